@@ -0,0 +1,236 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Admin API over active terminal sessions.
+//
+// GET /admin/sessions lists every connected terminal session on this plugin
+// instance with its user, VM, uptime, idle time and traffic, for building an
+// admin panel. Sessions are ordered by start time (then ID) so paging with
+// limit/offset is stable while sessions come and go at the end of the list.
+//
+// DELETE /admin/sessions/{id} force-disconnects a session: the learner gets a
+// final error message, the SSH session is closed and, with ?destroyVm=true,
+// the VM is destroyed as well.
+
+const (
+	defaultAdminSessionsLimit = 50
+	maxAdminSessionsLimit     = 500
+)
+
+// sessionTraffic counts a session's terminal traffic. A nil *sessionTraffic
+// ignores updates.
+type sessionTraffic struct {
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	messagesIn  atomic.Int64
+	messagesOut atomic.Int64
+}
+
+// recordIn counts one input or paste message of n bytes.
+func (t *sessionTraffic) recordIn(n int) {
+	if t == nil {
+		return
+	}
+	t.messagesIn.Add(1)
+	t.bytesIn.Add(int64(n))
+}
+
+// recordOut counts one output chunk of n bytes.
+func (t *sessionTraffic) recordOut(n int) {
+	if t == nil {
+		return
+	}
+	t.messagesOut.Add(1)
+	t.bytesOut.Add(int64(n))
+}
+
+// adminSessionInfo is the JSON view of an active session.
+type adminSessionInfo struct {
+	ID            string    `json:"id"`
+	User          string    `json:"user"`
+	VMID          string    `json:"vmId"`
+	Template      string    `json:"template,omitempty"`
+	Guide         string    `json:"guide,omitempty"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+	IdleSeconds   int64     `json:"idleSeconds"`
+	BytesIn       int64     `json:"bytesIn"`
+	BytesOut      int64     `json:"bytesOut"`
+	MessagesIn    int64     `json:"messagesIn"`
+	MessagesOut   int64     `json:"messagesOut"`
+	TakenOverBy   string    `json:"takenOverBy,omitempty"`
+}
+
+// adminSessionInfo snapshots sess for the admin API.
+func (a *App) adminSessionInfo(sess *streamSession) adminSessionInfo {
+	now := timeNow()
+	info := adminSessionInfo{
+		ID:            sess.id,
+		User:          sess.userLogin,
+		VMID:          sess.vmID,
+		Template:      sess.template,
+		Guide:         sess.logLabels.guide,
+		StartedAt:     sess.startedAt.UTC(),
+		UptimeSeconds: int64(now.Sub(sess.startedAt).Seconds()),
+		IdleSeconds:   int64(sess.idleFor().Seconds()),
+	}
+	if sess.traffic != nil {
+		info.BytesIn = sess.traffic.bytesIn.Load()
+		info.BytesOut = sess.traffic.bytesOut.Load()
+		info.MessagesIn = sess.traffic.messagesIn.Load()
+		info.MessagesOut = sess.traffic.messagesOut.Load()
+	}
+	if t := a.getTakeover(sess.id); t != nil {
+		info.TakenOverBy = t.admin
+	}
+	return info
+}
+
+// handleAdminSessions handles GET /admin/sessions?limit=N&offset=M&user=U
+// (admin only).
+func (a *App) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can list terminal sessions", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultAdminSessionsLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxAdminSessionsLimit {
+			a.writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxAdminSessionsLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if raw := query.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			a.writeError(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	userFilter := query.Get("user")
+
+	a.streamSessionsMu.Lock()
+	sessions := make([]*streamSession, 0, len(a.streamSessions))
+	for _, sess := range a.streamSessions {
+		if sess == nil || sess.session == nil {
+			continue
+		}
+		if userFilter != "" && sess.userLogin != userFilter {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	a.streamSessionsMu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].startedAt.Equal(sessions[j].startedAt) {
+			return sessions[i].startedAt.Before(sessions[j].startedAt)
+		}
+		return sessions[i].id < sessions[j].id
+	})
+
+	total := len(sessions)
+	result := []adminSessionInfo{}
+	for i := offset; i < total && len(result) < limit; i++ {
+		result = append(result, a.adminSessionInfo(sessions[i]))
+	}
+	a.writeJSON(w, map[string]interface{}{
+		"sessions": result,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	}, http.StatusOK)
+}
+
+// handleAdminSessionByID handles DELETE /admin/sessions/{id}?destroyVm=true&reason=R
+// (admin only).
+func (a *App) handleAdminSessionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can disconnect terminal sessions", http.StatusForbidden)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/admin/sessions/")
+	sess := a.findStreamSessionByID(id)
+	if sess == nil {
+		a.writeError(w, "Terminal session not found", http.StatusNotFound)
+		return
+	}
+	destroyVM := r.URL.Query().Get("destroyVm") == "true"
+	if destroyVM && a.coda == nil {
+		a.writeError(w, "Coda not registered - configure enrollment key and register first", http.StatusServiceUnavailable)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+
+	ctxLogger := a.ctxLogger(r.Context())
+	msg := "Your session was ended by an administrator"
+	if reason != "" {
+		msg += ": " + reason
+	}
+	a.endStreamSession(ctxLogger, sess, msg)
+
+	details := reason
+	var destroyErr error
+	if destroyVM {
+		if destroyErr = a.coda.DeleteVM(r.Context(), sess.vmID, true); destroyErr != nil {
+			ctxLogger.Error("Failed to destroy VM of disconnected session", "vmID", sess.vmID, "error", destroyErr)
+		} else {
+			a.clearUserVM(sess.userLogin, sess.vmID)
+			details = strings.TrimSpace("VM destroyed. " + reason)
+		}
+	}
+	a.recordAudit(ctxLogger, auditEntry{Actor: admin, Action: "session.disconnect", TargetUser: sess.userLogin, VMID: sess.vmID, SessionID: id, Details: details})
+	if destroyErr != nil {
+		a.writeError(w, "Session disconnected but the VM could not be destroyed: "+destroyErr.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endStreamSession sends msg to the learner as a final error and closes the
+// session's SSH connection.
+func (a *App) endStreamSession(ctxLogger log.Logger, sess *streamSession, msg string) {
+	sendStreamError(withCorrelationID(context.Background(), sess.id), sess.sender, msg)
+	if sess.cancel != nil {
+		sess.cancel()
+	}
+	if err := sess.session.Close(); err != nil {
+		ctxLogger.Warn("Failed to close terminal session", "sessionID", sess.id, "error", err)
+	}
+}
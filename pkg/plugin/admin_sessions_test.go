@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestHandleAdminSessions(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return base.Add(10 * time.Minute) }
+	defer func() { timeNow = restore }()
+
+	app := &App{logger: log.DefaultLogger, streamSessions: map[string]*streamSession{}}
+	for i, user := range []string{"carol", "alice", "bob"} {
+		sess := &streamSession{
+			id:        "sess-" + user,
+			vmID:      "vm-" + user,
+			userLogin: user,
+			session:   &TerminalSession{},
+			template:  "vm-aws",
+			startedAt: base.Add(time.Duration(i) * time.Minute),
+			traffic:   &sessionTraffic{},
+		}
+		sess.lastInput.Store(base.Add(9 * time.Minute).UnixNano())
+		app.streamSessions["terminal/vm-"+user+"/1"] = sess
+	}
+	app.streamSessions["terminal/vm-alice/1"].traffic.recordIn(3)
+	app.streamSessions["terminal/vm-alice/1"].traffic.recordOut(120)
+
+	w := httptest.NewRecorder()
+	app.handleAdminSessions(w, roleRequest(http.MethodGet, "/admin/sessions", "", "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+
+	list := func(query string) (sessions []adminSessionInfo, total int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleAdminSessions(w, roleRequest(http.MethodGet, "/admin/sessions"+query, "", "root", "Admin"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d body = %s", query, w.Code, w.Body)
+		}
+		var resp struct {
+			Sessions []adminSessionInfo `json:"sessions"`
+			Total    int                `json:"total"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Sessions, resp.Total
+	}
+
+	page1, total := list("?limit=2")
+	page2, _ := list("?limit=2&offset=2")
+	if total != 3 || len(page1) != 2 || len(page2) != 1 {
+		t.Fatalf("pages = %d + %d of %d", len(page1), len(page2), total)
+	}
+	if page1[0].User != "carol" || page1[1].User != "alice" || page2[0].User != "bob" {
+		t.Errorf("order = %s, %s, %s; want start order", page1[0].User, page1[1].User, page2[0].User)
+	}
+	alice := page1[1]
+	if alice.UptimeSeconds != 540 || alice.IdleSeconds != 60 || alice.BytesIn != 3 || alice.BytesOut != 120 || alice.MessagesOut != 1 {
+		t.Errorf("alice = %+v", alice)
+	}
+
+	if filtered, total := list("?user=bob"); total != 1 || filtered[0].ID != "sess-bob" {
+		t.Errorf("user filter = %+v", filtered)
+	}
+
+	w = httptest.NewRecorder()
+	app.handleAdminSessions(w, roleRequest(http.MethodGet, "/admin/sessions?limit=0", "", "root", "Admin"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: status = %d", w.Code)
+	}
+}
+
+func TestHandleAdminSessionByID_Disconnect(t *testing.T) {
+	rec, sender := newStreamRecorder(t)
+	cancelled := false
+	ts := &TerminalSession{VMID: "vm-1", stdin: &recordingWriter{}}
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), userVMs: map[string]string{"learner": "vm-1"}, streamSessions: map[string]*streamSession{
+		"terminal/vm-1/1": {id: "sess-1", vmID: "vm-1", userLogin: "learner", session: ts, sender: sender, cancel: func() { cancelled = true }},
+	}}
+
+	w := httptest.NewRecorder()
+	app.handleAdminSessionByID(w, roleRequest(http.MethodDelete, "/admin/sessions/sess-1", "", "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.handleAdminSessionByID(w, roleRequest(http.MethodDelete, "/admin/sessions/missing", "", "support", "Admin"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing: status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.handleAdminSessionByID(w, roleRequest(http.MethodDelete, "/admin/sessions/sess-1?destroyVm=true", "", "support", "Admin"))
+	if w.Code != http.StatusServiceUnavailable || cancelled {
+		t.Errorf("destroy without Coda: status = %d, cancelled = %v", w.Code, cancelled)
+	}
+
+	var deleted string
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = r.URL.Path
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	w = httptest.NewRecorder()
+	app.handleAdminSessionByID(w, roleRequest(http.MethodDelete, "/admin/sessions/sess-1?destroyVm=true&reason=crypto+mining", "", "support", "Admin"))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !cancelled || !ts.closed {
+		t.Errorf("cancelled = %v, closed = %v", cancelled, ts.closed)
+	}
+	if !strings.HasPrefix(deleted, "/api/v1/vms/vm-1") {
+		t.Errorf("DeleteVM path = %q", deleted)
+	}
+	if _, ok := app.userVMs["learner"]; ok {
+		t.Error("VM still tracked for learner")
+	}
+	if errs := rec.ofType("error"); len(errs) != 1 || !strings.Contains(errs[0].Error, "crypto mining") {
+		t.Errorf("client messages = %+v", errs)
+	}
+	if keys := app.store.keys(auditCollection); len(keys) != 1 {
+		t.Errorf("audit entries = %d", len(keys))
+	}
+}
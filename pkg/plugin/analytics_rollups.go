@@ -0,0 +1,339 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Analytics rollups.
+//
+// Guide opens and step positions (POST /history) and completions (POST
+// /learning-activity) are rolled up as they arrive, so the admin analytics
+// page charts aggregates instead of downloading events: per guide per day,
+// the opens, step updates, completions and distinct learners; and per
+// guide, each learner's furthest step, from which GET /analytics derives
+// the step drop-off funnel. Learners are kept as hashes of their login.
+// Daily rollups are kept for maxAnalyticsDays. Nothing is rolled up with
+// analytics off (see features.go).
+
+const (
+	analyticsCollection       = "analytics-rollups"
+	analyticsDayPrefix        = "day/"
+	analyticsFunnelPrefix     = "funnel/"
+	maxAnalyticsDays          = 400
+	defaultAnalyticsDays      = 30
+	maxAnalyticsFunnelLearner = 100_000
+
+	analyticsEventOpen     = "open"
+	analyticsEventStep     = "step"
+	analyticsEventComplete = "complete"
+)
+
+// analyticsDay is one guide's activity on one UTC day, keyed
+// day/YYYY-MM-DD/guide.
+type analyticsDay struct {
+	Day         string   `json:"day"`
+	Guide       string   `json:"guide"`
+	Opens       int      `json:"opens"`
+	StepUpdates int      `json:"stepUpdates"`
+	Completions int      `json:"completions"`
+	Learners    []string `json:"learners"`
+}
+
+// analyticsFunnel is each learner's furthest step in a guide, keyed
+// funnel/guide.
+type analyticsFunnel struct {
+	Guide      string          `json:"guide"`
+	TotalSteps int             `json:"totalSteps"`
+	Furthest   map[string]int  `json:"furthest"`
+	Completed  map[string]bool `json:"completed"`
+}
+
+type analyticsDayPoint struct {
+	Day         string `json:"day"`
+	Opens       int    `json:"opens"`
+	StepUpdates int    `json:"stepUpdates"`
+	Completions int    `json:"completions"`
+	Learners    int    `json:"learners"`
+}
+
+type analyticsGuideSummary struct {
+	Guide       string `json:"guide"`
+	Opens       int    `json:"opens"`
+	Completions int    `json:"completions"`
+}
+
+type analyticsFunnelStep struct {
+	Step    int `json:"step"`
+	Reached int `json:"reached"`
+	DropOff int `json:"dropOff"`
+}
+
+type analyticsFunnelResponse struct {
+	Guide      string                `json:"guide"`
+	TotalSteps int                   `json:"totalSteps"`
+	Learners   int                   `json:"learners"`
+	Completed  int                   `json:"completed"`
+	Steps      []analyticsFunnelStep `json:"steps"`
+}
+
+type analyticsResponse struct {
+	From   string                   `json:"from"`
+	To     string                   `json:"to"`
+	Daily  []analyticsDayPoint      `json:"daily"`
+	Guides []analyticsGuideSummary  `json:"guides"`
+	Funnel *analyticsFunnelResponse `json:"funnel,omitempty"`
+}
+
+func learnerHash(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rollupAnalytics adds one event to the rollups: kind is an analyticsEvent
+// constant, and step and totalSteps apply to step events.
+func (a *App) rollupAnalytics(kind, user, guide string, step, totalSteps int) {
+	if !a.featureEnabled(featureAnalytics) {
+		return
+	}
+	now := timeNow().UTC()
+	learner := learnerHash(user)
+	a.analyticsMu.Lock()
+	defer a.analyticsMu.Unlock()
+
+	dayKey := analyticsDayPrefix + activityDay(now) + "/" + guide
+	day := analyticsDay{Day: activityDay(now), Guide: guide, Learners: []string{}}
+	existed, err := a.store.get(analyticsCollection, dayKey, &day)
+	if err != nil {
+		a.logger.Warn("Failed to read analytics rollup", "key", dayKey, "error", err)
+		return
+	}
+	switch kind {
+	case analyticsEventOpen:
+		day.Opens++
+	case analyticsEventStep:
+		day.StepUpdates++
+	case analyticsEventComplete:
+		day.Completions++
+	}
+	if !slices.Contains(day.Learners, learner) {
+		day.Learners = append(day.Learners, learner)
+	}
+	if err := a.store.put(analyticsCollection, dayKey, day); err != nil {
+		a.logger.Warn("Failed to store analytics rollup", "key", dayKey, "error", err)
+	}
+	if !existed {
+		a.pruneAnalyticsDays(now)
+	}
+
+	if kind == analyticsEventOpen {
+		return
+	}
+	funnelKey := analyticsFunnelPrefix + guide
+	funnel := analyticsFunnel{Guide: guide}
+	if _, err := a.store.get(analyticsCollection, funnelKey, &funnel); err != nil {
+		a.logger.Warn("Failed to read analytics funnel", "guide", guide, "error", err)
+		return
+	}
+	if funnel.Furthest == nil {
+		funnel.Furthest, funnel.Completed = map[string]int{}, map[string]bool{}
+	}
+	if _, ok := funnel.Furthest[learner]; !ok && len(funnel.Furthest) >= maxAnalyticsFunnelLearner {
+		return
+	}
+	if kind == analyticsEventComplete {
+		funnel.Completed[learner] = true
+		step = max(funnel.TotalSteps-1, 0)
+	}
+	if totalSteps > 0 {
+		funnel.TotalSteps = totalSteps
+	}
+	if furthest, ok := funnel.Furthest[learner]; !ok || step > furthest {
+		funnel.Furthest[learner] = step
+	}
+	if err := a.store.put(analyticsCollection, funnelKey, funnel); err != nil {
+		a.logger.Warn("Failed to store analytics funnel", "guide", guide, "error", err)
+	}
+}
+
+// pruneAnalyticsDays deletes daily rollups older than maxAnalyticsDays.
+func (a *App) pruneAnalyticsDays(now time.Time) {
+	cutoff := activityDay(now.AddDate(0, 0, -maxAnalyticsDays))
+	if _, err := a.deleteRecords(analyticsCollection, func(key string) bool {
+		day, ok := strings.CutPrefix(key, analyticsDayPrefix)
+		return ok && day[:min(len(day), len(time.DateOnly))] < cutoff
+	}); err != nil {
+		a.logger.Warn("Failed to prune analytics rollups", "error", err)
+	}
+}
+
+// forgetAnalyticsLearner removes login's hash from the rollups, keeping
+// the counts, and returns how many rollups changed.
+func (a *App) forgetAnalyticsLearner(login string) (int, error) {
+	learner := learnerHash(login)
+	a.analyticsMu.Lock()
+	defer a.analyticsMu.Unlock()
+	changed := 0
+	for _, key := range a.store.keys(analyticsCollection) {
+		if strings.HasPrefix(key, analyticsDayPrefix) {
+			var day analyticsDay
+			if ok, err := a.store.get(analyticsCollection, key, &day); err != nil || !ok || !slices.Contains(day.Learners, learner) {
+				continue
+			}
+			day.Learners = slices.DeleteFunc(day.Learners, func(l string) bool { return l == learner })
+			if err := a.store.put(analyticsCollection, key, day); err != nil {
+				return changed, err
+			}
+			changed++
+			continue
+		}
+		var funnel analyticsFunnel
+		if ok, err := a.store.get(analyticsCollection, key, &funnel); err != nil || !ok {
+			continue
+		}
+		if _, ok := funnel.Furthest[learner]; !ok {
+			continue
+		}
+		delete(funnel.Furthest, learner)
+		delete(funnel.Completed, learner)
+		if err := a.store.put(analyticsCollection, key, funnel); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+func (f analyticsFunnel) response() *analyticsFunnelResponse {
+	resp := &analyticsFunnelResponse{Guide: f.Guide, TotalSteps: f.TotalSteps, Learners: len(f.Furthest), Steps: []analyticsFunnelStep{}}
+	for learner := range f.Furthest {
+		if f.Completed[learner] {
+			resp.Completed++
+		}
+	}
+	for step := 0; step < f.TotalSteps; step++ {
+		s := analyticsFunnelStep{Step: step}
+		for learner, furthest := range f.Furthest {
+			if furthest >= step {
+				s.Reached++
+			}
+			if furthest == step && !f.Completed[learner] {
+				s.DropOff++
+			}
+		}
+		resp.Steps = append(resp.Steps, s)
+	}
+	return resp
+}
+
+// handleAnalytics handles GET /analytics?from=&to=&guide= for admins:
+// daily totals for every day in the range, per-guide totals, and with
+// guide, its step funnel.
+func (a *App) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if userLoginFromContext(ctx) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(ctx) {
+		a.writeError(w, "Only admins can view analytics", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	to := timeNow().UTC()
+	if raw := q.Get("to"); raw != "" {
+		t, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			a.writeError(w, "to must be a date such as 2026-05-01", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(defaultAnalyticsDays - 1))
+	if raw := q.Get("from"); raw != "" {
+		t, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			a.writeError(w, "from must be a date such as 2026-04-01", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if from.After(to) || to.Sub(from) > maxAnalyticsDays*24*time.Hour {
+		a.writeError(w, "from must be before to and at most 400 days earlier", http.StatusBadRequest)
+		return
+	}
+	guide := q.Get("guide")
+	if guide != "" && !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "guide must be a guide ID such as alerting-101", http.StatusBadRequest)
+		return
+	}
+
+	resp := analyticsResponse{From: activityDay(from), To: activityDay(to), Daily: []analyticsDayPoint{}, Guides: []analyticsGuideSummary{}}
+	points := map[string]*analyticsDayPoint{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		resp.Daily = append(resp.Daily, analyticsDayPoint{Day: activityDay(d)})
+	}
+	for i := range resp.Daily {
+		points[resp.Daily[i].Day] = &resp.Daily[i]
+	}
+	guides := map[string]*analyticsGuideSummary{}
+	learners := map[string]map[string]bool{}
+	for _, key := range a.store.keys(analyticsCollection) {
+		if !strings.HasPrefix(key, analyticsDayPrefix) {
+			continue
+		}
+		var day analyticsDay
+		if ok, err := a.store.get(analyticsCollection, key, &day); err != nil || !ok {
+			continue
+		}
+		p, inRange := points[day.Day]
+		if !inRange || (guide != "" && day.Guide != guide) {
+			continue
+		}
+		p.Opens += day.Opens
+		p.StepUpdates += day.StepUpdates
+		p.Completions += day.Completions
+		if learners[day.Day] == nil {
+			learners[day.Day] = map[string]bool{}
+		}
+		for _, l := range day.Learners {
+			learners[day.Day][l] = true
+		}
+		g, ok := guides[day.Guide]
+		if !ok {
+			g = &analyticsGuideSummary{Guide: day.Guide}
+			guides[day.Guide] = g
+		}
+		g.Opens += day.Opens
+		g.Completions += day.Completions
+	}
+	for day, set := range learners {
+		points[day].Learners = len(set)
+	}
+	for _, g := range guides {
+		resp.Guides = append(resp.Guides, *g)
+	}
+	sort.Slice(resp.Guides, func(i, j int) bool {
+		if resp.Guides[i].Opens != resp.Guides[j].Opens {
+			return resp.Guides[i].Opens > resp.Guides[j].Opens
+		}
+		return resp.Guides[i].Guide < resp.Guides[j].Guide
+	})
+	if guide != "" {
+		funnel := analyticsFunnel{Guide: guide}
+		if _, err := a.store.get(analyticsCollection, analyticsFunnelPrefix+guide, &funnel); err != nil {
+			a.ctxLogger(ctx).Warn("Failed to read analytics funnel", "guide", guide, "error", err)
+		}
+		resp.Funnel = funnel.response()
+	}
+	a.writeJSON(w, resp, http.StatusOK)
+}
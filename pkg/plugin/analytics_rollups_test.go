@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsRollups(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC))
+	app := newTestApp(t)
+	history := func(user, body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleHistory(w, roleRequest(http.MethodPost, "/history", body, user, "Viewer"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("history: status %d: %s", w.Code, w.Body)
+		}
+	}
+	query := func(target, role string) (int, analyticsResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleAnalytics(w, roleRequest(http.MethodGet, target, "", "root", role))
+		var resp analyticsResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	history("ann", `{"guideId": "intro"}`)
+	history("ann", `{"guideId": "intro", "stepIndex": 2, "totalSteps": 4}`)
+	history("ann", `{"guideId": "intro", "stepIndex": 1}`)
+	history("bob", `{"guideId": "intro"}`)
+	history("bob", `{"guideId": "intro", "stepIndex": 0, "totalSteps": 4}`)
+	withFrozenTime(t, time.Date(2026, 5, 2, 9, 0, 0, 0, time.UTC))
+	history("cat", `{"guideId": "intro", "stepIndex": 1, "totalSteps": 4}`)
+	history("cat", `{"guideId": "other"}`)
+	w := httptest.NewRecorder()
+	app.handleLearningActivity(w, roleRequest(http.MethodPost, "/learning-activity", `{"guideId": "intro"}`, "cat", "Viewer"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("completion: status %d", w.Code)
+	}
+
+	if code, _ := query("/analytics", "Editor"); code != http.StatusForbidden {
+		t.Errorf("editor: status %d, want 403", code)
+	}
+	if code, _ := query("/analytics?from=2026-05-03&to=2026-05-01", "Admin"); code != http.StatusBadRequest {
+		t.Errorf("reversed range: status %d, want 400", code)
+	}
+	code, resp := query("/analytics?from=2026-04-30&to=2026-05-02&guide=intro", "Admin")
+	if code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	wantDaily := []analyticsDayPoint{
+		{Day: "2026-04-30"},
+		{Day: "2026-05-01", Opens: 2, StepUpdates: 3, Learners: 2},
+		{Day: "2026-05-02", StepUpdates: 1, Completions: 1, Learners: 1},
+	}
+	if len(resp.Daily) != len(wantDaily) {
+		t.Fatalf("daily = %+v", resp.Daily)
+	}
+	for i, want := range wantDaily {
+		if resp.Daily[i] != want {
+			t.Errorf("daily[%d] = %+v, want %+v", i, resp.Daily[i], want)
+		}
+	}
+	if len(resp.Guides) != 1 || resp.Guides[0] != (analyticsGuideSummary{Guide: "intro", Opens: 2, Completions: 1}) {
+		t.Errorf("guides = %+v", resp.Guides)
+	}
+	wantSteps := []analyticsFunnelStep{{Step: 0, Reached: 3, DropOff: 1}, {Step: 1, Reached: 2}, {Step: 2, Reached: 2, DropOff: 1}, {Step: 3, Reached: 1}}
+	if f := resp.Funnel; f == nil || f.TotalSteps != 4 || f.Learners != 3 || f.Completed != 1 || len(f.Steps) != len(wantSteps) {
+		t.Fatalf("funnel = %+v", resp.Funnel)
+	}
+	for i, want := range wantSteps {
+		if resp.Funnel.Steps[i] != want {
+			t.Errorf("step %d = %+v, want %+v", i, resp.Funnel.Steps[i], want)
+		}
+	}
+
+	_, resp = query("/analytics", "Admin")
+	if len(resp.Daily) != defaultAnalyticsDays || resp.Funnel != nil || len(resp.Guides) != 2 || resp.Guides[0].Guide != "intro" {
+		t.Errorf("default range: %d days, guides %+v, funnel %+v", len(resp.Daily), resp.Guides, resp.Funnel)
+	}
+}
+
+func TestAnalyticsRollups_SkippedWithAnalyticsOff(t *testing.T) {
+	app := newTestApp(t)
+	off := false
+	app.settings = &Settings{Features: FeatureFlags{Analytics: &off}}
+	app.rollupAnalytics(analyticsEventOpen, "ann", "intro", 0, 0)
+	if keys := app.store.keys(analyticsCollection); len(keys) != 0 {
+		t.Errorf("rollups = %v", keys)
+	}
+}
+
+func TestAnalyticsRollups_PrunesOldDays(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC))
+	app := newTestApp(t)
+	app.rollupAnalytics(analyticsEventOpen, "ann", "intro", 0, 0)
+	withFrozenTime(t, time.Date(2027, 6, 10, 9, 0, 0, 0, time.UTC))
+	app.rollupAnalytics(analyticsEventOpen, "ann", "intro", 0, 0)
+	if keys := app.store.keys(analyticsCollection); len(keys) != 1 || keys[0] != "day/2027-06-10/intro" {
+		t.Errorf("rollups = %v", keys)
+	}
+}
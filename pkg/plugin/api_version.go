@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Versioned resource API.
+//
+// Every route is served under /{apiVersion}/, e.g. /v1/vms. The unversioned
+// paths older frontends (still cached in browsers) and existing workshop
+// links call stay mounted as a compatibility layer: they reach the same
+// handlers and answer with a Deprecation header and a Link to the versioned
+// path. A breaking change ships as the next version alongside this one.
+
+const apiVersion = "v1"
+
+type apiVersionKey struct{}
+
+// apiVersionFromContext returns the API version the request was made under,
+// or "" for an unversioned path.
+func apiVersionFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(apiVersionKey{}).(string)
+	return v
+}
+
+// withAPIVersion serves h under /{version}. The prefix is stripped so
+// handlers parse the same paths whichever way they are reached.
+func withAPIVersion(version string, h http.HandlerFunc) http.HandlerFunc {
+	prefix := "/" + version
+	return func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(context.WithValue(r.Context(), apiVersionKey{}, version))
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+		h(w, r2)
+	}
+}
+
+// unversioned wraps h for the compatibility paths.
+func (a *App) unversioned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+pluginResourcesPath+"/"+apiVersion+r.URL.Path+`>; rel="successor-version"`)
+		a.ctxLogger(r.Context()).Debug("Unversioned resource path called", "path", r.URL.Path)
+		h(w, r)
+	}
+}
@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterRoutes_Versioned(t *testing.T) {
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/health", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Errorf("/v1/health: status = %d, Deprecation = %q", w.Code, w.Header().Get("Deprecation"))
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" {
+		t.Errorf("/health: status = %d, Deprecation = %q", w.Code, w.Header().Get("Deprecation"))
+	}
+	if link := w.Header().Get("Link"); link != `</api/plugins/grafana-pathfinder-app/resources/v1/health>; rel="successor-version"` {
+		t.Errorf("Link = %q", link)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/health", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /v1/health: status = %d", w.Code)
+	}
+}
+
+func TestHandleWorkshopClaim_RedirectDepth(t *testing.T) {
+	app := newTestApp(t)
+	app.userVMs = map[string]string{}
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	_ = app.store.put(workshopCollection, "ws", workshop{Name: "ws", VMs: []workshopVM{
+		{VMID: "vm-1", ClaimToken: "t1", State: workshopVMReady},
+		{VMID: "vm-2", ClaimToken: "t2", State: workshopVMReady},
+	}})
+
+	for _, c := range []struct{ path, user, want string }{
+		{"/v1/workshops/claim/t1", "alice", "../../../../../../../a/grafana-pathfinder-app"},
+		{"/workshops/claim/t2", "bob", "../../../../../../a/grafana-pathfinder-app"},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, c.path, nil), c.user))
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != c.want {
+			t.Errorf("%s: status = %d, Location = %q", c.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/grafana/grafana-plugin-sdk-go/config"
 )
 
 // Make sure App implements required interfaces.
@@ -40,7 +43,136 @@ type App struct {
 	userVMsMu sync.RWMutex
 
 	// Per-user rate limiter for POST /coda/exec
-	execRateLimiter *execRateLimiter
+	execRateLimiter *rateLimiter
+
+	// Per-user rate limiters for resource routes, by class; nil disables them
+	routeRateLimiters map[rateClass]*rateLimiter
+
+	// Org the instance serves; Grafana creates one instance per org
+	orgID int64
+
+	// Plugin-local persistence (workspaces); memory-only without StoragePath
+	store *jsonStore
+	// Reads of encrypted store documents since they were last audited (see
+	// store_crypto.go)
+	storeAccess storeAccessCounts
+
+	// Terminal log export; nil unless LokiURL is configured
+	loki *lokiExporter
+
+	// xAPI statements to an LRS; nil unless XAPIEndpoint is configured
+	xapi *xapiEmitter
+
+	// VM metrics forwarding; nil unless PromRemoteWriteURL is configured
+	metrics *remoteWriter
+
+	// Instructor terminal broadcasts (cohort -> broadcast)
+	broadcasts   map[string]*broadcast
+	broadcastsMu sync.Mutex
+
+	// Terminal sessions shared with a write lock (share ID -> share)
+	sharedTerminals   map[string]*sharedTerminal
+	sharedTerminalsMu sync.Mutex
+
+	// Admin takeovers of terminal sessions (session ID -> takeover)
+	takeovers   map[string]*sessionTakeover
+	takeoversMu sync.Mutex
+
+	// Guide presence channels (channel path -> members)
+	presence   map[string]*presenceChannel
+	presenceMu sync.Mutex
+
+	// Serializes learning activity updates
+	learningActivityMu sync.Mutex
+
+	// Serializes bookmark updates
+	bookmarksMu sync.Mutex
+
+	// Serializes guide history updates
+	historyMu sync.Mutex
+
+	// Serializes step progress syncs
+	progressMu sync.Mutex
+
+	// Serializes script publishes and deletes
+	scriptsMu sync.Mutex
+
+	// Loopback tunnels to VM services (user/vmID/name -> tunnel)
+	tunnels   map[string]*vmTunnel
+	tunnelsMu sync.Mutex
+
+	// Serializes VM resolution per workspace (owner/name -> lock)
+	workspaceLocks workspaceLocks
+
+	// Serializes read-modify-write of the monthly org usage record
+	orgUsageMu sync.Mutex
+
+	// Serializes provisioning schedule updates
+	schedulesMu sync.Mutex
+
+	// Serializes read-modify-write of workshop records
+	workshopsMu sync.Mutex
+
+	// Signatures of recently accepted webhook calls
+	webhookReplays webhookReplayCache
+
+	// Last terminal input per VM for idle destruction
+	idleVMs idleReaper
+
+	// Serializes read-modify-write of external identities
+	identitiesMu sync.Mutex
+	// guideReviewsMu serializes review changes (see guide_reviews.go).
+	guideReviewsMu sync.Mutex
+	// stepCommentsMu serializes step comment changes (see step_comments.go).
+	stepCommentsMu sync.Mutex
+	// stepReportsMu serializes broken-step reports (see guide_reports.go).
+	stepReportsMu sync.Mutex
+	// guideLocalesMu serializes translation changes (see guide_locales.go).
+	guideLocalesMu sync.Mutex
+	// experimentsMu serializes experiment and exposure changes (see
+	// experiments.go).
+	experimentsMu sync.Mutex
+	// analyticsMu serializes analytics rollup updates (see
+	// analytics_rollups.go).
+	analyticsMu sync.Mutex
+	// instanceContext caches what POST /recommend adds about the instance
+	// (see recommend_proxy.go).
+	instanceContextMu sync.Mutex
+	instanceContext   *recommendInstanceContext
+	instanceContextAt time.Time
+	// feedbackForwards counts recommendation feedback being forwarded (see
+	// recommend_feedback.go).
+	feedbackForwards atomic.Int32
+	// translationJobsMu serializes the machine translation queue (see
+	// guide_translation.go).
+	translationJobsMu sync.Mutex
+
+	// Serializes digest sends
+	digestMu sync.Mutex
+
+	// Per-source content refresh status (see content_refresh.go)
+	contentRefreshMu sync.Mutex
+	contentRefresh   map[string]*contentRefreshStatus
+
+	// CDN files being revalidated in the background (see cdn_cache.go)
+	cdnRevalidatingMu sync.Mutex
+	cdnRevalidating   map[string]bool
+
+	// Enrollment secrets from Vault, nil unless configured (see vault.go)
+	vault *vaultSecrets
+
+	// Drain before a restart (see drain.go)
+	drain instanceDrain
+
+	// Sessions left by the previous process (see session_records.go)
+	resumable resumableSessions
+
+	// Loops and workers stopped by Dispose (see background.go)
+	background backgroundJobs
+
+	// Grafana config from instance creation, for background jobs that call
+	// the Grafana API
+	grafanaCfg *config.GrafanaCfg
 }
 
 // NewApp creates a new App instance.
@@ -54,23 +186,61 @@ func NewApp(ctx context.Context, appSettings backend.AppInstanceSettings) (insta
 		settings = &Settings{}
 	}
 
+	store, err := newJSONStore(settings.StoragePath)
+	if err != nil {
+		logger.Warn("Failed to open plugin store, falling back to memory", "path", settings.StoragePath, "error", err)
+		store = newMemoryStore()
+	}
+
 	app := &App{
-		settings:        settings,
-		logger:          logger,
-		streamSessions:  make(map[string]*streamSession),
-		userVMs:         make(map[string]string),
-		execRateLimiter: newExecRateLimiter(),
+		settings:          settings,
+		orgID:             backend.PluginConfigFromContext(ctx).OrgID,
+		logger:            logger,
+		streamSessions:    make(map[string]*streamSession),
+		userVMs:           make(map[string]string),
+		execRateLimiter:   newExecRateLimiter(),
+		routeRateLimiters: newRouteRateLimiters(),
+		store:             store,
+		loki:              newLokiExporter(settings, logger),
+		xapi:              newXAPIEmitter(settings, logger),
+		metrics:           newRemoteWriter(settings),
+		grafanaCfg:        config.GrafanaConfigFromContext(ctx),
 	}
 
-	if settings.RefreshToken != "" && settings.CodaAPIURL != "" {
+	app.initStoreEncryption(settings)
+	app.initVaultSecrets(settings)
+	app.restoreSessionState()
+
+	if (settings.RefreshToken != "" || app.vault != nil) && settings.CodaAPIURL != "" {
 		app.coda = NewCodaClient(settings.CodaAPIURL, settings.RefreshToken)
 		logger.Info("Coda client initialized", "url", settings.CodaAPIURL)
+		sshSource, invalid := newSSHSourceRestriction(settings.SSHSourceCIDRs, settings.SSHSourceEgressIP)
+		if len(invalid) > 0 {
+			logger.Error("Ignoring invalid sshSourceCidrs entries", "entries", invalid)
+		}
+		app.coda.sshSource = sshSource
+		if app.vault != nil {
+			app.coda.missingTokenErr = app.vault.err
+		}
 	} else if settings.RefreshToken != "" {
 		logger.Warn("Coda API URL not configured, VM features disabled")
 	} else {
 		logger.Warn("Coda refresh token not configured, VM features disabled until registration")
 	}
 
+	app.startProvisioningScheduler()
+	app.startIdleReaper()
+	app.startRetentionCleanup()
+	app.startDigestScheduler()
+	app.startSelectorHealth()
+	app.startTranslationWorker()
+	app.startContentRefresh()
+	app.startVaultRenewal()
+	app.startSessionRecordFlush()
+	if err := terminalGRPC.attach(app); err != nil {
+		logger.Error("gRPC terminal transport disabled", "error", err)
+	}
+
 	// Set up HTTP routes using httpadapter
 	mux := http.NewServeMux()
 	app.registerRoutes(mux)
@@ -82,6 +252,7 @@ func NewApp(ctx context.Context, appSettings backend.AppInstanceSettings) (insta
 // Dispose is called when the plugin is being shut down.
 func (a *App) Dispose() {
 	a.logger.Info("Disposing plugin instance")
+	a.drainForDispose()
 
 	// Close all active streaming sessions
 	a.streamSessionsMu.Lock()
@@ -98,6 +269,16 @@ func (a *App) Dispose() {
 	}
 	a.streamSessionsMu.Unlock()
 
+	a.stopBackground()
+	a.auditStoreAccess()
+	terminalGRPC.detach(a)
+	a.stopAllBroadcasts()
+	a.stopAllSharedTerminals()
+	a.stopAllPresence()
+	a.closeVMTunnels(func(vmTunnelInfo) bool { return true })
+	a.loki.close()
+	a.xapi.close()
+
 	// Clear user VM mappings
 	a.userVMsMu.Lock()
 	for k := range a.userVMs {
@@ -106,6 +287,15 @@ func (a *App) Dispose() {
 	a.userVMsMu.Unlock()
 }
 
+// grafanaConfigContext returns ctx carrying the Grafana config the instance
+// was created with, for work that doesn't run under a request.
+func (a *App) grafanaConfigContext(ctx context.Context) context.Context {
+	if a.grafanaCfg == nil {
+		return ctx
+	}
+	return config.WithGrafanaConfig(ctx, a.grafanaCfg)
+}
+
 // ctxLogger returns a contextual logger that automatically includes traceID,
 // endpoint, pluginID, and other metadata from the context for better debugging.
 func (a *App) ctxLogger(ctx context.Context) log.Logger {
@@ -124,8 +314,11 @@ func (a *App) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest)
 		message = "Coda not registered - configure enrollment key and register to enable VM features"
 	}
 
-	return &backend.CheckHealthResult{
+	result := &backend.CheckHealthResult{
 		Status:  status,
 		Message: message,
-	}, nil
+	}
+	a.reportVaultHealth(result)
+	a.reportMirrorHealth(ctx, result)
+	return result, nil
 }
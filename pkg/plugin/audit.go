@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Audit log of admin actions on other users' terminal sessions.
+//
+// Entries are appended to the plugin store (newest maxAuditEntries kept) and
+// also written to the plugin log, so they survive restarts when a
+// storagePath is configured and reach the server logs either way.
+
+const (
+	auditCollection = "audit-log"
+	maxAuditEntries = 1000
+
+	defaultAuditLimit = 100
+)
+
+// auditEntry is one recorded admin action.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetUser string    `json:"targetUser,omitempty"`
+	VMID       string    `json:"vmId,omitempty"`
+	SessionID  string    `json:"sessionId,omitempty"`
+	Details    string    `json:"details,omitempty"`
+}
+
+// recordAudit stores entry and drops the oldest entries beyond
+// maxAuditEntries. Failures are logged; they never block the action.
+func (a *App) recordAudit(ctxLogger log.Logger, entry auditEntry) {
+	now := timeNow().UTC()
+	entry.Time = now
+	ctxLogger.Info("Audit", "action", entry.Action, "actor", entry.Actor, "targetUser", entry.TargetUser,
+		"vmID", entry.VMID, "sessionID", entry.SessionID, "details", entry.Details)
+
+	if err := a.store.put(auditCollection, fmt.Sprintf("%020d", now.UnixNano()), entry); err != nil {
+		ctxLogger.Error("Failed to record audit entry", "action", entry.Action, "error", err)
+		return
+	}
+	keys := a.store.keys(auditCollection)
+	for len(keys) > maxAuditEntries {
+		if err := a.store.delete(auditCollection, keys[0]); err != nil {
+			ctxLogger.Error("Failed to prune audit log", "error", err)
+			return
+		}
+		keys = keys[1:]
+	}
+}
+
+// handleAuditLog handles GET /admin/audit-log?limit=N (admin only), newest
+// first.
+func (a *App) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can read the audit log", http.StatusForbidden)
+		return
+	}
+
+	limit := defaultAuditLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxAuditEntries {
+			a.writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxAuditEntries), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	keys := a.store.keys(auditCollection)
+	entries := []auditEntry{}
+	for i := len(keys) - 1; i >= 0 && len(entries) < limit; i-- {
+		var entry auditEntry
+		if ok, err := a.store.get(auditCollection, keys[i], &entry); err != nil || !ok {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	a.writeJSON(w, map[string]interface{}{"entries": entries}, http.StatusOK)
+}
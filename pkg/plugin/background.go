@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundJobs are the instance's loops and workers. Dispose cancels them
+// and waits for them to return.
+type backgroundJobs struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// goBackground runs fn with a context cancelled by Dispose. Once the
+// instance is disposed it returns false without running fn.
+func (a *App) goBackground(fn func(ctx context.Context)) bool {
+	b := &a.background
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return false
+	}
+	if b.ctx == nil {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	}
+	ctx := b.ctx
+	b.wg.Add(1)
+	b.mu.Unlock()
+	go func() {
+		defer b.wg.Done()
+		fn(ctx)
+	}()
+	return true
+}
+
+// runEvery calls fn every interval until the instance is disposed.
+func (a *App) runEvery(interval time.Duration, fn func(ctx context.Context)) {
+	a.runScheduled(interval, func(ctx context.Context) time.Duration {
+		fn(ctx)
+		return interval
+	})
+}
+
+// runScheduled calls fn after first, then again after each delay fn
+// returns, until the instance is disposed.
+func (a *App) runScheduled(first time.Duration, fn func(ctx context.Context) time.Duration) {
+	a.goBackground(func(ctx context.Context) {
+		timer := time.NewTimer(first)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				timer.Reset(fn(ctx))
+			}
+		}
+	})
+}
+
+// stopBackground cancels background work and waits for it to return.
+func (a *App) stopBackground() {
+	b := &a.background
+	b.mu.Lock()
+	b.stopped = true
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
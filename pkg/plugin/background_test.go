@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundJobs(t *testing.T) {
+	app := newTestApp(t)
+	var runs atomic.Int32
+	ran := make(chan struct{}, 1)
+	app.runEvery(time.Millisecond, func(context.Context) {
+		runs.Add(1)
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+	stopped := make(chan struct{})
+	app.goBackground(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	<-ran
+
+	app.stopBackground()
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("stopBackground returned before its work did")
+	}
+	after := runs.Load()
+	if app.goBackground(func(context.Context) { t.Error("ran after stop") }) {
+		t.Error("goBackground accepted work after stop")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("runEvery kept running after stop")
+	}
+}
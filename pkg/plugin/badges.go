@@ -0,0 +1,315 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Badges and achievements.
+//
+// Badges are earned from the learning activity in leaderboard.go. The
+// built-in ones share IDs with the frontend's badges that can be judged from
+// completions and streaks; learning path badges depend on path definitions
+// only the frontend has, so it keeps awarding those. Admins add org badges
+// with POST /badges. Triggers mirror the frontend's BadgeTrigger, plus
+// category-completed for "completed 5 alerting guides":
+//
+//	{"type": "guide-completed"}                                  any guide
+//	{"type": "guide-completed", "guideId": "alerting-101"}       a specific guide
+//	{"type": "guide-completed", "count": 10}                     10 distinct guides
+//	{"type": "category-completed", "category": "alerting", "count": 5}
+//	{"type": "streak", "days": 7}                                longest streak
+//
+// Badges are awarded when a completion is recorded and when earned badges
+// are listed, so a new org badge reaches users who already qualify. Earned
+// badges keep their earnedAt; a deleted org badge is no longer listed.
+
+const (
+	badgeCollection = "badges"
+	maxOrgBadges    = 100
+
+	badgeGuideCompleted    = "guide-completed"
+	badgeCategoryCompleted = "category-completed"
+	badgeStreak            = "streak"
+)
+
+// badge is a badge definition.
+type badge struct {
+	ID          string       `json:"id" validate:"required,pattern=name"`
+	Title       string       `json:"title" validate:"required,max=100"`
+	Description string       `json:"description,omitempty" validate:"max=500"`
+	Icon        string       `json:"icon,omitempty" validate:"max=50"`
+	Emoji       string       `json:"emoji,omitempty" validate:"max=16"`
+	Trigger     badgeTrigger `json:"trigger"`
+	BuiltIn     bool         `json:"builtIn,omitempty"`
+	CreatedBy   string       `json:"createdBy,omitempty"`
+	CreatedAt   *time.Time   `json:"createdAt,omitempty"`
+}
+
+// badgeTrigger is the condition for earning a badge.
+type badgeTrigger struct {
+	Type     string `json:"type" validate:"required,oneof=guide-completed category-completed streak"`
+	GuideID  string `json:"guideId,omitempty" validate:"pattern=guideId"`
+	Category string `json:"category,omitempty" validate:"pattern=name"`
+	Count    int    `json:"count,omitempty" validate:"min=0,max=1000"`
+	Days     int    `json:"days,omitempty" validate:"min=0,max=400"`
+}
+
+// earnedBadge is a badge a user has earned.
+type earnedBadge struct {
+	badge
+	EarnedAt time.Time `json:"earnedAt"`
+}
+
+var builtInBadges = []badge{
+	{ID: "first-steps", Title: "First steps", Description: "Complete your first guide", Icon: "rocket", Trigger: badgeTrigger{Type: badgeGuideCompleted}},
+	{ID: "consistent-learner", Title: "Consistent Learner", Description: "Maintain a 3-day learning streak", Icon: "fire", Trigger: badgeTrigger{Type: badgeStreak, Days: 3}},
+	{ID: "dedicated-learner", Title: "Dedicated Learner", Description: "Maintain a 7-day learning streak", Icon: "star", Trigger: badgeTrigger{Type: badgeStreak, Days: 7}},
+}
+
+// check returns why the trigger is invalid, or "" if it isn't.
+func (t badgeTrigger) check() string {
+	if errs := validateRequest(t); len(errs) > 0 {
+		return "trigger." + errs[0].Field + " " + errs[0].Message
+	}
+	switch {
+	case t.Type == badgeCategoryCompleted && t.Category == "":
+		return "trigger.category is required for category-completed"
+	case t.Type == badgeStreak && t.Days == 0:
+		return "trigger.days is required for streak"
+	case t.Type == badgeGuideCompleted && t.GuideID != "" && t.Count > 1:
+		return "trigger.count can't be combined with trigger.guideId"
+	}
+	return ""
+}
+
+// earned reports whether activity meets the trigger.
+func (t badgeTrigger) earned(l learnerActivity) bool {
+	count := max(t.Count, 1)
+	switch t.Type {
+	case badgeGuideCompleted:
+		if t.GuideID != "" {
+			_, ok := l.Guides[t.GuideID]
+			return ok
+		}
+		return len(l.Guides) >= count
+	case badgeCategoryCompleted:
+		n := 0
+		for _, g := range l.Guides {
+			if g.Category == t.Category {
+				n++
+			}
+		}
+		return n >= count
+	case badgeStreak:
+		return l.LongestStreak >= t.Days
+	}
+	return false
+}
+
+// pendingBadges returns the IDs of the badges in defs that activity meets
+// but hasn't been awarded yet.
+func (l learnerActivity) pendingBadges(defs []badge) []string {
+	var ids []string
+	for _, b := range defs {
+		if _, ok := l.Badges[b.ID]; !ok && b.Trigger.earned(l) {
+			ids = append(ids, b.ID)
+		}
+	}
+	return ids
+}
+
+// awardBadges marks the pending badges in defs as earned at now and returns
+// their IDs.
+func (l *learnerActivity) awardBadges(defs []badge, now time.Time) []string {
+	ids := l.pendingBadges(defs)
+	if len(ids) > 0 && l.Badges == nil {
+		l.Badges = map[string]time.Time{}
+	}
+	for _, id := range ids {
+		l.Badges[id] = now
+	}
+	return ids
+}
+
+// badgeDefinitions returns the built-in badges followed by the org's, by ID.
+func (a *App) badgeDefinitions() []badge {
+	defs := append([]badge(nil), builtInBadges...)
+	for i := range defs {
+		defs[i].BuiltIn = true
+	}
+	var org []badge
+	for _, key := range a.store.keys(badgeCollection) {
+		var b badge
+		if ok, err := a.store.get(badgeCollection, key, &b); err == nil && ok {
+			org = append(org, b)
+		}
+	}
+	sort.Slice(org, func(i, j int) bool { return org[i].ID < org[j].ID })
+	return append(defs, org...)
+}
+
+func isBuiltInBadge(id string) bool {
+	for _, b := range builtInBadges {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// handleBadges handles GET (list definitions) and POST (define an org badge,
+// admin only) on /badges.
+func (a *App) handleBadges(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"badges": a.badgeDefinitions()}, http.StatusOK)
+	case http.MethodPost:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can define badges", http.StatusForbidden)
+			return
+		}
+		var req badge
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if msg := req.Trigger.check(); msg != "" {
+			a.writeError(w, "Invalid request body: "+msg, http.StatusBadRequest)
+			return
+		}
+		if req.ID == "earned" || isBuiltInBadge(req.ID) {
+			a.writeError(w, fmt.Sprintf("Badge ID %q is reserved", req.ID), http.StatusConflict)
+			return
+		}
+		if ok, _ := a.store.get(badgeCollection, req.ID, &badge{}); ok {
+			a.writeError(w, fmt.Sprintf("Badge %q already exists", req.ID), http.StatusConflict)
+			return
+		}
+		if len(a.store.keys(badgeCollection)) >= maxOrgBadges {
+			a.writeError(w, fmt.Sprintf("An org can define at most %d badges", maxOrgBadges), http.StatusConflict)
+			return
+		}
+		req.BuiltIn = false
+		req.CreatedBy = user
+		now := timeNow().UTC()
+		req.CreatedAt = &now
+		if err := a.store.put(badgeCollection, req.ID, req); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store badge", "badge", req.ID, "error", err)
+			a.writeError(w, "Failed to store the badge", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: user, Action: "badge.create", Details: req.ID})
+		a.writeJSON(w, req, http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBadgeByID handles PUT and DELETE /badges/{id} for org badges (admin
+// only).
+func (a *App) handleBadgeByID(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage badges", http.StatusForbidden)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/badges/")
+	if isBuiltInBadge(id) {
+		a.writeError(w, "Built-in badges can't be changed", http.StatusConflict)
+		return
+	}
+	var existing badge
+	if ok, err := a.store.get(badgeCollection, id, &existing); err != nil || !ok {
+		a.writeError(w, "Badge not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req badge
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if msg := req.Trigger.check(); msg != "" {
+			a.writeError(w, "Invalid request body: "+msg, http.StatusBadRequest)
+			return
+		}
+		if req.ID != id {
+			a.writeError(w, "id can't be changed", http.StatusBadRequest)
+			return
+		}
+		req.BuiltIn = false
+		req.CreatedBy = existing.CreatedBy
+		req.CreatedAt = existing.CreatedAt
+		if err := a.store.put(badgeCollection, id, req); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store badge", "badge", id, "error", err)
+			a.writeError(w, "Failed to store the badge", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: user, Action: "badge.update", Details: id})
+		a.writeJSON(w, req, http.StatusOK)
+	case http.MethodDelete:
+		if err := a.store.delete(badgeCollection, id); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to delete badge", "badge", id, "error", err)
+			a.writeError(w, "Failed to delete the badge", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: user, Action: "badge.delete", Details: id})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEarnedBadges handles GET /badges/earned?user=. Users see their own
+// badges; admins can name another user.
+func (a *App) handleEarnedBadges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller := userLoginFromContext(r.Context())
+	if caller == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	user := caller
+	if u := r.URL.Query().Get("user"); u != "" && u != caller {
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can list another user's badges", http.StatusForbidden)
+			return
+		}
+		user = u
+	}
+
+	defs := a.badgeDefinitions()
+	now := timeNow().UTC()
+	activity := a.loadLearnerActivity(user)
+	if len(activity.pendingBadges(defs)) > 0 {
+		var err error
+		if activity, err = a.updateLearnerActivity(user, func(l *learnerActivity) { l.awardBadges(defs, now) }); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store earned badges", "user", user, "error", err)
+		}
+	}
+
+	earned := []earnedBadge{}
+	for _, b := range defs {
+		if at, ok := activity.Badges[b.ID]; ok {
+			earned = append(earned, earnedBadge{badge: b, EarnedAt: at})
+		}
+	}
+	sort.SliceStable(earned, func(i, j int) bool { return earned[i].EarnedAt.Before(earned[j].EarnedAt) })
+	a.writeJSON(w, map[string]interface{}{"user": user, "badges": earned}, http.StatusOK)
+}
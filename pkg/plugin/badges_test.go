@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBadgeTriggerEarned(t *testing.T) {
+	activity := learnerActivity{
+		Guides: map[string]guideCompletion{
+			"alerting-101": {Category: "alerting"},
+			"alerting-201": {Category: "alerting"},
+			"loki-101":     {Category: "logs"},
+		},
+		LongestStreak: 4,
+	}
+	for _, tc := range []struct {
+		trigger badgeTrigger
+		want    bool
+	}{
+		{badgeTrigger{Type: badgeGuideCompleted}, true},
+		{badgeTrigger{Type: badgeGuideCompleted, GuideID: "loki-101"}, true},
+		{badgeTrigger{Type: badgeGuideCompleted, GuideID: "tempo-101"}, false},
+		{badgeTrigger{Type: badgeGuideCompleted, Count: 3}, true},
+		{badgeTrigger{Type: badgeGuideCompleted, Count: 4}, false},
+		{badgeTrigger{Type: badgeCategoryCompleted, Category: "alerting", Count: 2}, true},
+		{badgeTrigger{Type: badgeCategoryCompleted, Category: "alerting", Count: 3}, false},
+		{badgeTrigger{Type: badgeStreak, Days: 3}, true},
+		{badgeTrigger{Type: badgeStreak, Days: 7}, false},
+	} {
+		if got := tc.trigger.earned(activity); got != tc.want {
+			t.Errorf("%+v: earned = %v, want %v", tc.trigger, got, tc.want)
+		}
+	}
+}
+
+func TestBadges(t *testing.T) {
+	app := newTestApp(t)
+	advance := withFrozenTime(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	serve := func(h http.HandlerFunc, method, target, body, user, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(w, roleRequest(method, target, body, user, role))
+		return w
+	}
+	complete := func(guide string) learnerStats {
+		t.Helper()
+		w := serve(app.handleLearningActivity, http.MethodPost, "/learning-activity", `{"guideId": "`+guide+`", "category": "alerting"}`, "ana", "Viewer")
+		var s learnerStats
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("complete %s: status=%d body=%s", guide, w.Code, w.Body.String())
+		}
+		return s
+	}
+	earned := func(query, user, role string) []earnedBadge {
+		t.Helper()
+		w := serve(app.handleEarnedBadges, http.MethodGet, "/badges/earned"+query, "", user, role)
+		var resp struct{ Badges []earnedBadge }
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("earned%s as %s: status=%d body=%s", query, user, w.Code, w.Body.String())
+		}
+		return resp.Badges
+	}
+
+	if s := complete("alerting-101"); len(s.NewBadges) != 1 || s.NewBadges[0] != "first-steps" {
+		t.Errorf("first completion awarded %v", s.NewBadges)
+	}
+	if s := complete("alerting-101"); len(s.NewBadges) != 0 {
+		t.Errorf("repeat completion awarded %v", s.NewBadges)
+	}
+	advance(24 * time.Hour)
+	complete("alerting-201")
+
+	const alerting = `{"id": "alert-ace", "title": "Alert ace", "trigger": {"type": "category-completed", "category": "alerting", "count": 2}}`
+	for _, tc := range []struct {
+		body, role string
+		want       int
+	}{
+		{alerting, "Editor", http.StatusForbidden},
+		{`{"id": "first-steps", "title": "Mine", "trigger": {"type": "guide-completed"}}`, "Admin", http.StatusConflict},
+		{`{"id": "earned", "title": "Mine", "trigger": {"type": "guide-completed"}}`, "Admin", http.StatusConflict},
+		{`{"id": "x", "title": "X", "trigger": {"type": "paths"}}`, "Admin", http.StatusBadRequest},
+		{`{"id": "x", "title": "X", "trigger": {"type": "category-completed"}}`, "Admin", http.StatusBadRequest},
+		{`{"id": "x", "title": "X", "trigger": {"type": "streak"}}`, "Admin", http.StatusBadRequest},
+		{`{"id": "Bad ID", "title": "X", "trigger": {"type": "streak", "days": 2}}`, "Admin", http.StatusBadRequest},
+		{alerting, "Admin", http.StatusCreated},
+		{alerting, "Admin", http.StatusConflict},
+	} {
+		if w := serve(app.handleBadges, http.MethodPost, "/badges", tc.body, "root", tc.role); w.Code != tc.want {
+			t.Errorf("create %s as %s: status=%d, want %d (%s)", tc.body, tc.role, w.Code, tc.want, w.Body.String())
+		}
+	}
+
+	// ana already qualifies for the new badge and gets it when listing.
+	advance(time.Hour)
+	got := earned("", "ana", "Viewer")
+	if len(got) != 2 || got[0].ID != "first-steps" || !got[0].BuiltIn || got[1].ID != "alert-ace" || !got[1].EarnedAt.Equal(timeNow()) {
+		t.Fatalf("earned = %+v", got)
+	}
+	if again := earned("", "ana", "Viewer"); !again[1].EarnedAt.Equal(got[1].EarnedAt) {
+		t.Errorf("earnedAt changed: %v", again[1].EarnedAt)
+	}
+
+	if w := serve(app.handleEarnedBadges, http.MethodGet, "/badges/earned?user=ana", "", "bo", "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("bo listing ana's badges: status=%d", w.Code)
+	}
+	if got := earned("?user=ana", "root", "Admin"); len(got) != 2 {
+		t.Errorf("admin view = %+v", got)
+	}
+	if got := earned("", "bo", "Viewer"); got == nil || len(got) != 0 {
+		t.Errorf("bo's badges = %+v", got)
+	}
+
+	w := serve(app.handleBadgeByID, http.MethodPut, "/badges/alert-ace", `{"id": "alert-ace", "title": "Alerting ace", "trigger": {"type": "category-completed", "category": "alerting", "count": 5}}`, "root", "Admin")
+	var updated badge
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil || w.Code != http.StatusOK || updated.Title != "Alerting ace" || updated.CreatedBy != "root" {
+		t.Errorf("update: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := serve(app.handleBadgeByID, http.MethodDelete, "/badges/first-steps", "", "root", "Admin"); w.Code != http.StatusConflict {
+		t.Errorf("delete built-in: status=%d", w.Code)
+	}
+	if w := serve(app.handleBadgeByID, http.MethodDelete, "/badges/alert-ace", "", "root", "Admin"); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status=%d", w.Code)
+	}
+	if w := serve(app.handleBadgeByID, http.MethodDelete, "/badges/alert-ace", "", "root", "Admin"); w.Code != http.StatusNotFound {
+		t.Errorf("delete again: status=%d", w.Code)
+	}
+	if got := earned("", "ana", "Viewer"); len(got) != 1 {
+		t.Errorf("earned after delete = %+v", got)
+	}
+}
@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Guide bookmarks.
+//
+// Users save guides for later with POST /bookmarks, list them with GET
+// /bookmarks (newest first) and remove them with DELETE
+// /bookmarks/{guideId}. They're kept in the plugin store, one document per
+// user, so they follow the user across devices. Package recommendations
+// flag the caller's bookmarked packages.
+
+const (
+	bookmarkCollection  = "bookmarks"
+	maxBookmarksPerUser = 200
+)
+
+// guideBookmark is one saved guide.
+type guideBookmark struct {
+	GuideID   string    `json:"guideId"`
+	Title     string    `json:"title,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// userBookmarks is the stored document for one user.
+type userBookmarks struct {
+	Bookmarks []guideBookmark `json:"bookmarks"`
+}
+
+// CreateBookmarkRequest is the JSON body for POST /bookmarks.
+type CreateBookmarkRequest struct {
+	GuideID string `json:"guideId" validate:"required,pattern=guideId"`
+	Title   string `json:"title,omitempty" validate:"max=200"`
+	URL     string `json:"url,omitempty" validate:"max=2000"`
+	Note    string `json:"note,omitempty" validate:"max=500"`
+}
+
+func (a *App) listBookmarks(user string) []guideBookmark {
+	var doc userBookmarks
+	if _, err := a.store.get(bookmarkCollection, user, &doc); err != nil {
+		a.logger.Warn("Failed to read bookmarks", "user", user, "error", err)
+	}
+	bookmarks := append([]guideBookmark{}, doc.Bookmarks...)
+	sort.SliceStable(bookmarks, func(i, j int) bool { return bookmarks[i].CreatedAt.After(bookmarks[j].CreatedAt) })
+	return bookmarks
+}
+
+// bookmarkedGuides returns the set of guide IDs user bookmarked.
+func (a *App) bookmarkedGuides(user string) map[string]bool {
+	set := map[string]bool{}
+	for _, b := range a.listBookmarks(user) {
+		set[b.GuideID] = true
+	}
+	return set
+}
+
+// updateBookmarks applies fn to user's bookmarks and stores the result.
+// fn's error is returned without storing.
+func (a *App) updateBookmarks(user string, fn func([]guideBookmark) ([]guideBookmark, error)) error {
+	a.bookmarksMu.Lock()
+	defer a.bookmarksMu.Unlock()
+	var doc userBookmarks
+	if _, err := a.store.get(bookmarkCollection, user, &doc); err != nil {
+		return err
+	}
+	bookmarks, err := fn(doc.Bookmarks)
+	if err != nil {
+		return err
+	}
+	if len(bookmarks) == 0 {
+		return a.store.delete(bookmarkCollection, user)
+	}
+	return a.store.put(bookmarkCollection, user, userBookmarks{Bookmarks: bookmarks})
+}
+
+var (
+	errBookmarkLimit    = errors.New("bookmark limit reached")
+	errBookmarkNotFound = errors.New("bookmark not found")
+)
+
+// handleBookmarks handles GET (list) and POST (add) on /bookmarks. Adding a
+// guide that is already bookmarked updates its title, URL and note.
+func (a *App) handleBookmarks(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"bookmarks": a.listBookmarks(user)}, http.StatusOK)
+	case http.MethodPost:
+		var req CreateBookmarkRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		saved := guideBookmark{GuideID: req.GuideID, Title: req.Title, URL: req.URL, Note: req.Note, CreatedAt: timeNow().UTC()}
+		status := http.StatusCreated
+		err := a.updateBookmarks(user, func(bookmarks []guideBookmark) ([]guideBookmark, error) {
+			for i, b := range bookmarks {
+				if b.GuideID == req.GuideID {
+					saved.CreatedAt = b.CreatedAt
+					bookmarks[i] = saved
+					status = http.StatusOK
+					return bookmarks, nil
+				}
+			}
+			if len(bookmarks) >= maxBookmarksPerUser {
+				return nil, errBookmarkLimit
+			}
+			return append(bookmarks, saved), nil
+		})
+		if errors.Is(err, errBookmarkLimit) {
+			a.writeError(w, fmt.Sprintf("You can bookmark at most %d guides", maxBookmarksPerUser), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store bookmark", "user", user, "guideId", req.GuideID, "error", err)
+			a.writeError(w, "Failed to store the bookmark", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, saved, status)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBookmarkByGuide handles DELETE /bookmarks/{guideId}.
+func (a *App) handleBookmarkByGuide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	guideID := strings.TrimPrefix(r.URL.Path, "/bookmarks/")
+	err := a.updateBookmarks(user, func(bookmarks []guideBookmark) ([]guideBookmark, error) {
+		for i, b := range bookmarks {
+			if b.GuideID == guideID {
+				return append(bookmarks[:i], bookmarks[i+1:]...), nil
+			}
+		}
+		return nil, errBookmarkNotFound
+	})
+	if errors.Is(err, errBookmarkNotFound) {
+		a.writeError(w, "Bookmark not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to delete bookmark", "user", user, "guideId", guideID, "error", err)
+		a.writeError(w, "Failed to delete the bookmark", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
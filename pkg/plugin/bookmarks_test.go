@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBookmarks(t *testing.T) {
+	app := newTestApp(t)
+	advance := withFrozenTime(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	serve := func(h http.HandlerFunc, method, target, body, user string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(w, roleRequest(method, target, body, user, "Viewer"))
+		return w
+	}
+	list := func(user string) []guideBookmark {
+		t.Helper()
+		var resp struct{ Bookmarks []guideBookmark }
+		if err := json.Unmarshal(serve(app.handleBookmarks, http.MethodGet, "/bookmarks", "", user).Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Bookmarks
+	}
+
+	if w := serve(app.handleBookmarks, http.MethodPost, "/bookmarks", `{"guideId": "alerting-101", "title": "Alerting"}`, "ana"); w.Code != http.StatusCreated {
+		t.Fatalf("add: status=%d body=%s", w.Code, w.Body.String())
+	}
+	advance(time.Minute)
+	if w := serve(app.handleBookmarks, http.MethodPost, "/bookmarks", `{"guideId": "loki-101"}`, "ana"); w.Code != http.StatusCreated {
+		t.Fatalf("add: status=%d", w.Code)
+	}
+	advance(time.Minute)
+	if w := serve(app.handleBookmarks, http.MethodPost, "/bookmarks", `{"guideId": "alerting-101", "note": "after lunch"}`, "ana"); w.Code != http.StatusOK {
+		t.Errorf("re-add: status=%d", w.Code)
+	}
+	got := list("ana")
+	if len(got) != 2 || got[0].GuideID != "loki-101" || got[1].Note != "after lunch" || got[1].Title != "" || !got[1].CreatedAt.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("bookmarks = %+v", got)
+	}
+	if got := list("bo"); got == nil || len(got) != 0 {
+		t.Errorf("bo's bookmarks = %+v", got)
+	}
+
+	for _, body := range []string{`{}`, `{"guideId": "bad guide"}`, `{"guideId": "x", "note": "` + strings.Repeat("x", 501) + `"}`} {
+		if w := serve(app.handleBookmarks, http.MethodPost, "/bookmarks", body, "ana"); w.Code != http.StatusBadRequest {
+			t.Errorf("%.40s: status=%d", body, w.Code)
+		}
+	}
+
+	if w := serve(app.handleBookmarkByGuide, http.MethodDelete, "/bookmarks/loki-101", "", "bo"); w.Code != http.StatusNotFound {
+		t.Errorf("bo deleting: status=%d", w.Code)
+	}
+	if w := serve(app.handleBookmarkByGuide, http.MethodDelete, "/bookmarks/loki-101", "", "ana"); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status=%d", w.Code)
+	}
+	if got := list("ana"); len(got) != 1 || got[0].GuideID != "alerting-101" {
+		t.Errorf("after delete = %+v", got)
+	}
+
+	for i := len(list("ana")); i < maxBookmarksPerUser; i++ {
+		if w := serve(app.handleBookmarks, http.MethodPost, "/bookmarks", `{"guideId": "g`+strconv.Itoa(i)+`"}`, "ana"); w.Code != http.StatusCreated {
+			t.Fatalf("add %d: status=%d", i, w.Code)
+		}
+	}
+	if w := serve(app.handleBookmarks, http.MethodPost, "/bookmarks", `{"guideId": "one-more"}`, "ana"); w.Code != http.StatusConflict {
+		t.Errorf("over the limit: status=%d", w.Code)
+	}
+}
@@ -0,0 +1,292 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Instructor broadcast over Grafana Live.
+//
+// Channel path: broadcast/{cohort}
+//
+// An admin designates one of their own connected terminal sessions as the
+// instructor session for a workshop cohort with POST /broadcasts. Every
+// participant subscribed to broadcast/{cohort} receives the instructor's
+// terminal output through an outputFanout (see terminal_fanout.go). Publishing on
+// the channel is only accepted from the instructor and is forwarded to their
+// own session, so participants can watch but never type.
+//
+// Broadcasts are held in memory and end when stopped or when the plugin
+// instance is disposed. They outlive individual terminal connections, so an
+// instructor who reconnects to the same VM keeps broadcasting.
+
+const broadcastChannelPrefix = "broadcast"
+
+// broadcast is one cohort's instructor session and its viewers.
+type broadcast struct {
+	cohort     string
+	instructor string
+	startedAt  time.Time
+	fanout     *outputFanout
+
+	mu   sync.Mutex
+	vmID string
+}
+
+// broadcastInfo is the JSON view of a broadcast.
+type broadcastInfo struct {
+	Cohort     string    `json:"cohort"`
+	Instructor string    `json:"instructor"`
+	VMID       string    `json:"vmId"`
+	StartedAt  time.Time `json:"startedAt"`
+	Viewers    int       `json:"viewers"`
+}
+
+// StartBroadcastRequest is the JSON body for POST /broadcasts.
+type StartBroadcastRequest struct {
+	Cohort string `json:"cohort" validate:"required,pattern=name"`
+	VMID   string `json:"vmId" validate:"required"`
+}
+
+func (b *broadcast) info() broadcastInfo {
+	b.mu.Lock()
+	vmID := b.vmID
+	b.mu.Unlock()
+	return broadcastInfo{
+		Cohort:     b.cohort,
+		Instructor: b.instructor,
+		VMID:       vmID,
+		StartedAt:  b.startedAt,
+		Viewers:    b.fanout.viewerCount(),
+	}
+}
+
+// parseBroadcastChannel extracts the cohort from a broadcast/{cohort} path.
+func parseBroadcastChannel(channelPath string) (string, bool) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) != 2 || parts[0] != broadcastChannelPrefix || !workspaceNamePattern.MatchString(parts[1]) {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func (a *App) getBroadcast(cohort string) *broadcast {
+	a.broadcastsMu.Lock()
+	defer a.broadcastsMu.Unlock()
+	return a.broadcasts[cohort]
+}
+
+// broadcastFanouts returns the fan-outs of every cohort broadcasting user's
+// session on vmID.
+func (a *App) broadcastFanouts(user, vmID string) []*outputFanout {
+	a.broadcastsMu.Lock()
+	defer a.broadcastsMu.Unlock()
+	var fanouts []*outputFanout
+	for _, b := range a.broadcasts {
+		b.mu.Lock()
+		if b.instructor == user && b.vmID == vmID {
+			fanouts = append(fanouts, b.fanout)
+		}
+		b.mu.Unlock()
+	}
+	return fanouts
+}
+
+// stopAllBroadcasts ends every broadcast; used on dispose.
+func (a *App) stopAllBroadcasts() {
+	a.broadcastsMu.Lock()
+	defer a.broadcastsMu.Unlock()
+	for cohort, b := range a.broadcasts {
+		b.fanout.stop()
+		delete(a.broadcasts, cohort)
+	}
+}
+
+// handleBroadcasts handles GET /broadcasts (list) and POST /broadcasts
+// (start; admin only).
+func (a *App) handleBroadcasts(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.broadcastsMu.Lock()
+		result := make([]broadcastInfo, 0, len(a.broadcasts))
+		for _, b := range a.broadcasts {
+			result = append(result, b.info())
+		}
+		a.broadcastsMu.Unlock()
+		sort.Slice(result, func(i, j int) bool { return result[i].Cohort < result[j].Cohort })
+		a.writeJSON(w, map[string]interface{}{"broadcasts": result}, http.StatusOK)
+	case http.MethodPost:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can broadcast a terminal", http.StatusForbidden)
+			return
+		}
+		a.handleStartBroadcast(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleStartBroadcast(w http.ResponseWriter, r *http.Request, user string) {
+	var req StartBroadcastRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if a.findStreamSessionForUserVM(user, req.VMID) == nil {
+		a.writeError(w, "No active terminal session for this VM", http.StatusConflict)
+		return
+	}
+
+	a.broadcastsMu.Lock()
+	if a.broadcasts == nil {
+		a.broadcasts = make(map[string]*broadcast)
+	}
+	b, exists := a.broadcasts[req.Cohort]
+	if exists && b.instructor != user {
+		a.broadcastsMu.Unlock()
+		a.writeError(w, "Cohort is already being broadcast by another instructor", http.StatusConflict)
+		return
+	}
+	status := http.StatusOK
+	if exists {
+		// Re-designating moves the broadcast to another of the instructor's VMs.
+		b.mu.Lock()
+		if b.vmID != req.VMID {
+			b.vmID = req.VMID
+			b.fanout.resetReplay()
+		}
+		b.mu.Unlock()
+	} else {
+		b = &broadcast{
+			cohort:     req.Cohort,
+			instructor: user,
+			startedAt:  timeNow().UTC(),
+			fanout:     newOutputFanout(),
+			vmID:       req.VMID,
+		}
+		a.broadcasts[req.Cohort] = b
+		status = http.StatusCreated
+	}
+	a.broadcastsMu.Unlock()
+
+	a.ctxLogger(r.Context()).Info("Broadcasting terminal to cohort", "cohort", req.Cohort, "vmID", req.VMID, "instructor", user)
+	a.writeJSON(w, b.info(), status)
+}
+
+// handleBroadcastByCohort handles GET/DELETE /broadcasts/{cohort}. DELETE
+// requires the Admin role.
+func (a *App) handleBroadcastByCohort(w http.ResponseWriter, r *http.Request) {
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	cohort := strings.TrimPrefix(r.URL.Path, "/broadcasts/")
+
+	switch r.Method {
+	case http.MethodGet:
+		b := a.getBroadcast(cohort)
+		if b == nil {
+			a.writeError(w, "No broadcast for this cohort", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, b.info(), http.StatusOK)
+	case http.MethodDelete:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can stop a broadcast", http.StatusForbidden)
+			return
+		}
+		a.broadcastsMu.Lock()
+		b := a.broadcasts[cohort]
+		delete(a.broadcasts, cohort)
+		a.broadcastsMu.Unlock()
+		if b == nil {
+			a.writeError(w, "No broadcast for this cohort", http.StatusNotFound)
+			return
+		}
+		b.fanout.stop()
+		a.ctxLogger(r.Context()).Info("Stopped cohort broadcast", "cohort", cohort)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// subscribeBroadcastStream accepts any signed-in user while the cohort is
+// being broadcast.
+func (a *App) subscribeBroadcastStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	cohort, ok := parseBroadcastChannel(req.Path)
+	if !ok || a.getBroadcast(cohort) == nil {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if pluginUserLogin(req.PluginContext) == "" {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	a.ctxLogger(ctx).Info("Broadcast subscription accepted", "cohort", cohort, "user", pluginUserLogin(req.PluginContext))
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runBroadcastStream relays the instructor's output to this stream's
+// subscribers until the stream closes or the broadcast stops.
+func (a *App) runBroadcastStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	cohort, ok := parseBroadcastChannel(req.Path)
+	var b *broadcast
+	if ok {
+		b = a.getBroadcast(cohort)
+	}
+	if b == nil {
+		sendStreamError(ctx, sender, "No broadcast for this cohort")
+		return nil
+	}
+
+	info := b.info()
+	runFanoutStream(ctx, sender, b.fanout, "Broadcast ended", TerminalStreamOutput{
+		Type:    "connected",
+		VmId:    info.VMID,
+		Message: "Watching " + info.Instructor + "'s terminal (read-only)",
+	})
+	return nil
+}
+
+// publishBroadcastStream forwards input on a broadcast channel to the
+// instructor's session. Input from anyone else is refused.
+func (a *App) publishBroadcastStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+	cohort, ok := parseBroadcastChannel(req.Path)
+	var b *broadcast
+	if ok {
+		b = a.getBroadcast(cohort)
+	}
+	if b == nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	info := b.info()
+	if user != info.Instructor {
+		ctxLogger.Warn("Rejecting broadcast input from non-instructor", "cohort", cohort, "user", user)
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+
+	sess := a.findStreamSessionForUserVM(user, info.VMID)
+	if sess == nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+	input, err := a.parseTerminalInput(req.Data)
+	if err != nil {
+		ctxLogger.Warn("PublishStream: invalid input", "error", err, "dataLen", len(req.Data))
+		return nil, err
+	}
+	a.applyTerminalInput(ctxLogger, sess, input)
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func newBroadcastApp(stdin *recordingWriter) *App {
+	app := &App{logger: log.DefaultLogger, streamSessions: map[string]*streamSession{}}
+	app.streamSessions["terminal/vm-1/1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", stdin: stdin},
+	}
+	return app
+}
+
+func startBroadcast(t *testing.T, app *App, user, role, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	app.handleBroadcasts(w, roleRequest(http.MethodPost, "/broadcasts", body, user, role))
+	return w
+}
+
+func TestParseBroadcastChannel(t *testing.T) {
+	if cohort, ok := parseBroadcastChannel("broadcast/workshop-1"); !ok || cohort != "workshop-1" {
+		t.Errorf("got %q %v", cohort, ok)
+	}
+	for _, p := range []string{"broadcast", "broadcast/", "broadcast/Bad_Name", "broadcast/a/b", "terminal/a"} {
+		if _, ok := parseBroadcastChannel(p); ok {
+			t.Errorf("%q: expected rejection", p)
+		}
+	}
+}
+
+func TestHandleBroadcasts_Start(t *testing.T) {
+	app := newBroadcastApp(&recordingWriter{})
+	body := `{"cohort":"workshop-1","vmId":"vm-1"}`
+
+	if w := startBroadcast(t, app, "alice", "Editor", body); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+	if w := startBroadcast(t, app, "alice", "Admin", `{"cohort":"workshop-1","vmId":"vm-2"}`); w.Code != http.StatusConflict {
+		t.Errorf("no session: status = %d", w.Code)
+	}
+	if w := startBroadcast(t, app, "alice", "Admin", `{"cohort":"Workshop 1","vmId":"vm-1"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bad cohort: status = %d", w.Code)
+	}
+	if w := startBroadcast(t, app, "alice", "Admin", body); w.Code != http.StatusCreated {
+		t.Fatalf("start: status = %d body = %s", w.Code, w.Body)
+	}
+
+	// Another admin cannot take over the cohort.
+	app.streamSessions["terminal/vm-9/1"] = &streamSession{vmID: "vm-9", userLogin: "carol", session: &TerminalSession{}}
+	if w := startBroadcast(t, app, "carol", "Admin", `{"cohort":"workshop-1","vmId":"vm-9"}`); w.Code != http.StatusConflict {
+		t.Errorf("takeover: status = %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	app.handleBroadcasts(w, roleRequest(http.MethodGet, "/broadcasts", "", "bob", "Viewer"))
+	var resp struct {
+		Broadcasts []broadcastInfo `json:"broadcasts"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Broadcasts) != 1 || resp.Broadcasts[0].Instructor != "alice" || resp.Broadcasts[0].VMID != "vm-1" {
+		t.Errorf("list = %+v", resp.Broadcasts)
+	}
+}
+
+func TestRunBroadcastStream_FansOutInstructorOutput(t *testing.T) {
+	app := newBroadcastApp(&recordingWriter{})
+	if w := startBroadcast(t, app, "alice", "Admin", `{"cohort":"workshop-1","vmId":"vm-1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("start: status = %d", w.Code)
+	}
+	app.fanOutTerminalOutput("alice", "vm-1", []byte("before join\r\n"))
+
+	rec, sender := newStreamRecorder(t)
+	done := make(chan error, 1)
+	go func() {
+		done <- app.RunStream(context.Background(), &backend.RunStreamRequest{
+			Path:          "broadcast/workshop-1",
+			PluginContext: backend.PluginContext{User: &backend.User{Login: "bob"}},
+		}, sender)
+	}()
+
+	b := app.getBroadcast("workshop-1")
+	deadline := time.Now().Add(5 * time.Second)
+	for b.info().Viewers == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	app.fanOutTerminalOutput("alice", "vm-1", []byte("ls\r\n"))
+	app.fanOutTerminalOutput("carol", "vm-1", []byte("not the instructor"))
+
+	w := httptest.NewRecorder()
+	app.handleBroadcastByCohort(w, roleRequest(http.MethodDelete, "/broadcasts/workshop-1", "", "alice", "Admin"))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("stop: status = %d", w.Code)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast stream did not end after stop")
+	}
+
+	var out strings.Builder
+	for _, m := range rec.ofType("output") {
+		out.WriteString(m.Data)
+	}
+	if out.String() != "before join\r\nls\r\n" {
+		t.Errorf("viewer output = %q", out.String())
+	}
+	if c := rec.ofType("connected"); len(c) != 1 || c[0].VmId != "vm-1" {
+		t.Errorf("connected = %+v", c)
+	}
+	if len(rec.ofType("disconnected")) != 1 {
+		t.Errorf("expected a disconnected message, got %+v", rec.messages)
+	}
+}
+
+func TestPublishBroadcastStream_OnlyInstructor(t *testing.T) {
+	stdin := &recordingWriter{}
+	app := newBroadcastApp(stdin)
+	if w := startBroadcast(t, app, "alice", "Admin", `{"cohort":"workshop-1","vmId":"vm-1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("start: status = %d", w.Code)
+	}
+
+	publish := func(user string) backend.PublishStreamStatus {
+		resp, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			Path:          "broadcast/workshop-1",
+			Data:          json.RawMessage(`{"type":"input","data":"whoami\r"}`),
+			PluginContext: backend.PluginContext{User: &backend.User{Login: user}},
+		})
+		if err != nil {
+			t.Fatalf("PublishStream(%s): %v", user, err)
+		}
+		return resp.Status
+	}
+
+	if got := publish("bob"); got != backend.PublishStreamStatusPermissionDenied {
+		t.Errorf("participant: status = %v", got)
+	}
+	if len(stdin.writes) != 0 {
+		t.Errorf("participant input reached the shell: %q", stdin.writes)
+	}
+	if got := publish("alice"); got != backend.PublishStreamStatusOK {
+		t.Errorf("instructor: status = %v", got)
+	}
+	if len(stdin.writes) != 1 || string(stdin.writes[0]) != "whoami\r" {
+		t.Errorf("stdin writes = %q", stdin.writes)
+	}
+}
@@ -0,0 +1,313 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDN guide cache.
+//
+// GET /cdn-guides/{path} serves a JSON file (a guide's content.json or
+// manifest.json, or an index) from an interactive-learning CDN host,
+// interactive-learning.grafana.net unless ?host= names another allowed one,
+// through a cache kept in the plugin store: metadata in the cdn-cache
+// collection and bodies as blobs, so on disk when storagePath is set. The
+// CDN's Cache-Control and ETag are honoured. A fresh copy is served as is.
+// Within stale-while-revalidate of expiring (cdnDefaultStaleWhileRevalidate
+// when the CDN sets none) the stale copy is served at once and refreshed in
+// the background. Beyond that the copy is revalidated with If-None-Match and
+// If-Modified-Since first. When the CDN can't be reached or fails, any
+// cached copy is served, so a learner's page load never waits on a slow CDN
+// once a guide is cached and outages go unnoticed. A cdn mirror (see
+// mirrors.go) replaces every host. no-store responses aren't
+// cached. X-Cache reports HIT, STALE, REVALIDATED, MISS or OFFLINE. The newest
+// maxCDNCacheEntries files are kept. Files never cached come from the
+// offline bundle when the CDN fails (see offline_bundles.go).
+
+const (
+	cdnCacheCollection             = "cdn-cache"
+	cdnDefaultHost                 = "interactive-learning.grafana.net"
+	cdnDefaultMaxAge               = 5 * time.Minute
+	cdnDefaultStaleWhileRevalidate = 24 * time.Hour
+	cdnFetchTimeout                = 10 * time.Second
+	maxCDNCacheEntries             = 2000
+	maxCDNFileBytes                = 5 << 20
+)
+
+var cdnPathPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*)*\.json$`)
+
+// cdnOriginOverride replaces https://{host} and the cdn mirror in tests.
+var cdnOriginOverride string
+
+// cdnCacheEntry describes a cached file, keyed host/path.
+type cdnCacheEntry struct {
+	URL                  string        `json:"url"`
+	ETag                 string        `json:"etag,omitempty"`
+	LastModified         string        `json:"lastModified,omitempty"`
+	ContentType          string        `json:"contentType,omitempty"`
+	FetchedAt            time.Time     `json:"fetchedAt"`
+	MaxAge               time.Duration `json:"maxAge"`
+	StaleWhileRevalidate time.Duration `json:"staleWhileRevalidate"`
+	// NoCache entries are always revalidated before use.
+	NoCache bool `json:"noCache,omitempty"`
+}
+
+// cacheControl is the part of a Cache-Control header the cache honours.
+type cacheControl struct {
+	noStore, noCache                   bool
+	maxAge, staleWhileRevalidate       time.Duration
+	hasMaxAge, hasStaleWhileRevalidate bool
+}
+
+func parseCacheControl(header string) cacheControl {
+	var cc cacheControl
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		switch strings.ToLower(name) {
+		case "no-store":
+			cc.noStore = true
+		case "no-cache":
+			cc.noCache = true
+		case "max-age":
+			if err == nil && seconds >= 0 {
+				cc.maxAge, cc.hasMaxAge = time.Duration(seconds)*time.Second, true
+			}
+		case "stale-while-revalidate":
+			if err == nil && seconds >= 0 {
+				cc.staleWhileRevalidate, cc.hasStaleWhileRevalidate = time.Duration(seconds)*time.Second, true
+			}
+		}
+	}
+	return cc
+}
+
+// applyHeaders updates e's freshness and validators from a 200 or 304
+// response, fetched at now.
+func (e *cdnCacheEntry) applyHeaders(h http.Header, now time.Time) {
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	e.FetchedAt, e.NoCache = now, cc.noCache
+	e.MaxAge, e.StaleWhileRevalidate = cdnDefaultMaxAge, cdnDefaultStaleWhileRevalidate
+	if cc.hasMaxAge {
+		e.MaxAge = cc.maxAge
+	}
+	if cc.hasStaleWhileRevalidate {
+		e.StaleWhileRevalidate = cc.staleWhileRevalidate
+	}
+	if etag := h.Get("ETag"); etag != "" {
+		e.ETag = etag
+	}
+	if lm := h.Get("Last-Modified"); lm != "" {
+		e.LastModified = lm
+	}
+	if ct := h.Get("Content-Type"); ct != "" {
+		e.ContentType = ct
+	}
+}
+
+// cdnStatusError is a CDN response other than 200 or 304.
+type cdnStatusError struct {
+	status int
+	url    string
+}
+
+func (e *cdnStatusError) Error() string {
+	return fmt.Sprintf("CDN returned %d for %s", e.status, e.url)
+}
+
+// fetchCDN fetches key's file, conditionally when cached is set. It
+// returns the updated entry and, unless the CDN answered 304, the body.
+func (a *App) fetchCDN(ctx context.Context, key, url string, cached *cdnCacheEntry) (*cdnCacheEntry, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, cdnFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	now := timeNow().UTC()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		e := *cached
+		e.applyHeaders(resp.Header, now)
+		if err := a.store.put(cdnCacheCollection, key, e); err != nil {
+			return nil, nil, err
+		}
+		return &e, nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &cdnStatusError{status: resp.StatusCode, url: url}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCDNFileBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > maxCDNFileBytes {
+		return nil, nil, fmt.Errorf("%s is larger than %d bytes", url, maxCDNFileBytes)
+	}
+	e := &cdnCacheEntry{URL: url}
+	e.applyHeaders(resp.Header, now)
+	if parseCacheControl(resp.Header.Get("Cache-Control")).noStore {
+		_ = a.store.delete(cdnCacheCollection, key)
+		_ = a.store.deleteBlob(cdnCacheCollection, key)
+		return e, body, nil
+	}
+	if err := a.store.putBlob(cdnCacheCollection, key, body); err != nil {
+		return nil, nil, err
+	}
+	if err := a.store.put(cdnCacheCollection, key, e); err != nil {
+		return nil, nil, err
+	}
+	a.pruneCDNCache()
+	return e, body, nil
+}
+
+// pruneCDNCache drops the least recently fetched files beyond
+// maxCDNCacheEntries.
+func (a *App) pruneCDNCache() {
+	keys := a.store.keys(cdnCacheCollection)
+	if len(keys) <= maxCDNCacheEntries {
+		return
+	}
+	fetched := map[string]time.Time{}
+	for _, key := range keys {
+		var e cdnCacheEntry
+		if ok, err := a.store.get(cdnCacheCollection, key, &e); err == nil && ok {
+			fetched[key] = e.FetchedAt
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return fetched[keys[i]].Before(fetched[keys[j]]) })
+	for _, key := range keys[:len(keys)-maxCDNCacheEntries] {
+		_ = a.store.delete(cdnCacheCollection, key)
+		_ = a.store.deleteBlob(cdnCacheCollection, key)
+	}
+}
+
+// revalidateCDNInBackground refreshes key unless a refresh is already
+// running or the instance is disposed.
+func (a *App) revalidateCDNInBackground(key, url string, cached cdnCacheEntry) {
+	a.cdnRevalidatingMu.Lock()
+	if a.cdnRevalidating == nil {
+		a.cdnRevalidating = map[string]bool{}
+	}
+	if a.cdnRevalidating[key] {
+		a.cdnRevalidatingMu.Unlock()
+		return
+	}
+	a.cdnRevalidating[key] = true
+	a.cdnRevalidatingMu.Unlock()
+	done := func() {
+		a.cdnRevalidatingMu.Lock()
+		delete(a.cdnRevalidating, key)
+		a.cdnRevalidatingMu.Unlock()
+	}
+	started := a.goBackground(func(ctx context.Context) {
+		defer done()
+		if _, _, err := a.fetchCDN(ctx, key, url, &cached); err != nil {
+			a.logger.Warn("Failed to revalidate cached CDN file", "url", url, "error", err)
+		}
+	})
+	if !started {
+		done()
+	}
+}
+
+// handleCDNGuide handles GET /cdn-guides/{path}.
+func (a *App) handleCDNGuide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/cdn-guides/")
+	if !cdnPathPattern.MatchString(path) {
+		a.writeError(w, "Path must name a .json file such as prom-101/v1.0.0/content.json", http.StatusBadRequest)
+		return
+	}
+	host := cdnDefaultHost
+	if h := r.URL.Query().Get("host"); h != "" {
+		if _, ok := allowedPackageRepositoryHosts[h]; !ok {
+			a.writeError(w, "host must be an interactive-learning CDN host", http.StatusBadRequest)
+			return
+		}
+		host = h
+	}
+	key := host + "/" + path
+	url := a.cdnOrigin(host) + "/" + path
+	logger := a.ctxLogger(r.Context())
+
+	var cached *cdnCacheEntry
+	var body []byte
+	var e cdnCacheEntry
+	if ok, err := a.store.get(cdnCacheCollection, key, &e); err == nil && ok {
+		if data, ok, err := a.store.getBlob(cdnCacheCollection, key); err == nil && ok {
+			cached, body = &e, data
+		}
+	}
+
+	state := "MISS"
+	if cached != nil {
+		age := timeNow().Sub(cached.FetchedAt)
+		switch {
+		case !cached.NoCache && age < cached.MaxAge:
+			state = "HIT"
+		case !cached.NoCache && age < cached.MaxAge+cached.StaleWhileRevalidate:
+			state = "STALE"
+			a.revalidateCDNInBackground(key, url, *cached)
+		}
+	}
+	if state == "MISS" {
+		var statusErr *cdnStatusError
+		fresh, data, err := a.fetchCDN(context.WithoutCancel(r.Context()), key, url, cached)
+		switch {
+		case err == nil && data == nil:
+			cached, state = fresh, "REVALIDATED"
+		case err == nil:
+			cached, body = fresh, data
+		case cached != nil:
+			logger.Warn("CDN unavailable, serving cached copy", "url", url, "error", err)
+			state = "STALE"
+		case a.offlineBundleDir() != "":
+			data, offlineErr := readOfflineBundle(a.offlineBundleDir(), path, maxCDNFileBytes)
+			if offlineErr != nil {
+				logger.Warn("CDN fetch failed and the file isn't in the offline bundle", "url", url, "error", err, "offlineError", offlineErr)
+				a.writeError(w, "The CDN is unavailable and the offline bundle has no such file", http.StatusBadGateway)
+				return
+			}
+			cached, body, state = &cdnCacheEntry{ContentType: "application/json"}, data, "OFFLINE"
+		case errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound:
+			a.writeError(w, "No such file on the CDN", http.StatusNotFound)
+			return
+		default:
+			logger.Warn("CDN fetch failed", "url", url, "error", err)
+			a.writeError(w, "The CDN is unavailable", http.StatusBadGateway)
+			return
+		}
+	}
+	contentType := cached.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Cache", state)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
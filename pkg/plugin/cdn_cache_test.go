@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandleCDNGuide(t *testing.T) {
+	advance := withFrozenTime(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	var hits, notModified atomic.Int32
+	var failing atomic.Bool
+	version := atomic.Value{}
+	version.Store("v1")
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path != "/prom-101/v1.0.0/content.json" {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + version.Load().(string) + `"`
+		w.Header().Set("Cache-Control", "public, max-age=60, stale-while-revalidate=600")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "prom-101", "version": "` + version.Load().(string) + `"}`))
+	}))
+	defer cdn.Close()
+	cdnOriginOverride = cdn.URL
+	t.Cleanup(func() { cdnOriginOverride = "" })
+
+	app := newTestApp(t)
+	get := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleCDNGuide(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	waitRevalidated := func() {
+		t.Helper()
+		for i := 0; i < 500; i++ {
+			app.cdnRevalidatingMu.Lock()
+			n := len(app.cdnRevalidating)
+			app.cdnRevalidatingMu.Unlock()
+			if n == 0 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("background revalidation didn't finish")
+	}
+	const guide = "/cdn-guides/prom-101/v1.0.0/content.json"
+	expect := func(w *httptest.ResponseRecorder, state, version string) {
+		t.Helper()
+		want := `{"id": "prom-101", "version": "` + version + `"}`
+		if w.Code != http.StatusOK || w.Header().Get("X-Cache") != state || w.Body.String() != want {
+			t.Errorf("status %d, X-Cache %q, body %s; want %s with %s", w.Code, w.Header().Get("X-Cache"), w.Body, state, want)
+		}
+	}
+
+	for _, target := range []string{"/cdn-guides/../secrets.json", "/cdn-guides/prom-101/content.yaml", guide + "?host=example.com"} {
+		if w := get(target); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, w.Code)
+		}
+	}
+	if w := get("/cdn-guides/missing/content.json"); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: status %d, want 404", w.Code)
+	}
+
+	expect(get(guide), "MISS", "v1")
+	expect(get(guide), "HIT", "v1")
+	if hits.Load() != 2 {
+		t.Errorf("CDN hits = %d, want 2", hits.Load())
+	}
+
+	// Stale within stale-while-revalidate: served at once, revalidated in
+	// the background.
+	advance(2 * time.Minute)
+	expect(get(guide), "STALE", "v1")
+	waitRevalidated()
+	if notModified.Load() != 1 {
+		t.Errorf("304s = %d, want 1", notModified.Load())
+	}
+	expect(get(guide), "HIT", "v1")
+
+	// Past stale-while-revalidate with the CDN down, the cached copy is
+	// still served.
+	advance(time.Hour)
+	failing.Store(true)
+	expect(get(guide), "STALE", "v1")
+
+	// Once the CDN is back, a changed file replaces the copy.
+	failing.Store(false)
+	version.Store("v2")
+	expect(get(guide), "MISS", "v2")
+}
+
+func TestParseCacheControl(t *testing.T) {
+	cc := parseCacheControl(`public, max-age="300", stale-while-revalidate=60, no-cache`)
+	if !cc.noCache || cc.noStore || cc.maxAge != 5*time.Minute || cc.staleWhileRevalidate != time.Minute {
+		t.Errorf("parsed %+v", cc)
+	}
+	if cc := parseCacheControl("no-store, max-age=abc"); !cc.noStore || cc.hasMaxAge {
+		t.Errorf("parsed %+v", cc)
+	}
+}
+
+func TestRevalidateCDNAfterDispose(t *testing.T) {
+	app := newTestApp(t)
+	app.stopBackground()
+	app.revalidateCDNInBackground("prom-101/v1.0.0/content.json", "http://127.0.0.1:1/content.json", cdnCacheEntry{})
+	app.cdnRevalidatingMu.Lock()
+	defer app.cdnRevalidatingMu.Unlock()
+	if len(app.cdnRevalidating) != 0 {
+		t.Errorf("refused revalidation left %v marked running", app.cdnRevalidating)
+	}
+}
@@ -71,8 +71,14 @@ type ListVMsOptions struct {
 }
 
 // isUsableState returns true for VM states that can still serve a connection.
+// Hibernated VMs (stopping/stopped/starting) count: they are resumed on the
+// next connection rather than replaced.
 func isUsableState(state string) bool {
-	return state == "active" || state == "pending" || state == "provisioning"
+	switch state {
+	case "active", "pending", "provisioning", "stopping", "stopped", "starting":
+		return true
+	}
+	return false
 }
 
 // isVMNotFoundError returns true when the error indicates the VM no longer exists (HTTP 404).
@@ -113,6 +119,13 @@ type CodaClient struct {
 	tokenExpiry  time.Time
 	mutex        sync.RWMutex
 	client       *http.Client
+	// sshSource restricts SSH on new VMs; nil leaves SSH open (see ssh_source.go)
+	sshSource *sshSourceRestriction
+	// vmList caches ListVMs results (see coda_vm_cache.go)
+	vmList vmListCache
+	// missingTokenErr explains an empty refresh token, e.g. a failed Vault
+	// read; nil means the instance isn't registered yet
+	missingTokenErr func() error
 }
 
 // NewCodaClient creates a new Coda API client.
@@ -121,7 +134,8 @@ func NewCodaClient(apiURL, refreshToken string) *CodaClient {
 		apiURL:       apiURL,
 		refreshToken: refreshToken,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: correlationTransport{},
 		},
 	}
 }
@@ -150,6 +164,15 @@ func (c *CodaClient) refreshAccessToken(ctx context.Context) (string, error) {
 		return c.accessToken, nil
 	}
 
+	if c.refreshToken == "" {
+		if c.missingTokenErr != nil {
+			if err := c.missingTokenErr(); err != nil {
+				return "", fmt.Errorf("no refresh token: %w", err)
+			}
+		}
+		return "", fmt.Errorf("no refresh token configured, please register")
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"/api/v1/auth/refresh", nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create refresh request: %w", err)
@@ -188,6 +211,20 @@ func (c *CodaClient) refreshAccessToken(ctx context.Context) (string, error) {
 	return c.accessToken, nil
 }
 
+// setRefreshToken replaces the refresh token, dropping the cached access
+// token, and reports whether it changed.
+func (c *CodaClient) setRefreshToken(token string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if token == c.refreshToken {
+		return false
+	}
+	c.refreshToken = token
+	c.accessToken = ""
+	c.tokenExpiry = time.Time{}
+	return true
+}
+
 // setAuthHeader sets the Authorization header with an access token.
 // Gets a fresh access token if the current one is expired or about to expire.
 func (c *CodaClient) setAuthHeader(ctx context.Context, req *http.Request) error {
@@ -225,7 +262,7 @@ func Register(ctx context.Context, apiURL, enrollmentKey, instanceID, instanceUR
 
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: correlationTransport{}}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send registration request: %w", err)
@@ -253,6 +290,56 @@ func Register(ctx context.Context, apiURL, enrollmentKey, instanceID, instanceUR
 	return &registerResp, nil
 }
 
+// EnrollmentKeyValidation is Coda's verdict on an enrollment key.
+type EnrollmentKeyValidation struct {
+	// Status is "valid", "invalid" or "expired".
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ValidateEnrollmentKey checks an enrollment key with Coda without
+// registering, so the key stays usable.
+func ValidateEnrollmentKey(ctx context.Context, apiURL, enrollmentKey string) (*EnrollmentKeyValidation, error) {
+	body, err := json.Marshal(map[string]string{"enrollmentKey": enrollmentKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal validation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/api/v1/auth/validate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second, Transport: correlationTransport{}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send validation request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		result := EnrollmentKeyValidation{Status: "valid"}
+		var payload struct {
+			ExpiresAt *time.Time `json:"expiresAt"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err == nil {
+			result.ExpiresAt = payload.ExpiresAt
+		}
+		return &result, nil
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return &EnrollmentKeyValidation{Status: "invalid"}, nil
+	case http.StatusGone:
+		return &EnrollmentKeyValidation{Status: "expired"}, nil
+	case http.StatusTooManyRequests:
+		return nil, fmt.Errorf("too many validation attempts, please try again later")
+	default:
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("validation failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+}
+
 // CreateVMRequest represents the request body for creating a VM.
 type CreateVMRequest struct {
 	Template string                 `json:"template"`
@@ -266,6 +353,18 @@ func (c *CodaClient) CreateVM(ctx context.Context, template, owner string, confi
 	if len(config) > 0 && config[0] != nil {
 		vmConfig = config[0]
 	}
+	if c.sshSource != nil {
+		cidrs, err := c.sshSource.allowedCIDRs(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		restricted := make(map[string]interface{}, len(vmConfig)+1)
+		for k, v := range vmConfig {
+			restricted[k] = v
+		}
+		restricted[sshAllowedCIDRsConfigKey] = cidrs
+		vmConfig = restricted
+	}
 	payload := CreateVMRequest{
 		Template: template,
 		Owner:    owner,
@@ -310,6 +409,8 @@ func (c *CodaClient) CreateVM(ctx context.Context, template, owner string, confi
 		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
+	c.vmList.invalidate()
+
 	var vm VM
 	if err := json.NewDecoder(resp.Body).Decode(&vm); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
@@ -388,9 +489,55 @@ func (c *CodaClient) DeleteVM(ctx context.Context, vmID string, force bool) erro
 		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
+	c.vmList.invalidate()
 	return nil
 }
 
+// StopVM hibernates a VM: the instance is stopped but its disk survives, so a
+// later StartVM resumes the learner's environment instead of replacing it.
+func (c *CodaClient) StopVM(ctx context.Context, vmID string) error {
+	return c.vmPowerAction(ctx, vmID, "stop")
+}
+
+// StartVM resumes a hibernated VM. The VM passes through "starting" before
+// returning to "active" with fresh credentials.
+func (c *CodaClient) StartVM(ctx context.Context, vmID string) error {
+	return c.vmPowerAction(ctx, vmID, "start")
+}
+
+// vmPowerAction calls POST /api/v1/vms/{id}/{action} for stop/start.
+func (c *CodaClient) vmPowerAction(ctx context.Context, vmID, action string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"/api/v1/vms/"+vmID+"/"+action, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.setAuthHeader(ctx, req); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		c.vmList.invalidate()
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("authentication failed: token may be invalid or expired, please re-register")
+	case http.StatusNotFound:
+		return fmt.Errorf("VM not found: %s", vmID)
+	case http.StatusConflict:
+		return fmt.Errorf("VM conflict: cannot %s VM in its current state", action)
+	default:
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+}
+
 // ListVMs returns VMs, optionally filtered server-side by owner/state/limit.
 // Pass nil to list all VMs without filtering.
 func (c *CodaClient) ListVMs(ctx context.Context, opts *ListVMsOptions) ([]VM, error) {
@@ -411,6 +558,11 @@ func (c *CodaClient) ListVMs(ctx context.Context, opts *ListVMsOptions) ([]VM, e
 		}
 	}
 
+	cached, generation, ok := c.vmList.get(endpoint)
+	if ok {
+		return cached, nil
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -440,6 +592,7 @@ func (c *CodaClient) ListVMs(ctx context.Context, opts *ListVMsOptions) ([]VM, e
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	c.vmList.put(endpoint, generation, listResp.VMs)
 	return listResp.VMs, nil
 }
 
@@ -447,8 +600,9 @@ func (c *CodaClient) ListVMs(ctx context.Context, opts *ListVMsOptions) ([]VM, e
 // returns the most recently created VM in a usable state (active/pending/provisioning).
 // If multiple usable VMs exist, the surplus ones are returned in the second
 // slice so the caller can clean them up (users should only have one active VM).
+// VMs whose IDs are in exclude (e.g. workspace VMs) are ignored entirely.
 // Returns (nil, nil, nil) when no usable VM exists.
-func (c *CodaClient) FindActiveVMForUser(ctx context.Context, owner string) (*VM, []VM, error) {
+func (c *CodaClient) FindActiveVMForUser(ctx context.Context, owner string, exclude map[string]bool) (*VM, []VM, error) {
 	vms, err := c.ListVMs(ctx, &ListVMsOptions{Owner: owner})
 	if err != nil {
 		return nil, nil, err
@@ -456,7 +610,7 @@ func (c *CodaClient) FindActiveVMForUser(ctx context.Context, owner string) (*VM
 
 	var usable []VM
 	for i := range vms {
-		if isUsableState(vms[i].State) {
+		if isUsableState(vms[i].State) && !exclude[vms[i].ID] {
 			usable = append(usable, vms[i])
 		}
 	}
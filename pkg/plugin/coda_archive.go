@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// Directory archives for GET /vms/{id}/archive?path=.
+//
+// Learners take their lab workspace home as a tar.gz built on the fly: the
+// directory is walked over SFTP on the caller's own terminal session (the
+// same ownership and path rules as the file editor) and each entry is
+// streamed into the response as it's read, so nothing is staged on the VM or
+// in the plugin. Once streaming starts the status can't change; a failure
+// part-way leaves the gzip stream unterminated, which archive tools report
+// as a corrupt download.
+
+// codaArchiveMaxBytes caps the file content in one archive.
+const codaArchiveMaxBytes = 1 << 30
+
+// handleVMArchive handles GET /vms/{id}/archive?path=.
+func (a *App) handleVMArchive(w http.ResponseWriter, r *http.Request, vmID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.withVMSFTP(w, r, vmID, codaDownloadTimeout, validateRemoteDirPath, func(sc *sftp.Client, dirPath string) {
+		a.archiveVMDir(w, r, sc, vmID, dirPath)
+	})
+}
+
+func (a *App) archiveVMDir(w http.ResponseWriter, r *http.Request, sc *sftp.Client, vmID, dirPath string) {
+	info, err := sc.Stat(dirPath)
+	if err != nil {
+		a.writeFileError(w, r, vmID, dirPath, err)
+		return
+	}
+	if !info.IsDir() {
+		a.writeError(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	root := archiveRootName(dirPath)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": root + ".tar.gz"}))
+	w.WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	n, err := writeArchive(tw, sc, dirPath, root)
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	logger := a.ctxLogger(r.Context())
+	if err != nil {
+		logger.Warn("Directory archive aborted", "vmID", vmID, "path", dirPath, "bytes", n, "error", err)
+		return
+	}
+	logger.Info("Served directory archive", "vmID", vmID, "path", dirPath, "bytes", n)
+}
+
+// archiveRootName is the top-level directory name inside the archive.
+func archiveRootName(dirPath string) string {
+	switch dirPath {
+	case ".":
+		return "home"
+	case "/":
+		return "root"
+	}
+	return path.Base(dirPath)
+}
+
+// writeArchive walks dirPath and writes its directories, regular files and
+// symlinks under root. Entries that can't be read, and paths cleanRemotePath
+// refuses, are skipped. It returns the file bytes written.
+func writeArchive(tw *tar.Writer, sc *sftp.Client, dirPath, root string) (int64, error) {
+	var total int64
+	walker := sc.Walk(dirPath)
+	for walker.Step() {
+		if walker.Err() != nil {
+			continue
+		}
+		p, info := walker.Path(), walker.Stat()
+		if _, err := cleanRemotePath(p); err != nil {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+
+		var link string
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := sc.ReadLink(p)
+			if err != nil {
+				continue
+			}
+			link = target
+		default:
+			continue
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return total, err
+		}
+		rel := p
+		switch {
+		case p == dirPath:
+			rel = ""
+		case dirPath != ".":
+			rel = strings.TrimPrefix(strings.TrimPrefix(p, dirPath), "/")
+		}
+		hdr.Name = path.Join(root, rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if !info.Mode().IsRegular() {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return total, err
+			}
+			continue
+		}
+		if total+info.Size() > codaArchiveMaxBytes {
+			return total, fmt.Errorf("archive exceeds %d bytes", codaArchiveMaxBytes)
+		}
+		f, err := sc.Open(p)
+		if err != nil {
+			continue
+		}
+		err = tw.WriteHeader(hdr)
+		if err == nil {
+			var n int64
+			// The header fixes the size; a file that changed since the walk
+			// read it is cut or padded to match.
+			n, err = io.Copy(tw, io.LimitReader(f, hdr.Size))
+			if err == nil && n < hdr.Size {
+				_, err = tw.Write(make([]byte, hdr.Size-n))
+			}
+			total += n
+		}
+		_ = f.Close()
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
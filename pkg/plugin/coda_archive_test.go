@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHandleVMArchive_OverSFTP(t *testing.T) {
+	srv := newTestSSHServer(t)
+	srv.sftp = true
+	defer srv.close()
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	dir := filepath.Join(t.TempDir(), "lab")
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data", "results.csv"), []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("X=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data/results.csv", filepath.Join(dir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/archive?path="+dir, nil), "alice"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=lab.tar.gz" {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(content) + hdr.Linkname
+	}
+	want := map[string]string{
+		"lab/":                 "",
+		"lab/.env":             "X=1\n",
+		"lab/data/":            "",
+		"lab/data/results.csv": "a,b\n1,2\n",
+		"lab/latest":           "data/results.csv",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archive = %v, want %v", got, want)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/archive?path="+filepath.Join(dir, ".env"), nil), "alice"))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("file path: status=%d", rr.Code)
+	}
+}
+
+func TestArchiveRootName(t *testing.T) {
+	for in, want := range map[string]string{".": "home", "/": "root", "/home/ubuntu/lab": "lab", "app": "app"} {
+		if got := archiveRootName(in); got != want {
+			t.Errorf("archiveRootName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package plugin
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -58,9 +57,9 @@ const (
 
 // CodaExecRequest is the JSON body for POST /coda/exec.
 type CodaExecRequest struct {
-	Command   string `json:"command"`
+	Command   string `json:"command" validate:"required"`
 	TimeoutMs int    `json:"timeoutMs,omitempty"`
-	Mode      string `json:"mode,omitempty"` // "raw" (default) or "gated"
+	Mode      string `json:"mode,omitempty" validate:"oneof=raw gated"` // "raw" (default) or "gated"
 }
 
 // CodaExecResponse is the JSON response from POST /coda/exec.
@@ -93,24 +92,13 @@ func (a *App) handleCodaExec(w http.ResponseWriter, r *http.Request) {
 
 	if a.execRateLimiter != nil {
 		if ok, retryAfter := a.execRateLimiter.allow(user); !ok {
-			// Round up to whole seconds for the header (RFC 7231 §7.1.3).
-			secs := int(retryAfter.Seconds())
-			if secs < 1 {
-				secs = 1
-			}
-			w.Header().Set("Retry-After", fmt.Sprintf("%d", secs))
-			a.writeError(w, "Rate limit exceeded — slow down /coda/exec calls", http.StatusTooManyRequests)
+			a.writeRateLimited(w, retryAfter, "Rate limit exceeded — slow down /coda/exec calls")
 			return
 		}
 	}
 
 	var req CodaExecRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.writeError(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	if req.Command == "" {
-		a.writeError(w, "Command is required", http.StatusBadRequest)
+	if !a.decodeRequest(w, r, &req) {
 		return
 	}
 
@@ -126,10 +114,6 @@ func (a *App) handleCodaExec(w http.ResponseWriter, r *http.Request) {
 	if mode == "" {
 		mode = "raw"
 	}
-	if mode != "raw" && mode != "gated" {
-		a.writeError(w, "Mode must be 'raw' or 'gated'", http.StatusBadRequest)
-		return
-	}
 
 	client, vmID := a.findSSHClientForUser(user)
 	if client == nil {
@@ -171,6 +155,29 @@ func userLoginFromContext(ctx context.Context) string {
 	return ""
 }
 
+// userEmailFromContext returns the request's Grafana user email, or "".
+func userEmailFromContext(ctx context.Context) string {
+	pluginCtx := backend.PluginConfigFromContext(ctx)
+	if pluginCtx.User != nil {
+		return pluginCtx.User.Email
+	}
+	return ""
+}
+
+// userIsAdminFromContext reports whether the request's Grafana user holds the
+// Admin org role.
+func userIsAdminFromContext(ctx context.Context) bool {
+	pluginCtx := backend.PluginConfigFromContext(ctx)
+	return pluginCtx.User != nil && pluginCtx.User.Role == "Admin"
+}
+
+// userCanEditFromContext reports whether the request's Grafana user holds
+// the Editor or Admin org role.
+func userCanEditFromContext(ctx context.Context) bool {
+	pluginCtx := backend.PluginConfigFromContext(ctx)
+	return pluginCtx.User != nil && (pluginCtx.User.Role == "Editor" || pluginCtx.User.Role == "Admin")
+}
+
 // findSSHClientForUser returns the SSH client of the user's active terminal
 // session, or nil if they have no active session. The vmID is returned for
 // logging only. Acquires streamSessionsMu briefly.
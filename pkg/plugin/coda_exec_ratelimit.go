@@ -65,31 +65,38 @@ func (b *tokenBucket) retryAfter() time.Duration {
 	return time.Duration(math.Ceil(seconds*1000)) * time.Millisecond
 }
 
-// execRateLimiter manages per-user token buckets for /coda/exec. Buckets are
-// created lazily on first use and never evicted — memory grows by a small
-// constant per distinct caller. Acceptable trade-off for a single-tenant
-// plugin instance.
-type execRateLimiter struct {
-	mu      sync.Mutex
-	buckets map[string]*tokenBucket
-	now     func() time.Time // injectable for tests
+// rateLimiter manages per-user token buckets. Buckets are created lazily on
+// first use and never evicted — memory grows by a small constant per distinct
+// caller. Acceptable trade-off for a single-tenant plugin instance.
+type rateLimiter struct {
+	mu           sync.Mutex
+	buckets      map[string]*tokenBucket
+	burst        float64
+	refillPerSec float64
+	now          func() time.Time // injectable for tests
 }
 
-func newExecRateLimiter() *execRateLimiter {
-	return &execRateLimiter{
-		buckets: map[string]*tokenBucket{},
-		now:     time.Now,
+func newRateLimiter(burst, refillPerSec float64) *rateLimiter {
+	return &rateLimiter{
+		buckets:      map[string]*tokenBucket{},
+		burst:        burst,
+		refillPerSec: refillPerSec,
+		now:          time.Now,
 	}
 }
 
+func newExecRateLimiter() *rateLimiter {
+	return newRateLimiter(codaExecRateBurst, codaExecRateRefillPerSec)
+}
+
 // allow returns (true, 0) if the user's bucket had a token, or
 // (false, retryAfter) when the request should be rejected.
-func (r *execRateLimiter) allow(user string) (bool, time.Duration) {
+func (r *rateLimiter) allow(user string) (bool, time.Duration) {
 	now := r.now()
 	r.mu.Lock()
 	b, ok := r.buckets[user]
 	if !ok {
-		b = newTokenBucket(codaExecRateBurst, codaExecRateRefillPerSec, now)
+		b = newTokenBucket(r.burst, r.refillPerSec, now)
 		r.buckets[user] = b
 	}
 	r.mu.Unlock()
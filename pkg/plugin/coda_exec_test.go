@@ -19,6 +19,7 @@ import (
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -257,6 +258,8 @@ type testSSHServer struct {
 	hostKey   ssh.Signer
 	clientKey ssh.Signer
 	handler   func(command string) (stdout, stderr string, exit int, delay time.Duration)
+	sftp      bool              // serve the "sftp" subsystem against the local filesystem
+	forwards  map[uint32]string // direct-tcpip port on the "VM" -> local address
 	wg        sync.WaitGroup
 	closed    chan struct{}
 }
@@ -346,6 +349,10 @@ func (s *testSSHServer) handleConn(c net.Conn) {
 	go ssh.DiscardRequests(reqs)
 
 	for newChan := range chans {
+		if newChan.ChannelType() == "direct-tcpip" {
+			go s.handleForward(newChan)
+			continue
+		}
 		if newChan.ChannelType() != "session" {
 			_ = newChan.Reject(ssh.UnknownChannelType, "only sessions")
 			continue
@@ -392,12 +399,62 @@ func (s *testSSHServer) handleSession(ch ssh.Channel, reqs <-chan *ssh.Request)
 			status := struct{ Status uint32 }{Status: uint32(exit)}
 			_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(status))
 			return
+		case "subsystem":
+			if !s.sftp || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			server, err := sftp.NewServer(ch)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			return
 		default:
 			_ = req.Reply(false, nil)
 		}
 	}
 }
 
+// handleForward connects a direct-tcpip channel to the local address
+// forwards maps its port to, standing in for a service on the VM.
+func (s *testSSHServer) handleForward(newChan ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &target); err != nil {
+		_ = newChan.Reject(ssh.ConnectionFailed, "bad payload")
+		return
+	}
+	addr, ok := s.forwards[target.Port]
+	if !ok {
+		_ = newChan.Reject(ssh.ConnectionFailed, "connection refused")
+		return
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		_, _ = io.Copy(ch, conn)
+		_ = ch.CloseWrite()
+	}()
+	_, _ = io.Copy(conn, ch)
+	_ = conn.Close()
+	_ = ch.Close()
+}
+
 func (s *testSSHServer) dialClient(t *testing.T) *ssh.Client {
 	t.Helper()
 	config := &ssh.ClientConfig{
@@ -643,4 +700,3 @@ func TestHandleCodaExec_TimeoutClamping(t *testing.T) {
 		t.Errorf("status=%d want 409 (timeout parsing should not error)", rr.Code)
 	}
 }
-
@@ -0,0 +1,403 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// File read/write used by GET/PUT /vms/{id}/file?path=, directory listing
+// used by GET /vms/{id}/ls?path=, and raw downloads from
+// GET /vms/{id}/download?path=.
+//
+// Lets guides embed a small in-browser editor (e.g. "edit prometheus.yml") and
+// file browser instead of walking learners through vim and ls in the emulated
+// terminal. Access is over SFTP on the SSH client of the caller's own active
+// terminal session for that VM, with the same ownership rule as /coda/exec:
+// no session, no access.
+//
+// Path validation is a guard against obvious mistakes (pseudo-filesystems,
+// relative paths escaping home), not a security boundary — the learner already
+// has a shell on the VM as the same user.
+
+const (
+	// codaFileMaxBytes caps both reads and writes. The editor is meant for
+	// config files, not logs or binaries.
+	codaFileMaxBytes = 1024 * 1024
+	codaFileTimeout  = 30 * time.Second
+	// codaDownloadTimeout bounds a download, which has no size cap. Clients
+	// resume an interrupted one with a Range request.
+	codaDownloadTimeout = 30 * time.Minute
+	// codaLsMaxEntries caps a directory listing; larger directories are
+	// returned truncated.
+	codaLsMaxEntries = 1000
+)
+
+// codaFileDeniedPrefixes are pseudo-filesystems where reads can block or
+// return unbounded data.
+var codaFileDeniedPrefixes = []string{"/proc", "/sys", "/dev"}
+
+// CodaFileResponse is the JSON response from GET /vms/{id}/file.
+type CodaFileResponse struct {
+	Path    string    `json:"path"`
+	Content string    `json:"content"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// CodaFileWriteRequest is the JSON body for PUT /vms/{id}/file.
+type CodaFileWriteRequest struct {
+	Content string `json:"content"`
+}
+
+// CodaDirEntry is one entry in a GET /vms/{id}/ls response.
+type CodaDirEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"` // "file", "dir", "symlink", "other"
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// CodaLsResponse is the JSON response from GET /vms/{id}/ls.
+type CodaLsResponse struct {
+	Path      string         `json:"path"`
+	Entries   []CodaDirEntry `json:"entries"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// cleanRemotePath cleans p and rejects paths outside what the editor and
+// browser may touch. Relative paths resolve against the SSH user's home
+// directory.
+func cleanRemotePath(p string) (string, error) {
+	if strings.ContainsRune(p, 0) {
+		return "", errors.New("path contains a NUL byte")
+	}
+	cleaned := path.Clean(p)
+	if !path.IsAbs(cleaned) && (cleaned == ".." || strings.HasPrefix(cleaned, "../")) {
+		return "", errors.New("relative path escapes the home directory")
+	}
+	for _, prefix := range codaFileDeniedPrefixes {
+		if cleaned == prefix || strings.HasPrefix(cleaned, prefix+"/") {
+			return "", fmt.Errorf("paths under %s are not accessible", prefix)
+		}
+	}
+	return cleaned, nil
+}
+
+// validateRemoteFilePath is cleanRemotePath for a path that must name a file.
+func validateRemoteFilePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path is required")
+	}
+	cleaned, err := cleanRemotePath(p)
+	if err != nil {
+		return "", err
+	}
+	if cleaned == "/" || cleaned == "." {
+		return "", errors.New("path must name a file")
+	}
+	return cleaned, nil
+}
+
+// validateRemoteDirPath is cleanRemotePath for a directory listing. An empty
+// path lists the home directory.
+func validateRemoteDirPath(p string) (string, error) {
+	if p == "" {
+		return ".", nil
+	}
+	return cleanRemotePath(p)
+}
+
+// dirEntryType maps a file mode to the CodaDirEntry type string.
+func dirEntryType(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "other"
+	}
+}
+
+// findSSHClientForUserVM is findSSHClientForUser narrowed to one VM, so a
+// caller cannot reach a VM other than the one their terminal is driving.
+func (a *App) findSSHClientForUserVM(user, vmID string) *ssh.Client {
+	a.streamSessionsMu.Lock()
+	defer a.streamSessionsMu.Unlock()
+	for _, sess := range a.streamSessions {
+		if sess == nil || sess.session == nil {
+			continue
+		}
+		if sess.userLogin == user && sess.vmID == vmID {
+			return sess.session.SSHClient
+		}
+	}
+	return nil
+}
+
+// handleVMFile handles GET/PUT /vms/{id}/file?path=.
+func (a *App) handleVMFile(w http.ResponseWriter, r *http.Request, vmID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.withVMSFTP(w, r, vmID, codaFileTimeout, validateRemoteFilePath, func(sc *sftp.Client, filePath string) {
+		if r.Method == http.MethodGet {
+			a.readVMFile(w, r, sc, vmID, filePath)
+			return
+		}
+		a.writeVMFile(w, r, sc, vmID, filePath)
+	})
+}
+
+// handleVMLs handles GET /vms/{id}/ls?path=.
+func (a *App) handleVMLs(w http.ResponseWriter, r *http.Request, vmID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.withVMSFTP(w, r, vmID, codaFileTimeout, validateRemoteDirPath, func(sc *sftp.Client, dirPath string) {
+		a.listVMDir(w, r, sc, vmID, dirPath)
+	})
+}
+
+// handleVMDownload handles GET /vms/{id}/download?path=.
+func (a *App) handleVMDownload(w http.ResponseWriter, r *http.Request, vmID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.withVMSFTP(w, r, vmID, codaDownloadTimeout, validateRemoteFilePath, func(sc *sftp.Client, filePath string) {
+		a.downloadVMFile(w, r, sc, vmID, filePath)
+	})
+}
+
+// withVMSFTP authenticates the caller, validates ?path= with validate, and
+// runs fn with an SFTP client on the caller's session for vmID. The client is
+// closed when fn returns or timeout elapses.
+func (a *App) withVMSFTP(w http.ResponseWriter, r *http.Request, vmID string, timeout time.Duration, validate func(string) (string, error), fn func(sc *sftp.Client, remotePath string)) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	remotePath, err := validate(r.URL.Query().Get("path"))
+	if err != nil {
+		a.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := a.findSSHClientForUserVM(user, vmID)
+	if client == nil {
+		a.writeError(w, "No active terminal session for this VM", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		a.writeFileError(w, r, vmID, remotePath, fmt.Errorf("failed to start SFTP: %w", err))
+		return
+	}
+	defer func() { _ = sc.Close() }()
+	// sftp has no context support; closing the client aborts in-flight calls.
+	stop := context.AfterFunc(ctx, func() { _ = sc.Close() })
+	defer stop()
+
+	fn(sc, remotePath)
+}
+
+func (a *App) listVMDir(w http.ResponseWriter, r *http.Request, sc *sftp.Client, vmID, dirPath string) {
+	infos, err := sc.ReadDir(dirPath)
+	if err != nil {
+		a.writeFileError(w, r, vmID, dirPath, err)
+		return
+	}
+
+	// Directories first, then by name, so truncation keeps the most
+	// navigable entries.
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].IsDir() != infos[j].IsDir() {
+			return infos[i].IsDir()
+		}
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	resp := CodaLsResponse{Path: dirPath, Entries: make([]CodaDirEntry, 0, min(len(infos), codaLsMaxEntries))}
+	if len(infos) > codaLsMaxEntries {
+		infos = infos[:codaLsMaxEntries]
+		resp.Truncated = true
+	}
+	for _, info := range infos {
+		resp.Entries = append(resp.Entries, CodaDirEntry{
+			Name:    info.Name(),
+			Type:    dirEntryType(info.Mode()),
+			Size:    info.Size(),
+			Mode:    info.Mode().Perm().String(),
+			ModTime: info.ModTime().UTC(),
+		})
+	}
+	a.writeJSON(w, resp, http.StatusOK)
+}
+
+func (a *App) readVMFile(w http.ResponseWriter, r *http.Request, sc *sftp.Client, vmID, filePath string) {
+	info, err := sc.Stat(filePath)
+	if err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		a.writeError(w, "Path is not a regular file", http.StatusBadRequest)
+		return
+	}
+	if info.Size() > codaFileMaxBytes {
+		a.writeError(w, fmt.Sprintf("File too large to edit (%d bytes, max %d)", info.Size(), codaFileMaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	f, err := sc.Open(filePath)
+	if err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	// Read one byte past the cap in case the file grew after Stat.
+	content, err := io.ReadAll(io.LimitReader(f, codaFileMaxBytes+1))
+	if err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	if len(content) > codaFileMaxBytes {
+		a.writeError(w, fmt.Sprintf("File too large to edit (max %d bytes)", codaFileMaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !utf8.Valid(content) {
+		a.writeError(w, "Binary files cannot be edited", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	a.writeJSON(w, CodaFileResponse{
+		Path:    filePath,
+		Content: string(content),
+		Size:    int64(len(content)),
+		Mode:    info.Mode().Perm().String(),
+		ModTime: info.ModTime().UTC(),
+	}, http.StatusOK)
+}
+
+// downloadVMFile serves the file's raw bytes. http.ServeContent answers Range
+// and If-Range requests by seeking the SFTP file, so an interrupted download
+// resumes where it stopped. The ETag changes when the file does, so a resume
+// against a changed file gets the whole file again.
+func (a *App) downloadVMFile(w http.ResponseWriter, r *http.Request, sc *sftp.Client, vmID, filePath string) {
+	f, err := sc.Open(filePath)
+	if err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		a.writeError(w, "Path is not a regular file", http.StatusBadRequest)
+		return
+	}
+
+	name := path.Base(filePath)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	a.ctxLogger(r.Context()).Info("Serving file download", "vmID", vmID, "path", filePath, "size", info.Size(), "range", r.Header.Get("Range"))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+func (a *App) writeVMFile(w http.ResponseWriter, r *http.Request, sc *sftp.Client, vmID, filePath string) {
+	// JSON escaping can roughly double the encoded size of the content.
+	r.Body = http.MaxBytesReader(w, r.Body, 2*codaFileMaxBytes+1024)
+	var req CodaFileWriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			a.writeError(w, fmt.Sprintf("Content too large (max %d bytes)", codaFileMaxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		a.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Content) > codaFileMaxBytes {
+		a.writeError(w, fmt.Sprintf("Content too large (max %d bytes)", codaFileMaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	mode := os.FileMode(0o644)
+	if info, err := sc.Stat(filePath); err == nil {
+		if !info.Mode().IsRegular() {
+			a.writeError(w, "Path is not a regular file", http.StatusBadRequest)
+			return
+		}
+		mode = info.Mode().Perm()
+	}
+
+	f, err := sc.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	if _, err := f.Write([]byte(req.Content)); err != nil {
+		_ = f.Close()
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	if err := f.Close(); err != nil {
+		a.writeFileError(w, r, vmID, filePath, err)
+		return
+	}
+	if err := sc.Chmod(filePath, mode); err != nil {
+		a.ctxLogger(r.Context()).Warn("Failed to set file mode", "vmID", vmID, "path", filePath, "error", err)
+	}
+
+	a.ctxLogger(r.Context()).Info("Wrote file via /vms/{id}/file", "vmID", vmID, "path", filePath, "size", len(req.Content))
+	a.writeJSON(w, map[string]interface{}{"path": filePath, "size": len(req.Content)}, http.StatusOK)
+}
+
+// writeFileError maps SFTP errors to HTTP status codes.
+func (a *App) writeFileError(w http.ResponseWriter, r *http.Request, vmID, filePath string, err error) {
+	a.ctxLogger(r.Context()).Warn("File operation failed", "vmID", vmID, "path", filePath, "error", err)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		a.writeError(w, "File not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		a.writeError(w, "Permission denied", http.StatusForbidden)
+	case isDeadSessionError(err):
+		a.writeError(w,
+			"Terminal session is no longer connected. Reconnect via the terminal panel and try again.",
+			http.StatusServiceUnavailable)
+	default:
+		a.writeError(w, fmt.Sprintf("File operation failed: %v", err), http.StatusBadGateway)
+	}
+}
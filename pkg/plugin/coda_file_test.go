@@ -0,0 +1,276 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRemoteFilePath(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "/etc/prometheus/prometheus.yml", want: "/etc/prometheus/prometheus.yml"},
+		{in: "/etc//alloy/../alloy/config.alloy", want: "/etc/alloy/config.alloy"},
+		{in: "app/config.yaml", want: "app/config.yaml"},
+		{in: "", wantErr: true},
+		{in: "/", wantErr: true},
+		{in: "../outside", wantErr: true},
+		{in: "a/../../outside", wantErr: true},
+		{in: "/proc/self/environ", wantErr: true},
+		{in: "/sys", wantErr: true},
+		{in: "/dev/zero", wantErr: true},
+		{in: "/devices.txt", want: "/devices.txt"},
+		{in: "/tmp/a\x00b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := validateRemoteFilePath(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateRemoteFilePath(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("validateRemoteFilePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func fileRequest(method, vmID, path, body, user string) *http.Request {
+	target := "/vms/" + vmID + "/file?path=" + path
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if user != "" {
+		r = withUser(r, user)
+	}
+	return r
+}
+
+func TestHandleVMFile_RequiresOwnSession(t *testing.T) {
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "bob",
+		session:   &TerminalSession{VMID: "vm-1"},
+	}
+
+	rr := httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodGet, "vm-1", "/etc/hosts", "", ""))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("no user: got %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodGet, "vm-1", "/etc/hosts", "", "alice"))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("other user's VM: got %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodGet, "vm-1", "/proc/1/environ", "", "bob"))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("denied path: got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodPost, "vm-1", "/etc/hosts", "", "bob"))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandleVMFile_ReadWriteOverSFTP(t *testing.T) {
+	srv := newTestSSHServer(t)
+	srv.sftp = true
+	defer srv.close()
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "prometheus.yml")
+	if err := os.WriteFile(target, []byte("scrape_interval: 15s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodGet, "vm-1", target, "", "alice"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var got CodaFileResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Content != "scrape_interval: 15s\n" || got.Mode != "-rw-------" {
+		t.Errorf("GET resp = %+v", got)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodPut, "vm-1", target, `{"content":"scrape_interval: 5s\n"}`, "alice"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	written, _ := os.ReadFile(target)
+	if string(written) != "scrape_interval: 5s\n" {
+		t.Errorf("file content = %q", written)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode changed to %v, want preserved 0600", info.Mode().Perm())
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodGet, "vm-1", filepath.Join(dir, "missing.yml"), "", "alice"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	big := filepath.Join(dir, "big.log")
+	if err := os.WriteFile(big, make([]byte, codaFileMaxBytes+1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, fileRequest(http.MethodGet, "vm-1", big, "", "alice"))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized file: got %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestValidateRemoteDirPath(t *testing.T) {
+	for in, want := range map[string]string{"": ".", "/": "/", "./app/": "app", "/etc/alloy": "/etc/alloy"} {
+		if got, err := validateRemoteDirPath(in); err != nil || got != want {
+			t.Errorf("validateRemoteDirPath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"..", "/proc", "/sys/class"} {
+		if _, err := validateRemoteDirPath(in); err == nil {
+			t.Errorf("validateRemoteDirPath(%q) should fail", in)
+		}
+	}
+}
+
+func TestHandleVMLs_OverSFTP(t *testing.T) {
+	srv := newTestSSHServer(t)
+	srv.sftp = true
+	defer srv.close()
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "zdir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/ls?path="+dir, nil), "alice"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var got CodaLsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Entries) != 3 {
+		t.Fatalf("entries = %+v, want 3", got.Entries)
+	}
+	// Directories sort first.
+	if got.Entries[0].Name != "zdir" || got.Entries[0].Type != "dir" {
+		t.Errorf("first entry = %+v, want zdir directory", got.Entries[0])
+	}
+	if got.Entries[1].Name != "a.txt" || got.Entries[1].Type != "file" || got.Entries[1].Size != 5 {
+		t.Errorf("second entry = %+v, want 5-byte a.txt", got.Entries[1])
+	}
+	if got.Entries[2].Type != "symlink" {
+		t.Errorf("third entry = %+v, want symlink", got.Entries[2])
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/ls?path="+filepath.Join(dir, "nope"), nil), "alice"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("missing dir: got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleVMDownload_Range(t *testing.T) {
+	srv := newTestSSHServer(t)
+	srv.sftp = true
+	defer srv.close()
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	target := filepath.Join(t.TempDir(), "capture.pcap")
+	content := make([]byte, 3*codaFileMaxBytes)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	if err := os.WriteFile(target, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	download := func(header http.Header) *httptest.ResponseRecorder {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/download?path="+target, nil), "alice")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		app.handleVMByID(rr, req)
+		return rr
+	}
+
+	rr := download(nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), content) {
+		t.Fatalf("full download: status=%d len=%d", rr.Code, rr.Body.Len())
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename=capture.pcap` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	etag := rr.Header().Get("ETag")
+
+	rr = download(http.Header{"Range": {"bytes=1000-"}, "If-Range": {etag}})
+	if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), content[1000:]) {
+		t.Errorf("resumed download: status=%d len=%d", rr.Code, rr.Body.Len())
+	}
+
+	rr = download(http.Header{"Range": {"bytes=1000-"}, "If-Range": {`"changed"`}})
+	if rr.Code != http.StatusOK || rr.Body.Len() != len(content) {
+		t.Errorf("stale If-Range: status=%d len=%d", rr.Code, rr.Body.Len())
+	}
+
+	rr = download(http.Header{"Range": {"bytes=999999999-"}})
+	if rr.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range: status=%d", rr.Code)
+	}
+}
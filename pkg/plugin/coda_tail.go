@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"golang.org/x/crypto/ssh"
+)
+
+// File tail streaming over Grafana Live.
+//
+// Channel path: tail/{vmId}/{encodedPath}
+//
+// encodedPath is the file path in unpadded base64url, because Live channel
+// segments cannot carry "/" and most punctuation. RunStream runs
+// `tail -F` on the caller's active SSH connection to the VM and forwards
+// output as "output" frames, so a guide can show a log next to the terminal.
+//
+// Like /vms/{id}/file, the channel is only available to the user whose
+// terminal session is driving the VM; it never opens its own SSH connection.
+// The channel is read-only — PublishStream rejects it.
+
+const (
+	tailChannelPrefix = "tail"
+	// tailInitialLines is how much existing content is shown on subscribe.
+	tailInitialLines = 50
+)
+
+// encodeTailPath encodes a file path for a tail channel segment.
+func encodeTailPath(p string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(p))
+}
+
+// parseTailChannel extracts the VM ID and validated file path from a
+// tail/{vmId}/{encodedPath} channel path.
+func parseTailChannel(channelPath string) (string, string, error) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) != 3 || parts[0] != tailChannelPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("invalid tail channel: %s", channelPath)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid encoded path: %w", err)
+	}
+	filePath, err := validateRemoteFilePath(string(raw))
+	if err != nil {
+		return "", "", err
+	}
+	return parts[1], filePath, nil
+}
+
+// tailCommand builds the remote tail invocation. -F keeps following across
+// log rotation and waits for files that do not exist yet.
+func tailCommand(filePath string) string {
+	return fmt.Sprintf("tail -n %d -F -- %s", tailInitialLines, shellSingleQuote(filePath))
+}
+
+func pluginUserLogin(pCtx backend.PluginContext) string {
+	if pCtx.User != nil {
+		return pCtx.User.Login
+	}
+	return ""
+}
+
+func pluginUserIsAdmin(pCtx backend.PluginContext) bool {
+	return pCtx.User != nil && pCtx.User.Role == "Admin"
+}
+
+// subscribeTailStream authorizes a tail channel subscription.
+func (a *App) subscribeTailStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+
+	vmID, filePath, err := parseTailChannel(req.Path)
+	if err != nil {
+		ctxLogger.Warn("Rejecting tail subscription", "path", req.Path, "error", err)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	if user == "" || a.findSSHClientForUserVM(user, vmID) == nil {
+		ctxLogger.Info("Rejecting tail subscription without an active terminal session", "vmID", vmID, "user", user)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+
+	ctxLogger.Info("Tail subscription accepted", "vmID", vmID, "file", filePath, "user", user)
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runTailStream streams `tail -F` output for the channel's file until the
+// stream is closed or the SSH session ends.
+func (a *App) runTailStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	ctxLogger := a.ctxLogger(ctx)
+
+	vmID, filePath, err := parseTailChannel(req.Path)
+	if err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return err
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	client := a.findSSHClientForUserVM(user, vmID)
+	if client == nil {
+		errMsg := "No active terminal session for this VM"
+		sendStreamError(ctx, sender, errMsg)
+		return errors.New(errMsg)
+	}
+
+	ctxLogger.Info("Tail stream started", "vmID", vmID, "file", filePath, "user", user)
+	_ = a.streamRemoteCommand(ctx, sender, client, vmID, tailCommand(filePath), nil)
+	ctxLogger.Info("Tail stream ended", "vmID", vmID, "file", filePath)
+	return nil
+}
+
+// streamRemoteCommand runs a long-lived command in a new session on client
+// and forwards its stdout as "output" messages, bracketed by "connected" and
+// "disconnected", until the command exits or ctx is cancelled. onOutput, when
+// set, also receives each chunk. Returns the session's exit error (nil, an
+// *ssh.ExitError, or a transport error).
+func (a *App) streamRemoteCommand(ctx context.Context, sender *backend.StreamSender, client *ssh.Client, vmID, command string, onOutput func([]byte)) error {
+	ctxLogger := a.ctxLogger(ctx)
+
+	session, err := client.NewSession()
+	if err != nil {
+		sendStreamError(ctx, sender, fmt.Sprintf("Failed to open SSH session: %v", err))
+		return err
+	}
+	defer func() { _ = session.Close() }()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		sendStreamError(ctx, sender, fmt.Sprintf("Failed to get stdout pipe: %v", err))
+		return err
+	}
+	if err := session.Start(command); err != nil {
+		sendStreamError(ctx, sender, fmt.Sprintf("Failed to start command: %v", err))
+		return err
+	}
+
+	sendStreamMessage(sender, TerminalStreamOutput{Type: "connected", VmId: vmID})
+
+	// Closing the session unblocks the reader when the stream ends first.
+	stop := context.AfterFunc(ctx, func() { _ = session.Close() })
+	defer stop()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := stdout.Read(buf)
+		if n > 0 {
+			sendStreamMessage(sender, TerminalStreamOutput{Type: "output", Data: string(buf[:n])})
+			if onOutput != nil {
+				onOutput(buf[:n])
+			}
+		}
+		if readErr != nil {
+			if readErr != io.EOF && ctx.Err() == nil {
+				ctxLogger.Warn("Remote stream read failed", "vmID", vmID, "error", readErr)
+			}
+			break
+		}
+	}
+
+	waitErr := session.Wait()
+	sendStreamMessage(sender, TerminalStreamOutput{Type: "disconnected"})
+	return waitErr
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseTailChannel(t *testing.T) {
+	vmID, filePath, err := parseTailChannel("tail/vm-1/" + encodeTailPath("/var/log/alloy.log"))
+	if err != nil || vmID != "vm-1" || filePath != "/var/log/alloy.log" {
+		t.Fatalf("parseTailChannel = %q, %q, %v", vmID, filePath, err)
+	}
+
+	for _, p := range []string{
+		"tail/vm-1",
+		"tail//" + encodeTailPath("/var/log/x"),
+		"tail/vm-1/not*base64",
+		"tail/vm-1/" + encodeTailPath("/proc/kmsg"),
+		"tail/vm-1/" + encodeTailPath("/var/log/x") + "/extra",
+	} {
+		if _, _, err := parseTailChannel(p); err == nil {
+			t.Errorf("parseTailChannel(%q) should fail", p)
+		}
+	}
+}
+
+func TestTailCommand(t *testing.T) {
+	got := tailCommand("/tmp/it's.log")
+	want := `tail -n 50 -F -- '/tmp/it'\''s.log'`
+	if got != want {
+		t.Errorf("tailCommand = %q, want %q", got, want)
+	}
+}
+
+func TestSubscribeTailStream_RequiresOwnSession(t *testing.T) {
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "bob",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: &ssh.Client{}},
+	}
+	path := "tail/vm-1/" + encodeTailPath("/var/log/syslog")
+
+	for user, want := range map[string]backend.SubscribeStreamStatus{
+		"alice": backend.SubscribeStreamStatusPermissionDenied,
+		"bob":   backend.SubscribeStreamStatusOK,
+	} {
+		resp, err := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+			Path:          path,
+			PluginContext: backend.PluginContext{User: &backend.User{Login: user}},
+		})
+		if err != nil || resp.Status != want {
+			t.Errorf("%s: status=%v err=%v, want %v", user, resp.Status, err, want)
+		}
+	}
+}
+
+func TestRunTailStream_ForwardsOutput(t *testing.T) {
+	srv := newTestSSHServer(t)
+	defer srv.close()
+	var gotCmd string
+	srv.handler = func(cmd string) (string, string, int, time.Duration) {
+		gotCmd = cmd
+		return "line one\nline two\n", "", 0, 0
+	}
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	rec, sender := newStreamRecorder(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := app.RunStream(ctx, &backend.RunStreamRequest{
+		Path:          "tail/vm-1/" + encodeTailPath("/var/log/app.log"),
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "alice"}},
+	}, sender)
+	if err != nil {
+		t.Fatalf("RunStream: %v", err)
+	}
+
+	if gotCmd != tailCommand("/var/log/app.log") {
+		t.Errorf("remote command = %q", gotCmd)
+	}
+	var out strings.Builder
+	for _, m := range rec.ofType("output") {
+		out.WriteString(m.Data)
+	}
+	if out.String() != "line one\nline two\n" {
+		t.Errorf("streamed output = %q", out.String())
+	}
+	if len(rec.ofType("connected")) != 1 || len(rec.ofType("disconnected")) != 1 {
+		t.Errorf("expected one connected and one disconnected message, got %+v", rec.messages)
+	}
+}
+
+func TestRunTailStream_NoSession(t *testing.T) {
+	app := newExecApp()
+	rec, sender := newStreamRecorder(t)
+	err := app.RunStream(context.Background(), &backend.RunStreamRequest{
+		Path:          "tail/vm-1/" + encodeTailPath("/var/log/app.log"),
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "alice"}},
+	}, sender)
+	if err == nil || len(rec.ofType("error")) != 1 {
+		t.Errorf("expected an error message, got err=%v messages=%+v", err, rec.messages)
+	}
+}
@@ -1,7 +1,10 @@
 package plugin
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -13,6 +16,9 @@ func TestIsUsableState(t *testing.T) {
 		{"active", true},
 		{"pending", true},
 		{"provisioning", true},
+		{"stopping", true},
+		{"stopped", true},
+		{"starting", true},
 		{"destroyed", false},
 		{"destroying", false},
 		{"error", false},
@@ -52,3 +58,46 @@ func TestIsVMNotFoundError(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEnrollmentKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"valid", http.StatusOK, `{"expiresAt":"2026-12-01T00:00:00Z"}`, "valid", false},
+		{"invalid", http.StatusUnauthorized, "", "invalid", false},
+		{"expired", http.StatusGone, "", "expired", false},
+		{"rate limited", http.StatusTooManyRequests, "", "", true},
+		{"server error", http.StatusInternalServerError, "boom", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/auth/validate" {
+					t.Errorf("path = %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			result, err := ValidateEnrollmentKey(context.Background(), srv.URL, "key")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.Status != tt.want {
+				t.Errorf("status = %q, want %q", result.Status, tt.want)
+			}
+			if tt.want == "valid" && result.ExpiresAt == nil {
+				t.Error("expiresAt not parsed")
+			}
+		})
+	}
+}
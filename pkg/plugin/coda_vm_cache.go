@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// VM list cache.
+//
+// Admin views and the reuse lookup on every terminal connect list VMs, often
+// with the same filters seconds apart. ListVMs answers repeats from a short
+// cache instead of asking Coda again. Anything that changes the set of VMs or
+// their states invalidates it: creates, deletes and power actions made
+// through this client, and VM state webhooks from Coda. The TTL bounds
+// staleness from changes the plugin isn't told about.
+
+const vmListCacheTTL = 15 * time.Second
+
+type vmListEntry struct {
+	vms       []VM
+	fetchedAt time.Time
+}
+
+// vmListCache holds ListVMs results by request URL. The zero value is ready
+// to use.
+type vmListCache struct {
+	mu      sync.Mutex
+	entries map[string]vmListEntry
+	// generation counts invalidations, so a fetch that started before one
+	// doesn't store its (possibly stale) result after it.
+	generation uint64
+}
+
+// get returns a copy of the cached list for key, and the generation to pass
+// to put when it misses.
+func (c *vmListCache) get(key string) ([]VM, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || timeNow().Sub(e.fetchedAt) >= vmListCacheTTL {
+		return nil, c.generation, false
+	}
+	return slices.Clone(e.vms), c.generation, true
+}
+
+func (c *vmListCache) put(key string, generation uint64, vms []VM) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = map[string]vmListEntry{}
+	}
+	c.entries[key] = vmListEntry{vms: slices.Clone(vms), fetchedAt: timeNow()}
+}
+
+func (c *vmListCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.generation++
+}
+
+// InvalidateVMList drops cached ListVMs results, for changes made outside
+// this client (e.g. a VM state webhook).
+func (c *CodaClient) InvalidateVMList() {
+	c.vmList.invalidate()
+}
@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCodaClient_ListVMsCache(t *testing.T) {
+	var lists atomic.Int32
+	c := newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			lists.Add(1)
+			_ = json.NewEncoder(w).Encode(VMListResponse{VMs: []VM{{ID: "vm-1", State: "active"}}})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	ctx := context.Background()
+	list := func(owner string) {
+		t.Helper()
+		if _, err := c.ListVMs(ctx, &ListVMsOptions{Owner: owner}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list("alice")
+	list("alice")
+	list("bob")
+	if n := lists.Load(); n != 2 {
+		t.Fatalf("repeat list fetched again: %d fetches", n)
+	}
+
+	if err := c.DeleteVM(ctx, "vm-1", false); err != nil {
+		t.Fatal(err)
+	}
+	list("alice")
+	c.InvalidateVMList()
+	list("alice")
+	if n := lists.Load(); n != 4 {
+		t.Errorf("invalidation not honoured: %d fetches", n)
+	}
+
+	defer func(orig func() time.Time) { timeNow = orig }(timeNow)
+	timeNow = func() time.Time { return time.Now().Add(vmListCacheTTL) }
+	list("alice")
+	if n := lists.Load(); n != 5 {
+		t.Errorf("expired entry served: %d fetches", n)
+	}
+}
+
+func TestVMListCache_StaleFetchNotStored(t *testing.T) {
+	var c vmListCache
+	_, generation, _ := c.get("k")
+	c.invalidate()
+	c.put("k", generation, []VM{{ID: "vm-1"}})
+	if _, _, ok := c.get("k"); ok {
+		t.Error("result fetched before an invalidation was cached")
+	}
+}
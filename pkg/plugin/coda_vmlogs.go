@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// VM system logs: cloud-init output and the systemd journal.
+//
+// When provisioning "succeeds" but a service inside the VM does not come up,
+// the evidence is in cloud-init's output or the journal. These are exposed
+// two ways, both over the caller's active SSH session for the VM:
+//
+//	GET /vms/{id}/logs?source=&unit=&lines=   one-shot snapshot
+//	vmlogs/{vmId}/{source}[/{unit}]           Live channel that follows the log
+//
+// Logs are only reachable once SSH is up; failures before that point surface
+// through the VM's Coda error state instead.
+
+const (
+	vmLogsChannelPrefix = "vmlogs"
+
+	vmLogsDefaultLines = 200
+	vmLogsMaxLines     = 1000
+	vmLogsTimeout      = 10 * time.Second
+)
+
+// vmLogUnitPattern matches systemd unit names, including escaped and
+// template instances such as "getty@tty1.service".
+var vmLogUnitPattern = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]{1,128}$`)
+
+// vmLogCommand returns the remote command for a log source. unit filters the
+// journal to one systemd unit and is rejected for other sources.
+func vmLogCommand(source, unit string, lines int, follow bool) (string, error) {
+	if unit != "" && !vmLogUnitPattern.MatchString(unit) {
+		return "", fmt.Errorf("invalid unit name: %q", unit)
+	}
+	switch source {
+	case "cloud-init":
+		if unit != "" {
+			return "", errors.New("unit is only supported for the journal source")
+		}
+		cmd := fmt.Sprintf("tail -n %d", lines)
+		if follow {
+			cmd += " -F"
+		}
+		return cmd + " -- /var/log/cloud-init-output.log", nil
+	case "journal":
+		cmd := fmt.Sprintf("journalctl --no-pager -o short-iso -n %d", lines)
+		if unit != "" {
+			cmd += " -u " + shellSingleQuote(unit)
+		}
+		if follow {
+			cmd += " -f"
+		}
+		return cmd, nil
+	default:
+		return "", fmt.Errorf("unknown log source %q (want cloud-init or journal)", source)
+	}
+}
+
+// parseVMLogsChannel extracts the VM ID, source and optional unit from a
+// vmlogs/{vmId}/{source}[/{unit}] channel path.
+func parseVMLogsChannel(channelPath string) (vmID, source, unit string, err error) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != vmLogsChannelPrefix || parts[1] == "" {
+		return "", "", "", fmt.Errorf("invalid vmlogs channel: %s", channelPath)
+	}
+	if len(parts) == 4 {
+		unit = parts[3]
+	}
+	if _, err := vmLogCommand(parts[2], unit, vmLogsDefaultLines, true); err != nil {
+		return "", "", "", err
+	}
+	return parts[1], parts[2], unit, nil
+}
+
+// subscribeVMLogsStream authorizes a vmlogs channel subscription.
+func (a *App) subscribeVMLogsStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+
+	vmID, source, unit, err := parseVMLogsChannel(req.Path)
+	if err != nil {
+		ctxLogger.Warn("Rejecting vmlogs subscription", "path", req.Path, "error", err)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	if user == "" || a.findSSHClientForUserVM(user, vmID) == nil {
+		ctxLogger.Info("Rejecting vmlogs subscription without an active terminal session", "vmID", vmID, "user", user)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+
+	ctxLogger.Info("VM logs subscription accepted", "vmID", vmID, "source", source, "unit", unit, "user", user)
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runVMLogsStream follows the channel's log source until the stream closes.
+func (a *App) runVMLogsStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	ctxLogger := a.ctxLogger(ctx)
+
+	vmID, source, unit, err := parseVMLogsChannel(req.Path)
+	if err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return err
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	client := a.findSSHClientForUserVM(user, vmID)
+	if client == nil {
+		errMsg := "No active terminal session for this VM"
+		sendStreamError(ctx, sender, errMsg)
+		return errors.New(errMsg)
+	}
+
+	command, _ := vmLogCommand(source, unit, vmLogsDefaultLines, true)
+	ctxLogger.Info("VM logs stream started", "vmID", vmID, "source", source, "unit", unit, "user", user)
+	_ = a.streamRemoteCommand(ctx, sender, client, vmID, command, nil)
+	ctxLogger.Info("VM logs stream ended", "vmID", vmID, "source", source)
+	return nil
+}
+
+// VMLogsResponse is the JSON response from GET /vms/{id}/logs.
+type VMLogsResponse struct {
+	Source    string `json:"source"`
+	Unit      string `json:"unit,omitempty"`
+	Output    string `json:"output"`
+	Stderr    string `json:"stderr,omitempty"`
+	ExitCode  int    `json:"exitCode"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// handleVMLogs handles GET /vms/{id}/logs?source=&unit=&lines=.
+func (a *App) handleVMLogs(w http.ResponseWriter, r *http.Request, vmID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	source := q.Get("source")
+	if source == "" {
+		source = "cloud-init"
+	}
+	unit := q.Get("unit")
+	lines := vmLogsDefaultLines
+	if v := q.Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			a.writeError(w, "lines must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		lines = min(n, vmLogsMaxLines)
+	}
+
+	command, err := vmLogCommand(source, unit, lines, false)
+	if err != nil {
+		a.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := a.findSSHClientForUserVM(user, vmID)
+	if client == nil {
+		a.writeError(w, "No active terminal session for this VM", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), vmLogsTimeout)
+	defer cancel()
+
+	result, err := runRemoteCommand(ctx, client, command, "raw")
+	if err != nil {
+		a.ctxLogger(r.Context()).Warn("Failed to read VM logs", "vmID", vmID, "source", source, "error", err)
+		if errors.Is(err, errSSHSessionDead) {
+			a.writeError(w,
+				"Terminal session is no longer connected. Reconnect via the terminal panel and try again.",
+				http.StatusServiceUnavailable)
+			return
+		}
+		a.writeError(w, fmt.Sprintf("Failed to read logs: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	a.writeJSON(w, VMLogsResponse{
+		Source:    source,
+		Unit:      unit,
+		Output:    result.Stdout,
+		Stderr:    result.Stderr,
+		ExitCode:  result.ExitCode,
+		Truncated: result.Truncated,
+	}, http.StatusOK)
+}
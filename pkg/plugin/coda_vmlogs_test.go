@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestVMLogCommand(t *testing.T) {
+	tests := []struct {
+		source, unit string
+		follow       bool
+		want         string
+		wantErr      bool
+	}{
+		{source: "cloud-init", want: "tail -n 200 -- /var/log/cloud-init-output.log"},
+		{source: "cloud-init", follow: true, want: "tail -n 200 -F -- /var/log/cloud-init-output.log"},
+		{source: "journal", want: "journalctl --no-pager -o short-iso -n 200"},
+		{source: "journal", unit: "alloy.service", follow: true, want: "journalctl --no-pager -o short-iso -n 200 -u 'alloy.service' -f"},
+		{source: "journal", unit: "getty@tty1.service", want: "journalctl --no-pager -o short-iso -n 200 -u 'getty@tty1.service'"},
+		{source: "journal", unit: "x; rm -rf /", wantErr: true},
+		{source: "cloud-init", unit: "alloy", wantErr: true},
+		{source: "dmesg", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := vmLogCommand(tt.source, tt.unit, 200, tt.follow)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("vmLogCommand(%q, %q) err = %v, wantErr %v", tt.source, tt.unit, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("vmLogCommand(%q, %q) = %q, want %q", tt.source, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestParseVMLogsChannel(t *testing.T) {
+	vmID, source, unit, err := parseVMLogsChannel("vmlogs/vm-1/journal/alloy.service")
+	if err != nil || vmID != "vm-1" || source != "journal" || unit != "alloy.service" {
+		t.Fatalf("got %q %q %q %v", vmID, source, unit, err)
+	}
+	for _, p := range []string{"vmlogs/vm-1", "vmlogs//journal", "vmlogs/vm-1/nope", "vmlogs/vm-1/journal/a/b"} {
+		if _, _, _, err := parseVMLogsChannel(p); err == nil {
+			t.Errorf("parseVMLogsChannel(%q) should fail", p)
+		}
+	}
+}
+
+func TestHandleVMLogs(t *testing.T) {
+	srv := newTestSSHServer(t)
+	defer srv.close()
+	var gotCmd string
+	srv.handler = func(cmd string) (string, string, int, time.Duration) {
+		gotCmd = cmd
+		return "Cloud-init v. 23.1 finished\n", "", 0, 0
+	}
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	rr := httptest.NewRecorder()
+	app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/logs?lines=5000", nil), "alice"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp VMLogsResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Source != "cloud-init" || resp.Output != "Cloud-init v. 23.1 finished\n" {
+		t.Errorf("resp = %+v", resp)
+	}
+	if want := "tail -n 1000 -- /var/log/cloud-init-output.log"; gotCmd != want {
+		t.Errorf("remote command = %q, want lines clamped: %q", gotCmd, want)
+	}
+
+	for _, target := range []string{"/vms/vm-1/logs?source=dmesg", "/vms/vm-1/logs?lines=abc"} {
+		rr = httptest.NewRecorder()
+		app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, target, nil), "alice"))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, withUser(httptest.NewRequest(http.MethodGet, "/vms/vm-1/logs", nil), "bob"))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("other user: got %d, want %d", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestRunVMLogsStream(t *testing.T) {
+	srv := newTestSSHServer(t)
+	defer srv.close()
+	var gotCmd string
+	srv.handler = func(cmd string) (string, string, int, time.Duration) {
+		gotCmd = cmd
+		return "alloy.service: Failed with result 'exit-code'.\n", "", 0, 0
+	}
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newExecApp()
+	app.streamSessions["terminal/vm-1"] = &streamSession{
+		vmID:      "vm-1",
+		userLogin: "alice",
+		session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+	}
+
+	rec, sender := newStreamRecorder(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := app.RunStream(ctx, &backend.RunStreamRequest{
+		Path:          "vmlogs/vm-1/journal/alloy.service",
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "alice"}},
+	}, sender)
+	if err != nil {
+		t.Fatalf("RunStream: %v", err)
+	}
+	if want := "journalctl --no-pager -o short-iso -n 200 -u 'alloy.service' -f"; gotCmd != want {
+		t.Errorf("remote command = %q, want %q", gotCmd, want)
+	}
+	if out := rec.ofType("output"); len(out) == 0 || out[0].Data != "alloy.service: Failed with result 'exit-code'.\n" {
+		t.Errorf("output messages = %+v", out)
+	}
+}
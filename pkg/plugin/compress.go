@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Response compression.
+//
+// Large JSON responses (guide indexes, VM lists, usage exports) are gzipped
+// when the client accepts it, which matters on slow links. Responses are
+// buffered up to gzipMinSize first: small ones go out as they are, since
+// compressing them costs more than it saves.
+
+const gzipMinSize = 1024
+
+// gzipResponse decides on compression once the body passes gzipMinSize or
+// the handler returns.
+type gzipResponse struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	started bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponse) WriteHeader(code int) {
+	if g.status == 0 {
+		g.status = code
+	}
+}
+
+func (g *gzipResponse) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if g.started {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= gzipMinSize {
+		if err := g.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start writes the status and buffered body, compressed if compress is set
+// and the response is a compressible type not already encoded.
+func (g *gzipResponse) start(compress bool) error {
+	g.started = true
+	h := g.Header()
+	// Ranged responses (and responses offering ranges) stay uncompressed, so
+	// byte offsets refer to the file itself.
+	if compress && h.Get("Content-Encoding") == "" && h.Get("Accept-Ranges") == "" && compressibleType(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		// The compressed body is a different representation of the same
+		// content, so a strong ETag is weakened.
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+		_, err := g.gz.Write(g.buf)
+		return err
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf)
+	return err
+}
+
+func (g *gzipResponse) finish() {
+	if !g.started {
+		if g.status == 0 {
+			g.status = http.StatusOK
+		}
+		_ = g.start(false)
+	}
+	if g.gz != nil {
+		_ = g.gz.Close()
+	}
+}
+
+func compressibleType(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/")
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// withGzip compresses h's large responses for clients that accept gzip.
+func withGzip(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h(w, r)
+			return
+		}
+		g := &gzipResponse{ResponseWriter: w}
+		h(g, r)
+		g.finish()
+	}
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithGzip(t *testing.T) {
+	large := `{"vms":"` + strings.Repeat("x", 2*gzipMinSize) + `"}`
+	h := withGzip(withETag(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/small" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if r.URL.Path == "/ranged" {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		_, _ = w.Write([]byte(large))
+	}))
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	w := get("/large", "br, gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(w.Header().Get("ETag"), `W/"`) {
+		t.Fatalf("headers = %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != large {
+		t.Errorf("decompressed body differs (%d bytes)", len(body))
+	}
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"small":     get("/small", "gzip"),
+		"no accept": get("/large", ""),
+		"q=0":       get("/large", "gzip;q=0"),
+		"ranged":    get("/ranged", "gzip"),
+	} {
+		if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: headers = %v", name, w.Header())
+		}
+	}
+}
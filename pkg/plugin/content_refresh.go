@@ -0,0 +1,174 @@
+package plugin
+
+import (
+	"context"
+	mrand "math/rand/v2"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Content refresh.
+//
+// A scheduler refreshes the cached content indexes in the background so
+// learners' requests find them warm: today the interactive-learning package
+// index with its manifests (package_recommendations.go). Each source is
+// refreshed every contentRefreshIntervalMinutes, 300 by default, a little
+// under the index's cache TTL. Delays are spread by contentRefreshJitter so
+// instances started together don't hit the CDN in step. After a failure the
+// source is retried after contentRefreshRetryBase, doubled per consecutive
+// failure and capped at contentRefreshMaxDelay, so an air-gapped instance
+// isn't probed every few minutes. The status of each source is in GET
+// /health and GET /admin/content-refresh, and POST /admin/content-refresh
+// refreshes everything now.
+
+const (
+	defaultContentRefreshInterval = 300 * time.Minute
+	contentRefreshRetryBase       = 5 * time.Minute
+	contentRefreshMaxDelay        = 24 * time.Hour
+	contentRefreshJitter          = 0.1
+	contentRefreshInitialDelay    = time.Minute
+	contentRefreshTimeout         = 2 * time.Minute
+)
+
+// contentRefreshSource is a cached index the scheduler refreshes; refresh
+// returns how many items it holds.
+type contentRefreshSource struct {
+	name    string
+	refresh func(ctx context.Context) (int, error)
+}
+
+// contentRefreshStatus is a source's refresh history.
+type contentRefreshStatus struct {
+	Source      string    `json:"source"`
+	Items       int       `json:"items"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError,omitempty"`
+	Failures    int       `json:"failures"`
+	NextRefresh time.Time `json:"nextRefresh"`
+}
+
+func (a *App) contentRefreshSources() []contentRefreshSource {
+	return []contentRefreshSource{
+		{name: "package-index", refresh: func(ctx context.Context) (int, error) {
+			resp, err := refreshPackageRecommendations(ctx, a.packageIndexSource())
+			if err != nil {
+				return 0, err
+			}
+			return len(resp.Packages), nil
+		}},
+	}
+}
+
+func (a *App) contentRefreshInterval() time.Duration {
+	if a.settings != nil && a.settings.ContentRefreshIntervalMinutes > 0 {
+		return time.Duration(a.settings.ContentRefreshIntervalMinutes) * time.Minute
+	}
+	return defaultContentRefreshInterval
+}
+
+// contentRefreshDelay returns how long to wait before the next refresh:
+// interval, or after failures consecutive failures contentRefreshRetryBase
+// doubled per failure, spread by jitter (in [-1, 1]) times
+// contentRefreshJitter and capped at contentRefreshMaxDelay.
+func contentRefreshDelay(interval time.Duration, failures int, jitter float64) time.Duration {
+	d := interval
+	if failures > 0 {
+		d = contentRefreshRetryBase << min(failures-1, 10)
+	}
+	d = time.Duration(float64(d) * (1 + jitter*contentRefreshJitter))
+	return min(d, contentRefreshMaxDelay)
+}
+
+// refreshContent refreshes the sources that are due, or all of them with
+// force, and returns when the next one is due.
+func (a *App) refreshContent(ctx context.Context, logger log.Logger, force bool) time.Time {
+	interval := a.contentRefreshInterval()
+	var next time.Time
+	for _, src := range a.contentRefreshSources() {
+		a.contentRefreshMu.Lock()
+		if a.contentRefresh == nil {
+			a.contentRefresh = map[string]*contentRefreshStatus{}
+		}
+		st := a.contentRefresh[src.name]
+		if st == nil {
+			st = &contentRefreshStatus{Source: src.name}
+			a.contentRefresh[src.name] = st
+		}
+		due := force || !timeNow().Before(st.NextRefresh)
+		a.contentRefreshMu.Unlock()
+
+		if due {
+			refreshCtx, cancel := context.WithTimeout(ctx, contentRefreshTimeout)
+			items, err := src.refresh(refreshCtx)
+			cancel()
+			a.contentRefreshMu.Lock()
+			st.LastAttempt = timeNow().UTC()
+			if err != nil {
+				st.Failures++
+				st.LastError = err.Error()
+				logger.Warn("Content refresh failed", "source", src.name, "failures", st.Failures, "error", err)
+			} else {
+				st.Items, st.Failures, st.LastError, st.LastSuccess = items, 0, "", st.LastAttempt
+			}
+			st.NextRefresh = st.LastAttempt.Add(contentRefreshDelay(interval, st.Failures, mrand.Float64()*2-1))
+			a.contentRefreshMu.Unlock()
+		}
+		a.contentRefreshMu.Lock()
+		if next.IsZero() || st.NextRefresh.Before(next) {
+			next = st.NextRefresh
+		}
+		a.contentRefreshMu.Unlock()
+	}
+	return next
+}
+
+// contentRefreshStatuses returns every source's status, by name.
+func (a *App) contentRefreshStatuses() []contentRefreshStatus {
+	a.contentRefreshMu.Lock()
+	defer a.contentRefreshMu.Unlock()
+	out := []contentRefreshStatus{}
+	for _, st := range a.contentRefresh {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
+
+// startContentRefresh schedules content refreshes, the first after a
+// jittered delay so instances started together don't refresh together.
+func (a *App) startContentRefresh() {
+	a.runScheduled(time.Duration(float64(contentRefreshInitialDelay)*(1+mrand.Float64())), func(ctx context.Context) time.Duration {
+		next := a.refreshContent(ctx, a.logger, false)
+		return max(next.Sub(timeNow()), time.Second)
+	})
+}
+
+// handleAdminContentRefresh handles GET (the refresh status) and POST
+// (refresh every source now) on /admin/content-refresh, for admins.
+func (a *App) handleAdminContentRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if userLoginFromContext(ctx) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(ctx) {
+		a.writeError(w, "Only admins can manage content refresh", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		a.refreshContent(context.WithoutCancel(ctx), a.ctxLogger(ctx), true)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.writeJSON(w, map[string]interface{}{
+		"intervalMinutes": int(a.contentRefreshInterval() / time.Minute),
+		"sources":         a.contentRefreshStatuses(),
+	}, http.StatusOK)
+}
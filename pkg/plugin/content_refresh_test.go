@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestRefreshContent(t *testing.T) {
+	resetPackageRecommendationsCache()
+	t.Cleanup(resetPackageRecommendationsCache)
+	advance := withFrozenTime(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
+	payload := validPayload(t)
+	fetchErr := errors.New("cdn unreachable")
+	withFetcherOverride(t, func(ctx context.Context, rawURL string, maxBytes int64) ([]byte, error) {
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return payload, nil
+	})
+	app := newTestApp(t)
+	app.settings = &Settings{ContentRefreshIntervalMinutes: 60}
+	status := func() contentRefreshStatus {
+		t.Helper()
+		statuses := app.contentRefreshStatuses()
+		if len(statuses) != 1 {
+			t.Fatalf("statuses = %+v", statuses)
+		}
+		return statuses[0]
+	}
+
+	next := app.refreshContent(t.Context(), log.DefaultLogger, false)
+	if st := status(); st.Failures != 1 || st.LastError == "" || !st.LastSuccess.IsZero() {
+		t.Errorf("after failure: %+v", st)
+	}
+	if d := next.Sub(timeNow()); d < 4*time.Minute || d > 6*time.Minute {
+		t.Errorf("retry in %v, want about %v", d, contentRefreshRetryBase)
+	}
+
+	// Not due yet: nothing is fetched.
+	fetchErr = nil
+	app.refreshContent(t.Context(), log.DefaultLogger, false)
+	if st := status(); st.Failures != 1 {
+		t.Errorf("refreshed before the retry: %+v", st)
+	}
+
+	advance(6 * time.Minute)
+	next = app.refreshContent(t.Context(), log.DefaultLogger, false)
+	if st := status(); st.Failures != 0 || st.Items == 0 || st.LastError != "" || !st.LastSuccess.Equal(timeNow().UTC()) {
+		t.Errorf("after success: %+v", st)
+	}
+	if d := next.Sub(timeNow()); d < 54*time.Minute || d > 66*time.Minute {
+		t.Errorf("next refresh in %v, want about an hour", d)
+	}
+
+	// The scheduled refresh replaces a cached failure, which requests would
+	// otherwise serve for the cache TTL.
+	resp, err := app.getCachedPackageRecommendations(t.Context())
+	if err != nil || len(resp.Packages) == 0 {
+		t.Errorf("cached index: %v, %v", resp, err)
+	}
+
+	w := httptest.NewRecorder()
+	app.handleAdminContentRefresh(w, roleRequest(http.MethodPost, "/admin/content-refresh", "", "root", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("editor: status %d, want 403", w.Code)
+	}
+	advance(time.Minute)
+	w = httptest.NewRecorder()
+	app.handleAdminContentRefresh(w, roleRequest(http.MethodPost, "/admin/content-refresh", "", "root", "Admin"))
+	var body struct {
+		IntervalMinutes int                    `json:"intervalMinutes"`
+		Sources         []contentRefreshStatus `json:"sources"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || body.IntervalMinutes != 60 || len(body.Sources) != 1 || !body.Sources[0].LastAttempt.Equal(timeNow().UTC()) {
+		t.Errorf("POST: status %d, body %+v", w.Code, body)
+	}
+}
+
+func TestContentRefreshDelay(t *testing.T) {
+	hour := time.Hour
+	cases := []struct {
+		failures int
+		jitter   float64
+		want     time.Duration
+	}{
+		{0, 0, hour},
+		{0, 1, 66 * time.Minute},
+		{0, -1, 54 * time.Minute},
+		{1, 0, 5 * time.Minute},
+		{3, 0, 20 * time.Minute},
+		{30, 1, contentRefreshMaxDelay},
+	}
+	for _, c := range cases {
+		if got := contentRefreshDelay(hour, c.failures, c.jitter); got != c.want {
+			t.Errorf("contentRefreshDelay(1h, %d, %v) = %v, want %v", c.failures, c.jitter, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Correlation IDs.
+//
+// Every resource request and terminal stream gets a correlation ID so one
+// learner's failed attempt can be traced across plugin, relay and Coda logs:
+//
+//   - it is a contextual log attribute, so every line logged through
+//     ctxLogger carries correlationId;
+//   - resource responses return it in X-Correlation-Id and error bodies
+//     include it as correlationId; stream error and connected frames carry it
+//     too;
+//   - requests to Coda and the relay send it in X-Correlation-Id.
+//
+// A resource request may bring its own ID in X-Correlation-Id (for example
+// from a frontend retry loop); otherwise one is generated.
+
+const correlationIDHeader = "X-Correlation-Id"
+
+var correlationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+type correlationIDKey struct{}
+
+func newCorrelationID() string {
+	return rand.Text()
+}
+
+// withCorrelationID returns ctx carrying id, with id added to the contextual
+// log attributes.
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, correlationIDKey{}, id)
+	return log.WithContextualAttributes(ctx, []any{"correlationId", id})
+}
+
+// correlationIDFromContext returns the correlation ID of ctx, or "".
+func correlationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// setCorrelationHeader forwards the correlation ID of ctx on an outgoing
+// request.
+func setCorrelationHeader(ctx context.Context, header http.Header) {
+	if id := correlationIDFromContext(ctx); id != "" {
+		header.Set(correlationIDHeader, id)
+	}
+}
+
+// correlationTransport forwards the correlation ID of each request's context.
+type correlationTransport struct {
+	base http.RoundTripper
+}
+
+func (t correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := correlationIDFromContext(req.Context()); id != "" && req.Header.Get(correlationIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(correlationIDHeader, id)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// statusRecorder captures the status a handler writes.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// withCorrelation assigns the request its correlation ID and logs its
+// outcome: server errors as warnings, client errors as info, the rest at
+// debug level.
+func (a *App) withCorrelation(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlationIDHeader)
+		if !correlationIDPattern.MatchString(id) {
+			id = newCorrelationID()
+		}
+		w.Header().Set(correlationIDHeader, id)
+		r = r.WithContext(withCorrelationID(r.Context(), id))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		logger := a.ctxLogger(r.Context())
+		args := []any{"method", r.Method, "path", r.URL.Path, "status", rec.status, "durationMs", time.Since(start).Milliseconds()}
+		switch {
+		case rec.status >= 500:
+			logger.Warn("Resource request failed", args...)
+		case rec.status >= 400:
+			logger.Info("Resource request rejected", args...)
+		default:
+			logger.Debug("Resource request", args...)
+		}
+	}
+}
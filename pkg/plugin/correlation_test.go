@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithCorrelation(t *testing.T) {
+	app := newTestApp(t)
+	var seen string
+	h := app.withCorrelation(func(w http.ResponseWriter, r *http.Request) {
+		seen = correlationIDFromContext(r.Context())
+		app.writeError(w, "nope", http.StatusBadRequest)
+	})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/vms", nil))
+	id := w.Header().Get(correlationIDHeader)
+	if !correlationIDPattern.MatchString(id) || seen != id {
+		t.Fatalf("header = %q, context = %q", id, seen)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["correlationId"] != id {
+		t.Errorf("error body = %v", body)
+	}
+
+	for incoming, kept := range map[string]bool{"retry-1234abcd": true, "short": false, "bad id with spaces": false} {
+		req := httptest.NewRequest(http.MethodGet, "/vms", nil)
+		req.Header.Set(correlationIDHeader, incoming)
+		w = httptest.NewRecorder()
+		h(w, req)
+		if got := w.Header().Get(correlationIDHeader) == incoming; got != kept {
+			t.Errorf("%q kept = %v, want %v", incoming, got, kept)
+		}
+	}
+}
+
+func TestCorrelationTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(correlationIDHeader)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: correlationTransport{}}
+	req, _ := http.NewRequestWithContext(withCorrelationID(context.Background(), "abcdefgh"), http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "abcdefgh" {
+		t.Errorf("forwarded %q", got)
+	}
+}
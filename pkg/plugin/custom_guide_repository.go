@@ -85,7 +85,10 @@ type customGuideRepositoryResponse struct {
 // there is no cross-request cache (see the deviation note above).
 var customGuideListerOverride customGuideLister
 
-// handleCustomGuideRepository serves GET /custom-guide-repository.
+// handleCustomGuideRepository serves GET /custom-guide-repository. Guides
+// that need a newer Grafana than the caller's are flagged incompatible, or
+// left out with ?compatibleOnly=true. Guides restricted to teams or folders
+// the caller isn't in are left out (guide_access.go).
 func (a *App) handleCustomGuideRepository(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -142,6 +145,21 @@ func (a *App) handleCustomGuideRepository(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	gate, only := versionGateFromContext(r.Context()), compatibleOnly(r)
+	access, approved := a.newGuideAccessChecker(r.Context()), a.approvedGuides()
+	gated := make([]customGuideRepositoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !access.canView(entry.ID) || (approved != nil && entry.Status == "published" && !approved[entry.ID]) {
+			continue
+		}
+		entry.Incompatible = gate.incompatible(entry.minVersion())
+		if entry.Incompatible && only {
+			continue
+		}
+		gated = append(gated, entry)
+	}
+	entries = gated
+
 	logger.Debug("custom guide catalogue served", "namespace", namespace, "pages", pages, "guides", len(entries))
 	a.writeJSON(w, customGuideRepositoryResponse{
 		Capability: customGuideCapability{Available: true},
@@ -42,7 +42,10 @@ type customGuideManifest struct {
 		Name string `json:"name,omitempty"`
 		Team string `json:"team,omitempty"`
 	} `json:"author,omitempty"`
-	Depends []json.RawMessage `json:"depends,omitempty"`
+	Depends         []json.RawMessage `json:"depends,omitempty"`
+	TestEnvironment *struct {
+		MinVersion string `json:"minVersion,omitempty"`
+	} `json:"testEnvironment,omitempty"`
 }
 
 // customGuideRepositoryEntry is the slim, block-stripped view of an
@@ -50,11 +53,22 @@ type customGuideManifest struct {
 // PackageEntry in package_recommendations.go). This is the shaped/collated
 // unit the cache stores; the heavy spec.blocks never survives shaping, so
 // steady-state memory is bounded by guide count, not guide size.
+// Incompatible is set per request when the manifest's
+// testEnvironment.minVersion is newer than the calling Grafana.
 type customGuideRepositoryEntry struct {
-	ID       string               `json:"id"`
-	Title    string               `json:"title,omitempty"`
-	Status   string               `json:"status,omitempty"`
-	Manifest *customGuideManifest `json:"manifest,omitempty"`
+	ID           string               `json:"id"`
+	Title        string               `json:"title,omitempty"`
+	Status       string               `json:"status,omitempty"`
+	Manifest     *customGuideManifest `json:"manifest,omitempty"`
+	Incompatible bool                 `json:"incompatible,omitempty"`
+}
+
+// minVersion returns the entry's testEnvironment.minVersion, if any.
+func (e customGuideRepositoryEntry) minVersion() string {
+	if e.Manifest == nil || e.Manifest.TestEnvironment == nil {
+		return ""
+	}
+	return e.Manifest.TestEnvironment.MinVersion
 }
 
 // customGuidePage is one page of a namespace LIST: the shaped entries plus the
@@ -127,6 +127,31 @@ func TestCustomGuide_ServesShapedCatalogue(t *testing.T) {
 	}
 }
 
+func TestCustomGuide_GatesOnGrafanaVersion(t *testing.T) {
+	old := guideEntry("fe-old", "Works anywhere", "published", "guide")
+	future := guideEntry("fe-future", "Needs Grafana 13", "published", "guide")
+	future.Manifest.TestEnvironment = &struct {
+		MinVersion string `json:"minVersion,omitempty"`
+	}{MinVersion: "13.0.0"}
+	withGuideLister(t, singlePageGuideLister(old, future))
+
+	_, body := doCustomGuideReq(t, withGrafanaVersion(t, customGuideRequest(t, "/custom-guide-repository", "user:1"), "12.3.0"))
+	if len(body.Guides) != 2 || body.Guides[0].Incompatible || !body.Guides[1].Incompatible {
+		t.Errorf("flagged guides = %+v", body.Guides)
+	}
+
+	_, body = doCustomGuideReq(t, withGrafanaVersion(t, customGuideRequest(t, "/custom-guide-repository?compatibleOnly=true", "user:1"), "12.3.0"))
+	if len(body.Guides) != 1 || body.Guides[0].ID != "fe-old" {
+		t.Errorf("filtered guides = %+v", body.Guides)
+	}
+
+	// An instance that doesn't report its version sees every guide.
+	_, body = doCustomGuide(t, "/custom-guide-repository?compatibleOnly=true", "user:1")
+	if len(body.Guides) != 2 || body.Guides[1].Incompatible {
+		t.Errorf("unversioned guides = %+v", body.Guides)
+	}
+}
+
 // A structurally valid token with no `sub` claim is still authorized: the
 // catalogue is namespace-global and must not depend on subject extraction.
 func TestCustomGuide_SubjectlessTokenStillServes(t *testing.T) {
@@ -0,0 +1,302 @@
+package plugin
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Synthetic demo data for visualization guides.
+//
+// POST /demo-data generates a window of realistic metrics and logs from a
+// named profile and writes them where the guide's queries will find them:
+// into the Prometheus and Loki running on the caller's sandbox VM (target
+// "sandbox", reached through the terminal session's SSH connection), or
+// into the stack configured by promRemoteWriteUrl and lokiUrl (target
+// "stack"). Profiles are deterministic per user, so a guide's screenshots
+// and the learner's panels tell the same story.
+
+const (
+	demoDataJobLabel       = "pathfinder-demo"
+	demoDataStep           = 15 * time.Second
+	defaultDemoDataMinutes = 30
+
+	demoDataTargetSandbox = "sandbox"
+	demoDataTargetStack   = "stack"
+
+	// Sandbox images run Prometheus with the remote-write receiver enabled
+	// and Loki on their default ports.
+	sandboxPrometheusWriteURL = "http://127.0.0.1:9090/api/v1/write"
+	sandboxLokiPushURL        = "http://127.0.0.1:3100/loki/api/v1/push"
+)
+
+// demoDataProfile is a named scenario the generator can produce.
+type demoDataProfile struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	generate    func(g *demoGenerator)
+}
+
+var demoDataProfiles = map[string]demoDataProfile{
+	"web-service-incident": {
+		Name:        "web-service-incident",
+		Title:       "Web service with an incident",
+		Description: "A checkout service whose error rate and latency spike from 10 to 5 minutes ago, with matching access and error logs.",
+		generate:    generateWebServiceIncident,
+	},
+	"host-metrics": {
+		Name:        "host-metrics",
+		Title:       "Steady host",
+		Description: "CPU, memory and disk usage of a healthy host with a daily-looking load curve and periodic job logs.",
+		generate:    generateHostMetrics,
+	},
+}
+
+type demoDataRequest struct {
+	Profile string `json:"profile" validate:"required,pattern=name"`
+	Target  string `json:"target,omitempty" validate:"oneof=sandbox stack"`
+	Guide   string `json:"guide,omitempty" validate:"max=200"`
+	Minutes int    `json:"minutes,omitempty" validate:"min=5,max=120"`
+}
+
+type demoDataResponse struct {
+	Profile  string    `json:"profile"`
+	Target   string    `json:"target"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Samples  int       `json:"samples"`
+	LogLines int       `json:"logLines"`
+}
+
+// demoGenerator accumulates the samples and log lines of one profile run.
+type demoGenerator struct {
+	rng      *rand.Rand
+	from, to time.Time
+	labels   []promLabel
+	series   []promSeries
+	streams  []lokiPushStream
+	index    map[string]int
+	logLines int
+}
+
+func newDemoGenerator(profile, user, guide string, from, to time.Time) *demoGenerator {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(profile + "/" + user))
+	labels := []promLabel{{"job", demoDataJobLabel}, {"profile", profile}, {"user", user}}
+	if guide != "" {
+		labels = append(labels, promLabel{"guide", guide})
+	}
+	return &demoGenerator{
+		rng:    rand.New(rand.NewSource(int64(h.Sum64()))),
+		from:   from,
+		to:     to,
+		labels: labels,
+		index:  map[string]int{},
+	}
+}
+
+// steps calls fn for every sample time in the window, oldest first.
+func (g *demoGenerator) steps(fn func(at time.Time)) {
+	for at := g.from; !at.After(g.to); at = at.Add(demoDataStep) {
+		fn(at)
+	}
+}
+
+// jitter returns v varied by up to ±frac.
+func (g *demoGenerator) jitter(v, frac float64) float64 {
+	return v * (1 + frac*(2*g.rng.Float64()-1))
+}
+
+func (g *demoGenerator) sample(name string, at time.Time, value float64, extra ...promLabel) {
+	labels := make([]promLabel, 0, len(g.labels)+len(extra)+1)
+	labels = append(labels, promLabel{"__name__", name})
+	labels = append(labels, g.labels...)
+	labels = append(labels, extra...)
+	g.series = append(g.series, promSeries{Labels: labels, Value: value, TimeMs: at.UnixMilli()})
+}
+
+func (g *demoGenerator) log(at time.Time, service, level, line string) {
+	key := service + "/" + level
+	i, ok := g.index[key]
+	if !ok {
+		stream := map[string]string{"service_name": service, "level": level}
+		for _, l := range g.labels {
+			stream[l.Name] = l.Value
+		}
+		i = len(g.streams)
+		g.index[key] = i
+		g.streams = append(g.streams, lokiPushStream{Stream: stream})
+	}
+	g.streams[i].Values = append(g.streams[i].Values, [2]string{strconv.FormatInt(at.UnixNano(), 10), line})
+	g.logLines++
+}
+
+func (g *demoGenerator) traceID() string {
+	return fmt.Sprintf("%016x%016x", g.rng.Uint64(), g.rng.Uint64())
+}
+
+// generateWebServiceIncident produces request counters and p95 latency for
+// three checkout routes. Between 10 and 5 minutes before the end of the
+// window, /api/checkout fails a quarter of its requests and slows down.
+func generateWebServiceIncident(g *demoGenerator) {
+	const service = "checkout"
+	routes := []struct {
+		path    string
+		method  string
+		rps     float64
+		latency float64
+	}{
+		{"/api/products", "GET", 40, 0.08},
+		{"/api/cart", "POST", 12, 0.12},
+		{"/api/checkout", "POST", 5, 0.18},
+	}
+	incidentStart, incidentEnd := g.to.Add(-10*time.Minute), g.to.Add(-5*time.Minute)
+	ok := make([]float64, len(routes))
+	failed := make([]float64, len(routes))
+
+	g.steps(func(at time.Time) {
+		incident := !at.Before(incidentStart) && at.Before(incidentEnd)
+		for i, route := range routes {
+			errRatio, latency := 0.002, g.jitter(route.latency, 0.15)
+			if incident && route.path == "/api/checkout" {
+				errRatio, latency = g.jitter(0.25, 0.2), g.jitter(2.5, 0.2)
+			} else if incident {
+				latency *= 1.6
+			}
+			requests := g.jitter(route.rps, 0.1) * demoDataStep.Seconds()
+			failed[i] += math.Round(requests * errRatio)
+			ok[i] += math.Round(requests * (1 - errRatio))
+
+			rl := []promLabel{{"service", service}, {"method", route.method}, {"route", route.path}}
+			g.sample("demo_http_requests_total", at, ok[i], append(rl, promLabel{"status", "200"})...)
+			g.sample("demo_http_requests_total", at, failed[i], append(rl, promLabel{"status", "500"})...)
+			g.sample("demo_http_request_duration_seconds", at, latency, append(rl, promLabel{"quantile", "0.95"})...)
+
+			g.log(at, service, "info", fmt.Sprintf("level=info method=%s route=%s status=200 duration_ms=%d trace_id=%s",
+				route.method, route.path, int(latency*600), g.traceID()))
+			if incident && route.path == "/api/checkout" {
+				g.log(at, service, "error", fmt.Sprintf(`level=error method=POST route=/api/checkout status=500 duration_ms=%d upstream=payments msg="payment gateway timeout" trace_id=%s`,
+					int(latency*1000), g.traceID()))
+			}
+		}
+	})
+}
+
+// generateHostMetrics produces usage gauges for one host following a
+// smooth load curve, and a cron job log line every five minutes.
+func generateHostMetrics(g *demoGenerator) {
+	const service, host = "node", "demo-host-01"
+	const memTotal = 16 * 1024 * 1024 * 1024
+	diskUsed := 0.42 + 0.1*g.rng.Float64()
+
+	g.steps(func(at time.Time) {
+		load := 0.5 + 0.3*math.Sin(2*math.Pi*float64(at.Unix()%3600)/3600)
+		hl := promLabel{"instance", host}
+		g.sample("demo_cpu_usage_ratio", at, math.Min(1, g.jitter(load*0.7, 0.1)), hl)
+		g.sample("demo_memory_used_bytes", at, math.Round(memTotal*g.jitter(0.35+load*0.3, 0.03)), hl)
+		g.sample("demo_memory_total_bytes", at, memTotal, hl)
+		diskUsed += 0.0004 * g.rng.Float64()
+		g.sample("demo_disk_used_ratio", at, diskUsed, hl, promLabel{"mountpoint", "/"})
+
+		if at.Unix()%300 < int64(demoDataStep.Seconds()) {
+			g.log(at, service, "info", fmt.Sprintf(`level=info host=%s job=backup msg="backup finished" duration_s=%d`, host, 20+g.rng.Intn(40)))
+		}
+	})
+}
+
+// handleDemoData handles GET (list profiles) and POST (generate) on
+// /demo-data.
+func (a *App) handleDemoData(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		profiles := make([]demoDataProfile, 0, len(demoDataProfiles))
+		for _, p := range demoDataProfiles {
+			profiles = append(profiles, p)
+		}
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+		a.writeJSON(w, map[string]interface{}{"profiles": profiles}, http.StatusOK)
+	case http.MethodPost:
+		a.generateDemoData(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) generateDemoData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	var req demoDataRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	profile, ok := demoDataProfiles[req.Profile]
+	if !ok {
+		a.writeError(w, "Unknown demo data profile: "+req.Profile, http.StatusNotFound)
+		return
+	}
+	if req.Target == "" {
+		req.Target = demoDataTargetSandbox
+	}
+	if req.Minutes == 0 {
+		req.Minutes = defaultDemoDataMinutes
+	}
+
+	var metrics *remoteWriter
+	var logs lokiTarget
+	switch req.Target {
+	case demoDataTargetStack:
+		if !userCanEditFromContext(ctx) {
+			a.writeError(w, "Only editors and admins can write demo data to the stack", http.StatusForbidden)
+			return
+		}
+		if a.settings == nil || a.settings.PromRemoteWriteURL == "" || a.settings.LokiURL == "" {
+			a.writeError(w, "The stack target needs promRemoteWriteUrl and lokiUrl in the plugin settings", http.StatusConflict)
+			return
+		}
+		metrics, logs = newRemoteWriter(a.settings), newLokiTarget(a.settings)
+	default:
+		client, _ := a.findSSHClientForUser(user)
+		if client == nil {
+			a.writeError(w, "No active terminal session for user", http.StatusConflict)
+			return
+		}
+		tunnel := &http.Client{Timeout: remoteWriteTimeout, Transport: sshTunnelTransport(client)}
+		metrics = &remoteWriter{url: sandboxPrometheusWriteURL, client: tunnel}
+		logs = lokiTarget{pushURL: sandboxLokiPushURL, client: tunnel}
+	}
+
+	to := timeNow().UTC().Truncate(demoDataStep)
+	g := newDemoGenerator(profile.Name, user, req.Guide, to.Add(-time.Duration(req.Minutes)*time.Minute), to)
+	profile.generate(g)
+
+	logger := a.ctxLogger(ctx)
+	if err := metrics.push(ctx, g.series); err != nil {
+		logger.Warn("Failed to write demo metrics", "profile", profile.Name, "target", req.Target, "error", err)
+		a.writeError(w, "Failed to write demo metrics: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := logs.send(ctx, lokiPushRequest{Streams: g.streams}); err != nil {
+		logger.Warn("Failed to write demo logs", "profile", profile.Name, "target", req.Target, "error", err)
+		a.writeError(w, "Failed to write demo logs: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	logger.Info("Generated demo data", "user", user, "profile", profile.Name, "target", req.Target, "samples", len(g.series), "logLines", g.logLines)
+	a.writeJSON(w, demoDataResponse{
+		Profile:  profile.Name,
+		Target:   req.Target,
+		From:     g.from,
+		To:       g.to,
+		Samples:  len(g.series),
+		LogLines: g.logLines,
+	}, http.StatusOK)
+}
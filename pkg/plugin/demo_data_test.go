@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+func TestDemoData_Stack(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC))
+	var series []promSeries
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		raw, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+		}
+		series = decodeWriteRequest(t, raw)
+	}))
+	defer prom.Close()
+	var push lokiPushRequest
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer loki.Close()
+
+	app := newTestApp(t)
+	app.settings = &Settings{PromRemoteWriteURL: prom.URL, LokiURL: loki.URL}
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	body := `{"profile": "web-service-incident", "target": "stack", "guide": "visualizations-101"}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/demo-data", body, "ana", "Editor"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp demoDataResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.To.Sub(resp.From) != 30*time.Minute || resp.Samples != len(series) || resp.Samples == 0 {
+		t.Errorf("window %s-%s, %d samples, %d received", resp.From, resp.To, resp.Samples, len(series))
+	}
+
+	// Checkout errors only occur inside the incident window.
+	incidentStart, incidentEnd := resp.To.Add(-10*time.Minute).UnixMilli(), resp.To.Add(-5*time.Minute).UnixMilli()
+	var before, during float64
+	for _, s := range series {
+		labels := map[string]string{}
+		for _, l := range s.Labels {
+			labels[l.Name] = l.Value
+		}
+		if labels["__name__"] != "demo_http_requests_total" || labels["route"] != "/api/checkout" || labels["status"] != "500" {
+			continue
+		}
+		if labels["guide"] != "visualizations-101" || labels["user"] != "ana" {
+			t.Fatalf("labels = %v", labels)
+		}
+		switch {
+		case s.TimeMs < incidentStart:
+			before = s.Value
+		case s.TimeMs < incidentEnd:
+			during = s.Value
+		}
+	}
+	if before > 5 || during-before < 50 {
+		t.Errorf("checkout errors: %v before the incident, %v by its end", before, during)
+	}
+	var errorLines int
+	for _, s := range push.Streams {
+		if s.Stream["level"] == "error" {
+			errorLines += len(s.Values)
+		}
+	}
+	if errorLines != 20 {
+		t.Errorf("error log lines = %d, want one per step of the incident", errorLines)
+	}
+}
+
+func TestDemoData_Errors(t *testing.T) {
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	for _, tc := range []struct {
+		body, role string
+		want       int
+	}{
+		{`{"profile": "host-metrics"}`, "Viewer", http.StatusConflict},
+		{`{"profile": "host-metrics", "target": "stack"}`, "Viewer", http.StatusForbidden},
+		{`{"profile": "host-metrics", "target": "stack"}`, "Admin", http.StatusConflict},
+		{`{"profile": "black-friday"}`, "Viewer", http.StatusNotFound},
+		{`{"profile": "host-metrics", "minutes": 600}`, "Viewer", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/demo-data", tc.body, "ana", tc.role))
+		if w.Code != tc.want {
+			t.Errorf("%s as %s: status=%d, want %d", tc.body, tc.role, w.Code, tc.want)
+		}
+	}
+}
+
+func TestDemoGenerator_Deterministic(t *testing.T) {
+	to := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	run := func(user string) *demoGenerator {
+		g := newDemoGenerator("host-metrics", user, "", to.Add(-time.Hour), to)
+		generateHostMetrics(g)
+		return g
+	}
+	a, b, c := run("ana"), run("ana"), run("bo")
+	if len(a.series) != 241*4 {
+		t.Fatalf("got %d samples", len(a.series))
+	}
+	if a.series[8].Value != b.series[8].Value {
+		t.Error("same user got different data")
+	}
+	if a.series[8].Value == c.series[8].Value {
+		t.Error("different users got the same data")
+	}
+	if a.logLines != 13 {
+		t.Errorf("log lines = %d, want one every five minutes, both ends included", a.logLines)
+	}
+}
@@ -0,0 +1,311 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Scheduled digest.
+//
+// With digestWebhookUrl and digestIntervalHours set, a job checks every
+// digestCheckInterval whether a digest is due and posts a summary of the
+// org's learning activity and sandbox usage since the last one to the
+// webhook. The body is {"text": ...}, which Slack and Teams incoming
+// webhooks both accept; digestFormat "teams" sends a MessageCard with a
+// title instead. The first digest goes out one interval after the job
+// first runs; a digest that fails is retried on the next check and covers
+// the whole gap. Admins preview the next digest with GET /admin/digest and
+// send it now with POST.
+
+const (
+	digestCollection    = "digest"
+	digestStateKey      = "state"
+	digestCheckInterval = 15 * time.Minute
+	digestPostTimeout   = 10 * time.Second
+	digestTopGuides     = 5
+
+	digestFormatSlack = "slack"
+	digestFormatTeams = "teams"
+)
+
+var errDigestNotConfigured = errors.New("digest webhook is not configured")
+
+// digestState is the stored schedule state.
+type digestState struct {
+	LastSentAt time.Time `json:"lastSentAt"`
+}
+
+type digestGuideCount struct {
+	GuideID     string `json:"guideId"`
+	Completions int    `json:"completions"`
+}
+
+// digestSummary is what one digest reports.
+type digestSummary struct {
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	ActiveLearners int                `json:"activeLearners"`
+	Completions    int                `json:"completions"`
+	BadgesEarned   int                `json:"badgesEarned"`
+	TopGuides      []digestGuideCount `json:"topGuides"`
+	SandboxUsers   int                `json:"sandboxUsers"`
+	Sessions       int                `json:"sessions"`
+	VMs            int                `json:"vms"`
+	ConnectedHours float64            `json:"connectedHours"`
+}
+
+// digestInterval returns the configured interval, or 0 when the digest is
+// off.
+func (a *App) digestInterval() time.Duration {
+	if a.settings == nil || a.settings.DigestWebhookURL == "" || a.settings.DigestIntervalHours <= 0 {
+		return 0
+	}
+	return time.Duration(a.settings.DigestIntervalHours) * time.Hour
+}
+
+// buildDigest summarizes learning activity and sandbox usage in [from, to).
+func (a *App) buildDigest(from, to time.Time) digestSummary {
+	in := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+	s := digestSummary{From: from, To: to, TopGuides: []digestGuideCount{}}
+	byGuide := map[string]int{}
+	for _, key := range a.store.keys(learningActivityCollection) {
+		var activity learnerActivity
+		if ok, err := a.store.get(learningActivityCollection, key, &activity); err != nil || !ok {
+			continue
+		}
+		active := false
+		for id, g := range activity.Guides {
+			if in(g.LastCompletedAt) {
+				active = true
+			}
+			if in(g.FirstCompletedAt) {
+				s.Completions++
+				byGuide[id]++
+			}
+		}
+		for _, earned := range activity.Badges {
+			if in(earned) {
+				s.BadgesEarned++
+			}
+		}
+		if active {
+			s.ActiveLearners++
+		}
+	}
+	for id, n := range byGuide {
+		s.TopGuides = append(s.TopGuides, digestGuideCount{GuideID: id, Completions: n})
+	}
+	sort.Slice(s.TopGuides, func(i, j int) bool {
+		if s.TopGuides[i].Completions != s.TopGuides[j].Completions {
+			return s.TopGuides[i].Completions > s.TopGuides[j].Completions
+		}
+		return s.TopGuides[i].GuideID < s.TopGuides[j].GuideID
+	})
+	s.TopGuides = s.TopGuides[:min(len(s.TopGuides), digestTopGuides)]
+
+	users := map[string]bool{}
+	for _, row := range a.aggregateUsage(from, to) {
+		users[row.User] = true
+		s.Sessions += row.Sessions
+		s.VMs += row.VMs
+		s.ConnectedHours += row.ConnectedHours
+	}
+	s.SandboxUsers = len(users)
+	return s
+}
+
+func (s digestSummary) title() string {
+	return fmt.Sprintf("Pathfinder digest: %s to %s", s.From.Format("Jan 2"), s.To.Format("Jan 2, 2006"))
+}
+
+// text renders s as plain lines that read the same in Slack and Teams.
+func (s digestSummary) text() string {
+	lines := []string{
+		fmt.Sprintf("Learning: %d guide completions by %d learners, %d badges earned", s.Completions, s.ActiveLearners, s.BadgesEarned),
+	}
+	if len(s.TopGuides) > 0 {
+		top := make([]string, len(s.TopGuides))
+		for i, g := range s.TopGuides {
+			top[i] = fmt.Sprintf("%s (%d)", g.GuideID, g.Completions)
+		}
+		lines = append(lines, "Top guides: "+strings.Join(top, ", "))
+	}
+	lines = append(lines, fmt.Sprintf("Sandboxes: %d sessions on %d VMs by %d users, %.1f connected hours", s.Sessions, s.VMs, s.SandboxUsers, s.ConnectedHours))
+	return strings.Join(lines, "\n")
+}
+
+// digestPayload returns the webhook body for s in format.
+func digestPayload(format string, s digestSummary) interface{} {
+	if format == digestFormatTeams {
+		return map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  s.title(),
+			"title":    s.title(),
+			// MessageCard text is markdown, where a line break needs a blank line.
+			"text": strings.ReplaceAll(s.text(), "\n", "\n\n"),
+		}
+	}
+	return map[string]string{"text": s.title() + "\n" + s.text()}
+}
+
+// postDigest sends s to the configured webhook.
+func (a *App) postDigest(ctx context.Context, s digestSummary) error {
+	if a.digestInterval() == 0 {
+		return errDigestNotConfigured
+	}
+	body, err := json.Marshal(digestPayload(a.settings.DigestFormat, s))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, digestPostTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.settings.DigestWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("digest webhook returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sendDigest posts the digest for the period since the last one, ending
+// now, and records it as sent.
+func (a *App) sendDigest(ctx context.Context) (digestSummary, error) {
+	a.digestMu.Lock()
+	defer a.digestMu.Unlock()
+	now := timeNow().UTC()
+	s := a.buildDigest(a.digestPeriodStart(now), now)
+	if err := a.postDigest(ctx, s); err != nil {
+		return s, err
+	}
+	return s, a.store.put(digestCollection, digestStateKey, digestState{LastSentAt: now})
+}
+
+// digestPeriodStart returns when the period of the next digest starts: the
+// last send, or one interval before now.
+func (a *App) digestPeriodStart(now time.Time) time.Time {
+	var state digestState
+	if _, err := a.store.get(digestCollection, digestStateKey, &state); err == nil && !state.LastSentAt.IsZero() {
+		return state.LastSentAt
+	}
+	interval := a.digestInterval()
+	if interval == 0 {
+		interval = 24 * time.Hour
+	}
+	return now.Add(-interval)
+}
+
+// runDueDigest sends the digest if an interval has passed since the last
+// one. The first call only starts the clock.
+func (a *App) runDueDigest(ctx context.Context, logger log.Logger) {
+	interval := a.digestInterval()
+	if interval == 0 {
+		return
+	}
+	now := timeNow().UTC()
+	a.digestMu.Lock()
+	var state digestState
+	_, err := a.store.get(digestCollection, digestStateKey, &state)
+	if err == nil && state.LastSentAt.IsZero() {
+		err = a.store.put(digestCollection, digestStateKey, digestState{LastSentAt: now})
+	}
+	a.digestMu.Unlock()
+	if err != nil {
+		logger.Error("Failed to read digest state", "error", err)
+		return
+	}
+	if state.LastSentAt.IsZero() || now.Sub(state.LastSentAt) < interval {
+		return
+	}
+	if _, err := a.sendDigest(ctx); err != nil {
+		logger.Warn("Failed to send digest, retrying at the next check", "error", err)
+		return
+	}
+	logger.Info("Sent digest", "since", state.LastSentAt)
+}
+
+// startDigestScheduler checks for a due digest now and every
+// digestCheckInterval.
+func (a *App) startDigestScheduler() {
+	a.runScheduled(0, func(ctx context.Context) time.Duration {
+		a.runDueDigest(ctx, a.logger)
+		return digestCheckInterval
+	})
+}
+
+type digestStatus struct {
+	Enabled       bool          `json:"enabled"`
+	Format        string        `json:"format"`
+	IntervalHours int           `json:"intervalHours,omitempty"`
+	LastSentAt    *time.Time    `json:"lastSentAt,omitempty"`
+	NextAt        *time.Time    `json:"nextAt,omitempty"`
+	Summary       digestSummary `json:"summary"`
+}
+
+// handleAdminDigest handles GET (preview the next digest) and POST (send it
+// now) on /admin/digest, for admins.
+func (a *App) handleAdminDigest(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage the digest", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		now := timeNow().UTC()
+		status := digestStatus{Enabled: a.digestInterval() > 0, Format: digestFormatSlack, Summary: a.buildDigest(a.digestPeriodStart(now), now)}
+		if a.settings != nil && a.settings.DigestFormat == digestFormatTeams {
+			status.Format = digestFormatTeams
+		}
+		var state digestState
+		if _, err := a.store.get(digestCollection, digestStateKey, &state); err == nil && !state.LastSentAt.IsZero() {
+			status.LastSentAt = &state.LastSentAt
+		}
+		if status.Enabled {
+			status.IntervalHours = a.settings.DigestIntervalHours
+			if status.LastSentAt != nil {
+				next := status.LastSentAt.Add(a.digestInterval())
+				status.NextAt = &next
+			}
+		}
+		a.writeJSON(w, status, http.StatusOK)
+	case http.MethodPost:
+		s, err := a.sendDigest(r.Context())
+		if errors.Is(err, errDigestNotConfigured) {
+			a.writeError(w, "The digest is off; set digestWebhookUrl and digestIntervalHours", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to send digest", "error", err)
+			a.writeError(w, "Failed to send the digest: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: user, Action: "digest.send"})
+		a.writeJSON(w, s, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
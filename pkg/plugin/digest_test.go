@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestSchedule(t *testing.T) {
+	var posts []map[string]interface{}
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("payload: %v", err)
+		}
+		posts = append(posts, payload)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	app := newTestApp(t)
+	app.settings = &Settings{DigestIntervalHours: 24, DigestWebhookURL: srv.URL}
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	advance := withFrozenTime(t, start)
+	ctx := context.Background()
+
+	app.runDueDigest(ctx, app.logger)
+	if len(posts) != 0 {
+		t.Fatalf("first run posted %d digests, want 0", len(posts))
+	}
+
+	advance(2 * time.Hour)
+	_, _ = app.updateLearnerActivity("alice", func(l *learnerActivity) { l.recordCompletion("alerting-101", "", timeNow().UTC()) })
+	_, _ = app.updateLearnerActivity("bob", func(l *learnerActivity) { l.recordCompletion("alerting-101", "", timeNow().UTC()) })
+	_ = app.store.put(usageCollection, "1-a", usageRecord{User: "alice", VMID: "vm-1", StartedAt: timeNow(), EndedAt: timeNow().Add(90 * time.Minute)})
+	app.runDueDigest(ctx, app.logger)
+	if len(posts) != 0 {
+		t.Fatalf("posted before the interval passed")
+	}
+
+	advance(23 * time.Hour)
+	status = http.StatusInternalServerError
+	app.runDueDigest(ctx, app.logger)
+	status = http.StatusOK
+	app.runDueDigest(ctx, app.logger)
+	if len(posts) != 2 {
+		t.Fatalf("posts = %d, want a failed and a retried one", len(posts))
+	}
+	text, _ := posts[1]["text"].(string)
+	for _, want := range []string{"2 guide completions by 2 learners", "alerting-101 (2)", "1 sessions on 1 VMs by 1 users, 1.5 connected hours"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text %q lacks %q", text, want)
+		}
+	}
+
+	advance(time.Hour)
+	app.runDueDigest(ctx, app.logger)
+	if len(posts) != 2 {
+		t.Errorf("posted again before the next interval")
+	}
+
+	app.settings.DigestFormat = digestFormatTeams
+	w := httptest.NewRecorder()
+	app.handleAdminDigest(w, roleRequest(http.MethodPost, "/admin/digest", "", "admin", "Admin"))
+	if w.Code != http.StatusOK || len(posts) != 3 || posts[2]["@type"] != "MessageCard" {
+		t.Fatalf("send now: status %d, posts %v", w.Code, posts)
+	}
+	var s digestSummary
+	_ = json.Unmarshal(w.Body.Bytes(), &s)
+	if s.Completions != 0 || !s.From.Equal(start.Add(25*time.Hour)) {
+		t.Errorf("send now covered %+v, want the hour since the last digest", s)
+	}
+}
+
+func TestHandleAdminDigest(t *testing.T) {
+	app := newTestApp(t)
+	withFrozenTime(t, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	serve := func(method, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.handleAdminDigest(w, roleRequest(method, "/admin/digest", "", "admin", role))
+		return w
+	}
+	if w := serve(http.MethodGet, "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("editor: status %d, want 403", w.Code)
+	}
+	if w := serve(http.MethodPost, "Admin"); w.Code != http.StatusConflict {
+		t.Errorf("unconfigured send: status %d, want 409", w.Code)
+	}
+
+	app.settings = &Settings{DigestIntervalHours: 168, DigestWebhookURL: "http://127.0.0.1:1/hook"}
+	w := serve(http.MethodGet, "Admin")
+	var status digestStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || status.Format != digestFormatSlack || status.IntervalHours != 168 || status.LastSentAt != nil || status.Summary.To.Sub(status.Summary.From) != 168*time.Hour {
+		t.Errorf("status = %+v", status)
+	}
+	if w := serve(http.MethodPost, "Admin"); w.Code != http.StatusBadGateway {
+		t.Errorf("unreachable webhook: status %d, want 502", w.Code)
+	}
+}
@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subscriptions to channels with a running session stay open while draining,
+// so a Live reconnect doesn't drop a session the drain is about to save.
+// Drain state is in memory only; a restarted plugin isn't draining.
+
+const (
+	defaultDrainGrace   = time.Minute
+	drainNotifyEvery    = 15 * time.Second
+	drainRestartMessage = "Pathfinder is restarting. Reconnect in a moment to continue on the same VM"
+)
+
+// drainState is the instance's drain, if one is in progress.
+type drainState struct {
+	Draining  bool      `json:"draining"`
+	Reason    string    `json:"reason,omitempty"`
+	StartedBy string    `json:"startedBy,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	Deadline  time.Time `json:"deadline,omitzero"`
+}
+
+// drainInfo is the JSON view of the drain.
+type drainInfo struct {
+	drainState
+	// Sessions is the number of connected terminal sessions.
+	Sessions int `json:"sessions"`
+	// Resumable is the number of sessions from before the last restart
+	// that haven't reconnected.
+	Resumable int `json:"resumable"`
+}
+
+// DrainRequest is the body of PUT /admin/drain.
+type DrainRequest struct {
+	Draining bool `json:"draining"`
+	// GraceSeconds is how long sessions have before they are closed;
+	// 60 when 0.
+	GraceSeconds int    `json:"graceSeconds" validate:"min=0,max=1800"`
+	Reason       string `json:"reason" validate:"max=500"`
+}
+
+// instanceDrain holds the drain state and stops its countdown.
+type instanceDrain struct {
+	mu     sync.Mutex
+	state  drainState
+	cancel context.CancelFunc
+}
+
+func (a *App) drainStatus() drainState {
+	a.drain.mu.Lock()
+	defer a.drain.mu.Unlock()
+	return a.drain.state
+}
+
+// drainRefuses reports whether a subscription to path is refused because the
+// instance is draining. Channels with a running session stay open so a Live
+// reconnect can resume it.
+func (a *App) drainRefuses(path string) bool {
+	if !a.drainStatus().Draining {
+		return false
+	}
+	a.streamSessionsMu.Lock()
+	defer a.streamSessionsMu.Unlock()
+	sess := a.streamSessions[path]
+	return sess == nil || sess.session == nil
+}
+
+// connectedSessions returns the sessions with an open terminal.
+func (a *App) connectedSessions() []*streamSession {
+	a.streamSessionsMu.Lock()
+	defer a.streamSessionsMu.Unlock()
+	sessions := make([]*streamSession, 0, len(a.streamSessions))
+	for _, sess := range a.streamSessions {
+		if sess != nil && sess.session != nil {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
+// startDrain starts a drain ending after grace, replacing one in progress.
+func (a *App) startDrain(actor, reason string, grace time.Duration) drainState {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := timeNow().UTC()
+	state := drainState{Draining: true, Reason: reason, StartedBy: actor, StartedAt: now, Deadline: now.Add(grace)}
+
+	a.drain.mu.Lock()
+	if a.drain.cancel != nil {
+		a.drain.cancel()
+	}
+	a.drain.state = state
+	a.drain.cancel = cancel
+	a.drain.mu.Unlock()
+
+	a.saveSessionRecords(a.connectedSessions())
+	go a.runDrain(ctx, state.Deadline)
+	return state
+}
+
+// cancelDrain stops a drain in progress; sessions keep running.
+func (a *App) cancelDrain() {
+	a.drain.mu.Lock()
+	defer a.drain.mu.Unlock()
+	if a.drain.cancel != nil {
+		a.drain.cancel()
+		a.drain.cancel = nil
+	}
+	a.drain.state = drainState{}
+}
+
+// runDrain counts down to deadline, then closes the sessions left.
+func (a *App) runDrain(ctx context.Context, deadline time.Time) {
+	for ctx.Err() == nil {
+		left := deadline.Sub(timeNow())
+		if left <= 0 {
+			break
+		}
+		a.notifyDraining(left)
+		wait := left % drainNotifyEvery
+		if wait == 0 {
+			wait = drainNotifyEvery
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	sessions := a.connectedSessions()
+	a.saveSessionRecords(sessions)
+	for _, sess := range sessions {
+		a.endStreamSession(a.logger, sess, drainRestartMessage)
+	}
+	a.logger.Info("Drain complete", "closedSessions", len(sessions))
+}
+
+// notifyDraining tells every connected terminal how long it has left.
+func (a *App) notifyDraining(left time.Duration) {
+	seconds := int((left + time.Second - 1) / time.Second)
+	msg := fmt.Sprintf("Pathfinder is restarting in %ds. Finish what you're running; reconnect afterwards to continue on the same VM", seconds)
+	for _, sess := range a.connectedSessions() {
+		sendStreamMessage(sess.sender, TerminalStreamOutput{Type: "draining", Message: msg, Countdown: seconds})
+	}
+}
+
+// drainForDispose notifies connected terminals and saves their session
+// records as the instance shuts down.
+func (a *App) drainForDispose() {
+	a.drain.mu.Lock()
+	if a.drain.cancel != nil {
+		a.drain.cancel()
+		a.drain.cancel = nil
+	}
+	a.drain.state.Draining = true
+	a.drain.mu.Unlock()
+
+	sessions := a.connectedSessions()
+	if len(sessions) == 0 {
+		return
+	}
+	a.saveSessionRecords(sessions)
+	for _, sess := range sessions {
+		sendStreamMessage(sess.sender, TerminalStreamOutput{Type: "draining", Message: drainRestartMessage})
+	}
+	a.logger.Info("Drained sessions for shutdown", "sessions", len(sessions))
+}
+
+// handleDrain handles GET/PUT /admin/drain (admin only).
+func (a *App) handleDrain(w http.ResponseWriter, r *http.Request) {
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can drain sessions", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, drainInfo{drainState: a.drainStatus(), Sessions: len(a.connectedSessions()), Resumable: a.resumableCount()}, http.StatusOK)
+	case http.MethodPut:
+		var req DrainRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		ctxLogger := a.ctxLogger(r.Context())
+		reason := strings.TrimSpace(req.Reason)
+		if !req.Draining {
+			a.cancelDrain()
+			a.recordAudit(ctxLogger, auditEntry{Actor: admin, Action: "drain.cancel", Details: reason})
+			a.writeJSON(w, drainInfo{Sessions: len(a.connectedSessions())}, http.StatusOK)
+			return
+		}
+		grace := time.Duration(req.GraceSeconds) * time.Second
+		if grace == 0 {
+			grace = defaultDrainGrace
+		}
+		state := a.startDrain(admin, reason, grace)
+		sessions := len(a.connectedSessions())
+		a.recordAudit(ctxLogger, auditEntry{Actor: admin, Action: "drain.start", Details: strings.TrimSpace(fmt.Sprintf("%d sessions, %s grace. %s", sessions, grace, reason))})
+		a.writeJSON(w, drainInfo{drainState: state, Sessions: sessions}, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
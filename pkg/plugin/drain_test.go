@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestDrain(t *testing.T) {
+	rec, sender := newStreamRecorder(t)
+	ts := &TerminalSession{VMID: "vm-1", stdin: &recordingWriter{}}
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), settings: &Settings{}, streamSessions: map[string]*streamSession{
+		"terminal/vm-1/1": {id: "sess-1", vmID: "vm-1", userLogin: "learner", channel: "terminal/vm-1/1", session: ts, sender: sender},
+	}}
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	serve := func(method, body, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(method, "/admin/drain", body, "ops", role))
+		return w
+	}
+
+	if w := serve(http.MethodPut, `{"draining":true}`, "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+	if w := serve(http.MethodPut, `{"draining":true,"graceSeconds":7200}`, "Admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("grace over the limit: status = %d", w.Code)
+	}
+
+	// A long drain can be cancelled before it closes anything.
+	if w := serve(http.MethodPut, `{"draining":true,"graceSeconds":600}`, "Admin"); w.Code != http.StatusOK {
+		t.Fatalf("start: status = %d", w.Code)
+	}
+	if !app.drainRefuses("terminal/new/2") || app.drainRefuses("terminal/vm-1/1") {
+		t.Error("draining should refuse new channels and keep running ones")
+	}
+	if w := serve(http.MethodPut, `{"draining":false}`, "Admin"); w.Code != http.StatusOK || app.drainStatus().Draining {
+		t.Fatalf("cancel: status = %d, state = %+v", w.Code, app.drainStatus())
+	}
+	resp, _ := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "terminal/new/2"})
+	if resp.Status == backend.SubscribeStreamStatusPermissionDenied {
+		t.Error("subscription refused after the drain was cancelled")
+	}
+
+	w := serve(http.MethodPut, `{"draining":true,"graceSeconds":1,"reason":"upgrade to 2.4"}`, "Admin")
+	var info drainInfo
+	_ = json.Unmarshal(w.Body.Bytes(), &info)
+	if w.Code != http.StatusOK || !info.Draining || info.Sessions != 1 || info.StartedBy != "ops" || info.Reason != "upgrade to 2.4" {
+		t.Fatalf("start: status = %d, info = %+v", w.Code, info)
+	}
+	resp, _ = app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "terminal/new/2"})
+	if resp.Status != backend.SubscribeStreamStatusPermissionDenied {
+		t.Errorf("SubscribeStream while draining = %v", resp.Status)
+	}
+
+	var saved sessionRecord
+	if ok, _ := app.store.get(sessionRecordCollection, "sess-1", &saved); !ok || saved.VMID != "vm-1" || saved.Channel != "terminal/vm-1/1" || saved.UserLogin != "learner" {
+		t.Errorf("session record = %+v", saved)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ts.Write([]byte("x")) == nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if ts.Write([]byte("x")) == nil {
+		t.Fatal("session still open after the grace period")
+	}
+	if msgs := rec.ofType("draining"); len(msgs) == 0 || msgs[len(msgs)-1].Countdown != 1 {
+		t.Errorf("draining messages = %+v", msgs)
+	}
+	if errs := rec.ofType("error"); len(errs) != 1 || errs[0].Error != drainRestartMessage {
+		t.Errorf("errors = %+v", errs)
+	}
+}
+
+func TestDrainForDispose(t *testing.T) {
+	rec, sender := newStreamRecorder(t)
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), streamSessions: map[string]*streamSession{
+		"terminal/vm-1/1": {id: "sess-1", vmID: "vm-1", userLogin: "learner", channel: "terminal/vm-1/1", session: &TerminalSession{VMID: "vm-1"}, sender: sender},
+	}}
+	app.drainForDispose()
+	if msgs := rec.ofType("draining"); len(msgs) != 1 || msgs[0].Message != drainRestartMessage {
+		t.Errorf("draining messages = %+v", msgs)
+	}
+
+	// The next process picks the VM back up and expects the stream.
+	next := &App{logger: log.DefaultLogger, store: app.store, userVMs: map[string]string{}}
+	if n := next.restoreSessionState(); n != 1 || next.userVMs["learner"] != "vm-1" {
+		t.Errorf("restored %d: %v", n, next.userVMs)
+	}
+	if rec, ok := next.takeResumable("terminal/vm-1/1", "learner"); !ok || rec.SessionID != "sess-1" || rec.Nonce != "1" {
+		t.Errorf("resumable = %+v, %v", rec, ok)
+	}
+	if keys := next.store.keys(sessionRecordCollection); len(keys) != 0 {
+		t.Errorf("records left after resuming: %v", keys)
+	}
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithETag(t *testing.T) {
+	body := `{"guides":[]}`
+	h := withETag(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/guides", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.String() != body {
+		t.Fatalf("status = %d, ETag = %q, body = %q", w.Code, etag, w.Body.String())
+	}
+
+	for header, want := range map[string]int{
+		etag:             http.StatusNotModified,
+		`"x", W/` + etag: http.StatusNotModified,
+		"*":              http.StatusNotModified,
+		`"stale"`:        http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/guides", nil)
+		req.Header.Set("If-None-Match", header)
+		w = httptest.NewRecorder()
+		h(w, req)
+		if w.Code != want {
+			t.Errorf("If-None-Match %s: status = %d, want %d", header, w.Code, want)
+		}
+		if want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: 304 carried a body", header)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("If-None-Match", "*")
+	w = httptest.NewRecorder()
+	h(w, req)
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Errorf("error response: status = %d, ETag = %q", w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,380 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Guide experiments.
+//
+// Content teams A/B test a guide by defining an experiment with PUT
+// /experiments/{id}: two to five weighted variants, each a full guide JSON
+// with different wording or step order, or no content for the guide as it
+// is. A guide has at most one running experiment. GET
+// /guides/{name}/variant assigns the caller to a variant by hashing the
+// experiment and login, so a learner always sees the same one, and records
+// the exposure; a later POST /learning-activity for the guide records the
+// conversion. GET /experiments/{id} reports exposures, completions and the
+// conversion rate per variant. Exposures aren't recorded with analytics off
+// (see features.go).
+
+const (
+	experimentCollection         = "experiments"
+	experimentExposureCollection = "experiment-exposures"
+	maxExperiments               = 200
+	maxExperimentWeight          = 100
+)
+
+// experimentVariant is one version of the guide under test. Without
+// Content it is the guide as published.
+type experimentVariant struct {
+	ID      string          `json:"id"`
+	Weight  int             `json:"weight"`
+	Title   string          `json:"title,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+type experiment struct {
+	ID          string              `json:"id"`
+	Guide       string              `json:"guide"`
+	Description string              `json:"description,omitempty"`
+	Variants    []experimentVariant `json:"variants"`
+	Running     bool                `json:"running"`
+	UpdatedBy   string              `json:"updatedBy"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// experimentExposure is a learner's assignment, keyed experiment/login.
+type experimentExposure struct {
+	Experiment  string     `json:"experiment"`
+	User        string     `json:"user"`
+	Variant     string     `json:"variant"`
+	ExposedAt   time.Time  `json:"exposedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// ExperimentRequest is the JSON body for PUT /experiments/{id}. Weights
+// default to 1.
+type ExperimentRequest struct {
+	Guide       string              `json:"guide" validate:"required,pattern=guideId"`
+	Description string              `json:"description,omitempty" validate:"max=500"`
+	Variants    []experimentVariant `json:"variants" validate:"required,min=2,max=5"`
+	Running     bool                `json:"running"`
+}
+
+type experimentVariantResult struct {
+	Variant        string  `json:"variant"`
+	Weight         int     `json:"weight"`
+	Exposures      int     `json:"exposures"`
+	Completions    int     `json:"completions"`
+	ConversionRate float64 `json:"conversionRate"`
+}
+
+type experimentResponse struct {
+	experiment
+	Results []experimentVariantResult `json:"results"`
+}
+
+// assignedVariant is the response of GET /guides/{name}/variant. Content is
+// empty for the guide as published.
+type assignedVariant struct {
+	Experiment string          `json:"experiment"`
+	Variant    string          `json:"variant"`
+	Title      string          `json:"title,omitempty"`
+	Content    json.RawMessage `json:"content,omitempty"`
+}
+
+// assign picks user's variant: the same user always gets the same one, and
+// users spread across variants by weight.
+func (e experiment) assign(user string) experimentVariant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	sum := sha256.Sum256([]byte(e.ID + "\x00" + user))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+func (a *App) experiments() []experiment {
+	list := []experiment{}
+	for _, key := range a.store.keys(experimentCollection) {
+		var e experiment
+		if ok, err := a.store.get(experimentCollection, key, &e); err == nil && ok {
+			list = append(list, e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// runningExperiment returns guide's running experiment, if any.
+func (a *App) runningExperiment(guide string) (experiment, bool) {
+	for _, e := range a.experiments() {
+		if e.Running && e.Guide == guide {
+			return e, true
+		}
+	}
+	return experiment{}, false
+}
+
+func (a *App) experimentExposures(id string) []experimentExposure {
+	exposures := []experimentExposure{}
+	for _, key := range a.store.keys(experimentExposureCollection) {
+		if !strings.HasPrefix(key, id+"/") {
+			continue
+		}
+		var x experimentExposure
+		if ok, err := a.store.get(experimentExposureCollection, key, &x); err == nil && ok {
+			exposures = append(exposures, x)
+		}
+	}
+	return exposures
+}
+
+func (a *App) experimentResults(e experiment) []experimentVariantResult {
+	results := make([]experimentVariantResult, len(e.Variants))
+	index := map[string]int{}
+	for i, v := range e.Variants {
+		results[i] = experimentVariantResult{Variant: v.ID, Weight: v.Weight}
+		index[v.ID] = i
+	}
+	for _, x := range a.experimentExposures(e.ID) {
+		i, ok := index[x.Variant]
+		if !ok {
+			continue
+		}
+		results[i].Exposures++
+		if x.CompletedAt != nil {
+			results[i].Completions++
+		}
+	}
+	for i := range results {
+		if results[i].Exposures > 0 {
+			results[i].ConversionRate = float64(results[i].Completions) / float64(results[i].Exposures)
+		}
+	}
+	return results
+}
+
+// recordExperimentConversion marks user's exposure to guide's running
+// experiment as completed.
+func (a *App) recordExperimentConversion(user, guide string) {
+	e, ok := a.runningExperiment(guide)
+	if !ok {
+		return
+	}
+	a.experimentsMu.Lock()
+	defer a.experimentsMu.Unlock()
+	key := e.ID + "/" + user
+	var x experimentExposure
+	if ok, err := a.store.get(experimentExposureCollection, key, &x); err != nil || !ok || x.CompletedAt != nil {
+		return
+	}
+	now := timeNow().UTC()
+	x.CompletedAt = &now
+	if err := a.store.put(experimentExposureCollection, key, x); err != nil {
+		a.logger.Warn("Failed to record experiment conversion", "experiment", e.ID, "user", user, "error", err)
+	}
+}
+
+// validateExperiment checks req's variants and fills in default weights.
+func validateExperiment(req *ExperimentRequest) error {
+	seen := map[string]bool{}
+	for i := range req.Variants {
+		v := &req.Variants[i]
+		if !workspaceNamePattern.MatchString(v.ID) {
+			return fmt.Errorf("variants[%d].id must be 1-40 lowercase letters, digits, or hyphens", i)
+		}
+		if seen[v.ID] {
+			return fmt.Errorf("variant %q is listed twice", v.ID)
+		}
+		seen[v.ID] = true
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		if v.Weight < 0 || v.Weight > maxExperimentWeight {
+			return fmt.Errorf("variants[%d].weight must be between 1 and %d", i, maxExperimentWeight)
+		}
+		if len(v.Content) > 0 && !strings.HasPrefix(strings.TrimSpace(string(v.Content)), "{") {
+			return fmt.Errorf("variants[%d].content must be the guide's JSON object", i)
+		}
+	}
+	return nil
+}
+
+// sameVariants reports whether a and b assign learners the same way.
+func sameVariants(a, b []experimentVariant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+	return true
+}
+
+// handleExperiments handles GET /experiments for editors.
+func (a *App) handleExperiments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if userLoginFromContext(ctx) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can manage experiments", http.StatusForbidden)
+		return
+	}
+	list := a.experiments()
+	for i := range list {
+		for j := range list[i].Variants {
+			list[i].Variants[j].Content = nil
+		}
+	}
+	a.writeJSON(w, map[string]interface{}{"experiments": list}, http.StatusOK)
+}
+
+// handleExperiment handles GET (with results), PUT and DELETE on
+// /experiments/{id} for editors.
+func (a *App) handleExperiment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can manage experiments", http.StatusForbidden)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/experiments/")
+	if !workspaceNamePattern.MatchString(id) {
+		a.writeError(w, "Experiment ID must be 1-40 lowercase letters, digits, or hyphens", http.StatusBadRequest)
+		return
+	}
+
+	a.experimentsMu.Lock()
+	defer a.experimentsMu.Unlock()
+	var existing experiment
+	exists, err := a.store.get(experimentCollection, id, &existing)
+	if err != nil {
+		a.ctxLogger(ctx).Error("Failed to load experiment", "experiment", id, "error", err)
+		a.writeError(w, "Failed to load the experiment", http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			a.writeError(w, "Experiment not found", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, experimentResponse{experiment: existing, Results: a.experimentResults(existing)}, http.StatusOK)
+	case http.MethodPut:
+		var req ExperimentRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if err := validateExperiment(&req); err != nil {
+			a.writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !exists && len(a.store.keys(experimentCollection)) >= maxExperiments {
+			a.writeError(w, fmt.Sprintf("At most %d experiments can be stored", maxExperiments), http.StatusConflict)
+			return
+		}
+		if exists && len(a.experimentExposures(id)) > 0 && (existing.Guide != req.Guide || !sameVariants(existing.Variants, req.Variants)) {
+			a.writeError(w, "Learners have seen this experiment; its guide, variants and weights can't change. Start a new experiment instead", http.StatusConflict)
+			return
+		}
+		if req.Running {
+			if other, ok := a.runningExperiment(req.Guide); ok && other.ID != id {
+				a.writeError(w, fmt.Sprintf("Experiment %q is already running on this guide", other.ID), http.StatusConflict)
+				return
+			}
+		}
+		now := timeNow().UTC()
+		e := experiment{ID: id, Guide: req.Guide, Description: req.Description, Variants: req.Variants, Running: req.Running, UpdatedBy: user, CreatedAt: now, UpdatedAt: now}
+		if exists {
+			e.CreatedAt = existing.CreatedAt
+		}
+		if err := a.store.put(experimentCollection, id, e); err != nil {
+			a.ctxLogger(ctx).Error("Failed to store experiment", "experiment", id, "error", err)
+			a.writeError(w, "Failed to store the experiment", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, experimentResponse{experiment: e, Results: a.experimentResults(e)}, http.StatusOK)
+	case http.MethodDelete:
+		if !exists {
+			a.writeError(w, "Experiment not found", http.StatusNotFound)
+			return
+		}
+		if _, err := a.deleteRecords(experimentExposureCollection, func(key string) bool { return strings.HasPrefix(key, id+"/") }); err != nil {
+			a.ctxLogger(ctx).Error("Failed to delete experiment exposures", "experiment", id, "error", err)
+			a.writeError(w, "Failed to delete the experiment", http.StatusInternalServerError)
+			return
+		}
+		if err := a.store.delete(experimentCollection, id); err != nil {
+			a.ctxLogger(ctx).Error("Failed to delete experiment", "experiment", id, "error", err)
+			a.writeError(w, "Failed to delete the experiment", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGuideVariant handles GET /guides/{name}/variant: the caller's
+// variant of the guide's running experiment, or 404 when there is none.
+func (a *App) handleGuideVariant(w http.ResponseWriter, r *http.Request, guide string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	e, ok := a.runningExperiment(guide)
+	if !ok {
+		a.writeError(w, "The guide has no running experiment", http.StatusNotFound)
+		return
+	}
+	v := e.assign(user)
+	if a.featureEnabled(featureAnalytics) {
+		a.experimentsMu.Lock()
+		key := e.ID + "/" + user
+		if ok, err := a.store.get(experimentExposureCollection, key, &experimentExposure{}); err == nil && !ok {
+			if err := a.store.put(experimentExposureCollection, key, experimentExposure{Experiment: e.ID, User: user, Variant: v.ID, ExposedAt: timeNow().UTC()}); err != nil {
+				a.ctxLogger(ctx).Warn("Failed to record experiment exposure", "experiment", e.ID, "error", err)
+			}
+		}
+		a.experimentsMu.Unlock()
+	}
+	a.writeJSON(w, assignedVariant{Experiment: e.ID, Variant: v.ID, Title: v.Title, Content: v.Content}, http.StatusOK)
+}
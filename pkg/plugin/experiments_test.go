@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExperiments(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC))
+	app := newTestApp(t)
+	manage := func(method, target, body, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleExperiment(w, roleRequest(method, target, body, "ed", role))
+		return w
+	}
+	variant := func(user string) (int, assignedVariant) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleGuideByName(w, roleRequest(http.MethodGet, "/guides/intro/variant", "", user, "Viewer"))
+		var v assignedVariant
+		_ = json.Unmarshal(w.Body.Bytes(), &v)
+		return w.Code, v
+	}
+	const def = `{"guide": "intro", "running": true, "variants": [
+		{"id": "control"},
+		{"id": "short", "title": "Intro (short)", "content": {"blocks": []}}
+	]}`
+
+	if w := manage(http.MethodPut, "/experiments/short-intro", def, "Viewer"); w.Code != http.StatusForbidden {
+		t.Errorf("viewer PUT: status %d, want 403", w.Code)
+	}
+	if w := manage(http.MethodPut, "/experiments/short-intro", `{"guide": "intro", "variants": [{"id": "a"}, {"id": "a"}]}`, "Editor"); w.Code != http.StatusBadRequest {
+		t.Errorf("duplicate variants: status %d, want 400", w.Code)
+	}
+	if code, _ := variant("ann"); code != http.StatusNotFound {
+		t.Errorf("no experiment: status %d, want 404", code)
+	}
+	if w := manage(http.MethodPut, "/experiments/short-intro", def, "Editor"); w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body)
+	}
+	if w := manage(http.MethodPut, "/experiments/other", def, "Editor"); w.Code != http.StatusConflict {
+		t.Errorf("second running experiment: status %d, want 409", w.Code)
+	}
+
+	assigned := map[string]int{}
+	for i := 0; i < 20; i++ {
+		user := fmt.Sprintf("user%d", i)
+		code, first := variant(user)
+		_, again := variant(user)
+		if code != http.StatusOK || first.Variant != again.Variant {
+			t.Fatalf("%s: status %d, variants %q then %q", user, code, first.Variant, again.Variant)
+		}
+		if (first.Variant == "short") != (len(first.Content) > 0) {
+			t.Errorf("%s: variant %+v", user, first)
+		}
+		assigned[first.Variant]++
+	}
+	if assigned["control"] == 0 || assigned["short"] == 0 {
+		t.Errorf("assignments = %v", assigned)
+	}
+
+	_, v := variant("user0")
+	w := httptest.NewRecorder()
+	app.handleLearningActivity(w, roleRequest(http.MethodPost, "/learning-activity", `{"guideId": "intro"}`, "user0", "Viewer"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("completion: status %d", w.Code)
+	}
+	var resp experimentResponse
+	if err := json.Unmarshal(manage(http.MethodGet, "/experiments/short-intro", "", "Editor").Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range resp.Results {
+		wantCompletions := 0
+		if r.Variant == v.Variant {
+			wantCompletions = 1
+		}
+		if r.Exposures != assigned[r.Variant] || r.Completions != wantCompletions {
+			t.Errorf("result %+v, want %d exposures and %d completions", r, assigned[r.Variant], wantCompletions)
+		}
+	}
+
+	if w := manage(http.MethodPut, "/experiments/short-intro", `{"guide": "intro", "running": true, "variants": [{"id": "control", "weight": 3}, {"id": "short"}]}`, "Editor"); w.Code != http.StatusConflict {
+		t.Errorf("reweight after exposure: status %d, want 409", w.Code)
+	}
+	if w := manage(http.MethodPut, "/experiments/short-intro", `{"guide": "intro", "running": false, "variants": [{"id": "control"}, {"id": "short", "content": {"blocks": []}}]}`, "Editor"); w.Code != http.StatusOK {
+		t.Errorf("stop: status %d: %s", w.Code, w.Body)
+	}
+	if code, _ := variant("user1"); code != http.StatusNotFound {
+		t.Errorf("stopped experiment: status %d, want 404", code)
+	}
+	if w := manage(http.MethodDelete, "/experiments/short-intro", "", "Editor"); w.Code != http.StatusNoContent || len(app.store.keys(experimentExposureCollection)) != 0 {
+		t.Errorf("DELETE: status %d, exposures %v", w.Code, app.store.keys(experimentExposureCollection))
+	}
+}
+
+func TestExperimentAssign_FollowsWeights(t *testing.T) {
+	e := experiment{ID: "weights", Variants: []experimentVariant{{ID: "a", Weight: 1}, {ID: "b", Weight: 3}}}
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[e.assign(fmt.Sprintf("user%d", i)).ID]++
+	}
+	if counts["a"] < 800 || counts["a"] > 1200 {
+		t.Errorf("counts = %v, want about 1000 a", counts)
+	}
+}
+
+func TestExperimentExposure_SkippedWithAnalyticsOff(t *testing.T) {
+	app := newTestApp(t)
+	off := false
+	app.settings = &Settings{Features: FeatureFlags{Analytics: &off}}
+	_ = app.store.put(experimentCollection, "e", experiment{ID: "e", Guide: "intro", Running: true, Variants: []experimentVariant{{ID: "a", Weight: 1}, {ID: "b", Weight: 1}}})
+	w := httptest.NewRecorder()
+	app.handleGuideByName(w, roleRequest(http.MethodGet, "/guides/intro/variant", "", "ann", "Viewer"))
+	if w.Code != http.StatusOK || len(app.store.keys(experimentExposureCollection)) != 0 {
+		t.Errorf("status %d, exposures %v", w.Code, app.store.keys(experimentExposureCollection))
+	}
+}
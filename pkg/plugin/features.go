@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Backend feature flags.
+//
+// Admins switch whole capabilities off with the "features" block of the
+// plugin settings, e.g. for a docs-only Pathfinder with no sandbox surface:
+//
+//	"features": {"terminal": false, "vmProvisioning": false}
+//
+// Omitted flags are enabled. Disabled capabilities are refused on their routes
+// and Grafana Live channels, and GET /features reports the effective flags so
+// the frontend can hide them.
+//
+// Analytics is also off when telemetry is opted out, either with the plugin's
+// disableTelemetry setting or with Grafana's [analytics] reporting_enabled =
+// false. Grafana doesn't pass that setting to plugins, so it is read from
+// GF_ANALYTICS_REPORTING_ENABLED, which reaches the plugin process when listed
+// in [plugins] forward_host_env_vars. With analytics off no session usage is
+// recorded and completion records aren't served as recommender context.
+
+const (
+	featureTerminal       = "terminal"
+	featureVMProvisioning = "vmProvisioning"
+	featureCustomGuides   = "customGuides"
+	featureAnalytics      = "analytics"
+)
+
+// FeatureFlags is the "features" block of the plugin settings. A nil flag
+// means enabled.
+type FeatureFlags struct {
+	Terminal       *bool `json:"terminal,omitempty"`
+	VMProvisioning *bool `json:"vmProvisioning,omitempty"`
+	CustomGuides   *bool `json:"customGuides,omitempty"`
+	Analytics      *bool `json:"analytics,omitempty"`
+}
+
+var featureLabels = map[string]string{
+	featureTerminal:       "The sandbox terminal",
+	featureVMProvisioning: "VM provisioning",
+	featureCustomGuides:   "Custom guides",
+	featureAnalytics:      "Analytics",
+}
+
+// featureEnabled reports whether the named capability is enabled.
+func (a *App) featureEnabled(name string) bool {
+	if a.settings == nil {
+		return true
+	}
+	var flag *bool
+	switch name {
+	case featureTerminal:
+		flag = a.settings.Features.Terminal
+	case featureVMProvisioning:
+		flag = a.settings.Features.VMProvisioning
+	case featureCustomGuides:
+		flag = a.settings.Features.CustomGuides
+	case featureAnalytics:
+		if a.telemetryDisabled() {
+			return false
+		}
+		flag = a.settings.Features.Analytics
+	}
+	return flag == nil || *flag
+}
+
+// telemetryDisabled reports whether the plugin or Grafana opted out of usage
+// analytics.
+func (a *App) telemetryDisabled() bool {
+	if a.settings != nil && a.settings.DisableTelemetry {
+		return true
+	}
+	raw, ok := os.LookupEnv("GF_ANALYTICS_REPORTING_ENABLED")
+	if !ok {
+		return false
+	}
+	enabled, err := strconv.ParseBool(raw)
+	return err == nil && !enabled
+}
+
+// featureError returns the user-facing error for a disabled capability, or
+// nil when it is enabled.
+func (a *App) featureError(name string) error {
+	if a.featureEnabled(name) {
+		return nil
+	}
+	return fmt.Errorf("%s is disabled for this Grafana instance", featureLabels[name])
+}
+
+// requireFeature wraps h so it answers 403 while the named capability is
+// disabled.
+func (a *App) requireFeature(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := a.featureError(name); err != nil {
+			a.writeError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// terminalStreamDenied refuses Grafana Live subscriptions and publishes while
+// the terminal is disabled. Every plugin channel carries terminal traffic.
+func (a *App) terminalStreamDenied(ctx context.Context) bool {
+	if a.featureEnabled(featureTerminal) {
+		return false
+	}
+	a.ctxLogger(ctx).Info("Refusing stream: terminal feature disabled")
+	return true
+}
+
+// handleFeatures handles GET /features.
+func (a *App) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	killed := a.killSwitchError() != nil
+	a.writeJSON(w, map[string]bool{
+		featureTerminal:       a.featureEnabled(featureTerminal) && !killed,
+		featureVMProvisioning: a.featureEnabled(featureVMProvisioning) && !killed,
+		featureCustomGuides:   a.featureEnabled(featureCustomGuides),
+		featureAnalytics:      a.featureEnabled(featureAnalytics),
+		"pluginInstall":       a.pluginInstallAllowed(),
+	}, http.StatusOK)
+}
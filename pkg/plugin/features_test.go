@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	var settings Settings
+	if err := json.Unmarshal([]byte(`{"features":{"terminal":false,"analytics":true}}`), &settings); err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApp(t)
+	app.settings = &settings
+
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/features", nil), "alice"))
+	var got map[string]bool
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	want := map[string]bool{"terminal": false, "vmProvisioning": true, "customGuides": true, "analytics": true}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("features[%s] = %v, want %v", k, got[k], v)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withUser(httptest.NewRequest(http.MethodGet, "/scripts", nil), "alice"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/scripts with terminal disabled: status = %d", w.Code)
+	}
+
+	resp, err := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "terminal/vm-1"})
+	if err != nil || resp.Status != backend.SubscribeStreamStatusPermissionDenied {
+		t.Errorf("SubscribeStream = %+v, %v", resp, err)
+	}
+
+	if err := newTestApp(t).featureError(featureTerminal); err != nil {
+		t.Errorf("features default to enabled without settings: %v", err)
+	}
+}
+
+func TestTelemetryOptOut(t *testing.T) {
+	app := newTestApp(t)
+	app.settings = &Settings{}
+	sess := &streamSession{id: "s1", userLogin: "alice", startedAt: timeNow()}
+
+	t.Setenv("GF_ANALYTICS_REPORTING_ENABLED", "true")
+	if !app.featureEnabled(featureAnalytics) {
+		t.Fatal("analytics off with reporting enabled")
+	}
+	app.recordUsage(app.logger, sess)
+
+	t.Setenv("GF_ANALYTICS_REPORTING_ENABLED", "false")
+	if app.featureEnabled(featureAnalytics) {
+		t.Error("analytics on with Grafana reporting disabled")
+	}
+	app.recordUsage(app.logger, sess)
+
+	t.Setenv("GF_ANALYTICS_REPORTING_ENABLED", "")
+	app.settings.DisableTelemetry = true
+	if app.featureEnabled(featureAnalytics) {
+		t.Error("analytics on with disableTelemetry set")
+	}
+	app.recordUsage(app.logger, sess)
+
+	if n := len(app.store.keys(usageCollection)); n != 1 {
+		t.Errorf("recorded %d usage records, want 1 (only while reporting was enabled)", n)
+	}
+
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodGet, "/usage/export", "", "root", "Admin"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/usage/export with telemetry opted out: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,442 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/config"
+)
+
+// Grafana HTTP API client.
+//
+// Guide prerequisite checks, plugin installs and guide actions go through
+// Grafana's own HTTP API, authenticated as the plugin's service account (the
+// iam block in plugin.json; Grafana hands the token to the plugin when
+// externalServiceAccounts is enabled). Without that token the checks that
+// need the API report "unknown" rather than failing.
+
+const (
+	grafanaAPITimeout  = 10 * time.Second
+	grafanaAPIMaxBytes = 4 * 1024 * 1024
+	// grafanaDashboardSearchLimit is Grafana's largest search page.
+	grafanaDashboardSearchLimit = 5000
+
+	// grafanaPluginInstallTimeout allows for Grafana downloading the plugin
+	// archive from the catalog.
+	grafanaPluginInstallTimeout = 2 * time.Minute
+)
+
+// errGrafanaAPIUnavailable means the plugin has no way to call the HTTP API
+// on this instance (no app URL or no service account token).
+var errGrafanaAPIUnavailable = errors.New("grafana API unavailable")
+
+// grafanaAPIError is a non-2xx response from the Grafana API.
+type grafanaAPIError struct {
+	status  int
+	message string
+}
+
+func (e *grafanaAPIError) Error() string {
+	return fmt.Sprintf("grafana API: status %d: %s", e.status, e.message)
+}
+
+// grafanaAPIStatus returns the HTTP status carried by err, or 0.
+func grafanaAPIStatus(err error) int {
+	var apiErr *grafanaAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.status
+	}
+	return 0
+}
+
+// grafanaPluginSettings is the part of GET /api/plugins/{id}/settings the
+// checks use.
+type grafanaPluginSettings struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	Info    struct {
+		Version string `json:"version"`
+	} `json:"info"`
+}
+
+// grafanaDatasource is one entry of GET /api/datasources.
+type grafanaDatasource struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// grafanaAPI is the subset of Grafana's HTTP API the plugin calls.
+type grafanaAPI interface {
+	// PluginSettings returns nil, nil when the plugin isn't installed.
+	PluginSettings(ctx context.Context, pluginID string) (*grafanaPluginSettings, error)
+	ListDatasources(ctx context.Context) ([]grafanaDatasource, error)
+	// InstallPlugin installs pluginID from the plugin catalog, at version if
+	// set and the latest compatible version otherwise.
+	InstallPlugin(ctx context.Context, pluginID, version string) error
+	// EnsureFolder creates the folder unless one with uid exists.
+	EnsureFolder(ctx context.Context, uid, title string) error
+	CreateContactPoint(ctx context.Context, cp grafanaContactPoint) error
+	CreateAlertRule(ctx context.Context, rule grafanaAlertRule) error
+	CreateDatasource(ctx context.Context, ds grafanaDatasourceSpec) error
+	// SaveDashboard creates or replaces the dashboard with the model's uid.
+	SaveDashboard(ctx context.Context, dashboard map[string]interface{}, folderUID string) error
+	// DeleteResource deletes a resource of a guide resource kind. Deleting
+	// one that doesn't exist succeeds.
+	DeleteResource(ctx context.Context, kind, uid string) error
+	// TeamMembers returns the logins of the team named team, or nil, nil
+	// when there is no such team.
+	TeamMembers(ctx context.Context, team string) ([]string, error)
+	// UserTeams returns the names of the teams login belongs to.
+	UserTeams(ctx context.Context, login string) ([]string, error)
+	// FolderPermissions returns the folder's permission entries, or nil, nil
+	// when there is no such folder.
+	FolderPermissions(ctx context.Context, uid string) ([]grafanaFolderPermission, error)
+	// Version returns the running Grafana version from /api/health.
+	Version(ctx context.Context) (string, error)
+	// SearchDashboards returns up to grafanaDashboardSearchLimit dashboards.
+	SearchDashboards(ctx context.Context) ([]grafanaDashboardSummary, error)
+}
+
+// grafanaDashboardSummary is a dashboard in GET /api/search results. IDs
+// grow as dashboards are created.
+type grafanaDashboardSummary struct {
+	ID    int64    `json:"id"`
+	UID   string   `json:"uid"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+// grafanaFolderPermission is one entry of GET /api/folders/{uid}/permissions:
+// a user, a team or a basic role, each granting at least view.
+type grafanaFolderPermission struct {
+	UserLogin  string `json:"userLogin,omitempty"`
+	Team       string `json:"team,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Permission int    `json:"permission"`
+}
+
+// grafanaDatasourceSpec is a data source for POST /api/datasources.
+type grafanaDatasourceSpec struct {
+	UID            string                 `json:"uid"`
+	Name           string                 `json:"name"`
+	Type           string                 `json:"type"`
+	Access         string                 `json:"access"`
+	URL            string                 `json:"url"`
+	JSONData       map[string]interface{} `json:"jsonData,omitempty"`
+	SecureJSONData map[string]string      `json:"secureJsonData,omitempty"`
+}
+
+// grafanaContactPoint is a contact point for the alerting provisioning API.
+type grafanaContactPoint struct {
+	UID      string                 `json:"uid"`
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// grafanaAlertQuery is one query or expression of an alert rule.
+type grafanaAlertQuery struct {
+	RefID             string                 `json:"refId"`
+	RelativeTimeRange *grafanaTimeRange      `json:"relativeTimeRange,omitempty"`
+	DatasourceUID     string                 `json:"datasourceUid"`
+	Model             map[string]interface{} `json:"model"`
+}
+
+// grafanaTimeRange is a range relative to now, in seconds.
+type grafanaTimeRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// grafanaAlertRule is an alert rule for the alerting provisioning API.
+type grafanaAlertRule struct {
+	UID                  string                       `json:"uid"`
+	Title                string                       `json:"title"`
+	FolderUID            string                       `json:"folderUID"`
+	RuleGroup            string                       `json:"ruleGroup"`
+	Condition            string                       `json:"condition"`
+	Data                 []grafanaAlertQuery          `json:"data"`
+	NoDataState          string                       `json:"noDataState"`
+	ExecErrState         string                       `json:"execErrState"`
+	For                  string                       `json:"for"`
+	Labels               map[string]string            `json:"labels,omitempty"`
+	Annotations          map[string]string            `json:"annotations,omitempty"`
+	NotificationSettings *grafanaNotificationSettings `json:"notification_settings,omitempty"`
+}
+
+// grafanaNotificationSettings routes a rule straight to a contact point.
+type grafanaNotificationSettings struct {
+	Receiver string `json:"receiver"`
+}
+
+// grafanaAPIOverride injects a fake client in tests. nil selects the real
+// client built from the request's Grafana config.
+var grafanaAPIOverride grafanaAPI
+
+type grafanaHTTPClient struct {
+	appURL     string
+	token      string
+	httpClient *http.Client
+}
+
+// resolveGrafanaAPI returns a client for the instance serving ctx.
+func resolveGrafanaAPI(ctx context.Context) (grafanaAPI, error) {
+	if grafanaAPIOverride != nil {
+		return grafanaAPIOverride, nil
+	}
+	appURL, token, err := grafanaServiceAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &grafanaHTTPClient{appURL: appURL, token: token, httpClient: &http.Client{}}, nil
+}
+
+// grafanaServiceAccount returns the instance's app URL, without a trailing
+// slash, and the plugin's service account token.
+func grafanaServiceAccount(ctx context.Context) (appURL, token string, err error) {
+	cfg := config.GrafanaConfigFromContext(ctx)
+	if cfg == nil {
+		return "", "", errGrafanaAPIUnavailable
+	}
+	appURL, err = cfg.AppURL()
+	if err != nil || appURL == "" {
+		return "", "", errGrafanaAPIUnavailable
+	}
+	token, err = cfg.PluginAppClientSecret()
+	if err != nil || token == "" {
+		return "", "", errGrafanaAPIUnavailable
+	}
+	return strings.TrimRight(appURL, "/"), token, nil
+}
+
+// do sends a request to path and decodes a 2xx JSON response into out.
+// Non-2xx responses are returned as *grafanaAPIError.
+func (c *grafanaHTTPClient) do(ctx context.Context, timeout time.Duration, method, path string, body, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.appURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("grafana API: build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	// Keep provisioned resources editable in the Grafana UI.
+	req.Header.Set("X-Disable-Provenance", "true")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("grafana API %s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, grafanaAPIMaxBytes))
+	if err != nil {
+		return fmt.Errorf("grafana API %s %s: read body: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &grafanaAPIError{status: resp.StatusCode, message: grafanaErrorMessage(data)}
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("grafana API %s %s: decode: %w", method, path, err)
+		}
+	}
+	return nil
+}
+
+// grafanaErrorMessage returns the message of a Grafana API error body, which
+// is usually {"message": "..."}.
+func grafanaErrorMessage(body []byte) string {
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Message != "" {
+		return payload.Message
+	}
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 200 {
+		msg = msg[:200]
+	}
+	return msg
+}
+
+func (c *grafanaHTTPClient) PluginSettings(ctx context.Context, pluginID string) (*grafanaPluginSettings, error) {
+	var settings grafanaPluginSettings
+	err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/plugins/"+url.PathEscape(pluginID)+"/settings", nil, &settings)
+	if grafanaAPIStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (c *grafanaHTTPClient) ListDatasources(ctx context.Context) ([]grafanaDatasource, error) {
+	var list []grafanaDatasource
+	if err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/datasources", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *grafanaHTTPClient) Version(ctx context.Context) (string, error) {
+	var health struct {
+		Version string `json:"version"`
+	}
+	if err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/health", nil, &health); err != nil {
+		return "", err
+	}
+	return health.Version, nil
+}
+
+func (c *grafanaHTTPClient) SearchDashboards(ctx context.Context) ([]grafanaDashboardSummary, error) {
+	var list []grafanaDashboardSummary
+	path := fmt.Sprintf("/api/search?type=dash-db&limit=%d", grafanaDashboardSearchLimit)
+	if err := c.do(ctx, grafanaAPITimeout, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *grafanaHTTPClient) InstallPlugin(ctx context.Context, pluginID, version string) error {
+	body := map[string]string{}
+	if version != "" {
+		body["version"] = version
+	}
+	return c.do(ctx, grafanaPluginInstallTimeout, http.MethodPost, "/api/plugins/"+url.PathEscape(pluginID)+"/install", body, nil)
+}
+
+func (c *grafanaHTTPClient) EnsureFolder(ctx context.Context, uid, title string) error {
+	err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/folders/"+url.PathEscape(uid), nil, nil)
+	if grafanaAPIStatus(err) != http.StatusNotFound {
+		return err
+	}
+	return c.do(ctx, grafanaAPITimeout, http.MethodPost, "/api/folders", map[string]string{"uid": uid, "title": title}, nil)
+}
+
+func (c *grafanaHTTPClient) CreateContactPoint(ctx context.Context, cp grafanaContactPoint) error {
+	return c.do(ctx, grafanaAPITimeout, http.MethodPost, "/api/v1/provisioning/contact-points", cp, nil)
+}
+
+func (c *grafanaHTTPClient) CreateAlertRule(ctx context.Context, rule grafanaAlertRule) error {
+	return c.do(ctx, grafanaAPITimeout, http.MethodPost, "/api/v1/provisioning/alert-rules", rule, nil)
+}
+
+func (c *grafanaHTTPClient) CreateDatasource(ctx context.Context, ds grafanaDatasourceSpec) error {
+	return c.do(ctx, grafanaAPITimeout, http.MethodPost, "/api/datasources", ds, nil)
+}
+
+func (c *grafanaHTTPClient) SaveDashboard(ctx context.Context, dashboard map[string]interface{}, folderUID string) error {
+	body := map[string]interface{}{"dashboard": dashboard, "folderUid": folderUID, "overwrite": true}
+	return c.do(ctx, grafanaAPITimeout, http.MethodPost, "/api/dashboards/db", body, nil)
+}
+
+// grafanaResourcePaths are the API paths resources are deleted at, by guide
+// resource kind.
+var grafanaResourcePaths = map[string]string{
+	guideResourceAlertRule:    "/api/v1/provisioning/alert-rules/",
+	guideResourceContactPoint: "/api/v1/provisioning/contact-points/",
+	guideResourceDashboard:    "/api/dashboards/uid/",
+	guideResourceDatasource:   "/api/datasources/uid/",
+	guideResourceFolder:       "/api/folders/",
+}
+
+func (c *grafanaHTTPClient) DeleteResource(ctx context.Context, kind, uid string) error {
+	prefix, ok := grafanaResourcePaths[kind]
+	if !ok {
+		return fmt.Errorf("grafana API: unknown resource kind %q", kind)
+	}
+	err := c.do(ctx, grafanaAPITimeout, http.MethodDelete, prefix+url.PathEscape(uid), nil, nil)
+	if grafanaAPIStatus(err) == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *grafanaHTTPClient) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	var search struct {
+		Teams []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"teams"`
+	}
+	if err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/teams/search?name="+url.QueryEscape(team), nil, &search); err != nil {
+		return nil, err
+	}
+	for _, t := range search.Teams {
+		if t.Name != team {
+			continue
+		}
+		var members []struct {
+			Login string `json:"login"`
+		}
+		if err := c.do(ctx, grafanaAPITimeout, http.MethodGet, fmt.Sprintf("/api/teams/%d/members", t.ID), nil, &members); err != nil {
+			return nil, err
+		}
+		logins := make([]string, 0, len(members))
+		for _, m := range members {
+			logins = append(logins, m.Login)
+		}
+		return logins, nil
+	}
+	return nil, nil
+}
+
+func (c *grafanaHTTPClient) UserTeams(ctx context.Context, login string) ([]string, error) {
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/users/lookup?loginOrEmail="+url.QueryEscape(login), nil, &user)
+	if grafanaAPIStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var teams []struct {
+		Name string `json:"name"`
+	}
+	if err := c.do(ctx, grafanaAPITimeout, http.MethodGet, fmt.Sprintf("/api/users/%d/teams", user.ID), nil, &teams); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(teams))
+	for _, t := range teams {
+		names = append(names, t.Name)
+	}
+	return names, nil
+}
+
+func (c *grafanaHTTPClient) FolderPermissions(ctx context.Context, uid string) ([]grafanaFolderPermission, error) {
+	perms := []grafanaFolderPermission{}
+	err := c.do(ctx, grafanaAPITimeout, http.MethodGet, "/api/folders/"+url.PathEscape(uid)+"/permissions", nil, &perms)
+	if grafanaAPIStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeGrafanaAPI struct {
+	plugins       map[string]*grafanaPluginSettings
+	datasources   []grafanaDatasource
+	err           error
+	installErr    error
+	calls         int
+	folders       map[string]string
+	contactPoints map[string]grafanaContactPoint
+	alertRules    map[string]grafanaAlertRule
+	dashboards    map[string]map[string]interface{}
+	created       map[string]grafanaDatasourceSpec
+	deleted       []string
+	deleteErr     map[string]error
+	teams         map[string][]string
+	userTeams     map[string][]string
+	folderPerms   map[string][]grafanaFolderPermission
+	version       string
+	searched      []grafanaDashboardSummary
+}
+
+func (f *fakeGrafanaAPI) PluginSettings(_ context.Context, id string) (*grafanaPluginSettings, error) {
+	f.calls++
+	return f.plugins[id], f.err
+}
+
+func (f *fakeGrafanaAPI) ListDatasources(context.Context) ([]grafanaDatasource, error) {
+	f.calls++
+	return f.datasources, f.err
+}
+
+func (f *fakeGrafanaAPI) SearchDashboards(context.Context) ([]grafanaDashboardSummary, error) {
+	f.calls++
+	return f.searched, f.err
+}
+
+func (f *fakeGrafanaAPI) InstallPlugin(_ context.Context, id, version string) error {
+	f.calls++
+	if f.installErr != nil {
+		return f.installErr
+	}
+	if version == "" {
+		version = "1.0.0"
+	}
+	settings := &grafanaPluginSettings{ID: id, Enabled: true}
+	settings.Info.Version = version
+	f.plugins[id] = settings
+	return nil
+}
+
+func (f *fakeGrafanaAPI) EnsureFolder(_ context.Context, uid, title string) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	if f.folders == nil {
+		f.folders = map[string]string{}
+	}
+	if _, ok := f.folders[uid]; !ok {
+		f.folders[uid] = title
+	}
+	return nil
+}
+
+func (f *fakeGrafanaAPI) CreateContactPoint(_ context.Context, cp grafanaContactPoint) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.contactPoints[cp.UID]; ok {
+		return &grafanaAPIError{status: http.StatusBadRequest, message: "contact point already exists"}
+	}
+	if f.contactPoints == nil {
+		f.contactPoints = map[string]grafanaContactPoint{}
+	}
+	f.contactPoints[cp.UID] = cp
+	return nil
+}
+
+func (f *fakeGrafanaAPI) CreateAlertRule(_ context.Context, rule grafanaAlertRule) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.alertRules[rule.UID]; ok {
+		return &grafanaAPIError{status: http.StatusConflict, message: "alert rule already exists"}
+	}
+	if f.alertRules == nil {
+		f.alertRules = map[string]grafanaAlertRule{}
+	}
+	f.alertRules[rule.UID] = rule
+	return nil
+}
+
+func (f *fakeGrafanaAPI) CreateDatasource(_ context.Context, ds grafanaDatasourceSpec) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	if f.created == nil {
+		f.created = map[string]grafanaDatasourceSpec{}
+	}
+	f.created[ds.UID] = ds
+	return nil
+}
+
+func (f *fakeGrafanaAPI) SaveDashboard(_ context.Context, dashboard map[string]interface{}, folderUID string) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	if f.dashboards == nil {
+		f.dashboards = map[string]map[string]interface{}{}
+	}
+	dashboard["folderUid"] = folderUID
+	f.dashboards[dashboard["uid"].(string)] = dashboard
+	return nil
+}
+
+func (f *fakeGrafanaAPI) DeleteResource(_ context.Context, kind, uid string) error {
+	f.calls++
+	if err := f.deleteErr[kind+"/"+uid]; err != nil {
+		return err
+	}
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, kind+"/"+uid)
+	return nil
+}
+
+func (f *fakeGrafanaAPI) TeamMembers(_ context.Context, team string) ([]string, error) {
+	f.calls++
+	return f.teams[team], f.err
+}
+
+func (f *fakeGrafanaAPI) UserTeams(_ context.Context, login string) ([]string, error) {
+	f.calls++
+	return f.userTeams[login], f.err
+}
+
+func (f *fakeGrafanaAPI) FolderPermissions(_ context.Context, uid string) ([]grafanaFolderPermission, error) {
+	f.calls++
+	return f.folderPerms[uid], f.err
+}
+
+func (f *fakeGrafanaAPI) Version(context.Context) (string, error) {
+	f.calls++
+	return f.version, f.err
+}
+
+func useFakeGrafanaAPI(t *testing.T, f *fakeGrafanaAPI) {
+	t.Helper()
+	grafanaAPIOverride = f
+	t.Cleanup(func() { grafanaAPIOverride = nil })
+}
+
+func TestGrafanaHTTPClient(t *testing.T) {
+	var gotAuth, gotProvenance string
+	created := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotProvenance = r.Header.Get("X-Disable-Provenance")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/folders/pathfinder-demos":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/folders":
+			created["folder"] = true
+			_, _ = w.Write([]byte(`{"uid":"pathfinder-demos"}`))
+		case r.URL.Path == "/api/plugins/missing-panel/settings":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/api/teams/search":
+			_, _ = w.Write([]byte(`{"teams":[{"id":7,"name":"sre-oncall"},{"id":8,"name":"sre"}]}`))
+		case r.URL.Path == "/api/teams/8/members":
+			_, _ = w.Write([]byte(`[{"login":"alice"},{"login":"bob"}]`))
+		case r.URL.Path == "/api/users/lookup" && r.URL.Query().Get("loginOrEmail") == "alice":
+			_, _ = w.Write([]byte(`{"id":3}`))
+		case r.URL.Path == "/api/users/3/teams":
+			_, _ = w.Write([]byte(`[{"id":8,"name":"sre"}]`))
+		case r.URL.Path == "/api/users/lookup", r.URL.Path == "/api/folders/missing/permissions":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/api/folders/runbooks/permissions":
+			_, _ = w.Write([]byte(`[{"role":"Editor","permission":1},{"team":"sre","permission":2}]`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"permissions needed: alert.provisioning:write"}`))
+		}
+	}))
+	defer srv.Close()
+	c := &grafanaHTTPClient{appURL: srv.URL, token: "sa-token", httpClient: srv.Client()}
+	ctx := context.Background()
+
+	if err := c.EnsureFolder(ctx, "pathfinder-demos", "Pathfinder demos"); err != nil || !created["folder"] {
+		t.Fatalf("EnsureFolder: err=%v created=%v", err, created["folder"])
+	}
+	if gotAuth != "Bearer sa-token" || gotProvenance != "true" {
+		t.Errorf("headers: auth=%q provenance=%q", gotAuth, gotProvenance)
+	}
+	if settings, err := c.PluginSettings(ctx, "missing-panel"); settings != nil || err != nil {
+		t.Errorf("missing plugin: settings=%v err=%v", settings, err)
+	}
+	if members, err := c.TeamMembers(ctx, "sre"); err != nil || len(members) != 2 || members[0] != "alice" {
+		t.Errorf("TeamMembers: members=%v err=%v", members, err)
+	}
+	if members, err := c.TeamMembers(ctx, "platform"); members != nil || err != nil {
+		t.Errorf("missing team: members=%v err=%v", members, err)
+	}
+	if teams, err := c.UserTeams(ctx, "alice"); err != nil || len(teams) != 1 || teams[0] != "sre" {
+		t.Errorf("UserTeams: teams=%v err=%v", teams, err)
+	}
+	if teams, err := c.UserTeams(ctx, "nobody"); teams != nil || err != nil {
+		t.Errorf("missing user: teams=%v err=%v", teams, err)
+	}
+	if perms, err := c.FolderPermissions(ctx, "runbooks"); err != nil || len(perms) != 2 || perms[1].Team != "sre" {
+		t.Errorf("FolderPermissions: perms=%v err=%v", perms, err)
+	}
+	if perms, err := c.FolderPermissions(ctx, "missing"); perms != nil || err != nil {
+		t.Errorf("missing folder: perms=%v err=%v", perms, err)
+	}
+	err := c.CreateAlertRule(ctx, grafanaAlertRule{UID: "pf-1"})
+	if grafanaAPIStatus(err) != http.StatusForbidden {
+		t.Fatalf("CreateAlertRule: err=%v", err)
+	}
+	if want := "grafana API: status 403: permissions needed: alert.provisioning:write"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
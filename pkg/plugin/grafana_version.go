@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// grafanaVersionFromContext returns the version of the Grafana instance
+// making the request, from its user agent. ok is false when Grafana didn't
+// say.
+func grafanaVersionFromContext(ctx context.Context) (version string, ok bool) {
+	version = backend.UserAgentFromContext(ctx).GrafanaVersion()
+	if _, valid := parseVersion(version); !valid || version == "0.0.0" {
+		return "", false
+	}
+	return version, true
+}
+
+// parseVersion reads major.minor.patch from a version such as "12.3.0" or
+// "12.3.0-pre". Missing minor and patch numbers are zero, and any
+// pre-release or build suffix is ignored, as in the frontend's min-version
+// check.
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if v == "" || len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, the same as, or
+// newer than b.
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionGate checks guides' minimum Grafana versions against the instance
+// making a request.
+type versionGate struct {
+	current [3]int
+	known   bool
+}
+
+func versionGateFromContext(ctx context.Context) versionGate {
+	version, ok := grafanaVersionFromContext(ctx)
+	if !ok {
+		return versionGate{}
+	}
+	current, _ := parseVersion(version)
+	return versionGate{current: current, known: true}
+}
+
+// incompatible reports whether a guide needing minVersion can't run on the
+// instance. Guides without a readable minimum, and instances that don't
+// report their version, are treated as compatible.
+func (g versionGate) incompatible(minVersion string) bool {
+	if !g.known || minVersion == "" {
+		return false
+	}
+	required, ok := parseVersion(minVersion)
+	return ok && compareVersions(g.current, required) < 0
+}
+
+// compatibleOnly reports whether a listing request asked for incompatible
+// guides to be left out (?compatibleOnly=true) rather than flagged.
+func compatibleOnly(r *http.Request) bool {
+	only, _ := strconv.ParseBool(r.URL.Query().Get("compatibleOnly"))
+	return only
+}
@@ -0,0 +1,231 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Custom guide access rules.
+//
+// Internal runbooks published as custom guides shouldn't reach every viewer
+// in the org. Admins restrict a guide with PUT /guide-access/{guideId} to
+// Grafana teams, folders, or both: the guide is then listed by
+// /custom-guide-repository only for members of one of the teams and for
+// users who can view one of the folders (a folder permission for them, one
+// of their teams or their role). Admins see every guide. Team membership
+// and folder permissions come from the Grafana API through the plugin's
+// service account; when it can't be reached, restricted guides are hidden.
+
+const (
+	guideAccessCollection = "guide-access"
+	maxGuideAccessEntries = 500
+)
+
+// guideAccess is the access rule of one guide.
+type guideAccess struct {
+	GuideID   string    `json:"guideId"`
+	Teams     []string  `json:"teams,omitempty"`
+	Folders   []string  `json:"folders,omitempty"`
+	UpdatedBy string    `json:"updatedBy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GuideAccessRequest is the JSON body for PUT /guide-access/{guideId}.
+type GuideAccessRequest struct {
+	Teams   []string `json:"teams,omitempty" validate:"max=50,each,required,max=190"`
+	Folders []string `json:"folders,omitempty" validate:"max=50,each,required,max=40"`
+}
+
+// roleRank orders Grafana's basic roles.
+var roleRank = map[string]int{"Viewer": 1, "Editor": 2, "Admin": 3}
+
+// guideAccessChecker decides which guides the caller of one request may see.
+// It looks up the caller's teams and each folder's permissions at most once.
+type guideAccessChecker struct {
+	ctx   context.Context
+	app   *App
+	user  *backend.User
+	rules map[string]guideAccess
+
+	api      grafanaAPI
+	apiErr   error
+	teams    []string
+	teamsErr error
+	looked   bool
+	folders  map[string][]grafanaFolderPermission
+}
+
+func (a *App) newGuideAccessChecker(ctx context.Context) *guideAccessChecker {
+	c := &guideAccessChecker{ctx: ctx, app: a, user: backend.PluginConfigFromContext(ctx).User, rules: map[string]guideAccess{}, folders: map[string][]grafanaFolderPermission{}}
+	for _, key := range a.store.keys(guideAccessCollection) {
+		var rule guideAccess
+		if ok, err := a.store.get(guideAccessCollection, key, &rule); err == nil && ok {
+			c.rules[key] = rule
+		}
+	}
+	return c
+}
+
+func (c *guideAccessChecker) grafana() (grafanaAPI, error) {
+	if c.api == nil && c.apiErr == nil {
+		c.api, c.apiErr = resolveGrafanaAPI(c.ctx)
+	}
+	return c.api, c.apiErr
+}
+
+func (c *guideAccessChecker) userTeams() ([]string, error) {
+	if !c.looked {
+		c.looked = true
+		api, err := c.grafana()
+		if err != nil {
+			c.teamsErr = err
+		} else {
+			c.teams, c.teamsErr = api.UserTeams(c.ctx, c.user.Login)
+		}
+	}
+	return c.teams, c.teamsErr
+}
+
+// canView reports whether the caller may see guideID.
+func (c *guideAccessChecker) canView(guideID string) bool {
+	rule, ok := c.rules[guideID]
+	if !ok {
+		return true
+	}
+	if c.user == nil {
+		return false
+	}
+	if c.user.Role == "Admin" {
+		return true
+	}
+	teams, err := c.userTeams()
+	if err != nil {
+		c.app.ctxLogger(c.ctx).Warn("Failed to look up teams for guide access", "user", c.user.Login, "error", err)
+		return false
+	}
+	for _, team := range rule.Teams {
+		if slices.Contains(teams, team) {
+			return true
+		}
+	}
+	for _, folder := range rule.Folders {
+		perms, ok := c.folders[folder]
+		if !ok {
+			api, err := c.grafana()
+			if err == nil {
+				perms, err = api.FolderPermissions(c.ctx, folder)
+			}
+			if err != nil {
+				c.app.ctxLogger(c.ctx).Warn("Failed to read folder permissions for guide access", "folder", folder, "error", err)
+				continue
+			}
+			c.folders[folder] = perms
+		}
+		for _, p := range perms {
+			if (p.UserLogin != "" && p.UserLogin == c.user.Login) ||
+				(p.Team != "" && slices.Contains(teams, p.Team)) ||
+				(roleRank[p.Role] > 0 && roleRank[string(c.user.Role)] >= roleRank[p.Role]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleGuideAccessList handles GET /guide-access (admin only): every
+// guide's access rule.
+func (a *App) handleGuideAccessList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage guide access", http.StatusForbidden)
+		return
+	}
+	rules := []guideAccess{}
+	for _, rule := range a.newGuideAccessChecker(r.Context()).rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].GuideID < rules[j].GuideID })
+	a.writeJSON(w, map[string]interface{}{"rules": rules}, http.StatusOK)
+}
+
+// handleGuideAccess handles PUT and DELETE on /guide-access/{guideId} (admin
+// only). PUT with no teams and no folders is the same as DELETE.
+func (a *App) handleGuideAccess(w http.ResponseWriter, r *http.Request) {
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage guide access", http.StatusForbidden)
+		return
+	}
+	guideID := strings.TrimPrefix(r.URL.Path, "/guide-access/")
+	if !guideIDPattern.MatchString(guideID) {
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req GuideAccessRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if len(req.Teams) == 0 && len(req.Folders) == 0 {
+			if err := a.store.delete(guideAccessCollection, guideID); err != nil {
+				a.ctxLogger(r.Context()).Error("Failed to delete guide access", "guideId", guideID, "error", err)
+				a.writeError(w, "Failed to store the access rule", http.StatusInternalServerError)
+				return
+			}
+			a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: admin, Action: "guide.access.delete", Details: guideID})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		keys := a.store.keys(guideAccessCollection)
+		if len(keys) >= maxGuideAccessEntries && !slices.Contains(keys, guideID) {
+			a.writeError(w, fmt.Sprintf("At most %d guides can be restricted", maxGuideAccessEntries), http.StatusConflict)
+			return
+		}
+		rule := guideAccess{GuideID: guideID, Teams: req.Teams, Folders: req.Folders, UpdatedBy: admin, UpdatedAt: timeNow().UTC()}
+		if err := a.store.put(guideAccessCollection, guideID, rule); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store guide access", "guideId", guideID, "error", err)
+			a.writeError(w, "Failed to store the access rule", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: admin, Action: "guide.access.update", Details: fmt.Sprintf("%s teams=%s folders=%s", guideID, strings.Join(req.Teams, ","), strings.Join(req.Folders, ","))})
+		a.writeJSON(w, rule, http.StatusOK)
+	case http.MethodDelete:
+		var rule guideAccess
+		ok, err := a.store.get(guideAccessCollection, guideID, &rule)
+		if err == nil && !ok {
+			a.writeError(w, "Guide is not restricted", http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			err = a.store.delete(guideAccessCollection, guideID)
+		}
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to delete guide access", "guideId", guideID, "error", err)
+			a.writeError(w, "Failed to delete the access rule", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: admin, Action: "guide.access.delete", Details: guideID})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestGuideAccessRules(t *testing.T) {
+	app := newTestApp(t)
+	serve := func(method, target, body, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		if target == "/guide-access" {
+			app.handleGuideAccessList(w, roleRequest(method, target, body, "admin", role))
+		} else {
+			app.handleGuideAccess(w, roleRequest(method, target, body, "admin", role))
+		}
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/guide-access/runbook-db", `{"teams": ["dba"]}`, "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("editor: status %d, want 403", w.Code)
+	}
+	if w := serve(http.MethodPut, "/guide-access/runbook-db", `{"teams": [""]}`, "Admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("empty team: status %d, want 400", w.Code)
+	}
+	if w := serve(http.MethodPut, "/guide-access/runbook-db", `{"teams": ["dba"], "folders": ["runbooks"]}`, "Admin"); w.Code != http.StatusOK {
+		t.Fatalf("put: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPut, "/guide-access/runbook-net", `{"teams": ["neteng"]}`, "Admin"); w.Code != http.StatusOK {
+		t.Fatalf("put: status %d: %s", w.Code, w.Body.String())
+	}
+	w := serve(http.MethodGet, "/guide-access", "", "Admin")
+	var list struct {
+		Rules []guideAccess `json:"rules"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Rules) != 2 || list.Rules[0].GuideID != "runbook-db" || list.Rules[0].Folders[0] != "runbooks" || list.Rules[0].UpdatedBy != "admin" {
+		t.Errorf("rules = %+v", list.Rules)
+	}
+
+	if w := serve(http.MethodPut, "/guide-access/runbook-net", `{}`, "Admin"); w.Code != http.StatusNoContent {
+		t.Errorf("clear: status %d, want 204", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/guide-access/runbook-net", "", "Admin"); w.Code != http.StatusNotFound {
+		t.Errorf("delete cleared: status %d, want 404", w.Code)
+	}
+}
+
+func TestCustomGuide_FiltersRestrictedGuides(t *testing.T) {
+	withGuideLister(t, singlePageGuideLister(
+		guideEntry("public-guide", "Public", "published", "guide"),
+		guideEntry("runbook-db", "Database failover", "published", "guide"),
+		guideEntry("runbook-net", "Network outage", "published", "guide"),
+	))
+	app := newTestApp(t)
+	_ = app.store.put(guideAccessCollection, "runbook-db", guideAccess{GuideID: "runbook-db", Teams: []string{"dba"}})
+	_ = app.store.put(guideAccessCollection, "runbook-net", guideAccess{GuideID: "runbook-net", Folders: []string{"net-runbooks"}})
+	fake := &fakeGrafanaAPI{
+		userTeams: map[string][]string{"dana": {"dba"}, "nora": {"noc"}},
+		folderPerms: map[string][]grafanaFolderPermission{
+			"net-runbooks": {{Team: "noc", Permission: 1}, {Role: "Editor", Permission: 1}},
+		},
+	}
+	useFakeGrafanaAPI(t, fake)
+
+	visible := func(login, role string) []string {
+		t.Helper()
+		r := customGuideRequest(t, "/custom-guide-repository", "user:1")
+		pc := backend.PluginConfigFromContext(r.Context())
+		pc.User = &backend.User{Login: login, Role: role}
+		r = r.WithContext(backend.WithPluginContext(r.Context(), pc))
+		w := httptest.NewRecorder()
+		app.handleCustomGuideRepository(w, r)
+		var body customGuideRepositoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, g := range body.Guides {
+			ids = append(ids, g.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		login, role string
+		want        int
+	}{
+		{"viewer", "Viewer", 1}, // public only
+		{"dana", "Viewer", 2},   // team dba
+		{"nora", "Viewer", 2},   // folder via team noc
+		{"eddie", "Editor", 2},  // folder via role
+		{"root", "Admin", 3},
+	} {
+		if got := visible(tc.login, tc.role); len(got) != tc.want || got[0] != "public-guide" {
+			t.Errorf("%s sees %v, want %d guides", tc.login, got, tc.want)
+		}
+	}
+
+	fake.err = errors.New("service account missing")
+	if got := visible("dana", "Viewer"); len(got) != 1 {
+		t.Errorf("lookup failure: dana sees %v, want restricted guides hidden", got)
+	}
+}
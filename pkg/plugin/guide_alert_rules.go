@@ -0,0 +1,230 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Demo alert rules for alerting guides.
+//
+// POST /actions/alert-rules creates one of the bundled rule definitions
+// below through Grafana's alerting provisioning API, with an email contact
+// point the rule notifies, so a guide can go straight to "look at your
+// firing alert". Rules query the TestData data source, live in the user's
+// demo folder and are tracked as guide resources for cleanup.
+
+const (
+	demoRuleGroup = "pathfinder-demos"
+	demoEmail     = "demo@example.com"
+
+	// expressionDatasourceUID is Grafana's server-side expressions
+	// pseudo data source.
+	expressionDatasourceUID = "__expr__"
+)
+
+// demoAlertRule is a bundled alert rule definition: a TestData random walk
+// reduced to its last value and compared with a threshold.
+type demoAlertRule struct {
+	Name        string  `json:"name"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Scenario    string  `json:"-"`
+	Threshold   float64 `json:"threshold"`
+	For         string  `json:"for"`
+}
+
+var demoAlertRules = map[string]demoAlertRule{
+	"high-cpu": {
+		Name:        "high-cpu",
+		Title:       "Demo: high CPU usage",
+		Description: "Fires when simulated CPU usage goes above 40%.",
+		Scenario:    "random_walk",
+		Threshold:   40,
+		For:         "1m",
+	},
+	"error-spike": {
+		Name:        "error-spike",
+		Title:       "Demo: error rate spike",
+		Description: "Fires when the simulated error rate goes above 5 per second.",
+		Scenario:    "random_walk",
+		Threshold:   5,
+		For:         "0s",
+	},
+}
+
+type alertRuleActionRequest struct {
+	Definition    string `json:"definition" validate:"required,pattern=name"`
+	Guide         string `json:"guide,omitempty" validate:"max=200"`
+	DatasourceUID string `json:"datasourceUid,omitempty" validate:"max=40"`
+}
+
+type alertRuleActionResponse struct {
+	UID          string `json:"uid"`
+	Title        string `json:"title"`
+	URL          string `json:"url"`
+	FolderUID    string `json:"folderUid"`
+	ContactPoint string `json:"contactPoint"`
+}
+
+// handleAlertRuleActions handles GET (list definitions) and POST (create a
+// demo rule) on /actions/alert-rules.
+func (a *App) handleAlertRuleActions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		defs := make([]demoAlertRule, 0, len(demoAlertRules))
+		for _, def := range demoAlertRules {
+			defs = append(defs, def)
+		}
+		sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+		a.writeJSON(w, map[string]interface{}{"definitions": defs}, http.StatusOK)
+	case http.MethodPost:
+		a.createDemoAlertRule(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) createDemoAlertRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can create alert rules", http.StatusForbidden)
+		return
+	}
+	var req alertRuleActionRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	def, ok := demoAlertRules[req.Definition]
+	if !ok {
+		a.writeError(w, "Unknown alert rule definition: "+req.Definition, http.StatusNotFound)
+		return
+	}
+
+	ruleUID := guideResourceUID(guideResourceAlertRule, def.Name, user)
+	cpUID := guideResourceUID(guideResourceContactPoint, "email", user)
+	cpName := "Pathfinder demo (" + user + ")"
+	resp := alertRuleActionResponse{
+		UID:          ruleUID,
+		Title:        def.Title,
+		URL:          "/alerting/grafana/" + ruleUID + "/view",
+		FolderUID:    demoFolderUID(user),
+		ContactPoint: cpName,
+	}
+	if _, tracked := a.trackedGuideResource(user, guideResourceAlertRule, ruleUID); tracked {
+		a.writeJSON(w, resp, http.StatusOK)
+		return
+	}
+
+	api, err := resolveGrafanaAPI(ctx)
+	if err != nil {
+		a.writeError(w, "Alert rule actions need the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+		return
+	}
+	logger := a.ctxLogger(ctx)
+
+	dsUID, err := testDataDatasourceUID(ctx, api, req.DatasourceUID)
+	if errors.Is(err, errNoTestData) {
+		a.writeError(w, "Demo alert rules need a TestData data source; add one first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to list data sources", "error", err)
+		a.writeError(w, "Failed to list data sources", http.StatusBadGateway)
+		return
+	}
+
+	if err := a.ensureDemoFolder(ctx, api, user); err != nil {
+		a.writeGrafanaActionError(w, r, "create the demo folder", err)
+		return
+	}
+	if _, tracked := a.trackedGuideResource(user, guideResourceContactPoint, cpUID); !tracked {
+		cp := grafanaContactPoint{
+			UID:      cpUID,
+			Name:     cpName,
+			Type:     "email",
+			Settings: map[string]interface{}{"addresses": demoEmail, "singleEmail": true},
+		}
+		if err := api.CreateContactPoint(ctx, cp); err != nil {
+			a.writeGrafanaActionError(w, r, "create the contact point", err)
+			return
+		}
+		a.trackGuideResource(ctx, guideResource{Kind: guideResourceContactPoint, UID: cpUID, Title: cpName, Guide: req.Guide, User: user})
+	}
+
+	err = api.CreateAlertRule(ctx, demoAlertRuleSpec(def, ruleUID, resp.FolderUID, dsUID, cpName))
+	if err != nil && grafanaAPIStatus(err) != http.StatusConflict {
+		a.writeGrafanaActionError(w, r, "create the alert rule", err)
+		return
+	}
+	a.trackGuideResource(ctx, guideResource{Kind: guideResourceAlertRule, UID: ruleUID, Title: def.Title, Guide: req.Guide, User: user})
+	a.recordAudit(logger, auditEntry{Actor: user, Action: "guide.alert-rule.create", Details: def.Name + " " + ruleUID})
+	a.writeJSON(w, resp, http.StatusCreated)
+}
+
+// writeGrafanaActionError reports a failed Grafana API call made by a guide
+// action. Grafana's 403 usually means the plugin's service account lacks a
+// permission, which is an installation problem rather than the user's.
+func (a *App) writeGrafanaActionError(w http.ResponseWriter, r *http.Request, what string, err error) {
+	a.ctxLogger(r.Context()).Warn("Guide action failed", "step", what, "error", err)
+	var msg string
+	var apiErr *grafanaAPIError
+	switch {
+	case !errors.As(err, &apiErr):
+		msg = fmt.Sprintf("Failed to reach Grafana to %s", what)
+	case apiErr.status == http.StatusUnauthorized || apiErr.status == http.StatusForbidden:
+		msg = fmt.Sprintf("The plugin's service account is not allowed to %s", what)
+	default:
+		msg = fmt.Sprintf("Grafana failed to %s: %s", what, apiErr.message)
+	}
+	a.writeError(w, msg, http.StatusBadGateway)
+}
+
+// demoAlertRuleSpec builds the provisioning payload for def: query A from
+// TestData, B reduces it to the last value, C is the threshold condition.
+func demoAlertRuleSpec(def demoAlertRule, uid, folderUID, datasourceUID, receiver string) grafanaAlertRule {
+	return grafanaAlertRule{
+		UID:       uid,
+		Title:     def.Title,
+		FolderUID: folderUID,
+		RuleGroup: demoRuleGroup,
+		Condition: "C",
+		Data: []grafanaAlertQuery{
+			{
+				RefID:             "A",
+				RelativeTimeRange: &grafanaTimeRange{From: 600, To: 0},
+				DatasourceUID:     datasourceUID,
+				Model:             map[string]interface{}{"refId": "A", "scenarioId": def.Scenario},
+			},
+			{
+				RefID:         "B",
+				DatasourceUID: expressionDatasourceUID,
+				Model:         map[string]interface{}{"refId": "B", "type": "reduce", "expression": "A", "reducer": "last"},
+			},
+			{
+				RefID:         "C",
+				DatasourceUID: expressionDatasourceUID,
+				Model: map[string]interface{}{
+					"refId":      "C",
+					"type":       "threshold",
+					"expression": "B",
+					"conditions": []interface{}{
+						map[string]interface{}{"evaluator": map[string]interface{}{"type": "gt", "params": []float64{def.Threshold}}},
+					},
+				},
+			},
+		},
+		NoDataState:          "NoData",
+		ExecErrState:         "Error",
+		For:                  def.For,
+		Labels:               map[string]string{"pathfinder": "demo"},
+		Annotations:          map[string]string{"summary": def.Description},
+		NotificationSettings: &grafanaNotificationSettings{Receiver: receiver},
+	}
+}
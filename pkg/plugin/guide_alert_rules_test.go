@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlertRuleAction(t *testing.T) {
+	api := &fakeGrafanaAPI{
+		datasources: []grafanaDatasource{{UID: "prom", Type: "prometheus"}, {UID: "td", Type: "grafana-testdata-datasource"}},
+	}
+	useFakeGrafanaAPI(t, api)
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	body := `{"definition": "high-cpu", "guide": "alerting-101"}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/alert-rules", body, "ana", "Editor"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp alertRuleActionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	rule, ok := api.alertRules[resp.UID]
+	if !ok {
+		t.Fatalf("rule %s not created", resp.UID)
+	}
+	if rule.FolderUID != demoFolderUID("ana") || api.folders[rule.FolderUID] == "" {
+		t.Errorf("rule folder=%q folders=%v", rule.FolderUID, api.folders)
+	}
+	if rule.Data[0].DatasourceUID != "td" || rule.Condition != "C" {
+		t.Errorf("rule queries %s, condition %s", rule.Data[0].DatasourceUID, rule.Condition)
+	}
+	if len(api.contactPoints) != 1 || rule.NotificationSettings.Receiver != resp.ContactPoint {
+		t.Errorf("contact points=%v receiver=%q", api.contactPoints, rule.NotificationSettings.Receiver)
+	}
+	res, ok := app.trackedGuideResource("ana", guideResourceAlertRule, resp.UID)
+	if !ok || res.Guide != "alerting-101" {
+		t.Errorf("rule not tracked: %+v", res)
+	}
+
+	// Repeating the action reuses the tracked rule; a second definition
+	// reuses the contact point.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/alert-rules", body, "ana", "Editor"))
+	if w.Code != http.StatusOK {
+		t.Errorf("repeat: status=%d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/alert-rules", `{"definition": "error-spike"}`, "ana", "Editor"))
+	if w.Code != http.StatusCreated || len(api.alertRules) != 2 || len(api.contactPoints) != 1 {
+		t.Errorf("second rule: status=%d rules=%d contact points=%d", w.Code, len(api.alertRules), len(api.contactPoints))
+	}
+
+	for _, tc := range []struct {
+		body, role string
+		want       int
+	}{
+		{body, "Viewer", http.StatusForbidden},
+		{`{"definition": "disk-full"}`, "Editor", http.StatusNotFound},
+		{`{}`, "Editor", http.StatusBadRequest},
+	} {
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/alert-rules", tc.body, "bo", tc.role))
+		if w.Code != tc.want {
+			t.Errorf("%s as %s: status=%d, want %d", tc.body, tc.role, w.Code, tc.want)
+		}
+	}
+}
+
+func TestAlertRuleAction_NoTestData(t *testing.T) {
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{datasources: []grafanaDatasource{{UID: "prom", Type: "prometheus"}}})
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/alert-rules", `{"definition": "high-cpu"}`, "ana", "Admin"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("status=%d body=%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Guide assets.
+//
+// Custom guides reference images by URL, and externally hosted images break
+// behind corporate proxies. Authors (Editors and Admins) upload images for a
+// guide instead:
+//
+//	POST /guides/{name}/assets?filename=diagram.png   (raw image body)
+//
+// and reference the returned url, which serves the image from this plugin:
+//
+//	GET /guides/{name}/assets/{filename}?v=<content hash>
+//
+// so guides render their images without reaching any external host. The path
+// is stable across replacements; v changes with the content, so a request
+// carrying the current v may be cached indefinitely, and anything else is
+// revalidated against the content-hash ETag.
+//
+// Metadata lives in the plugin store and the bytes in its blobs, both keyed
+// by guide and file name. Only raster images are accepted (no SVG, which can
+// carry script), and the body must sniff as the declared type.
+
+const (
+	guideAssetCollection = "guide-assets"
+	guideAssetMaxBytes   = 5 * 1024 * 1024
+	maxAssetsPerGuide    = 100
+)
+
+// guideAssetTypes maps accepted media types to their file extensions.
+var guideAssetTypes = map[string][]string{
+	"image/png":  {".png"},
+	"image/jpeg": {".jpg", ".jpeg"},
+	"image/gif":  {".gif"},
+	"image/webp": {".webp"},
+}
+
+var guideAssetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// guideAssetUploadTypes lists guideAssetTypes for secureUploadRoute.
+func guideAssetUploadTypes() []string {
+	types := make([]string, 0, len(guideAssetTypes))
+	for t := range guideAssetTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// guideAsset is the stored metadata of one uploaded asset.
+type guideAsset struct {
+	Guide       string    `json:"guide"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	SHA256      string    `json:"sha256"`
+	URL         string    `json:"url"`
+	UploadedBy  string    `json:"uploadedBy"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
+
+func guideAssetKey(guide, name string) string {
+	return guide + "/" + name
+}
+
+// guideAssetVersion is the v query parameter of asset's url.
+func guideAssetVersion(asset guideAsset) string {
+	return asset.SHA256[:16]
+}
+
+// serveGuideAsset writes an asset's bytes with its type, validators and cache
+// headers. http.ServeContent answers If-None-Match, If-Modified-Since and
+// Range requests.
+func serveGuideAsset(w http.ResponseWriter, r *http.Request, asset guideAsset, data []byte) {
+	h := w.Header()
+	h.Set("Content-Type", asset.ContentType)
+	h.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": asset.Name}))
+	h.Set("ETag", `"`+asset.SHA256+`"`)
+	if r.URL.Query().Get("v") == guideAssetVersion(asset) {
+		h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "private, no-cache")
+	}
+	http.ServeContent(w, r, asset.Name, asset.UploadedAt, bytes.NewReader(data))
+}
+
+// listGuideAssets returns guide's assets sorted by name.
+func (a *App) listGuideAssets(guide string) []guideAsset {
+	result := []guideAsset{}
+	for _, key := range a.store.keys(guideAssetCollection) {
+		if !strings.HasPrefix(key, guide+"/") {
+			continue
+		}
+		var asset guideAsset
+		if ok, err := a.store.get(guideAssetCollection, key, &asset); err != nil || !ok {
+			continue
+		}
+		result = append(result, asset)
+	}
+	return result
+}
+
+// handleGuideAssets handles GET/POST /guides/{name}/assets and
+// GET/DELETE /guides/{name}/assets/{filename}. Changes require the Editor or
+// Admin role.
+func (a *App) handleGuideAssets(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/guides/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] != "assets" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	guide := parts[0]
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && !userCanEditFromContext(r.Context()) {
+		a.writeError(w, "Only editors and admins can change guide assets", http.StatusForbidden)
+		return
+	}
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			a.writeJSON(w, map[string]interface{}{"assets": a.listGuideAssets(guide)}, http.StatusOK)
+		case http.MethodPost:
+			a.handleUploadGuideAsset(w, r, user, guide)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	name := parts[2]
+	var asset guideAsset
+	ok, err := a.store.get(guideAssetCollection, guideAssetKey(guide, name), &asset)
+	if err != nil {
+		a.writeError(w, "Failed to load asset", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.writeError(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data, ok, err := a.store.getBlob(guideAssetCollection, guideAssetKey(guide, name))
+		if err != nil || !ok {
+			a.ctxLogger(r.Context()).Error("Guide asset content missing", "guide", guide, "name", name, "error", err)
+			a.writeError(w, "Failed to load asset", http.StatusInternalServerError)
+			return
+		}
+		serveGuideAsset(w, r, asset, data)
+	case http.MethodDelete:
+		if err := a.store.delete(guideAssetCollection, guideAssetKey(guide, name)); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to delete guide asset", "guide", guide, "name", name, "error", err)
+			a.writeError(w, "Failed to delete asset", http.StatusInternalServerError)
+			return
+		}
+		if err := a.store.deleteBlob(guideAssetCollection, guideAssetKey(guide, name)); err != nil {
+			a.ctxLogger(r.Context()).Warn("Failed to delete guide asset content", "guide", guide, "name", name, "error", err)
+		}
+		a.ctxLogger(r.Context()).Info("Deleted guide asset", "guide", guide, "name", name, "user", user)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleUploadGuideAsset(w http.ResponseWriter, r *http.Request, user, guide string) {
+	name := r.URL.Query().Get("filename")
+	if !guideAssetNamePattern.MatchString(name) {
+		a.writeError(w, "filename must be 1-100 letters, digits, '.', '_' or '-', starting with a letter or digit", http.StatusBadRequest)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	exts, ok := guideAssetTypes[contentType]
+	if !ok {
+		a.writeError(w, "Content-Type must be one of "+strings.Join(guideAssetUploadTypes(), ", "), http.StatusUnsupportedMediaType)
+		return
+	}
+	if !slices.Contains(exts, strings.ToLower(path.Ext(name))) {
+		a.writeError(w, fmt.Sprintf("filename must end in %s for %s", strings.Join(exts, " or "), contentType), http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, guideAssetMaxBytes))
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		a.writeError(w, fmt.Sprintf("Asset too large (max %d bytes)", guideAssetMaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil || len(data) == 0 {
+		a.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if sniffed := http.DetectContentType(data); sniffed != contentType {
+		a.writeError(w, fmt.Sprintf("Content is %s, not %s", sniffed, contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	key := guideAssetKey(guide, name)
+	existing, _ := a.store.get(guideAssetCollection, key, &guideAsset{})
+	if !existing && len(a.listGuideAssets(guide)) >= maxAssetsPerGuide {
+		a.writeError(w, fmt.Sprintf("Guide already has the maximum of %d assets", maxAssetsPerGuide), http.StatusConflict)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	asset := guideAsset{
+		Guide:       guide,
+		Name:        name,
+		ContentType: contentType,
+		Size:        len(data),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedBy:  user,
+		UploadedAt:  timeNow().UTC().Truncate(time.Second),
+	}
+	asset.URL = pluginResourcesPath + "/" + apiVersion + "/guides/" + guide + "/assets/" + name + "?v=" + guideAssetVersion(asset)
+	if err := a.store.putBlob(guideAssetCollection, key, data); err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to store guide asset content", "guide", guide, "name", name, "error", err)
+		a.writeError(w, "Failed to save asset", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.put(guideAssetCollection, key, asset); err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to store guide asset", "guide", guide, "name", name, "error", err)
+		a.writeError(w, "Failed to save asset", http.StatusInternalServerError)
+		return
+	}
+	a.ctxLogger(r.Context()).Info("Uploaded guide asset", "guide", guide, "name", name, "size", len(data), "user", user)
+
+	status := http.StatusCreated
+	if existing {
+		status = http.StatusOK
+	}
+	a.writeJSON(w, asset, status)
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGuideAssets(t *testing.T) {
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	upload := func(filename, contentType, body, role string) *httptest.ResponseRecorder {
+		r := roleRequest(http.MethodPost, "/v1/guides/otel-intro/assets?filename="+filename, body, "ana", role)
+		r.Header.Set("Content-Type", contentType)
+		return do(r)
+	}
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+
+	w := upload("arch.png", "image/png", png, "Editor")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var asset guideAsset
+	if err := json.Unmarshal(w.Body.Bytes(), &asset); err != nil {
+		t.Fatal(err)
+	}
+	if asset.URL != pluginResourcesPath+"/v1/guides/otel-intro/assets/arch.png?v="+asset.SHA256[:16] || asset.Size != len(png) {
+		t.Errorf("asset = %+v", asset)
+	}
+	if w := upload("arch.png", "image/png", png, "Editor"); w.Code != http.StatusOK {
+		t.Errorf("replace: status=%d", w.Code)
+	}
+
+	for name, c := range map[string]struct {
+		filename, contentType, body, role string
+		want                              int
+	}{
+		"viewer":        {"a.png", "image/png", png, "Viewer", http.StatusForbidden},
+		"svg":           {"a.svg", "image/svg+xml", "<svg/>", "Editor", http.StatusUnsupportedMediaType},
+		"wrong content": {"a.png", "image/png", "not an image", "Editor", http.StatusUnsupportedMediaType},
+		"wrong ext":     {"a.jpg", "image/png", png, "Editor", http.StatusBadRequest},
+		"bad filename":  {"../a.png", "image/png", png, "Editor", http.StatusBadRequest},
+		"too large":     {"big.png", "image/png", png + strings.Repeat("\x00", guideAssetMaxBytes), "Editor", http.StatusRequestEntityTooLarge},
+	} {
+		if w := upload(c.filename, c.contentType, c.body, c.role); w.Code != c.want {
+			t.Errorf("%s: status=%d, want %d (%s)", name, w.Code, c.want, w.Body.String())
+		}
+	}
+
+	w = do(roleRequest(http.MethodGet, "/v1/guides/otel-intro/assets/arch.png", "", "viewer", "Viewer"))
+	if w.Code != http.StatusOK || w.Body.String() != png || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("get: status=%d type=%q", w.Code, w.Header().Get("Content-Type"))
+	}
+	w = do(roleRequest(http.MethodGet, "/v1/guides/otel-intro/assets", "", "viewer", "Viewer"))
+	var list struct {
+		Assets []guideAsset `json:"assets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Assets) != 1 {
+		t.Errorf("list: %s", w.Body.String())
+	}
+
+	if w := do(roleRequest(http.MethodDelete, "/v1/guides/otel-intro/assets/arch.png", "", "ana", "Editor")); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status=%d", w.Code)
+	}
+	if w := do(roleRequest(http.MethodGet, "/v1/guides/otel-intro/assets/arch.png", "", "viewer", "Viewer")); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status=%d", w.Code)
+	}
+	if _, ok, _ := app.store.getBlob(guideAssetCollection, "otel-intro/arch.png"); ok {
+		t.Error("asset content left behind after delete")
+	}
+}
+
+func TestGuideAssets_CacheHeaders(t *testing.T) {
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	r := roleRequest(http.MethodPost, "/v1/guides/otel-intro/assets?filename=arch.png", png, "ana", "Editor")
+	r.Header.Set("Content-Type", "image/png")
+	var asset guideAsset
+	if err := json.Unmarshal(do(r).Body.Bytes(), &asset); err != nil {
+		t.Fatal(err)
+	}
+	target := strings.TrimPrefix(asset.URL, pluginResourcesPath)
+
+	w := do(roleRequest(http.MethodGet, target, "", "viewer", "Viewer"))
+	if w.Code != http.StatusOK || w.Body.String() != png {
+		t.Fatalf("get: status=%d", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); !strings.Contains(got, "immutable") {
+		t.Errorf("versioned url Cache-Control = %q", got)
+	}
+	if got := w.Header().Get("ETag"); got != `"`+asset.SHA256+`"` {
+		t.Errorf("ETag = %q", got)
+	}
+
+	r = roleRequest(http.MethodGet, "/v1/guides/otel-intro/assets/arch.png", "", "viewer", "Viewer")
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = do(r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("revalidate: status=%d", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("unversioned url Cache-Control = %q", got)
+	}
+}
@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// Demo dashboards for dashboard guides.
+//
+// POST /actions/dashboards creates one of the bundled dashboards below in
+// the user's demo folder, so a guide about editing panels or variables
+// starts from a populated dashboard instead of an empty one. Panels query
+// the TestData data source, and dashboards are tracked as guide resources
+// for cleanup.
+
+// demoDashboard is a bundled dashboard definition.
+type demoDashboard struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	panels      func(datasourceUID string) []interface{}
+}
+
+var demoDashboards = map[string]demoDashboard{
+	"service-overview": {
+		Name:        "service-overview",
+		Title:       "Demo: service overview",
+		Description: "Request rate, error ratio, latency and logs of a simulated service.",
+		panels:      serviceOverviewPanels,
+	},
+	"host-overview": {
+		Name:        "host-overview",
+		Title:       "Demo: host overview",
+		Description: "CPU, memory and disk gauges and their history for a simulated host.",
+		panels:      hostOverviewPanels,
+	},
+}
+
+type dashboardActionRequest struct {
+	Definition    string `json:"definition" validate:"required,pattern=name"`
+	Guide         string `json:"guide,omitempty" validate:"max=200"`
+	DatasourceUID string `json:"datasourceUid,omitempty" validate:"max=40"`
+}
+
+type dashboardActionResponse struct {
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	FolderUID string `json:"folderUid"`
+}
+
+// handleDashboardActions handles GET (list definitions) and POST (create a
+// demo dashboard) on /actions/dashboards.
+func (a *App) handleDashboardActions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		defs := make([]demoDashboard, 0, len(demoDashboards))
+		for _, def := range demoDashboards {
+			defs = append(defs, def)
+		}
+		sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+		a.writeJSON(w, map[string]interface{}{"definitions": defs}, http.StatusOK)
+	case http.MethodPost:
+		a.createDemoDashboard(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) createDemoDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can create dashboards", http.StatusForbidden)
+		return
+	}
+	var req dashboardActionRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	def, ok := demoDashboards[req.Definition]
+	if !ok {
+		a.writeError(w, "Unknown dashboard definition: "+req.Definition, http.StatusNotFound)
+		return
+	}
+
+	uid := guideResourceUID(guideResourceDashboard, def.Name, user)
+	resp := dashboardActionResponse{UID: uid, Title: def.Title, URL: "/d/" + uid, FolderUID: demoFolderUID(user)}
+	if _, tracked := a.trackedGuideResource(user, guideResourceDashboard, uid); tracked {
+		a.writeJSON(w, resp, http.StatusOK)
+		return
+	}
+
+	api, err := resolveGrafanaAPI(ctx)
+	if err != nil {
+		a.writeError(w, "Dashboard actions need the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+		return
+	}
+	logger := a.ctxLogger(ctx)
+
+	dsUID, err := testDataDatasourceUID(ctx, api, req.DatasourceUID)
+	if errors.Is(err, errNoTestData) {
+		a.writeError(w, "Demo dashboards need a TestData data source; add one first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to list data sources", "error", err)
+		a.writeError(w, "Failed to list data sources", http.StatusBadGateway)
+		return
+	}
+	if err := a.ensureDemoFolder(ctx, api, user); err != nil {
+		a.writeGrafanaActionError(w, r, "create the demo folder", err)
+		return
+	}
+	dashboard := map[string]interface{}{
+		"uid":           uid,
+		"title":         def.Title,
+		"description":   def.Description,
+		"tags":          []string{"pathfinder", "demo"},
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": "now-30m", "to": "now"},
+		"refresh":       "30s",
+		"panels":        def.panels(dsUID),
+	}
+	if err := api.SaveDashboard(ctx, dashboard, resp.FolderUID); err != nil {
+		a.writeGrafanaActionError(w, r, "create the dashboard", err)
+		return
+	}
+	a.trackGuideResource(ctx, guideResource{Kind: guideResourceDashboard, UID: uid, Title: def.Title, Guide: req.Guide, User: user})
+	a.recordAudit(logger, auditEntry{Actor: user, Action: "guide.dashboard.create", Details: def.Name + " " + uid})
+	a.writeJSON(w, resp, http.StatusCreated)
+}
+
+// demoPanel returns a panel at the given grid position whose targets use
+// the TestData scenarios, in order.
+func demoPanel(id int, typ, title string, x, y, width, height int, datasourceUID string, scenarios ...string) map[string]interface{} {
+	ds := map[string]string{"type": "grafana-testdata-datasource", "uid": datasourceUID}
+	targets := make([]interface{}, len(scenarios))
+	for i, scenario := range scenarios {
+		targets[i] = map[string]interface{}{
+			"refId":      string(rune('A' + i)),
+			"datasource": ds,
+			"scenarioId": scenario,
+		}
+	}
+	return map[string]interface{}{
+		"id":         id,
+		"type":       typ,
+		"title":      title,
+		"datasource": ds,
+		"gridPos":    map[string]int{"x": x, "y": y, "w": width, "h": height},
+		"targets":    targets,
+	}
+}
+
+func serviceOverviewPanels(datasourceUID string) []interface{} {
+	return []interface{}{
+		demoPanel(1, "timeseries", "Requests per second", 0, 0, 12, 8, datasourceUID, "random_walk", "random_walk"),
+		demoPanel(2, "stat", "Error ratio", 12, 0, 6, 8, datasourceUID, "random_walk"),
+		demoPanel(3, "timeseries", "p95 latency", 18, 0, 6, 8, datasourceUID, "random_walk"),
+		demoPanel(4, "logs", "Service logs", 0, 8, 24, 10, datasourceUID, "logs"),
+	}
+}
+
+func hostOverviewPanels(datasourceUID string) []interface{} {
+	return []interface{}{
+		demoPanel(1, "gauge", "CPU usage", 0, 0, 8, 6, datasourceUID, "random_walk"),
+		demoPanel(2, "gauge", "Memory usage", 8, 0, 8, 6, datasourceUID, "random_walk"),
+		demoPanel(3, "bargauge", "Disk usage", 16, 0, 8, 6, datasourceUID, "random_walk"),
+		demoPanel(4, "timeseries", "CPU history", 0, 6, 24, 8, datasourceUID, "random_walk"),
+	}
+}
@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Recently viewed guides.
+//
+// The frontend posts to /history when a guide is opened and as the learner
+// moves through it. GET /history returns one entry per guide, most recent
+// first, with the last step reached, for a "continue where you left off"
+// list that works across browsers. Each user keeps the newest
+// maxHistoryEntries guides; DELETE /history clears them.
+
+const (
+	historyCollection   = "guide-history"
+	maxHistoryEntries   = 50
+	defaultHistoryLimit = 10
+)
+
+// guideHistoryEntry is one recently viewed guide.
+type guideHistoryEntry struct {
+	GuideID       string    `json:"guideId"`
+	Title         string    `json:"title,omitempty"`
+	URL           string    `json:"url,omitempty"`
+	StepIndex     int       `json:"stepIndex,omitempty"`
+	TotalSteps    int       `json:"totalSteps,omitempty"`
+	Opens         int       `json:"opens"`
+	FirstViewedAt time.Time `json:"firstViewedAt"`
+	LastViewedAt  time.Time `json:"lastViewedAt"`
+}
+
+// guideHistory is the stored document for one user, newest first.
+type guideHistory struct {
+	Entries []guideHistoryEntry `json:"entries"`
+}
+
+// RecordHistoryRequest is the JSON body for POST /history. A request
+// without stepIndex is a new open of the guide; with it, a position update.
+type RecordHistoryRequest struct {
+	GuideID    string `json:"guideId" validate:"required,pattern=guideId"`
+	Title      string `json:"title,omitempty" validate:"max=200"`
+	URL        string `json:"url,omitempty" validate:"max=2000"`
+	StepIndex  *int   `json:"stepIndex,omitempty" validate:"min=0,max=1000"`
+	TotalSteps int    `json:"totalSteps,omitempty" validate:"min=0,max=1000"`
+}
+
+// record moves req's guide to the front of h, keeping the newest
+// maxHistoryEntries.
+func (h *guideHistory) record(req RecordHistoryRequest, now time.Time) guideHistoryEntry {
+	entry := guideHistoryEntry{GuideID: req.GuideID, FirstViewedAt: now}
+	for i, e := range h.Entries {
+		if e.GuideID == req.GuideID {
+			entry = e
+			h.Entries = append(h.Entries[:i], h.Entries[i+1:]...)
+			break
+		}
+	}
+	if req.Title != "" {
+		entry.Title = req.Title
+	}
+	if req.URL != "" {
+		entry.URL = req.URL
+	}
+	if req.TotalSteps > 0 {
+		entry.TotalSteps = req.TotalSteps
+	}
+	if req.StepIndex != nil {
+		entry.StepIndex = *req.StepIndex
+	} else {
+		entry.Opens++
+	}
+	entry.LastViewedAt = now
+	h.Entries = append([]guideHistoryEntry{entry}, h.Entries...)
+	if len(h.Entries) > maxHistoryEntries {
+		h.Entries = h.Entries[:maxHistoryEntries]
+	}
+	return entry
+}
+
+// handleHistory handles GET (?limit=N), POST (record a view) and DELETE
+// (clear) on /history for the caller.
+func (a *App) handleHistory(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit := defaultHistoryLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > maxHistoryEntries {
+				a.writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxHistoryEntries), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		var h guideHistory
+		if _, err := a.store.get(historyCollection, user, &h); err != nil {
+			a.ctxLogger(r.Context()).Warn("Failed to read guide history", "user", user, "error", err)
+		}
+		entries := append([]guideHistoryEntry{}, h.Entries[:min(limit, len(h.Entries))]...)
+		a.writeJSON(w, map[string]interface{}{"history": entries}, http.StatusOK)
+	case http.MethodPost:
+		var req RecordHistoryRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		a.captureIdentity(r.Context(), user)
+		a.historyMu.Lock()
+		var h guideHistory
+		_, err := a.store.get(historyCollection, user, &h)
+		entry := h.record(req, timeNow().UTC())
+		if err == nil {
+			err = a.store.put(historyCollection, user, h)
+		}
+		a.historyMu.Unlock()
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to record guide history", "user", user, "guideId", req.GuideID, "error", err)
+			a.writeError(w, "Failed to record the guide view", http.StatusInternalServerError)
+			return
+		}
+		if req.StepIndex == nil {
+			a.emitXAPI(r.Context(), user, xapiVerbExperienced, guideActivity(req.GuideID, entry.Title), nil)
+			a.rollupAnalytics(analyticsEventOpen, user, req.GuideID, 0, 0)
+		} else {
+			a.rollupAnalytics(analyticsEventStep, user, req.GuideID, *req.StepIndex, entry.TotalSteps)
+		}
+		a.writeJSON(w, entry, http.StatusOK)
+	case http.MethodDelete:
+		a.historyMu.Lock()
+		err := a.store.delete(historyCollection, user)
+		a.historyMu.Unlock()
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to clear guide history", "user", user, "error", err)
+			a.writeError(w, "Failed to clear the history", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandleHistory(t *testing.T) {
+	app := newTestApp(t)
+	advance := withFrozenTime(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	serve := func(method, target, body, user string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleHistory(w, roleRequest(method, target, body, user, "Viewer"))
+		return w
+	}
+	record := func(body string) {
+		t.Helper()
+		if w := serve(http.MethodPost, "/history", body, "ana"); w.Code != http.StatusOK {
+			t.Fatalf("record %s: status=%d body=%s", body, w.Code, w.Body.String())
+		}
+		advance(time.Minute)
+	}
+	history := func(target, user string) []guideHistoryEntry {
+		t.Helper()
+		var resp struct{ History []guideHistoryEntry }
+		if err := json.Unmarshal(serve(http.MethodGet, target, "", user).Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.History
+	}
+
+	record(`{"guideId": "alerting-101", "title": "Alerting", "totalSteps": 5}`)
+	record(`{"guideId": "loki-101"}`)
+	record(`{"guideId": "alerting-101", "stepIndex": 3}`)
+	got := history("/history", "ana")
+	if len(got) != 2 || got[0].GuideID != "alerting-101" || got[0].StepIndex != 3 || got[0].TotalSteps != 5 || got[0].Title != "Alerting" || got[0].Opens != 1 || got[1].GuideID != "loki-101" {
+		t.Fatalf("history = %+v", got)
+	}
+
+	// A new open moves the guide to the front and keeps the position.
+	record(`{"guideId": "loki-101"}`)
+	if got := history("/history?limit=1", "ana"); len(got) != 1 || got[0].GuideID != "loki-101" || got[0].Opens != 2 {
+		t.Errorf("limited history = %+v", got)
+	}
+	if got := history("/history", "bo"); got == nil || len(got) != 0 {
+		t.Errorf("bo's history = %+v", got)
+	}
+
+	for i := 0; i < maxHistoryEntries; i++ {
+		record(`{"guideId": "g` + strconv.Itoa(i) + `"}`)
+	}
+	if got := history("/history?limit=50", "ana"); len(got) != maxHistoryEntries || got[0].GuideID != "g49" || got[49].GuideID != "g0" {
+		t.Errorf("capped history has %d entries, first %+v", len(got), got[0])
+	}
+
+	for _, tc := range []struct{ method, target, body string }{
+		{http.MethodGet, "/history?limit=0", ""},
+		{http.MethodGet, "/history?limit=51", ""},
+		{http.MethodPost, "/history", `{"guideId": "bad guide"}`},
+		{http.MethodPost, "/history", `{"guideId": "x", "stepIndex": 5000}`},
+	} {
+		if w := serve(tc.method, tc.target, tc.body, "ana"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: status=%d", tc.method, tc.target, tc.body, w.Code)
+		}
+	}
+
+	if w := serve(http.MethodDelete, "/history", "", "ana"); w.Code != http.StatusNoContent {
+		t.Errorf("clear: status=%d", w.Code)
+	}
+	if got := history("/history", "ana"); len(got) != 0 {
+		t.Errorf("after clear = %+v", got)
+	}
+}
@@ -0,0 +1,287 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Guide linting.
+//
+// POST /guides/lint takes a guide's JSON, as the block editor saves it or
+// as it sits in a content repository, and runs checks that schema
+// validation can't: duplicate block and step IDs, unknown block types,
+// steps that can never be reached, deprecated block types and fields, and
+// references to Grafana pages that have moved. It only reads the guide, so
+// any signed-in user, or a content repository's CI through a service
+// account token, can call it. valid is false when there are errors.
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+	lintInfo    = "info"
+)
+
+// knownBlockTypes are the block types the frontend renders.
+var knownBlockTypes = map[string]bool{
+	"markdown": true, "html": true, "image": true, "video": true, "assistant": true,
+	"section": true, "collapsible": true, "conditional": true, "interactive": true,
+	"multistep": true, "guided": true, "quiz": true, "input": true, "terminal": true,
+	"terminal-connect": true, "challenge": true, "code-block": true, "grot-guide": true,
+	"snippet-ref": true,
+}
+
+// movedNavItem is a Grafana page that moved; guides that navigate to or
+// highlight the old path break on current versions.
+type movedNavItem struct {
+	Path        string
+	Replacement string
+}
+
+// movedNavItems is the maintained list of moved Grafana pages.
+var movedNavItems = []movedNavItem{
+	{Path: "/datasources", Replacement: "/connections/datasources"},
+	{Path: "/connections/your-connections", Replacement: "/connections/datasources"},
+	{Path: "/connections/connect-data", Replacement: "/connections/add-new-connection"},
+	{Path: "/org/apikeys", Replacement: "/org/serviceaccounts"},
+}
+
+var hrefPattern = regexp.MustCompile(`href=['"]([^'"]+)['"]`)
+
+// lintBlock is the subset of a guide block or step the checks read.
+type lintBlock struct {
+	Type         string `json:"type"`
+	ID           string `json:"id"`
+	Action       string `json:"action"`
+	TargetAction string `json:"targetAction"`
+	Reftarget    string `json:"reftarget"`
+	RefTarget    string `json:"refTarget"`
+	// targetvalue is only here so encoding/json, which matches keys case
+	// insensitively, doesn't read it into TargetValue.
+	Targetvalue   string      `json:"targetvalue"`
+	TargetValue   string      `json:"targetValue"`
+	Verify        string      `json:"verify"`
+	Skippable     bool        `json:"skippable"`
+	Requirements  []string    `json:"requirements"`
+	Conditions    []string    `json:"conditions"`
+	SetupCommands []string    `json:"setupCommands"`
+	Blocks        []lintBlock `json:"blocks"`
+	Steps         []lintBlock `json:"steps"`
+	WhenTrue      []lintBlock `json:"whenTrue"`
+	WhenFalse     []lintBlock `json:"whenFalse"`
+}
+
+// GuideLintRequest is the JSON body for POST /guides/lint: the guide.
+type GuideLintRequest struct {
+	ID     string      `json:"id"`
+	Title  string      `json:"title"`
+	Blocks []lintBlock `json:"blocks"`
+}
+
+// guideLintWarning is one finding; Path locates the block, for example
+// blocks[2].steps[0].
+type guideLintWarning struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+type guideLintResponse struct {
+	Valid    bool               `json:"valid"`
+	Warnings []guideLintWarning `json:"warnings"`
+}
+
+// guideLinter walks a guide in document order.
+type guideLinter struct {
+	warnings []guideLintWarning
+	ids      map[string]string
+	// sections are every section ID in the guide; done are those whose
+	// blocks all come before the block being checked.
+	sections map[string]bool
+	done     map[string]bool
+}
+
+func (l *guideLinter) add(rule, severity, path, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, guideLintWarning{Rule: rule, Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// lintGuide runs every check on g.
+func lintGuide(g GuideLintRequest) guideLintResponse {
+	l := &guideLinter{ids: map[string]string{}, sections: map[string]bool{}, done: map[string]bool{}}
+	if g.ID == "" {
+		l.add("missing-id", lintError, "id", "The guide has no id")
+	}
+	if len(g.Blocks) == 0 {
+		l.add("empty-guide", lintWarning, "blocks", "The guide has no blocks")
+	}
+	collectSections(g.Blocks, l.sections)
+	l.walk(g.Blocks, "blocks", "", false)
+
+	resp := guideLintResponse{Valid: true, Warnings: l.warnings}
+	if resp.Warnings == nil {
+		resp.Warnings = []guideLintWarning{}
+	}
+	rank := map[string]int{lintError: 0, lintWarning: 1, lintInfo: 2}
+	sort.SliceStable(resp.Warnings, func(i, j int) bool { return rank[resp.Warnings[i].Severity] < rank[resp.Warnings[j].Severity] })
+	for _, w := range resp.Warnings {
+		if w.Severity == lintError {
+			resp.Valid = false
+		}
+	}
+	return resp
+}
+
+func collectSections(blocks []lintBlock, sections map[string]bool) {
+	for _, b := range blocks {
+		if b.Type == "section" && b.ID != "" {
+			sections[b.ID] = true
+		}
+		for _, children := range [][]lintBlock{b.Blocks, b.Steps, b.WhenTrue, b.WhenFalse} {
+			collectSections(children, sections)
+		}
+	}
+}
+
+// walk checks blocks, or the steps of a multistep or guided block, at path;
+// section is the enclosing section's ID.
+func (l *guideLinter) walk(blocks []lintBlock, path, section string, steps bool) {
+	for i, b := range blocks {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if !steps && !knownBlockTypes[b.Type] {
+			l.add("unknown-block-type", lintError, p, "Unknown block type %q", b.Type)
+		}
+		if b.ID != "" {
+			if first, ok := l.ids[b.ID]; ok {
+				l.add("duplicate-id", lintError, p, "ID %q is already used at %s", b.ID, first)
+			} else {
+				l.ids[b.ID] = p
+			}
+		}
+		l.checkDeprecated(b, p)
+		l.checkRequirements(b, p, section)
+		l.checkNav(b, p)
+
+		if b.Type == "conditional" && len(b.Conditions) == 0 && len(b.WhenFalse) > 0 {
+			l.add("unreachable-step", lintWarning, p+".whenFalse", "The conditional has no conditions, so whenFalse is never shown")
+		}
+		inner := section
+		if b.Type == "section" {
+			inner = b.ID
+		}
+		l.walk(b.Blocks, p+".blocks", inner, false)
+		l.walk(b.Steps, p+".steps", inner, true)
+		l.walk(b.WhenTrue, p+".whenTrue", inner, false)
+		l.walk(b.WhenFalse, p+".whenFalse", inner, false)
+		if b.Type == "section" && b.ID != "" {
+			l.done[b.ID] = true
+		}
+	}
+}
+
+func (l *guideLinter) checkDeprecated(b lintBlock, p string) {
+	if b.Type == "assistant" {
+		l.add("deprecated", lintWarning, p, "The assistant wrapper block is deprecated; set assistantEnabled on the block instead")
+	}
+	if len(b.SetupCommands) > 0 {
+		l.add("deprecated", lintWarning, p+".setupCommands", "setupCommands is deprecated; use setupScript")
+	}
+	for _, alias := range []struct{ field, canonical, value string }{
+		{"targetAction", "action", b.TargetAction},
+		{"refTarget", "reftarget", b.RefTarget},
+		{"targetValue", "targetvalue", b.TargetValue},
+	} {
+		if alias.value != "" {
+			l.add("deprecated", lintInfo, p+"."+alias.field, "%s is a tolerated alias; use %s", alias.field, alias.canonical)
+		}
+	}
+}
+
+// checkRequirements flags section-completed requirements that can't be met
+// when the step is reached.
+func (l *guideLinter) checkRequirements(b lintBlock, p, section string) {
+	for _, req := range b.Requirements {
+		id, ok := strings.CutPrefix(strings.TrimSpace(req), "section-completed:")
+		if !ok || l.done[id] {
+			continue
+		}
+		severity := lintError
+		if b.Skippable {
+			severity = lintWarning
+		}
+		switch {
+		case !l.sections[id]:
+			l.add("unreachable-step", severity, p, "Requires section %q, which doesn't exist", id)
+		case id == section || id == b.ID:
+			l.add("unreachable-step", severity, p, "Requires section %q, which contains it", id)
+		default:
+			l.add("unreachable-step", severity, p, "Requires section %q, which comes after it", id)
+		}
+	}
+}
+
+// checkNav flags navigation, page checks and highlighted links that use a
+// moved Grafana page.
+func (l *guideLinter) checkNav(b lintBlock, p string) {
+	for _, ref := range navRefs(b) {
+		if item, ok := movedNavItemFor(ref); ok {
+			l.add("moved-nav-item", lintWarning, p, "%s has moved to %s", item.Path, item.Replacement)
+		}
+	}
+}
+
+// navRefs returns the Grafana paths b navigates to, links to in its target
+// or checks with on-page.
+func navRefs(b lintBlock) []string {
+	var refs []string
+	target := b.Reftarget
+	if target == "" {
+		target = b.RefTarget
+	}
+	action := b.Action
+	if action == "" {
+		action = b.TargetAction
+	}
+	if action == "navigate" {
+		refs = append(refs, target)
+	} else {
+		for _, m := range hrefPattern.FindAllStringSubmatch(target, -1) {
+			refs = append(refs, m[1])
+		}
+	}
+	for _, req := range append(append([]string{}, b.Requirements...), b.Verify) {
+		if page, ok := strings.CutPrefix(strings.TrimSpace(req), "on-page:"); ok {
+			refs = append(refs, page)
+		}
+	}
+	return refs
+}
+
+func movedNavItemFor(ref string) (movedNavItem, bool) {
+	path := navPath(ref)
+	for _, item := range movedNavItems {
+		if path == item.Path || strings.HasPrefix(path, item.Path+"/") {
+			return item, true
+		}
+	}
+	return movedNavItem{}, false
+}
+
+// handleGuideLint handles POST /guides/lint.
+func (a *App) handleGuideLint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	var req GuideLintRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	a.writeJSON(w, lintGuide(req), http.StatusOK)
+}
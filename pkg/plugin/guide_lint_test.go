@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLintGuide(t *testing.T) {
+	guide := `{
+		"id": "lint-me",
+		"title": "Lint me",
+		"blocks": [
+			{"type": "markdown", "content": "Intro"},
+			{"type": "section", "id": "setup", "requirements": ["section-completed:later"], "blocks": [
+				{"type": "interactive", "id": "step-1", "action": "navigate", "reftarget": "/datasources/new", "content": "Go"},
+				{"type": "interactive", "id": "step-1", "action": "highlight", "refTarget": "a[href='/connections/connect-data']", "content": "Click"},
+				{"type": "guided", "id": "walk", "content": "Walk", "steps": [
+					{"action": "button", "reftarget": "Save", "requirements": ["section-completed:setup"]}
+				]}
+			]},
+			{"type": "section", "id": "later", "blocks": [
+				{"type": "interactive", "action": "noop", "content": "Done", "requirements": ["section-completed:setup", "on-page:/org/apikeys"]},
+				{"type": "interactive", "action": "noop", "content": "Typo", "skippable": true, "requirements": ["section-completed:stup"]}
+			]},
+			{"type": "conditional", "conditions": [], "whenTrue": [{"type": "markdown", "content": "a"}], "whenFalse": [{"type": "markdown", "content": "b"}]},
+			{"type": "challenge", "title": "C", "brief": "B", "successCriteria": "x", "setupCommands": ["echo"]},
+			{"type": "interactive", "action": "formfill", "reftarget": "input", "targetvalue": "ok", "content": "Fill"},
+			{"type": "flashcard"}
+		]
+	}`
+	var req GuideLintRequest
+	if err := json.Unmarshal([]byte(guide), &req); err != nil {
+		t.Fatal(err)
+	}
+	resp := lintGuide(req)
+	if resp.Valid {
+		t.Error("valid = true, want false")
+	}
+
+	got := map[string]string{}
+	for _, w := range resp.Warnings {
+		got[w.Rule+" "+w.Path] = w.Severity
+	}
+	want := map[string]string{
+		"unreachable-step blocks[1]":                    lintError,
+		"moved-nav-item blocks[1].blocks[0]":            lintWarning,
+		"duplicate-id blocks[1].blocks[1]":              lintError,
+		"moved-nav-item blocks[1].blocks[1]":            lintWarning,
+		"deprecated blocks[1].blocks[1].refTarget":      lintInfo,
+		"unreachable-step blocks[1].blocks[2].steps[0]": lintError,
+		"moved-nav-item blocks[2].blocks[0]":            lintWarning,
+		"unreachable-step blocks[2].blocks[1]":          lintWarning,
+		"unreachable-step blocks[3].whenFalse":          lintWarning,
+		"deprecated blocks[4].setupCommands":            lintWarning,
+		"unknown-block-type blocks[6]":                  lintError,
+	}
+	for key, severity := range want {
+		if got[key] != severity {
+			t.Errorf("%s: severity %q, want %q", key, got[key], severity)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("warnings = %+v", resp.Warnings)
+	}
+	if resp.Warnings[0].Severity != lintError || resp.Warnings[len(resp.Warnings)-1].Severity != lintInfo {
+		t.Errorf("warnings not ordered by severity: %+v", resp.Warnings)
+	}
+}
+
+func TestHandleGuideLint(t *testing.T) {
+	app := newTestApp(t)
+	w := httptest.NewRecorder()
+	app.handleGuideLint(w, roleRequest(http.MethodPost, "/guides/lint", `{"id": "ok", "title": "OK", "blocks": [{"type": "markdown", "content": "Hi"}]}`, "ci-bot", "Viewer"))
+	var resp guideLintResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !resp.Valid || len(resp.Warnings) != 0 {
+		t.Errorf("status %d, %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	app.handleGuideLint(w, roleRequest(http.MethodPost, "/guides/lint", `not json`, "ci-bot", "Viewer"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad body: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,407 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Guide localization.
+//
+// Content managers store translated variants of a custom guide per locale
+// with PUT /guides/{name}/locales/{locale}; a variant is the whole guide
+// JSON in that language, published or a draft. GET /guides/{name}/localized
+// serves the published variant that best matches the learner's language:
+// their Pathfinder content language, then ?language= (the frontend passes
+// Grafana's language setting), then Accept-Language. Learners whose
+// language is the source locale, or has no variant, get 404 and read the
+// original. Guides restricted to teams or folders stay hidden from learners
+// outside them (guide_access.go). GET /guide-locales lists, per guide, the locales
+// Settings.GuideLocales names that have no published variant. A variant the
+// content scan flags is held for admin review (guide_quarantine.go) and the
+// PUT answers 202.
+
+const (
+	guideLocaleCollection  = "guide-locales"
+	maxGuideLocales        = 50
+	defaultGuideLocale     = "en"
+	guideLocalePublished   = "published"
+	guideLocaleDraft       = "draft"
+	maxGuideLocaleListings = 500
+)
+
+// guideLocaleVariant is a guide translated into Locale, keyed guide/locale.
+// Machine marks a draft from machine translation, and Proposal a machine
+// translation awaiting review (guide_translation.go); storing the variant
+// clears both.
+type guideLocaleVariant struct {
+	Guide     string               `json:"guide"`
+	Locale    string               `json:"locale"`
+	Title     string               `json:"title"`
+	Status    string               `json:"status"`
+	Machine   bool                 `json:"machine,omitempty"`
+	Content   json.RawMessage      `json:"content,omitempty"`
+	Proposal  *guideLocaleProposal `json:"proposal,omitempty"`
+	UpdatedBy string               `json:"updatedBy"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// GuideLocaleRequest is the JSON body for PUT
+// /guides/{name}/locales/{locale}. Status defaults to published.
+type GuideLocaleRequest struct {
+	Title   string          `json:"title" validate:"required,max=200"`
+	Status  string          `json:"status,omitempty" validate:"oneof=published draft"`
+	Content json.RawMessage `json:"content" validate:"required,max=1048576"`
+}
+
+// guideLocaleCoverage is one guide's entry in GET /guide-locales.
+type guideLocaleCoverage struct {
+	Guide     string   `json:"guide"`
+	Published []string `json:"published"`
+	Drafts    []string `json:"drafts"`
+	Missing   []string `json:"missing"`
+}
+
+type guideLocaleCoverageResponse struct {
+	SourceLocale string                `json:"sourceLocale"`
+	Locales      []string              `json:"locales"`
+	Guides       []guideLocaleCoverage `json:"guides"`
+}
+
+// canonicalLocale returns tag with the language lower case and regions
+// upper case, such as pt-BR, or "" if it isn't a language tag.
+func canonicalLocale(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if !languageTagPattern.MatchString(tag) {
+		return ""
+	}
+	parts := strings.Split(tag, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	return language
+}
+
+// matchLocale returns the locale in available that best serves the
+// learner's preferred languages, in order: the same tag, else the same
+// language. It returns "" once a preferred language is the source's.
+func matchLocale(preferred, available []string, source string) string {
+	for _, p := range preferred {
+		if p == "" {
+			continue
+		}
+		if slices.Contains(available, p) {
+			return p
+		}
+		if localeLanguage(p) == localeLanguage(source) {
+			return ""
+		}
+		for _, locale := range available {
+			if localeLanguage(locale) == localeLanguage(p) {
+				return locale
+			}
+		}
+	}
+	return ""
+}
+
+// preferredLocales returns the caller's languages, most preferred first.
+func (a *App) preferredLocales(r *http.Request, user string) []string {
+	var prefs UserPreferences
+	_, _ = a.store.get(preferencesCollection, user, &prefs)
+	preferred := []string{canonicalLocale(prefs.ContentLanguage), canonicalLocale(r.URL.Query().Get("language"))}
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		preferred = append(preferred, canonicalLocale(tag))
+	}
+	return preferred
+}
+
+// guideSourceLocale is the language guides are written in.
+func (a *App) guideSourceLocale() string {
+	if a.settings != nil {
+		if locale := canonicalLocale(a.settings.GuideSourceLocale); locale != "" {
+			return locale
+		}
+	}
+	return defaultGuideLocale
+}
+
+// guideLocaleVariants returns guide's variants by locale, or every guide's
+// when guide is "".
+func (a *App) guideLocaleVariants(guide string) []guideLocaleVariant {
+	variants := []guideLocaleVariant{}
+	for _, key := range a.store.keys(guideLocaleCollection) {
+		if guide != "" && !strings.HasPrefix(key, guide+"/") {
+			continue
+		}
+		var v guideLocaleVariant
+		if ok, err := a.store.get(guideLocaleCollection, key, &v); err == nil && ok {
+			variants = append(variants, v)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		if variants[i].Guide != variants[j].Guide {
+			return variants[i].Guide < variants[j].Guide
+		}
+		return variants[i].Locale < variants[j].Locale
+	})
+	return variants
+}
+
+// handleGuideLocales handles GET /guides/{name}/locales, and GET, PUT and
+// DELETE /guides/{name}/locales/{locale}. Drafts are only visible to
+// editors, who are the only ones who can change variants.
+func (a *App) handleGuideLocales(w http.ResponseWriter, r *http.Request, guide, locale string) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	editor := userCanEditFromContext(ctx)
+	if !editor && !a.newGuideAccessChecker(ctx).canView(guide) {
+		a.writeError(w, "Guide not found", http.StatusNotFound)
+		return
+	}
+
+	if locale == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		variants := []guideLocaleVariant{}
+		for _, v := range a.guideLocaleVariants(guide) {
+			if editor || v.Status == guideLocalePublished {
+				v.Content = nil
+				if v.Proposal != nil && editor {
+					v.Proposal = &guideLocaleProposal{Title: v.Proposal.Title, TranslatedAt: v.Proposal.TranslatedAt}
+				} else {
+					v.Proposal = nil
+				}
+				variants = append(variants, v)
+			}
+		}
+		a.writeJSON(w, map[string]interface{}{"sourceLocale": a.guideSourceLocale(), "locales": variants}, http.StatusOK)
+		return
+	}
+
+	canonical := canonicalLocale(locale)
+	if canonical == "" {
+		a.writeError(w, "Locale must be a language tag such as en or pt-BR", http.StatusBadRequest)
+		return
+	}
+	key := guide + "/" + canonical
+	switch r.Method {
+	case http.MethodGet:
+		var v guideLocaleVariant
+		ok, err := a.store.get(guideLocaleCollection, key, &v)
+		if err != nil {
+			a.ctxLogger(ctx).Error("Failed to load guide locale", "guide", guide, "locale", canonical, "error", err)
+			a.writeError(w, "Failed to load the translation", http.StatusInternalServerError)
+			return
+		}
+		if !ok || (!editor && v.Status != guideLocalePublished) {
+			a.writeError(w, "Translation not found", http.StatusNotFound)
+			return
+		}
+		if !editor {
+			v.Proposal = nil
+		}
+		a.writeJSON(w, v, http.StatusOK)
+	case http.MethodPut:
+		if !editor {
+			a.writeError(w, "Only editors and admins can change translations", http.StatusForbidden)
+			return
+		}
+		var req GuideLocaleRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if !strings.HasPrefix(strings.TrimSpace(string(req.Content)), "{") {
+			a.writeError(w, "content must be the guide's JSON object", http.StatusBadRequest)
+			return
+		}
+		if canonical == a.guideSourceLocale() {
+			a.writeError(w, fmt.Sprintf("%s is the source locale; edit the guide itself", canonical), http.StatusBadRequest)
+			return
+		}
+		if req.Status == "" {
+			req.Status = guideLocalePublished
+		}
+		a.guideLocalesMu.Lock()
+		defer a.guideLocalesMu.Unlock()
+		if findings := a.guideScanner().scan(req.Content); len(findings) > 0 {
+			q := quarantinedGuide{
+				Guide: guide, Locale: canonical, Source: quarantineSourceUpload, Title: req.Title, Status: req.Status,
+				Content: req.Content, Findings: findings, SubmittedBy: user, SubmittedAt: timeNow().UTC(),
+			}
+			if err := a.quarantineGuide(q); err != nil {
+				a.ctxLogger(ctx).Error("Failed to quarantine guide locale", "guide", guide, "locale", canonical, "error", err)
+				a.writeError(w, "Failed to store the translation", http.StatusInternalServerError)
+				return
+			}
+			a.ctxLogger(ctx).Warn("Quarantined a flagged translation for admin review", "guide", guide, "locale", canonical, "findings", len(findings))
+			q.Content = nil
+			a.writeJSON(w, q, http.StatusAccepted)
+			return
+		}
+		var existing guideLocaleVariant
+		exists, err := a.store.get(guideLocaleCollection, key, &existing)
+		if err == nil && !exists && len(a.guideLocaleVariants(guide)) >= maxGuideLocales {
+			a.writeError(w, fmt.Sprintf("A guide can have at most %d translations", maxGuideLocales), http.StatusConflict)
+			return
+		}
+		v := guideLocaleVariant{Guide: guide, Locale: canonical, Title: req.Title, Status: req.Status, Content: req.Content, UpdatedBy: user, UpdatedAt: timeNow().UTC()}
+		if err := a.store.put(guideLocaleCollection, key, v); err != nil {
+			a.ctxLogger(ctx).Error("Failed to store guide locale", "guide", guide, "locale", canonical, "error", err)
+			a.writeError(w, "Failed to store the translation", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, v, http.StatusOK)
+	case http.MethodDelete:
+		if !editor {
+			a.writeError(w, "Only editors and admins can change translations", http.StatusForbidden)
+			return
+		}
+		a.guideLocalesMu.Lock()
+		defer a.guideLocalesMu.Unlock()
+		if ok, err := a.store.get(guideLocaleCollection, key, &guideLocaleVariant{}); err == nil && !ok {
+			a.writeError(w, "Translation not found", http.StatusNotFound)
+			return
+		}
+		if err := a.store.delete(guideLocaleCollection, key); err != nil {
+			a.ctxLogger(ctx).Error("Failed to delete guide locale", "guide", guide, "locale", canonical, "error", err)
+			a.writeError(w, "Failed to delete the translation", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLocalizedGuide handles GET /guides/{name}/localized.
+func (a *App) handleLocalizedGuide(w http.ResponseWriter, r *http.Request, guide string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	if !a.newGuideAccessChecker(r.Context()).canView(guide) {
+		a.writeError(w, "Guide not found", http.StatusNotFound)
+		return
+	}
+	published := map[string]guideLocaleVariant{}
+	var available []string
+	for _, v := range a.guideLocaleVariants(guide) {
+		if v.Status == guideLocalePublished {
+			published[v.Locale] = v
+			available = append(available, v.Locale)
+		}
+	}
+	locale := matchLocale(a.preferredLocales(r, user), available, a.guideSourceLocale())
+	if locale == "" {
+		a.writeError(w, "No translation matches your language", http.StatusNotFound)
+		return
+	}
+	v := published[locale]
+	v.Proposal = nil
+	w.Header().Set("Content-Language", locale)
+	a.writeJSON(w, v, http.StatusOK)
+}
+
+// handleGuideLocaleCoverage handles GET /guide-locales for editors: the
+// translation state of every guide with a variant, and of each ?guide=.
+func (a *App) handleGuideLocaleCoverage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if userLoginFromContext(ctx) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can view translation coverage", http.StatusForbidden)
+		return
+	}
+	requested := r.URL.Query()["guide"]
+	if len(requested) > maxGuideLocaleListings {
+		a.writeError(w, fmt.Sprintf("At most %d guides can be requested", maxGuideLocaleListings), http.StatusBadRequest)
+		return
+	}
+	coverage := map[string]*guideLocaleCoverage{}
+	entry := func(guide string) *guideLocaleCoverage {
+		if c, ok := coverage[guide]; ok {
+			return c
+		}
+		c := &guideLocaleCoverage{Guide: guide, Published: []string{}, Drafts: []string{}, Missing: []string{}}
+		coverage[guide] = c
+		return c
+	}
+	for _, guide := range requested {
+		if !guideIDPattern.MatchString(guide) {
+			a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+			return
+		}
+		entry(guide)
+	}
+	for _, v := range a.guideLocaleVariants("") {
+		c := entry(v.Guide)
+		if v.Status == guideLocalePublished {
+			c.Published = append(c.Published, v.Locale)
+		} else {
+			c.Drafts = append(c.Drafts, v.Locale)
+		}
+	}
+
+	source := a.guideSourceLocale()
+	locales := []string{}
+	if a.settings != nil {
+		for _, l := range a.settings.GuideLocales {
+			if l = canonicalLocale(l); l != "" && l != source && !slices.Contains(locales, l) {
+				locales = append(locales, l)
+			}
+		}
+	}
+	resp := guideLocaleCoverageResponse{SourceLocale: source, Locales: locales, Guides: []guideLocaleCoverage{}}
+	for _, c := range coverage {
+		for _, l := range locales {
+			if !slices.Contains(c.Published, l) {
+				c.Missing = append(c.Missing, l)
+			}
+		}
+		resp.Guides = append(resp.Guides, *c)
+	}
+	sort.Slice(resp.Guides, func(i, j int) bool { return resp.Guides[i].Guide < resp.Guides[j].Guide })
+	a.writeJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGuideLocales(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	app := newTestApp(t)
+	app.settings = &Settings{GuideLocales: []string{"es", "pt-br", "ja"}}
+	serve := func(method, target, body, user, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleGuideByName(w, roleRequest(method, target, body, user, role))
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/guides/intro/locales/es", `{"title": "Introducción", "content": {"blocks": []}}`, "vic", "Viewer"); w.Code != http.StatusForbidden {
+		t.Errorf("viewer PUT: status %d, want 403", w.Code)
+	}
+	if w := serve(http.MethodPut, "/guides/intro/locales/en", `{"title": "Intro", "content": {"blocks": []}}`, "ed", "Editor"); w.Code != http.StatusBadRequest {
+		t.Errorf("source locale PUT: status %d, want 400", w.Code)
+	}
+	if w := serve(http.MethodPut, "/guides/intro/locales/es", `{"title": "Introducción", "content": "text"}`, "ed", "Editor"); w.Code != http.StatusBadRequest {
+		t.Errorf("non-object content: status %d, want 400", w.Code)
+	}
+	if w := serve(http.MethodPut, "/guides/intro/locales/es", `{"title": "Introducción", "content": {"blocks": []}}`, "ed", "Editor"); w.Code != http.StatusOK {
+		t.Fatalf("PUT es: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodPut, "/guides/intro/locales/pt_br", `{"title": "Introdução", "status": "draft", "content": {"blocks": []}}`, "ed", "Editor"); w.Code != http.StatusOK {
+		t.Fatalf("PUT pt-BR: status %d: %s", w.Code, w.Body)
+	}
+
+	var list struct {
+		Locales []guideLocaleVariant `json:"locales"`
+	}
+	if err := json.Unmarshal(serve(http.MethodGet, "/guides/intro/locales", "", "vic", "Viewer").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Locales) != 1 || list.Locales[0].Locale != "es" || list.Locales[0].Content != nil {
+		t.Errorf("viewer list = %+v", list.Locales)
+	}
+	if w := serve(http.MethodGet, "/guides/intro/locales/pt-BR", "", "vic", "Viewer"); w.Code != http.StatusNotFound {
+		t.Errorf("viewer draft GET: status %d, want 404", w.Code)
+	}
+	if w := serve(http.MethodGet, "/guides/intro/locales/pt-BR", "", "ed", "Editor"); w.Code != http.StatusOK {
+		t.Errorf("editor draft GET: status %d", w.Code)
+	}
+
+	localized := func(target, acceptLanguage string) (int, string) {
+		t.Helper()
+		r := roleRequest(http.MethodGet, target, "", "vic", "Viewer")
+		if acceptLanguage != "" {
+			r.Header.Set("Accept-Language", acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		app.handleGuideByName(w, r)
+		return w.Code, w.Header().Get("Content-Language")
+	}
+	if code, locale := localized("/guides/intro/localized?language=es-MX", ""); code != http.StatusOK || locale != "es" {
+		t.Errorf("es-MX: %d %q", code, locale)
+	}
+	if code, _ := localized("/guides/intro/localized?language=pt-BR", ""); code != http.StatusNotFound {
+		t.Errorf("draft only: status %d, want 404", code)
+	}
+	if code, _ := localized("/guides/intro/localized", "en-GB,es;q=0.8"); code != http.StatusNotFound {
+		t.Errorf("source language first: status %d, want 404", code)
+	}
+	if code, locale := localized("/guides/intro/localized", "fr,es;q=0.8"); code != http.StatusOK || locale != "es" {
+		t.Errorf("Accept-Language fallback: %d %q", code, locale)
+	}
+	_ = app.store.put(preferencesCollection, "vic", UserPreferences{ContentLanguage: "en"})
+	if code, _ := localized("/guides/intro/localized?language=es", ""); code != http.StatusNotFound {
+		t.Errorf("content language preference: status %d, want 404", code)
+	}
+
+	w := httptest.NewRecorder()
+	app.handleGuideLocaleCoverage(w, roleRequest(http.MethodGet, "/guide-locales?guide=intro&guide=setup", "", "ed", "Editor"))
+	var coverage guideLocaleCoverageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &coverage); err != nil {
+		t.Fatal(err)
+	}
+	if coverage.SourceLocale != "en" || len(coverage.Locales) != 3 || len(coverage.Guides) != 2 {
+		t.Fatalf("coverage = %+v", coverage)
+	}
+	intro, setup := coverage.Guides[0], coverage.Guides[1]
+	if len(intro.Published) != 1 || len(intro.Drafts) != 1 || len(intro.Missing) != 2 || intro.Missing[0] != "pt-BR" || intro.Missing[1] != "ja" {
+		t.Errorf("intro coverage = %+v", intro)
+	}
+	if len(setup.Missing) != 3 {
+		t.Errorf("setup coverage = %+v", setup)
+	}
+
+	if w := serve(http.MethodDelete, "/guides/intro/locales/es", "", "ed", "Editor"); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/guides/intro/locales/es", "", "ed", "Editor"); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE: status %d, want 404", w.Code)
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	available := []string{"de", "pt-BR", "pt-PT", "zh-Hans"}
+	for _, tc := range []struct {
+		preferred []string
+		want      string
+	}{
+		{[]string{"pt-PT"}, "pt-PT"},
+		{[]string{"pt"}, "pt-BR"},
+		{[]string{"de-AT"}, "de"},
+		{[]string{"", "fr", "zh-Hans"}, "zh-Hans"},
+		{[]string{"en-US", "de"}, ""},
+		{[]string{"fr"}, ""},
+	} {
+		if got := matchLocale(tc.preferred, available, "en"); got != tc.want {
+			t.Errorf("matchLocale(%v) = %q, want %q", tc.preferred, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/config"
+)
+
+// Guide prerequisite checks for POST /guides/{name}/prerequisites.
+//
+// Before a learner starts a guide, the frontend sends the guide's declared
+// requirements, in the same syntax as step requirements, and shows what's
+// missing with a way to fix it. The backend evaluates the ones it can
+// against the live instance:
+//
+//   - has-plugin:<id>        the plugin is installed
+//   - plugin-enabled:<id>    the plugin is installed and enabled
+//   - has-datasource:<x>     a data source with that name or type exists
+//   - min-version:<version>  Grafana is at least that version
+//   - has-feature:<toggle>   the feature toggle is enabled
+//
+// Anything else (page state, roles, variables) depends on the browser and is
+// reported as unknown, as are checks the plugin can't make on this instance.
+// Unknown results don't block: ready is false only when a check fails.
+
+const (
+	prerequisitePass    = "pass"
+	prerequisiteFail    = "fail"
+	prerequisiteUnknown = "unknown"
+)
+
+type prerequisitesRequest struct {
+	Requirements []string `json:"requirements" validate:"required,min=1,max=50,each,required,max=300"`
+}
+
+// prerequisiteResult is the outcome of one requirement. Action and Href, set
+// on failures, tell the frontend how to fix it.
+type prerequisiteResult struct {
+	Requirement string `json:"requirement"`
+	Status      string `json:"status"`
+	Message     string `json:"message,omitempty"`
+	Action      string `json:"action,omitempty"`
+	Href        string `json:"href,omitempty"`
+}
+
+type prerequisitesResponse struct {
+	Guide          string               `json:"guide"`
+	Ready          bool                 `json:"ready"`
+	GrafanaVersion string               `json:"grafanaVersion,omitempty"`
+	Results        []prerequisiteResult `json:"results"`
+}
+
+// handleGuidePrerequisites handles POST /guides/{name}/prerequisites.
+func (a *App) handleGuidePrerequisites(w http.ResponseWriter, r *http.Request, guide string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	var req prerequisitesRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+
+	c := &prerequisiteChecker{ctx: r.Context(), plugins: map[string]*grafanaPluginSettings{}}
+	c.api, c.apiErr = resolveGrafanaAPI(r.Context())
+	resp := prerequisitesResponse{Guide: guide, Ready: true, Results: make([]prerequisiteResult, 0, len(req.Requirements))}
+	resp.GrafanaVersion, _ = grafanaVersionFromContext(r.Context())
+	for _, requirement := range req.Requirements {
+		result := c.check(strings.TrimSpace(requirement))
+		if result.Status == prerequisiteFail {
+			resp.Ready = false
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	if c.apiErr != nil {
+		a.ctxLogger(r.Context()).Debug("Prerequisite checks without Grafana API", "guide", guide, "error", c.apiErr)
+	}
+	a.writeJSON(w, resp, http.StatusOK)
+}
+
+// prerequisiteChecker evaluates the requirements of one request, fetching
+// each plugin's settings and the data source list at most once.
+type prerequisiteChecker struct {
+	ctx         context.Context
+	api         grafanaAPI
+	apiErr      error
+	plugins     map[string]*grafanaPluginSettings
+	datasources []grafanaDatasource
+	fetchedDS   bool
+}
+
+func (c *prerequisiteChecker) check(requirement string) prerequisiteResult {
+	result := prerequisiteResult{Requirement: requirement, Status: prerequisiteUnknown}
+	kind, arg, _ := strings.Cut(requirement, ":")
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		result.Message = "Checked in the browser when the guide runs"
+		return result
+	}
+
+	switch kind {
+	case "has-plugin", "plugin-enabled":
+		settings, err := c.plugin(arg)
+		switch {
+		case err != nil:
+			result.Message = "Could not check plugins on this instance"
+		case settings == nil:
+			result.Status = prerequisiteFail
+			result.Message = fmt.Sprintf("Plugin %s is not installed", arg)
+			result.Action = "install-plugin"
+			result.Href = "/plugins/" + url.PathEscape(arg)
+		case kind == "plugin-enabled" && !settings.Enabled:
+			result.Status = prerequisiteFail
+			result.Message = fmt.Sprintf("Plugin %s is installed but not enabled", arg)
+			result.Action = "enable-plugin"
+			result.Href = "/plugins/" + url.PathEscape(arg)
+		default:
+			result.Status = prerequisitePass
+		}
+	case "has-datasource":
+		datasources, err := c.listDatasources()
+		switch {
+		case err != nil:
+			result.Message = "Could not check data sources on this instance"
+		case hasDatasource(datasources, arg):
+			result.Status = prerequisitePass
+		default:
+			result.Status = prerequisiteFail
+			result.Message = fmt.Sprintf("No data source named %s or of type %s", arg, arg)
+			result.Action = "add-datasource"
+			result.Href = "/connections/datasources/new"
+		}
+	case "min-version":
+		required, ok := parseVersion(arg)
+		if !ok {
+			result.Message = fmt.Sprintf("%q is not a version", arg)
+			break
+		}
+		version, ok := grafanaVersionFromContext(c.ctx)
+		if !ok {
+			result.Message = "Could not determine the Grafana version"
+			break
+		}
+		current, _ := parseVersion(version)
+		if compareVersions(current, required) >= 0 {
+			result.Status = prerequisitePass
+			break
+		}
+		result.Status = prerequisiteFail
+		result.Message = fmt.Sprintf("Requires Grafana %s or later; this instance runs %s", arg, version)
+		result.Action = "upgrade-grafana"
+	case "has-feature":
+		cfg := config.GrafanaConfigFromContext(c.ctx)
+		if cfg == nil {
+			result.Message = "Could not read this instance's feature toggles"
+			break
+		}
+		if cfg.FeatureToggles().IsEnabled(arg) {
+			result.Status = prerequisitePass
+			break
+		}
+		result.Status = prerequisiteFail
+		result.Message = fmt.Sprintf("Feature toggle %s is not enabled", arg)
+		result.Action = "enable-feature-toggle"
+	default:
+		result.Message = "Checked in the browser when the guide runs"
+	}
+	return result
+}
+
+func (c *prerequisiteChecker) plugin(id string) (*grafanaPluginSettings, error) {
+	if c.apiErr != nil {
+		return nil, c.apiErr
+	}
+	if settings, ok := c.plugins[id]; ok {
+		return settings, nil
+	}
+	settings, err := c.api.PluginSettings(c.ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.plugins[id] = settings
+	return settings, nil
+}
+
+func (c *prerequisiteChecker) listDatasources() ([]grafanaDatasource, error) {
+	if c.apiErr != nil {
+		return nil, c.apiErr
+	}
+	if !c.fetchedDS {
+		datasources, err := c.api.ListDatasources(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.datasources, c.fetchedDS = datasources, true
+	}
+	return c.datasources, nil
+}
+
+// hasDatasource matches want against data source names and types, also
+// trying types without their "grafana-" prefix and "-datasource" suffix, as
+// the frontend's has-datasource check does.
+func hasDatasource(datasources []grafanaDatasource, want string) bool {
+	want = strings.ToLower(want)
+	for _, ds := range datasources {
+		typ := strings.ToLower(ds.Type)
+		if strings.ToLower(ds.Name) == want || typ == want || shortDatasourceType(typ) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// shortDatasourceType strips the "grafana-" prefix and "-datasource" suffix
+// from a data source type, so "grafana-testdata-datasource" is "testdata".
+func shortDatasourceType(typ string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(typ), "grafana-"), "-datasource")
+}
@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/useragent"
+	sdkconfig "github.com/grafana/grafana-plugin-sdk-go/config"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/featuretoggles"
+)
+
+// withGrafanaVersion returns r as sent by a Grafana running version.
+func withGrafanaVersion(t *testing.T, r *http.Request, version string) *http.Request {
+	t.Helper()
+	ua, err := useragent.New(version, "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.WithContext(backend.WithUserAgent(r.Context(), ua))
+}
+
+// prerequisitesRequestFor builds a prerequisites request from an instance
+// running version with the given feature toggles enabled.
+func prerequisitesRequestFor(t *testing.T, body, version, toggles string) *http.Request {
+	t.Helper()
+	r := withGrafanaVersion(t, roleRequest(http.MethodPost, "/v1/guides/otel-intro/prerequisites", body, "ana", "Viewer"), version)
+	ctx := sdkconfig.WithGrafanaConfig(r.Context(), sdkconfig.NewGrafanaCfg(map[string]string{featuretoggles.EnabledFeatures: toggles}))
+	return r.WithContext(ctx)
+}
+
+func TestGuidePrerequisites(t *testing.T) {
+	api := &fakeGrafanaAPI{
+		plugins: map[string]*grafanaPluginSettings{
+			"grafana-clock-panel": {ID: "grafana-clock-panel", Enabled: true},
+			"grafana-k8s-app":     {ID: "grafana-k8s-app", Enabled: false},
+		},
+		datasources: []grafanaDatasource{{Name: "Metrics", Type: "prometheus"}, {Name: "TestData", Type: "grafana-testdata-datasource"}},
+	}
+	useFakeGrafanaAPI(t, api)
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	body := `{"requirements": [
+		"has-plugin:grafana-clock-panel", "has-plugin:grafana-polystat-panel", "plugin-enabled:grafana-k8s-app",
+		"has-datasource:prometheus", "has-datasource:testdata", "has-datasource:loki",
+		"min-version:11.0.0", "min-version:13.0",
+		"has-feature:publicDashboards", "has-feature:kubernetesDashboards",
+		"on-page:/dashboards", "plugin-enabled:grafana-clock-panel"
+	]}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, prerequisitesRequestFor(t, body, "12.3.1", "publicDashboards"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp prerequisitesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Ready || resp.GrafanaVersion != "12.3.1" {
+		t.Errorf("ready=%v version=%q", resp.Ready, resp.GrafanaVersion)
+	}
+	want := []struct{ status, action string }{
+		{prerequisitePass, ""},
+		{prerequisiteFail, "install-plugin"},
+		{prerequisiteFail, "enable-plugin"},
+		{prerequisitePass, ""},
+		{prerequisitePass, ""},
+		{prerequisiteFail, "add-datasource"},
+		{prerequisitePass, ""},
+		{prerequisiteFail, "upgrade-grafana"},
+		{prerequisitePass, ""},
+		{prerequisiteFail, "enable-feature-toggle"},
+		{prerequisiteUnknown, ""},
+		{prerequisitePass, ""},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(resp.Results), len(want))
+	}
+	for i, res := range resp.Results {
+		if res.Status != want[i].status || res.Action != want[i].action {
+			t.Errorf("%s: status=%s action=%q, want %s %q", res.Requirement, res.Status, res.Action, want[i].status, want[i].action)
+		}
+	}
+	// Three plugins and one data source list, each fetched once.
+	if api.calls != 4 {
+		t.Errorf("Grafana API called %d times, want 4", api.calls)
+	}
+}
+
+func TestGuidePrerequisites_APIUnavailable(t *testing.T) {
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{err: errors.New("connection refused")})
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, prerequisitesRequestFor(t, `{"requirements": ["has-plugin:grafana-clock-panel", "has-datasource:loki"]}`, "12.3.1", ""))
+	var resp prerequisitesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Ready {
+		t.Error("unknown results blocked the guide")
+	}
+	for _, res := range resp.Results {
+		if res.Status != prerequisiteUnknown {
+			t.Errorf("%s: status=%s, want unknown", res.Requirement, res.Status)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, prerequisitesRequestFor(t, `{"requirements": []}`, "12.3.1", ""))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty requirements: status=%d", w.Code)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for v, want := range map[string][3]int{
+		"12.3.0":        {12, 3, 0},
+		"12.3.0-pre":    {12, 3, 0},
+		"v11.1":         {11, 1, 0},
+		"10":            {10, 0, 0},
+		"12.4.0+build1": {12, 4, 0},
+	} {
+		got, ok := parseVersion(v)
+		if !ok || got != want {
+			t.Errorf("parseVersion(%q) = %v, %v", v, got, ok)
+		}
+	}
+	for _, v := range []string{"", "latest", "1.2.3.4", "1.x"} {
+		if _, ok := parseVersion(v); ok {
+			t.Errorf("parseVersion(%q) accepted", v)
+		}
+	}
+}
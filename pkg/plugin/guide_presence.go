@@ -0,0 +1,271 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Collaborative guide presence over Grafana Live.
+//
+// Channel path: presence/{guideId} for everyone in the org, or
+// presence/{guideId}/{workshop} for one workshop's participants.
+//
+// Subscribers publish their position in the guide and the backend fans the
+// channel's member list out to every subscriber as a "presence" message.
+// The backend stamps each update with the publisher's login and name, so
+// nobody can appear as someone else. Live channels are already scoped to
+// the org; workshop channels are further limited to the workshop's creator,
+// its roster and claimers, and admins. A member is dropped when their last
+// stream on the channel closes, when they publish status "left", or after
+// presenceTTL without an update. Presence is held in memory only.
+
+const (
+	presenceChannelPrefix = "presence"
+	presenceTTL           = 2 * time.Minute
+	maxPresenceMembers    = 200
+
+	presenceViewing   = "viewing"
+	presenceCompleted = "completed"
+	presenceLeft      = "left"
+)
+
+// guidePresence is one member's position in a guide.
+type guidePresence struct {
+	Login      string    `json:"login"`
+	Name       string    `json:"name,omitempty"`
+	Step       string    `json:"step,omitempty"`
+	StepIndex  int       `json:"stepIndex"`
+	TotalSteps int       `json:"totalSteps,omitempty"`
+	Status     string    `json:"status"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// presenceUpdate is what a subscriber publishes on a presence channel.
+type presenceUpdate struct {
+	Step       string `json:"step,omitempty" validate:"max=200"`
+	StepIndex  int    `json:"stepIndex,omitempty" validate:"min=0,max=1000"`
+	TotalSteps int    `json:"totalSteps,omitempty" validate:"min=0,max=1000"`
+	Status     string `json:"status,omitempty" validate:"oneof=viewing completed left"`
+}
+
+// presenceChannel is the member list of one presence channel.
+type presenceChannel struct {
+	fanout *outputFanout
+
+	mu      sync.Mutex
+	members map[string]guidePresence
+	streams map[string]int // open streams per login
+}
+
+// parsePresenceChannel extracts the guide and optional workshop from a
+// presence channel path.
+func parsePresenceChannel(channelPath string) (guide, workshop string, ok bool) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != presenceChannelPrefix || !guideIDPattern.MatchString(parts[1]) {
+		return "", "", false
+	}
+	if len(parts) == 3 {
+		if !workspaceNamePattern.MatchString(parts[2]) {
+			return "", "", false
+		}
+		workshop = parts[2]
+	}
+	return parts[1], workshop, true
+}
+
+// presenceAllowed reports whether the user may join a presence channel.
+func (a *App) presenceAllowed(pCtx backend.PluginContext, workshopName string) bool {
+	login := pluginUserLogin(pCtx)
+	if login == "" {
+		return false
+	}
+	if workshopName == "" || pluginUserIsAdmin(pCtx) {
+		return true
+	}
+	ws, ok := a.getWorkshop(workshopName)
+	if !ok {
+		return false
+	}
+	if ws.CreatedBy == login {
+		return true
+	}
+	for _, vm := range ws.VMs {
+		if vm.ClaimedBy == login || vm.AssignedTo == login || (pCtx.User.Email != "" && strings.EqualFold(vm.AssignedTo, pCtx.User.Email)) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinPresence registers a stream for login on path and returns its
+// channel, creating the channel if needed.
+func (a *App) joinPresence(path, login string) *presenceChannel {
+	a.presenceMu.Lock()
+	defer a.presenceMu.Unlock()
+	if a.presence == nil {
+		a.presence = make(map[string]*presenceChannel)
+	}
+	c, ok := a.presence[path]
+	if !ok {
+		c = &presenceChannel{
+			fanout:  newOutputFanout(),
+			members: make(map[string]guidePresence),
+			streams: make(map[string]int),
+		}
+		a.presence[path] = c
+	}
+	c.mu.Lock()
+	c.streams[login]++
+	c.mu.Unlock()
+	return c
+}
+
+// leavePresence unregisters a stream for login. When it was their last, the
+// member is dropped; when it was the channel's last, the channel goes too.
+// It reports whether the member was dropped.
+func (a *App) leavePresence(path, login string, c *presenceChannel) bool {
+	a.presenceMu.Lock()
+	defer a.presenceMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streams[login]--
+	if c.streams[login] > 0 {
+		return false
+	}
+	delete(c.streams, login)
+	delete(c.members, login)
+	if len(c.streams) == 0 && a.presence[path] == c {
+		delete(a.presence, path)
+	}
+	return true
+}
+
+func (a *App) getPresenceChannel(path string) *presenceChannel {
+	a.presenceMu.Lock()
+	defer a.presenceMu.Unlock()
+	return a.presence[path]
+}
+
+// snapshot returns the live members ordered by login, dropping expired ones.
+func (c *presenceChannel) snapshot() []guidePresence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := timeNow()
+	members := make([]guidePresence, 0, len(c.members))
+	for login, m := range c.members {
+		if now.Sub(m.UpdatedAt) > presenceTTL {
+			delete(c.members, login)
+			continue
+		}
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Login < members[j].Login })
+	return members
+}
+
+func (c *presenceChannel) announce() {
+	c.fanout.send(TerminalStreamOutput{Type: "presence", Presence: c.snapshot()})
+}
+
+// update applies a member's update and reports whether it was accepted.
+func (c *presenceChannel) update(m guidePresence) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m.Status == presenceLeft {
+		delete(c.members, m.Login)
+		return true
+	}
+	if _, known := c.members[m.Login]; !known && len(c.members) >= maxPresenceMembers {
+		return false
+	}
+	c.members[m.Login] = m
+	return true
+}
+
+// subscribePresenceStream accepts members of the channel's org or workshop.
+func (a *App) subscribePresenceStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	_, workshop, ok := parsePresenceChannel(req.Path)
+	if !ok {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if !a.presenceAllowed(req.PluginContext, workshop) {
+		a.ctxLogger(ctx).Info("Presence subscription denied", "path", req.Path, "user", pluginUserLogin(req.PluginContext))
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runPresenceStream sends the member list to this stream's subscriber until
+// the stream closes, then drops the subscriber if it was their last stream.
+func (a *App) runPresenceStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	if _, _, ok := parsePresenceChannel(req.Path); !ok {
+		sendStreamError(ctx, sender, "Invalid presence channel")
+		return nil
+	}
+	login := pluginUserLogin(req.PluginContext)
+	c := a.joinPresence(req.Path, login)
+	defer func() {
+		if a.leavePresence(req.Path, login, c) {
+			c.announce()
+		}
+	}()
+
+	runFanoutStream(ctx, sender, c.fanout, "Guide presence ended", TerminalStreamOutput{Type: "presence", Presence: c.snapshot()})
+	return nil
+}
+
+// publishPresenceStream records the publisher's position and fans the
+// member list out to the channel. Only channels with an open stream accept
+// updates.
+func (a *App) publishPresenceStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	_, workshop, ok := parsePresenceChannel(req.Path)
+	if !ok {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+	if !a.presenceAllowed(req.PluginContext, workshop) {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+	c := a.getPresenceChannel(req.Path)
+	if c == nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+	update, err := decodePresenceUpdate(req.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid presence update: %w", err)
+	}
+	if update.Status == "" {
+		update.Status = presenceViewing
+	}
+
+	accepted := c.update(guidePresence{
+		Login:      pluginUserLogin(req.PluginContext),
+		Name:       req.PluginContext.User.Name,
+		Step:       update.Step,
+		StepIndex:  update.StepIndex,
+		TotalSteps: update.TotalSteps,
+		Status:     update.Status,
+		UpdatedAt:  timeNow().UTC(),
+	})
+	if !accepted {
+		a.ctxLogger(ctx).Warn("Presence channel full", "path", req.Path, "members", maxPresenceMembers)
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+	c.announce()
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
+}
+
+// stopAllPresence ends every presence channel; used on dispose.
+func (a *App) stopAllPresence() {
+	a.presenceMu.Lock()
+	defer a.presenceMu.Unlock()
+	for path, c := range a.presence {
+		c.fanout.stop()
+		delete(a.presence, path)
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParsePresenceChannel(t *testing.T) {
+	if guide, ws, ok := parsePresenceChannel("presence/alerting-101"); !ok || guide != "alerting-101" || ws != "" {
+		t.Errorf("org channel: %q %q %v", guide, ws, ok)
+	}
+	if guide, ws, ok := parsePresenceChannel("presence/alerting-101/obs-101"); !ok || guide != "alerting-101" || ws != "obs-101" {
+		t.Errorf("workshop channel: %q %q %v", guide, ws, ok)
+	}
+	for _, p := range []string{"presence", "presence/", "presence/a b", "presence/g/Bad_Name", "presence/g/w/x", "broadcast/g"} {
+		if _, _, ok := parsePresenceChannel(p); ok {
+			t.Errorf("%q: expected rejection", p)
+		}
+	}
+}
+
+func TestSubscribePresenceStream_Workshop(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.store.put(workshopCollection, "obs-101", workshop{Name: "obs-101", CreatedBy: "root", VMs: []workshopVM{
+		{VMID: "vm-1", ClaimedBy: "ana"},
+		{AssignedTo: "bo@example.com"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		user *backend.User
+		want backend.SubscribeStreamStatus
+	}{
+		{"presence/alerting-101", &backend.User{Login: "carol"}, backend.SubscribeStreamStatusOK},
+		{"presence/alerting-101", nil, backend.SubscribeStreamStatusPermissionDenied},
+		{"presence/alerting-101/obs-101", &backend.User{Login: "ana"}, backend.SubscribeStreamStatusOK},
+		{"presence/alerting-101/obs-101", &backend.User{Login: "bo", Email: "Bo@example.com"}, backend.SubscribeStreamStatusOK},
+		{"presence/alerting-101/obs-101", &backend.User{Login: "root"}, backend.SubscribeStreamStatusOK},
+		{"presence/alerting-101/obs-101", &backend.User{Login: "carol"}, backend.SubscribeStreamStatusPermissionDenied},
+		{"presence/alerting-101/obs-101", &backend.User{Login: "dana", Role: "Admin"}, backend.SubscribeStreamStatusOK},
+		{"presence/alerting-101/obs-999", &backend.User{Login: "ana"}, backend.SubscribeStreamStatusPermissionDenied},
+		{"presence/bad path", &backend.User{Login: "ana"}, backend.SubscribeStreamStatusNotFound},
+	} {
+		resp, err := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+			Path:          tc.path,
+			PluginContext: backend.PluginContext{User: tc.user},
+		})
+		if err != nil || resp.Status != tc.want {
+			t.Errorf("%s as %+v: status=%v err=%v, want %v", tc.path, tc.user, resp.Status, err, tc.want)
+		}
+	}
+}
+
+func TestPresenceStream(t *testing.T) {
+	app := newTestApp(t)
+	const path = "presence/alerting-101"
+	publish := func(login, data string) backend.PublishStreamStatus {
+		t.Helper()
+		resp, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			Path:          path,
+			PluginContext: backend.PluginContext{User: &backend.User{Login: login, Name: login + " name"}},
+			Data:          []byte(data),
+		})
+		if err != nil {
+			t.Fatalf("publish as %s: %v", login, err)
+		}
+		return resp.Status
+	}
+	if got := publish("ana", `{"step": "intro"}`); got != backend.PublishStreamStatusNotFound {
+		t.Errorf("publish without a stream: %v", got)
+	}
+
+	run := func(login string) (*streamRecorder, context.CancelFunc, chan struct{}) {
+		rec, sender := newStreamRecorder(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			_ = app.RunStream(ctx, &backend.RunStreamRequest{Path: path, PluginContext: backend.PluginContext{User: &backend.User{Login: login}}}, sender)
+			close(done)
+		}()
+		return rec, cancel, done
+	}
+	anaRec, stopAna, anaDone := run("ana")
+	boRec, stopBo, boDone := run("bo")
+	defer func() { stopBo(); <-boDone }()
+	deadline := time.Now().Add(5 * time.Second)
+	for (app.getPresenceChannel(path) == nil || app.getPresenceChannel(path).fanout.viewerCount() < 2) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := publish("ana", `{"step": "create-rule", "stepIndex": 2, "totalSteps": 5}`); got != backend.PublishStreamStatusOK {
+		t.Fatalf("publish: %v", got)
+	}
+	if got := publish("bo", `{"step": "intro"}`); got != backend.PublishStreamStatusOK {
+		t.Fatalf("publish: %v", got)
+	}
+	if _, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+		Path:          path,
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "ana"}},
+		Data:          []byte(`{"status": "away"}`),
+	}); err == nil {
+		t.Error("invalid status accepted")
+	}
+	if _, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+		Path:          path,
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "ana"}},
+		Data:          []byte(`{"step": "intro", "login": "mallory"}`),
+	}); err == nil {
+		t.Error("update naming another login accepted")
+	}
+
+	msgs := boRec.ofType("presence")
+	last := msgs[len(msgs)-1].Presence
+	if len(last) != 2 || last[0].Login != "ana" || last[0].Name != "ana name" || last[0].StepIndex != 2 || last[0].Status != presenceViewing || last[1].Login != "bo" {
+		t.Fatalf("presence = %+v", last)
+	}
+	if first := anaRec.ofType("presence"); len(first) == 0 || first[0].Presence != nil {
+		t.Errorf("ana's initial presence = %+v", first)
+	}
+
+	// Closing ana's stream drops ana from everyone else's list.
+	stopAna()
+	<-anaDone
+	msgs = boRec.ofType("presence")
+	if last := msgs[len(msgs)-1].Presence; len(last) != 1 || last[0].Login != "bo" {
+		t.Errorf("after ana left: %+v", last)
+	}
+
+	// Members expire without updates.
+	withFrozenTime(t, time.Now().Add(time.Hour))
+	if got := app.getPresenceChannel(path).snapshot(); len(got) != 0 {
+		t.Errorf("expired members still present: %+v", got)
+	}
+}
@@ -0,0 +1,306 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Security scanning of imported guide content.
+//
+// Guide JSON the backend stores from outside, translations put with PUT
+// /guides/{name}/locales/{locale} and machine translations from the
+// translation API (guide_translation.go), is scanned first for embedded
+// scripts, inline event handlers, javascript: and similar URLs, and
+// resources loaded from hosts that aren't trusted. Flagged content isn't
+// stored: it is quarantined in the guide-quarantine collection, one item
+// per guide and locale, until an admin releases it, which stores it as it
+// would have been, or rejects it. GET /admin/quarantine lists the items.
+
+const (
+	guideQuarantineCollection = "guide-quarantine"
+	maxQuarantinedGuides      = 500
+	maxScanFindings           = 50
+	maxScanExcerpt            = 120
+
+	quarantineSourceUpload  = "upload"
+	quarantineSourceMachine = "machine-translation"
+)
+
+var (
+	scriptTagPattern    = regexp.MustCompile(`(?i)<\s*(script|iframe|frame|frameset|object|embed|applet|base|meta)\b`)
+	eventHandlerPattern = regexp.MustCompile(`(?i)<[a-z][^>]*\son[a-z]+\s*=`)
+	scriptURLPattern    = regexp.MustCompile(`(?i)\b(javascript|vbscript|livescript)\s*:|\bdata\s*:\s*(text/html|image/svg\+xml|application/(x-)?javascript)`)
+	// fetchTargetPattern finds URLs the browser loads by itself: src-like
+	// attributes, CSS url() and @import, and fetch() calls.
+	fetchTargetPattern = regexp.MustCompile(`(?i)(?:\b(?:src|srcset|action|formaction|poster|background)\s*=\s*['"]?|url\(\s*['"]?|@import\s+['"]|fetch\(\s*['"])((?:https?:)?//[^\s'"()<>]+)`)
+)
+
+// trustedGuideHosts are the domains, with their subdomains, guides may load
+// resources from.
+var trustedGuideHosts = []string{
+	"grafana.com", "grafana.net", "grafana-dev.net", "grafana-ops.net",
+	"youtube.com", "youtube-nocookie.com", "ytimg.com",
+}
+
+// guideScanFinding is one dangerous pattern in a guide. Path locates the
+// JSON value, such as blocks[2].content.
+type guideScanFinding struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path"`
+	Excerpt string `json:"excerpt"`
+}
+
+// quarantinedGuide is flagged guide content waiting for an admin, keyed
+// guide/locale.
+type quarantinedGuide struct {
+	Guide       string             `json:"guide"`
+	Locale      string             `json:"locale"`
+	Source      string             `json:"source"`
+	Title       string             `json:"title"`
+	Status      string             `json:"status"`
+	Content     json.RawMessage    `json:"content,omitempty"`
+	Findings    []guideScanFinding `json:"findings"`
+	SubmittedBy string             `json:"submittedBy"`
+	SubmittedAt time.Time          `json:"submittedAt"`
+}
+
+// guideScanner scans guide JSON; extraHosts are trusted besides
+// trustedGuideHosts.
+type guideScanner struct {
+	extraHosts []string
+	findings   []guideScanFinding
+}
+
+// guideScanner returns a scanner that also trusts the cdn mirror.
+func (a *App) guideScanner() *guideScanner {
+	s := &guideScanner{}
+	if cdn := mirrorOr(a.mirrors().CDN, ""); cdn != "" {
+		if u, err := url.Parse(cdn); err == nil {
+			s.extraHosts = append(s.extraHosts, u.Hostname())
+		}
+	}
+	return s
+}
+
+// scan returns the findings in content, a guide's JSON.
+func (s *guideScanner) scan(content json.RawMessage) []guideScanFinding {
+	s.findings = nil
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil
+	}
+	s.walk(doc, "")
+	return s.findings
+}
+
+func (s *guideScanner) walk(v interface{}, path string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if str, ok := v[k].(string); ok && strings.EqualFold(k, "src") {
+				s.checkFetchTarget(p, str, str)
+			}
+			s.walk(v[k], p)
+		}
+	case []interface{}:
+		for i, item := range v {
+			s.walk(item, path+"["+strconv.Itoa(i)+"]")
+		}
+	case string:
+		s.checkString(path, v)
+	}
+}
+
+func (s *guideScanner) add(rule, path, excerpt string) {
+	if len(s.findings) >= maxScanFindings {
+		return
+	}
+	if len(excerpt) > maxScanExcerpt {
+		excerpt = excerpt[:maxScanExcerpt]
+	}
+	s.findings = append(s.findings, guideScanFinding{Rule: rule, Path: path, Excerpt: excerpt})
+}
+
+func (s *guideScanner) checkString(path, text string) {
+	for _, check := range []struct {
+		rule    string
+		pattern *regexp.Regexp
+	}{
+		{"script-tag", scriptTagPattern},
+		{"event-handler", eventHandlerPattern},
+		{"script-url", scriptURLPattern},
+	} {
+		for _, match := range check.pattern.FindAllString(text, -1) {
+			s.add(check.rule, path, match)
+		}
+	}
+	for _, m := range fetchTargetPattern.FindAllStringSubmatchIndex(text, -1) {
+		s.checkFetchTarget(path, text[m[2]:m[3]], text[m[0]:m[1]])
+	}
+}
+
+// checkFetchTarget flags target, a URL the browser would load, unless it is
+// relative or on a trusted host over HTTPS.
+func (s *guideScanner) checkFetchTarget(path, target, excerpt string) {
+	if !strings.HasPrefix(target, "//") && !strings.Contains(target, "://") {
+		return
+	}
+	u, err := url.Parse(target)
+	if err == nil && u.Scheme != "http" && s.trusted(u.Hostname()) {
+		return
+	}
+	s.add("external-fetch", path, excerpt)
+}
+
+func (s *guideScanner) trusted(host string) bool {
+	host = strings.ToLower(host)
+	if host == "" || net.ParseIP(host) != nil {
+		return false
+	}
+	return slices.ContainsFunc(slices.Concat(trustedGuideHosts, s.extraHosts), func(h string) bool {
+		return host == h || strings.HasSuffix(host, "."+h)
+	})
+}
+
+// quarantineGuide stores q, replacing an earlier item for the same guide
+// and locale, and drops the oldest items beyond maxQuarantinedGuides. The
+// caller holds guideLocalesMu.
+func (a *App) quarantineGuide(q quarantinedGuide) error {
+	if err := a.store.put(guideQuarantineCollection, q.Guide+"/"+q.Locale, q); err != nil {
+		return err
+	}
+	items := a.quarantinedGuides()
+	for _, old := range items[min(len(items), maxQuarantinedGuides):] {
+		_ = a.store.delete(guideQuarantineCollection, old.Guide+"/"+old.Locale)
+	}
+	return nil
+}
+
+// quarantinedGuides returns the quarantined items, newest first.
+func (a *App) quarantinedGuides() []quarantinedGuide {
+	items := []quarantinedGuide{}
+	for _, key := range a.store.keys(guideQuarantineCollection) {
+		var q quarantinedGuide
+		if ok, err := a.store.get(guideQuarantineCollection, key, &q); err == nil && ok {
+			items = append(items, q)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].SubmittedAt.After(items[j].SubmittedAt) })
+	return items
+}
+
+// releaseQuarantinedGuide stores q where it was headed. The caller holds
+// guideLocalesMu.
+func (a *App) releaseQuarantinedGuide(q quarantinedGuide) (int, error) {
+	if q.Source == quarantineSourceMachine {
+		job := translationJob{Guide: q.Guide, Locale: q.Locale, RequestedBy: q.SubmittedBy}
+		if err := a.saveMachineTranslation(job, translationAPIResponse{Title: q.Title, Content: q.Content}); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+	key := q.Guide + "/" + q.Locale
+	exists, err := a.store.get(guideLocaleCollection, key, &guideLocaleVariant{})
+	if err == nil && !exists && len(a.guideLocaleVariants(q.Guide)) >= maxGuideLocales {
+		return http.StatusConflict, fmt.Errorf("a guide can have at most %d translations", maxGuideLocales)
+	}
+	v := guideLocaleVariant{Guide: q.Guide, Locale: q.Locale, Title: q.Title, Status: q.Status, Content: q.Content, UpdatedBy: q.SubmittedBy, UpdatedAt: timeNow().UTC()}
+	if err := a.store.put(guideLocaleCollection, key, v); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// handleAdminQuarantine handles GET /admin/quarantine, GET and DELETE
+// (reject) /admin/quarantine/{guide}/{locale} and POST
+// /admin/quarantine/{guide}/{locale}/release, for admins.
+func (a *App) handleAdminQuarantine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin := userLoginFromContext(ctx)
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(ctx) {
+		a.writeError(w, "Only admins can review quarantined guides", http.StatusForbidden)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/quarantine"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		items := a.quarantinedGuides()
+		for i := range items {
+			items[i].Content = nil
+		}
+		a.writeJSON(w, map[string]interface{}{"items": items}, http.StatusOK)
+		return
+	}
+	parts := strings.Split(rest, "/")
+	release := len(parts) == 3 && parts[2] == "release"
+	if len(parts) != 2 && !release {
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	key := parts[0] + "/" + parts[1]
+
+	a.guideLocalesMu.Lock()
+	defer a.guideLocalesMu.Unlock()
+	var q quarantinedGuide
+	ok, err := a.store.get(guideQuarantineCollection, key, &q)
+	if err != nil {
+		a.ctxLogger(ctx).Error("Failed to load quarantined guide", "key", key, "error", err)
+		a.writeError(w, "Failed to load the quarantined guide", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.writeError(w, "Quarantined guide not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case release && r.Method == http.MethodPost:
+		if status, err := a.releaseQuarantinedGuide(q); err != nil {
+			a.ctxLogger(ctx).Error("Failed to release quarantined guide", "key", key, "error", err)
+			a.writeError(w, "Failed to release the guide: "+err.Error(), status)
+			return
+		}
+		_ = a.store.delete(guideQuarantineCollection, key)
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: admin, Action: "guide.quarantine.release", TargetUser: q.SubmittedBy, Details: key})
+		q.Content = nil
+		a.writeJSON(w, q, http.StatusOK)
+	case release:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case r.Method == http.MethodGet:
+		a.writeJSON(w, q, http.StatusOK)
+	case r.Method == http.MethodDelete:
+		if err := a.store.delete(guideQuarantineCollection, key); err != nil {
+			a.ctxLogger(ctx).Error("Failed to delete quarantined guide", "key", key, "error", err)
+			a.writeError(w, "Failed to reject the guide", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: admin, Action: "guide.quarantine.reject", TargetUser: q.SubmittedBy, Details: key})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
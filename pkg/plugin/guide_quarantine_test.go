@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuideScanner(t *testing.T) {
+	app := newTestApp(t)
+	app.settings = &Settings{Mirrors: MirrorSettings{CDN: "https://cdn.internal"}}
+	clean := `{"blocks": [
+		{"type": "markdown", "content": "See [the docs](https://example.com/docs) and <img src=\"https://grafana.com/media/x.png\">"},
+		{"type": "image", "src": "https://cdn.internal/prom-101/graph.png"},
+		{"type": "video", "src": "https://www.youtube.com/embed/abc"},
+		{"type": "html", "content": "<a href=\"/connections/datasources\">Data sources</a>"}
+	]}`
+	if findings := app.guideScanner().scan(json.RawMessage(clean)); len(findings) != 0 {
+		t.Errorf("clean guide flagged: %+v", findings)
+	}
+
+	flagged := `{"blocks": [
+		{"type": "html", "content": "<p>Hi</p><SCRIPT>steal()</SCRIPT>"},
+		{"type": "html", "content": "<img src=x onerror=\"steal()\">"},
+		{"type": "markdown", "content": "[click](javascript:steal())"},
+		{"type": "image", "src": "http://grafana.com/insecure.png"},
+		{"type": "html", "content": "<div style=\"background: url('https://evil.example.com/t.gif')\"></div>"},
+		{"type": "image", "src": "https://10.0.0.5/x.png"}
+	]}`
+	findings := app.guideScanner().scan(json.RawMessage(flagged))
+	want := []guideScanFinding{
+		{Rule: "script-tag", Path: "blocks[0].content", Excerpt: "<SCRIPT"},
+		{Rule: "event-handler", Path: "blocks[1].content", Excerpt: "<img src=x onerror="},
+		{Rule: "script-url", Path: "blocks[2].content", Excerpt: "javascript:"},
+		{Rule: "external-fetch", Path: "blocks[3].src", Excerpt: "http://grafana.com/insecure.png"},
+		{Rule: "external-fetch", Path: "blocks[4].content", Excerpt: "url('https://evil.example.com/t.gif"},
+		{Rule: "external-fetch", Path: "blocks[5].src", Excerpt: "https://10.0.0.5/x.png"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("findings = %+v", findings)
+	}
+	for i := range want {
+		if findings[i] != want[i] {
+			t.Errorf("finding %d = %+v, want %+v", i, findings[i], want[i])
+		}
+	}
+}
+
+func TestGuideQuarantine(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	app := newTestApp(t)
+	serve := func(method, target, body, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := roleRequest(method, target, body, "ed", role)
+		if strings.HasPrefix(target, "/admin/") {
+			app.handleAdminQuarantine(w, r)
+		} else {
+			app.handleGuideByName(w, r)
+		}
+		return w
+	}
+	const dangerous = `{"title": "Introducción", "content": {"blocks": [{"type": "html", "content": "<script>x()</script>"}]}}`
+
+	w := serve(http.MethodPut, "/guides/intro/locales/es", dangerous, "Editor")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("flagged PUT: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodGet, "/guides/intro/locales/es", "", "Editor"); w.Code != http.StatusNotFound {
+		t.Errorf("quarantined variant was stored: status %d", w.Code)
+	}
+
+	if w := serve(http.MethodGet, "/admin/quarantine", "", "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("editor list: status %d, want 403", w.Code)
+	}
+	var list struct {
+		Items []quarantinedGuide `json:"items"`
+	}
+	if err := json.Unmarshal(serve(http.MethodGet, "/admin/quarantine", "", "Admin").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Source != quarantineSourceUpload || list.Items[0].SubmittedBy != "ed" || len(list.Items[0].Findings) != 1 || list.Items[0].Content != nil {
+		t.Errorf("quarantine = %+v", list.Items)
+	}
+	if w := serve(http.MethodGet, "/admin/quarantine/intro/es", "", "Admin"); w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("GET item: status %d", w.Code)
+	}
+
+	if w := serve(http.MethodPost, "/admin/quarantine/intro/es/release", "", "Admin"); w.Code != http.StatusOK {
+		t.Fatalf("release: status %d: %s", w.Code, w.Body)
+	}
+	var v guideLocaleVariant
+	if err := json.Unmarshal(serve(http.MethodGet, "/guides/intro/locales/es", "", "Editor").Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != guideLocalePublished || v.UpdatedBy != "ed" || v.Title != "Introducción" {
+		t.Errorf("released variant = %+v", v)
+	}
+	if w := serve(http.MethodPost, "/admin/quarantine/intro/es/release", "", "Admin"); w.Code != http.StatusNotFound {
+		t.Errorf("second release: status %d, want 404", w.Code)
+	}
+
+	// A flagged machine translation is quarantined too, and rejecting it
+	// discards it.
+	job := translationJob{Guide: "intro", Locale: "ja", RequestedBy: "ed"}
+	if err := app.storeMachineTranslation(job, translationAPIResponse{Title: "紹介", Content: json.RawMessage(`{"blocks": [{"type": "markdown", "content": "[x](javascript:x())"}]}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := app.store.get(guideLocaleCollection, "intro/ja", &guideLocaleVariant{}); ok {
+		t.Error("flagged machine translation was stored")
+	}
+	if w := serve(http.MethodDelete, "/admin/quarantine/intro/ja", "", "Admin"); w.Code != http.StatusNoContent {
+		t.Errorf("reject: status %d", w.Code)
+	}
+	if items := app.quarantinedGuides(); len(items) != 0 {
+		t.Errorf("quarantine after reject = %+v", items)
+	}
+}
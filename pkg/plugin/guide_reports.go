@@ -0,0 +1,245 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Broken-step reports.
+//
+// Learners report a step that doesn't work with POST /guides/{name}/report,
+// with the step ID, what went wrong and optionally a screenshot reference
+// (an uploaded guide asset or a URL); the Grafana version comes from the
+// request. Reports are kept per step. With a GitHub token configured, the
+// first report of a step opens an issue in the guide's source repository,
+// found from the manifest's repository name through
+// Settings.GuideReportRepositories, and later reports comment on it.
+// Issues carry the report context, never the reporter's login. Editors list
+// a guide's reported steps with GET /guides/{name}/report.
+
+const (
+	stepReportCollection = "step-reports"
+	maxStepReportsKept   = 50
+	maxReportedSteps     = 5000
+	githubIssueTimeout   = 10 * time.Second
+	defaultGitHubAPIURL  = "https://api.github.com"
+	defaultGuideRepoName = "interactive-tutorials"
+	brokenStepIssueLabel = "broken-step"
+)
+
+// defaultGuideReportRepositories maps manifest repository names to GitHub
+// repositories when Settings.GuideReportRepositories doesn't.
+var defaultGuideReportRepositories = map[string]string{
+	defaultGuideRepoName: "grafana/interactive-tutorials",
+}
+
+// stepReport is one learner's report of a broken step.
+type stepReport struct {
+	Reporter       string    `json:"reporter"`
+	Description    string    `json:"description,omitempty"`
+	Screenshot     string    `json:"screenshot,omitempty"`
+	GrafanaVersion string    `json:"grafanaVersion,omitempty"`
+	ReportedAt     time.Time `json:"reportedAt"`
+}
+
+// brokenStep is the reports of one step, newest maxStepReportsKept kept,
+// and the issue filed for it.
+type brokenStep struct {
+	Guide           string       `json:"guide"`
+	StepID          string       `json:"stepId"`
+	Repository      string       `json:"repository"`
+	Count           int          `json:"count"`
+	Reports         []stepReport `json:"reports"`
+	IssueNumber     int          `json:"issueNumber,omitempty"`
+	IssueURL        string       `json:"issueUrl,omitempty"`
+	FirstReportedAt time.Time    `json:"firstReportedAt"`
+	LastReportedAt  time.Time    `json:"lastReportedAt"`
+}
+
+// StepReportRequest is the JSON body for POST /guides/{name}/report.
+type StepReportRequest struct {
+	StepID      string `json:"stepId" validate:"required,max=200"`
+	Description string `json:"description,omitempty" validate:"max=2000"`
+	Screenshot  string `json:"screenshot,omitempty" validate:"max=500"`
+	// Repository is the guide manifest's repository name.
+	Repository string `json:"repository,omitempty" validate:"max=100"`
+}
+
+// stepReportResponse is the response of POST /guides/{name}/report.
+type stepReportResponse struct {
+	Count    int    `json:"count"`
+	IssueURL string `json:"issueUrl,omitempty"`
+}
+
+// guideReportRepository returns the GitHub owner/name for a manifest
+// repository name, or "".
+func (a *App) guideReportRepository(name string) string {
+	if a.settings != nil {
+		if repo, ok := a.settings.GuideReportRepositories[name]; ok {
+			return repo
+		}
+	}
+	return defaultGuideReportRepositories[name]
+}
+
+// stepReportIssueBody renders a report as the issue body or comment.
+func stepReportIssueBody(step brokenStep, report stepReport) string {
+	lines := []string{
+		fmt.Sprintf("A learner reported step `%s` of guide `%s` as broken.", step.StepID, step.Guide),
+		"",
+	}
+	if report.Description != "" {
+		lines = append(lines, "> "+strings.ReplaceAll(report.Description, "\n", "\n> "), "")
+	}
+	version := report.GrafanaVersion
+	if version == "" {
+		version = "unknown"
+	}
+	lines = append(lines, "- Grafana version: "+version)
+	if report.Screenshot != "" {
+		lines = append(lines, "- Screenshot: "+report.Screenshot)
+	}
+	lines = append(lines, fmt.Sprintf("- Reports so far: %d", step.Count))
+	return strings.Join(lines, "\n")
+}
+
+// fileStepIssue opens an issue for step, or comments on the one already
+// filed, and returns the issue's number and URL.
+func (a *App) fileStepIssue(ctx context.Context, repo string, step brokenStep, report stepReport) (int, string, error) {
+	apiURL := a.githubAPIURL()
+	body := stepReportIssueBody(step, report)
+	path, payload := "/repos/"+repo+"/issues", map[string]interface{}{
+		"title":  fmt.Sprintf("Broken step in %s: %s", step.Guide, step.StepID),
+		"body":   body,
+		"labels": []string{brokenStepIssueLabel},
+	}
+	if step.IssueNumber > 0 {
+		path, payload = fmt.Sprintf("/repos/%s/issues/%d/comments", repo, step.IssueNumber), map[string]interface{}{"body": body}
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, githubIssueTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+path, bytes.NewReader(raw))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+a.settings.GitHubToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, "", fmt.Errorf("GitHub returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if step.IssueNumber > 0 {
+		return step.IssueNumber, step.IssueURL, nil
+	}
+	var issue struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&issue); err != nil {
+		return 0, "", fmt.Errorf("decode GitHub issue: %w", err)
+	}
+	return issue.Number, issue.HTMLURL, nil
+}
+
+// handleStepReports handles POST (report a broken step) and GET (editors:
+// the guide's reported steps) on /guides/{name}/report.
+func (a *App) handleStepReports(w http.ResponseWriter, r *http.Request, guide string) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !userCanEditFromContext(ctx) {
+			a.writeError(w, "Only editors and admins can view broken-step reports", http.StatusForbidden)
+			return
+		}
+		prefix := guide + "/"
+		steps := []brokenStep{}
+		for _, key := range a.store.keys(stepReportCollection) {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			var step brokenStep
+			if ok, err := a.store.get(stepReportCollection, key, &step); err == nil && ok {
+				steps = append(steps, step)
+			}
+		}
+		sort.Slice(steps, func(i, j int) bool { return steps[i].LastReportedAt.After(steps[j].LastReportedAt) })
+		a.writeJSON(w, map[string]interface{}{"steps": steps}, http.StatusOK)
+	case http.MethodPost:
+		var req StepReportRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if req.Repository == "" {
+			req.Repository = defaultGuideRepoName
+		}
+		version, _ := grafanaVersionFromContext(ctx)
+		now := timeNow().UTC()
+		report := stepReport{Reporter: user, Description: req.Description, Screenshot: req.Screenshot, GrafanaVersion: version, ReportedAt: now}
+
+		a.stepReportsMu.Lock()
+		defer a.stepReportsMu.Unlock()
+		key := guide + "/" + req.StepID
+		var step brokenStep
+		ok, err := a.store.get(stepReportCollection, key, &step)
+		if err == nil && !ok && len(a.store.keys(stepReportCollection)) >= maxReportedSteps {
+			a.writeError(w, fmt.Sprintf("At most %d steps can have reports", maxReportedSteps), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			a.ctxLogger(ctx).Error("Failed to load step reports", "guide", guide, "step", req.StepID, "error", err)
+			a.writeError(w, "Failed to store the report", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			step = brokenStep{Guide: guide, StepID: req.StepID, FirstReportedAt: now}
+		}
+		step.Repository = req.Repository
+		step.Count++
+		step.LastReportedAt = now
+		step.Reports = append(step.Reports, report)
+		step.Reports = step.Reports[max(0, len(step.Reports)-maxStepReportsKept):]
+
+		if repo := a.guideReportRepository(req.Repository); repo != "" && a.settings != nil && a.settings.GitHubToken != "" {
+			number, url, err := a.fileStepIssue(ctx, repo, step, report)
+			if err != nil {
+				a.ctxLogger(ctx).Warn("Failed to file broken-step issue", "guide", guide, "step", req.StepID, "repository", repo, "error", err)
+			} else {
+				step.IssueNumber, step.IssueURL = number, url
+			}
+		}
+		if err := a.store.put(stepReportCollection, key, step); err != nil {
+			a.ctxLogger(ctx).Error("Failed to store step report", "guide", guide, "step", req.StepID, "error", err)
+			a.writeError(w, "Failed to store the report", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, stepReportResponse{Count: step.Count, IssueURL: step.IssueURL}, http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStepReports(t *testing.T) {
+	var mu sync.Mutex
+	var paths, bodies []string
+	gh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"number": 42, "html_url": "https://github.com/acme/guides/issues/42"}`))
+	}))
+	t.Cleanup(gh.Close)
+
+	app := newTestApp(t)
+	app.settings = &Settings{GitHubAPIURL: gh.URL, GitHubToken: "gh-token", GuideReportRepositories: map[string]string{"acme-guides": "acme/guides"}}
+	serve := func(method, body, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleGuideByName(w, roleRequest(method, "/guides/loki-101/report", body, "ann", role))
+		return w
+	}
+
+	if w := serve(http.MethodPost, `{"description": "no step"}`, "Viewer"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing stepId: status %d, want 400", w.Code)
+	}
+	w := serve(http.MethodPost, `{"stepId": "step-3", "description": "Button is gone", "screenshot": "shot.png", "repository": "acme-guides"}`, "Viewer")
+	var resp stepReportResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusCreated || resp.Count != 1 || resp.IssueURL != "https://github.com/acme/guides/issues/42" {
+		t.Fatalf("first report: status %d, %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPost, `{"stepId": "step-3", "repository": "acme-guides"}`, "Viewer"); w.Code != http.StatusCreated {
+		t.Fatalf("second report: status %d", w.Code)
+	}
+	if len(paths) != 2 || paths[0] != "/repos/acme/guides/issues" || paths[1] != "/repos/acme/guides/issues/42/comments" {
+		t.Errorf("GitHub calls = %v", paths)
+	}
+	if !strings.Contains(bodies[0], "Button is gone") || !strings.Contains(bodies[0], "shot.png") || strings.Contains(bodies[0], "ann") {
+		t.Errorf("issue body = %s", bodies[0])
+	}
+
+	// Unmapped repositories are recorded without an issue.
+	if w := serve(http.MethodPost, `{"stepId": "step-5", "repository": "elsewhere"}`, "Viewer"); w.Code != http.StatusCreated {
+		t.Fatalf("unmapped report: status %d", w.Code)
+	}
+	if len(paths) != 2 {
+		t.Errorf("unmapped repository called GitHub: %v", paths)
+	}
+
+	if w := serve(http.MethodGet, "", "Viewer"); w.Code != http.StatusForbidden {
+		t.Errorf("viewer list: status %d, want 403", w.Code)
+	}
+	w = serve(http.MethodGet, "", "Editor")
+	var list struct {
+		Steps []brokenStep `json:"steps"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Steps) != 2 {
+		t.Fatalf("steps = %+v", list.Steps)
+	}
+	for _, s := range list.Steps {
+		if s.StepID == "step-3" && (s.Count != 2 || s.IssueNumber != 42 || len(s.Reports) != 2) {
+			t.Errorf("step-3 = %+v", s)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Grafana resources created by guide actions.
+//
+// Guide actions create real resources in the org (dashboards, alert rules,
+// contact points, data sources, folders) as the plugin's service account.
+// Each one is recorded in the plugin store under the user who triggered it
+// and the guide it came from. POST /actions/cleanup deletes a user's
+// resources from Grafana, optionally for one guide, and with
+// guideResourceTtlHours set the retention job deletes them once they are
+// that old, so demo artifacts don't stay in production orgs.
+
+const guideResourceCollection = "guide-resources"
+
+const (
+	guideResourceAlertRule    = "alert-rule"
+	guideResourceContactPoint = "contact-point"
+	guideResourceDashboard    = "dashboard"
+	guideResourceDatasource   = "datasource"
+	guideResourceFolder       = "folder"
+)
+
+// guideResourceDeleteOrder deletes resources before the things they depend
+// on: rules before their contact points, everything before its folder.
+var guideResourceDeleteOrder = []string{
+	guideResourceAlertRule,
+	guideResourceDashboard,
+	guideResourceContactPoint,
+	guideResourceDatasource,
+	guideResourceFolder,
+}
+
+// guideResource is one Grafana resource a guide action created.
+type guideResource struct {
+	Kind      string    `json:"kind"`
+	UID       string    `json:"uid"`
+	Title     string    `json:"title"`
+	Guide     string    `json:"guide,omitempty"`
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func guideResourceKey(user, kind, uid string) string {
+	return user + "/" + kind + "/" + uid
+}
+
+// guideResourceUID derives a stable Grafana UID for the resource a user
+// creates from a bundled definition, so repeating an action finds the
+// existing resource instead of creating another.
+func guideResourceUID(kind, definition, user string) string {
+	sum := sha256.Sum256([]byte(kind + "/" + definition + "/" + user))
+	return "pf-" + hex.EncodeToString(sum[:12])
+}
+
+// trackGuideResource records res. A failure is logged: the resource exists
+// in Grafana either way.
+func (a *App) trackGuideResource(ctx context.Context, res guideResource) {
+	res.CreatedAt = timeNow().UTC()
+	if err := a.store.put(guideResourceCollection, guideResourceKey(res.User, res.Kind, res.UID), res); err != nil {
+		a.ctxLogger(ctx).Error("Failed to track guide resource", "kind", res.Kind, "uid", res.UID, "error", err)
+	}
+}
+
+// trackedGuideResource returns the user's record of a resource, if any.
+func (a *App) trackedGuideResource(user, kind, uid string) (guideResource, bool) {
+	var res guideResource
+	ok, err := a.store.get(guideResourceCollection, guideResourceKey(user, kind, uid), &res)
+	return res, ok && err == nil
+}
+
+// guideResources returns the tracked resources matching keep, in delete
+// order.
+func (a *App) guideResources(keep func(guideResource) bool) []guideResource {
+	result := []guideResource{}
+	for _, key := range a.store.keys(guideResourceCollection) {
+		var res guideResource
+		if ok, err := a.store.get(guideResourceCollection, key, &res); err != nil || !ok || !keep(res) {
+			continue
+		}
+		result = append(result, res)
+	}
+	rank := func(kind string) int {
+		for i, k := range guideResourceDeleteOrder {
+			if k == kind {
+				return i
+			}
+		}
+		return len(guideResourceDeleteOrder)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if rank(result[i].Kind) != rank(result[j].Kind) {
+			return rank(result[i].Kind) < rank(result[j].Kind)
+		}
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// demoFolderUID is the UID of the user's demo folder, where guide actions
+// put dashboards and alert rules. The folder is shared by the user's guides,
+// so it is tracked without one.
+func demoFolderUID(user string) string {
+	return guideResourceUID(guideResourceFolder, "demos", user)
+}
+
+// ensureDemoFolder creates the user's demo folder unless it is tracked.
+func (a *App) ensureDemoFolder(ctx context.Context, api grafanaAPI, user string) error {
+	uid := demoFolderUID(user)
+	if _, tracked := a.trackedGuideResource(user, guideResourceFolder, uid); tracked {
+		return nil
+	}
+	title := "Pathfinder demos (" + user + ")"
+	if err := api.EnsureFolder(ctx, uid, title); err != nil {
+		return err
+	}
+	a.trackGuideResource(ctx, guideResource{Kind: guideResourceFolder, UID: uid, Title: title, User: user})
+	return nil
+}
+
+// errNoTestData means the org has no TestData data source for demo
+// resources to query.
+var errNoTestData = errors.New("no TestData data source")
+
+// testDataDatasourceUID returns requested, or the UID of the org's TestData
+// data source.
+func testDataDatasourceUID(ctx context.Context, api grafanaAPI, requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	list, err := api.ListDatasources(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, ds := range list {
+		if shortDatasourceType(ds.Type) == "testdata" {
+			return ds.UID, nil
+		}
+	}
+	return "", errNoTestData
+}
+
+type guideResourceFailure struct {
+	guideResource
+	Error string `json:"error"`
+}
+
+// deleteGuideResources deletes resources from Grafana in order and stops
+// tracking each one that is gone. Resources already deleted in Grafana count
+// as removed.
+func (a *App) deleteGuideResources(ctx context.Context, api grafanaAPI, logger log.Logger, resources []guideResource) ([]guideResource, []guideResourceFailure) {
+	removed, failed := []guideResource{}, []guideResourceFailure{}
+	for _, res := range resources {
+		if err := api.DeleteResource(ctx, res.Kind, res.UID); err != nil {
+			logger.Warn("Failed to delete guide resource", "kind", res.Kind, "uid", res.UID, "user", res.User, "error", err)
+			failed = append(failed, guideResourceFailure{guideResource: res, Error: err.Error()})
+			continue
+		}
+		if err := a.store.delete(guideResourceCollection, guideResourceKey(res.User, res.Kind, res.UID)); err != nil {
+			logger.Error("Failed to untrack guide resource", "kind", res.Kind, "uid", res.UID, "error", err)
+		}
+		if res.Kind == guideResourceDatasource {
+			a.revokeVMProxyTokens(res.UID)
+			uid := res.UID
+			a.closeVMTunnels(func(t vmTunnelInfo) bool { return t.DatasourceUID == uid })
+		}
+		removed = append(removed, res)
+	}
+	return removed, failed
+}
+
+type guideCleanupRequest struct {
+	Guide string `json:"guide,omitempty" validate:"max=200"`
+}
+
+type guideCleanupResponse struct {
+	Removed []guideResource        `json:"removed"`
+	Failed  []guideResourceFailure `json:"failed"`
+}
+
+// handleGuideResources handles GET /actions/resources: the caller's tracked
+// resources, optionally for ?guide=.
+func (a *App) handleGuideResources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	guide := r.URL.Query().Get("guide")
+	resources := a.guideResources(func(res guideResource) bool {
+		return res.User == user && (guide == "" || res.Guide == guide)
+	})
+	a.writeJSON(w, map[string]interface{}{"resources": resources}, http.StatusOK)
+}
+
+// handleGuideCleanup handles POST /actions/cleanup: deletes the caller's
+// tracked resources, or those of one guide.
+func (a *App) handleGuideCleanup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	var req guideCleanupRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	resources := a.cleanupResources(user, req.Guide)
+	if len(resources) == 0 {
+		a.writeJSON(w, guideCleanupResponse{Removed: []guideResource{}, Failed: []guideResourceFailure{}}, http.StatusOK)
+		return
+	}
+	api, err := resolveGrafanaAPI(r.Context())
+	if err != nil {
+		a.writeError(w, "Cleanup needs the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+		return
+	}
+	logger := a.ctxLogger(r.Context())
+	removed, failed := a.deleteGuideResources(r.Context(), api, logger, resources)
+	if len(removed) > 0 {
+		a.recordAudit(logger, auditEntry{Actor: user, Action: "guide.resources.cleanup", Details: req.Guide})
+	}
+	a.writeJSON(w, guideCleanupResponse{Removed: removed, Failed: failed}, http.StatusOK)
+}
+
+// cleanupResources returns what cleaning up guide (or every guide) deletes
+// for user. The demo folder goes only with the user's last resources, since
+// deleting it would delete other guides' dashboards.
+func (a *App) cleanupResources(user, guide string) []guideResource {
+	remaining := false
+	resources := a.guideResources(func(res guideResource) bool {
+		if res.User != user {
+			return false
+		}
+		if guide != "" && res.Kind != guideResourceFolder && res.Guide != guide {
+			remaining = true
+			return false
+		}
+		return true
+	})
+	if !remaining {
+		return resources
+	}
+	kept := resources[:0]
+	for _, res := range resources {
+		if res.Kind != guideResourceFolder {
+			kept = append(kept, res)
+		}
+	}
+	return kept
+}
+
+// deleteExpiredGuideResources deletes resources older than
+// guideResourceTtlHours, for the retention job, and returns how many were
+// deleted. Without a request to take the Grafana config from, it uses the
+// config the instance was created with.
+func (a *App) deleteExpiredGuideResources(logger log.Logger) int {
+	if a.settings == nil || a.settings.GuideResourceTTLHours <= 0 {
+		return 0
+	}
+	cutoff := timeNow().Add(-time.Duration(a.settings.GuideResourceTTLHours) * time.Hour)
+	active := map[string]bool{}
+	for _, res := range a.guideResources(func(res guideResource) bool { return !res.CreatedAt.Before(cutoff) }) {
+		active[res.User] = true
+	}
+	// A demo folder outlives its TTL while it holds newer resources.
+	expired := a.guideResources(func(res guideResource) bool {
+		return res.CreatedAt.Before(cutoff) && !(res.Kind == guideResourceFolder && active[res.User])
+	})
+	if len(expired) == 0 {
+		return 0
+	}
+	ctx := a.grafanaConfigContext(context.Background())
+	api, err := resolveGrafanaAPI(ctx)
+	if err != nil {
+		logger.Warn("Cannot delete expired guide resources without the plugin's service account", "count", len(expired))
+		return 0
+	}
+	removed, _ := a.deleteGuideResources(ctx, api, logger, expired)
+	if len(removed) > 0 {
+		logger.Info("Deleted expired guide resources", "count", len(removed), "ttlHours", a.settings.GuideResourceTTLHours)
+	}
+	return len(removed)
+}
@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// createGuideResources runs the dashboard and alert rule actions as ana for
+// two guides and returns the mux.
+func createGuideResources(t *testing.T, app *App) *http.ServeMux {
+	t.Helper()
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	for _, req := range []struct{ path, body string }{
+		{"/v1/actions/dashboards", `{"definition": "service-overview", "guide": "dashboards-101"}`},
+		{"/v1/actions/alert-rules", `{"definition": "high-cpu", "guide": "alerting-101"}`},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(http.MethodPost, req.path, req.body, "ana", "Editor"))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: status=%d body=%s", req.path, w.Code, w.Body.String())
+		}
+	}
+	return mux
+}
+
+func cleanup(t *testing.T, mux *http.ServeMux, body, user string) guideCleanupResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/cleanup", body, user, "Viewer"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("cleanup: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp guideCleanupResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestGuideCleanup(t *testing.T) {
+	api := &fakeGrafanaAPI{datasources: []grafanaDatasource{{UID: "td", Type: "testdata"}}}
+	useFakeGrafanaAPI(t, api)
+	app := newTestApp(t)
+	mux := createGuideResources(t, app)
+
+	dashboard := api.dashboards[guideResourceUID(guideResourceDashboard, "service-overview", "ana")]
+	if dashboard == nil || dashboard["folderUid"] != demoFolderUID("ana") {
+		t.Fatalf("dashboard = %v", dashboard)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodGet, "/v1/actions/resources", "", "ana", "Viewer"))
+	var listed struct{ Resources []guideResource }
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Resources) != 4 {
+		t.Fatalf("tracked %d resources, want dashboard, rule, contact point and folder", len(listed.Resources))
+	}
+	if resp := cleanup(t, mux, `{}`, "bo"); len(resp.Removed) != 0 || len(api.deleted) != 0 {
+		t.Fatalf("another user's cleanup removed %v", api.deleted)
+	}
+
+	// One guide's cleanup leaves the folder the other guide still uses.
+	resp := cleanup(t, mux, `{"guide": "alerting-101"}`, "ana")
+	want := []string{
+		guideResourceAlertRule + "/" + guideResourceUID(guideResourceAlertRule, "high-cpu", "ana"),
+		guideResourceContactPoint + "/" + guideResourceUID(guideResourceContactPoint, "email", "ana"),
+	}
+	if len(resp.Removed) != 2 || len(api.deleted) != 2 || api.deleted[0] != want[0] || api.deleted[1] != want[1] {
+		t.Fatalf("deleted %v, want %v", api.deleted, want)
+	}
+
+	resp = cleanup(t, mux, `{}`, "ana")
+	if len(resp.Removed) != 2 || api.deleted[3] != guideResourceFolder+"/"+demoFolderUID("ana") {
+		t.Errorf("deleted %v, want the dashboard then the folder", api.deleted)
+	}
+	if left := app.guideResources(func(guideResource) bool { return true }); len(left) != 0 {
+		t.Errorf("still tracking %v", left)
+	}
+}
+
+func TestGuideCleanup_Failures(t *testing.T) {
+	api := &fakeGrafanaAPI{datasources: []grafanaDatasource{{UID: "td", Type: "testdata"}}}
+	useFakeGrafanaAPI(t, api)
+	app := newTestApp(t)
+	mux := createGuideResources(t, app)
+
+	dashboardUID := guideResourceUID(guideResourceDashboard, "service-overview", "ana")
+	api.deleteErr = map[string]error{guideResourceDashboard + "/" + dashboardUID: &grafanaAPIError{status: http.StatusForbidden, message: "permission denied"}}
+	resp := cleanup(t, mux, `{}`, "ana")
+	if len(resp.Failed) != 1 || resp.Failed[0].UID != dashboardUID || len(resp.Removed) != 3 {
+		t.Fatalf("removed %d, failed %+v", len(resp.Removed), resp.Failed)
+	}
+	if _, ok := app.trackedGuideResource("ana", guideResourceDashboard, dashboardUID); !ok {
+		t.Error("failed deletion stopped being tracked")
+	}
+}
+
+func TestDeleteExpiredGuideResources(t *testing.T) {
+	advance := withFrozenTime(t, time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC))
+	api := &fakeGrafanaAPI{datasources: []grafanaDatasource{{UID: "td", Type: "testdata"}}}
+	useFakeGrafanaAPI(t, api)
+	app := newTestApp(t)
+	app.settings = &Settings{GuideResourceTTLHours: 24}
+	mux := createGuideResources(t, app)
+
+	advance(20 * time.Hour)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/actions/dashboards", `{"definition": "host-overview"}`, "ana", "Editor"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status=%d", w.Code)
+	}
+
+	// The folder is past its TTL but still holds the newer dashboard.
+	advance(5 * time.Hour)
+	if n := app.deleteExpiredGuideResources(log.DefaultLogger); n != 3 {
+		t.Errorf("deleted %d expired resources (%v), want 3", n, api.deleted)
+	}
+	advance(20 * time.Hour)
+	if n := app.deleteExpiredGuideResources(log.DefaultLogger); n != 2 {
+		t.Errorf("deleted %d expired resources (%v), want the dashboard and folder", n, api.deleted)
+	}
+
+	api.err = errors.New("unreachable")
+	app.settings.GuideResourceTTLHours = 0
+	if n := app.deleteExpiredGuideResources(log.DefaultLogger); n != 0 {
+		t.Errorf("TTL 0 deleted %d", n)
+	}
+}
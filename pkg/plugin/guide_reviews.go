@@ -0,0 +1,329 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Custom guide review and approval.
+//
+// An author (an editor) asks for a review of a custom guide with POST
+// /guide-reviews/{guideId}, naming reviewers. Reviewers and approvers
+// comment on it; an approver who isn't the author approves it or requests
+// changes, after which the author asks again. Approvers are admins and,
+// with Settings.GuideApproverTeams, members of those Grafana teams. With
+// Settings.GuideApprovalRequired, /custom-guide-repository leaves out
+// published guides that aren't approved, and GET /guide-reviews/{guideId}
+// reports whether the guide is publishable. Approval covers the guide, not a
+// revision: authors ask for a new review after changing an approved guide.
+
+const (
+	guideReviewCollection = "guide-reviews"
+	maxGuideReviews       = 1000
+	maxGuideReviewNotes   = 200
+
+	reviewStatePending          = "pending"
+	reviewStateChangesRequested = "changes-requested"
+	reviewStateApproved         = "approved"
+)
+
+// guideReviewComment is a comment on a review; Decision is set on the
+// comment recorded with an approval or a change request.
+type guideReviewComment struct {
+	Author    string    `json:"author"`
+	Body      string    `json:"body,omitempty"`
+	Decision  string    `json:"decision,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// guideReview is the review of one guide.
+type guideReview struct {
+	GuideID     string               `json:"guideId"`
+	Author      string               `json:"author"`
+	Reviewers   []string             `json:"reviewers"`
+	State       string               `json:"state"`
+	Comments    []guideReviewComment `json:"comments"`
+	ApprovedBy  string               `json:"approvedBy,omitempty"`
+	ApprovedAt  *time.Time           `json:"approvedAt,omitempty"`
+	RequestedAt time.Time            `json:"requestedAt"`
+	UpdatedAt   time.Time            `json:"updatedAt"`
+}
+
+// guideReviewResponse is a review with whether the caller may act on it.
+type guideReviewResponse struct {
+	guideReview
+	Publishable bool `json:"publishable"`
+	CanApprove  bool `json:"canApprove"`
+}
+
+// GuideReviewRequest is the JSON body for POST /guide-reviews/{guideId} and
+// PUT /guide-reviews/{guideId}/reviewers.
+type GuideReviewRequest struct {
+	Reviewers []string `json:"reviewers" validate:"max=20,each,required,max=200"`
+}
+
+// GuideReviewCommentRequest is the JSON body for POST
+// /guide-reviews/{guideId}/comments, /approve and /request-changes.
+type GuideReviewCommentRequest struct {
+	Body string `json:"body" validate:"max=4000"`
+}
+
+// guideReview returns the stored review of guideID, if any.
+func (a *App) guideReview(guideID string) (guideReview, bool, error) {
+	var review guideReview
+	ok, err := a.store.get(guideReviewCollection, guideID, &review)
+	return review, ok, err
+}
+
+// approvedGuides returns the IDs of approved guides, or nil when approval
+// isn't required.
+func (a *App) approvedGuides() map[string]bool {
+	if a.settings == nil || !a.settings.GuideApprovalRequired {
+		return nil
+	}
+	approved := map[string]bool{}
+	for _, key := range a.store.keys(guideReviewCollection) {
+		if review, ok, err := a.guideReview(key); err == nil && ok && review.State == reviewStateApproved {
+			approved[key] = true
+		}
+	}
+	return approved
+}
+
+// canApproveGuides reports whether the caller is an approver: an admin or a
+// member of an approver team.
+func (a *App) canApproveGuides(ctx context.Context, user string) (bool, error) {
+	if userIsAdminFromContext(ctx) {
+		return true, nil
+	}
+	if a.settings == nil || len(a.settings.GuideApproverTeams) == 0 {
+		return false, nil
+	}
+	api, err := resolveGrafanaAPI(ctx)
+	if err != nil {
+		return false, err
+	}
+	teams, err := api.UserTeams(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	for _, team := range a.settings.GuideApproverTeams {
+		if slices.Contains(teams, team) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a *App) guideReviewResponse(review guideReview, canApprove bool, user string) guideReviewResponse {
+	return guideReviewResponse{
+		guideReview: review,
+		Publishable: review.State == reviewStateApproved || a.settings == nil || !a.settings.GuideApprovalRequired,
+		CanApprove:  canApprove && user != review.Author && review.State == reviewStatePending,
+	}
+}
+
+// handleGuideReviewList handles GET /guide-reviews?state=&reviewer=.
+func (a *App) handleGuideReviewList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(r.Context()) {
+		a.writeError(w, "Only editors and admins can take part in guide reviews", http.StatusForbidden)
+		return
+	}
+	state, reviewer := r.URL.Query().Get("state"), r.URL.Query().Get("reviewer")
+	reviews := []guideReview{}
+	for _, key := range a.store.keys(guideReviewCollection) {
+		review, ok, err := a.guideReview(key)
+		if err != nil || !ok {
+			continue
+		}
+		if (state != "" && review.State != state) || (reviewer != "" && !slices.Contains(review.Reviewers, reviewer)) {
+			continue
+		}
+		reviews = append(reviews, review)
+	}
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].UpdatedAt.After(reviews[j].UpdatedAt) })
+	a.writeJSON(w, map[string]interface{}{"reviews": reviews}, http.StatusOK)
+}
+
+// handleGuideReview handles /guide-reviews/{guideId} (GET, POST to ask for
+// a review, DELETE to withdraw it) and its reviewers, comments, approve and
+// request-changes actions.
+func (a *App) handleGuideReview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can take part in guide reviews", http.StatusForbidden)
+		return
+	}
+	guideID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/guide-reviews/"), "/")
+	if !guideIDPattern.MatchString(guideID) {
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	wantMethod := http.MethodPost
+	switch action {
+	case "":
+		wantMethod = r.Method
+	case "reviewers":
+		wantMethod = http.MethodPut
+	case "comments", "approve", "request-changes":
+	default:
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != wantMethod || (action == "" && r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	approver, err := a.canApproveGuides(ctx, user)
+	if err != nil {
+		a.ctxLogger(ctx).Warn("Failed to look up guide approver teams", "user", user, "error", err)
+	}
+	if action == "approve" && err != nil {
+		a.writeError(w, "Failed to check approver teams", http.StatusBadGateway)
+		return
+	}
+
+	a.guideReviewsMu.Lock()
+	defer a.guideReviewsMu.Unlock()
+	review, ok, err := a.guideReview(guideID)
+	if err != nil {
+		a.ctxLogger(ctx).Error("Failed to load guide review", "guideId", guideID, "error", err)
+		a.writeError(w, "Failed to load the review", http.StatusInternalServerError)
+		return
+	}
+	if !ok && !(action == "" && r.Method == http.MethodPost) {
+		a.writeError(w, "Guide has no review", http.StatusNotFound)
+		return
+	}
+	isAuthor := ok && review.Author == user
+	now := timeNow().UTC()
+
+	var req GuideReviewCommentRequest
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		a.writeJSON(w, a.guideReviewResponse(review, approver, user), http.StatusOK)
+		return
+
+	case action == "" && r.Method == http.MethodDelete:
+		if !isAuthor && !userIsAdminFromContext(ctx) {
+			a.writeError(w, "Only the author or an admin can withdraw a review", http.StatusForbidden)
+			return
+		}
+		if err := a.store.delete(guideReviewCollection, guideID); err != nil {
+			a.ctxLogger(ctx).Error("Failed to delete guide review", "guideId", guideID, "error", err)
+			a.writeError(w, "Failed to delete the review", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: user, Action: "guide.review.withdraw", Details: guideID})
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	case action == "" || action == "reviewers":
+		var body GuideReviewRequest
+		if !a.decodeRequest(w, r, &body) {
+			return
+		}
+		if ok && !isAuthor && !userIsAdminFromContext(ctx) {
+			a.writeError(w, "Only the author or an admin can change a review", http.StatusForbidden)
+			return
+		}
+		if slices.Contains(body.Reviewers, review.Author) || (!ok && slices.Contains(body.Reviewers, user)) {
+			a.writeError(w, "Invalid request body: reviewers must not include the author", http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			if len(a.store.keys(guideReviewCollection)) >= maxGuideReviews {
+				a.writeError(w, fmt.Sprintf("At most %d guides can be under review", maxGuideReviews), http.StatusConflict)
+				return
+			}
+			review = guideReview{GuideID: guideID, Author: user, Comments: []guideReviewComment{}}
+		}
+		review.Reviewers = body.Reviewers
+		if action == "" {
+			review.State, review.ApprovedBy, review.ApprovedAt, review.RequestedAt = reviewStatePending, "", nil, now
+		}
+
+	case action == "comments":
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Body) == "" {
+			a.writeError(w, "Invalid request body: body is required", http.StatusBadRequest)
+			return
+		}
+		if !isAuthor && !approver && !slices.Contains(review.Reviewers, user) {
+			a.writeError(w, "Only the author, reviewers and approvers can comment on a review", http.StatusForbidden)
+			return
+		}
+		review.Comments = append(review.Comments, guideReviewComment{Author: user, Body: req.Body, CreatedAt: now})
+
+	default:
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if isAuthor {
+			a.writeError(w, "Authors can't review their own guide", http.StatusForbidden)
+			return
+		}
+		if action == "approve" && !approver {
+			a.writeError(w, "Only approvers can approve guides", http.StatusForbidden)
+			return
+		}
+		if !approver && !slices.Contains(review.Reviewers, user) {
+			a.writeError(w, "Only reviewers and approvers can request changes", http.StatusForbidden)
+			return
+		}
+		if action == "request-changes" && strings.TrimSpace(req.Body) == "" {
+			a.writeError(w, "Invalid request body: body is required when requesting changes", http.StatusBadRequest)
+			return
+		}
+		if review.State != reviewStatePending {
+			a.writeError(w, "Guide is not awaiting review", http.StatusConflict)
+			return
+		}
+		review.State = reviewStateChangesRequested
+		if action == "approve" {
+			review.State, review.ApprovedBy, review.ApprovedAt = reviewStateApproved, user, &now
+		}
+		review.Comments = append(review.Comments, guideReviewComment{Author: user, Body: req.Body, Decision: review.State, CreatedAt: now})
+	}
+
+	if len(review.Comments) > maxGuideReviewNotes {
+		a.writeError(w, fmt.Sprintf("A review can have at most %d comments", maxGuideReviewNotes), http.StatusConflict)
+		return
+	}
+	review.UpdatedAt = now
+	if err := a.store.put(guideReviewCollection, guideID, review); err != nil {
+		a.ctxLogger(ctx).Error("Failed to store guide review", "guideId", guideID, "error", err)
+		a.writeError(w, "Failed to store the review", http.StatusInternalServerError)
+		return
+	}
+	switch action {
+	case "":
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: user, Action: "guide.review.request", Details: fmt.Sprintf("%s reviewers=%s", guideID, strings.Join(review.Reviewers, ","))})
+	case "reviewers":
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: user, Action: "guide.review.reviewers", Details: fmt.Sprintf("%s reviewers=%s", guideID, strings.Join(review.Reviewers, ","))})
+	case "approve", "request-changes":
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: user, Action: "guide.review." + action, TargetUser: review.Author, Details: guideID})
+	}
+	a.writeJSON(w, a.guideReviewResponse(review, approver, user), http.StatusOK)
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestGuideReviewWorkflow(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	app := newTestApp(t)
+	app.settings = &Settings{GuideApprovalRequired: true, GuideApproverTeams: []string{"docs-leads"}}
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{userTeams: map[string][]string{"lee": {"docs-leads"}}})
+
+	serve := func(method, target, body, user, role string) (int, guideReviewResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleGuideReview(w, roleRequest(method, target, body, user, role))
+		var resp guideReviewResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro", `{"reviewers": ["rae"]}`, "vic", "Viewer"); code != http.StatusForbidden {
+		t.Errorf("viewer request: status %d, want 403", code)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro", `{"reviewers": ["ann"]}`, "ann", "Editor"); code != http.StatusBadRequest {
+		t.Errorf("self review: status %d, want 400", code)
+	}
+	code, review := serve(http.MethodPost, "/guide-reviews/intro", `{"reviewers": ["rae"]}`, "ann", "Editor")
+	if code != http.StatusOK || review.Author != "ann" || review.State != reviewStatePending || review.Publishable {
+		t.Fatalf("request: status %d, review %+v", code, review)
+	}
+
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro/comments", `{"body": "Looks fine"}`, "eve", "Editor"); code != http.StatusForbidden {
+		t.Errorf("outsider comment: status %d, want 403", code)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro/comments", `{"body": "Step 3 is unclear"}`, "rae", "Editor"); code != http.StatusOK {
+		t.Errorf("reviewer comment: status %d", code)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro/approve", `{}`, "rae", "Editor"); code != http.StatusForbidden {
+		t.Errorf("reviewer approve: status %d, want 403", code)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro/request-changes", `{}`, "rae", "Editor"); code != http.StatusBadRequest {
+		t.Errorf("request changes without body: status %d, want 400", code)
+	}
+	code, review = serve(http.MethodPost, "/guide-reviews/intro/request-changes", `{"body": "Fix step 3"}`, "rae", "Editor")
+	if code != http.StatusOK || review.State != reviewStateChangesRequested || len(review.Comments) != 2 {
+		t.Fatalf("request changes: status %d, review %+v", code, review)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro/approve", `{}`, "lee", "Editor"); code != http.StatusConflict {
+		t.Errorf("approve with changes requested: status %d, want 409", code)
+	}
+
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro", `{"reviewers": ["rae"]}`, "rae", "Editor"); code != http.StatusForbidden {
+		t.Errorf("re-request by reviewer: status %d, want 403", code)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/intro", `{"reviewers": ["rae", "lee"]}`, "ann", "Editor"); code != http.StatusOK {
+		t.Fatalf("re-request: status %d", code)
+	}
+	if _, review := serve(http.MethodGet, "/guide-reviews/intro", "", "lee", "Editor"); !review.CanApprove {
+		t.Errorf("approver canApprove = false")
+	}
+	code, review = serve(http.MethodPost, "/guide-reviews/intro/approve", `{"body": "Ship it"}`, "lee", "Editor")
+	if code != http.StatusOK || review.State != reviewStateApproved || review.ApprovedBy != "lee" || !review.Publishable {
+		t.Fatalf("approve: status %d, review %+v", code, review)
+	}
+
+	app.settings.GuideApproverTeams = []string{"docs-leads", "authors"}
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{userTeams: map[string][]string{"ann": {"authors"}}})
+	if code, _ := serve(http.MethodPost, "/guide-reviews/other", `{}`, "ann", "Editor"); code != http.StatusOK {
+		t.Fatalf("request other: status %d", code)
+	}
+	if code, _ := serve(http.MethodPost, "/guide-reviews/other/approve", `{}`, "ann", "Editor"); code != http.StatusForbidden {
+		t.Errorf("author approve: status %d, want 403", code)
+	}
+
+	w := httptest.NewRecorder()
+	app.handleGuideReviewList(w, roleRequest(http.MethodGet, "/guide-reviews?state=approved", "", "ann", "Editor"))
+	var list struct {
+		Reviews []guideReview `json:"reviews"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Reviews) != 1 || list.Reviews[0].GuideID != "intro" {
+		t.Errorf("approved reviews = %+v", list.Reviews)
+	}
+
+	if code, _ := serve(http.MethodDelete, "/guide-reviews/other", "", "lee", "Editor"); code != http.StatusForbidden {
+		t.Errorf("withdraw by other: status %d, want 403", code)
+	}
+	if code, _ := serve(http.MethodDelete, "/guide-reviews/other", "", "ann", "Editor"); code != http.StatusNoContent {
+		t.Errorf("withdraw: status %d, want 204", code)
+	}
+	if code, _ := serve(http.MethodGet, "/guide-reviews/other", "", "ann", "Editor"); code != http.StatusNotFound {
+		t.Errorf("withdrawn: status %d, want 404", code)
+	}
+}
+
+func TestCustomGuide_HidesUnapprovedGuides(t *testing.T) {
+	withGuideLister(t, singlePageGuideLister(
+		guideEntry("approved", "Approved", "published", "guide"),
+		guideEntry("unreviewed", "Unreviewed", "published", "guide"),
+		guideEntry("wip", "Work in progress", "draft", "guide"),
+	))
+	app := newTestApp(t)
+	_ = app.store.put(guideReviewCollection, "approved", guideReview{GuideID: "approved", State: reviewStateApproved})
+
+	ids := func() []string {
+		t.Helper()
+		r := customGuideRequest(t, "/custom-guide-repository", "user:1")
+		pc := backend.PluginConfigFromContext(r.Context())
+		pc.User = &backend.User{Login: "ann", Role: "Viewer"}
+		r = r.WithContext(backend.WithPluginContext(r.Context(), pc))
+		w := httptest.NewRecorder()
+		app.handleCustomGuideRepository(w, r)
+		var resp customGuideRepositoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, g := range resp.Guides {
+			ids = append(ids, g.ID)
+		}
+		return ids
+	}
+
+	if got := ids(); len(got) != 3 {
+		t.Errorf("approval off: guides = %v", got)
+	}
+	app.settings = &Settings{GuideApprovalRequired: true}
+	if got := ids(); len(got) != 2 || got[0] != "approved" || got[1] != "wip" {
+		t.Errorf("approval on: guides = %v", got)
+	}
+}
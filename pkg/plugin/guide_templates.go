@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Guide → VM template mapping.
+//
+// Guide blocks can already name a template (vmTemplate), but a terminal opened
+// from a guide without one always got the default vm-aws. Admins can map a
+// guide ID to the template (and config) that guide needs; the frontend then
+// connects with
+//
+//	terminal/{vmId}/{nonce}/guide.{guideId}
+//
+// and RunStream provisions from the mapping, falling back to the default
+// template when the guide has none. An explicit template segment still wins,
+// so block-level metadata keeps working unchanged.
+
+const (
+	guideTemplateCollection = "guide-templates"
+
+	// guideTemplateChannelPrefix marks a Live channel template segment as a
+	// guide ID to look up rather than a template name.
+	guideTemplateChannelPrefix = "guide."
+)
+
+var (
+	// guideIDPattern matches the characters Grafana Live allows in a channel
+	// segment; the frontend replaces anything else before connecting.
+	guideIDPattern      = regexp.MustCompile(`^[A-Za-z0-9_=.-]{1,200}$`)
+	vmTemplateIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+	errGuideTemplateNotFound = errors.New("guide template mapping not found")
+)
+
+// guideTemplate is the persisted guide → template mapping.
+type guideTemplate struct {
+	GuideID   string                 `json:"guideId"`
+	Template  string                 `json:"template"`
+	Config    map[string]interface{} `json:"config,omitempty"`
+	UpdatedBy string                 `json:"updatedBy"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+}
+
+// PutGuideTemplateRequest is the JSON body for PUT /guide-templates/{guideId}.
+type PutGuideTemplateRequest struct {
+	Template string                 `json:"template" validate:"required,pattern=template"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+}
+
+// guideIDFromTemplateSegment returns the guide ID encoded in a Live channel
+// template segment, or "" when the segment names a template directly.
+func guideIDFromTemplateSegment(segment string) string {
+	if !strings.HasPrefix(segment, guideTemplateChannelPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(segment, guideTemplateChannelPrefix)
+}
+
+// getGuideTemplate loads the mapping for guideID.
+func (a *App) getGuideTemplate(guideID string) (*guideTemplate, error) {
+	var gt guideTemplate
+	ok, err := a.store.get(guideTemplateCollection, guideID, &gt)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errGuideTemplateNotFound
+	}
+	return &gt, nil
+}
+
+// guideVMRequestOpts returns the VM request options mapped to guideID. Guides
+// without a mapping get the zero value, i.e. the default template.
+func (a *App) guideVMRequestOpts(guideID string) vmRequestOpts {
+	gt, err := a.getGuideTemplate(guideID)
+	if err != nil {
+		return vmRequestOpts{}
+	}
+	return vmRequestOpts{template: gt.Template, config: gt.Config}
+}
+
+// listGuideTemplates returns every mapping, sorted by guide ID.
+func (a *App) listGuideTemplates() []guideTemplate {
+	result := []guideTemplate{}
+	for _, key := range a.store.keys(guideTemplateCollection) {
+		var gt guideTemplate
+		if ok, err := a.store.get(guideTemplateCollection, key, &gt); err != nil || !ok {
+			continue
+		}
+		result = append(result, gt)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GuideID < result[j].GuideID })
+	return result
+}
+
+// handleGuideTemplates handles GET /guide-templates.
+func (a *App) handleGuideTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	a.writeJSON(w, map[string]interface{}{"mappings": a.listGuideTemplates()}, http.StatusOK)
+}
+
+// handleGuideTemplateByID handles GET/PUT/DELETE /guide-templates/{guideId}.
+// PUT and DELETE require the Admin role.
+func (a *App) handleGuideTemplateByID(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	guideID := strings.TrimPrefix(r.URL.Path, "/guide-templates/")
+	if !guideIDPattern.MatchString(guideID) {
+		a.writeError(w, "Guide ID must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		gt, err := a.getGuideTemplate(guideID)
+		if errors.Is(err, errGuideTemplateNotFound) {
+			a.writeError(w, "No template mapping for this guide", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			a.writeError(w, "Failed to load template mapping", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, gt, http.StatusOK)
+	case http.MethodPut:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can change guide template mappings", http.StatusForbidden)
+			return
+		}
+		a.handlePutGuideTemplate(w, r, user, guideID)
+	case http.MethodDelete:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can change guide template mappings", http.StatusForbidden)
+			return
+		}
+		if err := a.store.delete(guideTemplateCollection, guideID); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to delete guide template mapping", "guideId", guideID, "error", err)
+			a.writeError(w, "Failed to delete template mapping", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handlePutGuideTemplate(w http.ResponseWriter, r *http.Request, user, guideID string) {
+	var req PutGuideTemplateRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+
+	gt := guideTemplate{
+		GuideID:   guideID,
+		Template:  req.Template,
+		Config:    req.Config,
+		UpdatedBy: user,
+		UpdatedAt: timeNow().UTC(),
+	}
+	if err := a.store.put(guideTemplateCollection, guideID, gt); err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to persist guide template mapping", "guideId", guideID, "error", err)
+		a.writeError(w, "Failed to save template mapping", http.StatusInternalServerError)
+		return
+	}
+	a.ctxLogger(r.Context()).Info("Updated guide template mapping", "guideId", guideID, "template", gt.Template, "user", user)
+	a.writeJSON(w, gt, http.StatusOK)
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuideIDFromTemplateSegment(t *testing.T) {
+	cases := map[string]string{
+		"guide.docs-alloy-intro": "docs-alloy-intro",
+		"guide.":                 "",
+		"vm-aws-sample-app":      "",
+	}
+	for in, want := range cases {
+		if got := guideIDFromTemplateSegment(in); got != want {
+			t.Errorf("guideIDFromTemplateSegment(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHandleGuideTemplates_AdminCRUD(t *testing.T) {
+	app := newTestApp(t)
+	body := `{"template":"vm-aws-sample-app","config":{"app":"nginx"}}`
+
+	rr := httptest.NewRecorder()
+	app.handleGuideTemplateByID(rr, roleRequest(http.MethodPut, "/guide-templates/docs-nginx", body, "alice", "Editor"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("editor put: got %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleGuideTemplateByID(rr, roleRequest(http.MethodPut, "/guide-templates/docs-nginx", body, "admin", "Admin"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("admin put: got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleGuideTemplates(rr, roleRequest(http.MethodGet, "/guide-templates", "", "alice", "Viewer"))
+	var list struct {
+		Mappings []guideTemplate `json:"mappings"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Mappings) != 1 || list.Mappings[0].Template != "vm-aws-sample-app" || list.Mappings[0].UpdatedBy != "admin" {
+		t.Errorf("list = %+v", list.Mappings)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleGuideTemplateByID(rr, roleRequest(http.MethodDelete, "/guide-templates/docs-nginx", "", "admin", "Admin"))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	app.handleGuideTemplateByID(rr, roleRequest(http.MethodGet, "/guide-templates/docs-nginx", "", "alice", "Viewer"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleGuideTemplates_Validation(t *testing.T) {
+	app := newTestApp(t)
+	cases := []struct{ target, body string }{
+		{"/guide-templates/has:colon", `{"template":"vm-aws"}`},
+		{"/guide-templates/ok", `not json`},
+		{"/guide-templates/ok", `{"template":""}`},
+		{"/guide-templates/ok", `{"template":"VM AWS"}`},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		app.handleGuideTemplateByID(rr, roleRequest(http.MethodPut, tc.target, tc.body, "admin", "Admin"))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: got %d, want %d", tc.target, tc.body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGuideVMRequestOpts(t *testing.T) {
+	app := newTestApp(t)
+	if opts := app.guideVMRequestOpts("unmapped"); opts.template != "" || opts.config != nil {
+		t.Errorf("unmapped guide = %+v, want default options", opts)
+	}
+
+	_ = app.store.put(guideTemplateCollection, "alloy-101", guideTemplate{
+		GuideID:  "alloy-101",
+		Template: "vm-aws-alloy-scenario",
+		Config:   map[string]interface{}{"scenario": "otel-examples/cost-control"},
+	})
+	opts := app.guideVMRequestOpts("alloy-101")
+	if opts.template != "vm-aws-alloy-scenario" || opts.scenarioName() != "otel-examples/cost-control" {
+		t.Errorf("mapped guide = %+v", opts)
+	}
+}
@@ -0,0 +1,307 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Machine translation.
+//
+// With translationApiUrl set, the block editor calls POST
+// /guides/{name}/translations after saving a guide, and a job is queued per
+// target locale (Settings.GuideLocales unless the request names some). A
+// worker sends each job to the translation API and stores the result as a
+// draft variant (guide_locales.go) for a person to review and publish.
+// When the locale already has a published variant, or a draft someone wrote,
+// the result is attached to it as a proposal instead, so learners keep the
+// published text and nobody's edits are overwritten. A newer save replaces
+// a locale's queued job. Failed jobs are retried with backoff and dropped
+// after maxTranslationAttempts.
+//
+// The API receives POST {sourceLocale, targetLocale, title, content}, with
+// content the guide JSON, and returns {title, content} translated.
+
+const (
+	translationJobCollection    = "translation-jobs"
+	maxTranslationJobs          = 1000
+	maxTranslationAttempts      = 5
+	translationCheckInterval    = time.Minute
+	translationJobsPerRun       = 20
+	translationRequestTimeout   = 60 * time.Second
+	maxTranslationResponseBytes = 2 << 20
+)
+
+// translationJob is a queued translation of a guide, keyed guide/locale.
+type translationJob struct {
+	Guide         string          `json:"guide"`
+	Locale        string          `json:"locale"`
+	Title         string          `json:"title"`
+	Content       json.RawMessage `json:"content,omitempty"`
+	RequestedBy   string          `json:"requestedBy"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError,omitempty"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+}
+
+// guideLocaleProposal is a machine translation waiting for review on a
+// variant it couldn't replace.
+type guideLocaleProposal struct {
+	Title        string          `json:"title"`
+	Content      json.RawMessage `json:"content"`
+	TranslatedAt time.Time       `json:"translatedAt"`
+}
+
+// TranslationRequest is the JSON body for POST /guides/{name}/translations:
+// the saved guide.
+type TranslationRequest struct {
+	Title   string          `json:"title" validate:"required,max=200"`
+	Content json.RawMessage `json:"content" validate:"required,max=1048576"`
+	Locales []string        `json:"locales,omitempty" validate:"max=50"`
+}
+
+type translationAPIRequest struct {
+	SourceLocale string          `json:"sourceLocale"`
+	TargetLocale string          `json:"targetLocale"`
+	Title        string          `json:"title"`
+	Content      json.RawMessage `json:"content"`
+}
+
+type translationAPIResponse struct {
+	Title   string          `json:"title"`
+	Content json.RawMessage `json:"content"`
+}
+
+// translate sends job to the translation API.
+func (a *App) translate(ctx context.Context, job translationJob) (translationAPIResponse, error) {
+	raw, err := json.Marshal(translationAPIRequest{SourceLocale: a.guideSourceLocale(), TargetLocale: job.Locale, Title: job.Title, Content: job.Content})
+	if err != nil {
+		return translationAPIResponse{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, translationRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.settings.TranslationAPIURL, bytes.NewReader(raw))
+	if err != nil {
+		return translationAPIResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.settings.TranslationAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.settings.TranslationAPIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return translationAPIResponse{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return translationAPIResponse{}, fmt.Errorf("translation API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var out translationAPIResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTranslationResponseBytes)).Decode(&out); err != nil {
+		return translationAPIResponse{}, fmt.Errorf("decode translation: %w", err)
+	}
+	if out.Title == "" || !strings.HasPrefix(strings.TrimSpace(string(out.Content)), "{") {
+		return translationAPIResponse{}, fmt.Errorf("translation API returned no title or guide content")
+	}
+	return out, nil
+}
+
+// storeMachineTranslation stores a translation as a draft variant, or as a
+// proposal on a variant a person published or wrote. A translation the scan
+// flags is quarantined instead (guide_quarantine.go).
+func (a *App) storeMachineTranslation(job translationJob, out translationAPIResponse) error {
+	a.guideLocalesMu.Lock()
+	defer a.guideLocalesMu.Unlock()
+	if findings := a.guideScanner().scan(out.Content); len(findings) > 0 {
+		return a.quarantineGuide(quarantinedGuide{
+			Guide: job.Guide, Locale: job.Locale, Source: quarantineSourceMachine, Title: out.Title, Status: guideLocaleDraft,
+			Content: out.Content, Findings: findings, SubmittedBy: job.RequestedBy, SubmittedAt: timeNow().UTC(),
+		})
+	}
+	return a.saveMachineTranslation(job, out)
+}
+
+// saveMachineTranslation does storeMachineTranslation's store. The caller
+// holds guideLocalesMu.
+func (a *App) saveMachineTranslation(job translationJob, out translationAPIResponse) error {
+	now := timeNow().UTC()
+	key := job.Guide + "/" + job.Locale
+	var v guideLocaleVariant
+	ok, err := a.store.get(guideLocaleCollection, key, &v)
+	if err != nil {
+		return err
+	}
+	if ok && (v.Status == guideLocalePublished || !v.Machine) {
+		v.Proposal = &guideLocaleProposal{Title: out.Title, Content: out.Content, TranslatedAt: now}
+	} else {
+		v = guideLocaleVariant{Guide: job.Guide, Locale: job.Locale, Title: out.Title, Status: guideLocaleDraft, Machine: true, Content: out.Content, UpdatedBy: job.RequestedBy, UpdatedAt: now}
+	}
+	return a.store.put(guideLocaleCollection, key, v)
+}
+
+// runTranslationJobs works through the jobs that are due, oldest first.
+func (a *App) runTranslationJobs(ctx context.Context, logger log.Logger) {
+	if a.settings == nil || a.settings.TranslationAPIURL == "" {
+		return
+	}
+	now := timeNow()
+	var due []translationJob
+	for _, key := range a.store.keys(translationJobCollection) {
+		var job translationJob
+		if ok, err := a.store.get(translationJobCollection, key, &job); err == nil && ok && !job.NextAttemptAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RequestedAt.Before(due[j].RequestedAt) })
+	for _, job := range due[:min(len(due), translationJobsPerRun)] {
+		if ctx.Err() != nil {
+			return
+		}
+		out, err := a.translate(ctx, job)
+		if err == nil {
+			err = a.storeMachineTranslation(job, out)
+		}
+		a.finishTranslationJob(logger, job, err)
+	}
+}
+
+// finishTranslationJob removes job, or reschedules it after a failure,
+// unless a newer save has replaced it meanwhile.
+func (a *App) finishTranslationJob(logger log.Logger, job translationJob, jobErr error) {
+	a.translationJobsMu.Lock()
+	defer a.translationJobsMu.Unlock()
+	key := job.Guide + "/" + job.Locale
+	var current translationJob
+	if ok, err := a.store.get(translationJobCollection, key, &current); err != nil || !ok || !current.RequestedAt.Equal(job.RequestedAt) {
+		return
+	}
+	if jobErr == nil {
+		logger.Info("Stored machine translation for review", "guide", job.Guide, "locale", job.Locale)
+		_ = a.store.delete(translationJobCollection, key)
+		return
+	}
+	job.Attempts++
+	if job.Attempts >= maxTranslationAttempts {
+		logger.Error("Giving up on machine translation", "guide", job.Guide, "locale", job.Locale, "attempts", job.Attempts, "error", jobErr)
+		_ = a.store.delete(translationJobCollection, key)
+		return
+	}
+	logger.Warn("Machine translation failed, retrying", "guide", job.Guide, "locale", job.Locale, "attempts", job.Attempts, "error", jobErr)
+	job.LastError = jobErr.Error()
+	job.NextAttemptAt = timeNow().Add(time.Duration(job.Attempts) * translationCheckInterval)
+	if err := a.store.put(translationJobCollection, key, job); err != nil {
+		logger.Error("Failed to reschedule machine translation", "guide", job.Guide, "locale", job.Locale, "error", err)
+	}
+}
+
+// startTranslationWorker runs queued translation jobs every
+// translationCheckInterval.
+func (a *App) startTranslationWorker() {
+	a.runEvery(translationCheckInterval, func(ctx context.Context) {
+		a.runTranslationJobs(ctx, a.logger)
+	})
+}
+
+// handleGuideTranslations handles POST (queue translations of the saved
+// guide) and GET (the queued jobs) on /guides/{name}/translations, for
+// editors.
+func (a *App) handleGuideTranslations(w http.ResponseWriter, r *http.Request, guide string) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can translate guides", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		jobs := []translationJob{}
+		for _, key := range a.store.keys(translationJobCollection) {
+			var job translationJob
+			if strings.HasPrefix(key, guide+"/") {
+				if ok, err := a.store.get(translationJobCollection, key, &job); err == nil && ok {
+					job.Content = nil
+					jobs = append(jobs, job)
+				}
+			}
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Locale < jobs[j].Locale })
+		a.writeJSON(w, map[string]interface{}{"jobs": jobs}, http.StatusOK)
+	case http.MethodPost:
+		if a.settings == nil || a.settings.TranslationAPIURL == "" {
+			a.writeError(w, "Machine translation is not configured", http.StatusConflict)
+			return
+		}
+		var req TranslationRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if !strings.HasPrefix(strings.TrimSpace(string(req.Content)), "{") {
+			a.writeError(w, "content must be the guide's JSON object", http.StatusBadRequest)
+			return
+		}
+		requested := req.Locales
+		if len(requested) == 0 {
+			requested = a.settings.GuideLocales
+		}
+		source := a.guideSourceLocale()
+		var locales []string
+		for _, l := range requested {
+			canonical := canonicalLocale(l)
+			if canonical == "" {
+				a.writeError(w, fmt.Sprintf("%q is not a language tag such as en or pt-BR", l), http.StatusBadRequest)
+				return
+			}
+			if canonical != source && !slices.Contains(locales, canonical) {
+				locales = append(locales, canonical)
+			}
+		}
+		if len(locales) == 0 {
+			a.writeError(w, "No target locales: name them or set guideLocales", http.StatusBadRequest)
+			return
+		}
+
+		a.translationJobsMu.Lock()
+		defer a.translationJobsMu.Unlock()
+		queued := 0
+		for _, l := range locales {
+			if ok, _ := a.store.get(translationJobCollection, guide+"/"+l, &translationJob{}); !ok {
+				queued++
+			}
+		}
+		if len(a.store.keys(translationJobCollection))+queued > maxTranslationJobs {
+			a.writeError(w, fmt.Sprintf("At most %d translations can be queued", maxTranslationJobs), http.StatusConflict)
+			return
+		}
+		now := timeNow().UTC()
+		for _, l := range locales {
+			job := translationJob{Guide: guide, Locale: l, Title: req.Title, Content: req.Content, RequestedBy: user, RequestedAt: now, NextAttemptAt: now}
+			if err := a.store.put(translationJobCollection, guide+"/"+l, job); err != nil {
+				a.ctxLogger(ctx).Error("Failed to queue translation", "guide", guide, "locale", l, "error", err)
+				a.writeError(w, "Failed to queue the translation", http.StatusInternalServerError)
+				return
+			}
+		}
+		a.writeJSON(w, map[string]interface{}{"locales": locales}, http.StatusAccepted)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestGuideTranslations(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 4, 2, 9, 0, 0, 0, time.UTC))
+	var gotAuth string
+	failing := map[string]bool{"ja": true}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		var req translationAPIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if failing[req.TargetLocale] {
+			http.Error(w, "unsupported language", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(translationAPIResponse{Title: req.Title + " (" + req.TargetLocale + ")", Content: req.Content})
+	}))
+	defer api.Close()
+
+	app := newTestApp(t)
+	app.settings = &Settings{GuideLocales: []string{"es", "de", "ja"}}
+	serve := func(method, body, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleGuideByName(w, roleRequest(method, "/guides/intro/translations", body, "ed", role))
+		return w
+	}
+	const saved = `{"title": "Intro", "content": {"blocks": [{"type": "markdown", "content": "Hello"}]}}`
+
+	if w := serve(http.MethodPost, saved, "Editor"); w.Code != http.StatusConflict {
+		t.Errorf("unconfigured: status %d, want 409", w.Code)
+	}
+	app.settings.TranslationAPIURL, app.settings.TranslationAPIKey = api.URL, "secret"
+	if w := serve(http.MethodPost, saved, "Viewer"); w.Code != http.StatusForbidden {
+		t.Errorf("viewer: status %d, want 403", w.Code)
+	}
+	_ = app.store.put(guideLocaleCollection, "intro/de", guideLocaleVariant{Guide: "intro", Locale: "de", Title: "Einführung", Status: guideLocalePublished, Content: json.RawMessage(`{"blocks": []}`)})
+	if w := serve(http.MethodPost, saved, "Editor"); w.Code != http.StatusAccepted {
+		t.Fatalf("queue: status %d: %s", w.Code, w.Body)
+	}
+
+	app.runTranslationJobs(t.Context(), log.DefaultLogger)
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	var es guideLocaleVariant
+	if ok, _ := app.store.get(guideLocaleCollection, "intro/es", &es); !ok || es.Status != guideLocaleDraft || !es.Machine || es.Title != "Intro (es)" {
+		t.Errorf("es variant = %+v", es)
+	}
+	var de guideLocaleVariant
+	_, _ = app.store.get(guideLocaleCollection, "intro/de", &de)
+	if de.Status != guideLocalePublished || de.Title != "Einführung" || de.Proposal == nil || de.Proposal.Title != "Intro (de)" {
+		t.Errorf("published de variant = %+v", de)
+	}
+
+	var queue struct {
+		Jobs []translationJob `json:"jobs"`
+	}
+	if err := json.Unmarshal(serve(http.MethodGet, "", "Editor").Body.Bytes(), &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Jobs) != 1 || queue.Jobs[0].Locale != "ja" || queue.Jobs[0].Attempts != 1 || !strings.Contains(queue.Jobs[0].LastError, "unsupported language") {
+		t.Fatalf("queue = %+v", queue.Jobs)
+	}
+
+	// The retry waits for its backoff, and the job is dropped after the
+	// last attempt.
+	app.runTranslationJobs(t.Context(), log.DefaultLogger)
+	var ja translationJob
+	_, _ = app.store.get(translationJobCollection, "intro/ja", &ja)
+	if ja.Attempts != 1 {
+		t.Errorf("retried before backoff: attempts %d", ja.Attempts)
+	}
+	for i := 0; i < maxTranslationAttempts; i++ {
+		withFrozenTime(t, timeNow().Add(time.Hour))
+		app.runTranslationJobs(t.Context(), log.DefaultLogger)
+	}
+	if keys := app.store.keys(translationJobCollection); len(keys) != 0 {
+		t.Errorf("jobs left = %v", keys)
+	}
+
+	// Once a person saves the draft, the next machine translation becomes a
+	// proposal.
+	if w := serve(http.MethodPost, `{"title": "Intro v2", "content": {"blocks": []}, "locales": ["es-es", "en"]}`, "Editor"); w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"es-ES"`) || strings.Contains(w.Body.String(), `"en"`) {
+		t.Fatalf("queue es-ES: status %d: %s", w.Code, w.Body)
+	}
+	w := httptest.NewRecorder()
+	app.handleGuideByName(w, roleRequest(http.MethodPut, "/guides/intro/locales/es", `{"title": "Introducción", "status": "draft", "content": {"blocks": []}}`, "ed", "Editor"))
+	_ = app.store.put(translationJobCollection, "intro/es", translationJob{Guide: "intro", Locale: "es", Title: "Intro v2", Content: json.RawMessage(`{}`), RequestedAt: timeNow()})
+	app.runTranslationJobs(t.Context(), log.DefaultLogger)
+	es = guideLocaleVariant{}
+	_, _ = app.store.get(guideLocaleCollection, "intro/es", &es)
+	if es.Machine || es.Title != "Introducción" || es.Proposal == nil || es.Proposal.Title != "Intro v2 (es)" {
+		t.Errorf("reviewed es variant = %+v", es)
+	}
+}
@@ -1,14 +1,83 @@
 package plugin
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
 // newTestApp builds a minimal App for tests that only exercise resource
-// handlers — no Coda client, no settings, just a logger.
+// handlers — no Coda client, no settings, just a logger and a memory store.
 func newTestApp(t *testing.T) *App {
 	t.Helper()
-	return &App{logger: log.DefaultLogger}
+	return &App{logger: log.DefaultLogger, store: newMemoryStore()}
+}
+
+// waitBackground waits for the background work app has started so far.
+func waitBackground(app *App) {
+	app.background.wg.Wait()
+}
+
+// withUser returns r carrying an SDK plugin context for login, mirroring what
+// httpadapter does for real requests.
+func withUser(r *http.Request, login string) *http.Request {
+	pluginCtx := backend.PluginContext{User: &backend.User{Login: login, Name: login}}
+	return r.WithContext(backend.WithPluginContext(r.Context(), pluginCtx))
+}
+
+// roleRequest builds a request for user carrying the given Grafana org role.
+func roleRequest(method, target, body, user, role string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	pluginCtx := backend.PluginContext{User: &backend.User{Login: user, Name: user, Role: role}}
+	return r.WithContext(backend.WithPluginContext(r.Context(), pluginCtx))
+}
+
+// streamRecorder captures the TerminalStreamOutput messages sent on a stream.
+type streamRecorder struct {
+	t        *testing.T
+	mu       sync.Mutex
+	messages []TerminalStreamOutput
+}
+
+func newStreamRecorder(t *testing.T) (*streamRecorder, *backend.StreamSender) {
+	rec := &streamRecorder{t: t}
+	return rec, backend.NewStreamSender(rec)
+}
+
+func (r *streamRecorder) Send(p *backend.StreamPacket) error {
+	raw, err := unwrapTerminalFrame(p.Data)
+	if err != nil {
+		r.t.Errorf("decode frame: %v", err)
+		return nil
+	}
+	msg, err := parseTerminalOutput(raw)
+	if err != nil {
+		r.t.Errorf("decode message %q: %v", raw, err)
+		return nil
+	}
+	r.mu.Lock()
+	r.messages = append(r.messages, msg)
+	r.mu.Unlock()
+	return nil
+}
+
+// ofType returns the recorded messages with the given type.
+func (r *streamRecorder) ofType(typ string) []TerminalStreamOutput {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []TerminalStreamOutput
+	for _, m := range r.messages {
+		if m.Type == typ {
+			out = append(out, m)
+		}
+	}
+	return out
 }
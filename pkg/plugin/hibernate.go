@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// VM hibernation.
+//
+// Instead of letting an idle sandbox run until Coda expires and destroys it,
+// a connected VM that sees no terminal input for Settings.VMHibernateIdleMinutes
+// is stopped (Coda keeps its disk) and the stream is closed. The VM stays in
+// the user's tracking map and workspace records, so the next connection finds
+// it in "stopped" and waitForVMActive resumes it transparently.
+
+// hibernateCheckInterval is how often a connected session is checked for idleness.
+const hibernateCheckInterval = 30 * time.Second
+
+// hibernateIdleTimeout returns the configured idle threshold, or 0 when
+// hibernation is disabled.
+func (a *App) hibernateIdleTimeout() time.Duration {
+	if a.settings == nil || a.settings.VMHibernateIdleMinutes <= 0 {
+		return 0
+	}
+	return time.Duration(a.settings.VMHibernateIdleMinutes) * time.Minute
+}
+
+// hibernateWhenIdle stops the session's VM and ends the stream once the
+// session has been idle for limit. A failed stop leaves the session running
+// and is retried after another full idle period.
+func (a *App) hibernateWhenIdle(ctx context.Context, sess *streamSession, limit time.Duration, ctxLogger log.Logger) {
+	ticker := time.NewTicker(hibernateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if sess.idleFor() < limit {
+				continue
+			}
+			ctxLogger.Info("Hibernating idle VM", "vmID", sess.vmID, "userLogin", sess.userLogin, "idle", sess.idleFor().String())
+			sendStreamStatusWithVmId(sess.sender, "stopping", statusMessageForState("stopping"), sess.vmID)
+			if err := a.coda.StopVM(ctx, sess.vmID); err != nil {
+				ctxLogger.Warn("Failed to hibernate idle VM", "vmID", sess.vmID, "error", err)
+				sess.touch()
+				continue
+			}
+			a.loki.event(sess.logLabels, "VM hibernated after %s idle", sess.idleFor().Round(time.Second))
+			sendStreamError(withCorrelationID(context.Background(), sess.id), sess.sender, "VM hibernated after inactivity. Press Connect to resume.")
+			sess.cancel()
+			return
+		}
+	}
+}
+
+// handleVMPowerAction handles POST /vms/{id}/stop and POST /vms/{id}/start.
+// Users can only stop and start their own VMs; admins can act on any.
+func (a *App) handleVMPowerAction(w http.ResponseWriter, r *http.Request, vmID, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.coda == nil {
+		a.writeError(w, "Coda not registered - configure enrollment key and register first", http.StatusServiceUnavailable)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) && !a.userOwnsVM(user, vmID) {
+		a.writeError(w, "VM not found", http.StatusNotFound)
+		return
+	}
+
+	ctxLogger := a.ctxLogger(r.Context())
+	ctxLogger.Info("VM power action", "vmID", vmID, "action", action)
+
+	var err error
+	if action == "stop" {
+		err = a.coda.StopVM(r.Context(), vmID)
+	} else {
+		err = a.coda.StartVM(r.Context(), vmID)
+	}
+	if err != nil {
+		ctxLogger.Error("VM power action failed", "vmID", vmID, "action", action, "error", err)
+		switch {
+		case strings.Contains(err.Error(), "authentication failed"):
+			a.writeError(w, err.Error(), http.StatusUnauthorized)
+		case strings.Contains(err.Error(), "not found"):
+			a.writeError(w, err.Error(), http.StatusNotFound)
+		case strings.Contains(err.Error(), "VM conflict"):
+			a.writeError(w, err.Error(), http.StatusConflict)
+		default:
+			a.writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// userOwnsVM reports whether vmID is user's assigned VM or is bound to one
+// of their workspaces. Both survive hibernation, so a stopped VM is found.
+func (a *App) userOwnsVM(user, vmID string) bool {
+	a.userVMsMu.Lock()
+	assigned := a.userVMs[user] == vmID
+	a.userVMsMu.Unlock()
+	return assigned || a.workspaceVMIDs(user)[vmID]
+}
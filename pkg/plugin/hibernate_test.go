@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCodaClient(t *testing.T, handler http.HandlerFunc) *CodaClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := NewCodaClient(srv.URL, "refresh")
+	c.accessToken = "token"
+	c.tokenExpiry = time.Now().Add(time.Hour)
+	return c
+}
+
+func TestCodaClient_StopStartVM(t *testing.T) {
+	var gotMethod, gotPath string
+	c := newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	if err := c.StopVM(context.Background(), "vm-1"); err != nil {
+		t.Fatalf("StopVM: %v", err)
+	}
+	if gotMethod != http.MethodPost || gotPath != "/api/v1/vms/vm-1/stop" {
+		t.Errorf("StopVM sent %s %s", gotMethod, gotPath)
+	}
+	if err := c.StartVM(context.Background(), "vm-1"); err != nil {
+		t.Fatalf("StartVM: %v", err)
+	}
+	if gotPath != "/api/v1/vms/vm-1/start" {
+		t.Errorf("StartVM sent %s", gotPath)
+	}
+}
+
+func TestCodaClient_StopVMErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		check  func(error) bool
+	}{
+		{http.StatusNotFound, isVMNotFoundError},
+		{http.StatusUnauthorized, func(err error) bool { return err != nil && strings.Contains(err.Error(), "authentication failed") }},
+		{http.StatusConflict, func(err error) bool { return err != nil && strings.Contains(err.Error(), "VM conflict") }},
+	}
+	for _, tt := range tests {
+		c := newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})
+		if err := c.StopVM(context.Background(), "vm-1"); !tt.check(err) {
+			t.Errorf("status %d: unexpected error %v", tt.status, err)
+		}
+	}
+}
+
+func TestStreamSessionIdleFor(t *testing.T) {
+	advance := withFrozenTime(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	sess := &streamSession{}
+	sess.touch()
+
+	advance(10 * time.Minute)
+	if got := sess.idleFor(); got != 10*time.Minute {
+		t.Errorf("idleFor = %v, want 10m", got)
+	}
+	sess.touch()
+	if got := sess.idleFor(); got != 0 {
+		t.Errorf("idleFor after touch = %v, want 0", got)
+	}
+}
+
+func TestHibernateIdleTimeout(t *testing.T) {
+	app := newTestApp(t)
+	if got := app.hibernateIdleTimeout(); got != 0 {
+		t.Errorf("default timeout = %v, want disabled", got)
+	}
+	app.settings = &Settings{VMHibernateIdleMinutes: 20}
+	if got := app.hibernateIdleTimeout(); got != 20*time.Minute {
+		t.Errorf("timeout = %v, want 20m", got)
+	}
+}
+
+func TestHandleVMPowerAction(t *testing.T) {
+	app := newTestApp(t)
+
+	rr := httptest.NewRecorder()
+	app.handleVMByID(rr, httptest.NewRequest(http.MethodPost, "/vms/vm-1/stop", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("unregistered: got %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	var calls int
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusAccepted)
+	})
+	app.userVMs = map[string]string{"alice": "vm-1"}
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, roleRequest(http.MethodGet, "/vms/vm-1/start", "", "alice", "Viewer"))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET start: got %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, roleRequest(http.MethodPost, "/vms/vm-1/start", "", "alice", "Viewer"))
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("POST start: got %d, want %d", rr.Code, http.StatusAccepted)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, roleRequest(http.MethodPost, "/vms/vm-1/stop", "", "bob", "Viewer"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("another user's stop: got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+	if calls != 1 {
+		t.Errorf("Coda calls = %d, want 1 (bob's stop must not reach Coda)", calls)
+	}
+	rr = httptest.NewRecorder()
+	app.handleVMByID(rr, roleRequest(http.MethodPost, "/vms/vm-1/stop", "", "root", "Admin"))
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("admin stop: got %d, want %d", rr.Code, http.StatusAccepted)
+	}
+}
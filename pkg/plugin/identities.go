@@ -0,0 +1,214 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// External identities.
+//
+// Grafana logins differ between stacks, so reports and LMS statements can
+// use a corporate identity instead: an email and an employee ID per login.
+// Admins set them with PUT /admin/identities/{login}, or in bulk with PUT
+// /admin/identities from an HR or IdP export. Until an admin sets one, the
+// email Grafana has for the user (from SSO when it is used) is captured
+// when they record learning activity. xAPI statements identify the learner
+// by employee ID, else email, else login; usage export includes both.
+
+const (
+	identityCollection    = "identities"
+	maxIdentitiesPerBatch = 5000
+
+	identitySourceAdmin   = "admin"
+	identitySourceGrafana = "grafana"
+)
+
+var emailPattern = regexp.MustCompile(`^[^@\s]{1,64}@[^@\s]{1,190}$`)
+
+// externalIdentity is the stored identity for one login.
+type externalIdentity struct {
+	Login      string    `json:"login"`
+	Email      string    `json:"email,omitempty"`
+	EmployeeID string    `json:"employeeId,omitempty"`
+	Source     string    `json:"source"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// IdentityRequest is the JSON body for PUT /admin/identities/{login}; with
+// login, one item of a bulk update.
+type IdentityRequest struct {
+	Login      string `json:"login,omitempty" validate:"max=200"`
+	Email      string `json:"email,omitempty" validate:"pattern=email"`
+	EmployeeID string `json:"employeeId,omitempty" validate:"max=100"`
+}
+
+// BulkIdentityRequest is the JSON body for PUT /admin/identities.
+type BulkIdentityRequest struct {
+	Identities []IdentityRequest `json:"identities" validate:"required,max=5000"`
+}
+
+// identity returns the stored identity for login, if any.
+func (a *App) identity(login string) (externalIdentity, bool) {
+	var id externalIdentity
+	ok, err := a.store.get(identityCollection, login, &id)
+	return id, ok && err == nil
+}
+
+// captureIdentity stores the email Grafana has for the caller unless an
+// admin has set the caller's identity.
+func (a *App) captureIdentity(ctx context.Context, login string) {
+	u := backend.PluginConfigFromContext(ctx).User
+	if u == nil || !emailPattern.MatchString(u.Email) {
+		return
+	}
+	a.identitiesMu.Lock()
+	defer a.identitiesMu.Unlock()
+	id, ok := a.identity(login)
+	if ok && (id.Source == identitySourceAdmin || id.Email == u.Email) {
+		return
+	}
+	id = externalIdentity{Login: login, Email: u.Email, Source: identitySourceGrafana, UpdatedAt: timeNow().UTC()}
+	if err := a.store.put(identityCollection, login, id); err != nil {
+		a.ctxLogger(ctx).Warn("Failed to store identity", "user", login, "error", err)
+	}
+}
+
+// setIdentity stores an admin-set identity; an empty email and employee ID
+// removes it.
+func (a *App) setIdentity(login string, req IdentityRequest) (externalIdentity, error) {
+	id := externalIdentity{Login: login, Email: req.Email, EmployeeID: req.EmployeeID, Source: identitySourceAdmin, UpdatedAt: timeNow().UTC()}
+	if req.Email == "" && req.EmployeeID == "" {
+		return id, a.store.delete(identityCollection, login)
+	}
+	return id, a.store.put(identityCollection, login, id)
+}
+
+// handleAdminIdentities handles GET (list) and PUT (bulk update) on
+// /admin/identities.
+func (a *App) handleAdminIdentities(w http.ResponseWriter, r *http.Request) {
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage identities", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		identities := []externalIdentity{}
+		for _, login := range a.store.keys(identityCollection) {
+			if id, ok := a.identity(login); ok {
+				identities = append(identities, id)
+			}
+		}
+		sort.Slice(identities, func(i, j int) bool { return identities[i].Login < identities[j].Login })
+		a.writeJSON(w, map[string]interface{}{"identities": identities}, http.StatusOK)
+	case http.MethodPut:
+		var req BulkIdentityRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		for i, item := range req.Identities {
+			if errs := validateRequest(item); len(errs) > 0 {
+				a.writeError(w, fmt.Sprintf("Invalid request body: identities[%d].%s %s", i, errs[0].Field, errs[0].Message), http.StatusBadRequest)
+				return
+			}
+			if item.Login == "" || strings.Contains(item.Login, "/") {
+				a.writeError(w, fmt.Sprintf("Invalid request body: identities[%d].login must be a Grafana login", i), http.StatusBadRequest)
+				return
+			}
+		}
+		a.identitiesMu.Lock()
+		updated := 0
+		var err error
+		for _, item := range req.Identities {
+			if _, err = a.setIdentity(item.Login, item); err != nil {
+				break
+			}
+			updated++
+		}
+		a.identitiesMu.Unlock()
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store identities", "updated", updated, "error", err)
+			a.writeError(w, fmt.Sprintf("Failed to store identities after %d of %d", updated, len(req.Identities)), http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: admin, Action: "identity.import", Details: fmt.Sprintf("%d identities", updated)})
+		a.writeJSON(w, map[string]int{"updated": updated}, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminIdentity handles GET, PUT and DELETE on
+// /admin/identities/{login}.
+func (a *App) handleAdminIdentity(w http.ResponseWriter, r *http.Request) {
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage identities", http.StatusForbidden)
+		return
+	}
+	login := strings.TrimPrefix(r.URL.Path, "/admin/identities/")
+	if login == "" || strings.Contains(login, "/") {
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		id, ok := a.identity(login)
+		if !ok {
+			a.writeError(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, id, http.StatusOK)
+	case http.MethodPut:
+		var req IdentityRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		a.identitiesMu.Lock()
+		id, err := a.setIdentity(login, req)
+		a.identitiesMu.Unlock()
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store identity", "user", login, "error", err)
+			a.writeError(w, "Failed to store the identity", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: admin, Action: "identity.update", TargetUser: login})
+		a.writeJSON(w, id, http.StatusOK)
+	case http.MethodDelete:
+		a.identitiesMu.Lock()
+		_, ok := a.identity(login)
+		var err error
+		if ok {
+			err = a.store.delete(identityCollection, login)
+		}
+		a.identitiesMu.Unlock()
+		if !ok {
+			a.writeError(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to delete identity", "user", login, "error", err)
+			a.writeError(w, "Failed to delete the identity", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: admin, Action: "identity.delete", TargetUser: login})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
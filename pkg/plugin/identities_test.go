@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAdminIdentities(t *testing.T) {
+	app := newTestApp(t)
+	serve := func(h http.HandlerFunc, method, target, body, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(w, roleRequest(method, target, body, "admin", role))
+		return w
+	}
+
+	if w := serve(app.handleAdminIdentities, http.MethodGet, "/admin/identities", "", "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("editor: status %d, want 403", w.Code)
+	}
+	if w := serve(app.handleAdminIdentity, http.MethodPut, "/admin/identities/alice", `{"email": "not-an-email"}`, "Admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad email: status %d, want 400", w.Code)
+	}
+	w := serve(app.handleAdminIdentity, http.MethodPut, "/admin/identities/alice", `{"email": "alice@corp.example", "employeeId": "E1001"}`, "Admin")
+	if w.Code != http.StatusOK {
+		t.Fatalf("put: status %d: %s", w.Code, w.Body.String())
+	}
+	w = serve(app.handleAdminIdentities, http.MethodPut, "/admin/identities", `{"identities": [{"login": "bob", "employeeId": "E1002"}, {"login": "carol", "email": "carol@corp.example"}]}`, "Admin")
+	if w.Code != http.StatusOK || w.Body.String() != "{\"updated\":2}\n" {
+		t.Fatalf("bulk: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(app.handleAdminIdentities, http.MethodPut, "/admin/identities", `{"identities": [{"email": "dave@corp.example"}]}`, "Admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("bulk without login: status %d, want 400", w.Code)
+	}
+
+	w = serve(app.handleAdminIdentities, http.MethodGet, "/admin/identities", "", "Admin")
+	var list struct {
+		Identities []externalIdentity `json:"identities"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Identities) != 3 || list.Identities[0].EmployeeID != "E1001" || list.Identities[2].Email != "carol@corp.example" || list.Identities[1].Source != identitySourceAdmin {
+		t.Errorf("identities = %+v", list.Identities)
+	}
+
+	if w := serve(app.handleAdminIdentity, http.MethodDelete, "/admin/identities/bob", "", "Admin"); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", w.Code)
+	}
+	if w := serve(app.handleAdminIdentity, http.MethodGet, "/admin/identities/bob", "", "Admin"); w.Code != http.StatusNotFound {
+		t.Errorf("deleted: status %d, want 404", w.Code)
+	}
+}
+
+func TestCaptureIdentity(t *testing.T) {
+	app := newTestApp(t)
+	ctxFor := func(email string) context.Context {
+		return backend.WithPluginContext(context.Background(), backend.PluginContext{User: &backend.User{Login: "alice", Email: email}})
+	}
+
+	app.captureIdentity(ctxFor("alice@sso.example"), "alice")
+	if id, ok := app.identity("alice"); !ok || id.Email != "alice@sso.example" || id.Source != identitySourceGrafana {
+		t.Fatalf("captured = %+v, %v", id, ok)
+	}
+	if _, err := app.setIdentity("alice", IdentityRequest{EmployeeID: "E1001"}); err != nil {
+		t.Fatal(err)
+	}
+	app.captureIdentity(ctxFor("alice@other.example"), "alice")
+	if id, _ := app.identity("alice"); id.EmployeeID != "E1001" || id.Email != "" {
+		t.Errorf("admin identity overwritten: %+v", id)
+	}
+}
+
+func TestXAPIActorIdentity(t *testing.T) {
+	app := newTestApp(t)
+	app.settings = &Settings{XAPIAccountHomePage: "https://hr.corp.example"}
+	ctx := context.Background()
+	_, _ = app.setIdentity("alice", IdentityRequest{Email: "alice@corp.example", EmployeeID: "E1001"})
+	_, _ = app.setIdentity("bob", IdentityRequest{Email: "bob@corp.example"})
+
+	if got := app.xapiActor(ctx, "alice"); got.Account == nil || *got.Account != (xapiAccount{HomePage: "https://hr.corp.example", Name: "E1001"}) || got.Mbox != "" {
+		t.Errorf("employee ID actor = %+v", got)
+	}
+	if got := app.xapiActor(ctx, "bob"); got.Mbox != "mailto:bob@corp.example" || got.Account != nil {
+		t.Errorf("email actor = %+v", got)
+	}
+	if got := app.xapiActor(ctx, "carol"); got.Account == nil || *got.Account != (xapiAccount{HomePage: xapiDefaultHomePage, Name: "carol"}) {
+		t.Errorf("login actor = %+v", got)
+	}
+}
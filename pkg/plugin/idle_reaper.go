@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Idle VM destruction.
+//
+// Hibernation (hibernate.go) only acts while a terminal is connected. The
+// idle reaper also covers learners who closed the tab: it tracks the last
+// terminal input per VM across connections and destroys VMs idle for
+// Settings.VMDestroyIdleMinutes. Connected learners see a banner
+// VMDestroyWarningMinutes (default 5) before the VM goes; typing anything
+// resets the clock. VMs backing a named workspace are never reaped.
+//
+// Activity is tracked in memory from the first connection on this plugin
+// instance, so a restart gives every VM a fresh idle window.
+
+const (
+	idleReapInterval           = 30 * time.Second
+	defaultIdleDestroyWarnMins = 5
+)
+
+// vmActivity is the reaper's view of one VM.
+type vmActivity struct {
+	owner     string
+	lastInput time.Time
+	warned    bool
+}
+
+// idleReaper holds per-VM activity for the idle reaper.
+type idleReaper struct {
+	mu  sync.Mutex
+	vms map[string]*vmActivity
+}
+
+// idleDestroyTimeout returns the configured idle window, or 0 when idle
+// destruction is disabled.
+func (a *App) idleDestroyTimeout() time.Duration {
+	if a.settings == nil || a.settings.VMDestroyIdleMinutes <= 0 {
+		return 0
+	}
+	return time.Duration(a.settings.VMDestroyIdleMinutes) * time.Minute
+}
+
+func (a *App) idleDestroyWarning() time.Duration {
+	mins := defaultIdleDestroyWarnMins
+	if a.settings != nil && a.settings.VMDestroyWarningMinutes > 0 {
+		mins = a.settings.VMDestroyWarningMinutes
+	}
+	return time.Duration(mins) * time.Minute
+}
+
+// noteVMActivity records terminal activity on vmID at t. Older timestamps
+// don't move the clock back.
+func (a *App) noteVMActivity(vmID, owner string, t time.Time) {
+	a.idleVMs.mu.Lock()
+	defer a.idleVMs.mu.Unlock()
+	if a.idleVMs.vms == nil {
+		a.idleVMs.vms = map[string]*vmActivity{}
+	}
+	act := a.idleVMs.vms[vmID]
+	if act == nil {
+		act = &vmActivity{owner: owner}
+		a.idleVMs.vms[vmID] = act
+	}
+	if t.After(act.lastInput) {
+		act.lastInput = t
+		act.warned = false
+	}
+}
+
+// forgetVMActivity stops tracking vmID.
+func (a *App) forgetVMActivity(vmID string) {
+	a.idleVMs.mu.Lock()
+	delete(a.idleVMs.vms, vmID)
+	a.idleVMs.mu.Unlock()
+}
+
+// startIdleReaper reaps idle VMs every idleReapInterval.
+func (a *App) startIdleReaper() {
+	a.runEvery(idleReapInterval, a.reapIdleVMs)
+}
+
+// reapIdleVMs warns about and destroys VMs past the idle window.
+func (a *App) reapIdleVMs(ctx context.Context) {
+	limit := a.idleDestroyTimeout()
+	if limit == 0 || a.coda == nil {
+		return
+	}
+	warnAt := limit - a.idleDestroyWarning()
+
+	// Connected sessions carry the freshest input time.
+	sessionsByVM := map[string][]*streamSession{}
+	a.streamSessionsMu.Lock()
+	for _, sess := range a.streamSessions {
+		if sess != nil && sess.session != nil {
+			sessionsByVM[sess.vmID] = append(sessionsByVM[sess.vmID], sess)
+		}
+	}
+	a.streamSessionsMu.Unlock()
+	for vmID, sessions := range sessionsByVM {
+		for _, sess := range sessions {
+			a.noteVMActivity(vmID, sess.userLogin, time.Unix(0, sess.lastInput.Load()))
+		}
+	}
+
+	type due struct {
+		vmID, owner string
+		idle        time.Duration
+		destroy     bool
+	}
+	var actions []due
+	now := timeNow()
+	a.idleVMs.mu.Lock()
+	for vmID, act := range a.idleVMs.vms {
+		idle := now.Sub(act.lastInput)
+		switch {
+		case idle >= limit:
+			actions = append(actions, due{vmID, act.owner, idle, true})
+		case idle >= warnAt && !act.warned:
+			act.warned = true
+			actions = append(actions, due{vmID, act.owner, idle, false})
+		}
+	}
+	a.idleVMs.mu.Unlock()
+
+	for _, d := range actions {
+		if a.workspaceVMIDs(d.owner)[d.vmID] {
+			a.forgetVMActivity(d.vmID)
+			continue
+		}
+		if !d.destroy {
+			left := (limit - d.idle).Round(time.Minute)
+			for _, sess := range sessionsByVM[d.vmID] {
+				sendStreamMessage(sess.sender, TerminalStreamOutput{
+					Type: "output",
+					Data: takeoverBanner(fmt.Sprintf("This sandbox has been idle and will be destroyed in %s. Type anything to keep it.", left)),
+				})
+			}
+			continue
+		}
+
+		a.logger.Info("Destroying idle VM", "vmID", d.vmID, "owner", d.owner, "idle", d.idle.Round(time.Second).String())
+		if err := a.coda.DeleteVM(ctx, d.vmID, true); err != nil && !isVMNotFoundError(err) {
+			a.logger.Warn("Failed to destroy idle VM", "vmID", d.vmID, "error", err)
+			continue
+		}
+		a.forgetVMActivity(d.vmID)
+		a.clearUserVM(d.owner, d.vmID)
+		for _, sess := range sessionsByVM[d.vmID] {
+			a.loki.event(sess.logLabels, "VM destroyed after %s idle", d.idle.Round(time.Second))
+			a.endStreamSession(a.logger, sess, "Sandbox destroyed after inactivity. Press Connect to start a new one.")
+		}
+	}
+}
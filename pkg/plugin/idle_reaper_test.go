@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReapIdleVMs(t *testing.T) {
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	var deleted []string
+	app := newTestApp(t)
+	app.settings = &Settings{VMDestroyIdleMinutes: 30}
+	app.userVMs = map[string]string{"alice": "vm-1", "bob": "vm-2"}
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/v1/vms/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	_ = app.store.put(workspaceCollection, workspaceKey("carol", "lab"), workspace{Name: "lab", Owner: "carol", VMID: "vm-3"})
+
+	rec, sender := newStreamRecorder(t)
+	ts := &TerminalSession{VMID: "vm-1", stdin: &recordingWriter{}}
+	alice := &streamSession{id: "sess-1", vmID: "vm-1", userLogin: "alice", session: ts, sender: sender, cancel: func() {}}
+	alice.touch()
+	app.streamSessions = map[string]*streamSession{"terminal/vm-1": alice}
+	app.noteVMActivity("vm-2", "bob", now)
+	app.noteVMActivity("vm-3", "carol", now)
+
+	now = now.Add(26 * time.Minute)
+	app.reapIdleVMs(context.Background())
+	if len(deleted) != 0 {
+		t.Fatalf("deleted before the idle window: %v", deleted)
+	}
+	if out := rec.ofType("output"); len(out) != 1 || !strings.Contains(out[0].Data, "destroyed in 4m") {
+		t.Errorf("warning = %+v", out)
+	}
+	app.reapIdleVMs(context.Background())
+	if out := rec.ofType("output"); len(out) != 1 {
+		t.Errorf("warned %d times", len(out))
+	}
+
+	now = now.Add(5 * time.Minute)
+	app.reapIdleVMs(context.Background())
+	if strings.Join(deleted, ",") != "vm-1,vm-2" && strings.Join(deleted, ",") != "vm-2,vm-1" {
+		t.Errorf("deleted = %v, want vm-1 and vm-2", deleted)
+	}
+	if !ts.closed {
+		t.Error("connected session on the idle VM was not ended")
+	}
+	if len(app.userVMs) != 0 {
+		t.Errorf("userVMs = %v", app.userVMs)
+	}
+	if len(app.idleVMs.vms) != 0 {
+		t.Errorf("still tracking %v", app.idleVMs.vms)
+	}
+}
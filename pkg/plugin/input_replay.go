@@ -0,0 +1,40 @@
+package plugin
+
+import "fmt"
+
+// Replay protection for terminal input.
+//
+// A client that knows the session, from the correlationId of "connected",
+// sends it as sessionId on each "input" and "paste" with inputSeq, a
+// counter that starts at 1 for the session and increases by at least one
+// per message. The backend rejects a message whose sessionId belongs to
+// another session or whose inputSeq isn't above the last accepted one, so a
+// captured publish can't be replayed into the shell, in this session or a
+// later one on the same channel. Once a session has seen inputSeq it is
+// required; with requireTerminalInputSeq it is required from the start,
+// which refuses input from frontends that predate it.
+
+// checkInputSeq accepts or rejects an "input" or "paste" message for sess.
+func (a *App) checkInputSeq(sess *streamSession, input TerminalInput) error {
+	if input.SessionID != "" && input.SessionID != sess.id {
+		return fmt.Errorf("input for session %q", input.SessionID)
+	}
+	if input.InputSeq == 0 {
+		if sess.lastInputSeq.Load() > 0 || (a.settings != nil && a.settings.RequireTerminalInputSeq) {
+			return fmt.Errorf("input without inputSeq")
+		}
+		return nil
+	}
+	if input.SessionID == "" {
+		return fmt.Errorf("inputSeq without sessionId")
+	}
+	for {
+		last := sess.lastInputSeq.Load()
+		if input.InputSeq <= last {
+			return fmt.Errorf("inputSeq %d not after %d", input.InputSeq, last)
+		}
+		if sess.lastInputSeq.CompareAndSwap(last, input.InputSeq) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestPublishStream_InputReplay(t *testing.T) {
+	stdin := &recordingWriter{}
+	sess := &streamSession{id: "sess-1", vmID: "vm-1", userLogin: "alice", session: &TerminalSession{VMID: "vm-1", stdin: stdin}}
+	app := &App{logger: log.DefaultLogger, streamSessions: map[string]*streamSession{"terminal/vm-1/1": sess}}
+
+	publish := func(body string) backend.PublishStreamStatus {
+		t.Helper()
+		resp, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			Path: "terminal/vm-1/1",
+			Data: json.RawMessage(body),
+		})
+		if err != nil {
+			t.Fatalf("PublishStream(%s): %v", body, err)
+		}
+		return resp.Status
+	}
+
+	for _, tc := range []struct {
+		body string
+		want backend.PublishStreamStatus
+	}{
+		{`{"type":"input","data":"legacy"}`, backend.PublishStreamStatusOK},
+		{`{"type":"input","data":"a","sessionId":"sess-1","inputSeq":1}`, backend.PublishStreamStatusOK},
+		{`{"type":"input","data":"a","sessionId":"sess-1","inputSeq":1}`, backend.PublishStreamStatusPermissionDenied},
+		{`{"type":"paste","data":"b","sessionId":"sess-1","inputSeq":3}`, backend.PublishStreamStatusOK},
+		{`{"type":"input","data":"late","sessionId":"sess-1","inputSeq":2}`, backend.PublishStreamStatusPermissionDenied},
+		{`{"type":"input","data":"stripped"}`, backend.PublishStreamStatusPermissionDenied},
+		{`{"type":"input","data":"old session","sessionId":"sess-0","inputSeq":9}`, backend.PublishStreamStatusPermissionDenied},
+		{`{"type":"input","data":"no session","inputSeq":9}`, backend.PublishStreamStatusPermissionDenied},
+		{`{"type":"input","data":"c","sessionId":"sess-1","inputSeq":4}`, backend.PublishStreamStatusOK},
+	} {
+		if got := publish(tc.body); got != tc.want {
+			t.Errorf("%s: status %v, want %v", tc.body, got, tc.want)
+		}
+	}
+	if len(stdin.writes) != 4 || string(stdin.writes[0]) != "legacy" || string(stdin.writes[1]) != "a" || string(stdin.writes[3]) != "c" {
+		t.Errorf("stdin writes = %q", stdin.writes)
+	}
+}
+
+func TestCheckInputSeq_Required(t *testing.T) {
+	app := newTestApp(t)
+	app.settings = &Settings{RequireTerminalInputSeq: true}
+	sess := &streamSession{id: "sess-1"}
+	if err := app.checkInputSeq(sess, TerminalInput{Type: "input", Data: "x"}); err == nil {
+		t.Error("input without inputSeq accepted")
+	}
+	if err := app.checkInputSeq(sess, TerminalInput{Type: "input", Data: "x", SessionID: "sess-1", InputSeq: 1}); err != nil {
+		t.Errorf("first input: %v", err)
+	}
+	if !terminalCapabilities().InputSeq {
+		t.Error("capabilities don't report inputSeq")
+	}
+}
@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sandbox kill switch.
+//
+// For incident response when Coda or the relay misbehaves, or a security
+// issue is found. While engaged the plugin refuses new terminal connections,
+// VM creation and commands; existing sessions keep running unless the admin
+// asks to terminate them. Reads and deletes stay available for cleanup.
+//
+//	GET /admin/kill-switch    current state
+//	PUT /admin/kill-switch    {"engaged": true, "reason": "...", "terminateSessions": true}
+//
+// The runtime state is kept in the plugin store so it survives restarts. The
+// sandboxKillSwitch setting engages the switch as well and can only be
+// released by changing the setting.
+
+const (
+	killSwitchCollection = "kill-switch"
+	killSwitchKey        = "state"
+)
+
+// killSwitchState is the runtime kill switch as persisted in the store.
+type killSwitchState struct {
+	Engaged   bool      `json:"engaged"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedBy string    `json:"changedBy,omitempty"`
+	ChangedAt time.Time `json:"changedAt,omitzero"`
+}
+
+// killSwitchInfo is the JSON view of the kill switch.
+type killSwitchInfo struct {
+	killSwitchState
+	// FromSettings is true when the sandboxKillSwitch setting engages it.
+	FromSettings       bool `json:"fromSettings"`
+	TerminatedSessions int  `json:"terminatedSessions,omitempty"`
+}
+
+// KillSwitchRequest is the body of PUT /admin/kill-switch.
+type KillSwitchRequest struct {
+	Engaged           bool   `json:"engaged"`
+	Reason            string `json:"reason" validate:"max=500"`
+	TerminateSessions bool   `json:"terminateSessions"`
+}
+
+func (a *App) killSwitch() killSwitchInfo {
+	var info killSwitchInfo
+	if a.store != nil {
+		_, _ = a.store.get(killSwitchCollection, killSwitchKey, &info.killSwitchState)
+	}
+	if a.settings != nil && a.settings.SandboxKillSwitch {
+		info.FromSettings = true
+		info.Engaged = true
+	}
+	return info
+}
+
+// killSwitchError returns the user-facing error while the kill switch is
+// engaged, or nil.
+func (a *App) killSwitchError() error {
+	ks := a.killSwitch()
+	if !ks.Engaged {
+		return nil
+	}
+	if ks.Reason != "" {
+		return fmt.Errorf("Sandbox features are suspended by an administrator: %s", ks.Reason)
+	}
+	return fmt.Errorf("Sandbox features are suspended by an administrator")
+}
+
+// refuseWhenKilled wraps h so that, while the kill switch is engaged, requests
+// that start something new (POST) answer 503.
+func (a *App) refuseWhenKilled(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if err := a.killSwitchError(); err != nil {
+				a.writeError(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// terminateAllSessions ends every connected terminal session and returns how
+// many were ended.
+func (a *App) terminateAllSessions(r *http.Request, reason string) int {
+	sessions := a.connectedSessions()
+	msg := "Your session was ended by an administrator: sandbox features are suspended"
+	if reason != "" {
+		msg += " (" + reason + ")"
+	}
+	ctxLogger := a.ctxLogger(r.Context())
+	for _, sess := range sessions {
+		a.endStreamSession(ctxLogger, sess, msg)
+	}
+	return len(sessions)
+}
+
+// handleKillSwitch handles GET/PUT /admin/kill-switch (admin only).
+func (a *App) handleKillSwitch(w http.ResponseWriter, r *http.Request) {
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can use the kill switch", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, a.killSwitch(), http.StatusOK)
+	case http.MethodPut:
+		var req KillSwitchRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		if !req.Engaged && a.settings != nil && a.settings.SandboxKillSwitch {
+			a.writeError(w, "The kill switch is engaged in the plugin settings; disable sandboxKillSwitch there to release it", http.StatusConflict)
+			return
+		}
+		ctxLogger := a.ctxLogger(r.Context())
+		state := killSwitchState{Engaged: req.Engaged, Reason: strings.TrimSpace(req.Reason), ChangedBy: admin, ChangedAt: timeNow().UTC()}
+		if err := a.store.put(killSwitchCollection, killSwitchKey, state); err != nil {
+			ctxLogger.Error("Failed to save kill switch", "error", err)
+			a.writeError(w, "Failed to save kill switch", http.StatusInternalServerError)
+			return
+		}
+
+		action := "killswitch.release"
+		if req.Engaged {
+			action = "killswitch.engage"
+		}
+		info := a.killSwitch()
+		if req.Engaged && req.TerminateSessions {
+			info.TerminatedSessions = a.terminateAllSessions(r, state.Reason)
+		}
+		details := state.Reason
+		if info.TerminatedSessions > 0 {
+			details = strings.TrimSpace(fmt.Sprintf("%d sessions terminated. %s", info.TerminatedSessions, state.Reason))
+		}
+		a.recordAudit(ctxLogger, auditEntry{Actor: admin, Action: action, Details: details})
+		a.writeJSON(w, info, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestKillSwitch(t *testing.T) {
+	rec, sender := newStreamRecorder(t)
+	ts := &TerminalSession{VMID: "vm-1", stdin: &recordingWriter{}}
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), settings: &Settings{}, streamSessions: map[string]*streamSession{
+		"terminal/vm-1/1": {id: "sess-1", vmID: "vm-1", userLogin: "learner", session: ts, sender: sender},
+	}}
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	serve := func(method, target, body, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(method, target, body, "ops", role))
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/admin/kill-switch", `{"engaged":true}`, "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+	w := serve(http.MethodPut, "/admin/kill-switch", `{"engaged":true,"reason":"relay compromised","terminateSessions":true}`, "Admin")
+	var info killSwitchInfo
+	_ = json.Unmarshal(w.Body.Bytes(), &info)
+	if w.Code != http.StatusOK || !info.Engaged || info.TerminatedSessions != 1 || info.ChangedBy != "ops" {
+		t.Fatalf("engage: status = %d, info = %+v", w.Code, info)
+	}
+	if !ts.closed {
+		t.Error("session not terminated")
+	}
+	if errs := rec.ofType("error"); len(errs) != 1 || !strings.Contains(errs[0].Error, "relay compromised") {
+		t.Errorf("learner errors = %+v", errs)
+	}
+
+	if w := serve(http.MethodPost, "/vms", `{"template":"vm-aws"}`, "Admin"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "relay compromised") {
+		t.Errorf("POST /vms while engaged: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	resp, _ := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "terminal/vm-2"})
+	if resp.Status != backend.SubscribeStreamStatusPermissionDenied {
+		t.Errorf("SubscribeStream while engaged = %v", resp.Status)
+	}
+	var features map[string]bool
+	_ = json.Unmarshal(serve(http.MethodGet, "/features", "", "Viewer").Body.Bytes(), &features)
+	if features["terminal"] || features["vmProvisioning"] || !features["customGuides"] {
+		t.Errorf("features while engaged = %v", features)
+	}
+
+	if w := serve(http.MethodPut, "/admin/kill-switch", `{"engaged":false}`, "Admin"); w.Code != http.StatusOK || app.killSwitchError() != nil {
+		t.Errorf("release: status = %d, err = %v", w.Code, app.killSwitchError())
+	}
+	if entries := app.store.keys(auditCollection); len(entries) != 2 {
+		t.Errorf("audit entries = %d, want 2", len(entries))
+	}
+
+	app.settings.SandboxKillSwitch = true
+	if w := serve(http.MethodPut, "/admin/kill-switch", `{"engaged":false}`, "Admin"); w.Code != http.StatusConflict {
+		t.Errorf("release with settings flag: status = %d", w.Code)
+	}
+	if app.killSwitchError() == nil {
+		t.Error("settings flag does not engage the kill switch")
+	}
+}
@@ -0,0 +1,310 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Learning activity and the org leaderboard.
+//
+// POST /learning-activity records that the caller completed a guide. The
+// plugin keeps one record per user in the store with the guides they
+// completed and the UTC days they completed any, from which completion
+// counts and streaks are derived the same way the frontend's streak tracker
+// does: consecutive days, still running if the last one was today or
+// yesterday. A plugin instance serves one org, so GET /leaderboard ranks the
+// org's learners. Users who opt out with PUT /leaderboard/opt-out are left
+// off the leaderboard but keep their own stats.
+
+const (
+	learningActivityCollection = "learning-activity"
+
+	// Older days are dropped; LongestStreak keeps the record.
+	maxActivityDays          = 400
+	maxActivityGuides        = 2000
+	defaultLeaderboardLimit  = 10
+	maxLeaderboardLimit      = 100
+	leaderboardByCompletions = "completions"
+	leaderboardByStreak      = "streak"
+)
+
+// learnerActivity is one user's stored learning activity.
+type learnerActivity struct {
+	User          string                     `json:"user"`
+	Name          string                     `json:"name,omitempty"`
+	Guides        map[string]guideCompletion `json:"guides"`
+	Days          []string                   `json:"days"` // YYYY-MM-DD (UTC), ascending
+	LongestStreak int                        `json:"longestStreak"`
+	OptOut        bool                       `json:"optOut,omitempty"`
+	Badges        map[string]time.Time       `json:"badges,omitempty"` // badge ID -> earned at
+}
+
+// guideCompletion is one completed guide in a learner's activity.
+type guideCompletion struct {
+	Category         string    `json:"category,omitempty"`
+	Count            int       `json:"count"`
+	FirstCompletedAt time.Time `json:"firstCompletedAt"`
+	LastCompletedAt  time.Time `json:"lastCompletedAt"`
+}
+
+// RecordCompletionRequest is the JSON body for POST /learning-activity.
+type RecordCompletionRequest struct {
+	GuideID  string `json:"guideId" validate:"required,pattern=guideId"`
+	Category string `json:"category,omitempty" validate:"pattern=name"`
+}
+
+// learnerStats is the derived view of a learner's activity.
+type learnerStats struct {
+	Rank          int    `json:"rank,omitempty"`
+	User          string `json:"user"`
+	Name          string `json:"name,omitempty"`
+	Completions   int    `json:"completions"`
+	CurrentStreak int    `json:"currentStreak"`
+	LongestStreak int    `json:"longestStreak"`
+	LastActiveDay string `json:"lastActiveDay,omitempty"`
+	OptOut        bool   `json:"optOut,omitempty"`
+	// NewBadges lists the badges a recorded completion earned.
+	NewBadges []string `json:"newBadges,omitempty"`
+}
+
+type leaderboardResponse struct {
+	By      string         `json:"by"`
+	Entries []learnerStats `json:"entries"`
+	Me      learnerStats   `json:"me"`
+}
+
+func activityDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// currentStreak counts the consecutive days ending today or yesterday.
+func currentStreak(days []string, now time.Time) int {
+	if len(days) == 0 {
+		return 0
+	}
+	expect := now.UTC()
+	if days[len(days)-1] != activityDay(expect) {
+		expect = expect.AddDate(0, 0, -1)
+	}
+	n := 0
+	for i := len(days) - 1; i >= 0 && days[i] == activityDay(expect); i-- {
+		n++
+		expect = expect.AddDate(0, 0, -1)
+	}
+	return n
+}
+
+func (l learnerActivity) stats(now time.Time) learnerStats {
+	s := learnerStats{
+		User:          l.User,
+		Name:          l.Name,
+		Completions:   len(l.Guides),
+		CurrentStreak: currentStreak(l.Days, now),
+		LongestStreak: l.LongestStreak,
+		OptOut:        l.OptOut,
+	}
+	if len(l.Days) > 0 {
+		s.LastActiveDay = l.Days[len(l.Days)-1]
+	}
+	return s
+}
+
+func (a *App) loadLearnerActivity(user string) learnerActivity {
+	activity := learnerActivity{User: user}
+	if _, err := a.store.get(learningActivityCollection, user, &activity); err != nil {
+		a.logger.Warn("Failed to read learning activity", "user", user, "error", err)
+	}
+	if activity.Guides == nil {
+		activity.Guides = map[string]guideCompletion{}
+	}
+	return activity
+}
+
+// updateLearnerActivity applies fn to user's activity and stores it.
+func (a *App) updateLearnerActivity(user string, fn func(*learnerActivity)) (learnerActivity, error) {
+	a.learningActivityMu.Lock()
+	defer a.learningActivityMu.Unlock()
+	activity := a.loadLearnerActivity(user)
+	fn(&activity)
+	return activity, a.store.put(learningActivityCollection, user, activity)
+}
+
+// recordCompletion adds a completion of guideID at now to activity.
+func (l *learnerActivity) recordCompletion(guideID, category string, now time.Time) {
+	g, seen := l.Guides[guideID]
+	if !seen && len(l.Guides) >= maxActivityGuides {
+		return
+	}
+	if !seen {
+		g.FirstCompletedAt = now
+	}
+	g.Count++
+	g.LastCompletedAt = now
+	if category != "" {
+		g.Category = category
+	}
+	l.Guides[guideID] = g
+
+	day := activityDay(now)
+	if n := len(l.Days); n == 0 || l.Days[n-1] < day {
+		l.Days = append(l.Days, day)
+	}
+	if over := len(l.Days) - maxActivityDays; over > 0 {
+		l.Days = append([]string(nil), l.Days[over:]...)
+	}
+	if streak := currentStreak(l.Days, now); streak > l.LongestStreak {
+		l.LongestStreak = streak
+	}
+}
+
+// handleLearningActivity handles GET (own stats) and POST (record a
+// completion) on /learning-activity.
+func (a *App) handleLearningActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, a.loadLearnerActivity(user).stats(timeNow()), http.StatusOK)
+	case http.MethodPost:
+		var req RecordCompletionRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		now := timeNow().UTC()
+		name := ""
+		if u := backend.PluginConfigFromContext(ctx).User; u != nil {
+			name = u.Name
+		}
+		a.captureIdentity(ctx, user)
+		defs := a.badgeDefinitions()
+		var awarded []string
+		activity, err := a.updateLearnerActivity(user, func(l *learnerActivity) {
+			l.Name = name
+			l.recordCompletion(req.GuideID, req.Category, now)
+			awarded = l.awardBadges(defs, now)
+		})
+		if err != nil {
+			a.ctxLogger(ctx).Error("Failed to record learning activity", "user", user, "guideId", req.GuideID, "error", err)
+			a.writeError(w, "Failed to record the completion", http.StatusInternalServerError)
+			return
+		}
+		a.recordExperimentConversion(user, req.GuideID)
+		a.rollupAnalytics(analyticsEventComplete, user, req.GuideID, 0, 0)
+		completion := true
+		a.emitXAPI(ctx, user, xapiVerbCompleted, guideActivity(req.GuideID, ""), &xapiResult{Completion: &completion})
+		stats := activity.stats(now)
+		stats.NewBadges = awarded
+		a.writeJSON(w, stats, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLeaderboard handles GET /leaderboard?by=completions|streak&limit=.
+func (a *App) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = leaderboardByCompletions
+	}
+	if by != leaderboardByCompletions && by != leaderboardByStreak {
+		a.writeError(w, "by must be completions or streak", http.StatusBadRequest)
+		return
+	}
+	limit := defaultLeaderboardLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxLeaderboardLimit {
+			a.writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	now := timeNow()
+	score := func(s learnerStats) int {
+		if by == leaderboardByStreak {
+			return s.CurrentStreak
+		}
+		return s.Completions
+	}
+	var ranked []learnerStats
+	for _, key := range a.store.keys(learningActivityCollection) {
+		var activity learnerActivity
+		if ok, err := a.store.get(learningActivityCollection, key, &activity); err != nil || !ok || activity.OptOut {
+			continue
+		}
+		if s := activity.stats(now); score(s) > 0 {
+			ranked = append(ranked, s)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if si, sj := score(ranked[i]), score(ranked[j]); si != sj {
+			return si > sj
+		}
+		return ranked[i].User < ranked[j].User
+	})
+
+	resp := leaderboardResponse{By: by, Entries: []learnerStats{}, Me: a.loadLearnerActivity(user).stats(now)}
+	for i := range ranked {
+		// Ties share a rank.
+		if i == 0 || score(ranked[i]) != score(ranked[i-1]) {
+			ranked[i].Rank = i + 1
+		} else {
+			ranked[i].Rank = ranked[i-1].Rank
+		}
+		if ranked[i].User == user {
+			resp.Me.Rank = ranked[i].Rank
+		}
+		if i < limit {
+			resp.Entries = append(resp.Entries, ranked[i])
+		}
+	}
+	a.writeJSON(w, resp, http.StatusOK)
+}
+
+// LeaderboardOptOutRequest is the JSON body for PUT /leaderboard/opt-out.
+type LeaderboardOptOutRequest struct {
+	OptOut bool `json:"optOut"`
+}
+
+// handleLeaderboardOptOut handles PUT /leaderboard/opt-out.
+func (a *App) handleLeaderboardOptOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	var req LeaderboardOptOutRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	activity, err := a.updateLearnerActivity(user, func(l *learnerActivity) { l.OptOut = req.OptOut })
+	if err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to store leaderboard opt-out", "user", user, "error", err)
+		a.writeError(w, "Failed to store the preference", http.StatusInternalServerError)
+		return
+	}
+	a.writeJSON(w, activity.stats(timeNow()), http.StatusOK)
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCurrentStreak(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		days []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"2026-03-10"}, 1},
+		{[]string{"2026-03-08", "2026-03-09"}, 2},
+		{[]string{"2026-03-07", "2026-03-09", "2026-03-10"}, 2},
+		{[]string{"2026-03-07", "2026-03-08"}, 0},
+	} {
+		if got := currentStreak(tc.days, now); got != tc.want {
+			t.Errorf("%v: streak = %d, want %d", tc.days, got, tc.want)
+		}
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	app := newTestApp(t)
+	advance := withFrozenTime(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	serve := func(h http.HandlerFunc, method, target, body, user string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(w, roleRequest(method, target, body, user, "Viewer"))
+		return w
+	}
+	complete := func(user, guide string) learnerStats {
+		t.Helper()
+		w := serve(app.handleLearningActivity, http.MethodPost, "/learning-activity", `{"guideId": "`+guide+`", "category": "alerting"}`, user)
+		var s learnerStats
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("complete %s as %s: status=%d body=%s", guide, user, w.Code, w.Body.String())
+		}
+		return s
+	}
+	board := func(query, user string) leaderboardResponse {
+		t.Helper()
+		w := serve(app.handleLeaderboard, http.MethodGet, "/leaderboard"+query, "", user)
+		var resp leaderboardResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("leaderboard%s: status=%d body=%s", query, w.Code, w.Body.String())
+		}
+		return resp
+	}
+
+	// ana completes a guide on three consecutive days, bo two guides on one
+	// day, and carl one guide two days ago.
+	complete("carl", "intro")
+	complete("ana", "alerting-101")
+	advance(24 * time.Hour)
+	complete("ana", "alerting-101")
+	advance(24 * time.Hour)
+	complete("bo", "alerting-101")
+	complete("bo", "loki-101")
+	if s := complete("ana", "loki-101"); s.Completions != 2 || s.CurrentStreak != 3 || s.LongestStreak != 3 || s.LastActiveDay != "2026-03-03" {
+		t.Errorf("ana = %+v", s)
+	}
+
+	resp := board("", "carl")
+	if resp.By != leaderboardByCompletions || len(resp.Entries) != 3 {
+		t.Fatalf("leaderboard = %+v", resp)
+	}
+	if e := resp.Entries; e[0].User != "ana" || e[0].Rank != 1 || e[1].User != "bo" || e[1].Rank != 1 || e[2].User != "carl" || e[2].Rank != 3 {
+		t.Errorf("entries = %+v", e)
+	}
+	if resp.Me.User != "carl" || resp.Me.Rank != 3 || resp.Me.CurrentStreak != 0 {
+		t.Errorf("me = %+v", resp.Me)
+	}
+
+	// A missed day ends the current streak but not the longest.
+	advance(48 * time.Hour)
+	resp = board("?by=streak", "ana")
+	if len(resp.Entries) != 0 || resp.Me.CurrentStreak != 0 || resp.Me.LongestStreak != 3 {
+		t.Errorf("streak board after a gap = %+v", resp)
+	}
+	complete("bo", "intro")
+	resp = board("?by=streak&limit=1", "ana")
+	if len(resp.Entries) != 1 || resp.Entries[0].User != "bo" || resp.Entries[0].CurrentStreak != 1 || resp.Me.Rank != 0 {
+		t.Errorf("streak board = %+v", resp)
+	}
+
+	// Opting out hides ana from the board; ana still sees their own stats.
+	if w := serve(app.handleLeaderboardOptOut, http.MethodPut, "/leaderboard/opt-out", `{"optOut": true}`, "ana"); w.Code != http.StatusOK {
+		t.Fatalf("opt out: status=%d", w.Code)
+	}
+	resp = board("", "ana")
+	if len(resp.Entries) != 2 || resp.Entries[0].User != "bo" || resp.Me.Completions != 2 || !resp.Me.OptOut || resp.Me.Rank != 0 {
+		t.Errorf("after opt-out = %+v", resp)
+	}
+	if s := complete("ana", "intro"); s.Completions != 3 || !s.OptOut {
+		t.Errorf("completion after opt-out = %+v", s)
+	}
+
+	for _, target := range []string{"/leaderboard?by=time", "/leaderboard?limit=0", "/leaderboard?limit=101", "/leaderboard?limit=x"} {
+		if w := serve(app.handleLeaderboard, http.MethodGet, target, "", "ana"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", target, w.Code)
+		}
+	}
+	if w := serve(app.handleLearningActivity, http.MethodPost, "/learning-activity", `{"guideId": "bad guide"}`, "ana"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid guide: status=%d", w.Code)
+	}
+	if w := serve(app.handleLeaderboard, http.MethodGet, "/leaderboard", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status=%d", w.Code)
+	}
+}
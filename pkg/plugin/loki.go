@@ -0,0 +1,273 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Terminal session export to Loki.
+//
+// When Settings.LokiURL is set, terminal output and session lifecycle events
+// are pushed to Loki's push API, labelled with user, vmId and guide, so
+// sandbox activity can be queried next to the rest of the stack. Keystrokes
+// are not exported: the echoed output already forms the transcript, and
+// skipping raw input keeps passwords typed at no-echo prompts out of Loki.
+//
+// Export is best-effort. Entries are buffered and pushed in batches by one
+// goroutine; when Loki is slow or down the buffer fills and new entries are
+// dropped rather than blocking the terminal.
+
+const (
+	lokiJobLabel      = "grafana-pathfinder-terminal"
+	lokiBufferSize    = 4096
+	lokiBatchSize     = 500
+	lokiFlushInterval = 2 * time.Second
+	lokiPushTimeout   = 10 * time.Second
+)
+
+// ansiEscapePattern matches CSI and OSC escape sequences, which would make
+// transcripts unsearchable.
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// lokiLabels identifies the session an entry belongs to.
+type lokiLabels struct {
+	user  string
+	vmID  string
+	guide string
+}
+
+type lokiEntry struct {
+	labels lokiLabels
+	stream string // "output" or "event"
+	ts     time.Time
+	line   string
+}
+
+// lokiTarget is a Loki push endpoint and its credentials.
+type lokiTarget struct {
+	pushURL  string
+	user     string
+	password string
+	tenantID string
+	client   *http.Client
+}
+
+// lokiExporter batches entries and pushes them to Loki. A nil exporter is a
+// valid no-op, so call sites need no enabled check.
+type lokiExporter struct {
+	lokiTarget
+	logger log.Logger
+
+	// mu guards closed so enqueue never sends on a closed channel.
+	mu      sync.RWMutex
+	closed  bool
+	entries chan lokiEntry
+	done    chan struct{}
+
+	dropMu  sync.Mutex
+	dropped int
+}
+
+// newLokiExporter returns an exporter for settings, or nil when export is not
+// configured.
+func newLokiExporter(settings *Settings, logger log.Logger) *lokiExporter {
+	if settings == nil || settings.LokiURL == "" {
+		return nil
+	}
+	e := &lokiExporter{
+		lokiTarget: newLokiTarget(settings),
+		logger:     logger,
+		entries:    make(chan lokiEntry, lokiBufferSize),
+		done:       make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// newLokiTarget returns the push endpoint configured by settings.
+func newLokiTarget(settings *Settings) lokiTarget {
+	return lokiTarget{
+		pushURL:  strings.TrimSuffix(settings.LokiURL, "/") + "/loki/api/v1/push",
+		user:     settings.LokiUser,
+		password: settings.LokiPassword,
+		tenantID: settings.LokiTenantID,
+		client:   &http.Client{Timeout: lokiPushTimeout},
+	}
+}
+
+// output queues a chunk of terminal output for the session.
+func (e *lokiExporter) output(labels lokiLabels, data []byte) {
+	if e == nil {
+		return
+	}
+	line := ansiEscapePattern.ReplaceAllString(string(data), "")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	e.enqueue(lokiEntry{labels: labels, stream: "output", ts: timeNow(), line: line})
+}
+
+// event queues a lifecycle event such as "session connected".
+func (e *lokiExporter) event(labels lokiLabels, format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.enqueue(lokiEntry{labels: labels, stream: "event", ts: timeNow(), line: fmt.Sprintf(format, args...)})
+}
+
+func (e *lokiExporter) enqueue(entry lokiEntry) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.entries <- entry:
+	default:
+		e.dropMu.Lock()
+		e.dropped++
+		e.dropMu.Unlock()
+	}
+}
+
+// close flushes buffered entries and stops the exporter.
+func (e *lokiExporter) close() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.entries)
+	}
+	e.mu.Unlock()
+	<-e.done
+}
+
+func (e *lokiExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(lokiFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]lokiEntry, 0, lokiBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.push(batch); err != nil {
+			e.logger.Warn("Failed to push terminal logs to Loki", "entries", len(batch), "error", err)
+		}
+		batch = batch[:0]
+
+		e.dropMu.Lock()
+		dropped := e.dropped
+		e.dropped = 0
+		e.dropMu.Unlock()
+		if dropped > 0 {
+			e.logger.Warn("Dropped terminal log entries, Loki export buffer full", "dropped", dropped)
+		}
+	}
+
+	for {
+		select {
+		case entry, ok := <-e.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= lokiBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+type lokiPushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiPushStream `json:"streams"`
+}
+
+// buildLokiPush groups entries into one Loki stream per label set.
+func buildLokiPush(entries []lokiEntry) lokiPushRequest {
+	type streamKey struct {
+		labels lokiLabels
+		stream string
+	}
+	index := map[streamKey]int{}
+	req := lokiPushRequest{Streams: []lokiPushStream{}}
+	for _, entry := range entries {
+		key := streamKey{entry.labels, entry.stream}
+		i, ok := index[key]
+		if !ok {
+			labels := map[string]string{
+				"job":    lokiJobLabel,
+				"user":   entry.labels.user,
+				"vmId":   entry.labels.vmID,
+				"stream": entry.stream,
+			}
+			if entry.labels.guide != "" {
+				labels["guide"] = entry.labels.guide
+			}
+			i = len(req.Streams)
+			index[key] = i
+			req.Streams = append(req.Streams, lokiPushStream{Stream: labels})
+		}
+		req.Streams[i].Values = append(req.Streams[i].Values, [2]string{strconv.FormatInt(entry.ts.UnixNano(), 10), entry.line})
+	}
+	return req
+}
+
+func (e *lokiExporter) push(entries []lokiEntry) error {
+	return e.send(context.Background(), buildLokiPush(entries))
+}
+
+// send posts one push request to the target.
+func (e lokiTarget) send(ctx context.Context, push lokiPushRequest) error {
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lokiPushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.user != "" || e.password != "" {
+		req.SetBasicAuth(e.user, e.password)
+	}
+	if e.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", e.tenantID)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("loki push returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
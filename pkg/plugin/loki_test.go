@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestNewLokiExporter_DisabledWithoutURL(t *testing.T) {
+	e := newLokiExporter(&Settings{}, log.DefaultLogger)
+	if e != nil {
+		t.Fatal("expected nil exporter without LokiURL")
+	}
+	// A nil exporter must be safe to use.
+	e.output(lokiLabels{user: "alice"}, []byte("hi"))
+	e.event(lokiLabels{user: "alice"}, "connected")
+	e.close()
+}
+
+func TestBuildLokiPush_GroupsByLabels(t *testing.T) {
+	ts := time.Unix(0, 42)
+	alice := lokiLabels{user: "alice", vmID: "vm-1", guide: "alloy-101"}
+	bob := lokiLabels{user: "bob", vmID: "vm-2"}
+	req := buildLokiPush([]lokiEntry{
+		{labels: alice, stream: "output", ts: ts, line: "a1"},
+		{labels: bob, stream: "output", ts: ts, line: "b1"},
+		{labels: alice, stream: "output", ts: ts, line: "a2"},
+		{labels: alice, stream: "event", ts: ts, line: "connected"},
+	})
+
+	if len(req.Streams) != 3 {
+		t.Fatalf("got %d streams, want 3", len(req.Streams))
+	}
+	first := req.Streams[0]
+	if first.Stream["user"] != "alice" || first.Stream["guide"] != "alloy-101" || first.Stream["job"] != lokiJobLabel {
+		t.Errorf("labels = %v", first.Stream)
+	}
+	if len(first.Values) != 2 || first.Values[1] != [2]string{"42", "a2"} {
+		t.Errorf("values = %v", first.Values)
+	}
+	if _, ok := req.Streams[1].Stream["guide"]; ok {
+		t.Errorf("empty guide should be omitted, got %v", req.Streams[1].Stream)
+	}
+}
+
+func TestLokiExporter_PushesOnClose(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []lokiPushRequest
+		header   http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var req lokiPushRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		received = append(received, req)
+		header = r.Header.Clone()
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	e := newLokiExporter(&Settings{
+		LokiURL:      srv.URL + "/",
+		LokiUser:     "123",
+		LokiPassword: "secret",
+		LokiTenantID: "tenant-a",
+	}, log.DefaultLogger)
+	labels := lokiLabels{user: "alice", vmID: "vm-1"}
+	e.output(labels, []byte("\x1b[1;32muser@vm\x1b[0m:~$ ls\r\n"))
+	e.output(labels, []byte("\x1b[?2004h"))
+	e.event(labels, "Session connected (template %s)", "vm-aws")
+	e.close()
+	// Entries after close are dropped, not a panic.
+	e.event(labels, "late")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("got %d pushes, want 1", len(received))
+	}
+	if user, pass, ok := (&http.Request{Header: header}).BasicAuth(); !ok || user != "123" || pass != "secret" {
+		t.Errorf("basic auth = %q %q %v", user, pass, ok)
+	}
+	if got := header.Get("X-Scope-OrgID"); got != "tenant-a" {
+		t.Errorf("X-Scope-OrgID = %q", got)
+	}
+
+	var lines []string
+	for _, s := range received[0].Streams {
+		for _, v := range s.Values {
+			lines = append(lines, s.Stream["stream"]+": "+v[1])
+		}
+	}
+	want := []string{"output: user@vm:~$ ls\r\n", "event: Session connected (template vm-aws)"}
+	if len(lines) != len(want) || lines[0] != want[0] || lines[1] != want[1] {
+		t.Errorf("lines = %q, want %q (escape-only chunks dropped)", lines, want)
+	}
+}
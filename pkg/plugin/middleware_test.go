@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecureRoute(t *testing.T) {
+	app := newTestApp(t)
+	h := app.secureRoute(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }, http.MethodGet, http.MethodPost)
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		headers map[string]string
+		want    int
+	}{
+		{"get", http.MethodGet, "", nil, http.StatusNoContent},
+		{"method not allowed", http.MethodDelete, "", nil, http.StatusMethodNotAllowed},
+		{"json post", http.MethodPost, `{}`, map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusNoContent},
+		{"empty post", http.MethodPost, "", nil, http.StatusNoContent},
+		{"form post", http.MethodPost, "a=b", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType},
+		{"post without content type", http.MethodPost, `{}`, nil, http.StatusUnsupportedMediaType},
+		{"same origin", http.MethodPost, `{}`, map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "same-origin"}, http.StatusNoContent},
+		{"cross site", http.MethodPost, `{}`, map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"foreign origin", http.MethodPost, `{}`, map[string]string{"Content-Type": "application/json", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"cross site get", http.MethodGet, "", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://grafana.example/features", strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("missing security headers")
+			}
+			if tt.want == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, POST" {
+				t.Errorf("Allow = %q", w.Header().Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestSecureRoute_BodyLimit(t *testing.T) {
+	app := newTestApp(t)
+	h := app.secureUploadRoute(func(w http.ResponseWriter, r *http.Request) {
+		var req CodaRegisterRequest
+		if app.decodeRequest(w, r, &req) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}, nil, 64, http.MethodPost)
+
+	serve := func(body string, length int64) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "http://grafana.example/coda/register", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.ContentLength = length
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+	if w := serve(`{"instanceId":"i-1"}`, 20); w.Code != http.StatusNoContent {
+		t.Errorf("small body: status %d: %s", w.Code, w.Body)
+	}
+	big := `{"instanceId":"` + strings.Repeat("x", 100) + `"}`
+	if w := serve(big, int64(len(big))); w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "limit 64 bytes") {
+		t.Errorf("declared large body: status %d: %s", w.Code, w.Body)
+	}
+	// A chunked body has no length up front and is cut off while read.
+	if w := serve(big, -1); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked large body: status %d: %s", w.Code, w.Body)
+	}
+
+	routes := map[string]int64{}
+	for _, route := range app.apiRoutes() {
+		routes[route.pattern] = route.maxBodyBytes
+	}
+	if routes["/coda/register"] != 0 || routes["/guides/"] != guideAssetMaxBytes || routes["/progress/import"] != maxProgressImportBytes {
+		t.Errorf("route limits = %v", routes)
+	}
+}
@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Air-gapped mirrors.
+//
+// The mirrors settings block points the external endpoints the backend
+// contacts at internal mirrors, in one place: cdn replaces the
+// interactive-learning CDN for /cdn-guides and, unless packageIndex is set,
+// the package index at {cdn}/packages/repository.json; recommender replaces
+// recommenderServiceUrl, githubApi githubApiUrl and selectorManifest
+// selectorManifestUrl. A mirror wins over the setting it replaces, and a
+// mirror that isn't an absolute http or https URL is ignored. CheckHealth,
+// Grafana's "Save & test", validates each mirror and checks that it answers.
+
+const mirrorProbeTimeout = 5 * time.Second
+
+// MirrorSettings are the mirrors settings block.
+type MirrorSettings struct {
+	CDN              string `json:"cdn"`
+	PackageIndex     string `json:"packageIndex"`
+	Recommender      string `json:"recommender"`
+	GitHubAPI        string `json:"githubApi"`
+	SelectorManifest string `json:"selectorManifest"`
+}
+
+// mirrorEndpoint is one configured mirror.
+type mirrorEndpoint struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (m MirrorSettings) endpoints() []mirrorEndpoint {
+	var out []mirrorEndpoint
+	for _, e := range []mirrorEndpoint{
+		{"cdn", m.CDN},
+		{"packageIndex", m.PackageIndex},
+		{"recommender", m.Recommender},
+		{"githubApi", m.GitHubAPI},
+		{"selectorManifest", m.SelectorManifest},
+	} {
+		if e.URL != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func validateMirrorURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("must not have a query or fragment")
+	}
+	return nil
+}
+
+func (a *App) mirrors() MirrorSettings {
+	if a.settings == nil {
+		return MirrorSettings{}
+	}
+	return a.settings.Mirrors
+}
+
+// mirrorOr returns mirror without a trailing slash when it is valid, and
+// fallback otherwise.
+func mirrorOr(mirror, fallback string) string {
+	if mirror == "" || validateMirrorURL(mirror) != nil {
+		return fallback
+	}
+	return strings.TrimSuffix(mirror, "/")
+}
+
+// cdnOrigin returns the origin CDN files on host are fetched from.
+func (a *App) cdnOrigin(host string) string {
+	if cdnOriginOverride != "" {
+		return cdnOriginOverride
+	}
+	return mirrorOr(a.mirrors().CDN, "https://"+host)
+}
+
+// packageIndexSource returns where the package index is read from.
+func (a *App) packageIndexSource() packageIndexSource {
+	src := packageIndexSource{url: packageRepositoryURL, offlineDir: a.offlineBundleDir()}
+	m := a.mirrors()
+	if cdn := mirrorOr(m.CDN, ""); cdn != "" {
+		src.url, src.mirrored = cdn+"/packages/repository.json", true
+	}
+	if index := mirrorOr(m.PackageIndex, ""); index != "" {
+		src.url, src.mirrored = index, true
+	}
+	return src
+}
+
+func (a *App) recommenderServiceURL() string {
+	if a.settings == nil {
+		return ""
+	}
+	return mirrorOr(a.settings.Mirrors.Recommender, strings.TrimSuffix(a.settings.RecommenderServiceURL, "/"))
+}
+
+func (a *App) githubAPIURL() string {
+	fallback := defaultGitHubAPIURL
+	if a.settings != nil && a.settings.GitHubAPIURL != "" {
+		fallback = strings.TrimSuffix(a.settings.GitHubAPIURL, "/")
+	}
+	return mirrorOr(a.mirrors().GitHubAPI, fallback)
+}
+
+func (a *App) selectorManifestURL() string {
+	if a.settings == nil {
+		return ""
+	}
+	return mirrorOr(a.settings.Mirrors.SelectorManifest, a.settings.SelectorManifestURL)
+}
+
+// mirrorCheck is a mirror's result in CheckHealth.
+type mirrorCheck struct {
+	mirrorEndpoint
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// checkMirrors validates the configured mirrors and requests each one. A
+// mirror that answers below 500 is reachable; 404 from a base URL is normal.
+func (a *App) checkMirrors(ctx context.Context) []mirrorCheck {
+	endpoints := a.mirrors().endpoints()
+	checks := make([]mirrorCheck, len(endpoints))
+	client := &http.Client{Timeout: mirrorProbeTimeout}
+	var wg sync.WaitGroup
+	for i, e := range endpoints {
+		checks[i].mirrorEndpoint = e
+		if err := validateMirrorURL(e.URL); err != nil {
+			checks[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(c *mirrorCheck) {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+			if err != nil {
+				c.Error = err.Error()
+				return
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				c.Error = err.Error()
+				return
+			}
+			_ = resp.Body.Close()
+			c.Status = resp.StatusCode
+			if resp.StatusCode >= http.StatusInternalServerError {
+				c.Error = fmt.Sprintf("answered %d", resp.StatusCode)
+			}
+		}(&checks[i])
+	}
+	wg.Wait()
+	return checks
+}
+
+// reportMirrorHealth adds the mirror checks to result, failing it when a
+// mirror is invalid or unreachable so "Save & test" catches the mistake.
+func (a *App) reportMirrorHealth(ctx context.Context, result *backend.CheckHealthResult) {
+	checks := a.checkMirrors(ctx)
+	if len(checks) == 0 {
+		return
+	}
+	var failed []string
+	for _, c := range checks {
+		if c.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s (%s): %s", c.Name, c.URL, c.Error))
+		}
+	}
+	if len(failed) > 0 {
+		result.Status = backend.HealthStatusError
+		result.Message = "Mirror check failed: " + strings.Join(failed, "; ")
+	} else {
+		result.Message += fmt.Sprintf("; %d mirrors reachable", len(checks))
+	}
+	result.JSONDetails, _ = json.Marshal(map[string]interface{}{"mirrors": checks})
+}
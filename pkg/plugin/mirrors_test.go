@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestMirrorURLs(t *testing.T) {
+	app := newTestApp(t)
+	app.settings = &Settings{RecommenderServiceURL: "https://recommender.example.com/", GitHubAPIURL: "https://ghe.example.com/api/v3"}
+	if got := app.recommenderServiceURL(); got != "https://recommender.example.com" {
+		t.Errorf("recommender = %q", got)
+	}
+	if got := app.packageIndexSource(); got.url != packageRepositoryURL || got.mirrored {
+		t.Errorf("package index = %+v", got)
+	}
+
+	app.settings.Mirrors = MirrorSettings{
+		CDN:         "http://mirror.internal/il/",
+		Recommender: "https://recommender.internal",
+		GitHubAPI:   "mirror.internal/github",
+	}
+	if got := app.recommenderServiceURL(); got != "https://recommender.internal" {
+		t.Errorf("mirrored recommender = %q", got)
+	}
+	if got := app.githubAPIURL(); got != "https://ghe.example.com/api/v3" {
+		t.Errorf("invalid GitHub mirror used: %q", got)
+	}
+	if got := app.cdnOrigin(cdnDefaultHost); got != "http://mirror.internal/il" {
+		t.Errorf("CDN origin = %q", got)
+	}
+	src := app.packageIndexSource()
+	if src.url != "http://mirror.internal/il/packages/repository.json" || !src.mirrored {
+		t.Errorf("package index = %+v", src)
+	}
+	if !src.allows("http://mirror.internal/il/packages/prom-101/manifest.json") || src.allows("https://interactive-learning.grafana.net/packages/repository.json") {
+		t.Error("mirrored index allows the wrong hosts")
+	}
+	app.settings.Mirrors.PackageIndex = "https://index.internal/repository.json"
+	if got := app.packageIndexSource().url; got != "https://index.internal/repository.json" {
+		t.Errorf("package index mirror = %q", got)
+	}
+}
+
+func TestMirrorPackageIndex(t *testing.T) {
+	resetPackageRecommendationsCache()
+	t.Cleanup(resetPackageRecommendationsCache)
+	var fetched []string
+	withFetcherOverride(t, func(_ context.Context, rawURL string, _ int64) ([]byte, error) {
+		fetched = append(fetched, rawURL)
+		if strings.HasSuffix(rawURL, "/repository.json") {
+			return validPayload(t), nil
+		}
+		return []byte(`{}`), nil
+	})
+	app := newTestApp(t)
+	app.settings = &Settings{Mirrors: MirrorSettings{CDN: "http://mirror.internal"}}
+	resp, err := app.getCachedPackageRecommendations(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.BaseURL != "http://mirror.internal/packages/" {
+		t.Errorf("base URL = %q", resp.BaseURL)
+	}
+	for _, u := range fetched {
+		if !strings.HasPrefix(u, "http://mirror.internal/") {
+			t.Errorf("fetched %s, not from the mirror", u)
+		}
+	}
+
+	// Removing the mirror makes the cached mirror index stale.
+	app.settings.Mirrors.CDN = ""
+	fetched = nil
+	if _, err := app.getCachedPackageRecommendations(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) == 0 || fetched[0] != packageRepositoryURL {
+		t.Errorf("fetched %v after removing the mirror", fetched)
+	}
+}
+
+func TestCheckHealthMirrors(t *testing.T) {
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	app := newTestApp(t)
+	app.coda = &CodaClient{}
+	app.settings = &Settings{Mirrors: MirrorSettings{CDN: up.URL, Recommender: up.URL}}
+	result, err := app.CheckHealth(t.Context(), &backend.CheckHealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != backend.HealthStatusOk || !strings.Contains(result.Message, "2 mirrors reachable") {
+		t.Errorf("reachable mirrors: %v %q", result.Status, result.Message)
+	}
+
+	app.settings.Mirrors = MirrorSettings{CDN: up.URL, GitHubAPI: "ftp://mirror.internal", SelectorManifest: down.URL + "/selectors.json"}
+	result, err = app.CheckHealth(t.Context(), &backend.CheckHealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var details struct {
+		Mirrors []mirrorCheck `json:"mirrors"`
+	}
+	if err := json.Unmarshal(result.JSONDetails, &details); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != backend.HealthStatusError || !strings.Contains(result.Message, "githubApi") || !strings.Contains(result.Message, "selectorManifest") || strings.Contains(result.Message, "cdn") {
+		t.Errorf("failing mirrors: %v %q", result.Status, result.Message)
+	}
+	if len(details.Mirrors) != 3 || details.Mirrors[0].Status != http.StatusNotFound || details.Mirrors[2].Status != http.StatusServiceUnavailable {
+		t.Errorf("details = %+v", details.Mirrors)
+	}
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Offline guide bundles.
+//
+// offlineGuideBundlePath names a local directory, such as a mounted volume,
+// laid out like the interactive-learning CDN: packages/repository.json and
+// each package's {path}/content.json and manifest.json. When the CDN can't
+// be reached or fails, the package index (package_recommendations.go) and
+// /cdn-guides (cdn_cache.go) read the same file from the directory instead,
+// so fully offline installs still have guides.
+
+func (a *App) offlineBundleDir() string {
+	if a.settings == nil {
+		return ""
+	}
+	return a.settings.OfflineGuideBundlePath
+}
+
+// readOfflineBundle reads path, a CDN path such as
+// prom-101/v1.0.0/content.json, from dir.
+func readOfflineBundle(dir, path string, maxBytes int64) ([]byte, error) {
+	if !cdnPathPattern.MatchString(path) {
+		return nil, fmt.Errorf("offline bundle: %q is not a guide file path", path)
+	}
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, fmt.Errorf("offline bundle: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	body, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("offline bundle: read %s: %w", path, err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("offline bundle: %s exceeded %d bytes", path, maxBytes)
+	}
+	return body, nil
+}
+
+// offlineBundleFetcher returns a fetcher that falls back to dir when fetch
+// fails.
+func offlineBundleFetcher(fetch packageRepositoryFetcher, dir string) packageRepositoryFetcher {
+	return func(ctx context.Context, rawURL string, maxBytes int64) ([]byte, error) {
+		body, err := fetch(ctx, rawURL, maxBytes)
+		if err == nil {
+			return body, nil
+		}
+		u, parseErr := url.Parse(rawURL)
+		if parseErr != nil {
+			return nil, err
+		}
+		body, offlineErr := readOfflineBundle(dir, strings.TrimPrefix(u.Path, "/"), maxBytes)
+		if offlineErr != nil {
+			return nil, fmt.Errorf("%w; %w", err, offlineErr)
+		}
+		return body, nil
+	}
+}
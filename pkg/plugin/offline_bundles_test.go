@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeOfflineBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, body := range files {
+		full := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestOfflineBundle_PackageIndex(t *testing.T) {
+	resetPackageRecommendationsCache()
+	t.Cleanup(resetPackageRecommendationsCache)
+	withFetcherOverride(t, func(context.Context, string, int64) ([]byte, error) {
+		return nil, errors.New("dial tcp: no route to host")
+	})
+	dir := writeOfflineBundle(t, map[string]string{
+		"packages/repository.json":               string(validPayload(t)),
+		"packages/prom-101/v1.0.0/manifest.json": `{"testEnvironment": {"minVersion": "11.0.0"}}`,
+	})
+
+	if _, err := refreshPackageRecommendations(t.Context(), packageIndexSource{url: packageRepositoryURL}); err == nil {
+		t.Fatal("refresh without a bundle succeeded")
+	}
+	resp, err := refreshPackageRecommendations(t.Context(), packageIndexSource{url: packageRepositoryURL, offlineDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prom *PackageEntry
+	for i := range resp.Packages {
+		if resp.Packages[i].ID == "prom-101" {
+			prom = &resp.Packages[i]
+		}
+	}
+	if prom == nil || prom.MinGrafanaVersion != "11.0.0" {
+		t.Errorf("prom-101 = %+v", prom)
+	}
+}
+
+func TestOfflineBundle_CDNGuides(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer cdn.Close()
+	cdnOriginOverride = cdn.URL
+	t.Cleanup(func() { cdnOriginOverride = "" })
+
+	app := newTestApp(t)
+	app.settings = &Settings{OfflineGuideBundlePath: writeOfflineBundle(t, map[string]string{
+		"prom-101/v1.0.0/content.json": `{"id": "prom-101"}`,
+	})}
+	w := httptest.NewRecorder()
+	app.handleCDNGuide(w, httptest.NewRequest(http.MethodGet, "/cdn-guides/prom-101/v1.0.0/content.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "OFFLINE" || w.Body.String() != `{"id": "prom-101"}` {
+		t.Errorf("status %d, X-Cache %q, body %s", w.Code, w.Header().Get("X-Cache"), w.Body)
+	}
+	w = httptest.NewRecorder()
+	app.handleCDNGuide(w, httptest.NewRequest(http.MethodGet, "/cdn-guides/loki-101/content.json", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("not in bundle: status %d, want 502", w.Code)
+	}
+}
+
+func TestReadOfflineBundle_RejectsEscapes(t *testing.T) {
+	dir := writeOfflineBundle(t, map[string]string{"a/content.json": "{}"})
+	for _, path := range []string{"../a/content.json", "/etc/passwd.json", "a/../../x.json"} {
+		if _, err := readOfflineBundle(dir, path, 1024); err == nil {
+			t.Errorf("%s: read outside the bundle", path)
+		}
+	}
+	if _, err := readOfflineBundle(dir, "a/content.json", 1); err == nil {
+		t.Error("oversized file was read")
+	}
+}
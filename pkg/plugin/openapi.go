@@ -0,0 +1,319 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// OpenAPI document for the resource API.
+//
+// GET /openapi.json describes every route in apiRoutes: paths and their
+// parameters, request and response bodies, and error statuses. Schemas are
+// reflected from the Go types the handlers decode and encode, using their
+// json tags, so the document follows the code. Errors share the
+// {"error": "..."} body written by writeError. Statuses added by the shared
+// wrappers (cross-origin, content type, feature gates, kill switch) are
+// derived from the route rather than listed by hand.
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// handleOpenAPI handles GET /openapi.json.
+func (a *App) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.writeJSON(w, openAPIDocument(a.apiRoutes(), backend.PluginConfigFromContext(r.Context()).PluginVersion), http.StatusOK)
+}
+
+// openAPIDocument builds an OpenAPI 3 document for routes.
+func openAPIDocument(routes []apiRoute, version string) map[string]interface{} {
+	if version == "" {
+		version = "dev"
+	}
+	schemas := &schemaBuilder{components: map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+			"required":   []string{"error"},
+		},
+	}}
+
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		for _, op := range route.ops {
+			if paths[op.path] == nil {
+				paths[op.path] = map[string]interface{}{}
+			}
+			paths[op.path][strings.ToLower(op.method)] = schemas.operation(route, op)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Pathfinder resource API",
+			"version": version,
+		},
+		"servers":    []map[string]string{{"url": pluginResourcesPath + "/" + apiVersion}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas.components},
+	}
+}
+
+func (b *schemaBuilder) operation(route apiRoute, op apiOperation) map[string]interface{} {
+	doc := map[string]interface{}{
+		"operationId": operationID(op),
+		"summary":     op.summary,
+	}
+	if op.admin {
+		doc["description"] = "Admin only."
+	}
+
+	var params []map[string]interface{}
+	for _, segment := range strings.Split(op.path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			params = append(params, map[string]interface{}{
+				"name":     strings.TrimSuffix(name, "}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, name := range op.query {
+		params = append(params, map[string]interface{}{
+			"name":   name,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	conditional := route.conditional && op.method == http.MethodGet
+	if conditional {
+		params = append(params, map[string]interface{}{
+			"name":   "If-None-Match",
+			"in":     "header",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	if op.request != nil {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": b.of(op.request)}},
+		}
+	}
+	if op.upload {
+		content := map[string]interface{}{}
+		for _, t := range route.uploadTypes {
+			content[t] = map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}
+		}
+		doc["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if op.response != nil {
+		success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": b.of(op.response)}}
+	}
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+	if conditional {
+		responses[strconv.Itoa(http.StatusNotModified)] = map[string]interface{}{"description": http.StatusText(http.StatusNotModified)}
+	}
+
+	errors := append([]int{}, op.errors...)
+	errors = append(errors, http.StatusTooManyRequests)
+	if op.method != http.MethodGet || route.feature != "" {
+		errors = append(errors, http.StatusForbidden)
+	}
+	if op.request != nil || op.upload {
+		errors = append(errors, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType)
+	}
+	if route.killable && op.method == http.MethodPost {
+		errors = append(errors, http.StatusServiceUnavailable)
+	}
+	for _, code := range errors {
+		responses[strconv.Itoa(code)] = map[string]interface{}{
+			"description": http.StatusText(code),
+			"content": map[string]interface{}{"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			}},
+		}
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// operationID names an operation from its method and path, e.g.
+// "putVmsIdFile" for PUT /vms/{id}/file.
+func operationID(op apiOperation) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(op.method))
+	for _, word := range strings.FieldsFunc(op.path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '.'
+	}) {
+		sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return sb.String()
+}
+
+// schemaBuilder reflects JSON schemas from Go values. Named struct types are
+// collected in components and referenced.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (b *schemaBuilder) of(v interface{}) map[string]interface{} {
+	if fields, ok := v.(apiFields); ok {
+		props := map[string]interface{}{}
+		for name, example := range fields {
+			props[name] = b.of(example)
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	return b.typeSchema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.components[t.Name()]; !ok {
+			b.components[t.Name()] = map[string]interface{}{}
+			b.components[t.Name()] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes the fields encoding/json writes for t. Request
+// types list their required fields with validate tags; for other types,
+// fields without omitempty are required.
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	b.addFields(t, props, &required, hasValidateTags(t))
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, props map[string]interface{}, required *[]string, validated bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			b.addFields(ft, props, required, validated)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		rules := strings.Split(f.Tag.Get("validate"), ",")
+		props[name] = withRules(b.typeSchema(f.Type), rules)
+		if validated && slices.Contains(rules, "required") || !validated && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func hasValidateTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("validate"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withRules adds the constraints of validate rules to schema.
+func withRules(schema map[string]interface{}, rules []string) map[string]interface{} {
+	for i, rule := range rules {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "each":
+			if items, ok := schema["items"].(map[string]interface{}); ok {
+				withRules(items, rules[i+1:])
+			}
+			return schema
+		case "min", "max":
+			n, _ := strconv.Atoi(arg)
+			switch schema["type"] {
+			case "string":
+				schema[key+"Length"] = n
+			case "array":
+				schema[key+"Items"] = n
+			case "object":
+				schema[key+"Properties"] = n
+			default:
+				schema[key+"imum"] = n
+			}
+		case "oneof":
+			schema["enum"] = strings.Fields(arg)
+		case "pattern":
+			schema["pattern"] = validationPatterns[arg].re.String()
+		}
+	}
+	return schema
+}
@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAPIRoutes_OperationsMatchMux(t *testing.T) {
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	for _, route := range app.apiRoutes() {
+		if len(route.ops) == 0 {
+			t.Errorf("%s has no operations", route.pattern)
+		}
+		for _, op := range route.ops {
+			req := httptest.NewRequest(op.method, "/"+apiVersion+param.ReplaceAllString(op.path, "x"), nil)
+			if _, pattern := mux.Handler(req); pattern != "/"+apiVersion+route.pattern {
+				t.Errorf("%s %s is served by %q, not %q", op.method, op.path, pattern, route.pattern)
+			}
+		}
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	app := newTestApp(t)
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range app.apiRoutes() {
+		for _, op := range route.ops {
+			if _, ok := doc.Paths[op.path][strings.ToLower(op.method)]; !ok {
+				t.Errorf("document is missing %s %s", op.method, op.path)
+			}
+		}
+	}
+
+	var createVM struct {
+		RequestBody struct {
+			Content map[string]struct {
+				Schema map[string]string `json:"schema"`
+			} `json:"content"`
+		} `json:"requestBody"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	}
+	if err := json.Unmarshal(doc.Paths["/vms"]["post"], &createVM); err != nil {
+		t.Fatal(err)
+	}
+	if ref := createVM.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/CreateVMHTTPRequest" {
+		t.Errorf("POST /vms request schema = %q", ref)
+	}
+	for _, code := range []string{"201", "403", "415", "503"} {
+		if _, ok := createVM.Responses[code]; !ok {
+			t.Errorf("POST /vms is missing response %s", code)
+		}
+	}
+
+	refs := regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1)
+	for _, ref := range refs {
+		if _, ok := doc.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("unresolved schema reference %s", ref[1])
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Org-level monthly usage quotas.
+//
+// A plugin instance serves one Grafana org, so the instance settings carry
+// the org's allowance: Settings.OrgQuotaVMCount caps the VMs provisioned per
+// calendar month (UTC) and Settings.OrgQuotaVMHours caps connected terminal
+// time. Usage is kept per month in the plugin store; connected time is added
+// when a session ends, and live sessions count towards the hours check too.
+// Provisioning is refused once either allowance is used up.
+
+const orgUsageCollection = "org-usage"
+
+// orgUsage is one month's recorded usage.
+type orgUsage struct {
+	Month     string  `json:"month"`
+	VMCount   int     `json:"vmCount"`
+	VMSeconds float64 `json:"vmSeconds"`
+}
+
+// quotaAllowance is one quota dimension in the GET /usage/quota response.
+// Limit and Remaining are null when the dimension is unlimited.
+type quotaAllowance struct {
+	Used      float64  `json:"used"`
+	Limit     *float64 `json:"limit"`
+	Remaining *float64 `json:"remaining"`
+}
+
+func newQuotaAllowance(used, limit float64) quotaAllowance {
+	q := quotaAllowance{Used: used}
+	if limit > 0 {
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		q.Limit = &limit
+		q.Remaining = &remaining
+	}
+	return q
+}
+
+// monthStart returns the first instant of t's calendar month in UTC.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (a *App) loadOrgUsage(month string) orgUsage {
+	usage := orgUsage{Month: month}
+	if _, err := a.store.get(orgUsageCollection, month, &usage); err != nil {
+		a.logger.Warn("Failed to read org usage", "month", month, "error", err)
+	}
+	return usage
+}
+
+// updateOrgUsage applies fn to the current month's usage and stores it.
+func (a *App) updateOrgUsage(ctxLogger log.Logger, fn func(*orgUsage)) {
+	month := monthStart(timeNow()).Format("2006-01")
+	a.orgUsageMu.Lock()
+	defer a.orgUsageMu.Unlock()
+	usage := a.loadOrgUsage(month)
+	fn(&usage)
+	if err := a.store.put(orgUsageCollection, month, usage); err != nil {
+		ctxLogger.Warn("Failed to record org usage", "month", month, "error", err)
+	}
+}
+
+// recordVMProvisioned counts a newly created VM against this month.
+func (a *App) recordVMProvisioned(ctxLogger log.Logger) {
+	a.updateOrgUsage(ctxLogger, func(u *orgUsage) { u.VMCount++ })
+}
+
+// releaseVMProvisioned takes back this month's count of a VM that failed, so
+// replacing it costs the org one VM rather than two.
+func (a *App) releaseVMProvisioned(ctxLogger log.Logger, vm *VM) {
+	if vm.State != "error" || vm.CreatedAt.Before(monthStart(timeNow())) {
+		return
+	}
+	a.updateOrgUsage(ctxLogger, func(u *orgUsage) {
+		if u.VMCount > 0 {
+			u.VMCount--
+		}
+	})
+}
+
+// recordSessionUsage adds the part of a session since startedAt that falls in
+// the current month.
+func (a *App) recordSessionUsage(ctxLogger log.Logger, startedAt time.Time) {
+	now := timeNow()
+	if start := monthStart(now); startedAt.Before(start) {
+		startedAt = start
+	}
+	if !now.After(startedAt) {
+		return
+	}
+	a.updateOrgUsage(ctxLogger, func(u *orgUsage) { u.VMSeconds += now.Sub(startedAt).Seconds() })
+}
+
+// currentOrgUsage returns this month's usage including the connected time of
+// live sessions.
+func (a *App) currentOrgUsage() orgUsage {
+	now := timeNow()
+	start := monthStart(now)
+	a.orgUsageMu.Lock()
+	usage := a.loadOrgUsage(start.Format("2006-01"))
+	a.orgUsageMu.Unlock()
+
+	a.streamSessionsMu.Lock()
+	for _, sess := range a.streamSessions {
+		if sess == nil || sess.session == nil || sess.startedAt.IsZero() {
+			continue
+		}
+		from := sess.startedAt
+		if from.Before(start) {
+			from = start
+		}
+		if now.After(from) {
+			usage.VMSeconds += now.Sub(from).Seconds()
+		}
+	}
+	a.streamSessionsMu.Unlock()
+	return usage
+}
+
+func (a *App) orgQuotaLimits() (vmCount int, vmHours float64) {
+	if a.settings == nil {
+		return 0, 0
+	}
+	return a.settings.OrgQuotaVMCount, a.settings.OrgQuotaVMHours
+}
+
+// checkOrgQuota returns a "quota exhausted" error when this month's
+// allowance is used up, nil otherwise.
+func (a *App) checkOrgQuota() error {
+	maxCount, maxHours := a.orgQuotaLimits()
+	if maxCount <= 0 && maxHours <= 0 {
+		return nil
+	}
+	usage := a.currentOrgUsage()
+	resets := monthStart(timeNow()).AddDate(0, 1, 0).Format("January 2")
+	if maxCount > 0 && usage.VMCount >= maxCount {
+		return fmt.Errorf("Organization quota exhausted: %d of %d sandbox VMs provisioned this month, resets %s", usage.VMCount, maxCount, resets)
+	}
+	if hours := usage.VMSeconds / 3600; maxHours > 0 && hours >= maxHours {
+		return fmt.Errorf("Organization quota exhausted: %.1f of %g sandbox VM-hours used this month, resets %s", hours, maxHours, resets)
+	}
+	return nil
+}
+
+// handleUsageQuota handles GET /usage/quota.
+func (a *App) handleUsageQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	maxCount, maxHours := a.orgQuotaLimits()
+	usage := a.currentOrgUsage()
+	start := monthStart(timeNow())
+	a.writeJSON(w, map[string]interface{}{
+		"month":    usage.Month,
+		"resetsAt": start.AddDate(0, 1, 0),
+		"vmCount":  newQuotaAllowance(float64(usage.VMCount), float64(maxCount)),
+		"vmHours":  newQuotaAllowance(usage.VMSeconds/3600, maxHours),
+	}, http.StatusOK)
+}
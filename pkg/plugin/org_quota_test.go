@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestCheckOrgQuota(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	app := newTestApp(t)
+	app.streamSessions = map[string]*streamSession{}
+	if err := app.checkOrgQuota(); err != nil {
+		t.Fatalf("no quota configured: %v", err)
+	}
+
+	app.settings = &Settings{OrgQuotaVMCount: 2, OrgQuotaVMHours: 3}
+	app.recordVMProvisioned(log.DefaultLogger)
+	if err := app.checkOrgQuota(); err != nil {
+		t.Fatalf("1 of 2 VMs: %v", err)
+	}
+	app.recordVMProvisioned(log.DefaultLogger)
+	if err := app.checkOrgQuota(); err == nil || !strings.Contains(err.Error(), "2 of 2 sandbox VMs") {
+		t.Errorf("count exhausted: err = %v", err)
+	}
+
+	app.settings.OrgQuotaVMCount = 0
+	app.recordSessionUsage(log.DefaultLogger, now.Add(-2*time.Hour))
+	if err := app.checkOrgQuota(); err != nil {
+		t.Fatalf("2 of 3 hours: %v", err)
+	}
+	app.streamSessions["terminal/vm-1/1"] = &streamSession{session: &TerminalSession{}, startedAt: now.Add(-time.Hour)}
+	if err := app.checkOrgQuota(); err == nil || !strings.Contains(err.Error(), "VM-hours") {
+		t.Errorf("hours exhausted with live session: err = %v", err)
+	}
+
+	// Sessions spanning the month boundary only count from the 1st.
+	now = time.Date(2026, 4, 1, 1, 0, 0, 0, time.UTC)
+	app.streamSessions = map[string]*streamSession{}
+	app.recordSessionUsage(log.DefaultLogger, now.Add(-5*time.Hour))
+	if got := app.currentOrgUsage(); got.Month != "2026-04" || got.VMCount != 0 || got.VMSeconds != 3600 {
+		t.Errorf("April usage = %+v", got)
+	}
+}
+
+func TestHandleUsageQuota(t *testing.T) {
+	restore := timeNow
+	timeNow = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC) }
+	defer func() { timeNow = restore }()
+
+	app := newTestApp(t)
+	app.settings = &Settings{OrgQuotaVMCount: 10}
+	app.recordVMProvisioned(log.DefaultLogger)
+
+	w := httptest.NewRecorder()
+	app.handleUsageQuota(w, withUser(httptest.NewRequest(http.MethodGet, "/usage/quota", nil), "alice"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp struct {
+		Month    string         `json:"month"`
+		ResetsAt time.Time      `json:"resetsAt"`
+		VMCount  quotaAllowance `json:"vmCount"`
+		VMHours  quotaAllowance `json:"vmHours"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Month != "2026-03" || !resp.ResetsAt.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("month = %s, resetsAt = %v", resp.Month, resp.ResetsAt)
+	}
+	if resp.VMCount.Used != 1 || resp.VMCount.Limit == nil || *resp.VMCount.Remaining != 9 {
+		t.Errorf("vmCount = %+v", resp.VMCount)
+	}
+	if resp.VMHours.Limit != nil || resp.VMHours.Remaining != nil {
+		t.Errorf("vmHours should be unlimited: %+v", resp.VMHours)
+	}
+}
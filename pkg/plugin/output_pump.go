@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Output backpressure.
+//
+// Terminal output goes through an outputPump rather than being sent from the
+// SSH read goroutine, so a slow SendFrame doesn't stall reads for as long as
+// it takes: the read goroutine appends to a buffer and a separate sender
+// drains it. When the buffer reaches Settings.OutputBufferKB (default 256)
+// the read goroutine waits, which stops SSH stdout reads and lets the SSH
+// channel window push back on the VM, instead of dropping output. While it
+// waits the client is sent a "lag" message, and another once it has caught
+// up, so the frontend can warn the user.
+//
+// Output frames are numbered (seq) and the pump keeps the most recent
+// Settings.ReplayBufferKB (default 128) of sent output. A client that comes
+// back from a transient Live reconnect publishes {"type":"resume","seq":N}
+// with the last seq it received; it is sent a "replay" message whose seq is
+// where the replay starts, followed by every retained frame after it, before
+// any further live output. State "truncated" means older output had already
+// been discarded and the client missed some.
+
+const (
+	defaultOutputBufferKB = 256
+	defaultReplayBufferKB = 128
+)
+
+// outputPump buffers terminal output between the SSH reader and the stream
+// sender.
+type outputPump struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	limit   int
+	blocked bool // the writer waited for room since the last take
+	closed  bool
+
+	// sendMu orders live sends against replays; it guards the fields below.
+	sendMu       sync.Mutex
+	seq          int64
+	history      []sentOutput
+	historyBytes int
+	historyLimit int
+	frameBudget  int // see stream_chunking.go
+}
+
+// sentOutput is one numbered output frame retained for replay.
+type sentOutput struct {
+	seq  int64
+	data string
+}
+
+func newOutputPump(limit, historyLimit, frameBudget int) *outputPump {
+	p := &outputPump{limit: limit, historyLimit: historyLimit, frameBudget: frameBudget}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// outputBufferLimit returns the configured output buffer size in bytes.
+func (a *App) outputBufferLimit() int {
+	kb := defaultOutputBufferKB
+	if a.settings != nil && a.settings.OutputBufferKB > 0 {
+		kb = a.settings.OutputBufferKB
+	}
+	return kb * 1024
+}
+
+// replayBufferLimit returns the configured replay history size in bytes.
+func (a *App) replayBufferLimit() int {
+	kb := defaultReplayBufferKB
+	if a.settings != nil && a.settings.ReplayBufferKB > 0 {
+		kb = a.settings.ReplayBufferKB
+	}
+	return kb * 1024
+}
+
+// write queues b, waiting while the buffer is full. It returns false once the
+// pump is closed.
+func (p *outputPump) write(b []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.buf) >= p.limit && !p.closed {
+		p.blocked = true
+		p.cond.Wait()
+	}
+	if p.closed {
+		return false
+	}
+	p.buf = append(p.buf, b...)
+	p.cond.Broadcast()
+	return true
+}
+
+// take waits for output and returns everything buffered, and whether the
+// writer had to wait for room since the previous take. ok is false once the
+// pump is closed and drained.
+func (p *outputPump) take() (out []byte, lagging, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.buf) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if len(p.buf) == 0 {
+		return nil, false, false
+	}
+	out, p.buf = p.buf, nil
+	lagging, p.blocked = p.blocked, false
+	p.cond.Broadcast()
+	return out, lagging, true
+}
+
+// close releases a waiting writer and ends the drain loop once the buffer is
+// empty.
+func (p *outputPump) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// drain sends buffered output as "output" frames, split to fit Live's
+// message size limit, until the pump is closed, bracketing periods of
+// backpressure with "lag" messages.
+func (p *outputPump) drain(sender *backend.StreamSender, onErr func(error)) {
+	send := func(output TerminalStreamOutput) error {
+		return sender.SendFrame(terminalFrame(output), data.IncludeAll)
+	}
+	reported := false
+	for {
+		out, lagging, ok := p.take()
+		if !ok {
+			return
+		}
+		if lagging && !reported {
+			reported = true
+			_ = send(TerminalStreamOutput{Type: "lag", State: "lagging", Message: "Your connection is falling behind; terminal output is paused until it catches up"})
+		}
+		for _, chunk := range splitOutput(out, p.frameBudget) {
+			if err := p.sendOutput(sender, chunk); err != nil {
+				onErr(err)
+			}
+		}
+		if reported && !lagging {
+			reported = false
+			_ = send(TerminalStreamOutput{Type: "lag", State: "ok"})
+		}
+	}
+}
+
+// sendOutput numbers out, sends it and retains it for replay, evicting the
+// oldest frames beyond historyLimit.
+func (p *outputPump) sendOutput(sender *backend.StreamSender, out string) error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	p.seq++
+	err := sender.SendFrame(terminalFrame(TerminalStreamOutput{Type: "output", Data: out, Seq: p.seq}), data.IncludeAll)
+	p.history = append(p.history, sentOutput{seq: p.seq, data: out})
+	p.historyBytes += len(out)
+	for len(p.history) > 1 && p.historyBytes > p.historyLimit {
+		p.historyBytes -= len(p.history[0].data)
+		p.history = p.history[1:]
+	}
+	return err
+}
+
+// lastSeq returns the seq of the last output frame sent.
+func (p *outputPump) lastSeq() int64 {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	return p.seq
+}
+
+// replay resends the retained output after seq, preceded by a "replay"
+// message. Live output waits until it is done.
+func (p *outputPump) replay(sender *backend.StreamSender, after int64) error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	from, state := after, "ok"
+	if after > p.seq {
+		// The client's seq belongs to another stream; nothing here follows it.
+		from, state = p.seq, "truncated"
+	} else if len(p.history) > 0 && p.history[0].seq > after+1 {
+		from, state = p.history[0].seq-1, "truncated"
+	} else if len(p.history) == 0 && p.seq > after {
+		from, state = p.seq, "truncated"
+	}
+	if err := sender.SendFrame(terminalFrame(TerminalStreamOutput{Type: "replay", Seq: from, State: state}), data.IncludeAll); err != nil {
+		return err
+	}
+	for _, h := range p.history {
+		if h.seq <= from {
+			continue
+		}
+		if err := sender.SendFrame(terminalFrame(TerminalStreamOutput{Type: "output", Data: h.data, Seq: h.seq}), data.IncludeAll); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestOutputPump_Backpressure(t *testing.T) {
+	p := newOutputPump(4, 1024, 1<<20)
+	if !p.write([]byte("abcd")) {
+		t.Fatal("write to open pump failed")
+	}
+
+	wrote := make(chan struct{})
+	go func() {
+		p.write([]byte("efgh"))
+		close(wrote)
+	}()
+	select {
+	case <-wrote:
+		t.Fatal("write did not wait for a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	waitFor(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.blocked
+	})
+	out, lagging, ok := p.take()
+	if string(out) != "abcd" || !lagging || !ok {
+		t.Errorf("take = %q, lagging %v, ok %v", out, lagging, ok)
+	}
+	<-wrote
+	out, lagging, _ = p.take()
+	if string(out) != "efgh" || lagging {
+		t.Errorf("take = %q, lagging %v", out, lagging)
+	}
+
+	p.close()
+	if p.write([]byte("x")) {
+		t.Error("write to closed pump succeeded")
+	}
+	if _, _, ok := p.take(); ok {
+		t.Error("take on closed, empty pump returned ok")
+	}
+}
+
+func TestOutputPump_DrainReportsLag(t *testing.T) {
+	rec, sender := newStreamRecorder(t)
+	p := newOutputPump(1024, 1024, 1<<20)
+	p.buf, p.blocked = []byte("one"), true
+	done := make(chan struct{})
+	go func() {
+		p.drain(sender, func(err error) { t.Error(err) })
+		close(done)
+	}()
+	count := func() int {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		return len(rec.messages)
+	}
+	waitFor(t, func() bool { return count() == 2 })
+	p.write([]byte("two"))
+	waitFor(t, func() bool { return count() == 4 })
+	p.close()
+	<-done
+
+	var got []string
+	for _, m := range rec.messages {
+		got = append(got, m.Type+":"+m.State+m.Data)
+	}
+	if want := "lag:lagging,output:one,output:two,lag:ok"; strings.Join(got, ",") != want {
+		t.Errorf("messages = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestOutputPump_Replay(t *testing.T) {
+	_, sender := newStreamRecorder(t)
+	p := newOutputPump(1024, 6, 1<<20)
+	for _, out := range []string{"aaa", "bbb", "ccc", "ddd"} {
+		if err := p.sendOutput(sender, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		after int64
+		want  string
+	}{
+		{after: 2, want: "replay:2ok,output:3ccc,output:4ddd"},
+		{after: 4, want: "replay:4ok"},
+		{after: 1, want: "replay:2truncated,output:3ccc,output:4ddd"},
+		{after: 9, want: "replay:4truncated"},
+	}
+	for _, tt := range tests {
+		rec, sender := newStreamRecorder(t)
+		if err := p.replay(sender, tt.after); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range rec.messages {
+			got = append(got, fmt.Sprintf("%s:%d%s%s", m.Type, m.Seq, m.State, m.Data))
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("replay after %d = %s, want %s", tt.after, strings.Join(got, ","), tt.want)
+		}
+	}
+}
+
+func TestPublishStream_Resume(t *testing.T) {
+	rec, sender := newStreamRecorder(t)
+	pump := newOutputPump(1024, 1024, 1<<20)
+	sess := &streamSession{id: "sess-1", vmID: "vm-1", userLogin: "alice", sender: sender, output: pump, session: &TerminalSession{VMID: "vm-1", stdin: &recordingWriter{}}}
+	app := &App{logger: log.DefaultLogger, streamSessions: map[string]*streamSession{"terminal/vm-1/1": sess}}
+	for _, out := range []string{"one", "two"} {
+		_ = pump.sendOutput(sender, out)
+	}
+
+	resp, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+		Path: "terminal/vm-1/1",
+		Data: json.RawMessage(`{"type":"resume","seq":1,"schemaVersion":1}`),
+	})
+	if err != nil || resp.Status != backend.PublishStreamStatusOK {
+		t.Fatalf("resume: resp = %+v, err = %v", resp, err)
+	}
+	replayed := rec.messages[2:]
+	if len(replayed) != 2 || replayed[0].Type != "replay" || replayed[0].Seq != 1 || replayed[1].Data != "two" {
+		t.Errorf("replayed = %+v", replayed)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -71,6 +71,10 @@ type PackageTargeting struct {
 // `milestones`, `recommends`, and `suggests` for the rich learning-journey
 // rendering — without them, the cards lack milestone counts, deferred nav
 // links, and the right "Start" CTA wiring.
+//
+// MinGrafanaVersion is the entry's testEnvironment.minVersion (from the
+// index, else the manifest). Incompatible is set per request when the
+// calling instance is older than that.
 type PackageEntry struct {
 	ID          string                 `json:"id"`
 	Path        string                 `json:"path"`
@@ -79,6 +83,10 @@ type PackageEntry struct {
 	Type        string                 `json:"type,omitempty"`
 	Targeting   *PackageTargeting      `json:"targeting,omitempty"`
 	Manifest    map[string]interface{} `json:"manifest,omitempty"`
+
+	MinGrafanaVersion string `json:"minGrafanaVersion,omitempty"`
+	Incompatible      bool   `json:"incompatible,omitempty"`
+	Bookmarked        bool   `json:"bookmarked,omitempty"`
 }
 
 // PackageRecommendationsResponse is the JSON returned to the frontend.
@@ -96,6 +104,10 @@ type rawRepositoryEntry struct {
 	Title       string            `json:"title,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Targeting   *PackageTargeting `json:"targeting,omitempty"`
+
+	TestEnvironment *struct {
+		MinVersion string `json:"minVersion,omitempty"`
+	} `json:"testEnvironment,omitempty"`
 }
 
 // packageRepositoryFetcher abstracts the HTTP fetch so tests can inject a
@@ -109,6 +121,9 @@ type rawRepositoryEntry struct {
 type packageRepositoryFetcher func(ctx context.Context, rawURL string, maxBytes int64) ([]byte, error)
 
 type packageCacheEntry struct {
+	// url is the index the entry was fetched from; a cache for another
+	// index, such as before a mirror was set, is stale.
+	url       string
 	resp      *PackageRecommendationsResponse
 	err       error
 	fetchedAt time.Time
@@ -165,7 +180,10 @@ func baseURLFromRepositoryURL(rawURL string) string {
 
 // handlePackageRecommendations serves the cached package index. It returns
 // 503 once and stays 503 for the rest of the cache TTL on any failure, so
-// air-gapped or restricted networks aren't repeatedly probed.
+// air-gapped or restricted networks aren't repeatedly probed. Packages that
+// need a newer Grafana than the caller's are flagged incompatible, or left
+// out with ?compatibleOnly=true. Packages the caller bookmarked are flagged
+// bookmarked.
 func (a *App) handlePackageRecommendations(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -184,7 +202,14 @@ func (a *App) handlePackageRecommendations(w http.ResponseWriter, r *http.Reques
 	// Grafana overrides Cache-Control to "no-store" on plugin resource
 	// responses, so we rely on the in-process cache (packageRepositoryCacheTTL)
 	// rather than HTTP caching for repeat-call dedupe.
-	a.writeJSON(w, resp, http.StatusOK)
+	gated := gatePackages(resp, versionGateFromContext(r.Context()), compatibleOnly(r))
+	if user := userLoginFromContext(r.Context()); user != "" {
+		bookmarked := a.bookmarkedGuides(user)
+		for i := range gated.Packages {
+			gated.Packages[i].Bookmarked = bookmarked[gated.Packages[i].ID]
+		}
+	}
+	a.writeJSON(w, gated, http.StatusOK)
 }
 
 // getCachedPackageRecommendations returns the cached index, refreshing it at
@@ -197,19 +222,52 @@ func (a *App) handlePackageRecommendations(w http.ResponseWriter, r *http.Reques
 // refresh wait on the inflight channel instead of serializing on the mutex
 // (which would block them for the index fetch plus the enrichment budget).
 func (a *App) getCachedPackageRecommendations(ctx context.Context) (*PackageRecommendationsResponse, error) {
+	src := a.packageIndexSource()
 	packageCacheMu.Lock()
 	if packageCache != nil {
 		ttl := packageRepositoryCacheTTL
 		if packageCache.partial {
 			ttl = packageRepositoryPartialCacheTTL
 		}
-		if timeNow().Sub(packageCache.fetchedAt) < ttl {
+		if packageCache.url == src.url && timeNow().Sub(packageCache.fetchedAt) < ttl {
 			resp, err := packageCache.resp, packageCache.err
 			packageCacheMu.Unlock()
 			return resp, err
 		}
 	}
+	packageCacheMu.Unlock()
+	return refreshPackageRecommendations(ctx, src)
+}
+
+// packageIndexSource says where the package index is read from.
+type packageIndexSource struct {
+	// url is repository.json. Unless it is a mirror it must be on an
+	// allowed interactive-learning host; a mirror's manifests must share
+	// its origin.
+	url      string
+	mirrored bool
+	// offlineDir is read for files the CDN doesn't serve.
+	offlineDir string
+}
+
+// allows reports whether rawURL may be fetched for the index.
+func (src packageIndexSource) allows(rawURL string) bool {
+	if !src.mirrored {
+		return isAllowedInteractiveLearningHost(rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	base, err := url.Parse(src.url)
+	return err == nil && u.Scheme == base.Scheme && u.Host == base.Host
+}
 
+// refreshPackageRecommendations fetches the index into the cache whatever
+// its age, or waits for a refresh already in flight. The content refresh
+// scheduler calls it so requests rarely find the cache expired.
+func refreshPackageRecommendations(ctx context.Context, src packageIndexSource) (*PackageRecommendationsResponse, error) {
+	packageCacheMu.Lock()
 	if existing := packageActiveFlight; existing != nil {
 		packageCacheMu.Unlock()
 		// Wait for the in-flight refresh to publish its result. Honour the
@@ -232,10 +290,11 @@ func (a *App) getCachedPackageRecommendations(ctx context.Context) (*PackageReco
 	// the 6-hour cache with a "context canceled" error. The index fetch
 	// timeout and the enrichment budget still apply because they're added
 	// with their own context.WithTimeout.
-	resp, partial, err := fetchAndParsePackageRepository(context.WithoutCancel(ctx), packageRepositoryURL)
+	resp, partial, err := fetchAndParsePackageRepository(context.WithoutCancel(ctx), src)
 
 	packageCacheMu.Lock()
 	packageCache = &packageCacheEntry{
+		url:       src.url,
 		resp:      resp,
 		err:       err,
 		fetchedAt: timeNow(),
@@ -253,8 +312,9 @@ func (a *App) getCachedPackageRecommendations(ctx context.Context) (*PackageReco
 // fetchAndParsePackageRepository performs the network fetch and trims the
 // response to the slim shape the frontend consumes. The bool reports whether
 // manifest enrichment was cut short by its total budget (partial result).
-func fetchAndParsePackageRepository(ctx context.Context, rawURL string) (*PackageRecommendationsResponse, bool, error) {
-	if !isAllowedInteractiveLearningHost(rawURL) {
+func fetchAndParsePackageRepository(ctx context.Context, src packageIndexSource) (*PackageRecommendationsResponse, bool, error) {
+	rawURL := src.url
+	if !src.allows(rawURL) {
 		return nil, false, fmt.Errorf("package repository host not allowed")
 	}
 
@@ -262,6 +322,9 @@ func fetchAndParsePackageRepository(ctx context.Context, rawURL string) (*Packag
 	if fetch == nil {
 		fetch = defaultPackageRepositoryFetcher
 	}
+	if src.offlineDir != "" {
+		fetch = offlineBundleFetcher(fetch, src.offlineDir)
+	}
 
 	body, err := fetch(ctx, rawURL, packageRepositoryMaxBytes)
 	if err != nil {
@@ -285,17 +348,26 @@ func fetchAndParsePackageRepository(ctx context.Context, rawURL string) (*Packag
 		if entry.Path == "" {
 			continue
 		}
-		packages = append(packages, PackageEntry{
+		pkg := PackageEntry{
 			ID:          id,
 			Path:        entry.Path,
 			Title:       entry.Title,
 			Description: entry.Description,
 			Type:        entry.Type,
 			Targeting:   entry.Targeting,
-		})
+		}
+		if entry.TestEnvironment != nil {
+			pkg.MinGrafanaVersion = entry.TestEnvironment.MinVersion
+		}
+		packages = append(packages, pkg)
 	}
 
-	partial := enrichPackagesWithManifests(ctx, baseURL, packages, fetch)
+	partial := enrichPackagesWithManifests(ctx, baseURL, packages, fetch, src.allows)
+	for i := range packages {
+		if packages[i].MinGrafanaVersion == "" {
+			packages[i].MinGrafanaVersion = manifestMinVersion(packages[i].Manifest)
+		}
+	}
 
 	return &PackageRecommendationsResponse{
 		BaseURL:  baseURL,
@@ -303,6 +375,28 @@ func fetchAndParsePackageRepository(ctx context.Context, rawURL string) (*Packag
 	}, partial, nil
 }
 
+// manifestMinVersion returns a parsed manifest's testEnvironment.minVersion.
+func manifestMinVersion(manifest map[string]interface{}) string {
+	env, _ := manifest["testEnvironment"].(map[string]interface{})
+	v, _ := env["minVersion"].(string)
+	return v
+}
+
+// gatePackages flags the packages in resp that need a newer Grafana than
+// gate's, or drops them when only is set. The cached response is shared, so
+// the result is a copy.
+func gatePackages(resp *PackageRecommendationsResponse, gate versionGate, only bool) *PackageRecommendationsResponse {
+	gated := &PackageRecommendationsResponse{BaseURL: resp.BaseURL, Packages: make([]PackageEntry, 0, len(resp.Packages))}
+	for _, pkg := range resp.Packages {
+		pkg.Incompatible = gate.incompatible(pkg.MinGrafanaVersion)
+		if pkg.Incompatible && only {
+			continue
+		}
+		gated.Packages = append(gated.Packages, pkg)
+	}
+	return gated
+}
+
 // enrichPackagesWithManifests fetches targeted packages' manifest.json in
 // parallel (bounded concurrency, bounded total time) and inlines it into each
 // PackageEntry. Untargeted entries are skipped: they can only surface through
@@ -316,6 +410,7 @@ func enrichPackagesWithManifests(
 	baseURL string,
 	packages []PackageEntry,
 	fetch packageRepositoryFetcher,
+	allowed func(string) bool,
 ) bool {
 	if baseURL == "" || len(packages) == 0 {
 		return false
@@ -337,7 +432,7 @@ func enrichPackagesWithManifests(
 			continue
 		}
 		// Defensive: only fetch from the same allowlisted host as the index.
-		if !isAllowedInteractiveLearningHost(manifestURL) {
+		if !allowed(manifestURL) {
 			continue
 		}
 
@@ -139,6 +139,76 @@ func TestHandlePackageRecommendations_Success(t *testing.T) {
 	}
 }
 
+func TestHandlePackageRecommendations_FlagsBookmarks(t *testing.T) {
+	resetPackageRecommendationsCache()
+	fetcher, _ := stubFetcher(t, validPayload(t), nil)
+	withFetcherOverride(t, fetcher)
+
+	app := newTestApp(t)
+	if err := app.store.put(bookmarkCollection, "ana", userBookmarks{Bookmarks: []guideBookmark{{GuideID: "prom-101"}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"ana", "bo"} {
+		rr := httptest.NewRecorder()
+		app.handlePackageRecommendations(rr, roleRequest(http.MethodGet, "/package-recommendations", "", user, "Viewer"))
+		var resp PackageRecommendationsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, p := range resp.Packages {
+			if want := user == "ana" && p.ID == "prom-101"; p.Bookmarked != want {
+				t.Errorf("%s: %s bookmarked = %v", user, p.ID, p.Bookmarked)
+			}
+		}
+	}
+}
+
+func TestHandlePackageRecommendations_GatesOnGrafanaVersion(t *testing.T) {
+	resetPackageRecommendationsCache()
+	payload, err := json.Marshal(map[string]map[string]any{
+		"old":    {"path": "old/v1", "testEnvironment": map[string]any{"minVersion": "11.0.0"}},
+		"future": {"path": "future/v1", "testEnvironment": map[string]any{"minVersion": "13.0.0"}},
+		"any":    {"path": "any/v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher, _ := stubFetcher(t, payload, nil)
+	withFetcherOverride(t, fetcher)
+	app := newTestApp(t)
+
+	get := func(target string) map[string]PackageEntry {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		app.handlePackageRecommendations(rr, withGrafanaVersion(t, httptest.NewRequest(http.MethodGet, target, nil), "12.3.0"))
+		var resp PackageRecommendationsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		byID := map[string]PackageEntry{}
+		for _, p := range resp.Packages {
+			byID[p.ID] = p
+		}
+		return byID
+	}
+
+	packages := get("/package-recommendations")
+	if len(packages) != 3 || !packages["future"].Incompatible || packages["old"].Incompatible || packages["any"].Incompatible {
+		t.Errorf("flagged packages = %+v", packages)
+	}
+	if packages["future"].MinGrafanaVersion != "13.0.0" {
+		t.Errorf("minGrafanaVersion = %q", packages["future"].MinGrafanaVersion)
+	}
+	packages = get("/package-recommendations?compatibleOnly=true")
+	if _, ok := packages["future"]; ok || len(packages) != 2 {
+		t.Errorf("filtered packages = %+v", packages)
+	}
+	// Gating works on a copy; the cached index keeps every package unflagged.
+	if packageCache.resp.Packages[0].Incompatible || len(packageCache.resp.Packages) != 3 {
+		t.Error("gating modified the cached index")
+	}
+}
+
 func TestHandlePackageRecommendations_CachesAcrossCalls(t *testing.T) {
 	resetPackageRecommendationsCache()
 	withFrozenTime(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
@@ -291,7 +361,7 @@ func TestIsAllowedInteractiveLearningHost(t *testing.T) {
 }
 
 func TestFetchAndParsePackageRepository_RejectsDisallowedHost(t *testing.T) {
-	_, _, err := fetchAndParsePackageRepository(context.Background(), "https://evil.example.com/repository.json")
+	_, _, err := fetchAndParsePackageRepository(context.Background(), packageIndexSource{url: "https://evil.example.com/repository.json"})
 	if err == nil || !strings.Contains(err.Error(), "host not allowed") {
 		t.Fatalf("expected host-not-allowed error, got %v", err)
 	}
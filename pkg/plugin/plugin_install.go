@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Plugin installs for guide steps.
+//
+// "Install the X data source plugin" steps call POST /plugin-installs so the
+// learner doesn't leave the guide for the plugin catalog. The backend asks
+// Grafana to install the plugin through its plugin install API, as the
+// plugin's service account, and reports what Grafana did. Only admins can
+// install, and only when the plugin's allowPluginInstall setting is on;
+// Grafana's own [plugins] plugin_admin_enabled must also allow installs.
+
+var (
+	pluginIDPattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,127}$`)
+	pluginVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+[0-9A-Za-z.+-]{0,40}$`)
+)
+
+const (
+	pluginInstallInstalled        = "installed"
+	pluginInstallAlreadyInstalled = "already-installed"
+)
+
+type pluginInstallRequest struct {
+	PluginID string `json:"pluginId" validate:"required,pattern=pluginId"`
+	Version  string `json:"version,omitempty" validate:"pattern=version"`
+}
+
+type pluginInstallResponse struct {
+	PluginID string `json:"pluginId"`
+	Version  string `json:"version,omitempty"`
+	Status   string `json:"status"`
+}
+
+// pluginInstallAllowed reports whether the plugin settings allow installs.
+func (a *App) pluginInstallAllowed() bool {
+	return a.settings != nil && a.settings.AllowPluginInstall
+}
+
+// handlePluginInstalls handles POST /plugin-installs (admin only).
+func (a *App) handlePluginInstalls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can install plugins", http.StatusForbidden)
+		return
+	}
+	if !a.pluginInstallAllowed() {
+		a.writeError(w, "Plugin installation is disabled; enable allowPluginInstall in the plugin settings", http.StatusForbidden)
+		return
+	}
+	var req pluginInstallRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+
+	api, err := resolveGrafanaAPI(r.Context())
+	if err != nil {
+		a.writeError(w, "Plugin installation needs the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+		return
+	}
+	logger := a.ctxLogger(r.Context())
+
+	existing, err := api.PluginSettings(r.Context(), req.PluginID)
+	if err != nil {
+		logger.Error("Failed to check installed plugin", "pluginID", req.PluginID, "error", err)
+		a.writeError(w, "Failed to check whether the plugin is installed", http.StatusBadGateway)
+		return
+	}
+	if existing != nil && (req.Version == "" || req.Version == existing.Info.Version) {
+		a.writeJSON(w, pluginInstallResponse{PluginID: req.PluginID, Version: existing.Info.Version, Status: pluginInstallAlreadyInstalled}, http.StatusOK)
+		return
+	}
+
+	if err := api.InstallPlugin(r.Context(), req.PluginID, req.Version); err != nil {
+		logger.Warn("Plugin install failed", "pluginID", req.PluginID, "version", req.Version, "error", err)
+		var apiErr *grafanaAPIError
+		switch {
+		case !errors.As(err, &apiErr):
+			a.writeError(w, "Failed to reach Grafana to install the plugin", http.StatusBadGateway)
+		case apiErr.status == http.StatusNotFound:
+			a.writeError(w, fmt.Sprintf("Plugin %s was not found in the plugin catalog", req.PluginID), http.StatusNotFound)
+		case apiErr.status == http.StatusConflict:
+			a.writeError(w, fmt.Sprintf("Plugin %s is already installed", req.PluginID), http.StatusConflict)
+		default:
+			a.writeError(w, "Grafana refused the install: "+apiErr.message, http.StatusBadGateway)
+		}
+		return
+	}
+
+	resp := pluginInstallResponse{PluginID: req.PluginID, Version: req.Version, Status: pluginInstallInstalled}
+	if installed, err := api.PluginSettings(r.Context(), req.PluginID); err == nil && installed != nil {
+		resp.Version = installed.Info.Version
+	}
+	a.recordAudit(logger, auditEntry{Actor: admin, Action: "plugin.install", Details: req.PluginID + " " + resp.Version})
+	a.writeJSON(w, resp, http.StatusOK)
+}
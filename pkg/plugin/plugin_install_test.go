@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestPluginInstalls(t *testing.T) {
+	api := &fakeGrafanaAPI{plugins: map[string]*grafanaPluginSettings{"prometheus": {ID: "prometheus"}}}
+	useFakeGrafanaAPI(t, api)
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), settings: &Settings{AllowPluginInstall: true}}
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	install := func(body, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(http.MethodPost, "/v1/plugin-installs", body, "root", role))
+		return w
+	}
+
+	w := install(`{"pluginId": "grafana-clock-panel", "version": "2.1.0"}`, "Admin")
+	var resp pluginInstallResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("install: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if resp.Status != pluginInstallInstalled || resp.Version != "2.1.0" {
+		t.Errorf("install = %+v", resp)
+	}
+	if entries := app.store.keys(auditCollection); len(entries) != 1 {
+		t.Errorf("audit entries = %d, want 1", len(entries))
+	}
+
+	w = install(`{"pluginId": "prometheus"}`, "Admin")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Status != pluginInstallAlreadyInstalled {
+		t.Errorf("already installed: status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	api.installErr = &grafanaAPIError{status: http.StatusNotFound, message: "Plugin not found"}
+	if w := install(`{"pluginId": "no-such-panel"}`, "Admin"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown plugin: status=%d", w.Code)
+	}
+	api.installErr = &grafanaAPIError{status: http.StatusForbidden, message: "Plugin admin is disabled"}
+	if w := install(`{"pluginId": "grafana-polystat-panel"}`, "Admin"); w.Code != http.StatusBadGateway {
+		t.Errorf("refused install: status=%d", w.Code)
+	}
+
+	if w := install(`{"pluginId": "../etc"}`, "Admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad plugin ID: status=%d", w.Code)
+	}
+	if w := install(`{"pluginId": "grafana-clock-panel"}`, "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("editor: status=%d", w.Code)
+	}
+	app.settings.AllowPluginInstall = false
+	if w := install(`{"pluginId": "grafana-clock-panel"}`, "Admin"); w.Code != http.StatusForbidden {
+		t.Errorf("installs disabled: status=%d", w.Code)
+	}
+}
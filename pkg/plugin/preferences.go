@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Per-user Pathfinder preferences.
+//
+// GET /preferences returns the caller's stored preferences and PUT replaces
+// them, so settings follow the user across browsers. Unset fields (zero, or
+// null for openPanelOnLaunch) mean the frontend's default or the org
+// setting.
+
+const preferencesCollection = "preferences"
+
+var languageTagPattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8}){0,3}$`)
+
+// UserPreferences is the body of PUT /preferences and the response of both
+// methods.
+type UserPreferences struct {
+	SidebarWidth      int        `json:"sidebarWidth,omitempty" validate:"min=240,max=2000"`
+	OpenPanelOnLaunch *bool      `json:"openPanelOnLaunch,omitempty"`
+	ContentLanguage   string     `json:"contentLanguage,omitempty" validate:"pattern=language"`
+	TerminalFontSize  int        `json:"terminalFontSize,omitempty" validate:"min=8,max=32"`
+	UpdatedAt         *time.Time `json:"updatedAt,omitempty"`
+}
+
+// handlePreferences handles GET and PUT /preferences for the caller.
+func (a *App) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var prefs UserPreferences
+		if _, err := a.store.get(preferencesCollection, user, &prefs); err != nil {
+			a.ctxLogger(r.Context()).Warn("Failed to read preferences", "user", user, "error", err)
+		}
+		a.writeJSON(w, prefs, http.StatusOK)
+	case http.MethodPut:
+		var prefs UserPreferences
+		if !a.decodeRequest(w, r, &prefs) {
+			return
+		}
+		now := timeNow().UTC()
+		prefs.UpdatedAt = &now
+		if err := a.store.put(preferencesCollection, user, prefs); err != nil {
+			a.ctxLogger(r.Context()).Error("Failed to store preferences", "user", user, "error", err)
+			a.writeError(w, "Failed to store preferences", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, prefs, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlePreferences(t *testing.T) {
+	app := newTestApp(t)
+	before := time.Now()
+	serve := func(method, body, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.handlePreferences(w, roleRequest(method, "/preferences", body, user, "Viewer"))
+		return w
+	}
+
+	if w := serve(http.MethodGet, "", "ana"); w.Code != http.StatusOK || w.Body.String() != "{}\n" {
+		t.Errorf("empty preferences: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPut, `{"sidebarWidth": 480, "openPanelOnLaunch": false, "contentLanguage": "pt-BR", "terminalFontSize": 14}`, "ana"); w.Code != http.StatusOK {
+		t.Fatalf("put: status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var prefs UserPreferences
+	if err := json.Unmarshal(serve(http.MethodGet, "", "ana").Body.Bytes(), &prefs); err != nil {
+		t.Fatal(err)
+	}
+	if prefs.SidebarWidth != 480 || prefs.OpenPanelOnLaunch == nil || *prefs.OpenPanelOnLaunch || prefs.ContentLanguage != "pt-BR" || prefs.TerminalFontSize != 14 || prefs.UpdatedAt == nil || prefs.UpdatedAt.Before(before) {
+		t.Errorf("preferences = %+v", prefs)
+	}
+	if w := serve(http.MethodGet, "", "bo"); w.Code != http.StatusOK || w.Body.String() != "{}\n" {
+		t.Errorf("bo's preferences: %s", w.Body.String())
+	}
+
+	for _, body := range []string{`{"sidebarWidth": 100}`, `{"terminalFontSize": 72}`, `{"contentLanguage": "english!"}`, `not json`} {
+		if w := serve(http.MethodPut, body, "ana"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", body, w.Code)
+		}
+	}
+	if w := serve(http.MethodGet, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status=%d", w.Code)
+	}
+}
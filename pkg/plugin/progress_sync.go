@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Cross-device step progress.
+//
+// The frontend keeps completed interactive steps per guide (contentKey) and
+// section. On load it posts its local state to /progress/sync and replaces
+// it with the merged state the backend returns. Each step carries completed
+// and updatedAt; a reset is sent as completed false so it can win over an
+// older completion. Merging is last-writer-wins per step: the newer
+// updatedAt is kept, and on a tie a completion wins. updatedAt in the future
+// is clamped to the server's clock so a fast device clock can't pin a step.
+// Local state imported without timestamps has a zero updatedAt and only
+// fills gaps.
+
+const (
+	progressCollection     = "step-progress"
+	maxProgressStepsStored = 20000
+)
+
+// stepProgress is one step's completion state.
+type stepProgress struct {
+	ContentKey string    `json:"contentKey" validate:"required,max=500"`
+	SectionID  string    `json:"sectionId" validate:"required,max=200"`
+	StepID     string    `json:"stepId" validate:"required,max=200"`
+	Completed  bool      `json:"completed"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Device     string    `json:"device,omitempty"`
+}
+
+func (s stepProgress) key() string {
+	return s.ContentKey + "\x00" + s.SectionID + "\x00" + s.StepID
+}
+
+// newerThan reports whether s wins over other under last-writer-wins.
+func (s stepProgress) newerThan(other stepProgress) bool {
+	if !s.UpdatedAt.Equal(other.UpdatedAt) {
+		return s.UpdatedAt.After(other.UpdatedAt)
+	}
+	return s.Completed && !other.Completed
+}
+
+// userProgress is the stored document for one user.
+type userProgress struct {
+	Steps map[string]stepProgress `json:"steps"`
+}
+
+// SyncProgressRequest is the JSON body for POST /progress/sync.
+type SyncProgressRequest struct {
+	Device string         `json:"device,omitempty" validate:"max=100"`
+	Steps  []stepProgress `json:"steps" validate:"max=1000"`
+}
+
+type syncProgressResponse struct {
+	Steps    []stepProgress `json:"steps"`
+	Merged   int            `json:"merged"`
+	SyncedAt time.Time      `json:"syncedAt"`
+}
+
+// merge applies incoming to p and returns how many steps changed.
+func (p *userProgress) merge(incoming []stepProgress) int {
+	if p.Steps == nil {
+		p.Steps = map[string]stepProgress{}
+	}
+	changed := 0
+	for _, s := range incoming {
+		key := s.key()
+		existing, ok := p.Steps[key]
+		if ok && !s.newerThan(existing) {
+			continue
+		}
+		if !ok && len(p.Steps) >= maxProgressStepsStored {
+			continue
+		}
+		p.Steps[key] = s
+		changed++
+	}
+	return changed
+}
+
+// handleProgressSync handles POST /progress/sync: it merges the caller's
+// local step state and returns the merged state.
+func (a *App) handleProgressSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	var req SyncProgressRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	now := timeNow().UTC()
+	for i := range req.Steps {
+		if errs := validateRequest(req.Steps[i]); len(errs) > 0 {
+			a.writeError(w, fmt.Sprintf("Invalid request body: steps[%d].%s %s", i, errs[0].Field, errs[0].Message), http.StatusBadRequest)
+			return
+		}
+		if req.Steps[i].UpdatedAt.After(now) {
+			req.Steps[i].UpdatedAt = now
+		}
+		req.Steps[i].UpdatedAt = req.Steps[i].UpdatedAt.UTC()
+		req.Steps[i].Device = req.Device
+	}
+
+	a.progressMu.Lock()
+	var p userProgress
+	_, err := a.store.get(progressCollection, user, &p)
+	merged := 0
+	if err == nil {
+		if merged = p.merge(req.Steps); merged > 0 {
+			err = a.store.put(progressCollection, user, p)
+		}
+	}
+	a.progressMu.Unlock()
+	if err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to sync step progress", "user", user, "error", err)
+		a.writeError(w, "Failed to sync progress", http.StatusInternalServerError)
+		return
+	}
+
+	resp := syncProgressResponse{Steps: []stepProgress{}, Merged: merged, SyncedAt: now}
+	for _, s := range p.Steps {
+		resp.Steps = append(resp.Steps, s)
+	}
+	sort.Slice(resp.Steps, func(i, j int) bool { return resp.Steps[i].key() < resp.Steps[j].key() })
+	a.writeJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleProgressSync(t *testing.T) {
+	app := newTestApp(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	withFrozenTime(t, base)
+	sync := func(body, user string) syncProgressResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleProgressSync(w, roleRequest(http.MethodPost, "/progress/sync", body, user, "Viewer"))
+		var resp syncProgressResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("sync %s: status=%d body=%s", body, w.Code, w.Body.String())
+		}
+		return resp
+	}
+	state := func(resp syncProgressResponse) map[string]bool {
+		m := map[string]bool{}
+		for _, s := range resp.Steps {
+			m[s.SectionID+"/"+s.StepID] = s.Completed
+		}
+		return m
+	}
+
+	// The laptop completes two steps; the phone, offline, had reset one of
+	// them later and completed another earlier.
+	laptop := sync(`{"device": "laptop", "steps": [
+		{"contentKey": "alerting-101", "sectionId": "s1", "stepId": "a", "completed": true, "updatedAt": "2026-03-01T10:00:00Z"},
+		{"contentKey": "alerting-101", "sectionId": "s1", "stepId": "b", "completed": true, "updatedAt": "2026-03-01T10:05:00Z"}
+	]}`, "ana")
+	if laptop.Merged != 2 || len(laptop.Steps) != 2 || !laptop.SyncedAt.Equal(base) {
+		t.Fatalf("laptop sync = %+v", laptop)
+	}
+	phone := sync(`{"device": "phone", "steps": [
+		{"contentKey": "alerting-101", "sectionId": "s1", "stepId": "a", "completed": false, "updatedAt": "2026-03-01T11:00:00Z"},
+		{"contentKey": "alerting-101", "sectionId": "s1", "stepId": "b", "completed": false, "updatedAt": "2026-03-01T09:00:00Z"},
+		{"contentKey": "alerting-101", "sectionId": "s2", "stepId": "c", "completed": true, "updatedAt": "2026-03-01T09:30:00Z"}
+	]}`, "ana")
+	if got := state(phone); phone.Merged != 2 || len(got) != 3 || got["s1/a"] || !got["s1/b"] || !got["s2/c"] {
+		t.Errorf("phone sync: merged=%d state=%v", phone.Merged, got)
+	}
+	if phone.Steps[0].Device != "phone" || phone.Steps[1].Device != "laptop" {
+		t.Errorf("devices = %s, %s", phone.Steps[0].Device, phone.Steps[1].Device)
+	}
+
+	// Same timestamp: the completion wins. Timestamps ahead of the server are
+	// clamped, and a zero timestamp only fills gaps.
+	tie := sync(`{"steps": [
+		{"contentKey": "alerting-101", "sectionId": "s1", "stepId": "a", "completed": true, "updatedAt": "2026-03-01T11:00:00Z"},
+		{"contentKey": "alerting-101", "sectionId": "s2", "stepId": "d", "completed": true, "updatedAt": "2027-01-01T00:00:00Z"},
+		{"contentKey": "alerting-101", "sectionId": "s2", "stepId": "c", "completed": false},
+		{"contentKey": "loki-101", "sectionId": "s1", "stepId": "a", "completed": true}
+	]}`, "ana")
+	if got := state(tie); tie.Merged != 3 || !got["s1/a"] || !got["s2/c"] || len(tie.Steps) != 5 {
+		t.Errorf("tie sync: merged=%d state=%v", tie.Merged, got)
+	}
+	for _, s := range tie.Steps {
+		if s.StepID == "d" && !s.UpdatedAt.Equal(base) {
+			t.Errorf("future updatedAt stored as %v", s.UpdatedAt)
+		}
+	}
+
+	// An empty sync reads the state; other users' progress is separate.
+	if got := sync(`{"steps": []}`, "ana"); got.Merged != 0 || len(got.Steps) != 5 {
+		t.Errorf("read = %+v", got)
+	}
+	if got := sync(`{}`, "bo"); got.Steps == nil || len(got.Steps) != 0 {
+		t.Errorf("bo = %+v", got)
+	}
+
+	for _, body := range []string{
+		`{"steps": [{"contentKey": "alerting-101", "sectionId": "s1"}]}`,
+		`{"device": "x", "steps": [{"sectionId": "s1", "stepId": "a"}]}`,
+	} {
+		w := httptest.NewRecorder()
+		app.handleProgressSync(w, roleRequest(http.MethodPost, "/progress/sync", body, "ana", "Viewer"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package plugin
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Progress export and import.
+//
+// GET /progress/export returns everything the plugin keeps about the
+// caller's learning as one JSON document: learning activity and badges,
+// step progress, bookmarks, guide history and preferences. POST
+// /progress/import merges such a document into the caller's data on this
+// instance, for example when moving from a trial stack to production.
+// Logins can differ between instances, so the document is always imported
+// as the caller.
+//
+// Imports are idempotent: importing the same document twice changes
+// nothing the second time. Completed guides and active days are unions,
+// with the larger completion count and the earlier earned badge kept. Steps
+// merge last-writer-wins as in /progress/sync. Existing bookmarks are kept;
+// for history the later view wins. Preferences are taken only when newer
+// than the local ones. The leaderboard opt-out is not imported.
+
+const (
+	progressExportVersion  = 1
+	maxProgressImportBytes = 8 << 20
+)
+
+// progressExport is the document GET /progress/export returns and POST
+// /progress/import accepts.
+type progressExport struct {
+	Version          int                 `json:"version" validate:"required,oneof=1"`
+	ExportedAt       time.Time           `json:"exportedAt"`
+	User             string              `json:"user,omitempty"`
+	LearningActivity *learnerActivity    `json:"learningActivity,omitempty"`
+	StepProgress     []stepProgress      `json:"stepProgress"`
+	Bookmarks        []guideBookmark     `json:"bookmarks"`
+	History          []guideHistoryEntry `json:"history"`
+	Preferences      *UserPreferences    `json:"preferences,omitempty"`
+}
+
+// progressImportReport counts what an import added or changed.
+type progressImportReport struct {
+	Guides      int  `json:"guides"`
+	Days        int  `json:"days"`
+	Badges      int  `json:"badges"`
+	Steps       int  `json:"steps"`
+	Bookmarks   int  `json:"bookmarks"`
+	History     int  `json:"history"`
+	Preferences bool `json:"preferences"`
+}
+
+// check returns why the document is invalid, or "" if it isn't.
+func (e progressExport) check() string {
+	if l := e.LearningActivity; l != nil {
+		if len(l.Guides) > maxActivityGuides || len(l.Days) > maxActivityDays {
+			return "learningActivity is too large"
+		}
+		for id, g := range l.Guides {
+			if !guideIDPattern.MatchString(id) || (g.Category != "" && !workspaceNamePattern.MatchString(g.Category)) || g.Count < 0 {
+				return fmt.Sprintf("learningActivity.guides[%q] is invalid", id)
+			}
+		}
+		for _, day := range l.Days {
+			if _, err := time.Parse(time.DateOnly, day); err != nil {
+				return fmt.Sprintf("learningActivity.days has invalid day %q", day)
+			}
+		}
+		for id := range l.Badges {
+			if !workspaceNamePattern.MatchString(id) {
+				return fmt.Sprintf("learningActivity.badges has invalid badge %q", id)
+			}
+		}
+	}
+	if len(e.StepProgress) > maxProgressStepsStored {
+		return fmt.Sprintf("stepProgress must have at most %d items", maxProgressStepsStored)
+	}
+	for i, s := range e.StepProgress {
+		if errs := validateRequest(s); len(errs) > 0 {
+			return fmt.Sprintf("stepProgress[%d].%s %s", i, errs[0].Field, errs[0].Message)
+		}
+	}
+	for i, b := range e.Bookmarks {
+		if errs := validateRequest(CreateBookmarkRequest{GuideID: b.GuideID, Title: b.Title, URL: b.URL, Note: b.Note}); len(errs) > 0 {
+			return fmt.Sprintf("bookmarks[%d].%s %s", i, errs[0].Field, errs[0].Message)
+		}
+	}
+	for i, h := range e.History {
+		if errs := validateRequest(RecordHistoryRequest{GuideID: h.GuideID, Title: h.Title, URL: h.URL, StepIndex: &h.StepIndex, TotalSteps: h.TotalSteps}); len(errs) > 0 {
+			return fmt.Sprintf("history[%d].%s %s", i, errs[0].Field, errs[0].Message)
+		}
+	}
+	if e.Preferences != nil {
+		if errs := validateRequest(e.Preferences); len(errs) > 0 {
+			return fmt.Sprintf("preferences.%s %s", errs[0].Field, errs[0].Message)
+		}
+	}
+	return ""
+}
+
+// exportProgress collects user's progress.
+func (a *App) exportProgress(user string) progressExport {
+	activity := a.loadLearnerActivity(user)
+	var progress userProgress
+	_, _ = a.store.get(progressCollection, user, &progress)
+	var history guideHistory
+	_, _ = a.store.get(historyCollection, user, &history)
+	var prefs UserPreferences
+	hasPrefs, _ := a.store.get(preferencesCollection, user, &prefs)
+
+	doc := progressExport{
+		Version:          progressExportVersion,
+		ExportedAt:       timeNow().UTC(),
+		User:             user,
+		LearningActivity: &activity,
+		StepProgress:     []stepProgress{},
+		Bookmarks:        a.listBookmarks(user),
+		History:          append([]guideHistoryEntry{}, history.Entries...),
+	}
+	for _, s := range progress.Steps {
+		doc.StepProgress = append(doc.StepProgress, s)
+	}
+	sort.Slice(doc.StepProgress, func(i, j int) bool { return doc.StepProgress[i].key() < doc.StepProgress[j].key() })
+	if hasPrefs {
+		doc.Preferences = &prefs
+	}
+	return doc
+}
+
+// mergeActivity merges imported learning activity into l and counts what
+// it added.
+func (l *learnerActivity) mergeActivity(in learnerActivity, report *progressImportReport) {
+	for id, g := range in.Guides {
+		local, ok := l.Guides[id]
+		if !ok {
+			if len(l.Guides) >= maxActivityGuides {
+				continue
+			}
+			l.Guides[id] = g
+			report.Guides++
+			continue
+		}
+		merged := local
+		merged.Count = max(local.Count, g.Count)
+		if !g.FirstCompletedAt.IsZero() && g.FirstCompletedAt.Before(local.FirstCompletedAt) {
+			merged.FirstCompletedAt = g.FirstCompletedAt
+		}
+		if g.LastCompletedAt.After(local.LastCompletedAt) {
+			merged.LastCompletedAt = g.LastCompletedAt
+		}
+		if merged.Category == "" {
+			merged.Category = g.Category
+		}
+		l.Guides[id] = merged
+	}
+
+	days := map[string]bool{}
+	for _, d := range l.Days {
+		days[d] = true
+	}
+	for _, d := range in.Days {
+		if !days[d] {
+			days[d] = true
+			l.Days = append(l.Days, d)
+			report.Days++
+		}
+	}
+	sort.Strings(l.Days)
+	if over := len(l.Days) - maxActivityDays; over > 0 {
+		l.Days = append([]string(nil), l.Days[over:]...)
+	}
+	l.LongestStreak = max(l.LongestStreak, in.LongestStreak, longestStreak(l.Days))
+
+	for id, at := range in.Badges {
+		local, ok := l.Badges[id]
+		if ok && !at.Before(local) {
+			continue
+		}
+		if l.Badges == nil {
+			l.Badges = map[string]time.Time{}
+		}
+		l.Badges[id] = at
+		if !ok {
+			report.Badges++
+		}
+	}
+}
+
+// longestStreak returns the longest run of consecutive days in days, which
+// must be sorted.
+func longestStreak(days []string) int {
+	longest, run := 0, 0
+	var prev time.Time
+	for _, d := range days {
+		t, err := time.Parse(time.DateOnly, d)
+		if err != nil {
+			continue
+		}
+		if run > 0 && t.Equal(prev.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		prev = t
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// importProgress merges doc into user's data.
+func (a *App) importProgress(user string, doc progressExport) (progressImportReport, error) {
+	var report progressImportReport
+	now := timeNow().UTC()
+
+	if doc.LearningActivity != nil {
+		if _, err := a.updateLearnerActivity(user, func(l *learnerActivity) {
+			l.mergeActivity(*doc.LearningActivity, &report)
+		}); err != nil {
+			return report, err
+		}
+	}
+
+	if len(doc.StepProgress) > 0 {
+		for i := range doc.StepProgress {
+			if doc.StepProgress[i].UpdatedAt.After(now) {
+				doc.StepProgress[i].UpdatedAt = now
+			}
+		}
+		a.progressMu.Lock()
+		var p userProgress
+		_, err := a.store.get(progressCollection, user, &p)
+		if err == nil {
+			if report.Steps = p.merge(doc.StepProgress); report.Steps > 0 {
+				err = a.store.put(progressCollection, user, p)
+			}
+		}
+		a.progressMu.Unlock()
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if len(doc.Bookmarks) > 0 {
+		if err := a.updateBookmarks(user, func(bookmarks []guideBookmark) ([]guideBookmark, error) {
+			have := map[string]bool{}
+			for _, b := range bookmarks {
+				have[b.GuideID] = true
+			}
+			for _, b := range doc.Bookmarks {
+				if have[b.GuideID] || len(bookmarks) >= maxBookmarksPerUser {
+					continue
+				}
+				have[b.GuideID] = true
+				bookmarks = append(bookmarks, b)
+				report.Bookmarks++
+			}
+			return bookmarks, nil
+		}); err != nil {
+			return report, err
+		}
+	}
+
+	if len(doc.History) > 0 {
+		a.historyMu.Lock()
+		var h guideHistory
+		_, err := a.store.get(historyCollection, user, &h)
+		if err == nil {
+			report.History = h.mergeHistory(doc.History)
+			if report.History > 0 {
+				err = a.store.put(historyCollection, user, h)
+			}
+		}
+		a.historyMu.Unlock()
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if in := doc.Preferences; in != nil && in.UpdatedAt != nil {
+		var local UserPreferences
+		ok, err := a.store.get(preferencesCollection, user, &local)
+		if err != nil {
+			return report, err
+		}
+		if !ok || local.UpdatedAt == nil || in.UpdatedAt.After(*local.UpdatedAt) {
+			if err := a.store.put(preferencesCollection, user, in); err != nil {
+				return report, err
+			}
+			report.Preferences = true
+		}
+	}
+	return report, nil
+}
+
+// mergeHistory merges imported entries into h, keeping the later view of
+// each guide and the newest maxHistoryEntries. It returns how many entries
+// were added or replaced.
+func (h *guideHistory) mergeHistory(in []guideHistoryEntry) int {
+	byGuide := map[string]int{}
+	for i, e := range h.Entries {
+		byGuide[e.GuideID] = i
+	}
+	changed := 0
+	for _, e := range in {
+		i, ok := byGuide[e.GuideID]
+		if ok && !e.LastViewedAt.After(h.Entries[i].LastViewedAt) {
+			continue
+		}
+		if ok {
+			if local := h.Entries[i].FirstViewedAt; !local.IsZero() && (e.FirstViewedAt.IsZero() || local.Before(e.FirstViewedAt)) {
+				e.FirstViewedAt = local
+			}
+			h.Entries[i] = e
+		} else {
+			byGuide[e.GuideID] = len(h.Entries)
+			h.Entries = append(h.Entries, e)
+		}
+		changed++
+	}
+	sort.SliceStable(h.Entries, func(i, j int) bool { return h.Entries[i].LastViewedAt.After(h.Entries[j].LastViewedAt) })
+	if len(h.Entries) > maxHistoryEntries {
+		h.Entries = h.Entries[:maxHistoryEntries]
+	}
+	return changed
+}
+
+// handleProgressExport handles GET /progress/export.
+func (a *App) handleProgressExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "pathfinder-progress.json"}))
+	a.writeJSON(w, a.exportProgress(user), http.StatusOK)
+}
+
+// handleProgressImport handles POST /progress/import.
+func (a *App) handleProgressImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxProgressImportBytes)
+	var doc progressExport
+	if !a.decodeRequest(w, r, &doc) {
+		return
+	}
+	if msg := doc.check(); msg != "" {
+		a.writeError(w, "Invalid request body: "+msg, http.StatusBadRequest)
+		return
+	}
+	report, err := a.importProgress(user, doc)
+	if err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to import progress", "user", user, "error", err)
+		a.writeError(w, "Failed to import progress", http.StatusInternalServerError)
+		return
+	}
+	a.ctxLogger(r.Context()).Info("Imported progress", "user", user, "from", doc.User, "guides", report.Guides, "steps", report.Steps)
+	a.writeJSON(w, report, http.StatusOK)
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLongestStreak(t *testing.T) {
+	for _, tc := range []struct {
+		days []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"2026-03-01"}, 1},
+		{[]string{"2026-02-27", "2026-02-28", "2026-03-01", "2026-03-03"}, 3},
+		{[]string{"2026-03-01", "2026-03-03", "2026-03-04"}, 2},
+	} {
+		if got := longestStreak(tc.days); got != tc.want {
+			t.Errorf("%v: %d, want %d", tc.days, got, tc.want)
+		}
+	}
+}
+
+func TestProgressExportImport(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	serve := func(app *App, h func(*App) http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(app)(w, roleRequest(method, target, body, "ana", "Viewer"))
+		return w
+	}
+	exportHandler := func(a *App) http.HandlerFunc { return a.handleProgressExport }
+	importHandler := func(a *App) http.HandlerFunc { return a.handleProgressImport }
+
+	// The trial stack has a completed guide, a step, a bookmark, a history
+	// entry and preferences.
+	trial := newTestApp(t)
+	earlier := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := trial.updateLearnerActivity("ana", func(l *learnerActivity) {
+		l.recordCompletion("alerting-101", "alerting", earlier)
+		l.recordCompletion("loki-101", "logs", earlier.AddDate(0, 0, 1))
+		l.Badges = map[string]time.Time{"first-steps": earlier}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	trial.handleProgressSync(httptest.NewRecorder(), roleRequest(http.MethodPost, "/progress/sync", `{"steps": [{"contentKey": "alerting-101", "sectionId": "s1", "stepId": "a", "completed": true, "updatedAt": "2026-03-01T09:00:00Z"}]}`, "ana", "Viewer"))
+	serve(trial, func(a *App) http.HandlerFunc { return a.handleBookmarks }, http.MethodPost, "/bookmarks", `{"guideId": "tempo-101"}`)
+	serve(trial, func(a *App) http.HandlerFunc { return a.handleHistory }, http.MethodPost, "/history", `{"guideId": "loki-101", "title": "Loki"}`)
+	serve(trial, func(a *App) http.HandlerFunc { return a.handlePreferences }, http.MethodPut, "/preferences", `{"terminalFontSize": 16}`)
+
+	w := serve(trial, exportHandler, http.MethodGet, "/progress/export", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("export: status=%d headers=%v", w.Code, w.Header())
+	}
+	exported := w.Body.String()
+	var doc progressExport
+	if err := json.Unmarshal([]byte(exported), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 1 || len(doc.LearningActivity.Guides) != 2 || len(doc.StepProgress) != 1 || len(doc.Bookmarks) != 1 || len(doc.History) != 1 || doc.Preferences == nil {
+		t.Fatalf("export = %s", exported)
+	}
+
+	// Production already has one of the guides, completed later, on a day
+	// that extends the trial's streak.
+	prod := newTestApp(t)
+	if _, err := prod.updateLearnerActivity("ana", func(l *learnerActivity) {
+		l.recordCompletion("alerting-101", "", earlier.AddDate(0, 0, 2))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var report progressImportReport
+	w = serve(prod, importHandler, http.MethodPost, "/progress/import", exported)
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("import: status=%d body=%s", w.Code, w.Body.String())
+	}
+	want := progressImportReport{Guides: 1, Days: 2, Badges: 1, Steps: 1, Bookmarks: 1, History: 1, Preferences: true}
+	if report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+	activity := prod.loadLearnerActivity("ana")
+	if g := activity.Guides["alerting-101"]; g.Category != "alerting" || !g.FirstCompletedAt.Equal(earlier) || !g.LastCompletedAt.Equal(earlier.AddDate(0, 0, 2)) {
+		t.Errorf("merged guide = %+v", g)
+	}
+	if len(activity.Days) != 3 || activity.LongestStreak != 3 {
+		t.Errorf("days = %v, longest = %d", activity.Days, activity.LongestStreak)
+	}
+
+	// Importing again changes nothing.
+	w = serve(prod, importHandler, http.MethodPost, "/progress/import", exported)
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || report != (progressImportReport{}) {
+		t.Errorf("second import: %s", w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"version": 2}`,
+		`{}`,
+		`{"version": 1, "learningActivity": {"guides": {"bad guide": {}}}}`,
+		`{"version": 1, "learningActivity": {"days": ["March 1"]}}`,
+		`{"version": 1, "stepProgress": [{"contentKey": "x"}]}`,
+		`{"version": 1, "bookmarks": [{"guideId": ""}]}`,
+		`{"version": 1, "history": [{"guideId": "x", "stepIndex": -1}]}`,
+		`{"version": 1, "preferences": {"terminalFontSize": 99}}`,
+	} {
+		if w := serve(prod, importHandler, http.MethodPost, "/progress/import", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Scheduled provisioning for workshops.
+//
+// An admin schedules Count VMs of a template for a time window. When StartAt
+// arrives the scheduler creates the VMs up front (owned by "schedule:{id}"
+// in Coda) so they have booted by the time learners connect; a learner who
+// then connects with that template and no app or scenario config is handed
+// one of them instead of waiting for a fresh VM. At EndAt every VM of the
+// schedule is destroyed. Schedules live in the plugin store, so with a
+// storagePath they survive restarts; the scheduler runs on every instance
+// and checks due schedules every scheduleCheckInterval.
+
+const (
+	scheduleCollection    = "provisioning-schedules"
+	scheduleCheckInterval = 30 * time.Second
+)
+
+const (
+	scheduleStateScheduled    = "scheduled"
+	scheduleStateProvisioning = "provisioning"
+	scheduleStateActive       = "active"
+	scheduleStateEnded        = "ended"
+)
+
+// provisioningSchedule is a stored workshop provisioning request.
+type provisioningSchedule struct {
+	ID        string    `json:"id"`
+	Template  string    `json:"template"`
+	Count     int       `json:"count"`
+	StartAt   time.Time `json:"startAt"`
+	EndAt     time.Time `json:"endAt"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	State     string    `json:"state"`
+	VMIDs     []string  `json:"vmIds,omitempty"`
+	// Claims maps a learner to the VM they were handed.
+	Claims map[string]string `json:"claims,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// CreateScheduleRequest is the body of POST /provisioning-schedules.
+type CreateScheduleRequest struct {
+	Template string    `json:"template" validate:"pattern=template"`
+	Count    int       `json:"count" validate:"required,min=1,max=100"`
+	StartAt  time.Time `json:"startAt" validate:"required"`
+	EndAt    time.Time `json:"endAt" validate:"required"`
+}
+
+func (a *App) listSchedules() []provisioningSchedule {
+	schedules := []provisioningSchedule{}
+	for _, key := range a.store.keys(scheduleCollection) {
+		var s provisioningSchedule
+		if ok, err := a.store.get(scheduleCollection, key, &s); err != nil || !ok {
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].StartAt.Before(schedules[j].StartAt) })
+	return schedules
+}
+
+// updateSchedule applies fn to the stored schedule id under schedulesMu.
+// Returns false when the schedule no longer exists.
+func (a *App) updateSchedule(id string, fn func(*provisioningSchedule)) (provisioningSchedule, bool) {
+	a.schedulesMu.Lock()
+	defer a.schedulesMu.Unlock()
+	var s provisioningSchedule
+	if ok, err := a.store.get(scheduleCollection, id, &s); err != nil || !ok {
+		return s, false
+	}
+	fn(&s)
+	if err := a.store.put(scheduleCollection, id, s); err != nil {
+		a.logger.Warn("Failed to update provisioning schedule", "schedule", id, "error", err)
+	}
+	return s, true
+}
+
+// startProvisioningScheduler runs due schedules every scheduleCheckInterval.
+func (a *App) startProvisioningScheduler() {
+	a.runEvery(scheduleCheckInterval, a.runDueSchedules)
+}
+
+// runDueSchedules provisions schedules whose window has started and tears
+// down those whose window has ended.
+func (a *App) runDueSchedules(ctx context.Context) {
+	if a.coda == nil {
+		return
+	}
+	now := timeNow()
+	for _, s := range a.listSchedules() {
+		switch {
+		case s.State != scheduleStateEnded && !now.Before(s.EndAt):
+			a.endSchedule(ctx, s.ID)
+		case s.State == scheduleStateScheduled && !now.Before(s.StartAt) && a.featureEnabled(featureVMProvisioning) && a.killSwitchError() == nil:
+			a.provisionSchedule(ctx, s.ID)
+		}
+	}
+}
+
+// provisionSchedule creates the schedule's VMs, stopping early when the org
+// quota is exhausted or Coda refuses.
+func (a *App) provisionSchedule(ctx context.Context, id string) {
+	s, ok := a.updateSchedule(id, func(s *provisioningSchedule) { s.State = scheduleStateProvisioning })
+	if !ok {
+		return
+	}
+	a.logger.Info("Provisioning scheduled VMs", "schedule", id, "template", s.Template, "count", s.Count)
+
+	var failure string
+	for i := len(s.VMIDs); i < s.Count && ctx.Err() == nil; i++ {
+		if err := a.checkOrgQuota(); err != nil {
+			failure = err.Error()
+			break
+		}
+		vm, err := a.coda.CreateVM(ctx, s.Template, "schedule:"+id)
+		if err != nil {
+			failure = fmt.Sprintf("Failed to create VM %d of %d: %v", i+1, s.Count, err)
+			break
+		}
+		a.recordVMProvisioned(a.logger)
+		if _, ok := a.updateSchedule(id, func(s *provisioningSchedule) { s.VMIDs = append(s.VMIDs, vm.ID) }); !ok {
+			// Cancelled while provisioning.
+			_ = a.coda.DeleteVM(context.Background(), vm.ID, true)
+			return
+		}
+	}
+	if failure != "" {
+		a.logger.Warn("Scheduled provisioning stopped early", "schedule", id, "error", failure)
+	}
+	a.updateSchedule(id, func(s *provisioningSchedule) {
+		s.State = scheduleStateActive
+		s.Error = failure
+	})
+}
+
+// destroyScheduleVMs destroys the schedule's VMs and forgets learner claims.
+func (a *App) destroyScheduleVMs(ctx context.Context, s provisioningSchedule) {
+	for user, vmID := range s.Claims {
+		a.clearUserVM(user, vmID)
+	}
+	if a.coda == nil {
+		return
+	}
+	for _, vmID := range s.VMIDs {
+		if err := a.coda.DeleteVM(ctx, vmID, true); err != nil && !isVMNotFoundError(err) {
+			a.logger.Warn("Failed to destroy scheduled VM", "vmID", vmID, "error", err)
+		}
+	}
+}
+
+func (a *App) endSchedule(ctx context.Context, id string) {
+	s, ok := a.updateSchedule(id, func(s *provisioningSchedule) { s.State = scheduleStateEnded })
+	if !ok {
+		return
+	}
+	a.logger.Info("Ending provisioning schedule", "schedule", id, "vms", len(s.VMIDs), "claimed", len(s.Claims))
+	a.destroyScheduleVMs(ctx, s)
+}
+
+// claimScheduledVM hands user a VM from an active schedule for template, or
+// returns the one they already claimed. Returns nil when none is available.
+func (a *App) claimScheduledVM(ctx context.Context, user, template string, ctxLogger log.Logger) *VM {
+	var vmID, scheduleID string
+	a.schedulesMu.Lock()
+	for _, key := range a.store.keys(scheduleCollection) {
+		var s provisioningSchedule
+		if ok, err := a.store.get(scheduleCollection, key, &s); err != nil || !ok {
+			continue
+		}
+		if s.State != scheduleStateActive || s.Template != template {
+			continue
+		}
+		if claimed := s.Claims[user]; claimed != "" {
+			vmID, scheduleID = claimed, s.ID
+			break
+		}
+		taken := make(map[string]bool, len(s.Claims))
+		for _, id := range s.Claims {
+			taken[id] = true
+		}
+		for _, id := range s.VMIDs {
+			if taken[id] {
+				continue
+			}
+			if s.Claims == nil {
+				s.Claims = map[string]string{}
+			}
+			s.Claims[user] = id
+			if err := a.store.put(scheduleCollection, s.ID, s); err != nil {
+				ctxLogger.Warn("Failed to record scheduled VM claim", "schedule", s.ID, "error", err)
+			}
+			vmID, scheduleID = id, s.ID
+			break
+		}
+		if vmID != "" {
+			break
+		}
+	}
+	a.schedulesMu.Unlock()
+	if vmID == "" {
+		return nil
+	}
+
+	vm, err := a.coda.GetVM(ctx, vmID)
+	if err != nil || !isUsableState(vm.State) {
+		ctxLogger.Warn("Scheduled VM is not usable", "schedule", scheduleID, "vmID", vmID, "error", err)
+		return nil
+	}
+	ctxLogger.Info("Assigned scheduled VM", "schedule", scheduleID, "userLogin", user, "vmID", vmID)
+	return vm
+}
+
+// handleProvisioningSchedules handles GET and POST /provisioning-schedules
+// (admin only).
+func (a *App) handleProvisioningSchedules(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can schedule provisioning", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"schedules": a.listSchedules()}, http.StatusOK)
+	case http.MethodPost:
+		a.handleCreateSchedule(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleCreateSchedule(w http.ResponseWriter, r *http.Request, user string) {
+	if a.coda == nil {
+		a.writeError(w, "Coda not registered - configure enrollment key and register first", http.StatusServiceUnavailable)
+		return
+	}
+	var req CreateScheduleRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Template == "" {
+		req.Template = "vm-aws"
+	}
+	if !req.StartAt.After(timeNow()) {
+		a.writeError(w, "startAt must be in the future", http.StatusBadRequest)
+		return
+	}
+	if !req.EndAt.After(req.StartAt) {
+		a.writeError(w, "endAt must be after startAt", http.StatusBadRequest)
+		return
+	}
+
+	s := provisioningSchedule{
+		ID:        strings.ToLower(rand.Text()),
+		Template:  req.Template,
+		Count:     req.Count,
+		StartAt:   req.StartAt.UTC(),
+		EndAt:     req.EndAt.UTC(),
+		CreatedBy: user,
+		CreatedAt: timeNow().UTC(),
+		State:     scheduleStateScheduled,
+	}
+	a.schedulesMu.Lock()
+	err := a.store.put(scheduleCollection, s.ID, s)
+	a.schedulesMu.Unlock()
+	if err != nil {
+		a.writeError(w, "Failed to save schedule", http.StatusInternalServerError)
+		return
+	}
+	a.ctxLogger(r.Context()).Info("Scheduled provisioning", "schedule", s.ID, "template", s.Template, "count", s.Count, "startAt", s.StartAt, "endAt", s.EndAt, "by", user)
+	a.writeJSON(w, s, http.StatusCreated)
+}
+
+// handleProvisioningScheduleByID handles GET/DELETE
+// /provisioning-schedules/{id} (admin only). DELETE cancels the schedule and
+// destroys any VMs it already created.
+func (a *App) handleProvisioningScheduleByID(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage provisioning schedules", http.StatusForbidden)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/provisioning-schedules/")
+	var s provisioningSchedule
+	if ok, err := a.store.get(scheduleCollection, id, &s); err != nil || !ok {
+		a.writeError(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, s, http.StatusOK)
+	case http.MethodDelete:
+		a.schedulesMu.Lock()
+		_, _ = a.store.get(scheduleCollection, id, &s)
+		err := a.store.delete(scheduleCollection, id)
+		a.schedulesMu.Unlock()
+		if err != nil {
+			a.writeError(w, "Failed to delete schedule", http.StatusInternalServerError)
+			return
+		}
+		a.destroyScheduleVMs(r.Context(), s)
+		a.ctxLogger(r.Context()).Info("Cancelled provisioning schedule", "schedule", id, "vms", len(s.VMIDs), "by", user)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
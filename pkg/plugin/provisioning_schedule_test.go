@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestHandleCreateSchedule_Validation(t *testing.T) {
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	app := newTestApp(t)
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	app.handleProvisioningSchedules(w, roleRequest(http.MethodPost, "/provisioning-schedules", `{"count":5,"startAt":"2026-06-01T09:00:00Z","endAt":"2026-06-01T12:00:00Z"}`, "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+
+	for _, body := range []string{
+		`{"count":0,"startAt":"2026-06-01T09:00:00Z","endAt":"2026-06-01T12:00:00Z"}`,
+		`{"count":101,"startAt":"2026-06-01T09:00:00Z","endAt":"2026-06-01T12:00:00Z"}`,
+		`{"count":5,"startAt":"2026-06-01T07:00:00Z","endAt":"2026-06-01T12:00:00Z"}`,
+		`{"count":5,"startAt":"2026-06-01T09:00:00Z","endAt":"2026-06-01T09:00:00Z"}`,
+	} {
+		w = httptest.NewRecorder()
+		app.handleProvisioningSchedules(w, roleRequest(http.MethodPost, "/provisioning-schedules", body, "admin", "Admin"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", body, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.handleProvisioningSchedules(w, roleRequest(http.MethodPost, "/provisioning-schedules", `{"count":5,"startAt":"2026-06-01T09:00:00Z","endAt":"2026-06-01T12:00:00Z"}`, "admin", "Admin"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var s provisioningSchedule
+	_ = json.Unmarshal(w.Body.Bytes(), &s)
+	if s.Template != "vm-aws" || s.State != scheduleStateScheduled || s.CreatedBy != "admin" {
+		t.Errorf("schedule = %+v", s)
+	}
+}
+
+func TestProvisioningSchedule_Lifecycle(t *testing.T) {
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	var mu sync.Mutex
+	created, deleted := 0, map[string]bool{}
+	app := newTestApp(t)
+	app.userVMs = map[string]string{}
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/vms":
+			var req CreateVMRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			created++
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(VM{ID: fmt.Sprintf("vm-%d", created), Template: req.Template, Owner: req.Owner, State: "pending"})
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(VM{ID: strings.TrimPrefix(r.URL.Path, "/api/v1/vms/"), Template: "vm-aws", State: "active"})
+		case r.Method == http.MethodDelete:
+			deleted[strings.TrimPrefix(r.URL.Path, "/api/v1/vms/")] = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	app.handleProvisioningSchedules(w, roleRequest(http.MethodPost, "/provisioning-schedules", `{"count":2,"startAt":"2026-06-01T09:00:00Z","endAt":"2026-06-01T12:00:00Z"}`, "admin", "Admin"))
+	var s provisioningSchedule
+	_ = json.Unmarshal(w.Body.Bytes(), &s)
+
+	app.runDueSchedules(context.Background())
+	if created != 0 {
+		t.Fatalf("provisioned before startAt: %d", created)
+	}
+
+	now = now.Add(time.Hour)
+	app.runDueSchedules(context.Background())
+	if created != 2 {
+		t.Fatalf("created = %d, want 2", created)
+	}
+
+	ctx := context.Background()
+	alice := app.claimScheduledVM(ctx, "alice", "vm-aws", log.DefaultLogger)
+	bob := app.claimScheduledVM(ctx, "bob", "vm-aws", log.DefaultLogger)
+	if alice == nil || bob == nil || alice.ID == bob.ID {
+		t.Fatalf("claims: alice = %+v, bob = %+v", alice, bob)
+	}
+	if again := app.claimScheduledVM(ctx, "alice", "vm-aws", log.DefaultLogger); again == nil || again.ID != alice.ID {
+		t.Errorf("alice's second claim = %+v, want %s", again, alice.ID)
+	}
+	if carol := app.claimScheduledVM(ctx, "carol", "vm-aws", log.DefaultLogger); carol != nil {
+		t.Errorf("carol got %s from an exhausted schedule", carol.ID)
+	}
+	if other := app.claimScheduledVM(ctx, "dave", "vm-gcp", log.DefaultLogger); other != nil {
+		t.Errorf("template mismatch claimed %s", other.ID)
+	}
+
+	app.userVMs["alice"] = alice.ID
+	now = now.Add(3 * time.Hour)
+	app.runDueSchedules(context.Background())
+	if !deleted["vm-1"] || !deleted["vm-2"] {
+		t.Errorf("deleted = %v", deleted)
+	}
+	if _, ok := app.userVMs["alice"]; ok {
+		t.Error("alice still mapped to an ended workshop VM")
+	}
+	w = httptest.NewRecorder()
+	app.handleProvisioningScheduleByID(w, roleRequest(http.MethodGet, "/provisioning-schedules/"+s.ID, "", "admin", "Admin"))
+	_ = json.Unmarshal(w.Body.Bytes(), &s)
+	if s.State != scheduleStateEnded {
+		t.Errorf("state = %s", s.State)
+	}
+}
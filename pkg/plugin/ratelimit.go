@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Per-user rate limits for resource routes.
+//
+// Every request from a signed-in user takes a token from that user's bucket
+// for the request's class, so a frontend stuck in a loop or an abusive user
+// can't hammer Coda through the plugin. Operations that create VMs share the
+// tightest bucket, other writes a looser one, and reads the loosest. A
+// request over the limit gets 429 with Retry-After. /coda/exec also keeps
+// its own limit (see coda_exec_ratelimit.go).
+
+type rateClass string
+
+const (
+	rateClassRead     rateClass = "read"
+	rateClassWrite    rateClass = "write"
+	rateClassCreateVM rateClass = "createVM"
+)
+
+// routeRateLimits are the bucket sizes (burst, refill per second) per class.
+var routeRateLimits = map[rateClass][2]float64{
+	rateClassRead:     {60, 10},
+	rateClassWrite:    {20, 2},
+	rateClassCreateVM: {3, 1.0 / 20},
+}
+
+func newRouteRateLimiters() map[rateClass]*rateLimiter {
+	limiters := make(map[rateClass]*rateLimiter, len(routeRateLimits))
+	for class, limit := range routeRateLimits {
+		limiters[class] = newRateLimiter(limit[0], limit[1])
+	}
+	return limiters
+}
+
+// rateClassOf returns the class of a request served by route.
+func rateClassOf(route apiRoute, r *http.Request) rateClass {
+	if op, ok := route.operation(r.Method, r.URL.Path); ok && op.createsVM {
+		return rateClassCreateVM
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return rateClassRead
+	}
+	return rateClassWrite
+}
+
+// rateLimit applies the per-user limit for the request's class. Requests
+// without a user (webhooks, health checks) are not limited here.
+func (a *App) rateLimit(route apiRoute, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userLoginFromContext(r.Context())
+		class := rateClassOf(route, r)
+		limiter := a.routeRateLimiters[class]
+		if user == "" || limiter == nil {
+			h(w, r)
+			return
+		}
+		if ok, retryAfter := limiter.allow(user); !ok {
+			a.ctxLogger(r.Context()).Info("Rate limited resource request", "user", user, "path", r.URL.Path, "class", class)
+			a.writeRateLimited(w, retryAfter, "Too many requests, try again later")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// writeRateLimited answers 429 with Retry-After rounded up to whole seconds
+// (RFC 7231 §7.1.3).
+func (a *App) writeRateLimited(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	secs := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	a.writeError(w, msg, http.StatusTooManyRequests)
+}
+
+// operation returns the route's operation matching method and path, where
+// {param} segments of the operation path match any single segment.
+func (r apiRoute) operation(method, path string) (apiOperation, bool) {
+	segments := strings.Split(path, "/")
+	for _, op := range r.ops {
+		if op.method == method && matchOperationPath(strings.Split(op.path, "/"), segments) {
+			return op, true
+		}
+	}
+	return apiOperation{}, false
+}
+
+func matchOperationPath(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != segments[i] && !(strings.HasPrefix(p, "{") && segments[i] != "") {
+			return false
+		}
+	}
+	return true
+}
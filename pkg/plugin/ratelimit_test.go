@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateClassOf(t *testing.T) {
+	app := newTestApp(t)
+	routes := map[string]apiRoute{}
+	for _, route := range app.apiRoutes() {
+		routes[route.pattern] = route
+	}
+	cases := []struct {
+		pattern, method, path string
+		want                  rateClass
+	}{
+		{"/vms", http.MethodPost, "/vms", rateClassCreateVM},
+		{"/vms", http.MethodGet, "/vms", rateClassRead},
+		{"/vms/", http.MethodPost, "/vms/vm-1/start", rateClassWrite},
+		{"/vms/", http.MethodGet, "/vms/vm-1", rateClassRead},
+		{"/admin/workshops", http.MethodPost, "/admin/workshops", rateClassCreateVM},
+		{"/workspaces/", http.MethodDelete, "/workspaces/demo", rateClassWrite},
+	}
+	for _, c := range cases {
+		if got := rateClassOf(routes[c.pattern], httptest.NewRequest(c.method, c.path, nil)); got != c.want {
+			t.Errorf("%s %s = %s, want %s", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApp(t)
+	app.routeRateLimiters = newRouteRateLimiters()
+	frozen := time.Now()
+	for _, l := range app.routeRateLimiters {
+		l.now = func() time.Time { return frozen }
+	}
+	route := apiRoute{pattern: "/vms", ops: []apiOperation{
+		{method: http.MethodGet, path: "/vms"},
+		{method: http.MethodPost, path: "/vms", createsVM: true},
+	}}
+	h := app.rateLimit(route, func(w http.ResponseWriter, r *http.Request) {})
+	do := func(method, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(w, withUser(httptest.NewRequest(method, "/vms", nil), user))
+		return w
+	}
+
+	burst := int(routeRateLimits[rateClassCreateVM][0])
+	for i := 0; i < burst; i++ {
+		if w := do(http.MethodPost, "alice"); w.Code != http.StatusOK {
+			t.Fatalf("create %d: status %d", i+1, w.Code)
+		}
+	}
+	w := do(http.MethodPost, "alice")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "20" {
+		t.Errorf("over limit: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := do(http.MethodGet, "alice"); w.Code != http.StatusOK {
+		t.Errorf("read after create limit: status %d", w.Code)
+	}
+	if w := do(http.MethodPost, "bob"); w.Code != http.StatusOK {
+		t.Errorf("other user: status %d", w.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Recommendation feedback.
+//
+// The context panel sends POST /recommend/feedback when a learner rates a
+// recommendation: thumbs up, thumbs down or not relevant. The latest signal
+// per learner and recommendation is kept (newest maxFeedbackPerUser per
+// learner) so the panel can show it again, and with
+// forwardRecommendationFeedback on, each signal is also posted to the
+// recommender's /api/v1/feedback with the learner as a hash of their login.
+// The route is off with analytics off (see features.go).
+
+const (
+	recommendationFeedbackCollection = "recommendation-feedback"
+	maxFeedbackPerUser               = 500
+	feedbackForwardTimeout           = 10 * time.Second
+	maxFeedbackForwards              = 16
+)
+
+var feedbackForwardClient = &http.Client{Timeout: feedbackForwardTimeout}
+
+// recommendationFeedback is a learner's signal on one recommendation,
+// keyed user/hash of the URL.
+type recommendationFeedback struct {
+	User   string    `json:"user"`
+	URL    string    `json:"url"`
+	Type   string    `json:"type,omitempty"`
+	Signal string    `json:"signal"`
+	Path   string    `json:"path,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// RecommendationFeedbackRequest is the JSON body for POST
+// /recommend/feedback: the recommendation's url (its content URL for a
+// package), its type, the signal and the Grafana page it was shown on.
+type RecommendationFeedbackRequest struct {
+	URL    string `json:"url" validate:"required,max=2048"`
+	Type   string `json:"type,omitempty" validate:"max=40"`
+	Signal string `json:"signal" validate:"required,oneof=up down not-relevant"`
+	Path   string `json:"path,omitempty" validate:"max=512"`
+}
+
+type recommenderFeedback struct {
+	URL     string    `json:"url"`
+	Type    string    `json:"type,omitempty"`
+	Signal  string    `json:"signal"`
+	Path    string    `json:"path,omitempty"`
+	Learner string    `json:"learner"`
+	At      time.Time `json:"at"`
+}
+
+func feedbackKey(user, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return user + "/" + hex.EncodeToString(sum[:12])
+}
+
+// userRecommendationFeedback returns user's feedback, newest first.
+func (a *App) userRecommendationFeedback(user string) []recommendationFeedback {
+	out := []recommendationFeedback{}
+	for _, key := range a.store.keys(recommendationFeedbackCollection) {
+		if !strings.HasPrefix(key, user+"/") {
+			continue
+		}
+		var f recommendationFeedback
+		if ok, err := a.store.get(recommendationFeedbackCollection, key, &f); err == nil && ok {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.After(out[j].At) })
+	return out
+}
+
+// feedbackForwardEndpoint is the recommender's feedback URL, or "" with
+// forwarding off.
+func (a *App) feedbackForwardEndpoint() string {
+	if a.settings == nil || !a.settings.ForwardRecommendationFeedback || a.recommenderServiceURL() == "" {
+		return ""
+	}
+	return a.recommenderServiceURL() + "/api/v1/feedback"
+}
+
+// queueFeedbackForward posts f to endpoint in the background. Feedback is
+// dropped while maxFeedbackForwards are in flight.
+func (a *App) queueFeedbackForward(logger log.Logger, endpoint string, f recommendationFeedback) {
+	if a.feedbackForwards.Add(1) > maxFeedbackForwards {
+		a.feedbackForwards.Add(-1)
+		logger.Warn("Dropped recommendation feedback: too many forwards in flight")
+		return
+	}
+	started := a.goBackground(func(ctx context.Context) {
+		defer a.feedbackForwards.Add(-1)
+		if err := forwardRecommendationFeedback(ctx, endpoint, f); err != nil {
+			logger.Warn("Failed to forward recommendation feedback", "error", err)
+		}
+	})
+	if !started {
+		a.feedbackForwards.Add(-1)
+	}
+}
+
+// forwardRecommendationFeedback posts f to the recommender's endpoint.
+func forwardRecommendationFeedback(ctx context.Context, endpoint string, f recommendationFeedback) error {
+	raw, err := json.Marshal(recommenderFeedback{URL: f.URL, Type: f.Type, Signal: f.Signal, Path: f.Path, Learner: learnerHash(f.User), At: f.At})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := feedbackForwardClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("recommender returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// handleRecommendationFeedback handles GET (the caller's feedback) and POST
+// (rate a recommendation) on /recommend/feedback.
+func (a *App) handleRecommendationFeedback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"feedback": a.userRecommendationFeedback(user)}, http.StatusOK)
+	case http.MethodPost:
+		var req RecommendationFeedbackRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		f := recommendationFeedback{User: user, URL: req.URL, Type: req.Type, Signal: req.Signal, Path: req.Path, At: timeNow().UTC()}
+		if err := a.store.put(recommendationFeedbackCollection, feedbackKey(user, req.URL), f); err != nil {
+			a.ctxLogger(ctx).Error("Failed to store recommendation feedback", "user", user, "error", err)
+			a.writeError(w, "Failed to store the feedback", http.StatusInternalServerError)
+			return
+		}
+		if all := a.userRecommendationFeedback(user); len(all) > maxFeedbackPerUser {
+			for _, old := range all[maxFeedbackPerUser:] {
+				_ = a.store.delete(recommendationFeedbackCollection, feedbackKey(user, old.URL))
+			}
+		}
+		if endpoint := a.feedbackForwardEndpoint(); endpoint != "" {
+			a.queueFeedbackForward(a.ctxLogger(ctx), endpoint, f)
+		}
+		a.writeJSON(w, f, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecommendationFeedback(t *testing.T) {
+	forwarded := make(chan recommenderFeedback, 2)
+	recommender := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var f recommenderFeedback
+		if r.URL.Path == "/api/v1/feedback" && json.NewDecoder(r.Body).Decode(&f) == nil {
+			forwarded <- f
+		}
+	}))
+	defer recommender.Close()
+
+	app := newTestApp(t)
+	app.settings = &Settings{RecommenderServiceURL: recommender.URL + "/"}
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleRecommendationFeedback(w, roleRequest(method, "/recommend/feedback", body, "ann", "Viewer"))
+		return w
+	}
+
+	if w := serve(http.MethodPost, `{"url": "https://grafana.com/docs/loki/", "signal": "meh"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bad signal: status %d, want 400", w.Code)
+	}
+	if w := serve(http.MethodPost, `{"url": "https://grafana.com/docs/loki/", "type": "docs-page", "signal": "up", "path": "/explore"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST: status %d: %s", w.Code, w.Body)
+	}
+	waitBackground(app)
+	app.settings.ForwardRecommendationFeedback = true
+	if w := serve(http.MethodPost, `{"url": "https://grafana.com/docs/loki/", "type": "docs-page", "signal": "not-relevant", "path": "/explore"}`); w.Code != http.StatusOK {
+		t.Fatalf("second POST: status %d: %s", w.Code, w.Body)
+	}
+	waitBackground(app)
+	if len(forwarded) != 1 {
+		t.Fatalf("forwarded %d signals, want only the one sent with forwarding on", len(forwarded))
+	}
+	if f := <-forwarded; f.Signal != "not-relevant" || f.Learner != learnerHash("ann") || f.Path != "/explore" {
+		t.Errorf("forwarded %+v", f)
+	}
+
+	var resp struct {
+		Feedback []recommendationFeedback `json:"feedback"`
+	}
+	if err := json.Unmarshal(serve(http.MethodGet, "").Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Feedback) != 1 || resp.Feedback[0].Signal != "not-relevant" {
+		t.Errorf("feedback = %+v", resp.Feedback)
+	}
+}
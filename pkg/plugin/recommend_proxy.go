@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/config"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/featuretoggles"
+)
+
+// Recommendation proxy.
+//
+// POST /recommend forwards the context panel's recommendation request to
+// {recommenderServiceUrl}/api/v1/recommend after adding what the instance
+// runs, gathered with the plugin's service account: the installed data
+// source types (also merged into the request's datasources), the tags of
+// the newest dashboards and the enabled Grafana feature toggles. Dashboard
+// titles and data source names stay on the instance. The instance context
+// is cached for instanceContextTTL, and a part that can't be gathered is
+// left out rather than failing the request.
+
+const (
+	recommendTimeout          = 10 * time.Second
+	maxRecommendRequestBytes  = 64 << 10
+	maxRecommendResponseBytes = 4 << 20
+	instanceContextTTL        = 5 * time.Minute
+	recentDashboardCount      = 20
+	maxInstanceDashboardTags  = 50
+)
+
+// recommendInstanceContext is what POST /recommend adds to the request as
+// "instance".
+type recommendInstanceContext struct {
+	DatasourceTypes []string `json:"datasourceTypes"`
+	DashboardCount  int      `json:"dashboardCount"`
+	DashboardTags   []string `json:"recentDashboardTags"`
+	Features        []string `json:"features"`
+}
+
+// gatherInstanceContext reads the instance context from the Grafana API
+// and config, or returns the cached one.
+func (a *App) gatherInstanceContext(ctx context.Context) recommendInstanceContext {
+	a.instanceContextMu.Lock()
+	defer a.instanceContextMu.Unlock()
+	if a.instanceContext != nil && timeNow().Sub(a.instanceContextAt) < instanceContextTTL {
+		return *a.instanceContext
+	}
+	logger := a.ctxLogger(ctx)
+	ic := recommendInstanceContext{DatasourceTypes: []string{}, DashboardTags: []string{}, Features: []string{}}
+	if cfg := config.GrafanaConfigFromContext(ctx); cfg != nil {
+		for _, f := range strings.Split(cfg.Get(featuretoggles.EnabledFeatures), ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				ic.Features = append(ic.Features, f)
+			}
+		}
+		sort.Strings(ic.Features)
+	}
+	api, err := resolveGrafanaAPI(ctx)
+	if err != nil {
+		logger.Debug("Recommending without instance data sources and dashboards", "error", err)
+	} else {
+		if list, err := api.ListDatasources(ctx); err != nil {
+			logger.Warn("Failed to list data sources for recommendations", "error", err)
+		} else {
+			for _, ds := range list {
+				if t := strings.ToLower(ds.Type); t != "" && !slices.Contains(ic.DatasourceTypes, t) {
+					ic.DatasourceTypes = append(ic.DatasourceTypes, t)
+				}
+			}
+			sort.Strings(ic.DatasourceTypes)
+		}
+		if list, err := api.SearchDashboards(ctx); err != nil {
+			logger.Warn("Failed to search dashboards for recommendations", "error", err)
+		} else {
+			ic.DashboardCount = len(list)
+			sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+			for _, d := range list[:min(len(list), recentDashboardCount)] {
+				for _, tag := range d.Tags {
+					if len(ic.DashboardTags) < maxInstanceDashboardTags && !slices.Contains(ic.DashboardTags, tag) {
+						ic.DashboardTags = append(ic.DashboardTags, tag)
+					}
+				}
+			}
+		}
+	}
+	a.instanceContext, a.instanceContextAt = &ic, timeNow()
+	return ic
+}
+
+// handleRecommend handles POST /recommend: the context panel's recommender
+// request, enriched with the instance context and proxied.
+func (a *App) handleRecommend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if userLoginFromContext(ctx) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if a.recommenderServiceURL() == "" {
+		a.writeError(w, "The recommender is not configured", http.StatusConflict)
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecommendRequestBytes)).Decode(&payload); err != nil || payload == nil {
+		a.writeError(w, "Request body must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	ic := a.gatherInstanceContext(ctx)
+	payload["instance"] = ic
+	datasources := []string{}
+	if list, ok := payload["datasources"].([]interface{}); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok && !slices.Contains(datasources, s) {
+				datasources = append(datasources, s)
+			}
+		}
+	}
+	for _, t := range ic.DatasourceTypes {
+		if !slices.Contains(datasources, t) {
+			datasources = append(datasources, t)
+		}
+	}
+	payload["datasources"] = datasources
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		a.writeError(w, "Failed to build the recommender request", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, recommendTimeout)
+	defer cancel()
+	endpoint := a.recommenderServiceURL() + "/api/v1/recommend"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		a.writeError(w, "Failed to build the recommender request", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		a.ctxLogger(ctx).Warn("Recommender request failed", "error", err)
+		a.writeError(w, "The recommender is unavailable", http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRecommendResponseBytes))
+	if err != nil {
+		a.writeError(w, "The recommender is unavailable", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	sdkconfig "github.com/grafana/grafana-plugin-sdk-go/config"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/featuretoggles"
+)
+
+func TestHandleRecommend(t *testing.T) {
+	var got map[string]json.RawMessage
+	recommender := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/recommend" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"recommendations": [{"type": "docs-page", "url": "https://grafana.com/docs/loki/"}]}`))
+	}))
+	defer recommender.Close()
+
+	fake := &fakeGrafanaAPI{
+		datasources: []grafanaDatasource{{UID: "a", Name: "Prod logs", Type: "loki"}, {UID: "b", Type: "prometheus"}, {UID: "c", Type: "Loki"}},
+		searched: []grafanaDashboardSummary{
+			{ID: 1, Title: "Old", Tags: []string{"legacy"}},
+			{ID: 40, Title: "Nodes", Tags: []string{"kubernetes", "infra"}},
+		},
+	}
+	useFakeGrafanaAPI(t, fake)
+	app := newTestApp(t)
+	recommend := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := roleRequest(http.MethodPost, "/recommend", body, "ann", "Viewer")
+		cfg := sdkconfig.NewGrafanaCfg(map[string]string{featuretoggles.EnabledFeatures: "kubernetesDashboards, alertingSimplifiedRouting"})
+		w := httptest.NewRecorder()
+		app.handleRecommend(w, r.WithContext(sdkconfig.WithGrafanaConfig(r.Context(), cfg)))
+		return w
+	}
+
+	if w := recommend(`{"path": "/explore"}`); w.Code != http.StatusConflict {
+		t.Errorf("unconfigured: status %d, want 409", w.Code)
+	}
+	app.settings = &Settings{RecommenderServiceURL: recommender.URL}
+	if w := recommend(`[1]`); w.Code != http.StatusBadRequest {
+		t.Errorf("array body: status %d, want 400", w.Code)
+	}
+	w := recommend(`{"path": "/explore", "datasources": ["tempo", "loki"]}`)
+	if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var datasources []string
+	var instance recommendInstanceContext
+	_ = json.Unmarshal(got["datasources"], &datasources)
+	_ = json.Unmarshal(got["instance"], &instance)
+	if string(got["path"]) != `"/explore"` || !slices.Equal(datasources, []string{"tempo", "loki", "prometheus"}) {
+		t.Errorf("forwarded path %s, datasources %v", got["path"], datasources)
+	}
+	if !slices.Equal(instance.DatasourceTypes, []string{"loki", "prometheus"}) || instance.DashboardCount != 2 ||
+		!slices.Equal(instance.DashboardTags, []string{"kubernetes", "infra", "legacy"}) ||
+		!slices.Equal(instance.Features, []string{"alertingSimplifiedRouting", "kubernetesDashboards"}) {
+		t.Errorf("instance = %+v", instance)
+	}
+
+	calls := fake.calls
+	recommend(`{"path": "/dashboards"}`)
+	if fake.calls != calls {
+		t.Errorf("instance context not cached: %d more API calls", fake.calls-calls)
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Panic recovery.
+//
+// A panic in a resource or stream handler would otherwise take the plugin
+// process, and every learner's terminal with it, down. Handlers are wrapped
+// so a panic is logged with its stack and the correlation ID, and the caller
+// gets a 500 or a stream error frame instead.
+
+const internalErrorMessage = "Internal error"
+
+// recoverPanics answers 500 when h panics. If h already started the response
+// the status can't change, so the response is only cut short.
+func (a *App) recoverPanics(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			a.logPanic(r.Context(), "Panic in resource handler", p, "method", r.Method, "path", r.URL.Path)
+			if rec.status == 0 {
+				a.writeError(rec, internalErrorMessage, http.StatusInternalServerError)
+			}
+		}()
+		h(rec, r)
+	}
+}
+
+// recoverStream turns a panic in a stream handler into err, and an error
+// frame when sender is set. It must be deferred directly.
+func (a *App) recoverStream(ctx context.Context, path string, sender *backend.StreamSender, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	a.logPanic(ctx, "Panic in stream handler", p, "path", path)
+	if sender != nil {
+		sendStreamError(ctx, sender, internalErrorMessage)
+	}
+	*err = fmt.Errorf("stream handler panicked: %v", p)
+}
+
+func (a *App) logPanic(ctx context.Context, msg string, p interface{}, args ...interface{}) {
+	args = append(args, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+	a.ctxLogger(ctx).Error(msg, args...)
+}
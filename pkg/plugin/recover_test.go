@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	app := newTestApp(t)
+	h := app.withCorrelation(app.recoverPanics(func(w http.ResponseWriter, r *http.Request) {
+		var vm *VM
+		_ = vm.ID
+	}))
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/vms", nil))
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInternalServerError || body["error"] != internalErrorMessage || body["correlationId"] != w.Header().Get(correlationIDHeader) {
+		t.Errorf("status = %d, body = %v", w.Code, body)
+	}
+}
+
+func TestRecoverStream(t *testing.T) {
+	app := newTestApp(t)
+	rec, sender := newStreamRecorder(t)
+	ctx := withCorrelationID(context.Background(), "abcdefgh")
+
+	run := func() (err error) {
+		defer app.recoverStream(ctx, "terminal/vm-1", sender, &err)
+		panic("boom")
+	}
+	if err := run(); err == nil {
+		t.Fatal("panic not returned as an error")
+	}
+	frames := rec.ofType("error")
+	if len(frames) != 1 || frames[0].CorrelationID != "abcdefgh" {
+		t.Errorf("error frames = %+v", frames)
+	}
+}
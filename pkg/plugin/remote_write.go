@@ -0,0 +1,219 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// VM metrics forwarding over Prometheus remote write.
+//
+// When Settings.PromRemoteWriteURL is set, every connected terminal session
+// periodically reads resource stats from its VM (see vm_stats.go) and pushes
+// them as node_exporter-named series, so an observability tutorial can show
+// the learner's own sandbox as a monitored host. Series are labelled
+// job="pathfinder-sandbox", instance={vmId}, user and, when known, guide.
+//
+// The remote-write WriteRequest is small and stable, so it is encoded by hand
+// with protowire rather than pulling in the Prometheus module.
+
+const (
+	vmMetricsJobLabel        = "pathfinder-sandbox"
+	defaultVMMetricsInterval = 15 * time.Second
+	vmMetricsCollectTimeout  = 10 * time.Second
+	remoteWriteTimeout       = 10 * time.Second
+)
+
+// promLabel is one series label.
+type promLabel struct {
+	Name, Value string
+}
+
+// promSeries is a single-sample time series.
+type promSeries struct {
+	Labels []promLabel
+	Value  float64
+	TimeMs int64
+}
+
+// remoteWriter pushes series to a Prometheus remote-write endpoint. A nil
+// writer means forwarding is disabled.
+type remoteWriter struct {
+	url      string
+	user     string
+	password string
+	interval time.Duration
+	client   *http.Client
+}
+
+// newRemoteWriter returns a writer for settings, or nil when forwarding is
+// not configured.
+func newRemoteWriter(settings *Settings) *remoteWriter {
+	if settings == nil || settings.PromRemoteWriteURL == "" {
+		return nil
+	}
+	interval := defaultVMMetricsInterval
+	if settings.VMMetricsIntervalSeconds > 0 {
+		interval = time.Duration(settings.VMMetricsIntervalSeconds) * time.Second
+	}
+	return &remoteWriter{
+		url:      settings.PromRemoteWriteURL,
+		user:     settings.PromRemoteWriteUser,
+		password: settings.PromRemoteWritePassword,
+		interval: interval,
+		client:   &http.Client{Timeout: remoteWriteTimeout},
+	}
+}
+
+// encodeWriteRequest encodes series as a prometheus.WriteRequest protobuf.
+// Labels are sorted by name, as remote-write receivers require.
+func encodeWriteRequest(series []promSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		labels := append([]promLabel(nil), s.Labels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+		var ts []byte
+		for _, l := range labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.TimeMs))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// push sends series in one snappy-compressed remote-write request.
+func (w *remoteWriter) push(ctx context.Context, series []promSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	ctx, cancel := context.WithTimeout(ctx, remoteWriteTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.user != "" || w.password != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("remote write returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// promSeries converts s to node_exporter-named series carrying base labels.
+func (s *vmStats) promSeries(base []promLabel, at time.Time) []promSeries {
+	ms := at.UnixMilli()
+	var out []promSeries
+	add := func(name string, value float64, extra ...promLabel) {
+		labels := make([]promLabel, 0, len(base)+len(extra)+1)
+		labels = append(labels, promLabel{"__name__", name})
+		labels = append(labels, base...)
+		labels = append(labels, extra...)
+		out = append(out, promSeries{Labels: labels, Value: value, TimeMs: ms})
+	}
+
+	add("node_load1", s.Load1)
+	add("node_load5", s.Load5)
+	add("node_load15", s.Load15)
+	add("node_memory_MemTotal_bytes", s.MemTotalBytes)
+	add("node_memory_MemAvailable_bytes", s.MemAvailableBytes)
+	add("node_filesystem_size_bytes", s.RootFSSizeBytes, promLabel{"mountpoint", "/"})
+	add("node_filesystem_avail_bytes", s.RootFSAvailBytes, promLabel{"mountpoint", "/"})
+
+	cpus := make([]string, 0, len(s.CPUSeconds))
+	for cpu := range s.CPUSeconds {
+		if cpu != "cpu" {
+			cpus = append(cpus, cpu)
+		}
+	}
+	sort.Strings(cpus)
+	for _, cpu := range cpus {
+		for _, mode := range cpuModes {
+			if v, ok := s.CPUSeconds[cpu][mode]; ok {
+				add("node_cpu_seconds_total", v, promLabel{"cpu", strings.TrimPrefix(cpu, "cpu")}, promLabel{"mode", mode})
+			}
+		}
+	}
+
+	devices := make([]string, 0, len(s.NetReceiveBytes))
+	for dev := range s.NetReceiveBytes {
+		devices = append(devices, dev)
+	}
+	sort.Strings(devices)
+	for _, dev := range devices {
+		add("node_network_receive_bytes_total", s.NetReceiveBytes[dev], promLabel{"device", dev})
+		add("node_network_transmit_bytes_total", s.NetTransmitBytes[dev], promLabel{"device", dev})
+	}
+	return out
+}
+
+// forwardVMMetrics pushes the session VM's stats every interval until ctx is
+// done. Failures are logged and retried on the next tick.
+func (a *App) forwardVMMetrics(ctx context.Context, sess *streamSession, ctxLogger log.Logger) {
+	base := []promLabel{
+		{"job", vmMetricsJobLabel},
+		{"instance", sess.vmID},
+		{"user", sess.userLogin},
+	}
+	if sess.logLabels.guide != "" {
+		base = append(base, promLabel{"guide", sess.logLabels.guide})
+	}
+
+	ticker := time.NewTicker(a.metrics.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			collectCtx, cancel := context.WithTimeout(ctx, vmMetricsCollectTimeout)
+			stats, err := collectVMStats(collectCtx, sess.session.SSHClient)
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					ctxLogger.Debug("Failed to collect VM stats", "vmID", sess.vmID, "error", err)
+				}
+				continue
+			}
+			if err := a.metrics.push(ctx, stats.promSeries(base, timeNow())); err != nil && ctx.Err() == nil {
+				ctxLogger.Warn("Failed to push VM metrics", "vmID", sess.vmID, "error", err)
+			}
+		}
+	}
+}
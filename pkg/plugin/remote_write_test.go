@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest is a minimal decoder for encodeWriteRequest output.
+func decodeWriteRequest(t *testing.T, b []byte) []promSeries {
+	t.Helper()
+	var out []promSeries
+	for len(b) > 0 {
+		_, _, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		tsBytes, n := protowire.ConsumeBytes(b)
+		b = b[n:]
+
+		var s promSeries
+		for len(tsBytes) > 0 {
+			num, _, n := protowire.ConsumeTag(tsBytes)
+			tsBytes = tsBytes[n:]
+			msg, n := protowire.ConsumeBytes(tsBytes)
+			tsBytes = tsBytes[n:]
+			switch num {
+			case 1:
+				var l promLabel
+				for len(msg) > 0 {
+					f, _, n := protowire.ConsumeTag(msg)
+					msg = msg[n:]
+					v, n := protowire.ConsumeString(msg)
+					msg = msg[n:]
+					if f == 1 {
+						l.Name = v
+					} else {
+						l.Value = v
+					}
+				}
+				s.Labels = append(s.Labels, l)
+			case 2:
+				_, _, n := protowire.ConsumeTag(msg)
+				msg = msg[n:]
+				bits, n := protowire.ConsumeFixed64(msg)
+				msg = msg[n:]
+				s.Value = math.Float64frombits(bits)
+				_, _, n = protowire.ConsumeTag(msg)
+				msg = msg[n:]
+				ms, _ := protowire.ConsumeVarint(msg)
+				s.TimeMs = int64(ms)
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestEncodeWriteRequest_SortsLabels(t *testing.T) {
+	in := []promSeries{{
+		Labels: []promLabel{{"__name__", "node_load1"}, {"job", "pathfinder-sandbox"}, {"instance", "vm-1"}},
+		Value:  0.5,
+		TimeMs: 1700000000000,
+	}}
+	got := decodeWriteRequest(t, encodeWriteRequest(in))
+	if len(got) != 1 {
+		t.Fatalf("decoded %d series, want 1", len(got))
+	}
+	names := []string{}
+	for _, l := range got[0].Labels {
+		names = append(names, l.Name)
+	}
+	if len(names) != 3 || names[0] != "__name__" || names[1] != "instance" || names[2] != "job" {
+		t.Errorf("label order = %v, want sorted", names)
+	}
+	if got[0].Value != 0.5 || got[0].TimeMs != 1700000000000 {
+		t.Errorf("sample = %v @ %d", got[0].Value, got[0].TimeMs)
+	}
+}
+
+func TestVMStatsPromSeries(t *testing.T) {
+	s, err := parseVMStats(sampleVMStatsOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := s.promSeries([]promLabel{{"instance", "vm-1"}}, time.Unix(100, 0))
+
+	var cpuSeries, netSeries int
+	for _, ps := range series {
+		if ps.TimeMs != 100000 {
+			t.Errorf("timestamp = %d", ps.TimeMs)
+		}
+		switch ps.Labels[0].Value {
+		case "node_cpu_seconds_total":
+			cpuSeries++
+			for _, l := range ps.Labels {
+				if l.Name == "cpu" && (l.Value != "0" && l.Value != "1") {
+					t.Errorf("cpu label = %q, want per-core index", l.Value)
+				}
+			}
+		case "node_network_receive_bytes_total", "node_network_transmit_bytes_total":
+			netSeries++
+		}
+	}
+	if cpuSeries != 2*len(cpuModes) {
+		t.Errorf("got %d cpu series, want %d (aggregate line excluded)", cpuSeries, 2*len(cpuModes))
+	}
+	if netSeries != 2 {
+		t.Errorf("got %d network series, want 2", netSeries)
+	}
+}
+
+func TestRemoteWriter_Push(t *testing.T) {
+	var gotSeries []promSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "42" || pass != "token" {
+			t.Errorf("basic auth = %q %q %v", user, pass, ok)
+		}
+		compressed, _ := io.ReadAll(r.Body)
+		raw, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("snappy decode: %v", err)
+		}
+		gotSeries = decodeWriteRequest(t, raw)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := newRemoteWriter(&Settings{PromRemoteWriteURL: srv.URL, PromRemoteWriteUser: "42", PromRemoteWritePassword: "token"})
+	if w.interval != defaultVMMetricsInterval {
+		t.Errorf("interval = %v, want default", w.interval)
+	}
+	err := w.push(context.Background(), []promSeries{{Labels: []promLabel{{"__name__", "node_load1"}}, Value: 1, TimeMs: 1}})
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if len(gotSeries) != 1 || gotSeries[0].Labels[0].Value != "node_load1" {
+		t.Errorf("received %+v", gotSeries)
+	}
+
+	if newRemoteWriter(&Settings{}) != nil {
+		t.Error("expected nil writer without PromRemoteWriteURL")
+	}
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Org completion reporting.
+//
+// GET /reports/completion aggregates the learning-activity and guide-history
+// collections into per-guide counts for admins: how many users started each
+// guide (opened it or completed it), how many completed it, and the average
+// time from first view to first completion. ?guide= limits the report to one
+// guide and ?team= to the members of a Grafana team, which needs the
+// plugin's service account. Leaderboard opt-out doesn't apply; the report
+// only has counts.
+
+// guideCompletionReport is one guide's row in a completion report.
+type guideCompletionReport struct {
+	GuideID   string `json:"guideId"`
+	Started   int    `json:"started"`
+	Completed int    `json:"completed"`
+	// Timed is how many completions had a recorded first view; the average
+	// is over those.
+	Timed                    int     `json:"timed"`
+	AvgTimeToCompleteSeconds float64 `json:"avgTimeToCompleteSeconds,omitempty"`
+}
+
+type completionReport struct {
+	Guides      []guideCompletionReport `json:"guides"`
+	Users       int                     `json:"users"`
+	Team        string                  `json:"team,omitempty"`
+	GeneratedAt time.Time               `json:"generatedAt"`
+}
+
+// completionReport builds the report over users (nil for everyone),
+// restricted to guide when it is set.
+func (a *App) completionReport(users map[string]bool, guide string) completionReport {
+	logins := map[string]bool{}
+	for _, coll := range []string{learningActivityCollection, historyCollection} {
+		for _, key := range a.store.keys(coll) {
+			if users == nil || users[key] {
+				logins[key] = true
+			}
+		}
+	}
+
+	rows := map[string]*guideCompletionReport{}
+	totals := map[string]time.Duration{}
+	row := func(id string) *guideCompletionReport {
+		if rows[id] == nil {
+			rows[id] = &guideCompletionReport{GuideID: id}
+		}
+		return rows[id]
+	}
+	if guide != "" {
+		row(guide)
+	}
+	active := 0
+	for login := range logins {
+		var activity learnerActivity
+		var history guideHistory
+		if _, err := a.store.get(learningActivityCollection, login, &activity); err != nil {
+			a.logger.Warn("Failed to read learning activity", "user", login, "error", err)
+		}
+		if _, err := a.store.get(historyCollection, login, &history); err != nil {
+			a.logger.Warn("Failed to read guide history", "user", login, "error", err)
+		}
+		firstViewed := map[string]time.Time{}
+		for _, e := range history.Entries {
+			firstViewed[e.GuideID] = e.FirstViewedAt
+		}
+
+		counted := false
+		for id := range firstViewed {
+			if (guide == "" || id == guide) && activity.Guides[id].Count == 0 {
+				row(id).Started++
+				counted = true
+			}
+		}
+		for id, c := range activity.Guides {
+			if guide != "" && id != guide {
+				continue
+			}
+			r := row(id)
+			r.Started++
+			r.Completed++
+			counted = true
+			if viewed := firstViewed[id]; !viewed.IsZero() && c.FirstCompletedAt.After(viewed) {
+				r.Timed++
+				totals[id] += c.FirstCompletedAt.Sub(viewed)
+			}
+		}
+		if counted {
+			active++
+		}
+	}
+
+	report := completionReport{Guides: []guideCompletionReport{}, Users: active, GeneratedAt: timeNow().UTC()}
+	for id, r := range rows {
+		if r.Timed > 0 {
+			r.AvgTimeToCompleteSeconds = (totals[id] / time.Duration(r.Timed)).Seconds()
+		}
+		report.Guides = append(report.Guides, *r)
+	}
+	sort.Slice(report.Guides, func(i, j int) bool {
+		gi, gj := report.Guides[i], report.Guides[j]
+		if gi.Started != gj.Started {
+			return gi.Started > gj.Started
+		}
+		return gi.GuideID < gj.GuideID
+	})
+	return report
+}
+
+// handleCompletionReport handles GET /reports/completion?guide=&team=.
+func (a *App) handleCompletionReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if userLoginFromContext(ctx) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(ctx) {
+		a.writeError(w, "Only admins can view completion reports", http.StatusForbidden)
+		return
+	}
+	guide := r.URL.Query().Get("guide")
+	if guide != "" && !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "guide must be a valid guide ID", http.StatusBadRequest)
+		return
+	}
+
+	var users map[string]bool
+	team := r.URL.Query().Get("team")
+	if team != "" {
+		api, err := resolveGrafanaAPI(ctx)
+		if err != nil {
+			a.writeError(w, "Team reports need the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+			return
+		}
+		members, err := api.TeamMembers(ctx, team)
+		if err != nil {
+			a.ctxLogger(ctx).Error("Failed to list team members", "team", team, "error", err)
+			a.writeError(w, "Failed to list team members", http.StatusBadGateway)
+			return
+		}
+		if members == nil {
+			a.writeError(w, "Team not found", http.StatusNotFound)
+			return
+		}
+		users = map[string]bool{}
+		for _, m := range members {
+			users[m] = true
+		}
+	}
+
+	report := a.completionReport(users, guide)
+	report.Team = team
+	a.writeJSON(w, report, http.StatusOK)
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCompletionReport(t *testing.T) {
+	app := newTestApp(t)
+	advance := withFrozenTime(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	view := func(user, guide string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleHistory(w, roleRequest(http.MethodPost, "/history", `{"guideId": "`+guide+`"}`, user, "Viewer"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("view: status %d: %s", w.Code, w.Body.String())
+		}
+	}
+	complete := func(user, guide string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleLearningActivity(w, roleRequest(http.MethodPost, "/learning-activity", `{"guideId": "`+guide+`"}`, user, "Viewer"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("complete: status %d: %s", w.Code, w.Body.String())
+		}
+	}
+	report := func(target, role string) (*httptest.ResponseRecorder, completionReport) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleCompletionReport(w, roleRequest(http.MethodGet, target, "", "admin", role))
+		var resp completionReport
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, resp
+	}
+
+	view("alice", "alerting-101")
+	view("bob", "alerting-101")
+	view("carol", "loki-intro")
+	advance(10 * time.Minute)
+	complete("alice", "alerting-101")
+	advance(20 * time.Minute)
+	complete("bob", "alerting-101")
+	// Completed without a recorded view: counted but not timed.
+	complete("dave", "loki-intro")
+
+	if w, _ := report("/reports/completion", "Editor"); w.Code != http.StatusForbidden {
+		t.Errorf("editor: status %d, want 403", w.Code)
+	}
+	if w, _ := report("/reports/completion?guide=../x", "Admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad guide: status %d, want 400", w.Code)
+	}
+
+	w, resp := report("/reports/completion", "Admin")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	want := []guideCompletionReport{
+		{GuideID: "alerting-101", Started: 2, Completed: 2, Timed: 2, AvgTimeToCompleteSeconds: 20 * 60},
+		{GuideID: "loki-intro", Started: 2, Completed: 1},
+	}
+	if resp.Users != 4 || len(resp.Guides) != len(want) {
+		t.Fatalf("report = %+v", resp)
+	}
+	for i := range want {
+		if resp.Guides[i] != want[i] {
+			t.Errorf("guides[%d] = %+v, want %+v", i, resp.Guides[i], want[i])
+		}
+	}
+
+	_, resp = report("/reports/completion?guide=metrics-drilldown", "Admin")
+	if len(resp.Guides) != 1 || resp.Guides[0].Started != 0 || resp.Users != 0 {
+		t.Errorf("unvisited guide: %+v", resp)
+	}
+
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{teams: map[string][]string{"sre": {"alice", "carol"}}})
+	_, resp = report("/reports/completion?team=sre", "Admin")
+	if resp.Team != "sre" || resp.Users != 2 || len(resp.Guides) != 2 || resp.Guides[0].Completed != 1 || resp.Guides[1].Completed != 0 {
+		t.Errorf("team report: %+v", resp)
+	}
+	if w, _ := report("/reports/completion?team=platform", "Admin"); w.Code != http.StatusNotFound {
+		t.Errorf("missing team: status %d, want 404", w.Code)
+	}
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{err: errors.New("boom")})
+	if w, _ := report("/reports/completion?team=sre", "Admin"); w.Code != http.StatusBadGateway {
+		t.Errorf("API error: status %d, want 502", w.Code)
+	}
+}
@@ -10,18 +10,29 @@ import (
 
 // registerRoutes sets up the HTTP routes for the plugin.
 // Terminal I/O is handled entirely via Grafana Live (see stream.go).
+// Routes are declared in apiRoutes (see routes.go) and mounted under
+// /{apiVersion}/ and, for compatibility, unversioned (see api_version.go).
+// Every route goes through secureRoute (see middleware.go) with the methods
+// of its operations.
 func (a *App) registerRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/coda/register", a.handleCodaRegister)
-	mux.HandleFunc("/coda/exec", a.handleCodaExec)
-	mux.HandleFunc("/vms", a.handleVMs)
-	mux.HandleFunc("/vms/", a.handleVMByID)
-	mux.HandleFunc("/sample-apps", a.handleSampleApps)
-	mux.HandleFunc("/alloy-scenarios", a.handleAlloyScenarios)
-	mux.HandleFunc("/package-recommendations", a.handlePackageRecommendations)
-	mux.HandleFunc("/completion-records/my", a.handleMyCompletions)
-	mux.HandleFunc("/completion-records/capability", a.handleCompletionCapability)
-	mux.HandleFunc("/custom-guide-repository", a.handleCustomGuideRepository)
-	mux.HandleFunc("/health", a.handleHealth)
+	for _, route := range a.apiRoutes() {
+		h := route.handler
+		if route.conditional {
+			h = withETag(h)
+		}
+		h = withGzip(h)
+		if route.killable {
+			h = a.refuseWhenKilled(h)
+		}
+		if route.feature != "" {
+			h = a.requireFeature(route.feature, h)
+		}
+		h = a.rateLimit(route, h)
+		h = a.secureUploadRoute(h, route.uploadTypes, route.maxBodyBytes, route.methods()...)
+		h = a.recoverPanics(h)
+		mux.HandleFunc("/"+apiVersion+route.pattern, a.withCorrelation(withAPIVersion(apiVersion, h)))
+		mux.HandleFunc(route.pattern, a.withCorrelation(a.unversioned(h)))
+	}
 }
 
 // handleVMs handles POST /vms (create) and GET /vms (list).
@@ -39,7 +50,8 @@ func (a *App) handleVMs(w http.ResponseWriter, r *http.Request) {
 // handleVMByID handles GET/DELETE /vms/{id}.
 // Terminal connections are handled via Grafana Live streaming (see stream.go).
 func (a *App) handleVMByID(w http.ResponseWriter, r *http.Request) {
-	// Extract VM ID from path: /vms/{id}
+	// Extract VM ID from path: /vms/{id}, /vms/{id}/{stop,start,file,ls,logs}
+	// /vms/{id}/proxy/{service}/... or /vms/{id}/tunnels[/{name}]
 	path := strings.TrimPrefix(r.URL.Path, "/vms/")
 	parts := strings.SplitN(path, "/", 2)
 	vmID := parts[0]
@@ -49,6 +61,38 @@ func (a *App) handleVMByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) == 2 {
+		if rest, ok := strings.CutPrefix(parts[1], "proxy/"); ok {
+			a.handleVMProxy(w, r, vmID, rest)
+			return
+		}
+		if name, ok := strings.CutPrefix(parts[1], "tunnels/"); ok {
+			a.handleVMTunnels(w, r, vmID, name)
+			return
+		}
+		switch parts[1] {
+		case "stop", "start":
+			a.handleVMPowerAction(w, r, vmID, parts[1])
+		case "file":
+			a.handleVMFile(w, r, vmID)
+		case "ls":
+			a.handleVMLs(w, r, vmID)
+		case "download":
+			a.handleVMDownload(w, r, vmID)
+		case "archive":
+			a.handleVMArchive(w, r, vmID)
+		case "logs":
+			a.handleVMLogs(w, r, vmID)
+		case "datasources":
+			a.handleSandboxDatasources(w, r, vmID)
+		case "tunnels":
+			a.handleVMTunnels(w, r, vmID, "")
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		a.handleGetVM(w, r, vmID)
@@ -59,6 +103,65 @@ func (a *App) handleVMByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleGuideByName handles /guides/{name}/assets[/{filename}],
+// /guides/{name}/prerequisites, /guides/{name}/comments[/{id}] and
+// /guides/{name}/report.
+func (a *App) handleGuideByName(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/guides/"), "/", 3)
+	if len(parts) < 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	switch parts[1] {
+	case "assets":
+		a.handleGuideAssets(w, r)
+	case "prerequisites":
+		if len(parts) == 3 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		a.handleGuidePrerequisites(w, r, parts[0])
+	case "report":
+		if len(parts) == 3 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		a.handleStepReports(w, r, parts[0])
+	case "comments":
+		id := ""
+		if len(parts) == 3 {
+			id = parts[2]
+		}
+		a.handleStepComments(w, r, parts[0], id)
+	case "locales":
+		locale := ""
+		if len(parts) == 3 {
+			locale = parts[2]
+		}
+		a.handleGuideLocales(w, r, parts[0], locale)
+	case "variant":
+		if len(parts) == 3 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		a.handleGuideVariant(w, r, parts[0])
+	case "translations":
+		if len(parts) == 3 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		a.handleGuideTranslations(w, r, parts[0])
+	case "localized":
+		if len(parts) == 3 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		a.handleLocalizedGuide(w, r, parts[0])
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
 // allowedHostSuffixes lists the trusted domain suffixes to prevent
 // token exfiltration via user-supplied URLs. Any subdomain of these
 // domains is allowed (e.g., coda.lg.grafana-dev.com, relay.lg.grafana-dev.com).
@@ -105,9 +208,9 @@ func IsAllowedRelayURL(rawURL string) bool {
 // CodaRegisterRequest represents the request body for Coda registration.
 type CodaRegisterRequest struct {
 	EnrollmentKey string `json:"enrollmentKey"`
-	InstanceID    string `json:"instanceId"`
-	InstanceURL   string `json:"instanceUrl,omitempty"`
-	CodaAPIURL    string `json:"codaApiUrl"`
+	InstanceID    string `json:"instanceId" validate:"required,max=200"`
+	InstanceURL   string `json:"instanceUrl,omitempty" validate:"max=2048"`
+	CodaAPIURL    string `json:"codaApiUrl" validate:"max=2048"`
 }
 
 func (a *App) handleCodaRegister(w http.ResponseWriter, r *http.Request) {
@@ -117,14 +220,13 @@ func (a *App) handleCodaRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CodaRegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.writeError(w, "Invalid request body", http.StatusBadRequest)
+	if !a.decodeRequest(w, r, &req) {
 		return
 	}
 
 	enrollmentKey := req.EnrollmentKey
 	if enrollmentKey == "" {
-		enrollmentKey = a.settings.EnrollmentKey
+		enrollmentKey = a.enrollmentKey()
 	}
 
 	if enrollmentKey == "" {
@@ -132,23 +234,9 @@ func (a *App) handleCodaRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine the Coda API URL: prefer admin-configured, fall back to request body.
-	// Validate against allowlist to prevent enrollment key exfiltration via arbitrary URLs.
-	codaAPIURL := a.settings.CodaAPIURL
-	if codaAPIURL == "" {
-		codaAPIURL = req.CodaAPIURL
-	}
-	if codaAPIURL == "" {
-		a.writeError(w, "Coda API URL is required", http.StatusBadRequest)
-		return
-	}
-	if !isAllowedCodaURL(codaAPIURL) {
-		a.writeError(w, "Coda API URL is not a trusted host", http.StatusBadRequest)
-		return
-	}
-
-	if req.InstanceID == "" {
-		a.writeError(w, "Instance ID is required", http.StatusBadRequest)
+	codaAPIURL, msg := a.resolveCodaAPIURL(req.CodaAPIURL)
+	if msg != "" {
+		a.writeError(w, msg, http.StatusBadRequest)
 		return
 	}
 
@@ -171,9 +259,72 @@ func (a *App) handleCodaRegister(w http.ResponseWriter, r *http.Request) {
 	a.writeJSON(w, result, http.StatusCreated)
 }
 
+// resolveCodaAPIURL picks the Coda API URL for registration: prefer
+// admin-configured, fall back to the request body. It is validated against
+// the allowlist to prevent enrollment key exfiltration via arbitrary URLs.
+// Returns a user-facing message when there is no acceptable URL.
+func (a *App) resolveCodaAPIURL(requested string) (string, string) {
+	codaAPIURL := a.settings.CodaAPIURL
+	if codaAPIURL == "" {
+		codaAPIURL = requested
+	}
+	if codaAPIURL == "" {
+		return "", "Coda API URL is required"
+	}
+	if !isAllowedCodaURL(codaAPIURL) {
+		return "", "Coda API URL is not a trusted host"
+	}
+	return codaAPIURL, ""
+}
+
+// CodaValidateKeyRequest represents the request body for enrollment key validation.
+type CodaValidateKeyRequest struct {
+	EnrollmentKey string `json:"enrollmentKey"`
+	CodaAPIURL    string `json:"codaApiUrl" validate:"max=2048"`
+}
+
+// handleCodaValidateKey checks an enrollment key with Coda without
+// registering, for immediate feedback on the config page (admin only).
+func (a *App) handleCodaValidateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can validate enrollment keys", http.StatusForbidden)
+		return
+	}
+
+	var req CodaValidateKeyRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	enrollmentKey := req.EnrollmentKey
+	if enrollmentKey == "" {
+		enrollmentKey = a.enrollmentKey()
+	}
+	if enrollmentKey == "" {
+		a.writeError(w, "Enrollment key is required", http.StatusBadRequest)
+		return
+	}
+	codaAPIURL, msg := a.resolveCodaAPIURL(req.CodaAPIURL)
+	if msg != "" {
+		a.writeError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	result, err := ValidateEnrollmentKey(r.Context(), codaAPIURL, enrollmentKey)
+	if err != nil {
+		a.ctxLogger(r.Context()).Warn("Failed to validate enrollment key", "apiUrl", codaAPIURL, "error", err)
+		a.writeError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	a.writeJSON(w, result, http.StatusOK)
+}
+
 // CreateVMHTTPRequest represents the request body for creating a VM.
 type CreateVMHTTPRequest struct {
-	Template string                 `json:"template"`
+	Template string                 `json:"template" validate:"pattern=template"`
 	Config   map[string]interface{} `json:"config,omitempty"`
 }
 
@@ -185,8 +336,7 @@ func (a *App) handleCreateVM(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CreateVMHTTPRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.writeError(w, "Invalid request body", http.StatusBadRequest)
+	if !a.decodeRequest(w, r, &req) {
 		return
 	}
 
@@ -208,6 +358,10 @@ func (a *App) handleCreateVM(w http.ResponseWriter, r *http.Request) {
 		a.writeError(w, fmt.Sprintf("VM quota exceeded: you already have %d VMs (max %d), please wait for existing VMs to expire", count, maxUserVMs), http.StatusTooManyRequests)
 		return
 	}
+	if err := a.checkOrgQuota(); err != nil {
+		a.writeError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 
 	ctxLogger.Info("Creating VM", "template", req.Template, "user", user, "hasConfig", len(req.Config) > 0)
 
@@ -222,6 +376,7 @@ func (a *App) handleCreateVM(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	a.recordVMProvisioned(ctxLogger)
 
 	a.writeJSON(w, vm, http.StatusCreated)
 }
@@ -273,6 +428,7 @@ func (a *App) handleDeleteVM(w http.ResponseWriter, r *http.Request, vmID string
 		}
 		return
 	}
+	a.closeVMTunnels(func(t vmTunnelInfo) bool { return t.VMID == vmID })
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -359,6 +515,7 @@ func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
 	status := map[string]interface{}{
 		"status":         "ok",
 		"codaRegistered": a.coda != nil,
+		"contentRefresh": a.contentRefreshStatuses(),
 	}
 	a.writeJSON(w, status, http.StatusOK)
 }
@@ -376,5 +533,9 @@ func (a *App) writeJSON(w http.ResponseWriter, data interface{}, statusCode int)
 func (a *App) writeError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+	body := map[string]string{"error": message}
+	if id := w.Header().Get(correlationIDHeader); id != "" {
+		body["correlationId"] = id
+	}
+	_ = json.NewEncoder(w).Encode(body)
 }
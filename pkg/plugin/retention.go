@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Retention of stored records.
+//
+// Audit entries, session usage records and script runs accumulate in the
+// plugin store with every session. Besides their count caps, each can be
+// given a retention period in days; a cleanup job runs at startup and every
+// retentionCleanupInterval and deletes records older than that. Records are
+// dated by the unix-nanosecond timestamp their keys start with.
+//
+// The same job deletes Grafana resources created by guide actions once they
+// are guideResourceTtlHours old (see guide_resources.go). Terminal
+// transcripts are not stored by the plugin; they go to Loki, whose own
+// retention applies. GET /admin/storage reports what the store holds.
+
+const retentionCleanupInterval = time.Hour
+
+// retentionPolicy ties a time-keyed collection to its retention setting.
+type retentionPolicy struct {
+	collection string
+	days       func(*Settings) int
+}
+
+var retentionPolicies = []retentionPolicy{
+	{auditCollection, func(s *Settings) int { return s.AuditRetentionDays }},
+	{usageCollection, func(s *Settings) int { return s.UsageRetentionDays }},
+	{scriptRunCollection, func(s *Settings) int { return s.ScriptRunRetentionDays }},
+}
+
+// retentionDays returns the configured retention for collection, or 0.
+func (a *App) retentionDays(collection string) int {
+	if a.settings == nil {
+		return 0
+	}
+	for _, p := range retentionPolicies {
+		if p.collection == collection {
+			return max(p.days(a.settings), 0)
+		}
+	}
+	return 0
+}
+
+// startRetentionCleanup deletes expired records and guide resources now and
+// every retentionCleanupInterval.
+func (a *App) startRetentionCleanup() {
+	a.runScheduled(0, func(context.Context) time.Duration {
+		a.deleteExpiredRecords(a.logger)
+		a.deleteExpiredGuideResources(a.logger)
+		return retentionCleanupInterval
+	})
+}
+
+// deleteExpiredRecords deletes records past their collection's retention
+// period and returns how many were deleted.
+func (a *App) deleteExpiredRecords(logger log.Logger) int {
+	total := 0
+	for _, p := range retentionPolicies {
+		days := a.retentionDays(p.collection)
+		if days == 0 {
+			continue
+		}
+		cutoff := timeNow().Add(-time.Duration(days) * 24 * time.Hour)
+		var expired []string
+		for _, key := range a.store.keys(p.collection) {
+			if t, ok := recordKeyTime(key); ok && t.Before(cutoff) {
+				expired = append(expired, key)
+			}
+		}
+		n, err := a.store.deleteKeys(p.collection, expired)
+		if err != nil {
+			logger.Error("Failed to delete expired records", "collection", p.collection, "error", err)
+			continue
+		}
+		if n > 0 {
+			logger.Info("Deleted expired records", "collection", p.collection, "count", n, "retentionDays", days)
+		}
+		total += n
+	}
+	return total
+}
+
+// recordKeyTime extracts the timestamp from a time-keyed store key:
+// "{nanos}", "{nanos}-{id}" or "{user}/{nanos}".
+func recordKeyTime(key string) (time.Time, bool) {
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		key = key[i+1:]
+	}
+	key, _, _ = strings.Cut(key, "-")
+	nanos, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// storageCollection is one row of GET /admin/storage.
+type storageCollection struct {
+	Name          string `json:"name"`
+	Documents     int    `json:"documents"`
+	Bytes         int    `json:"bytes"`
+	RetentionDays int    `json:"retentionDays,omitempty"`
+}
+
+// handleAdminStorage handles GET /admin/storage (admin only): the store's
+// file size and the size of each collection.
+func (a *App) handleAdminStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can read storage usage", http.StatusForbidden)
+		return
+	}
+
+	collections := []storageCollection{}
+	for _, name := range a.store.collectionNames() {
+		docs, size := a.store.collectionSize(name)
+		collections = append(collections, storageCollection{
+			Name:          name,
+			Documents:     docs,
+			Bytes:         size,
+			RetentionDays: a.retentionDays(name),
+		})
+	}
+	var fileBytes int64
+	if a.store.path != "" {
+		if info, err := os.Stat(a.store.path); err == nil {
+			fileBytes = info.Size()
+		}
+	}
+	a.writeJSON(w, map[string]interface{}{
+		"persistent":  a.store.path != "",
+		"fileBytes":   fileBytes,
+		"collections": collections,
+	}, http.StatusOK)
+}
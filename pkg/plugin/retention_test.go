@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeleteExpiredRecords(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	app := newTestApp(t)
+	app.settings = &Settings{AuditRetentionDays: 7, ScriptRunRetentionDays: 1}
+	old, recent := now.Add(-10*24*time.Hour).UnixNano(), now.Add(-time.Hour).UnixNano()
+	for _, put := range []struct{ collection, key string }{
+		{auditCollection, fmt.Sprintf("%020d", old)},
+		{auditCollection, fmt.Sprintf("%020d", recent)},
+		{usageCollection, fmt.Sprintf("%020d-sess", old)},
+		{scriptRunCollection, fmt.Sprintf("alice/%020d", old)},
+		{scriptRunCollection, fmt.Sprintf("alice/%020d", recent)},
+	} {
+		if err := app.store.put(put.collection, put.key, map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := app.deleteExpiredRecords(app.logger); n != 2 {
+		t.Errorf("deleted %d records, want 2", n)
+	}
+	if keys := app.store.keys(auditCollection); len(keys) != 1 || keys[0] != fmt.Sprintf("%020d", recent) {
+		t.Errorf("audit keys = %v", keys)
+	}
+	if keys := app.store.keys(usageCollection); len(keys) != 1 {
+		t.Errorf("usage records without retention were deleted: %v", keys)
+	}
+	if keys := app.store.keys(scriptRunCollection); len(keys) != 1 {
+		t.Errorf("script run keys = %v", keys)
+	}
+}
+
+func TestHandleAdminStorage(t *testing.T) {
+	app := newTestApp(t)
+	store, err := newJSONStore(filepath.Join(t.TempDir(), "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.store = store
+	app.settings = &Settings{AuditRetentionDays: 30}
+	_ = app.store.put(auditCollection, "1", map[string]string{"action": "x"})
+
+	w := httptest.NewRecorder()
+	app.handleAdminStorage(w, roleRequest(http.MethodGet, "/admin/storage", "", "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("editor: status = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	app.handleAdminStorage(w, roleRequest(http.MethodGet, "/admin/storage", "", "root", "Admin"))
+	var body struct {
+		Persistent  bool                `json:"persistent"`
+		FileBytes   int64               `json:"fileBytes"`
+		Collections []storageCollection `json:"collections"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Persistent || body.FileBytes == 0 || len(body.Collections) != 1 {
+		t.Fatalf("body = %+v", body)
+	}
+	if c := body.Collections[0]; c.Name != auditCollection || c.Documents != 1 || c.Bytes == 0 || c.RetentionDays != 30 {
+		t.Errorf("collection = %+v", c)
+	}
+}
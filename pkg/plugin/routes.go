@@ -0,0 +1,405 @@
+package plugin
+
+import "net/http"
+
+// apiRoute is one pattern on the resource mux. registerRoutes mounts it and
+// the OpenAPI document (see openapi.go) describes it from the same table, so
+// a route can't be added without its description.
+type apiRoute struct {
+	pattern string
+	// feature, if set, is the capability the route requires (requireFeature).
+	feature string
+	// killable routes refuse POSTs while the kill switch is engaged.
+	killable bool
+	// conditional routes answer GETs with an ETag and honour If-None-Match
+	// (see etag.go).
+	conditional bool
+	// uploadTypes are media types accepted as raw request bodies besides
+	// JSON, and maxBodyBytes caps request bodies, defaultMaxBodyBytes when 0
+	// (see secureUploadRoute).
+	uploadTypes  []string
+	maxBodyBytes int64
+	handler      http.HandlerFunc
+	ops          []apiOperation
+}
+
+// apiOperation describes one method and path served under a route pattern.
+type apiOperation struct {
+	method  string
+	path    string
+	summary string
+	query   []string
+	// request and response are example values whose types give the JSON
+	// schemas; apiFields describes map-shaped bodies.
+	request  interface{}
+	response interface{}
+	// status is the success status, 200 when zero.
+	status int
+	errors []int
+	admin  bool
+	// createsVM operations share the tightest rate limit (see ratelimit.go).
+	createsVM bool
+	// upload operations take a raw body of one of the route's uploadTypes.
+	upload bool
+}
+
+// apiFields describes a JSON object written as a map, by example values.
+type apiFields map[string]interface{}
+
+// methods returns the distinct methods of the route's operations, in order.
+func (r apiRoute) methods() []string {
+	var methods []string
+	seen := map[string]bool{}
+	for _, op := range r.ops {
+		if !seen[op.method] {
+			seen[op.method] = true
+			methods = append(methods, op.method)
+		}
+	}
+	return methods
+}
+
+// apiRoutes is the resource API.
+func (a *App) apiRoutes() []apiRoute {
+	const (
+		get  = http.MethodGet
+		post = http.MethodPost
+		put  = http.MethodPut
+		del  = http.MethodDelete
+	)
+	var (
+		userErrors  = []int{http.StatusUnauthorized}
+		adminErrors = []int{http.StatusUnauthorized, http.StatusForbidden}
+		codaErrors  = []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable}
+		itemErrors  = []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}
+	)
+	return []apiRoute{
+		{pattern: "/coda/register", handler: a.handleCodaRegister, ops: []apiOperation{
+			{method: post, path: "/coda/register", summary: "Register this Grafana instance with Coda", request: CodaRegisterRequest{}, response: RegisterResponse{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError}},
+		}},
+		{pattern: "/coda/validate-key", handler: a.handleCodaValidateKey, ops: []apiOperation{
+			{method: post, path: "/coda/validate-key", summary: "Check an enrollment key without registering", request: CodaValidateKeyRequest{}, response: EnrollmentKeyValidation{}, errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusBadGateway}, admin: true},
+		}},
+		{pattern: "/coda/exec", feature: featureTerminal, killable: true, handler: a.handleCodaExec, ops: []apiOperation{
+			{method: post, path: "/coda/exec", summary: "Run a command on the caller's VM", request: CodaExecRequest{}, response: CodaExecResponse{}, errors: codaErrors},
+		}},
+		{pattern: "/vms", feature: featureVMProvisioning, killable: true, handler: a.handleVMs, ops: []apiOperation{
+			{method: get, path: "/vms", summary: "List VMs", response: apiFields{"vms": []VM{}}, errors: codaErrors},
+			{method: post, path: "/vms", summary: "Create a VM", request: CreateVMHTTPRequest{}, response: VM{}, status: http.StatusCreated, errors: append(codaErrors, http.StatusTooManyRequests), createsVM: true},
+		}},
+		{pattern: "/vms/", feature: featureVMProvisioning, killable: true, maxBodyBytes: 2*codaFileMaxBytes + 1024, handler: a.handleVMByID, ops: []apiOperation{
+			{method: get, path: "/vms/{id}", summary: "Get a VM", response: VM{}, errors: codaErrors},
+			{method: del, path: "/vms/{id}", summary: "Destroy a VM", query: []string{"force"}, status: http.StatusNoContent, errors: codaErrors},
+			{method: post, path: "/vms/{id}/stop", summary: "Hibernate a VM", status: http.StatusAccepted, errors: codaErrors},
+			{method: post, path: "/vms/{id}/start", summary: "Resume a hibernated VM", status: http.StatusAccepted, errors: codaErrors},
+			{method: get, path: "/vms/{id}/file", summary: "Read a file on a VM", query: []string{"path"}, response: CodaFileResponse{}, errors: codaErrors},
+			{method: put, path: "/vms/{id}/file", summary: "Write a file on a VM", query: []string{"path"}, request: CodaFileWriteRequest{}, response: apiFields{"path": "", "size": 0}, errors: codaErrors},
+			{method: get, path: "/vms/{id}/download", summary: "Download a file from a VM, resumable with Range", query: []string{"path"}, errors: append(codaErrors, http.StatusRequestedRangeNotSatisfiable)},
+			{method: get, path: "/vms/{id}/archive", summary: "Download a directory from a VM as a tar.gz", query: []string{"path"}, errors: codaErrors},
+			{method: get, path: "/vms/{id}/ls", summary: "List a directory on a VM", query: []string{"path"}, response: CodaLsResponse{}, errors: codaErrors},
+			{method: get, path: "/vms/{id}/logs", summary: "Read service logs from a VM", query: []string{"source", "unit", "lines"}, response: VMLogsResponse{}, errors: codaErrors},
+			{method: get, path: "/vms/{id}/proxy/{service}/{path}", summary: "Proxy a read-only request to Prometheus, Loki or Tempo on a VM", errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable}},
+			{method: post, path: "/vms/{id}/datasources", summary: "Create Grafana data sources for the services running on a VM", request: sandboxDatasourcesRequest{}, response: apiFields{"datasources": []sandboxDatasource{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusBadGateway, http.StatusServiceUnavailable}},
+			{method: get, path: "/vms/{id}/tunnels", summary: "List the caller's tunnels to a VM with their health", response: apiFields{"tunnels": []vmTunnelInfo{}}, errors: userErrors},
+			{method: post, path: "/vms/{id}/tunnels", summary: "Open a named loopback tunnel to a port on a VM", request: openVMTunnelRequest{}, response: vmTunnelInfo{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusTooManyRequests}},
+			{method: get, path: "/vms/{id}/tunnels/{name}", summary: "Get a tunnel's status", response: vmTunnelInfo{}, errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+			{method: del, path: "/vms/{id}/tunnels/{name}", summary: "Close a tunnel", status: http.StatusNoContent, errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+		}},
+		{pattern: "/workspaces", feature: featureVMProvisioning, killable: true, handler: a.handleWorkspaces, ops: []apiOperation{
+			{method: get, path: "/workspaces", summary: "List the caller's workspaces", response: apiFields{"workspaces": []workspace{}}, errors: userErrors},
+			{method: post, path: "/workspaces", summary: "Create a workspace", request: CreateWorkspaceRequest{}, response: workspace{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict}},
+		}},
+		{pattern: "/workspaces/", feature: featureVMProvisioning, killable: true, handler: a.handleWorkspaceByName, ops: []apiOperation{
+			{method: get, path: "/workspaces/{name}", summary: "Get a workspace", response: workspace{}, errors: itemErrors},
+			{method: del, path: "/workspaces/{name}", summary: "Delete a workspace", query: []string{"destroyVm"}, status: http.StatusNoContent, errors: itemErrors},
+		}},
+		{pattern: "/scripts", feature: featureTerminal, handler: a.handleScripts, ops: []apiOperation{
+			{method: get, path: "/scripts", summary: "List the latest version of each library script", response: apiFields{"scripts": []libraryScript{}}},
+			{method: post, path: "/scripts", summary: "Publish a script version", request: PublishScriptRequest{}, response: libraryScript{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden}},
+		}},
+		{pattern: "/scripts/", feature: featureTerminal, conditional: true, handler: a.handleScriptByName, ops: []apiOperation{
+			{method: get, path: "/scripts/{name}", summary: "Get a library script", query: []string{"version"}, response: libraryScript{}, errors: itemErrors},
+			{method: del, path: "/scripts/{name}", summary: "Delete a library script", status: http.StatusNoContent, errors: append(itemErrors, http.StatusForbidden)},
+		}},
+		{pattern: "/script-runs", feature: featureTerminal, killable: true, handler: a.handleScriptRuns, ops: []apiOperation{
+			{method: get, path: "/script-runs", summary: "List the caller's script runs, newest first", response: apiFields{"runs": []scriptRun{}}, errors: userErrors},
+		}},
+		{pattern: "/guide-templates", feature: featureCustomGuides, conditional: true, handler: a.handleGuideTemplates, ops: []apiOperation{
+			{method: get, path: "/guide-templates", summary: "List guide template mappings", response: apiFields{"mappings": []guideTemplate{}}},
+		}},
+		{pattern: "/guide-templates/", feature: featureCustomGuides, conditional: true, handler: a.handleGuideTemplateByID, ops: []apiOperation{
+			{method: get, path: "/guide-templates/{guideId}", summary: "Get a guide's template mapping", response: guideTemplate{}, errors: itemErrors},
+			{method: put, path: "/guide-templates/{guideId}", summary: "Set a guide's template mapping", request: PutGuideTemplateRequest{}, response: guideTemplate{}, errors: adminErrors, admin: true},
+			{method: del, path: "/guide-templates/{guideId}", summary: "Remove a guide's template mapping", status: http.StatusNoContent, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/guides/", feature: featureCustomGuides, conditional: true, uploadTypes: guideAssetUploadTypes(), maxBodyBytes: guideAssetMaxBytes, handler: a.handleGuideByName, ops: []apiOperation{
+			{method: get, path: "/guides/{name}/assets", summary: "List a guide's uploaded assets", response: apiFields{"assets": []guideAsset{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+			{method: post, path: "/guides/{name}/assets", summary: "Upload an image for a guide", query: []string{"filename"}, upload: true, response: guideAsset{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusRequestEntityTooLarge}},
+			{method: get, path: "/guides/{name}/assets/{filename}", summary: "Get an uploaded guide asset", errors: itemErrors},
+			{method: del, path: "/guides/{name}/assets/{filename}", summary: "Delete an uploaded guide asset", status: http.StatusNoContent, errors: itemErrors},
+			{method: post, path: "/guides/{name}/prerequisites", summary: "Check a guide's prerequisites against this instance", request: prerequisitesRequest{}, response: prerequisitesResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+			{method: get, path: "/guides/{name}/report", summary: "List a guide's broken-step reports", response: apiFields{"steps": []brokenStep{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden}},
+			{method: post, path: "/guides/{name}/report", summary: "Report a broken guide step", request: StepReportRequest{}, response: stepReportResponse{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict}},
+			{method: get, path: "/guides/{name}/comments", summary: "List the step comments you can see on a guide", query: []string{"step"}, response: apiFields{"comments": []stepComment{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+			{method: post, path: "/guides/{name}/comments", summary: "Comment on a guide step", request: StepCommentRequest{}, response: stepComment{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict}},
+			{method: put, path: "/guides/{name}/comments/{id}", summary: "Resolve or reopen a step comment", request: StepCommentUpdateRequest{}, response: stepComment{}, errors: append(itemErrors, http.StatusForbidden)},
+			{method: del, path: "/guides/{name}/comments/{id}", summary: "Delete a step comment", status: http.StatusNoContent, errors: append(itemErrors, http.StatusForbidden)},
+			{method: get, path: "/guides/{name}/locales", summary: "List a guide's translations", response: apiFields{"sourceLocale": "", "locales": []guideLocaleVariant{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+			{method: get, path: "/guides/{name}/locales/{locale}", summary: "Get a guide's translation", response: guideLocaleVariant{}, errors: itemErrors},
+			{method: put, path: "/guides/{name}/locales/{locale}", summary: "Store a guide's translation", request: GuideLocaleRequest{}, response: guideLocaleVariant{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict}},
+			{method: del, path: "/guides/{name}/locales/{locale}", summary: "Delete a guide's translation", status: http.StatusNoContent, errors: append(itemErrors, http.StatusForbidden)},
+			{method: get, path: "/guides/{name}/variant", summary: "Get the caller's variant of the guide's running experiment", response: assignedVariant{}, errors: itemErrors},
+			{method: get, path: "/guides/{name}/translations", summary: "List a guide's queued machine translations", response: apiFields{"jobs": []translationJob{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden}},
+			{method: post, path: "/guides/{name}/translations", summary: "Queue machine translation of a saved guide", request: TranslationRequest{}, response: apiFields{"locales": []string{}}, status: http.StatusAccepted, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict}},
+			{method: get, path: "/guides/{name}/localized", summary: "Get the translation that best matches the caller's language", query: []string{"language"}, response: guideLocaleVariant{}, errors: itemErrors},
+		}},
+		{pattern: "/guides/lint", handler: a.handleGuideLint, ops: []apiOperation{
+			{method: post, path: "/guides/lint", summary: "Lint a guide's JSON beyond schema validation", request: GuideLintRequest{}, response: guideLintResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/broadcasts", feature: featureTerminal, handler: a.handleBroadcasts, ops: []apiOperation{
+			{method: get, path: "/broadcasts", summary: "List active broadcasts", response: apiFields{"broadcasts": []broadcastInfo{}}, errors: userErrors},
+			{method: post, path: "/broadcasts", summary: "Start broadcasting the caller's terminal to a cohort", request: StartBroadcastRequest{}, response: broadcastInfo{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden}},
+		}},
+		{pattern: "/broadcasts/", feature: featureTerminal, handler: a.handleBroadcastByCohort, ops: []apiOperation{
+			{method: get, path: "/broadcasts/{cohort}", summary: "Get a cohort's broadcast", response: broadcastInfo{}, errors: itemErrors},
+			{method: del, path: "/broadcasts/{cohort}", summary: "Stop a cohort's broadcast", status: http.StatusNoContent, errors: append(itemErrors, http.StatusForbidden)},
+		}},
+		{pattern: "/shared-terminals", feature: featureTerminal, handler: a.handleSharedTerminals, ops: []apiOperation{
+			{method: get, path: "/shared-terminals", summary: "List shares the caller owns or was invited to", response: apiFields{"sharedTerminals": []sharedTerminalInfo{}}, errors: userErrors},
+			{method: post, path: "/shared-terminals", summary: "Share the caller's terminal", request: ShareTerminalRequest{}, response: sharedTerminalInfo{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/shared-terminals/", feature: featureTerminal, handler: a.handleSharedTerminalByID, ops: []apiOperation{
+			{method: get, path: "/shared-terminals/{id}", summary: "Get a terminal share", response: sharedTerminalInfo{}, errors: itemErrors},
+			{method: del, path: "/shared-terminals/{id}", summary: "Revoke a terminal share", status: http.StatusNoContent, errors: append(itemErrors, http.StatusForbidden)},
+		}},
+		{pattern: "/admin/workshops", feature: featureVMProvisioning, killable: true, handler: a.handleAdminWorkshops, ops: []apiOperation{
+			{method: get, path: "/admin/workshops", summary: "List workshops", response: apiFields{"workshops": []workshopInfo{}}, errors: adminErrors, admin: true},
+			{method: post, path: "/admin/workshops", summary: "Create a workshop and provision its VMs", request: CreateWorkshopRequest{}, response: workshopInfo{}, status: http.StatusAccepted, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusServiceUnavailable}, admin: true, createsVM: true},
+		}},
+		{pattern: "/admin/workshops/", feature: featureVMProvisioning, handler: a.handleAdminWorkshopByName, ops: []apiOperation{
+			{method: get, path: "/admin/workshops/{name}", summary: "Get a workshop", response: workshopInfo{}, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: del, path: "/admin/workshops/{name}", summary: "Delete a workshop and destroy its VMs", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: get, path: "/admin/workshops/{name}/roster", summary: "Get a workshop's roster", response: apiFields{"roster": []rosterEntry{}}, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: put, path: "/admin/workshops/{name}/roster", summary: "Replace a workshop's roster", request: RosterRequest{}, response: apiFields{"roster": []rosterEntry{}}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict), admin: true},
+		}},
+		{pattern: "/workshops/claim/", feature: featureVMProvisioning, handler: a.handleWorkshopClaim, ops: []apiOperation{
+			{method: get, path: "/workshops/claim/{token}", summary: "Claim a workshop VM and redirect to its guide", status: http.StatusSeeOther, errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+		}},
+		{pattern: "/provisioning-schedules", feature: featureVMProvisioning, killable: true, handler: a.handleProvisioningSchedules, ops: []apiOperation{
+			{method: get, path: "/provisioning-schedules", summary: "List provisioning schedules", response: apiFields{"schedules": []provisioningSchedule{}}, errors: adminErrors, admin: true},
+			{method: post, path: "/provisioning-schedules", summary: "Schedule VM provisioning", request: CreateScheduleRequest{}, response: provisioningSchedule{}, status: http.StatusCreated, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/provisioning-schedules/", feature: featureVMProvisioning, handler: a.handleProvisioningScheduleByID, ops: []apiOperation{
+			{method: get, path: "/provisioning-schedules/{id}", summary: "Get a provisioning schedule", response: provisioningSchedule{}, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: del, path: "/provisioning-schedules/{id}", summary: "Cancel a provisioning schedule", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound), admin: true},
+		}},
+		{pattern: "/usage/quota", handler: a.handleUsageQuota, ops: []apiOperation{
+			{method: get, path: "/usage/quota", summary: "Get this month's VM quota usage", response: apiFields{"month": "", "resetsAt": timeNow(), "vmCount": quotaAllowance{}, "vmHours": quotaAllowance{}}, errors: userErrors},
+		}},
+		{pattern: "/analytics", feature: featureAnalytics, handler: a.handleAnalytics, ops: []apiOperation{
+			{method: get, path: "/analytics", summary: "Daily guide activity, per-guide totals and a guide's step funnel", query: []string{"from", "to", "guide"}, response: analyticsResponse{}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/recommend", handler: a.handleRecommend, ops: []apiOperation{
+			{method: post, path: "/recommend", summary: "Proxy a recommender request with the instance's data sources, dashboard tags and feature toggles added", request: apiFields{"path": "", "datasources": []string{}}, response: apiFields{"recommendations": []apiFields{}, "featured": []apiFields{}}, errors: append(userErrors, http.StatusBadRequest, http.StatusConflict, http.StatusBadGateway)},
+		}},
+		{pattern: "/recommend/feedback", feature: featureAnalytics, handler: a.handleRecommendationFeedback, ops: []apiOperation{
+			{method: get, path: "/recommend/feedback", summary: "The caller's recommendation feedback, newest first", response: apiFields{"feedback": []recommendationFeedback{}}, errors: userErrors},
+			{method: post, path: "/recommend/feedback", summary: "Rate a recommendation up, down or not relevant", request: RecommendationFeedbackRequest{}, response: recommendationFeedback{}, errors: append(userErrors, http.StatusBadRequest)},
+		}},
+		{pattern: "/usage/export", feature: featureAnalytics, handler: a.handleUsageExport, ops: []apiOperation{
+			{method: get, path: "/usage/export", summary: "Export aggregated session usage as JSON or CSV", query: []string{"from", "to", "format"}, response: apiFields{"from": timeNow(), "to": timeNow(), "rows": []usageRow{}}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/admin/sessions", feature: featureTerminal, handler: a.handleAdminSessions, ops: []apiOperation{
+			{method: get, path: "/admin/sessions", summary: "List connected terminal sessions", query: []string{"limit", "offset", "user"}, response: apiFields{"sessions": []adminSessionInfo{}, "total": 0, "limit": 0, "offset": 0}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/admin/sessions/", feature: featureTerminal, handler: a.handleAdminSessionByID, ops: []apiOperation{
+			{method: del, path: "/admin/sessions/{id}", summary: "Disconnect a terminal session", query: []string{"destroyVm", "reason"}, status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound, http.StatusBadGateway), admin: true},
+		}},
+		{pattern: "/admin/audit-log", handler: a.handleAuditLog, ops: []apiOperation{
+			{method: get, path: "/admin/audit-log", summary: "List audit entries, newest first", query: []string{"limit"}, response: apiFields{"entries": []auditEntry{}}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/admin/content-refresh", handler: a.handleAdminContentRefresh, ops: []apiOperation{
+			{method: get, path: "/admin/content-refresh", summary: "Report when each cached content index was last refreshed", response: apiFields{"intervalMinutes": 0, "sources": []contentRefreshStatus{}}, errors: adminErrors, admin: true},
+			{method: post, path: "/admin/content-refresh", summary: "Refresh every cached content index now", response: apiFields{"intervalMinutes": 0, "sources": []contentRefreshStatus{}}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/admin/storage", handler: a.handleAdminStorage, ops: []apiOperation{
+			{method: get, path: "/admin/storage", summary: "Report the plugin store's size per collection", response: apiFields{"persistent": false, "fileBytes": 0, "collections": []storageCollection{}}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/admin/digest", handler: a.handleAdminDigest, ops: []apiOperation{
+			{method: get, path: "/admin/digest", summary: "Preview the next scheduled digest", response: digestStatus{}, errors: adminErrors, admin: true},
+			{method: post, path: "/admin/digest", summary: "Send the digest to its webhook now", response: digestSummary{}, errors: append(adminErrors, http.StatusConflict, http.StatusBadGateway), admin: true},
+		}},
+		{pattern: "/admin/selector-health", handler: a.handleAdminSelectorHealth, ops: []apiOperation{
+			{method: get, path: "/admin/selector-health", summary: "Get the last selector health report", response: selectorHealthReport{}, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: post, path: "/admin/selector-health", summary: "Check monitored guides' selectors now", response: selectorHealthReport{}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/admin/selector-health/", handler: a.handleAdminSelectorHealth, ops: []apiOperation{
+			{method: get, path: "/admin/selector-health/guides", summary: "List the guides selector health monitors", response: apiFields{"guides": []selectorGuide{}}, errors: adminErrors, admin: true},
+			{method: put, path: "/admin/selector-health/guides", summary: "Replace the guides selector health monitors", request: SelectorHealthGuidesRequest{}, response: apiFields{"guides": 0}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/admin/quarantine", feature: featureCustomGuides, handler: a.handleAdminQuarantine, ops: []apiOperation{
+			{method: get, path: "/admin/quarantine", summary: "List guide content quarantined by the security scan", response: apiFields{"items": []quarantinedGuide{}}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/admin/quarantine/", feature: featureCustomGuides, handler: a.handleAdminQuarantine, ops: []apiOperation{
+			{method: get, path: "/admin/quarantine/{guide}/{locale}", summary: "Get quarantined guide content with its findings", response: quarantinedGuide{}, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: post, path: "/admin/quarantine/{guide}/{locale}/release", summary: "Release quarantined guide content and store it", response: quarantinedGuide{}, errors: append(adminErrors, http.StatusNotFound, http.StatusConflict), admin: true},
+			{method: del, path: "/admin/quarantine/{guide}/{locale}", summary: "Reject quarantined guide content", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound), admin: true},
+		}},
+		{pattern: "/admin/identities", handler: a.handleAdminIdentities, ops: []apiOperation{
+			{method: get, path: "/admin/identities", summary: "List external identities mapped to Grafana logins", response: apiFields{"identities": []externalIdentity{}}, errors: adminErrors, admin: true},
+			{method: put, path: "/admin/identities", summary: "Set external identities in bulk", request: BulkIdentityRequest{}, response: apiFields{"updated": 0}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/admin/identities/", handler: a.handleAdminIdentity, ops: []apiOperation{
+			{method: get, path: "/admin/identities/{login}", summary: "Get a login's external identity", response: externalIdentity{}, errors: append(adminErrors, http.StatusNotFound), admin: true},
+			{method: put, path: "/admin/identities/{login}", summary: "Set a login's external identity", request: IdentityRequest{}, response: externalIdentity{}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+			{method: del, path: "/admin/identities/{login}", summary: "Remove a login's external identity", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound), admin: true},
+		}},
+		{pattern: "/admin/users/", handler: a.handleAdminUserData, ops: []apiOperation{
+			{method: del, path: "/admin/users/{login}/data", summary: "Purge what the plugin stores about a user", query: []string{"email", "destroyVms"}, response: purgeReport{}, errors: append(adminErrors, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusServiceUnavailable), admin: true},
+		}},
+		{pattern: "/admin/drain", handler: a.handleDrain, ops: []apiOperation{
+			{method: get, path: "/admin/drain", summary: "Get the drain state", response: drainInfo{}, errors: adminErrors, admin: true},
+			{method: put, path: "/admin/drain", summary: "Start or cancel draining terminal sessions before a restart", request: DrainRequest{}, response: drainInfo{}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/admin/kill-switch", handler: a.handleKillSwitch, ops: []apiOperation{
+			{method: get, path: "/admin/kill-switch", summary: "Get the kill switch state", response: killSwitchInfo{}, errors: adminErrors, admin: true},
+			{method: put, path: "/admin/kill-switch", summary: "Engage or release the kill switch", request: KillSwitchRequest{}, response: killSwitchInfo{}, errors: append(adminErrors, http.StatusBadRequest), admin: true},
+		}},
+		{pattern: "/sample-apps", conditional: true, handler: a.handleSampleApps, ops: []apiOperation{
+			{method: get, path: "/sample-apps", summary: "List sample apps available for VMs", response: SampleAppsResponse{}, errors: []int{http.StatusBadGateway, http.StatusServiceUnavailable}},
+		}},
+		{pattern: "/alloy-scenarios", conditional: true, handler: a.handleAlloyScenarios, ops: []apiOperation{
+			{method: get, path: "/alloy-scenarios", summary: "List Alloy scenarios available for VMs", response: AlloyScenariosResponse{}, errors: []int{http.StatusBadGateway, http.StatusServiceUnavailable}},
+		}},
+		{pattern: "/cdn-guides/", conditional: true, handler: a.handleCDNGuide, ops: []apiOperation{
+			{method: get, path: "/cdn-guides/{path}", summary: "Serve a guide JSON file from the interactive-learning CDN through the plugin's cache", query: []string{"host"}, response: apiFields{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusBadGateway}},
+		}},
+		{pattern: "/package-recommendations", conditional: true, handler: a.handlePackageRecommendations, ops: []apiOperation{
+			{method: get, path: "/package-recommendations", summary: "Recommend guide packages for this instance", query: []string{"compatibleOnly"}, response: PackageRecommendationsResponse{}},
+		}},
+		{pattern: "/completion-records/my", feature: featureAnalytics, handler: a.handleMyCompletions, ops: []apiOperation{
+			{method: get, path: "/completion-records/my", summary: "List the caller's guide completions", query: []string{"refresh"}, response: myCompletionsResponse{}, errors: userErrors},
+		}},
+		{pattern: "/completion-records/capability", feature: featureAnalytics, handler: a.handleCompletionCapability, ops: []apiOperation{
+			{method: get, path: "/completion-records/capability", summary: "Report whether completion records are available", response: completionCapability{}},
+		}},
+		{pattern: "/bookmarks", handler: a.handleBookmarks, ops: []apiOperation{
+			{method: get, path: "/bookmarks", summary: "List the caller's bookmarked guides", response: apiFields{"bookmarks": []guideBookmark{}}, errors: userErrors},
+			{method: post, path: "/bookmarks", summary: "Bookmark a guide", request: CreateBookmarkRequest{}, response: guideBookmark{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict}},
+		}},
+		{pattern: "/bookmarks/", handler: a.handleBookmarkByGuide, ops: []apiOperation{
+			{method: del, path: "/bookmarks/{guideId}", summary: "Remove a bookmark", status: http.StatusNoContent, errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+		}},
+		{pattern: "/history", handler: a.handleHistory, ops: []apiOperation{
+			{method: get, path: "/history", summary: "List the caller's recently viewed guides", query: []string{"limit"}, response: apiFields{"history": []guideHistoryEntry{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+			{method: post, path: "/history", summary: "Record that the caller opened or moved through a guide", request: RecordHistoryRequest{}, response: guideHistoryEntry{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+			{method: del, path: "/history", summary: "Clear the caller's guide history", status: http.StatusNoContent, errors: userErrors},
+		}},
+		{pattern: "/progress/sync", handler: a.handleProgressSync, ops: []apiOperation{
+			{method: post, path: "/progress/sync", summary: "Merge the caller's local step progress and return the merged state", request: SyncProgressRequest{}, response: syncProgressResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/progress/export", handler: a.handleProgressExport, ops: []apiOperation{
+			{method: get, path: "/progress/export", summary: "Export the caller's learning progress", response: progressExport{}, errors: userErrors},
+		}},
+		{pattern: "/progress/import", maxBodyBytes: maxProgressImportBytes, handler: a.handleProgressImport, ops: []apiOperation{
+			{method: post, path: "/progress/import", summary: "Merge an exported progress document into the caller's progress", request: progressExport{}, response: progressImportReport{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/learning-activity", handler: a.handleLearningActivity, ops: []apiOperation{
+			{method: get, path: "/learning-activity", summary: "Get the caller's completion count and streak", response: learnerStats{}, errors: userErrors},
+			{method: post, path: "/learning-activity", summary: "Record a guide completion for the caller", request: RecordCompletionRequest{}, response: learnerStats{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/learning-activity/quiz", handler: a.handleQuizResult, ops: []apiOperation{
+			{method: post, path: "/learning-activity/quiz", summary: "Report a quiz result to the configured LRS", request: QuizResultRequest{}, status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/leaderboard", handler: a.handleLeaderboard, ops: []apiOperation{
+			{method: get, path: "/leaderboard", summary: "Rank the org's learners by completions or streak", query: []string{"by", "limit"}, response: leaderboardResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/leaderboard/opt-out", handler: a.handleLeaderboardOptOut, ops: []apiOperation{
+			{method: put, path: "/leaderboard/opt-out", summary: "Leave or rejoin the leaderboard", request: LeaderboardOptOutRequest{}, response: learnerStats{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/preferences", handler: a.handlePreferences, ops: []apiOperation{
+			{method: get, path: "/preferences", summary: "Get the caller's Pathfinder preferences", response: UserPreferences{}, errors: userErrors},
+			{method: put, path: "/preferences", summary: "Replace the caller's Pathfinder preferences", request: UserPreferences{}, response: UserPreferences{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		}},
+		{pattern: "/badges", handler: a.handleBadges, ops: []apiOperation{
+			{method: get, path: "/badges", summary: "List built-in and org badge definitions", response: apiFields{"badges": []badge{}}, errors: userErrors},
+			{method: post, path: "/badges", summary: "Define an org badge", request: badge{}, response: badge{}, status: http.StatusCreated, errors: append(adminErrors, http.StatusBadRequest, http.StatusConflict), admin: true},
+		}},
+		{pattern: "/badges/earned", handler: a.handleEarnedBadges, ops: []apiOperation{
+			{method: get, path: "/badges/earned", summary: "List the badges a user has earned", query: []string{"user"}, response: apiFields{"user": "", "badges": []earnedBadge{}}, errors: []int{http.StatusUnauthorized, http.StatusForbidden}},
+		}},
+		{pattern: "/badges/", handler: a.handleBadgeByID, ops: []apiOperation{
+			{method: put, path: "/badges/{id}", summary: "Update an org badge", request: badge{}, response: badge{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict), admin: true},
+			{method: del, path: "/badges/{id}", summary: "Delete an org badge", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound, http.StatusConflict), admin: true},
+		}},
+		{pattern: "/reports/completion", handler: a.handleCompletionReport, ops: []apiOperation{
+			{method: get, path: "/reports/completion", summary: "Summarize guide starts, completions and time to complete", query: []string{"guide", "team"}, response: completionReport{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable), admin: true},
+		}},
+		{pattern: "/custom-guide-repository", feature: featureCustomGuides, conditional: true, handler: a.handleCustomGuideRepository, ops: []apiOperation{
+			{method: get, path: "/custom-guide-repository", summary: "List custom guides published in this instance", query: []string{"compatibleOnly"}, response: customGuideRepositoryResponse{}},
+		}},
+		{pattern: "/guide-access", feature: featureCustomGuides, handler: a.handleGuideAccessList, ops: []apiOperation{
+			{method: get, path: "/guide-access", summary: "List custom guide access rules", response: apiFields{"rules": []guideAccess{}}, errors: adminErrors, admin: true},
+		}},
+		{pattern: "/guide-access/", feature: featureCustomGuides, handler: a.handleGuideAccess, ops: []apiOperation{
+			{method: put, path: "/guide-access/{guideId}", summary: "Restrict a custom guide to teams or folders", request: GuideAccessRequest{}, response: guideAccess{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict), admin: true},
+			{method: del, path: "/guide-access/{guideId}", summary: "Remove a custom guide's access rule", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound), admin: true},
+		}},
+		{pattern: "/experiments", handler: a.handleExperiments, ops: []apiOperation{
+			{method: get, path: "/experiments", summary: "List guide experiments", response: apiFields{"experiments": []experiment{}}, errors: adminErrors},
+		}},
+		{pattern: "/experiments/", handler: a.handleExperiment, ops: []apiOperation{
+			{method: get, path: "/experiments/{id}", summary: "Get a guide experiment with its results per variant", response: experimentResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound)},
+			{method: put, path: "/experiments/{id}", summary: "Create, change, start or stop a guide experiment", request: ExperimentRequest{}, response: experimentResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusConflict)},
+			{method: del, path: "/experiments/{id}", summary: "Delete a guide experiment and its exposures", status: http.StatusNoContent, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound)},
+		}},
+		{pattern: "/guide-locales", feature: featureCustomGuides, handler: a.handleGuideLocaleCoverage, ops: []apiOperation{
+			{method: get, path: "/guide-locales", summary: "List guides' missing translations", query: []string{"guide"}, response: guideLocaleCoverageResponse{}, errors: append(adminErrors, http.StatusBadRequest)},
+		}},
+		{pattern: "/guide-reviews", feature: featureCustomGuides, handler: a.handleGuideReviewList, ops: []apiOperation{
+			{method: get, path: "/guide-reviews", summary: "List custom guide reviews", query: []string{"state", "reviewer"}, response: apiFields{"reviews": []guideReview{}}, errors: adminErrors},
+		}},
+		{pattern: "/guide-reviews/", feature: featureCustomGuides, handler: a.handleGuideReview, ops: []apiOperation{
+			{method: get, path: "/guide-reviews/{guideId}", summary: "Get a custom guide's review", response: guideReviewResponse{}, errors: append(adminErrors, http.StatusNotFound)},
+			{method: post, path: "/guide-reviews/{guideId}", summary: "Ask for a review of a custom guide", request: GuideReviewRequest{}, response: guideReviewResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusConflict)},
+			{method: del, path: "/guide-reviews/{guideId}", summary: "Withdraw a custom guide's review", status: http.StatusNoContent, errors: append(adminErrors, http.StatusNotFound)},
+			{method: put, path: "/guide-reviews/{guideId}/reviewers", summary: "Assign a review's reviewers", request: GuideReviewRequest{}, response: guideReviewResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound)},
+			{method: post, path: "/guide-reviews/{guideId}/comments", summary: "Comment on a custom guide's review", request: GuideReviewCommentRequest{}, response: guideReviewResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)},
+			{method: post, path: "/guide-reviews/{guideId}/approve", summary: "Approve a custom guide for publishing", request: GuideReviewCommentRequest{}, response: guideReviewResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway)},
+			{method: post, path: "/guide-reviews/{guideId}/request-changes", summary: "Request changes to a custom guide", request: GuideReviewCommentRequest{}, response: guideReviewResponse{}, errors: append(adminErrors, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)},
+		}},
+		{pattern: "/plugin-installs", handler: a.handlePluginInstalls, ops: []apiOperation{
+			{method: post, path: "/plugin-installs", summary: "Install a plugin a guide requires", request: pluginInstallRequest{}, response: pluginInstallResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusServiceUnavailable}, admin: true},
+		}},
+		{pattern: "/actions/alert-rules", handler: a.handleAlertRuleActions, ops: []apiOperation{
+			{method: get, path: "/actions/alert-rules", summary: "List the demo alert rule definitions", response: apiFields{"definitions": []demoAlertRule{}}},
+			{method: post, path: "/actions/alert-rules", summary: "Create a demo alert rule and contact point", request: alertRuleActionRequest{}, response: alertRuleActionResponse{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusServiceUnavailable}},
+		}},
+		{pattern: "/actions/dashboards", handler: a.handleDashboardActions, ops: []apiOperation{
+			{method: get, path: "/actions/dashboards", summary: "List the demo dashboard definitions", response: apiFields{"definitions": []demoDashboard{}}},
+			{method: post, path: "/actions/dashboards", summary: "Create a demo dashboard", request: dashboardActionRequest{}, response: dashboardActionResponse{}, status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusServiceUnavailable}},
+		}},
+		{pattern: "/actions/resources", handler: a.handleGuideResources, ops: []apiOperation{
+			{method: get, path: "/actions/resources", summary: "List Grafana resources your guide actions created", query: []string{"guide"}, response: apiFields{"resources": []guideResource{}}, errors: userErrors},
+		}},
+		{pattern: "/actions/cleanup", handler: a.handleGuideCleanup, ops: []apiOperation{
+			{method: post, path: "/actions/cleanup", summary: "Delete Grafana resources your guide actions created", request: guideCleanupRequest{}, response: guideCleanupResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable}},
+		}},
+		{pattern: "/demo-data", handler: a.handleDemoData, ops: []apiOperation{
+			{method: get, path: "/demo-data", summary: "List the demo data profiles", response: apiFields{"profiles": []demoDataProfile{}}},
+			{method: post, path: "/demo-data", summary: "Generate demo metrics and logs from a profile", request: demoDataRequest{}, response: demoDataResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway}},
+		}},
+		{pattern: "/features", handler: a.handleFeatures, ops: []apiOperation{
+			{method: get, path: "/features", summary: "Report which capabilities are enabled", response: map[string]bool{}},
+		}},
+		{pattern: "/webhooks/", handler: a.handleWebhook, ops: []apiOperation{
+			{method: post, path: "/webhooks/{kind}", summary: "Receive a signed webhook from Coda", status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+		}},
+		{pattern: "/openapi.json", conditional: true, handler: a.handleOpenAPI, ops: []apiOperation{
+			{method: get, path: "/openapi.json", summary: "Get this OpenAPI document", response: map[string]interface{}{}},
+		}},
+		{pattern: "/health", handler: a.handleHealth, ops: []apiOperation{
+			{method: get, path: "/health", summary: "Report plugin health", response: apiFields{"status": "", "codaRegistered": false, "contentRefresh": []contentRefreshStatus{}}},
+		}},
+	}
+}
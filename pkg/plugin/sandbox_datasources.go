@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Grafana data sources for services running on a sandbox VM.
+//
+// POST /vms/{id}/datasources checks which of Prometheus, Loki and Tempo
+// answer on the caller's VM and creates a Grafana data source for each,
+// so the learner can open Explore on data produced in their own sandbox.
+// In the default "proxy" mode the data source points at the plugin's VM
+// proxy (see vm_proxy.go), authenticates to Grafana as the plugin's service
+// account and carries a proxy token scoped to its VM and service. In
+// "tunnel" mode it points at a loopback tunnel in the plugin process (see
+// vm_tunnel.go), which needs Grafana and the plugin on the same host. Data
+// sources are tracked as guide resources, so POST /actions/cleanup removes
+// them and revokes their tokens or closes their tunnels.
+
+const pluginID = "grafana-pathfinder-app"
+
+const (
+	sandboxDatasourceModeProxy  = "proxy"
+	sandboxDatasourceModeTunnel = "tunnel"
+
+	sandboxDatasourceCreated     = "created"
+	sandboxDatasourceExists      = "exists"
+	sandboxDatasourceUnavailable = "unavailable"
+)
+
+type sandboxDatasourcesRequest struct {
+	Services []string `json:"services,omitempty" validate:"max=3,each,oneof=prometheus loki tempo"`
+	Guide    string   `json:"guide,omitempty" validate:"max=200"`
+	Mode     string   `json:"mode,omitempty" validate:"oneof=proxy tunnel"`
+}
+
+type sandboxDatasource struct {
+	Service string `json:"service"`
+	UID     string `json:"uid,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Tunnel  string `json:"tunnel,omitempty"`
+}
+
+// vmProxyURL is the plugin resource URL Grafana reaches service on vmID at.
+func vmProxyURL(appURL, vmID, service string) string {
+	return fmt.Sprintf("%s/api/plugins/%s/resources/%s/vms/%s/proxy/%s", appURL, pluginID, apiVersion, vmID, service)
+}
+
+// handleSandboxDatasources handles POST /vms/{id}/datasources.
+func (a *App) handleSandboxDatasources(w http.ResponseWriter, r *http.Request, vmID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userCanEditFromContext(ctx) {
+		a.writeError(w, "Only editors and admins can create data sources", http.StatusForbidden)
+		return
+	}
+	var req sandboxDatasourcesRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Services) == 0 {
+		for name := range vmServices {
+			req.Services = append(req.Services, name)
+		}
+		sort.Strings(req.Services)
+	}
+	if req.Mode == "" {
+		req.Mode = sandboxDatasourceModeProxy
+	}
+
+	client := a.findSSHClientForUserVM(user, vmID)
+	if client == nil {
+		a.writeError(w, "No active terminal session for this VM", http.StatusConflict)
+		return
+	}
+	appURL, saToken, err := grafanaServiceAccount(ctx)
+	if err != nil {
+		a.writeError(w, "Sandbox data sources need the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+		return
+	}
+	api, err := resolveGrafanaAPI(ctx)
+	if err != nil {
+		a.writeError(w, "Sandbox data sources need the plugin's service account; enable externalServiceAccounts in Grafana", http.StatusServiceUnavailable)
+		return
+	}
+	logger := a.ctxLogger(ctx)
+
+	results := make([]sandboxDatasource, 0, len(req.Services))
+	for _, name := range req.Services {
+		service := vmServices[name]
+		uid := guideResourceUID(guideResourceDatasource, vmID+"/"+name, user)
+		result := sandboxDatasource{Service: name, UID: uid, Name: fmt.Sprintf("Sandbox %s (%s, %s)", name, user, vmID), Type: service.Datasource}
+		if _, tracked := a.trackedGuideResource(user, guideResourceDatasource, uid); tracked {
+			result.Status = sandboxDatasourceExists
+			if req.Mode == sandboxDatasourceModeTunnel {
+				// Reopens the tunnel on its remembered port after a restart.
+				if t, err := a.openVMTunnel(user, vmID, name, service.Port, service.ReadyPath); err == nil {
+					t.setDatasource(uid)
+					result.Tunnel = t.snapshot().LocalAddr
+				}
+			}
+			results = append(results, result)
+			continue
+		}
+		if !vmServiceReady(ctx, client, service) {
+			results = append(results, sandboxDatasource{Service: name, Type: service.Datasource, Status: sandboxDatasourceUnavailable})
+			continue
+		}
+
+		spec := grafanaDatasourceSpec{UID: uid, Name: result.Name, Type: service.Datasource, Access: "proxy"}
+		if req.Mode == sandboxDatasourceModeTunnel {
+			t, err := a.openVMTunnel(user, vmID, name, service.Port, service.ReadyPath)
+			if err != nil {
+				logger.Error("Failed to open VM tunnel", "vmID", vmID, "service", name, "error", err)
+				a.writeError(w, "Failed to open a tunnel to "+name, http.StatusInternalServerError)
+				return
+			}
+			t.setDatasource(uid)
+			result.Tunnel = t.snapshot().LocalAddr
+			spec.URL = "http://" + result.Tunnel
+		} else {
+			proxyToken, err := a.issueVMProxyToken(vmProxyToken{User: user, VMID: vmID, Service: name, DatasourceUID: uid})
+			if err != nil {
+				logger.Error("Failed to issue VM proxy token", "vmID", vmID, "service", name, "error", err)
+				a.writeError(w, "Failed to store the data source's proxy token", http.StatusInternalServerError)
+				return
+			}
+			spec.URL = vmProxyURL(appURL, vmID, name)
+			spec.JSONData = map[string]interface{}{
+				"httpHeaderName1": "Authorization",
+				"httpHeaderName2": vmProxyTokenHeader,
+			}
+			if name == "prometheus" {
+				// The proxy only forwards GET.
+				spec.JSONData["httpMethod"] = http.MethodGet
+			}
+			spec.SecureJSONData = map[string]string{
+				"httpHeaderValue1": "Bearer " + saToken,
+				"httpHeaderValue2": proxyToken,
+			}
+		}
+		if err := api.CreateDatasource(ctx, spec); err != nil {
+			a.revokeVMProxyTokens(uid)
+			a.closeVMTunnels(func(t vmTunnelInfo) bool { return t.DatasourceUID == uid })
+			a.writeGrafanaActionError(w, r, "create the "+name+" data source", err)
+			return
+		}
+		a.trackGuideResource(ctx, guideResource{Kind: guideResourceDatasource, UID: uid, Title: result.Name, Guide: req.Guide, User: user})
+		a.recordAudit(logger, auditEntry{Actor: user, Action: "sandbox.datasource.create", Details: vmID + " " + name + " " + req.Mode + " " + uid})
+		result.Status = sandboxDatasourceCreated
+		results = append(results, result)
+	}
+	a.writeJSON(w, map[string]interface{}{"datasources": results}, http.StatusOK)
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdkconfig "github.com/grafana/grafana-plugin-sdk-go/config"
+)
+
+// newSandboxApp returns an app where ana has a terminal session to vm-1
+// whose Prometheus answers on port 9090.
+func newSandboxApp(t *testing.T) (*App, *http.ServeMux) {
+	t.Helper()
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/-/ready":
+			_, _ = io.WriteString(w, "Prometheus Server is Ready.\n")
+		case "/api/v1/query":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(prom.Close)
+	srv := newTestSSHServer(t)
+	srv.forwards = map[uint32]string{9090: prom.Listener.Addr().String()}
+	t.Cleanup(srv.close)
+	client := srv.dialClient(t)
+	t.Cleanup(func() { _ = client.Close() })
+
+	app := newTestApp(t)
+	app.streamSessions = map[string]*streamSession{
+		"terminal/vm-1/1": {vmID: "vm-1", userLogin: "ana", session: &TerminalSession{VMID: "vm-1", SSHClient: client}},
+	}
+	mux := http.NewServeMux()
+	app.registerRoutes(mux)
+	return app, mux
+}
+
+func withServiceAccount(r *http.Request) *http.Request {
+	cfg := sdkconfig.NewGrafanaCfg(map[string]string{
+		sdkconfig.AppURL:          "https://grafana.example.com/",
+		sdkconfig.AppClientSecret: "sa-token",
+	})
+	return r.WithContext(sdkconfig.WithGrafanaConfig(r.Context(), cfg))
+}
+
+func TestSandboxDatasources(t *testing.T) {
+	api := &fakeGrafanaAPI{}
+	useFakeGrafanaAPI(t, api)
+	app, mux := newSandboxApp(t)
+
+	body := `{"guide": "explore-101"}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, withServiceAccount(roleRequest(http.MethodPost, "/v1/vms/vm-1/datasources", body, "ana", "Editor")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct{ Datasources []sandboxDatasource }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, ds := range resp.Datasources {
+		statuses[ds.Service] = ds.Status
+	}
+	if statuses["prometheus"] != sandboxDatasourceCreated || statuses["loki"] != sandboxDatasourceUnavailable || statuses["tempo"] != sandboxDatasourceUnavailable {
+		t.Fatalf("statuses = %v", statuses)
+	}
+	uid := guideResourceUID(guideResourceDatasource, "vm-1/prometheus", "ana")
+	ds, ok := api.created[uid]
+	if !ok {
+		t.Fatalf("data source %s not created: %v", uid, api.created)
+	}
+	if ds.URL != "https://grafana.example.com/api/plugins/grafana-pathfinder-app/resources/v1/vms/vm-1/proxy/prometheus" {
+		t.Errorf("url = %s", ds.URL)
+	}
+	if ds.SecureJSONData["httpHeaderValue1"] != "Bearer sa-token" || ds.JSONData["httpMethod"] != http.MethodGet {
+		t.Errorf("data source auth/method: %v %v", ds.SecureJSONData["httpHeaderValue1"], ds.JSONData["httpMethod"])
+	}
+
+	// The data source's token reaches the VM as the plugin's service account.
+	token := ds.SecureJSONData["httpHeaderValue2"]
+	query := roleRequest(http.MethodGet, "/v1/vms/vm-1/proxy/prometheus/api/v1/query?query=up", "", "extsvc-grafana-pathfinder-app", "Viewer")
+	query.Header.Set(vmProxyTokenHeader, token)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, query)
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"success","data":{"resultType":"vector","result":[]}}` {
+		t.Fatalf("proxied query: status=%d body=%s", w.Code, w.Body.String())
+	}
+	query.Header.Set(vmProxyTokenHeader, token)
+	query.URL.Path = "/v1/vms/vm-1/proxy/loki/ready"
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, query)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("token used for another service: status=%d", w.Code)
+	}
+
+	// Repeating reports the existing data source; cleanup revokes its token.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withServiceAccount(roleRequest(http.MethodPost, "/v1/vms/vm-1/datasources", `{"services": ["prometheus"]}`, "ana", "Editor")))
+	if !json.Valid(w.Body.Bytes()) || len(api.created) != 1 {
+		t.Errorf("repeat created %d data sources", len(api.created))
+	}
+	cleanup(t, mux, `{"guide": "explore-101"}`, "ana")
+	if len(app.store.keys(vmProxyTokenCollection)) != 0 {
+		t.Error("proxy token survived cleanup")
+	}
+}
+
+func TestVMProxy(t *testing.T) {
+	_, mux := newSandboxApp(t)
+
+	for _, tc := range []struct {
+		method, target, user string
+		want                 int
+	}{
+		{http.MethodGet, "/v1/vms/vm-1/proxy/prometheus/api/v1/query?query=up", "ana", http.StatusOK},
+		{http.MethodGet, "/v1/vms/vm-1/proxy/prometheus/api/v1/query?query=up", "bo", http.StatusServiceUnavailable},
+		{http.MethodGet, "/v1/vms/vm-1/proxy/loki/ready", "ana", http.StatusBadGateway},
+		{http.MethodGet, "/v1/vms/vm-1/proxy/mysql/", "ana", http.StatusNotFound},
+		{http.MethodPost, "/v1/vms/vm-1/proxy/prometheus/api/v1/admin/tsdb/delete_series", "ana", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(tc.method, tc.target, "", tc.user, "Viewer"))
+		if w.Code != tc.want {
+			t.Errorf("%s %s as %s: status=%d, want %d", tc.method, tc.target, tc.user, w.Code, tc.want)
+		}
+	}
+
+	r := roleRequest(http.MethodGet, "/v1/vms/vm-1/proxy/prometheus/api/v1/query", "", "ana", "Viewer")
+	r.Header.Set(vmProxyTokenHeader, "forged")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("forged token: status=%d", w.Code)
+	}
+}
@@ -0,0 +1,440 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"golang.org/x/crypto/ssh"
+)
+
+// Curated script library.
+//
+// Admins publish named, versioned setup/teardown scripts alongside custom
+// guides, and guides run them by name instead of pasting the same lab setup
+// inline. Scripts live in the plugin store; every publish under an existing
+// name adds a new version, and older versions stay runnable so a guide can pin
+// one.
+//
+//	GET    /scripts                     latest version of every script
+//	POST   /scripts                     publish a new version (admin)
+//	GET    /scripts/{name}?version=N    one version (latest when omitted)
+//	DELETE /scripts/{name}              remove every version (admin)
+//	GET    /script-runs                 the caller's recent run results
+//
+// A script runs over Grafana Live on the caller's own terminal session:
+//
+//	script/{vmId}/{name}/{version|latest}[/{nonce}]
+//
+// Output is streamed as "output" frames and the run ends with a "status"
+// frame whose state is the result. Each run is recorded in the store.
+
+const (
+	scriptCollection    = "scripts"
+	scriptRunCollection = "script-runs"
+
+	scriptChannelPrefix = "script"
+
+	scriptMaxBytes = 64 * 1024
+	// scriptRunOutputTail is how much trailing output a run record keeps.
+	scriptRunOutputTail = 4 * 1024
+	// maxUserScriptRuns caps the run history kept per user.
+	maxUserScriptRuns = 50
+)
+
+var errScriptNotFound = errors.New("script not found")
+
+// libraryScript is one published version of a script.
+type libraryScript struct {
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	Kind        string    `json:"kind"` // "setup" or "teardown"
+	Description string    `json:"description,omitempty"`
+	Content     string    `json:"content"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// scriptRun is the recorded result of one script execution.
+type scriptRun struct {
+	ID         string    `json:"id"`
+	Script     string    `json:"script"`
+	Version    int       `json:"version"`
+	VMID       string    `json:"vmId"`
+	User       string    `json:"user"`
+	Status     string    `json:"status"` // "succeeded", "failed", "cancelled"
+	ExitCode   int       `json:"exitCode"`
+	Output     string    `json:"output,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// PublishScriptRequest is the JSON body for POST /scripts.
+type PublishScriptRequest struct {
+	Name        string `json:"name" validate:"required,pattern=name"`
+	Kind        string `json:"kind" validate:"required,oneof=setup teardown"`
+	Description string `json:"description,omitempty" validate:"max=500"`
+	Content     string `json:"content" validate:"required"`
+}
+
+// scriptKey zero-pads the version so store keys sort by version.
+func scriptKey(name string, version int) string {
+	return fmt.Sprintf("%s/%06d", name, version)
+}
+
+// scriptVersions returns every stored version of name, oldest first.
+func (a *App) scriptVersions(name string) []libraryScript {
+	prefix := name + "/"
+	result := []libraryScript{}
+	for _, key := range a.store.keys(scriptCollection) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var s libraryScript
+		if ok, err := a.store.get(scriptCollection, key, &s); err != nil || !ok {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// getScript loads one version of name; version 0 means the latest.
+func (a *App) getScript(name string, version int) (*libraryScript, error) {
+	if version == 0 {
+		versions := a.scriptVersions(name)
+		if len(versions) == 0 {
+			return nil, errScriptNotFound
+		}
+		return &versions[len(versions)-1], nil
+	}
+	var s libraryScript
+	ok, err := a.store.get(scriptCollection, scriptKey(name, version), &s)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errScriptNotFound
+	}
+	return &s, nil
+}
+
+// listLatestScripts returns the latest version of every script, sorted by name.
+func (a *App) listLatestScripts() []libraryScript {
+	latest := map[string]libraryScript{}
+	for _, key := range a.store.keys(scriptCollection) {
+		var s libraryScript
+		if ok, err := a.store.get(scriptCollection, key, &s); err != nil || !ok {
+			continue
+		}
+		latest[s.Name] = s
+	}
+	result := make([]libraryScript, 0, len(latest))
+	for _, s := range latest {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// handleScripts handles GET /scripts (list) and POST /scripts (publish).
+func (a *App) handleScripts(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"scripts": a.listLatestScripts()}, http.StatusOK)
+	case http.MethodPost:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can publish scripts", http.StatusForbidden)
+			return
+		}
+		a.handlePublishScript(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handlePublishScript(w http.ResponseWriter, r *http.Request, user string) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*scriptMaxBytes+1024)
+	var req PublishScriptRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Content) > scriptMaxBytes {
+		a.writeError(w, fmt.Sprintf("Script too large (max %d bytes)", scriptMaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	a.scriptsMu.Lock()
+	defer a.scriptsMu.Unlock()
+	version := 1
+	if versions := a.scriptVersions(req.Name); len(versions) > 0 {
+		version = versions[len(versions)-1].Version + 1
+	}
+	s := libraryScript{
+		Name:        req.Name,
+		Version:     version,
+		Kind:        req.Kind,
+		Description: req.Description,
+		Content:     req.Content,
+		CreatedBy:   user,
+		CreatedAt:   timeNow().UTC(),
+	}
+	if err := a.store.put(scriptCollection, scriptKey(s.Name, s.Version), s); err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to persist script", "script", s.Name, "version", s.Version, "error", err)
+		a.writeError(w, "Failed to save script", http.StatusInternalServerError)
+		return
+	}
+	a.ctxLogger(r.Context()).Info("Published script", "script", s.Name, "version", s.Version, "user", user)
+	a.writeJSON(w, s, http.StatusCreated)
+}
+
+// handleScriptByName handles GET/DELETE /scripts/{name}.
+func (a *App) handleScriptByName(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/scripts/")
+	if name == "" || strings.Contains(name, "/") {
+		a.writeError(w, "Script name required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		version := 0
+		if v := r.URL.Query().Get("version"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				a.writeError(w, "version must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			version = n
+		}
+		s, err := a.getScript(name, version)
+		if errors.Is(err, errScriptNotFound) {
+			a.writeError(w, "Script not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			a.writeError(w, "Failed to load script", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, s, http.StatusOK)
+	case http.MethodDelete:
+		if !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only admins can delete scripts", http.StatusForbidden)
+			return
+		}
+		a.scriptsMu.Lock()
+		defer a.scriptsMu.Unlock()
+		versions := a.scriptVersions(name)
+		if len(versions) == 0 {
+			a.writeError(w, "Script not found", http.StatusNotFound)
+			return
+		}
+		for _, s := range versions {
+			if err := a.store.delete(scriptCollection, scriptKey(s.Name, s.Version)); err != nil {
+				a.ctxLogger(r.Context()).Error("Failed to delete script", "script", name, "version", s.Version, "error", err)
+				a.writeError(w, "Failed to delete script", http.StatusInternalServerError)
+				return
+			}
+		}
+		a.ctxLogger(r.Context()).Info("Deleted script", "script", name, "versions", len(versions), "user", user)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScriptRuns handles GET /script-runs, newest first.
+func (a *App) handleScriptRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	runs := a.listScriptRuns(user)
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	a.writeJSON(w, map[string]interface{}{"runs": runs}, http.StatusOK)
+}
+
+// listScriptRuns returns user's recorded runs, oldest first.
+func (a *App) listScriptRuns(user string) []scriptRun {
+	prefix := user + "/"
+	result := []scriptRun{}
+	for _, key := range a.store.keys(scriptRunCollection) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var run scriptRun
+		if ok, err := a.store.get(scriptRunCollection, key, &run); err != nil || !ok {
+			continue
+		}
+		result = append(result, run)
+	}
+	return result
+}
+
+// recordScriptRun stores run and drops the user's oldest runs beyond
+// maxUserScriptRuns.
+func (a *App) recordScriptRun(run scriptRun) error {
+	if err := a.store.put(scriptRunCollection, run.User+"/"+run.ID, run); err != nil {
+		return err
+	}
+	prefix := run.User + "/"
+	var keys []string
+	for _, key := range a.store.keys(scriptRunCollection) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for len(keys) > maxUserScriptRuns {
+		if err := a.store.delete(scriptRunCollection, keys[0]); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// parseScriptChannel extracts the VM ID, script name and version (0 for
+// latest) from a script/{vmId}/{name}/{version|latest}[/{nonce}] channel path.
+func parseScriptChannel(channelPath string) (vmID, name string, version int, err error) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) < 4 || len(parts) > 5 || parts[0] != scriptChannelPrefix || parts[1] == "" {
+		return "", "", 0, fmt.Errorf("invalid script channel: %s", channelPath)
+	}
+	if !workspaceNamePattern.MatchString(parts[2]) {
+		return "", "", 0, fmt.Errorf("invalid script name: %q", parts[2])
+	}
+	if parts[3] != "latest" {
+		version, err = strconv.Atoi(parts[3])
+		if err != nil || version <= 0 {
+			return "", "", 0, fmt.Errorf("invalid script version: %q", parts[3])
+		}
+	}
+	return parts[1], parts[2], version, nil
+}
+
+// scriptCommand runs content under bash with stderr folded into the streamed
+// output.
+func scriptCommand(content string) string {
+	return "bash -c " + shellSingleQuote(content) + " 2>&1"
+}
+
+// subscribeScriptStream authorizes a script channel subscription.
+func (a *App) subscribeScriptStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+
+	vmID, name, version, err := parseScriptChannel(req.Path)
+	if err != nil {
+		ctxLogger.Warn("Rejecting script subscription", "path", req.Path, "error", err)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if _, err := a.getScript(name, version); err != nil {
+		ctxLogger.Warn("Rejecting script subscription", "path", req.Path, "error", err)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	if user == "" || a.findSSHClientForUserVM(user, vmID) == nil {
+		ctxLogger.Info("Rejecting script subscription without an active terminal session", "vmID", vmID, "user", user)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+
+	ctxLogger.Info("Script subscription accepted", "vmID", vmID, "script", name, "version", version, "user", user)
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runScriptStream executes the channel's script once, streams its output and
+// records the result.
+func (a *App) runScriptStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	ctxLogger := a.ctxLogger(ctx)
+
+	vmID, name, version, err := parseScriptChannel(req.Path)
+	if err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return err
+	}
+	script, err := a.getScript(name, version)
+	if err != nil {
+		sendStreamError(ctx, sender, fmt.Sprintf("Script %s: %v", name, err))
+		return err
+	}
+
+	user := pluginUserLogin(req.PluginContext)
+	client := a.findSSHClientForUserVM(user, vmID)
+	if client == nil {
+		errMsg := "No active terminal session for this VM"
+		sendStreamError(ctx, sender, errMsg)
+		return errors.New(errMsg)
+	}
+
+	run := scriptRun{
+		Script:    script.Name,
+		Version:   script.Version,
+		VMID:      vmID,
+		User:      user,
+		StartedAt: timeNow().UTC(),
+	}
+	run.ID = fmt.Sprintf("%020d", run.StartedAt.UnixNano())
+
+	var tail []byte
+	ctxLogger.Info("Script run started", "vmID", vmID, "script", script.Name, "version", script.Version, "user", user)
+	runErr := a.streamRemoteCommand(ctx, sender, client, vmID, scriptCommand(script.Content), func(p []byte) {
+		tail = append(tail, p...)
+		if len(tail) > scriptRunOutputTail {
+			tail = tail[len(tail)-scriptRunOutputTail:]
+		}
+	})
+
+	run.FinishedAt = timeNow().UTC()
+	run.Output = string(tail)
+	var exitErr *ssh.ExitError
+	switch {
+	case ctx.Err() != nil:
+		run.Status, run.ExitCode = "cancelled", -1
+	case runErr == nil:
+		run.Status = "succeeded"
+	case errors.As(runErr, &exitErr):
+		run.Status, run.ExitCode = "failed", exitErr.ExitStatus()
+	default:
+		run.Status, run.ExitCode = "failed", -1
+	}
+
+	if err := a.recordScriptRun(run); err != nil {
+		ctxLogger.Error("Failed to record script run", "script", script.Name, "error", err)
+	}
+	ctxLogger.Info("Script run finished", "vmID", vmID, "script", script.Name, "version", script.Version, "status", run.Status, "exitCode", run.ExitCode)
+	if ctx.Err() == nil {
+		sendStreamMessage(sender, TerminalStreamOutput{
+			Type:    "status",
+			State:   run.Status,
+			Message: fmt.Sprintf("Script %s v%d exited with code %d", script.Name, script.Version, run.ExitCode),
+			VmId:    vmID,
+		})
+	}
+	return nil
+}
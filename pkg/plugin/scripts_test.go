@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseScriptChannel(t *testing.T) {
+	vmID, name, version, err := parseScriptChannel("script/vm-1/install-alloy/3/abc")
+	if err != nil || vmID != "vm-1" || name != "install-alloy" || version != 3 {
+		t.Fatalf("got %q %q %d %v", vmID, name, version, err)
+	}
+	if _, _, version, err := parseScriptChannel("script/vm-1/install-alloy/latest"); err != nil || version != 0 {
+		t.Errorf("latest: version=%d err=%v", version, err)
+	}
+	for _, p := range []string{"script/vm-1/x", "script//x/1", "script/vm-1/Bad Name/1", "script/vm-1/x/0", "script/vm-1/x/1/n/extra"} {
+		if _, _, _, err := parseScriptChannel(p); err == nil {
+			t.Errorf("parseScriptChannel(%q) should fail", p)
+		}
+	}
+}
+
+func TestHandleScripts_PublishRequiresAdmin(t *testing.T) {
+	app := newTestApp(t)
+	body := `{"name":"install-alloy","kind":"setup","content":"echo hi"}`
+
+	rr := httptest.NewRecorder()
+	app.handleScripts(rr, roleRequest(http.MethodPost, "/scripts", body, "alice", "Editor"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("editor publish: got %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleScripts(rr, roleRequest(http.MethodPost, "/scripts", body, "admin", "Admin"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("admin publish: got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleScriptByName(rr, roleRequest(http.MethodDelete, "/scripts/install-alloy", "", "alice", "Viewer"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("viewer delete: got %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandleScripts_Versioning(t *testing.T) {
+	app := newTestApp(t)
+	for _, content := range []string{"echo v1", "echo v2"} {
+		rr := httptest.NewRecorder()
+		body := `{"name":"install-alloy","kind":"setup","content":"` + content + `"}`
+		app.handleScripts(rr, roleRequest(http.MethodPost, "/scripts", body, "admin", "Admin"))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("publish: got %d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	app.handleScripts(rr, roleRequest(http.MethodGet, "/scripts", "", "alice", "Viewer"))
+	var list struct {
+		Scripts []libraryScript `json:"scripts"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Scripts) != 1 || list.Scripts[0].Version != 2 || list.Scripts[0].Content != "echo v2" {
+		t.Errorf("list = %+v, want only the latest version", list.Scripts)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleScriptByName(rr, roleRequest(http.MethodGet, "/scripts/install-alloy?version=1", "", "alice", "Viewer"))
+	var v1 libraryScript
+	_ = json.Unmarshal(rr.Body.Bytes(), &v1)
+	if rr.Code != http.StatusOK || v1.Content != "echo v1" || v1.CreatedBy != "admin" {
+		t.Errorf("get v1: code=%d script=%+v", rr.Code, v1)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleScriptByName(rr, roleRequest(http.MethodDelete, "/scripts/install-alloy", "", "admin", "Admin"))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	app.handleScriptByName(rr, roleRequest(http.MethodGet, "/scripts/install-alloy?version=1", "", "alice", "Viewer"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleScripts_ConcurrentPublish(t *testing.T) {
+	app := newTestApp(t)
+	const publishes = 8
+	var wg sync.WaitGroup
+	for i := range publishes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			body := fmt.Sprintf(`{"name":"install-alloy","kind":"setup","content":"echo %d"}`, i)
+			app.handleScripts(rr, roleRequest(http.MethodPost, "/scripts", body, "admin", "Admin"))
+			if rr.Code != http.StatusCreated {
+				t.Errorf("publish: got %d body=%s", rr.Code, rr.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	versions := app.scriptVersions("install-alloy")
+	if len(versions) != publishes {
+		t.Fatalf("got %d versions, want %d", len(versions), publishes)
+	}
+	for i, s := range versions {
+		if s.Version != i+1 {
+			t.Errorf("versions[%d] = %d, want %d", i, s.Version, i+1)
+		}
+	}
+}
+
+func TestHandleScripts_Validation(t *testing.T) {
+	app := newTestApp(t)
+	bodies := []string{
+		`not json`,
+		`{"name":"Bad Name","kind":"setup","content":"x"}`,
+		`{"name":"ok","kind":"cleanup","content":"x"}`,
+		`{"name":"ok","kind":"setup","content":"  "}`,
+	}
+	for _, body := range bodies {
+		rr := httptest.NewRecorder()
+		app.handleScripts(rr, roleRequest(http.MethodPost, "/scripts", body, "admin", "Admin"))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("body %s: got %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	big := `{"name":"ok","kind":"setup","content":"` + strings.Repeat("a", scriptMaxBytes+1) + `"}`
+	rr := httptest.NewRecorder()
+	app.handleScripts(rr, roleRequest(http.MethodPost, "/scripts", big, "admin", "Admin"))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized: got %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestRecordScriptRun_Prunes(t *testing.T) {
+	app := newTestApp(t)
+	for i := 0; i < maxUserScriptRuns+5; i++ {
+		run := scriptRun{ID: time.Unix(int64(i), 0).Format("20060102150405"), User: "alice", Script: "s"}
+		if err := app.recordScriptRun(run); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	runs := app.listScriptRuns("alice")
+	if len(runs) != maxUserScriptRuns {
+		t.Fatalf("kept %d runs, want %d", len(runs), maxUserScriptRuns)
+	}
+	if runs[0].ID != time.Unix(5, 0).Format("20060102150405") {
+		t.Errorf("oldest kept run = %s, want the sixth", runs[0].ID)
+	}
+}
+
+func TestRunScriptStream(t *testing.T) {
+	srv := newTestSSHServer(t)
+	defer srv.close()
+	var gotCmd string
+	srv.handler = func(cmd string) (string, string, int, time.Duration) {
+		gotCmd = cmd
+		return "installing alloy\n", "", 3, 0
+	}
+
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newTestApp(t)
+	app.streamSessions = map[string]*streamSession{
+		"terminal/vm-1": {
+			vmID:      "vm-1",
+			userLogin: "alice",
+			session:   &TerminalSession{VMID: "vm-1", SSHClient: client},
+		},
+	}
+	_ = app.store.put(scriptCollection, scriptKey("install-alloy", 1), libraryScript{Name: "install-alloy", Version: 1, Kind: "setup", Content: "apt-get install alloy"})
+
+	rec, sender := newStreamRecorder(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := app.RunStream(ctx, &backend.RunStreamRequest{
+		Path:          "script/vm-1/install-alloy/latest/n1",
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "alice"}},
+	}, sender)
+	if err != nil {
+		t.Fatalf("RunStream: %v", err)
+	}
+	if want := "bash -c 'apt-get install alloy' 2>&1"; gotCmd != want {
+		t.Errorf("remote command = %q, want %q", gotCmd, want)
+	}
+	if out := rec.ofType("output"); len(out) == 0 || out[0].Data != "installing alloy\n" {
+		t.Errorf("output messages = %+v", out)
+	}
+	if st := rec.ofType("status"); len(st) != 1 || st[0].State != "failed" {
+		t.Errorf("status messages = %+v, want one failed result", st)
+	}
+
+	runs := app.listScriptRuns("alice")
+	if len(runs) != 1 {
+		t.Fatalf("recorded %d runs, want 1", len(runs))
+	}
+	if r := runs[0]; r.Status != "failed" || r.ExitCode != 3 || r.Version != 1 || r.Output != "installing alloy\n" {
+		t.Errorf("run = %+v", r)
+	}
+
+	// Another user cannot subscribe against alice's VM.
+	resp, _ := app.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
+		Path:          "script/vm-1/install-alloy/latest/n2",
+		PluginContext: backend.PluginContext{User: &backend.User{Login: "bob"}},
+	})
+	if resp.Status != backend.SubscribeStreamStatusPermissionDenied {
+		t.Errorf("bob subscribe: got %v, want permission denied", resp.Status)
+	}
+}
@@ -0,0 +1,453 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Selector health.
+//
+// Interactive steps point at Grafana pages and data-testid selectors that
+// change between Grafana versions. The monitored guides are pushed with PUT
+// /admin/selector-health/guides: bundled guides only exist in the frontend,
+// and custom guides can only be read with a user's identity, so the
+// frontend or a content repository's CI sends them. Only their targets are
+// kept. A job checks them every selectorHealthIntervalHours (24 by
+// default) against a target manifest for the running Grafana version: the
+// built-in one, made from the linter's moved pages, extended by the
+// maintained manifest at selectorManifestUrl if set. Targets the manifest
+// doesn't know are counted as unverified. Admins read the last report with
+// GET /admin/selector-health and check now with POST.
+
+const (
+	selectorGuideCollection     = "selector-guides"
+	selectorHealthCollection    = "selector-health"
+	selectorHealthReportKey     = "report"
+	maxSelectorGuides           = 2000
+	selectorHealthCheckInterval = time.Hour
+	defaultSelectorHealthHours  = 24
+	selectorManifestTimeout     = 10 * time.Second
+	maxSelectorManifestBytes    = 5 << 20
+	selectorTargetPath          = "path"
+	selectorTargetTestID        = "testid"
+	selectorManifestBuiltin     = "builtin"
+	selectorManifestRemote      = "remote"
+	selectorGuideSourceBundled  = "bundled"
+	selectorGuideSourceCustom   = "custom"
+)
+
+var testIDPattern = regexp.MustCompile(`data-testid\s*=\s*['"]([^'"]+)['"]`)
+
+// selectorTarget is a manifest entry: a Grafana page path or data-testid
+// and the versions that have it. Removed means no supported version does.
+type selectorTarget struct {
+	Kind        string `json:"kind"`
+	Value       string `json:"value"`
+	AddedIn     string `json:"addedIn,omitempty"`
+	RemovedIn   string `json:"removedIn,omitempty"`
+	Removed     bool   `json:"removed,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// selectorManifest is the format served at selectorManifestUrl.
+type selectorManifest struct {
+	Version string           `json:"version,omitempty"`
+	Targets []selectorTarget `json:"targets"`
+}
+
+// builtinSelectorManifest returns the manifest entries the plugin ships.
+func builtinSelectorManifest() selectorManifest {
+	m := selectorManifest{}
+	for _, item := range movedNavItems {
+		m.Targets = append(m.Targets, selectorTarget{Kind: selectorTargetPath, Value: item.Path, Removed: true, Replacement: item.Replacement})
+	}
+	return m
+}
+
+// selectorRef is a target a guide step uses; Path locates the step.
+type selectorRef struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// selectorGuide is a monitored guide's targets.
+type selectorGuide struct {
+	ID        string        `json:"id"`
+	Title     string        `json:"title,omitempty"`
+	Source    string        `json:"source,omitempty"`
+	Targets   []selectorRef `json:"targets"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// SelectorHealthGuide is one guide in PUT /admin/selector-health/guides.
+type SelectorHealthGuide struct {
+	ID     string      `json:"id"`
+	Title  string      `json:"title"`
+	Source string      `json:"source"`
+	Blocks []lintBlock `json:"blocks"`
+}
+
+// SelectorHealthGuidesRequest is the JSON body for PUT
+// /admin/selector-health/guides; it replaces the monitored guides.
+type SelectorHealthGuidesRequest struct {
+	Guides []SelectorHealthGuide `json:"guides" validate:"max=2000"`
+}
+
+// selectorFailure is a target that doesn't exist in the checked version.
+type selectorFailure struct {
+	selectorRef
+	Reason      string `json:"reason"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+type selectorGuideHealth struct {
+	GuideID    string            `json:"guideId"`
+	Title      string            `json:"title,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Targets    int               `json:"targets"`
+	Unverified int               `json:"unverified"`
+	Failures   []selectorFailure `json:"failures"`
+}
+
+// selectorHealthReport is the result of a check. GrafanaVersion is empty
+// when it couldn't be found, in which case only removed targets fail.
+type selectorHealthReport struct {
+	CheckedAt       time.Time             `json:"checkedAt"`
+	GrafanaVersion  string                `json:"grafanaVersion,omitempty"`
+	Manifest        string                `json:"manifest"`
+	ManifestVersion string                `json:"manifestVersion,omitempty"`
+	Guides          int                   `json:"guides"`
+	Targets         int                   `json:"targets"`
+	Unverified      int                   `json:"unverified"`
+	FailingGuides   []selectorGuideHealth `json:"failingGuides"`
+}
+
+// guideSelectorRefs returns the page paths and data-testid selectors in
+// blocks, in document order.
+func guideSelectorRefs(blocks []lintBlock, path string) []selectorRef {
+	var refs []selectorRef
+	for i, b := range blocks {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		for _, ref := range navRefs(b) {
+			if page := navPath(ref); strings.HasPrefix(page, "/") {
+				refs = append(refs, selectorRef{Path: p, Kind: selectorTargetPath, Value: page})
+			}
+		}
+		target := b.Reftarget
+		if target == "" {
+			target = b.RefTarget
+		}
+		for _, m := range testIDPattern.FindAllStringSubmatch(target, -1) {
+			refs = append(refs, selectorRef{Path: p, Kind: selectorTargetTestID, Value: m[1]})
+		}
+		refs = append(refs, guideSelectorRefs(b.Blocks, p+".blocks")...)
+		refs = append(refs, guideSelectorRefs(b.Steps, p+".steps")...)
+		refs = append(refs, guideSelectorRefs(b.WhenTrue, p+".whenTrue")...)
+		refs = append(refs, guideSelectorRefs(b.WhenFalse, p+".whenFalse")...)
+	}
+	return refs
+}
+
+// navPath strips the query and fragment from a page reference.
+func navPath(ref string) string {
+	path, _, _ := strings.Cut(strings.TrimSpace(ref), "?")
+	path, _, _ = strings.Cut(path, "#")
+	return path
+}
+
+// lookup returns the manifest entry for ref: the exact data-testid, or the
+// longest path that is ref's page or a parent of it.
+func (m selectorManifest) lookup(ref selectorRef) (selectorTarget, bool) {
+	var best selectorTarget
+	found := false
+	for _, t := range m.Targets {
+		if t.Kind != ref.Kind {
+			continue
+		}
+		match := t.Value == ref.Value
+		if t.Kind == selectorTargetPath && !match {
+			match = strings.HasPrefix(ref.Value, strings.TrimSuffix(t.Value, "/")+"/")
+		}
+		if match && (!found || len(t.Value) > len(best.Value)) {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
+
+// missingReason returns why t doesn't exist in version, "" if it does, or
+// ok false when that depends on a version that isn't known.
+func (t selectorTarget) missingReason(version string) (reason string, ok bool) {
+	if t.Removed {
+		return "Removed from Grafana", true
+	}
+	if t.AddedIn == "" && t.RemovedIn == "" {
+		return "", true
+	}
+	v, known := parseVersion(version)
+	if !known {
+		return "", false
+	}
+	if added, valid := parseVersion(t.AddedIn); valid && t.AddedIn != "" && compareVersions(v, added) < 0 {
+		return "Added in Grafana " + t.AddedIn, true
+	}
+	if removed, valid := parseVersion(t.RemovedIn); valid && t.RemovedIn != "" && compareVersions(v, removed) >= 0 {
+		return "Removed in Grafana " + t.RemovedIn, true
+	}
+	return "", true
+}
+
+// selectorManifest returns the built-in manifest, extended by the one at
+// Settings.SelectorManifestURL, or its mirror, when that loads; remote
+// entries replace built-in ones for the same target.
+func (a *App) selectorManifest(ctx context.Context, logger log.Logger) (selectorManifest, string) {
+	m := builtinSelectorManifest()
+	manifestURL := a.selectorManifestURL()
+	if manifestURL == "" {
+		return m, selectorManifestBuiltin
+	}
+	remote, err := fetchSelectorManifest(ctx, manifestURL)
+	if err != nil {
+		logger.Warn("Failed to load the selector manifest, using the built-in one", "url", manifestURL, "error", err)
+		return m, selectorManifestBuiltin
+	}
+	seen := map[string]bool{}
+	for _, t := range remote.Targets {
+		seen[t.Kind+"\x00"+t.Value] = true
+	}
+	for _, t := range m.Targets {
+		if !seen[t.Kind+"\x00"+t.Value] {
+			remote.Targets = append(remote.Targets, t)
+		}
+	}
+	return remote, selectorManifestRemote
+}
+
+func fetchSelectorManifest(ctx context.Context, url string) (selectorManifest, error) {
+	ctx, cancel := context.WithTimeout(ctx, selectorManifestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return selectorManifest{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return selectorManifest{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return selectorManifest{}, fmt.Errorf("manifest returned %d", resp.StatusCode)
+	}
+	var m selectorManifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSelectorManifestBytes)).Decode(&m); err != nil {
+		return selectorManifest{}, fmt.Errorf("decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+// selectorGuides returns the monitored guides, by ID.
+func (a *App) selectorGuides() []selectorGuide {
+	guides := []selectorGuide{}
+	for _, key := range a.store.keys(selectorGuideCollection) {
+		var g selectorGuide
+		if ok, err := a.store.get(selectorGuideCollection, key, &g); err == nil && ok {
+			guides = append(guides, g)
+		}
+	}
+	sort.Slice(guides, func(i, j int) bool { return guides[i].ID < guides[j].ID })
+	return guides
+}
+
+// checkSelectorHealth checks the monitored guides against version and
+// stores the report.
+func (a *App) checkSelectorHealth(ctx context.Context, logger log.Logger, version string) (selectorHealthReport, error) {
+	manifest, source := a.selectorManifest(ctx, logger)
+	report := selectorHealthReport{
+		CheckedAt:       timeNow().UTC(),
+		GrafanaVersion:  version,
+		Manifest:        source,
+		ManifestVersion: manifest.Version,
+		FailingGuides:   []selectorGuideHealth{},
+	}
+	for _, g := range a.selectorGuides() {
+		health := selectorGuideHealth{GuideID: g.ID, Title: g.Title, Source: g.Source, Targets: len(g.Targets), Failures: []selectorFailure{}}
+		for _, ref := range g.Targets {
+			target, found := manifest.lookup(ref)
+			if !found {
+				health.Unverified++
+				continue
+			}
+			reason, ok := target.missingReason(version)
+			if !ok {
+				health.Unverified++
+			} else if reason != "" {
+				health.Failures = append(health.Failures, selectorFailure{selectorRef: ref, Reason: reason, Replacement: target.Replacement})
+			}
+		}
+		report.Guides++
+		report.Targets += health.Targets
+		report.Unverified += health.Unverified
+		if len(health.Failures) > 0 {
+			report.FailingGuides = append(report.FailingGuides, health)
+		}
+	}
+	if err := a.store.put(selectorHealthCollection, selectorHealthReportKey, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// selectorHealthInterval returns how often the job checks the guides.
+func (a *App) selectorHealthInterval() time.Duration {
+	hours := defaultSelectorHealthHours
+	if a.settings != nil && a.settings.SelectorHealthIntervalHours > 0 {
+		hours = a.settings.SelectorHealthIntervalHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// runDueSelectorHealth checks the guides if the last report is older than
+// the interval, with the Grafana version from the plugin's service account.
+func (a *App) runDueSelectorHealth(logger log.Logger) {
+	if len(a.store.keys(selectorGuideCollection)) == 0 {
+		return
+	}
+	var last selectorHealthReport
+	if ok, err := a.store.get(selectorHealthCollection, selectorHealthReportKey, &last); err == nil && ok && timeNow().Sub(last.CheckedAt) < a.selectorHealthInterval() {
+		return
+	}
+	ctx := a.grafanaConfigContext(context.Background())
+	version := ""
+	if api, err := resolveGrafanaAPI(ctx); err == nil {
+		if version, err = api.Version(ctx); err != nil {
+			logger.Warn("Failed to read the Grafana version for the selector health check", "error", err)
+		}
+	}
+	report, err := a.checkSelectorHealth(ctx, logger, version)
+	if err != nil {
+		logger.Error("Failed to store the selector health report", "error", err)
+		return
+	}
+	if len(report.FailingGuides) > 0 {
+		logger.Warn("Guides reference Grafana targets that don't exist", "failingGuides", len(report.FailingGuides), "grafanaVersion", version)
+	}
+}
+
+// startSelectorHealth checks for a due selector health run now and every
+// selectorHealthCheckInterval.
+func (a *App) startSelectorHealth() {
+	a.runScheduled(0, func(context.Context) time.Duration {
+		a.runDueSelectorHealth(a.logger)
+		return selectorHealthCheckInterval
+	})
+}
+
+// handleAdminSelectorHealth handles GET (the last report) and POST (check
+// now, against the caller's Grafana version) on /admin/selector-health, and
+// GET and PUT on /admin/selector-health/guides, for admins.
+func (a *App) handleAdminSelectorHealth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(ctx) {
+		a.writeError(w, "Only admins can manage selector health", http.StatusForbidden)
+		return
+	}
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/guides") {
+		a.handleSelectorHealthGuides(w, r, user)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var report selectorHealthReport
+		ok, err := a.store.get(selectorHealthCollection, selectorHealthReportKey, &report)
+		if err != nil {
+			a.ctxLogger(ctx).Error("Failed to load the selector health report", "error", err)
+			a.writeError(w, "Failed to load the report", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			a.writeError(w, "No selector health check has run yet", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, report, http.StatusOK)
+	case http.MethodPost:
+		version, _ := grafanaVersionFromContext(ctx)
+		report, err := a.checkSelectorHealth(ctx, a.ctxLogger(ctx), version)
+		if err != nil {
+			a.ctxLogger(ctx).Error("Failed to store the selector health report", "error", err)
+			a.writeError(w, "Failed to store the report", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, report, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleSelectorHealthGuides(w http.ResponseWriter, r *http.Request, user string) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"guides": a.selectorGuides()}, http.StatusOK)
+	case http.MethodPut:
+		var req SelectorHealthGuidesRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		now := timeNow().UTC()
+		guides := map[string]selectorGuide{}
+		for i, g := range req.Guides {
+			if !guideIDPattern.MatchString(g.ID) {
+				a.writeError(w, fmt.Sprintf("guides[%d].id must be 1-200 letters, digits, '.', '_', '=', or '-'", i), http.StatusBadRequest)
+				return
+			}
+			switch g.Source {
+			case selectorGuideSourceBundled, selectorGuideSourceCustom, "":
+			default:
+				a.writeError(w, fmt.Sprintf("guides[%d].source must be bundled or custom", i), http.StatusBadRequest)
+				return
+			}
+			guides[g.ID] = selectorGuide{ID: g.ID, Title: g.Title, Source: g.Source, Targets: guideSelectorRefs(g.Blocks, "blocks"), UpdatedAt: now}
+		}
+		if len(guides) > maxSelectorGuides {
+			a.writeError(w, fmt.Sprintf("At most %d guides can be monitored", maxSelectorGuides), http.StatusBadRequest)
+			return
+		}
+		var stale []string
+		for _, key := range a.store.keys(selectorGuideCollection) {
+			if _, ok := guides[key]; !ok {
+				stale = append(stale, key)
+			}
+		}
+		for id, g := range guides {
+			if err := a.store.put(selectorGuideCollection, id, g); err != nil {
+				a.ctxLogger(ctx).Error("Failed to store monitored guide", "guide", id, "error", err)
+				a.writeError(w, "Failed to store the guides", http.StatusInternalServerError)
+				return
+			}
+		}
+		if _, err := a.store.deleteKeys(selectorGuideCollection, stale); err != nil {
+			a.ctxLogger(ctx).Error("Failed to remove monitored guides", "error", err)
+			a.writeError(w, "Failed to store the guides", http.StatusInternalServerError)
+			return
+		}
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: user, Action: "selector-health.guides", Details: fmt.Sprintf("guides=%d", len(guides))})
+		a.writeJSON(w, map[string]interface{}{"guides": len(guides)}, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const selectorHealthGuides = `{"guides": [
+	{"id": "connect-prometheus", "title": "Connect Prometheus", "source": "bundled", "blocks": [
+		{"type": "interactive", "action": "navigate", "reftarget": "/datasources/new?type=prometheus"},
+		{"type": "multistep", "steps": [
+			{"action": "button", "reftarget": "button[data-testid='data-testid Nav toggle']"},
+			{"action": "highlight", "reftarget": "a[href='/explore']", "requirements": ["on-page:/explore"]}
+		]}
+	]},
+	{"id": "dashboards", "title": "Dashboards", "source": "custom", "blocks": [
+		{"type": "interactive", "action": "navigate", "reftarget": "/dashboards"}
+	]}
+]}`
+
+func TestSelectorHealth(t *testing.T) {
+	withFrozenTime(t, time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC))
+	manifest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "2026.05", "targets": [
+			{"kind": "testid", "value": "data-testid Nav toggle", "removedIn": "11.0.0", "replacement": "data-testid Nav menu"},
+			{"kind": "path", "value": "/explore", "addedIn": "7.0.0"},
+			{"kind": "path", "value": "/dashboards"}
+		]}`))
+	}))
+	defer manifest.Close()
+	app := newTestApp(t)
+	app.settings = &Settings{SelectorManifestURL: manifest.URL}
+
+	w := httptest.NewRecorder()
+	app.handleAdminSelectorHealth(w, roleRequest(http.MethodPut, "/admin/selector-health/guides", selectorHealthGuides, "ed", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("editor PUT: status %d, want 403", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.handleAdminSelectorHealth(w, roleRequest(http.MethodGet, "/admin/selector-health", "", "admin", "Admin"))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("GET before a check: status %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.handleAdminSelectorHealth(w, roleRequest(http.MethodPut, "/admin/selector-health/guides", selectorHealthGuides, "admin", "Admin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body)
+	}
+	guides := app.selectorGuides()
+	if len(guides) != 2 || len(guides[0].Targets) != 4 {
+		t.Fatalf("monitored guides = %+v", guides)
+	}
+
+	// Without a Grafana version only removed targets can fail.
+	w = httptest.NewRecorder()
+	app.handleAdminSelectorHealth(w, roleRequest(http.MethodPost, "/admin/selector-health", "", "admin", "Admin"))
+	var report selectorHealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Manifest != selectorManifestRemote || report.Guides != 2 || report.Targets != 5 || report.Unverified != 3 {
+		t.Errorf("unversioned report = %+v", report)
+	}
+	if len(report.FailingGuides) != 1 || len(report.FailingGuides[0].Failures) != 1 || report.FailingGuides[0].Failures[0].Replacement != "/connections/datasources" {
+		t.Errorf("unversioned failing guides = %+v", report.FailingGuides)
+	}
+
+	// The job skips a fresh report and checks again once it's stale, with
+	// the version from the Grafana API.
+	useFakeGrafanaAPI(t, &fakeGrafanaAPI{version: "11.3.0"})
+	app.runDueSelectorHealth(log.DefaultLogger)
+	_, _ = app.store.get(selectorHealthCollection, selectorHealthReportKey, &report)
+	if report.GrafanaVersion != "" {
+		t.Errorf("job ran on a fresh report: version %q", report.GrafanaVersion)
+	}
+	withFrozenTime(t, time.Date(2026, 6, 2, 10, 0, 0, 0, time.UTC))
+	app.runDueSelectorHealth(log.DefaultLogger)
+	w = httptest.NewRecorder()
+	app.handleAdminSelectorHealth(w, roleRequest(http.MethodGet, "/admin/selector-health", "", "admin", "Admin"))
+	report = selectorHealthReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.GrafanaVersion != "11.3.0" || report.Unverified != 0 || len(report.FailingGuides) != 1 {
+		t.Fatalf("versioned report = %+v", report)
+	}
+	failures := report.FailingGuides[0].Failures
+	if report.FailingGuides[0].GuideID != "connect-prometheus" || len(failures) != 2 || failures[1].Path != "blocks[1].steps[0]" || failures[1].Reason != "Removed in Grafana 11.0.0" {
+		t.Errorf("versioned failures = %+v", failures)
+	}
+
+	w = httptest.NewRecorder()
+	app.handleAdminSelectorHealth(w, roleRequest(http.MethodPut, "/admin/selector-health/guides", `{"guides": [{"id": "dashboards"}]}`, "admin", "Admin"))
+	if w.Code != http.StatusOK || len(app.selectorGuides()) != 1 {
+		t.Errorf("replace: status %d, guides %+v", w.Code, app.selectorGuides())
+	}
+}
+
+func TestSelectorManifest_FallsBackToBuiltin(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	app := newTestApp(t)
+	app.settings = &Settings{SelectorManifestURL: down.URL}
+	m, source := app.selectorManifest(t.Context(), log.DefaultLogger)
+	if source != selectorManifestBuiltin || len(m.Targets) != len(movedNavItems) {
+		t.Errorf("manifest = %s %+v", source, m)
+	}
+	if target, ok := m.lookup(selectorRef{Kind: selectorTargetPath, Value: "/datasources/edit/abc"}); !ok || target.Value != "/datasources" {
+		t.Errorf("lookup = %+v, %v", target, ok)
+	}
+}
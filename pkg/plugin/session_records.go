@@ -0,0 +1,245 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A session that ends normally deletes its record. One cut off by a restart
+// or a drain keeps it, and the next process treats its channel as resumable
+// and hands the VM back to its user.
+//
+// VM assignments don't expire: resolveVMForUser checks the VM with Coda
+// before using it, so a stale one costs a lookup, while one dropped by age
+// would strand a VM in long use.
+
+const (
+	userVMCollection        = "user-vms"
+	sessionRecordCollection = "sessions"
+	sessionRecordFlushEvery = 30 * time.Second
+	sessionRecordMaxAge     = 24 * time.Hour
+)
+
+// userVMRecord is a persisted userVMs entry.
+type userVMRecord struct {
+	VMID      string    `json:"vmId"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// sessionRecord is a terminal session's persisted metadata.
+type sessionRecord struct {
+	SessionID string    `json:"sessionId"`
+	UserLogin string    `json:"userLogin"`
+	VMID      string    `json:"vmId"`
+	Channel   string    `json:"channel"`
+	Nonce     string    `json:"nonce,omitempty"`
+	OutputSeq int64     `json:"outputSeq,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// resumableSessions are the sessions a previous process left, by channel.
+type resumableSessions struct {
+	mu       sync.Mutex
+	channels map[string]sessionRecord
+}
+
+// setUserVM assigns vmID to user.
+func (a *App) setUserVM(user, vmID string) {
+	a.userVMsMu.Lock()
+	a.userVMs[user] = vmID
+	a.userVMsMu.Unlock()
+	if a.store == nil {
+		return
+	}
+	if err := a.store.put(userVMCollection, user, userVMRecord{VMID: vmID, UpdatedAt: timeNow().UTC()}); err != nil {
+		a.logger.Warn("Failed to save VM assignment", "userLogin", user, "vmID", vmID, "error", err)
+	}
+}
+
+// forgetUserVM removes user's VM assignment, whatever it is.
+func (a *App) forgetUserVM(user string) {
+	a.userVMsMu.Lock()
+	delete(a.userVMs, user)
+	a.userVMsMu.Unlock()
+	if a.store == nil {
+		return
+	}
+	if err := a.store.delete(userVMCollection, user); err != nil {
+		a.logger.Warn("Failed to delete VM assignment", "userLogin", user, "error", err)
+	}
+}
+
+// channelNonce returns the nonce of a terminal/{vmId}/{nonce} channel.
+func channelNonce(channel string) string {
+	parts := strings.SplitN(channel, "/", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
+
+// saveSessionRecord writes sess's record with its current output seq.
+func (a *App) saveSessionRecord(sess *streamSession) {
+	if a.store == nil {
+		return
+	}
+	var seq int64
+	if sess.output != nil {
+		seq = sess.output.lastSeq()
+	}
+	rec := sessionRecord{
+		SessionID: sess.id,
+		UserLogin: sess.userLogin,
+		VMID:      sess.vmID,
+		Channel:   sess.channel,
+		Nonce:     channelNonce(sess.channel),
+		OutputSeq: seq,
+		StartedAt: sess.startedAt.UTC(),
+		UpdatedAt: timeNow().UTC(),
+	}
+	if err := a.store.put(sessionRecordCollection, sess.id, rec); err != nil {
+		a.logger.Warn("Failed to save session record", "sessionID", sess.id, "error", err)
+		return
+	}
+	sess.recordedSeq.Store(seq)
+}
+
+// saveSessionRecords writes the records of sessions.
+func (a *App) saveSessionRecords(sessions []*streamSession) {
+	for _, sess := range sessions {
+		a.saveSessionRecord(sess)
+	}
+}
+
+// endSessionRecord deletes the record of a session that ended, unless the
+// instance is draining, in which case it is kept for the next process.
+func (a *App) endSessionRecord(sess *streamSession) {
+	if a.drainStatus().Draining {
+		a.saveSessionRecord(sess)
+		return
+	}
+	if a.store == nil {
+		return
+	}
+	if err := a.store.delete(sessionRecordCollection, sess.id); err != nil {
+		a.logger.Warn("Failed to delete session record", "sessionID", sess.id, "error", err)
+	}
+}
+
+// flushSessionRecords rewrites the records of sessions whose output moved
+// since they were last written.
+func (a *App) flushSessionRecords() {
+	for _, sess := range a.connectedSessions() {
+		if sess.output != nil && sess.output.lastSeq() != sess.recordedSeq.Load() {
+			a.saveSessionRecord(sess)
+		}
+	}
+}
+
+// startSessionRecordFlush keeps session records' output seq current.
+func (a *App) startSessionRecordFlush() {
+	a.runEvery(sessionRecordFlushEvery, func(context.Context) {
+		a.flushSessionRecords()
+	})
+}
+
+// restoreSessionState loads VM assignments and the sessions the previous
+// process left, assigns those sessions' VMs to users that have none, and
+// returns how many sessions are resumable.
+func (a *App) restoreSessionState() int {
+	now := timeNow()
+	a.userVMsMu.Lock()
+	for _, user := range a.store.keys(userVMCollection) {
+		var rec userVMRecord
+		if ok, err := a.store.get(userVMCollection, user, &rec); ok && err == nil && rec.VMID != "" {
+			a.userVMs[user] = rec.VMID
+		}
+	}
+	a.userVMsMu.Unlock()
+
+	var stale []string
+	channels := map[string]sessionRecord{}
+	for _, id := range a.store.keys(sessionRecordCollection) {
+		var rec sessionRecord
+		if ok, err := a.store.get(sessionRecordCollection, id, &rec); !ok || err != nil || rec.Channel == "" || now.Sub(rec.UpdatedAt) > sessionRecordMaxAge {
+			stale = append(stale, id)
+			continue
+		}
+		if prev, ok := channels[rec.Channel]; ok {
+			if prev.UpdatedAt.After(rec.UpdatedAt) {
+				stale = append(stale, id)
+				continue
+			}
+			stale = append(stale, prev.SessionID)
+		}
+		channels[rec.Channel] = rec
+	}
+	if len(stale) > 0 {
+		_, _ = a.store.deleteKeys(sessionRecordCollection, stale)
+	}
+	a.userVMsMu.Lock()
+	for _, rec := range channels {
+		if _, ok := a.userVMs[rec.UserLogin]; !ok && rec.VMID != "" {
+			a.userVMs[rec.UserLogin] = rec.VMID
+		}
+	}
+	a.userVMsMu.Unlock()
+
+	a.resumable.mu.Lock()
+	a.resumable.channels = channels
+	a.resumable.mu.Unlock()
+	if len(channels) > 0 || len(a.userVMs) > 0 {
+		a.logger.Info("Restored session metadata", "vmAssignments", len(a.userVMs), "resumableSessions", len(channels))
+	}
+	return len(channels)
+}
+
+// takeResumable returns and forgets the session user left on channel before
+// the restart, deleting its record.
+func (a *App) takeResumable(channel, user string) (sessionRecord, bool) {
+	if a.store == nil {
+		return sessionRecord{}, false
+	}
+	a.resumable.mu.Lock()
+	rec, ok := a.resumable.channels[channel]
+	if ok && rec.UserLogin == user {
+		delete(a.resumable.channels, channel)
+	}
+	a.resumable.mu.Unlock()
+	if !ok || rec.UserLogin != user {
+		return sessionRecord{}, false
+	}
+	_ = a.store.delete(sessionRecordCollection, rec.SessionID)
+	return rec, true
+}
+
+// resumableCount returns how many sessions from before the restart haven't
+// been resumed.
+func (a *App) resumableCount() int {
+	a.resumable.mu.Lock()
+	defer a.resumable.mu.Unlock()
+	return len(a.resumable.channels)
+}
+
+// forgetUserSessions deletes login's session records.
+func (a *App) forgetUserSessions(login string) int {
+	var ids []string
+	for _, id := range a.store.keys(sessionRecordCollection) {
+		var rec sessionRecord
+		if ok, _ := a.store.get(sessionRecordCollection, id, &rec); ok && rec.UserLogin == login {
+			ids = append(ids, id)
+		}
+	}
+	a.resumable.mu.Lock()
+	for channel, rec := range a.resumable.channels {
+		if rec.UserLogin == login {
+			delete(a.resumable.channels, channel)
+		}
+	}
+	a.resumable.mu.Unlock()
+	n, _ := a.store.deleteKeys(sessionRecordCollection, ids)
+	return n
+}
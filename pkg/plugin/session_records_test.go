@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestSessionRecords(t *testing.T) {
+	advance := withFrozenTime(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "store.json")
+	app := &App{logger: log.DefaultLogger, store: openTestStore(t, path), userVMs: map[string]string{}, streamSessions: map[string]*streamSession{}}
+
+	app.setUserVM("ana", "vm-a")
+	app.setUserVM("bob", "vm-b")
+	app.clearUserVM("bob", "vm-other")
+	app.clearUserVM("ana", "vm-a")
+
+	pump := newOutputPump(1024, 1024, 1024)
+	sess := &streamSession{id: "sess-b", vmID: "vm-b", userLogin: "bob", channel: "terminal/vm-b/n1", session: &TerminalSession{VMID: "vm-b"}, output: pump, startedAt: timeNow()}
+	app.streamSessions[sess.channel] = sess
+	app.saveSessionRecord(sess)
+	pump.seq = 42
+	advance(time.Minute)
+	app.flushSessionRecords()
+	var rec sessionRecord
+	if ok, _ := app.store.get(sessionRecordCollection, "sess-b", &rec); !ok || rec.OutputSeq != 42 || rec.Nonce != "n1" || !rec.UpdatedAt.Equal(timeNow()) {
+		t.Fatalf("record = %+v", rec)
+	}
+
+	// A session that ends normally leaves nothing to resume.
+	ended := &streamSession{id: "sess-x", vmID: "vm-b", userLogin: "bob", channel: "terminal/vm-b/n0"}
+	app.saveSessionRecord(ended)
+	app.endSessionRecord(ended)
+
+	// A fresh process on the same store knows bob's VM and expects their
+	// stream back.
+	next := &App{logger: log.DefaultLogger, store: openTestStore(t, path), userVMs: map[string]string{}}
+	if n := next.restoreSessionState(); n != 1 {
+		t.Errorf("resumable = %d", n)
+	}
+	if len(next.userVMs) != 1 || next.userVMs["bob"] != "vm-b" {
+		t.Errorf("userVMs = %v", next.userVMs)
+	}
+	if _, ok := next.takeResumable("terminal/vm-b/n1", "eve"); ok {
+		t.Error("another user resumed bob's stream")
+	}
+	if rec, ok := next.takeResumable("terminal/vm-b/n1", "bob"); !ok || rec.OutputSeq != 42 {
+		t.Errorf("resume = %+v, %v", rec, ok)
+	}
+	if next.resumableCount() != 0 {
+		t.Error("stream still resumable after resuming")
+	}
+
+	// Session records left for a day are dropped; VM assignments aren't.
+	next.saveSessionRecord(&streamSession{id: "sess-c", vmID: "vm-c", userLogin: "cy", channel: "terminal/vm-c/n2"})
+	advance(sessionRecordMaxAge + time.Hour)
+	last := &App{logger: log.DefaultLogger, store: openTestStore(t, path), userVMs: map[string]string{}}
+	if n := last.restoreSessionState(); n != 0 || len(last.userVMs) != 1 || last.userVMs["bob"] != "vm-b" {
+		t.Errorf("restored %d: %v", n, last.userVMs)
+	}
+}
+
+func TestForgetUserSessions(t *testing.T) {
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), userVMs: map[string]string{}}
+	for _, s := range []*streamSession{
+		{id: "s1", userLogin: "ana", channel: "terminal/vm-1/a"},
+		{id: "s2", userLogin: "ana", channel: "terminal/vm-1/b"},
+		{id: "s3", userLogin: "bob", channel: "terminal/vm-2/a"},
+	} {
+		app.saveSessionRecord(s)
+	}
+	app.restoreSessionState()
+	if n := app.forgetUserSessions("ana"); n != 2 || app.resumableCount() != 1 {
+		t.Errorf("forgot %d, %d resumable", n, app.resumableCount())
+	}
+}
@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// Per-session SSH keys.
+//
+// With sessionSshKeys on, a terminal connection uses the VM's long-lived
+// key only to install a fresh ed25519 key for the session in the VM user's
+// authorized_keys, with an expiry-time SessionSSHKeyTTLMinutes ahead (480
+// by default), then reconnects with that key and closes the first
+// connection. When the session ends the key is removed, over the session's
+// connection or, when that is gone, a new one. A session key that leaks
+// from logs or a memory dump stops working when its session closes or
+// expires, whichever comes first. expiry-time needs OpenSSH 7.7 or newer in
+// the template; when installing or using the key fails, the session keeps
+// the long-lived key's connection and a warning is logged.
+
+const (
+	defaultSessionSSHKeyTTL     = 8 * time.Hour
+	sessionSSHKeyCommandTimeout = 10 * time.Second
+	sessionSSHKeyCommentPrefix  = "pathfinder-session-"
+)
+
+// sessionSSHKey is a key minted for one terminal session.
+type sessionSSHKey struct {
+	// comment identifies the key's authorized_keys line.
+	comment       string
+	privateKeyPEM string
+	authorizedKey string
+	expiresAt     time.Time
+	// vmID and creds reach the VM with the long-lived key to revoke the
+	// session key when the session's connection is gone.
+	vmID  string
+	creds *Credentials
+}
+
+// newSessionSSHKey generates a key for vmID that expires at expiresAt.
+func newSessionSSHKey(vmID string, creds *Credentials, expiresAt time.Time) (*sessionSSHKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	comment := sessionSSHKeyCommentPrefix + hex.EncodeToString(id)
+	block, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionSSHKey{
+		comment:       comment,
+		privateKeyPEM: string(pem.EncodeToMemory(block)),
+		authorizedKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))),
+		expiresAt:     expiresAt.UTC(),
+		vmID:          vmID,
+		creds:         creds,
+	}, nil
+}
+
+// installCommand appends the key to authorized_keys with its expiry.
+func (k *sessionSSHKey) installCommand() string {
+	line := fmt.Sprintf(`expiry-time="%s" %s %s`, k.expiresAt.Format("20060102150405Z"), k.authorizedKey, k.comment)
+	return fmt.Sprintf(`umask 077 && mkdir -p ~/.ssh && printf '%%s\n' '%s' >> ~/.ssh/authorized_keys`, line)
+}
+
+// revokeCommand removes the key's line from authorized_keys, leaving the
+// file alone if grep fails.
+func (k *sessionSSHKey) revokeCommand() string {
+	return fmt.Sprintf(`umask 077; f=~/.ssh/authorized_keys; grep -v ' %s$' "$f" > "$f.pathfinder"; [ $? -le 1 ] && mv "$f.pathfinder" "$f"`, k.comment)
+}
+
+func (a *App) sessionSSHKeysEnabled() bool {
+	return a.settings != nil && a.settings.SessionSSHKeys
+}
+
+func (a *App) sessionSSHKeyTTL() time.Duration {
+	if a.settings != nil && a.settings.SessionSSHKeyTTLMinutes > 0 {
+		return time.Duration(a.settings.SessionSSHKeyTTLMinutes) * time.Minute
+	}
+	return defaultSessionSSHKeyTTL
+}
+
+// runSessionKeyCommand runs command on client and fails on a non-zero exit.
+func runSessionKeyCommand(ctx context.Context, client *ssh.Client, command string) error {
+	ctx, cancel := context.WithTimeout(ctx, sessionSSHKeyCommandTimeout)
+	defer cancel()
+	res, err := runRemoteCommand(ctx, client, command, "")
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("exit code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	return nil
+}
+
+// switchToSessionSSHKey installs a session key over bootstrap, connected
+// with the long-lived key, and returns a connection made with it, closing
+// bootstrap. On failure it returns bootstrap and no key.
+func (a *App) switchToSessionSSHKey(ctx context.Context, logger log.Logger, bootstrap *ssh.Client, vmID string, creds *Credentials, token string) (*ssh.Client, *sessionSSHKey) {
+	key, err := newSessionSSHKey(vmID, creds, timeNow().Add(a.sessionSSHKeyTTL()))
+	if err == nil {
+		err = runSessionKeyCommand(ctx, bootstrap, key.installCommand())
+	}
+	if err != nil {
+		logger.Warn("Failed to install a session SSH key, using the VM key", "vmID", vmID, "error", err)
+		return bootstrap, nil
+	}
+	sessionCreds := *creds
+	sessionCreds.SSHPrivateKey = key.privateKeyPEM
+	client, err := ConnectSSHViaRelay(ctx, a.settings.CodaRelayURL, vmID, &sessionCreds, token, a.relayTimeouts())
+	if err != nil {
+		logger.Warn("Failed to connect with the session SSH key, using the VM key", "vmID", vmID, "error", err)
+		if err := runSessionKeyCommand(ctx, bootstrap, key.revokeCommand()); err != nil {
+			logger.Warn("Failed to revoke session SSH key", "vmID", vmID, "key", key.comment, "error", err)
+		}
+		return bootstrap, nil
+	}
+	_ = bootstrap.Close()
+	logger.Info("Connected with a session SSH key", "vmID", vmID, "key", key.comment, "expiresAt", key.expiresAt)
+	return client, key
+}
+
+// revokeSessionSSHKey removes key from the VM over client, or over a new
+// connection made with the long-lived key when client is gone. That runs in
+// the background, or within sessionSSHKeyCommandTimeout once the instance is
+// disposed. key may be nil.
+func (a *App) revokeSessionSSHKey(logger log.Logger, key *sessionSSHKey, client *ssh.Client) {
+	if key == nil {
+		return
+	}
+	if err := runSessionKeyCommand(context.Background(), client, key.revokeCommand()); err == nil {
+		return
+	}
+	revoke := func(ctx context.Context) {
+		if err := a.revokeSessionSSHKeyOverNewConnection(ctx, key); err != nil {
+			logger.Warn("Failed to revoke session SSH key; it expires on its own", "vmID", key.vmID, "key", key.comment, "expiresAt", key.expiresAt, "error", err)
+		}
+	}
+	if !a.goBackground(revoke) {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionSSHKeyCommandTimeout)
+		defer cancel()
+		revoke(ctx)
+	}
+}
+
+// revokeSessionSSHKeyOverNewConnection connects to the key's VM with the
+// long-lived key and removes key.
+func (a *App) revokeSessionSSHKeyOverNewConnection(ctx context.Context, key *sessionSSHKey) error {
+	token, err := a.coda.GetAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	fresh, err := ConnectSSHViaRelay(ctx, a.settings.CodaRelayURL, key.vmID, key.creds, token, a.relayTimeouts())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fresh.Close() }()
+	return runSessionKeyCommand(ctx, fresh, key.revokeCommand())
+}
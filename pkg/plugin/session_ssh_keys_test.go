@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSessionSSHKey(t *testing.T) {
+	expires := time.Date(2026, 4, 1, 17, 0, 0, 0, time.UTC)
+	key, err := newSessionSSHKey("vm-1", &Credentials{}, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalized, err := normalizePrivateKey(key.privateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(normalized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))); got != key.authorizedKey {
+		t.Errorf("authorized key %q doesn't match the private key's %q", key.authorizedKey, got)
+	}
+
+	// The commands run against a scratch home directory with a key that
+	// must survive the revoke.
+	home := t.TempDir()
+	run := func(command string) {
+		t.Helper()
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(), "HOME="+home)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v: %s", command, err, out)
+		}
+	}
+	authorized := filepath.Join(home, ".ssh", "authorized_keys")
+	run(`mkdir -p ~/.ssh && echo 'ssh-ed25519 AAAAvmkey coda' > ~/.ssh/authorized_keys`)
+	run(key.installCommand())
+	data, err := os.ReadFile(authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `ssh-ed25519 AAAAvmkey coda
+expiry-time="20260401170000Z" ` + key.authorizedKey + " " + key.comment + "\n"
+	if string(data) != want {
+		t.Errorf("after install:\n%s\nwant:\n%s", data, want)
+	}
+
+	run(key.revokeCommand())
+	if data, _ := os.ReadFile(authorized); string(data) != "ssh-ed25519 AAAAvmkey coda\n" {
+		t.Errorf("after revoke: %q", data)
+	}
+	if info, err := os.Stat(authorized); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("authorized_keys mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestRevokeSessionSSHKey(t *testing.T) {
+	srv := newTestSSHServer(t)
+	defer srv.close()
+	var commands []string
+	srv.handler = func(cmd string) (string, string, int, time.Duration) {
+		commands = append(commands, cmd)
+		return "", "", 0, 0
+	}
+	client := srv.dialClient(t)
+	defer func() { _ = client.Close() }()
+
+	app := newTestApp(t)
+	app.revokeSessionSSHKey(log.DefaultLogger, nil, client)
+	if len(commands) != 0 {
+		t.Errorf("revoked without a key: %v", commands)
+	}
+	key, err := newSessionSSHKey("vm-1", &Credentials{}, timeNow().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.revokeSessionSSHKey(log.DefaultLogger, key, client)
+	if len(commands) != 1 || commands[0] != key.revokeCommand() {
+		t.Errorf("commands = %v", commands)
+	}
+
+	srv.handler = func(string) (string, string, int, time.Duration) { return "", "denied", 1, 0 }
+	if err := runSessionKeyCommand(t.Context(), client, key.installCommand()); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("failing command: %v", err)
+	}
+}
+
+func TestRevokeSessionSSHKey_AfterDisposeRevokesInline(t *testing.T) {
+	srv := newTestSSHServer(t)
+	client := srv.dialClient(t)
+	_ = client.Close()
+	srv.close()
+
+	var tokenRequests atomic.Int32
+	app := newTestApp(t)
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	app.coda.tokenExpiry = time.Time{}
+	app.stopBackground()
+
+	key, err := newSessionSSHKey("vm-1", &Credentials{}, timeNow().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.revokeSessionSSHKey(log.DefaultLogger, key, client)
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("token requests before revoke returned = %d, want 1", n)
+	}
+}
+
+func TestSessionSSHKeyTTL(t *testing.T) {
+	app := newTestApp(t)
+	if app.sessionSSHKeysEnabled() || app.sessionSSHKeyTTL() != defaultSessionSSHKeyTTL {
+		t.Error("defaults without settings")
+	}
+	app.settings = &Settings{SessionSSHKeys: true, SessionSSHKeyTTLMinutes: 90}
+	if !app.sessionSSHKeysEnabled() || app.sessionSSHKeyTTL() != 90*time.Minute {
+		t.Errorf("ttl = %v", app.sessionSSHKeyTTL())
+	}
+}
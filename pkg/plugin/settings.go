@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
@@ -11,8 +12,158 @@ type Settings struct {
 	CodaRegistered bool   `json:"codaRegistered"`
 	CodaAPIURL     string `json:"codaApiUrl"`
 	CodaRelayURL   string `json:"codaRelayUrl"`
-	EnrollmentKey  string `json:"-"`
-	RefreshToken   string `json:"-"`
+	StoragePath    string `json:"storagePath"`
+	// StorageEncryptionKey encrypts stored tokens and session metadata;
+	// StorageEncryptionPreviousKeys still decrypt during a rotation (see
+	// store_crypto.go).
+	StorageEncryptionKey          string   `json:"-"`
+	StorageEncryptionPreviousKeys []string `json:"-"`
+	// AuditRetentionDays, UsageRetentionDays and ScriptRunRetentionDays
+	// delete stored audit entries, session usage records and script runs
+	// older than this many days (see retention.go). 0 keeps them until the
+	// per-collection count cap.
+	AuditRetentionDays     int `json:"auditRetentionDays"`
+	UsageRetentionDays     int `json:"usageRetentionDays"`
+	ScriptRunRetentionDays int `json:"scriptRunRetentionDays"`
+	// VMHibernateIdleMinutes stops (hibernates) a connected VM after this many
+	// minutes without terminal input. 0 disables hibernation.
+	VMHibernateIdleMinutes int `json:"vmHibernateIdleMinutes"`
+	// VMDestroyIdleMinutes destroys a VM, connected or not, after this many
+	// minutes without terminal input, warning connected learners
+	// VMDestroyWarningMinutes (default 5) ahead. 0 disables it. Workspace
+	// VMs are exempt.
+	VMDestroyIdleMinutes    int `json:"vmDestroyIdleMinutes"`
+	VMDestroyWarningMinutes int `json:"vmDestroyWarningMinutes"`
+	// RelayHandshakeTimeoutSeconds, SSHHandshakeTimeoutSeconds and
+	// VMActiveTimeoutSeconds raise the connection ceilings for slow relays and
+	// large templates. 0 keeps the defaults (30s, 30s, 180s).
+	RelayHandshakeTimeoutSeconds int `json:"relayHandshakeTimeoutSeconds"`
+	SSHHandshakeTimeoutSeconds   int `json:"sshHandshakeTimeoutSeconds"`
+	VMActiveTimeoutSeconds       int `json:"vmActiveTimeoutSeconds"`
+	// OutputBufferKB bounds terminal output queued for a slow client before
+	// SSH reads pause (see output_pump.go). 0 means 256.
+	OutputBufferKB int `json:"outputBufferKb"`
+	// ReplayBufferKB is how much recently sent output each session keeps for
+	// replay after a Live reconnect (see output_pump.go). 0 means 128.
+	ReplayBufferKB int `json:"replayBufferKb"`
+	// LiveMaxMessageKB should match Grafana Live's message size limit; larger
+	// output is split across frames (see stream_chunking.go). 0 means 64.
+	LiveMaxMessageKB int `json:"liveMaxMessageKb"`
+	// OrgQuotaVMCount and OrgQuotaVMHours cap the VMs provisioned and the
+	// connected VM-hours per calendar month for the org. 0 means unlimited.
+	OrgQuotaVMCount int     `json:"orgQuotaVmCount"`
+	OrgQuotaVMHours float64 `json:"orgQuotaVmHours"`
+	// LokiURL enables export of terminal transcripts and session events to
+	// Loki. LokiUser/LokiPassword are optional basic auth; LokiTenantID is
+	// sent as X-Scope-OrgID.
+	LokiURL      string `json:"lokiUrl"`
+	LokiUser     string `json:"lokiUser"`
+	LokiTenantID string `json:"lokiTenantId"`
+	// PromRemoteWriteURL enables forwarding of sandbox VM metrics, collected
+	// every VMMetricsIntervalSeconds (default 15).
+	PromRemoteWriteURL       string `json:"promRemoteWriteUrl"`
+	PromRemoteWriteUser      string `json:"promRemoteWriteUser"`
+	VMMetricsIntervalSeconds int    `json:"vmMetricsIntervalSeconds"`
+	// SSHSourceCIDRs and SSHSourceEgressIP limit which sources may reach SSH
+	// on new VMs (see ssh_source.go).
+	SSHSourceCIDRs    []string `json:"sshSourceCidrs"`
+	SSHSourceEgressIP bool     `json:"sshSourceEgressIp"`
+	// SessionSSHKeys connects terminals with a key minted per session that
+	// expires after SessionSSHKeyTTLMinutes, 480 by default, and is revoked
+	// when the session ends (see session_ssh_keys.go).
+	SessionSSHKeys          bool `json:"sessionSshKeys"`
+	SessionSSHKeyTTLMinutes int  `json:"sessionSshKeyTtlMinutes"`
+	// RequireTerminalInputSeq refuses terminal input without replay
+	// protection (see input_replay.go).
+	RequireTerminalInputSeq bool `json:"requireTerminalInputSeq"`
+	// StrictTerminalInput refuses terminal input with fields this backend
+	// doesn't know (see stream_frames.go).
+	StrictTerminalInput bool `json:"strictTerminalInput"`
+	// SandboxKillSwitch refuses new terminal connections and VMs (see
+	// kill_switch.go).
+	SandboxKillSwitch bool `json:"sandboxKillSwitch"`
+	// DisableTelemetry opts the instance out of usage analytics, like
+	// Grafana's own reporting_enabled = false (see features.go).
+	DisableTelemetry bool `json:"disableTelemetry"`
+	// AllowPluginInstall lets admins install plugins that guides require
+	// from the guide itself (see plugin_install.go). Off by default.
+	AllowPluginInstall bool `json:"allowPluginInstall"`
+	// GuideResourceTTLHours deletes Grafana resources created by guide
+	// actions after this many hours (see guide_resources.go). 0 keeps them
+	// until the learner cleans up.
+	GuideResourceTTLHours int `json:"guideResourceTtlHours"`
+	// DigestIntervalHours posts a learning and sandbox usage digest to
+	// DigestWebhookURL this often, as Slack or, with DigestFormat "teams",
+	// Teams JSON (see digest.go). 0 disables it.
+	DigestIntervalHours int    `json:"digestIntervalHours"`
+	DigestFormat        string `json:"digestFormat"`
+	DigestWebhookURL    string `json:"-"`
+	// XAPIEndpoint sends learning events as xAPI statements to this LRS,
+	// with optional basic auth (see xapi.go). XAPIAccountHomePage is the
+	// homePage of actors identified by employee ID.
+	XAPIEndpoint        string `json:"xapiEndpoint"`
+	XAPIUser            string `json:"xapiUser"`
+	XAPIAccountHomePage string `json:"xapiAccountHomePage"`
+	XAPIPassword        string `json:"-"`
+	// GuideApprovalRequired hides published custom guides until they're
+	// approved; GuideApproverTeams can approve besides admins (see
+	// guide_reviews.go).
+	GuideApprovalRequired bool     `json:"guideApprovalRequired"`
+	GuideApproverTeams    []string `json:"guideApproverTeams"`
+	// GitHubToken files broken-step reports as issues in the GitHub
+	// repositories GuideReportRepositories maps guide manifest repository
+	// names to, through GitHubAPIURL (see guide_reports.go).
+	GitHubAPIURL            string            `json:"githubApiUrl"`
+	GuideReportRepositories map[string]string `json:"guideReportRepositories"`
+	GitHubToken             string            `json:"-"`
+	// GuideSourceLocale is the language guides are written in, en by
+	// default; GuideLocales are the locales content managers translate
+	// them into (see guide_locales.go).
+	GuideSourceLocale string   `json:"guideSourceLocale"`
+	GuideLocales      []string `json:"guideLocales"`
+	// TranslationAPIURL machine-translates saved guides into GuideLocales
+	// as drafts for review, authenticating with TranslationAPIKey (see
+	// guide_translation.go).
+	TranslationAPIURL string `json:"translationApiUrl"`
+	TranslationAPIKey string `json:"-"`
+	// SelectorManifestURL serves the maintained manifest of Grafana pages
+	// and data-testid selectors per version that monitored guides are
+	// checked against every SelectorHealthIntervalHours, 24 by default (see
+	// selector_health.go).
+	SelectorManifestURL         string `json:"selectorManifestUrl"`
+	SelectorHealthIntervalHours int    `json:"selectorHealthIntervalHours"`
+	// RecommenderServiceURL is the recommender the frontend queries;
+	// ForwardRecommendationFeedback sends learners' ratings of its
+	// recommendations there too (see recommend_feedback.go).
+	RecommenderServiceURL         string `json:"recommenderServiceUrl"`
+	ForwardRecommendationFeedback bool   `json:"forwardRecommendationFeedback"`
+	// ContentRefreshIntervalMinutes is how often cached content indexes
+	// are refreshed in the background, 300 by default (see
+	// content_refresh.go).
+	ContentRefreshIntervalMinutes int `json:"contentRefreshIntervalMinutes"`
+	// OfflineGuideBundlePath is a local copy of the interactive-learning
+	// CDN read when the CDN can't be reached (see offline_bundles.go).
+	OfflineGuideBundlePath string `json:"offlineGuideBundlePath"`
+	// Mirrors replace the external endpoints above with internal mirrors
+	// for air-gapped installs (see mirrors.go).
+	Mirrors MirrorSettings `json:"mirrors"`
+	// Vault reads EnrollmentKey and RefreshToken from HashiCorp Vault
+	// instead of secureJsonData (see vault.go).
+	Vault VaultSettings `json:"vault"`
+	// Features switches backend capabilities off (see features.go).
+	Features                FeatureFlags `json:"features"`
+	EnrollmentKey           string       `json:"-"`
+	RefreshToken            string       `json:"-"`
+	LokiPassword            string       `json:"-"`
+	PromRemoteWritePassword string       `json:"-"`
+	// WebhookSecrets verify signed webhook calls (see webhook.go).
+	WebhookSecrets []string `json:"-"`
+	// TerminalGRPCAddress enables the gRPC terminal transport, optionally with
+	// TLS, for the logins in TerminalGRPCTokens (see terminal_grpc.go).
+	TerminalGRPCAddress     string                       `json:"terminalGrpcAddress"`
+	TerminalGRPCTLSCertFile string                       `json:"terminalGrpcTlsCertFile"`
+	TerminalGRPCTLSKeyFile  string                       `json:"terminalGrpcTlsKeyFile"`
+	TerminalGRPCTokens      map[string]terminalGRPCToken `json:"-"`
 }
 
 // ParseSettings parses the plugin settings from Grafana's AppInstanceSettings.
@@ -33,6 +184,54 @@ func ParseSettings(appSettings backend.AppInstanceSettings) (*Settings, error) {
 	if refreshToken, ok := appSettings.DecryptedSecureJSONData["codaRefreshToken"]; ok {
 		settings.RefreshToken = refreshToken
 	}
+	if storageKey, ok := appSettings.DecryptedSecureJSONData["storageEncryptionKey"]; ok {
+		settings.StorageEncryptionKey = storageKey
+	}
+	if previousKeys, ok := appSettings.DecryptedSecureJSONData["storageEncryptionPreviousKeys"]; ok {
+		settings.StorageEncryptionPreviousKeys = splitSecretList(previousKeys)
+	}
+	if vaultToken, ok := appSettings.DecryptedSecureJSONData["vaultToken"]; ok {
+		settings.Vault.Token = vaultToken
+	}
+	if vaultSecretID, ok := appSettings.DecryptedSecureJSONData["vaultSecretId"]; ok {
+		settings.Vault.SecretID = vaultSecretID
+	}
+	if lokiPassword, ok := appSettings.DecryptedSecureJSONData["lokiPassword"]; ok {
+		settings.LokiPassword = lokiPassword
+	}
+	if promPassword, ok := appSettings.DecryptedSecureJSONData["promRemoteWritePassword"]; ok {
+		settings.PromRemoteWritePassword = promPassword
+	}
+	if webhookSecrets, ok := appSettings.DecryptedSecureJSONData["webhookSecrets"]; ok {
+		settings.WebhookSecrets = splitSecretList(webhookSecrets)
+	}
+	if digestURL, ok := appSettings.DecryptedSecureJSONData["digestWebhookUrl"]; ok {
+		settings.DigestWebhookURL = digestURL
+	}
+	if xapiPassword, ok := appSettings.DecryptedSecureJSONData["xapiPassword"]; ok {
+		settings.XAPIPassword = xapiPassword
+	}
+	if githubToken, ok := appSettings.DecryptedSecureJSONData["githubToken"]; ok {
+		settings.GitHubToken = githubToken
+	}
+	if translationKey, ok := appSettings.DecryptedSecureJSONData["translationApiKey"]; ok {
+		settings.TranslationAPIKey = translationKey
+	}
+	if grpcTokens, ok := appSettings.DecryptedSecureJSONData["terminalGrpcTokens"]; ok {
+		settings.TerminalGRPCTokens = parseTerminalGRPCTokens(grpcTokens)
+	}
 
 	return settings, nil
 }
+
+// splitSecretList splits a secure setting holding several values, one per
+// line or separated by commas, dropping blank entries.
+func splitSecretList(raw string) []string {
+	var values []string
+	for _, s := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
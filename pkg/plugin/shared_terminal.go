@@ -0,0 +1,391 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Shared writable terminals with a write lock.
+//
+// Channel path: shared/{shareId}
+//
+// The owner of a connected terminal session invites other users with
+// POST /shared-terminals. Invited users subscribe to shared/{shareId} and see
+// the session's output (fanned out like a broadcast, see terminal_fanout.go),
+// but only the current holder of the write lock may send input, paste or
+// resize — from the shared channel or the owner's own terminal channel. The
+// owner starts with the lock.
+//
+// Lock messages are published like terminal input ({"type": ...}):
+//
+//	lock-request  ask for the lock; the owner takes it back immediately,
+//	              anyone else is announced to the holder as "requested"
+//	lock-release  return the lock to the owner
+//	lock-handoff  give the lock to the user in "data" (holder or owner only)
+//
+// Every change is announced on the stream as {"type":"lock","holder":...}.
+
+const (
+	sharedTerminalChannelPrefix = "shared"
+	maxSharedTerminalUsers      = 10
+)
+
+// sharedTerminal is one shared session and its write lock.
+type sharedTerminal struct {
+	id        string
+	owner     string
+	vmID      string
+	users     map[string]bool // invited users, not including the owner
+	createdAt time.Time
+	fanout    *outputFanout
+
+	mu     sync.Mutex
+	holder string
+}
+
+// sharedTerminalInfo is the JSON view of a shared terminal.
+type sharedTerminalInfo struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	VMID      string    `json:"vmId"`
+	Users     []string  `json:"users"`
+	Holder    string    `json:"holder"`
+	CreatedAt time.Time `json:"createdAt"`
+	Viewers   int       `json:"viewers"`
+}
+
+// ShareTerminalRequest is the JSON body for POST /shared-terminals.
+type ShareTerminalRequest struct {
+	VMID  string   `json:"vmId" validate:"required"`
+	Users []string `json:"users" validate:"required,max=50,each,max=200"`
+}
+
+func (s *sharedTerminal) authorized(user string) bool {
+	return user != "" && (user == s.owner || s.users[user])
+}
+
+func (s *sharedTerminal) lockHolder() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holder
+}
+
+func (s *sharedTerminal) info() sharedTerminalInfo {
+	users := make([]string, 0, len(s.users))
+	for u := range s.users {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return sharedTerminalInfo{
+		ID:        s.id,
+		Owner:     s.owner,
+		VMID:      s.vmID,
+		Users:     users,
+		Holder:    s.lockHolder(),
+		CreatedAt: s.createdAt,
+		Viewers:   s.fanout.viewerCount(),
+	}
+}
+
+// lockMessage describes the current lock state.
+func (s *sharedTerminal) lockMessage() TerminalStreamOutput {
+	holder := s.lockHolder()
+	return TerminalStreamOutput{Type: "lock", State: "held", Holder: holder, Message: holder + " has the keyboard"}
+}
+
+func newShareID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseSharedTerminalChannel extracts the share ID from shared/{shareId}.
+func parseSharedTerminalChannel(channelPath string) (string, bool) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) != 2 || parts[0] != sharedTerminalChannelPrefix || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func (a *App) getSharedTerminal(id string) *sharedTerminal {
+	a.sharedTerminalsMu.Lock()
+	defer a.sharedTerminalsMu.Unlock()
+	return a.sharedTerminals[id]
+}
+
+// sharedTerminalsFor returns the shares of owner's session on vmID.
+func (a *App) sharedTerminalsFor(owner, vmID string) []*sharedTerminal {
+	a.sharedTerminalsMu.Lock()
+	defer a.sharedTerminalsMu.Unlock()
+	var shares []*sharedTerminal
+	for _, s := range a.sharedTerminals {
+		if s.owner == owner && s.vmID == vmID {
+			shares = append(shares, s)
+		}
+	}
+	return shares
+}
+
+// stopAllSharedTerminals ends every share; used on dispose.
+func (a *App) stopAllSharedTerminals() {
+	a.sharedTerminalsMu.Lock()
+	defer a.sharedTerminalsMu.Unlock()
+	for id, s := range a.sharedTerminals {
+		s.fanout.stop()
+		delete(a.sharedTerminals, id)
+	}
+}
+
+// announceLock sends msg to the share's viewers and the owner's own
+// terminal stream.
+func (a *App) announceLock(s *sharedTerminal, msg TerminalStreamOutput) {
+	s.fanout.send(msg)
+	if sess := a.findStreamSessionForUserVM(s.owner, s.vmID); sess != nil && sess.sender != nil {
+		sendStreamMessage(sess.sender, msg)
+	}
+}
+
+// applySharedInput enforces the write lock for input from user. It reports
+// whether the message was consumed here; unconsumed messages are forwarded to
+// the shell as usual.
+func (a *App) applySharedInput(ctxLogger log.Logger, s *sharedTerminal, user string, input TerminalInput) (backend.PublishStreamStatus, bool) {
+	s.mu.Lock()
+	holder := s.holder
+	switch input.Type {
+	case "lock-request":
+		if user == holder {
+			s.mu.Unlock()
+			return backend.PublishStreamStatusOK, true
+		}
+		if user != s.owner {
+			s.mu.Unlock()
+			a.announceLock(s, TerminalStreamOutput{Type: "lock", State: "requested", Holder: holder, Message: user + " is asking for the keyboard"})
+			return backend.PublishStreamStatusOK, true
+		}
+		s.holder = user
+	case "lock-release":
+		if user != holder || user == s.owner {
+			s.mu.Unlock()
+			return backend.PublishStreamStatusOK, true
+		}
+		s.holder = s.owner
+	case "lock-handoff":
+		if user != holder && user != s.owner {
+			s.mu.Unlock()
+			return backend.PublishStreamStatusPermissionDenied, true
+		}
+		if !s.authorized(input.Data) {
+			s.mu.Unlock()
+			ctxLogger.Warn("Rejecting write lock handoff to uninvited user", "share", s.id, "from", user, "to", input.Data)
+			return backend.PublishStreamStatusPermissionDenied, true
+		}
+		s.holder = input.Data
+	default:
+		s.mu.Unlock()
+		if user != holder {
+			ctxLogger.Debug("Rejecting shared terminal input without the write lock", "share", s.id, "user", user, "holder", holder)
+			return backend.PublishStreamStatusPermissionDenied, true
+		}
+		return backend.PublishStreamStatusOK, false
+	}
+	s.mu.Unlock()
+
+	ctxLogger.Info("Shared terminal write lock changed", "share", s.id, "from", holder, "to", s.lockHolder(), "by", user)
+	a.announceLock(s, s.lockMessage())
+	return backend.PublishStreamStatusOK, true
+}
+
+// handleSharedTerminals handles GET /shared-terminals (shares the caller owns
+// or is invited to) and POST /shared-terminals (share the caller's session).
+func (a *App) handleSharedTerminals(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.sharedTerminalsMu.Lock()
+		result := []sharedTerminalInfo{}
+		for _, s := range a.sharedTerminals {
+			if s.authorized(user) {
+				result = append(result, s.info())
+			}
+		}
+		a.sharedTerminalsMu.Unlock()
+		sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+		a.writeJSON(w, map[string]interface{}{"sharedTerminals": result}, http.StatusOK)
+	case http.MethodPost:
+		a.handleShareTerminal(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleShareTerminal(w http.ResponseWriter, r *http.Request, user string) {
+	var req ShareTerminalRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	users := map[string]bool{}
+	for _, u := range req.Users {
+		if u = strings.TrimSpace(u); u != "" && u != user {
+			users[u] = true
+		}
+	}
+	if len(users) == 0 || len(users) > maxSharedTerminalUsers {
+		a.writeError(w, fmt.Sprintf("users must name 1-%d other Grafana users", maxSharedTerminalUsers), http.StatusBadRequest)
+		return
+	}
+	if a.findStreamSessionForUserVM(user, req.VMID) == nil {
+		a.writeError(w, "No active terminal session for this VM", http.StatusConflict)
+		return
+	}
+
+	id, err := newShareID()
+	if err != nil {
+		a.writeError(w, "Failed to create share", http.StatusInternalServerError)
+		return
+	}
+	s := &sharedTerminal{
+		id:        id,
+		owner:     user,
+		vmID:      req.VMID,
+		users:     users,
+		createdAt: timeNow().UTC(),
+		fanout:    newOutputFanout(),
+		holder:    user,
+	}
+	a.sharedTerminalsMu.Lock()
+	if a.sharedTerminals == nil {
+		a.sharedTerminals = make(map[string]*sharedTerminal)
+	}
+	a.sharedTerminals[id] = s
+	a.sharedTerminalsMu.Unlock()
+
+	a.ctxLogger(r.Context()).Info("Shared terminal session", "share", id, "vmID", req.VMID, "owner", user, "users", len(users))
+	a.writeJSON(w, s.info(), http.StatusCreated)
+}
+
+// handleSharedTerminalByID handles GET/DELETE /shared-terminals/{id}. Only
+// the owner or an admin may end a share.
+func (a *App) handleSharedTerminalByID(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/shared-terminals/")
+	s := a.getSharedTerminal(id)
+	if s == nil || !s.authorized(user) {
+		a.writeError(w, "Shared terminal not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, s.info(), http.StatusOK)
+	case http.MethodDelete:
+		if user != s.owner && !userIsAdminFromContext(r.Context()) {
+			a.writeError(w, "Only the owner can stop sharing", http.StatusForbidden)
+			return
+		}
+		a.sharedTerminalsMu.Lock()
+		delete(a.sharedTerminals, id)
+		a.sharedTerminalsMu.Unlock()
+		s.fanout.stop()
+		if sess := a.findStreamSessionForUserVM(s.owner, s.vmID); sess != nil && sess.sender != nil {
+			sendStreamMessage(sess.sender, TerminalStreamOutput{Type: "lock", State: "held", Holder: s.owner, Message: "Sharing ended"})
+		}
+		a.ctxLogger(r.Context()).Info("Stopped sharing terminal session", "share", id, "by", user)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// subscribeSharedTerminalStream accepts the owner and invited users.
+func (a *App) subscribeSharedTerminalStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	id, ok := parseSharedTerminalChannel(req.Path)
+	var s *sharedTerminal
+	if ok {
+		s = a.getSharedTerminal(id)
+	}
+	if s == nil {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	user := pluginUserLogin(req.PluginContext)
+	if !s.authorized(user) {
+		a.ctxLogger(ctx).Info("Rejecting shared terminal subscription from uninvited user", "share", id, "user", user)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runSharedTerminalStream relays the owner's session output and lock
+// messages until the stream closes or sharing stops.
+func (a *App) runSharedTerminalStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	id, ok := parseSharedTerminalChannel(req.Path)
+	var s *sharedTerminal
+	if ok {
+		s = a.getSharedTerminal(id)
+	}
+	if s == nil {
+		sendStreamError(ctx, sender, "Shared terminal not found")
+		return nil
+	}
+
+	runFanoutStream(ctx, sender, s.fanout, "Sharing ended",
+		TerminalStreamOutput{Type: "connected", VmId: s.vmID, Message: "Joined " + s.owner + "'s terminal"},
+		s.lockMessage(),
+	)
+	return nil
+}
+
+// publishSharedTerminalStream applies lock messages and forwards the lock
+// holder's input to the owner's session.
+func (a *App) publishSharedTerminalStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+	id, ok := parseSharedTerminalChannel(req.Path)
+	var s *sharedTerminal
+	if ok {
+		s = a.getSharedTerminal(id)
+	}
+	if s == nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+	user := pluginUserLogin(req.PluginContext)
+	if !s.authorized(user) {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+
+	input, err := a.parseTerminalInput(req.Data)
+	if err != nil {
+		ctxLogger.Warn("PublishStream: invalid input", "error", err, "dataLen", len(req.Data))
+		return nil, err
+	}
+	if status, handled := a.applySharedInput(ctxLogger, s, user, input); handled {
+		return &backend.PublishStreamResponse{Status: status}, nil
+	}
+
+	sess := a.findStreamSessionForUserVM(s.owner, s.vmID)
+	if sess == nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+	a.applyTerminalInput(ctxLogger, sess, input)
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
+}
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func shareTerminal(t *testing.T, app *App, user, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	app.handleSharedTerminals(w, roleRequest(http.MethodPost, "/shared-terminals", body, user, "Viewer"))
+	return w
+}
+
+func TestHandleSharedTerminals_Create(t *testing.T) {
+	app := newBroadcastApp(&recordingWriter{})
+
+	if w := shareTerminal(t, app, "alice", `{"vmId":"vm-2","users":["bob"]}`); w.Code != http.StatusConflict {
+		t.Errorf("no session: status = %d", w.Code)
+	}
+	if w := shareTerminal(t, app, "alice", `{"vmId":"vm-1","users":["alice"," "]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no other users: status = %d", w.Code)
+	}
+	w := shareTerminal(t, app, "alice", `{"vmId":"vm-1","users":["bob"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("share: status = %d body = %s", w.Code, w.Body)
+	}
+	var info sharedTerminalInfo
+	_ = json.Unmarshal(w.Body.Bytes(), &info)
+	if info.ID == "" || info.Owner != "alice" || info.Holder != "alice" || len(info.Users) != 1 {
+		t.Errorf("info = %+v", info)
+	}
+
+	for user, want := range map[string]int{"bob": 1, "carol": 0} {
+		w := httptest.NewRecorder()
+		app.handleSharedTerminals(w, roleRequest(http.MethodGet, "/shared-terminals", "", user, "Viewer"))
+		var resp struct {
+			SharedTerminals []sharedTerminalInfo `json:"sharedTerminals"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.SharedTerminals) != want {
+			t.Errorf("%s sees %d shares, want %d", user, len(resp.SharedTerminals), want)
+		}
+	}
+
+	for user, want := range map[string]backend.SubscribeStreamStatus{
+		"bob":   backend.SubscribeStreamStatusOK,
+		"carol": backend.SubscribeStreamStatusPermissionDenied,
+	} {
+		resp, _ := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+			Path:          "shared/" + info.ID,
+			PluginContext: backend.PluginContext{User: &backend.User{Login: user}},
+		})
+		if resp.Status != want {
+			t.Errorf("%s subscribe: status = %v, want %v", user, resp.Status, want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.handleSharedTerminalByID(w, roleRequest(http.MethodDelete, "/shared-terminals/"+info.ID, "", "bob", "Viewer"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("guest stop: status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.handleSharedTerminalByID(w, roleRequest(http.MethodDelete, "/shared-terminals/"+info.ID, "", "alice", "Viewer"))
+	if w.Code != http.StatusNoContent || app.getSharedTerminal(info.ID) != nil {
+		t.Errorf("owner stop: status = %d", w.Code)
+	}
+}
+
+func TestSharedTerminal_WriteLock(t *testing.T) {
+	stdin := &recordingWriter{}
+	app := newBroadcastApp(stdin)
+	w := shareTerminal(t, app, "alice", `{"vmId":"vm-1","users":["bob"]}`)
+	var info sharedTerminalInfo
+	_ = json.Unmarshal(w.Body.Bytes(), &info)
+	share := app.getSharedTerminal(info.ID)
+
+	publish := func(path, user, body string) backend.PublishStreamStatus {
+		t.Helper()
+		resp, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			Path:          path,
+			Data:          json.RawMessage(body),
+			PluginContext: backend.PluginContext{User: &backend.User{Login: user}},
+		})
+		if err != nil {
+			t.Fatalf("PublishStream(%s, %s): %v", path, user, err)
+		}
+		return resp.Status
+	}
+	shared := "shared/" + info.ID
+	owner := "terminal/vm-1/1"
+
+	if got := publish(shared, "bob", `{"type":"input","data":"rm -rf /\r"}`); got != backend.PublishStreamStatusPermissionDenied {
+		t.Errorf("guest without lock: status = %v", got)
+	}
+	if got := publish(shared, "carol", `{"type":"lock-request"}`); got != backend.PublishStreamStatusPermissionDenied {
+		t.Errorf("uninvited: status = %v", got)
+	}
+	if got := publish(shared, "bob", `{"type":"lock-request"}`); got != backend.PublishStreamStatusOK || share.lockHolder() != "alice" {
+		t.Errorf("guest request must not take the lock: status = %v holder = %s", got, share.lockHolder())
+	}
+	if got := publish(owner, "alice", `{"type":"lock-handoff","data":"carol"}`); got != backend.PublishStreamStatusPermissionDenied {
+		t.Errorf("handoff to uninvited: status = %v", got)
+	}
+	if got := publish(owner, "alice", `{"type":"lock-handoff","data":"bob"}`); got != backend.PublishStreamStatusOK || share.lockHolder() != "bob" {
+		t.Fatalf("handoff: status = %v holder = %s", got, share.lockHolder())
+	}
+
+	if got := publish(owner, "alice", `{"type":"input","data":"x"}`); got != backend.PublishStreamStatusPermissionDenied {
+		t.Errorf("owner without lock: status = %v", got)
+	}
+	if got := publish(shared, "bob", `{"type":"input","data":"ls\r"}`); got != backend.PublishStreamStatusOK {
+		t.Errorf("guest with lock: status = %v", got)
+	}
+	if len(stdin.writes) != 1 || string(stdin.writes[0]) != "ls\r" {
+		t.Errorf("stdin writes = %q", stdin.writes)
+	}
+
+	if got := publish(shared, "bob", `{"type":"lock-release"}`); got != backend.PublishStreamStatusOK || share.lockHolder() != "alice" {
+		t.Errorf("release: status = %v holder = %s", got, share.lockHolder())
+	}
+	if got := publish(owner, "alice", `{"type":"input","data":"pwd\r"}`); got != backend.PublishStreamStatusOK || len(stdin.writes) != 2 {
+		t.Errorf("owner after release: status = %v writes = %q", got, stdin.writes)
+	}
+}
@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSH source restriction.
+//
+// By default every sandbox's SSH port is reachable from anywhere. With
+// sshSourceCidrs and/or sshSourceEgressIp set, CreateVM passes
+// config.sshAllowedCidrs so Coda only lets those sources reach SSH. The
+// egress IP is the plugin's public address as Coda sees it
+// (GET /api/v1/client-ip), re-checked every sshEgressIPTTL; when a re-check
+// fails the last known address is used, and with none known VM creation fails
+// rather than opening SSH to the world.
+
+const (
+	sshAllowedCIDRsConfigKey = "sshAllowedCidrs"
+	sshEgressIPTTL           = time.Hour
+)
+
+// sshSourceRestriction computes the SSH allow-list sent with CreateVM.
+type sshSourceRestriction struct {
+	cidrs  []string
+	egress bool
+
+	mu        sync.Mutex
+	egressIP  string
+	fetchedAt time.Time
+}
+
+// newSSHSourceRestriction normalizes the configured CIDRs (bare IPs become
+// single-host prefixes). Invalid entries are returned separately so the
+// caller can report them. Returns nil when nothing restricts SSH.
+func newSSHSourceRestriction(cidrs []string, egress bool) (*sshSourceRestriction, []string) {
+	var valid, invalid []string
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(c); err == nil {
+			valid = append(valid, p.Masked().String())
+		} else if addr, err := netip.ParseAddr(c); err == nil {
+			valid = append(valid, netip.PrefixFrom(addr, addr.BitLen()).String())
+		} else {
+			invalid = append(invalid, c)
+		}
+	}
+	if len(valid) == 0 && !egress {
+		return nil, invalid
+	}
+	return &sshSourceRestriction{cidrs: valid, egress: egress}, invalid
+}
+
+// allowedCIDRs returns the allow-list for a new VM.
+func (s *sshSourceRestriction) allowedCIDRs(ctx context.Context, c *CodaClient) ([]string, error) {
+	cidrs := append([]string(nil), s.cidrs...)
+	if !s.egress {
+		return cidrs, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.egressIP == "" || timeNow().Sub(s.fetchedAt) >= sshEgressIPTTL {
+		ip, err := c.ClientIP(ctx)
+		switch {
+		case err == nil:
+			s.egressIP, s.fetchedAt = ip, timeNow()
+		case s.egressIP == "":
+			return nil, fmt.Errorf("could not determine egress IP for SSH source restriction: %w", err)
+		}
+	}
+	addr, _ := netip.ParseAddr(s.egressIP)
+	return append(cidrs, netip.PrefixFrom(addr, addr.BitLen()).String()), nil
+}
+
+// ClientIP returns the plugin's public IP address as seen by Coda.
+func (c *CodaClient) ClientIP(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+"/api/v1/client-ip", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := c.setAuthHeader(ctx, req); err != nil {
+		return "", fmt.Errorf("authentication failed: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	var result struct {
+		IP string `json:"ip"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	addr, err := netip.ParseAddr(result.IP)
+	if err != nil {
+		return "", fmt.Errorf("invalid client IP %q", result.IP)
+	}
+	return addr.Unmap().String(), nil
+}
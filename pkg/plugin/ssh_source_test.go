@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewSSHSourceRestriction(t *testing.T) {
+	s, invalid := newSSHSourceRestriction([]string{"10.0.0.7/8", " 203.0.113.4 ", "2001:db8::1", "not-a-cidr", ""}, false)
+	if want := []string{"10.0.0.0/8", "203.0.113.4/32", "2001:db8::1/128"}; s == nil || !reflect.DeepEqual(s.cidrs, want) {
+		t.Errorf("cidrs = %+v, want %v", s, want)
+	}
+	if !reflect.DeepEqual(invalid, []string{"not-a-cidr"}) {
+		t.Errorf("invalid = %v", invalid)
+	}
+	if s, _ := newSSHSourceRestriction(nil, false); s != nil {
+		t.Errorf("no restriction configured: got %+v", s)
+	}
+}
+
+func TestCreateVM_SSHSourceRestriction(t *testing.T) {
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	ipCalls, ipFails := 0, false
+	var gotConfig map[string]interface{}
+	c := newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/client-ip":
+			ipCalls++
+			if ipFails {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"ip": "198.51.100.9"})
+		case "/api/v1/vms":
+			var req CreateVMRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			gotConfig = req.Config
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(VM{ID: "vm-1", State: "pending"})
+		}
+	})
+	c.sshSource, _ = newSSHSourceRestriction([]string{"10.1.0.0/16"}, true)
+
+	callerConfig := map[string]interface{}{"app": "shop"}
+	if _, err := c.CreateVM(context.Background(), "sample-app", "alice", callerConfig); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"10.1.0.0/16", "198.51.100.9/32"}
+	if !reflect.DeepEqual(gotConfig[sshAllowedCIDRsConfigKey], want) || gotConfig["app"] != "shop" {
+		t.Errorf("config = %v", gotConfig)
+	}
+	if _, ok := callerConfig[sshAllowedCIDRsConfigKey]; ok {
+		t.Error("caller's config was modified")
+	}
+
+	ipFails = true
+	now = now.Add(2 * sshEgressIPTTL)
+	if _, err := c.CreateVM(context.Background(), "vm-aws", "alice"); err != nil {
+		t.Fatalf("stale egress IP should be reused: %v", err)
+	}
+	if ipCalls != 2 || !reflect.DeepEqual(gotConfig[sshAllowedCIDRsConfigKey], want) {
+		t.Errorf("ipCalls = %d, config = %v", ipCalls, gotConfig)
+	}
+
+	c.sshSource, _ = newSSHSourceRestriction(nil, true)
+	if _, err := c.CreateVM(context.Background(), "vm-aws", "alice"); err == nil {
+		t.Error("CreateVM succeeded without a known egress IP")
+	}
+}
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Step comments.
+//
+// Learners leave feedback on a guide step with POST /guides/{name}/comments,
+// so maintainers see exactly which step is confusing. Comments are private
+// to their author and the guide's maintainers (editors and admins) unless
+// the learner shares them, which shows them to every learner of the guide.
+// Maintainers resolve comments with PUT /guides/{name}/comments/{id}; a
+// comment is deleted by its author or a maintainer.
+
+const (
+	stepCommentCollection   = "step-comments"
+	maxStepCommentsPerGuide = 2000
+)
+
+// stepComment is one comment on a guide step, keyed guide/id.
+type stepComment struct {
+	ID         string     `json:"id"`
+	Guide      string     `json:"guide"`
+	StepID     string     `json:"stepId"`
+	Author     string     `json:"author"`
+	Body       string     `json:"body"`
+	Shared     bool       `json:"shared"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy string     `json:"resolvedBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// StepCommentRequest is the JSON body for POST /guides/{name}/comments.
+type StepCommentRequest struct {
+	StepID string `json:"stepId" validate:"required,max=200"`
+	Body   string `json:"body" validate:"required,max=2000"`
+	Shared bool   `json:"shared"`
+}
+
+// StepCommentUpdateRequest is the JSON body for PUT
+// /guides/{name}/comments/{id}.
+type StepCommentUpdateRequest struct {
+	Resolved bool `json:"resolved"`
+}
+
+// stepComments returns guide's comments, oldest first.
+func (a *App) stepComments(guide string) []stepComment {
+	prefix := guide + "/"
+	comments := []stepComment{}
+	for _, key := range a.store.keys(stepCommentCollection) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var c stepComment
+		if ok, err := a.store.get(stepCommentCollection, key, &c); err == nil && ok {
+			comments = append(comments, c)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].CreatedAt.Before(comments[j].CreatedAt) })
+	return comments
+}
+
+// handleStepComments handles GET/POST /guides/{name}/comments and
+// PUT/DELETE /guides/{name}/comments/{id}.
+func (a *App) handleStepComments(w http.ResponseWriter, r *http.Request, guide, id string) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !guideIDPattern.MatchString(guide) {
+		a.writeError(w, "Guide name must be 1-200 letters, digits, '.', '_', '=', or '-'", http.StatusBadRequest)
+		return
+	}
+	maintainer := userCanEditFromContext(ctx)
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			step := r.URL.Query().Get("step")
+			visible := []stepComment{}
+			for _, c := range a.stepComments(guide) {
+				if (step == "" || c.StepID == step) && (maintainer || c.Shared || c.Author == user) {
+					visible = append(visible, c)
+				}
+			}
+			a.writeJSON(w, map[string]interface{}{"comments": visible}, http.StatusOK)
+		case http.MethodPost:
+			var req StepCommentRequest
+			if !a.decodeRequest(w, r, &req) {
+				return
+			}
+			a.stepCommentsMu.Lock()
+			defer a.stepCommentsMu.Unlock()
+			if len(a.stepComments(guide)) >= maxStepCommentsPerGuide {
+				a.writeError(w, fmt.Sprintf("A guide can have at most %d comments", maxStepCommentsPerGuide), http.StatusConflict)
+				return
+			}
+			c := stepComment{ID: rand.Text(), Guide: guide, StepID: req.StepID, Author: user, Body: req.Body, Shared: req.Shared, CreatedAt: timeNow().UTC()}
+			if err := a.store.put(stepCommentCollection, guide+"/"+c.ID, c); err != nil {
+				a.ctxLogger(ctx).Error("Failed to store step comment", "guide", guide, "error", err)
+				a.writeError(w, "Failed to store the comment", http.StatusInternalServerError)
+				return
+			}
+			a.writeJSON(w, c, http.StatusCreated)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	a.stepCommentsMu.Lock()
+	defer a.stepCommentsMu.Unlock()
+	key := guide + "/" + id
+	var c stepComment
+	ok, err := a.store.get(stepCommentCollection, key, &c)
+	if err != nil {
+		a.ctxLogger(ctx).Error("Failed to load step comment", "guide", guide, "id", id, "error", err)
+		a.writeError(w, "Failed to load the comment", http.StatusInternalServerError)
+		return
+	}
+	if !ok || (!maintainer && !c.Shared && c.Author != user) {
+		a.writeError(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		if !maintainer {
+			a.writeError(w, "Only editors and admins can resolve comments", http.StatusForbidden)
+			return
+		}
+		var req StepCommentUpdateRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		c.Resolved, c.ResolvedBy, c.ResolvedAt = req.Resolved, "", nil
+		if req.Resolved {
+			now := timeNow().UTC()
+			c.ResolvedBy, c.ResolvedAt = user, &now
+		}
+		if err := a.store.put(stepCommentCollection, key, c); err != nil {
+			a.ctxLogger(ctx).Error("Failed to store step comment", "guide", guide, "id", id, "error", err)
+			a.writeError(w, "Failed to store the comment", http.StatusInternalServerError)
+			return
+		}
+		a.writeJSON(w, c, http.StatusOK)
+	case http.MethodDelete:
+		if !maintainer && c.Author != user {
+			a.writeError(w, "Only the author, editors and admins can delete a comment", http.StatusForbidden)
+			return
+		}
+		if err := a.store.delete(stepCommentCollection, key); err != nil {
+			a.ctxLogger(ctx).Error("Failed to delete step comment", "guide", guide, "id", id, "error", err)
+			a.writeError(w, "Failed to delete the comment", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
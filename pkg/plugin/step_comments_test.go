@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStepComments(t *testing.T) {
+	app := newTestApp(t)
+	serve := func(method, target, body, user, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.handleGuideByName(w, roleRequest(method, target, body, user, role))
+		return w
+	}
+	post := func(user, body string) stepComment {
+		t.Helper()
+		w := serve(http.MethodPost, "/guides/loki-101/comments", body, user, "Viewer")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("post: status %d: %s", w.Code, w.Body.String())
+		}
+		var c stepComment
+		if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	list := func(target, user, role string) []stepComment {
+		t.Helper()
+		w := serve(http.MethodGet, target, "", user, role)
+		var resp struct {
+			Comments []stepComment `json:"comments"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Comments
+	}
+
+	if w := serve(http.MethodPost, "/guides/loki-101/comments", `{"body": "no step"}`, "ann", "Viewer"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing stepId: status %d, want 400", w.Code)
+	}
+	private := post("ann", `{"stepId": "step-3", "body": "Which data source?"}`)
+	shared := post("bob", `{"stepId": "step-4", "body": "The query returns nothing", "shared": true}`)
+	if private.Author != "ann" || private.StepID != "step-3" || private.ID == "" {
+		t.Errorf("comment = %+v", private)
+	}
+
+	if got := list("/guides/loki-101/comments", "ann", "Viewer"); len(got) != 2 {
+		t.Errorf("ann sees %d comments, want 2", len(got))
+	}
+	if got := list("/guides/loki-101/comments", "cal", "Viewer"); len(got) != 1 || got[0].ID != shared.ID {
+		t.Errorf("cal sees %+v, want only the shared comment", got)
+	}
+	if got := list("/guides/loki-101/comments?step=step-3", "ed", "Editor"); len(got) != 1 || got[0].ID != private.ID {
+		t.Errorf("editor step-3 = %+v", got)
+	}
+
+	if w := serve(http.MethodDelete, "/guides/loki-101/comments/"+private.ID, "", "cal", "Viewer"); w.Code != http.StatusNotFound {
+		t.Errorf("delete private by other: status %d, want 404", w.Code)
+	}
+	if w := serve(http.MethodPut, "/guides/loki-101/comments/"+shared.ID, `{"resolved": true}`, "bob", "Viewer"); w.Code != http.StatusForbidden {
+		t.Errorf("resolve by viewer: status %d, want 403", w.Code)
+	}
+	w := serve(http.MethodPut, "/guides/loki-101/comments/"+shared.ID, `{"resolved": true}`, "ed", "Editor")
+	var resolved stepComment
+	_ = json.Unmarshal(w.Body.Bytes(), &resolved)
+	if w.Code != http.StatusOK || !resolved.Resolved || resolved.ResolvedBy != "ed" || resolved.ResolvedAt == nil {
+		t.Errorf("resolve: status %d, comment %+v", w.Code, resolved)
+	}
+	if w := serve(http.MethodDelete, "/guides/loki-101/comments/"+shared.ID, "", "cal", "Viewer"); w.Code != http.StatusForbidden {
+		t.Errorf("delete shared by other: status %d, want 403", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/guides/loki-101/comments/"+private.ID, "", "ann", "Viewer"); w.Code != http.StatusNoContent {
+		t.Errorf("delete own: status %d, want 204", w.Code)
+	}
+	if got := list("/guides/loki-101/comments", "ed", "Editor"); len(got) != 1 {
+		t.Errorf("after delete: %d comments, want 1", len(got))
+	}
+}
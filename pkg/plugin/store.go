@@ -0,0 +1,281 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Plugin-local persistence.
+//
+// The backend has no database. State that must outlive a single request or
+// stream (workspace records and the like) lives in a jsonStore: named
+// collections of JSON documents held in memory and mirrored to a single file
+// when Settings.StoragePath is configured. Without a path the store is
+// memory-only, so an unconfigured instance behaves exactly as before —
+// everything is lost on restart.
+//
+// Writes rewrite the whole file (temp file + rename) under the store mutex.
+// Collections are small per-instance indexes, not bulk data, so the simple
+// approach is cheaper than it sounds and never leaves a torn file behind.
+//
+// Bulk data (uploaded files) goes in blobs instead: one file per key under
+// <path>.blobs/<collection>/, written the same way, or in memory for a
+// memory-only store.
+
+// jsonStore is a collection → key → document map with optional file backing.
+type jsonStore struct {
+	mu          sync.Mutex
+	path        string
+	collections map[string]map[string]json.RawMessage
+	// blobs holds a memory-only store's blobs by collection and key.
+	blobs map[string][]byte
+	// cipher encrypts sealedCollections, calling onUnseal after each
+	// decryption; nil stores them as plain JSON (see store_crypto.go).
+	cipher   *storeCipher
+	onUnseal func(collection, key string)
+}
+
+// newMemoryStore returns a store that never touches disk.
+func newMemoryStore() *jsonStore {
+	return &jsonStore{collections: map[string]map[string]json.RawMessage{}, blobs: map[string][]byte{}}
+}
+
+// newJSONStore opens (or lazily creates) the store file at path. An empty path
+// yields a memory-only store.
+func newJSONStore(path string) (*jsonStore, error) {
+	s := newMemoryStore()
+	if path == "" {
+		return s, nil
+	}
+	s.path = path
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read store %s: %w", path, err)
+	}
+	if len(raw) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(raw, &s.collections); err != nil {
+		return nil, fmt.Errorf("decode store %s: %w", path, err)
+	}
+	if s.collections == nil {
+		s.collections = map[string]map[string]json.RawMessage{}
+	}
+	return s, nil
+}
+
+// get decodes the document at collection/key into v. Returns false when the
+// key does not exist.
+func (s *jsonStore) get(collection, key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	raw, ok := s.collections[collection][key]
+	c, onUnseal := s.cipher, s.onUnseal
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if doc, sealed := parseSealed(raw); sealed {
+		plain, err := c.open(collection, key, doc)
+		if err != nil {
+			return true, fmt.Errorf("decode %s/%s: %w", collection, key, err)
+		}
+		raw = plain
+		if onUnseal != nil {
+			onUnseal(collection, key)
+		}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return true, fmt.Errorf("decode %s/%s: %w", collection, key, err)
+	}
+	return true, nil
+}
+
+// put stores v at collection/key, replacing any previous document.
+func (s *jsonStore) put(collection, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s/%s: %w", collection, key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if raw, err = s.sealLocked(collection, key, raw); err != nil {
+		return fmt.Errorf("encrypt %s/%s: %w", collection, key, err)
+	}
+	c := s.collections[collection]
+	if c == nil {
+		c = map[string]json.RawMessage{}
+		s.collections[collection] = c
+	}
+	c[key] = raw
+	return s.flushLocked()
+}
+
+// delete removes collection/key. Deleting a missing key is not an error.
+func (s *jsonStore) delete(collection, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.collections[collection]
+	if _, ok := c[key]; !ok {
+		return nil
+	}
+	delete(c, key)
+	return s.flushLocked()
+}
+
+// deleteKeys removes several keys from collection with a single write and
+// returns how many existed.
+func (s *jsonStore) deleteKeys(collection string, keys []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.collections[collection]
+	n := 0
+	for _, key := range keys {
+		if _, ok := c[key]; ok {
+			delete(c, key)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.flushLocked()
+}
+
+// collectionSize returns the number of documents in collection and their
+// encoded size in bytes.
+func (s *jsonStore) collectionSize(collection string) (docs, bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, raw := range s.collections[collection] {
+		bytes += len(raw)
+	}
+	return len(s.collections[collection]), bytes
+}
+
+// collectionNames returns the names of all collections in sorted order.
+func (s *jsonStore) collectionNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keys returns the collection's keys in sorted order.
+func (s *jsonStore) keys(collection string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.collections[collection]))
+	for k := range s.collections[collection] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// blobPath returns the file holding collection/key. Keys are hashed so any
+// string is a safe file name.
+func (s *jsonStore) blobPath(collection, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.path+".blobs", collection, hex.EncodeToString(sum[:]))
+}
+
+// putBlob stores data at collection/key, replacing any previous blob.
+func (s *jsonStore) putBlob(collection, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		s.blobs[collection+"/"+key] = data
+		return nil
+	}
+	return writeFileAtomic(s.blobPath(collection, key), data)
+}
+
+// getBlob returns the blob at collection/key. Returns false when it doesn't
+// exist.
+func (s *jsonStore) getBlob(collection, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		data, ok := s.blobs[collection+"/"+key]
+		return data, ok, nil
+	}
+	data, err := os.ReadFile(s.blobPath(collection, key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read blob %s/%s: %w", collection, key, err)
+	}
+	return data, true, nil
+}
+
+// deleteBlob removes the blob at collection/key. Deleting a missing blob is
+// not an error.
+func (s *jsonStore) deleteBlob(collection, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		delete(s.blobs, collection+"/"+key)
+		return nil
+	}
+	if err := os.Remove(s.blobPath(collection, key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete blob %s/%s: %w", collection, key, err)
+	}
+	return nil
+}
+
+// flushLocked mirrors the store to disk. Caller holds s.mu.
+func (s *jsonStore) flushLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(s.collections)
+	if err != nil {
+		return fmt.Errorf("encode store: %w", err)
+	}
+	if err := writeFileAtomic(s.path, raw); err != nil {
+		return fmt.Errorf("write store: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data via a temp file and
+// rename, so readers never see a torn file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pathfinder-store-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("replace file: %w", err)
+	}
+	return nil
+}
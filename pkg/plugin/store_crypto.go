@@ -0,0 +1,302 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Encryption of stored tokens and session metadata at rest.
+//
+// With the storageEncryptionKey secure field set, documents in the
+// collections that hold tokens or session metadata (sealedCollections) are
+// written to the store file encrypted with AES-256-GCM, under a key derived
+// from the secret with HKDF-SHA256 and bound to their collection and key.
+// To rotate, set the new secret and move the old one to
+// storageEncryptionPreviousKeys: at startup every document not sealed with
+// the current key is re-encrypted with it, and the rotation is recorded in
+// the audit log. Plaintext documents from before encryption was enabled
+// are sealed the same way. Reads of sealed documents are counted per
+// document and recorded in the audit log every storeAccessAuditEvery, one
+// entry per collection, and when the instance is disposed. A memory-only
+// store holds nothing at rest and isn't encrypted.
+
+const (
+	storeKeyInfo          = "grafana-pathfinder-app store v1"
+	storeKeyIDInfo        = "grafana-pathfinder-app store key id v1"
+	sealedDocVersion      = "aes-256-gcm-v1"
+	storeAccessAuditEvery = time.Hour
+	// maxAuditedStoreDocs caps the documents named in one access entry.
+	maxAuditedStoreDocs = 20
+)
+
+// sealedCollections hold claim tokens, proxy token grants, and workspace,
+// VM assignment and session metadata.
+var sealedCollections = []string{workshopCollection, workspaceCollection, vmProxyTokenCollection, userVMCollection, sessionRecordCollection}
+
+// sealedDoc is how an encrypted document is stored.
+type sealedDoc struct {
+	Sealed string `json:"sealed"`
+	KeyID  string `json:"kid"`
+	Data   []byte `json:"data"`
+}
+
+// storeKey is one derived key; ID names it in sealed documents without
+// revealing it.
+type storeKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// storeCipher seals with the first key and opens with any of them.
+type storeCipher struct {
+	keys []storeKey
+}
+
+func deriveStoreKey(secret string) (storeKey, error) {
+	key, err := hkdf.Key(sha256.New, []byte(secret), nil, storeKeyInfo, 32)
+	if err != nil {
+		return storeKey{}, err
+	}
+	id, err := hkdf.Key(sha256.New, []byte(secret), nil, storeKeyIDInfo, 6)
+	if err != nil {
+		return storeKey{}, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return storeKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return storeKey{}, err
+	}
+	return storeKey{id: hex.EncodeToString(id), aead: aead}, nil
+}
+
+// newStoreCipher returns nil when current is empty.
+func newStoreCipher(current string, previous []string) (*storeCipher, error) {
+	if current == "" {
+		return nil, nil
+	}
+	c := &storeCipher{}
+	for _, secret := range append([]string{current}, previous...) {
+		k, err := deriveStoreKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, k)
+	}
+	return c, nil
+}
+
+func (c *storeCipher) currentKeyID() string {
+	return c.keys[0].id
+}
+
+func sealedAAD(collection, key string) []byte {
+	return []byte(collection + "/" + key)
+}
+
+func (c *storeCipher) seal(collection, key string, plain json.RawMessage) (json.RawMessage, error) {
+	k := c.keys[0]
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(plain)+k.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedDoc{Sealed: sealedDocVersion, KeyID: k.id, Data: k.aead.Seal(nonce, nonce, plain, sealedAAD(collection, key))})
+}
+
+// parseSealed returns the envelope when raw is a sealed document.
+func parseSealed(raw json.RawMessage) (sealedDoc, bool) {
+	if !bytes.Contains(raw, []byte(`"sealed"`)) {
+		return sealedDoc{}, false
+	}
+	var doc sealedDoc
+	if err := json.Unmarshal(raw, &doc); err != nil || doc.Sealed != sealedDocVersion {
+		return sealedDoc{}, false
+	}
+	return doc, true
+}
+
+// open decrypts doc, stored at collection/key.
+func (c *storeCipher) open(collection, key string, doc sealedDoc) (json.RawMessage, error) {
+	if c == nil {
+		return nil, errors.New("document is encrypted and storageEncryptionKey isn't set")
+	}
+	for _, k := range c.keys {
+		if k.id != doc.KeyID {
+			continue
+		}
+		n := k.aead.NonceSize()
+		if len(doc.Data) < n {
+			return nil, errors.New("sealed document is truncated")
+		}
+		plain, err := k.aead.Open(nil, doc.Data[:n], doc.Data[n:], sealedAAD(collection, key))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt with key %s: %w", k.id, err)
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("document is encrypted with key %s, which is neither storageEncryptionKey nor in storageEncryptionPreviousKeys", doc.KeyID)
+}
+
+// setCipher makes the store encrypt sealedCollections with c, calling
+// onUnseal after each sealed document it decrypts. It does nothing for a
+// memory-only store.
+func (s *jsonStore) setCipher(c *storeCipher, onUnseal func(collection, key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		return
+	}
+	s.cipher = c
+	s.onUnseal = onUnseal
+}
+
+// sealLocked encrypts raw when collection is sealed. Caller holds s.mu.
+func (s *jsonStore) sealLocked(collection, key string, raw json.RawMessage) (json.RawMessage, error) {
+	if s.cipher == nil || !slices.Contains(sealedCollections, collection) {
+		return raw, nil
+	}
+	return s.cipher.seal(collection, key, raw)
+}
+
+// storeRotation is what resealStore changed: re-encrypted documents by the
+// key they were sealed with ("plaintext" for unencrypted ones), and
+// documents no configured key opens.
+type storeRotation struct {
+	KeyID      string
+	Resealed   map[string]int
+	Unreadable []string
+}
+
+// resealStore re-encrypts every document in sealedCollections that isn't
+// sealed with the current key, in one write.
+func (s *jsonStore) resealStore() (storeRotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cipher == nil {
+		return storeRotation{}, nil
+	}
+	rot := storeRotation{KeyID: s.cipher.currentKeyID(), Resealed: map[string]int{}}
+	for _, collection := range sealedCollections {
+		for key, raw := range s.collections[collection] {
+			from := "plaintext"
+			plain := raw
+			if doc, ok := parseSealed(raw); ok {
+				if doc.KeyID == rot.KeyID {
+					continue
+				}
+				var err error
+				if plain, err = s.cipher.open(collection, key, doc); err != nil {
+					rot.Unreadable = append(rot.Unreadable, collection+"/"+key)
+					continue
+				}
+				from = doc.KeyID
+			}
+			sealed, err := s.cipher.seal(collection, key, plain)
+			if err != nil {
+				return rot, err
+			}
+			s.collections[collection][key] = sealed
+			rot.Resealed[from]++
+		}
+	}
+	slices.Sort(rot.Unreadable)
+	if len(rot.Resealed) == 0 {
+		return rot, nil
+	}
+	return rot, s.flushLocked()
+}
+
+// storeAccessCounts counts reads of sealed documents, by collection and
+// key.
+type storeAccessCounts struct {
+	mu    sync.Mutex
+	reads map[string]map[string]int
+}
+
+func (t *storeAccessCounts) note(collection, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.reads == nil {
+		t.reads = map[string]map[string]int{}
+	}
+	if t.reads[collection] == nil {
+		t.reads[collection] = map[string]int{}
+	}
+	t.reads[collection][key]++
+}
+
+// take returns the counts and starts over.
+func (t *storeAccessCounts) take() map[string]map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reads := t.reads
+	t.reads = nil
+	return reads
+}
+
+// initStoreEncryption turns on encryption of sealedCollections, reseals
+// documents left by earlier keys and audits the rotation.
+func (a *App) initStoreEncryption(settings *Settings) {
+	c, err := newStoreCipher(settings.StorageEncryptionKey, settings.StorageEncryptionPreviousKeys)
+	if err != nil || c == nil {
+		if err != nil {
+			a.logger.Error("Store encryption disabled", "error", err)
+		}
+		return
+	}
+	a.store.setCipher(c, a.storeAccess.note)
+	a.runEvery(storeAccessAuditEvery, func(context.Context) { a.auditStoreAccess() })
+	rot, err := a.store.resealStore()
+	if err != nil {
+		a.logger.Error("Failed to re-encrypt the plugin store", "error", err)
+	}
+	if len(rot.Resealed) > 0 {
+		var from []string
+		for id, n := range rot.Resealed {
+			from = append(from, fmt.Sprintf("%d from %s", n, id))
+		}
+		slices.Sort(from)
+		a.recordAudit(a.logger, auditEntry{Actor: "system", Action: "store.key.rotate", Details: fmt.Sprintf("re-encrypted with key %s: %s", rot.KeyID, strings.Join(from, ", "))})
+	}
+	if len(rot.Unreadable) > 0 {
+		a.recordAudit(a.logger, auditEntry{Actor: "system", Action: "store.key.missing", Details: fmt.Sprintf("no configured key opens %d documents: %s", len(rot.Unreadable), strings.Join(rot.Unreadable[:min(len(rot.Unreadable), 20)], ", "))})
+	}
+}
+
+// auditStoreAccess records the sealed document reads since it last ran,
+// one audit entry per collection naming the documents and their reads.
+func (a *App) auditStoreAccess() {
+	reads := a.storeAccess.take()
+	for _, collection := range slices.Sorted(maps.Keys(reads)) {
+		keys := slices.Sorted(maps.Keys(reads[collection]))
+		total := 0
+		var docs []string
+		for _, key := range keys {
+			total += reads[collection][key]
+			if len(docs) < maxAuditedStoreDocs {
+				docs = append(docs, fmt.Sprintf("%s (%d)", key, reads[collection][key]))
+			}
+		}
+		details := fmt.Sprintf("%s: %d reads of %d documents: %s", collection, total, len(keys), strings.Join(docs, ", "))
+		if len(keys) > len(docs) {
+			details += fmt.Sprintf(" and %d more", len(keys)-len(docs))
+		}
+		a.recordAudit(a.logger, auditEntry{Actor: "system", Action: "store.secret.read", Details: details})
+	}
+}
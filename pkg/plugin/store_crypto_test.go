@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func openTestStore(t *testing.T, path string) *jsonStore {
+	t.Helper()
+	s, err := newJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStoreEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s := openTestStore(t, path)
+	c, err := newStoreCipher("first-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unsealed []string
+	s.setCipher(c, func(collection, key string) { unsealed = append(unsealed, collection+"/"+key) })
+	ws := workspace{Name: "lab", Owner: "ana", VMID: "vm-secret-123"}
+	if err := s.put(workspaceCollection, "ana/lab", ws); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put("preferences", "ana", storeDoc{Name: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "vm-secret-123") || !strings.Contains(string(raw), `"plain"`) {
+		t.Errorf("store file: %s", raw)
+	}
+	var got workspace
+	if ok, err := s.get(workspaceCollection, "ana/lab", &got); !ok || err != nil || got.VMID != "vm-secret-123" {
+		t.Fatalf("get: %v %v %+v", ok, err, got)
+	}
+	if len(unsealed) != 1 || unsealed[0] != "workspaces/ana/lab" {
+		t.Errorf("unsealed = %v", unsealed)
+	}
+
+	// A sealed document moved to another key doesn't open.
+	s.mu.Lock()
+	s.collections[workspaceCollection]["bob/lab"] = s.collections[workspaceCollection]["ana/lab"]
+	s.mu.Unlock()
+	if _, err := s.get(workspaceCollection, "bob/lab", &got); err == nil {
+		t.Error("moved document opened")
+	}
+
+	// Memory-only stores aren't encrypted.
+	m := newMemoryStore()
+	m.setCipher(c, nil)
+	if m.cipher != nil {
+		t.Error("memory store encrypted")
+	}
+}
+
+func TestStoreKeyRotation(t *testing.T) {
+	advance := withFrozenTime(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	// Documents written before encryption are sealed at startup.
+	s := openTestStore(t, path)
+	if err := s.put(workshopCollection, "ws1", workshop{Name: "ws1", VMs: []workshopVM{{ClaimToken: "claim-abc"}}}); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{logger: log.DefaultLogger, store: s}
+	app.initStoreEncryption(&Settings{StorageEncryptionKey: "first-secret"})
+	if raw, _ := os.ReadFile(path); strings.Contains(string(raw), "claim-abc") {
+		t.Errorf("plaintext left after enabling encryption: %s", raw)
+	}
+
+	// Rotating re-encrypts with the new key.
+	advance(time.Second)
+	app = &App{logger: log.DefaultLogger, store: openTestStore(t, path)}
+	app.initStoreEncryption(&Settings{StorageEncryptionKey: "second-secret", StorageEncryptionPreviousKeys: []string{"first-secret"}})
+	second, _ := newStoreCipher("second-secret", nil)
+	advance(time.Second)
+	var ws workshop
+	if ok, err := app.store.get(workshopCollection, "ws1", &ws); !ok || err != nil || ws.VMs[0].ClaimToken != "claim-abc" {
+		t.Fatalf("after rotation: %v %v %+v", ok, err, ws)
+	}
+	app.auditStoreAccess()
+	raw, _ := os.ReadFile(path)
+	if !strings.Contains(string(raw), `"kid":"`+second.currentKeyID()+`"`) {
+		t.Errorf("not resealed with the new key: %s", raw)
+	}
+
+	// Without the old key the document can't be read, which is audited.
+	advance(time.Second)
+	app = &App{logger: log.DefaultLogger, store: openTestStore(t, path)}
+	app.initStoreEncryption(&Settings{StorageEncryptionKey: "third-secret"})
+	if _, err := app.store.get(workshopCollection, "ws1", &ws); err == nil {
+		t.Error("opened without the key")
+	}
+
+	var actions []string
+	for _, key := range app.store.keys(auditCollection) {
+		var e auditEntry
+		_, _ = app.store.get(auditCollection, key, &e)
+		actions = append(actions, e.Action+": "+e.Details)
+	}
+	want := []string{
+		"store.key.rotate: re-encrypted with key " + mustKeyID(t, "first-secret") + ": 1 from plaintext",
+		"store.key.rotate: re-encrypted with key " + second.currentKeyID() + ": 1 from " + mustKeyID(t, "first-secret"),
+		"store.secret.read: workshops: 1 reads of 1 documents: ws1 (1)",
+		"store.key.missing: no configured key opens 1 documents: workshops/ws1",
+	}
+	if strings.Join(actions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit:\n%s\nwant:\n%s", strings.Join(actions, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAuditStoreAccess(t *testing.T) {
+	app := newTestApp(t)
+	for range 3 {
+		app.storeAccess.note(workspaceCollection, "alice/lab")
+	}
+	app.storeAccess.note(workspaceCollection, "bob/demo")
+	app.storeAccess.note(userVMCollection, "alice")
+	app.auditStoreAccess()
+	app.auditStoreAccess()
+
+	var details []string
+	for _, key := range app.store.keys(auditCollection) {
+		var e auditEntry
+		_, _ = app.store.get(auditCollection, key, &e)
+		if e.Action == "store.secret.read" {
+			details = append(details, e.Details)
+		}
+	}
+	want := []string{
+		"user-vms: 1 reads of 1 documents: alice (1)",
+		"workspaces: 4 reads of 2 documents: alice/lab (3), bob/demo (1)",
+	}
+	if strings.Join(details, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit:\n%s\nwant:\n%s", strings.Join(details, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func mustKeyID(t *testing.T, secret string) string {
+	t.Helper()
+	c, err := newStoreCipher(secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.currentKeyID()
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type storeDoc struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestJSONStore_MemoryRoundTrip(t *testing.T) {
+	s := newMemoryStore()
+
+	if ok, err := s.get("c", "missing", &storeDoc{}); ok || err != nil {
+		t.Fatalf("get missing: ok=%v err=%v", ok, err)
+	}
+
+	if err := s.put("c", "b", storeDoc{Name: "b", Count: 2}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := s.put("c", "a", storeDoc{Name: "a", Count: 1}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	var got storeDoc
+	if ok, err := s.get("c", "a", &got); !ok || err != nil || got.Count != 1 {
+		t.Fatalf("get a: ok=%v err=%v got=%+v", ok, err, got)
+	}
+
+	if keys := s.keys("c"); len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("keys = %v, want sorted [a b]", keys)
+	}
+
+	if err := s.delete("c", "a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := s.delete("c", "a"); err != nil {
+		t.Errorf("deleting a missing key should not error, got %v", err)
+	}
+	if keys := s.keys("c"); len(keys) != 1 {
+		t.Errorf("keys after delete = %v", keys)
+	}
+}
+
+func TestJSONStore_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "store.json")
+
+	s, err := newJSONStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := s.put("workspaces", "alice/lab", storeDoc{Name: "lab", Count: 3}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	reopened, err := newJSONStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	var got storeDoc
+	if ok, err := reopened.get("workspaces", "alice/lab", &got); !ok || err != nil || got.Count != 3 {
+		t.Fatalf("get after reopen: ok=%v err=%v got=%+v", ok, err, got)
+	}
+
+	// No temp files left behind by the atomic rewrite.
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("store dir has %d entries, want only the store file", len(entries))
+	}
+}
+
+func TestJSONStore_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newJSONStore(path); err == nil {
+		t.Error("expected an error for a corrupt store file")
+	}
+}
+
+func TestJSONStore_Blobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	for name, s := range map[string]*jsonStore{"memory": newMemoryStore(), "file": mustOpenStore(t, path)} {
+		if err := s.putBlob("assets", "guide/a.png", []byte("png")); err != nil {
+			t.Fatalf("%s put: %v", name, err)
+		}
+		if data, ok, err := s.getBlob("assets", "guide/a.png"); !ok || err != nil || string(data) != "png" {
+			t.Errorf("%s get: %q %v %v", name, data, ok, err)
+		}
+		if err := s.deleteBlob("assets", "guide/a.png"); err != nil {
+			t.Fatalf("%s delete: %v", name, err)
+		}
+		if _, ok, err := s.getBlob("assets", "guide/a.png"); ok || err != nil {
+			t.Errorf("%s get after delete: ok=%v err=%v", name, ok, err)
+		}
+		if err := s.deleteBlob("assets", "guide/a.png"); err != nil {
+			t.Errorf("%s delete missing: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".blobs"); err != nil {
+		t.Errorf("file store did not write blobs beside the store: %v", err)
+	}
+}
+
+func mustOpenStore(t *testing.T, path string) *jsonStore {
+	t.Helper()
+	s, err := newJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -22,11 +22,12 @@ package plugin
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	mrand "math/rand/v2"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -39,11 +40,42 @@ var _ backend.StreamHandler = (*App)(nil)
 
 // streamSession holds an active terminal streaming session
 type streamSession struct {
+	id        string // random, stable for the session's lifetime; used by admin APIs
 	vmID      string
 	userLogin string
+	channel   string // Live channel path
 	session   *TerminalSession
 	sender    *backend.StreamSender
 	cancel    context.CancelFunc
+	lastInput atomic.Int64 // unix nanos of the last "input" message
+	logLabels lokiLabels
+	template  string
+	startedAt time.Time
+	traffic   *sessionTraffic
+	// clientSchema is the schemaVersion the client last declared (see
+	// stream_schema.go); 0 until its first input.
+	clientSchema atomic.Int32
+	// lastAck is the unix nanos of the last heartbeat pong; 0 if the client
+	// never acknowledges (see stream_heartbeat.go).
+	lastAck atomic.Int64
+	// output sends and retains the session's output for replay (see
+	// output_pump.go).
+	output *outputPump
+	// lastInputSeq is the last accepted inputSeq (see input_replay.go).
+	lastInputSeq atomic.Int64
+	// recordedSeq is the output seq last written to the session's record
+	// (see session_records.go).
+	recordedSeq atomic.Int64
+}
+
+// touch records terminal activity for idle hibernation.
+func (s *streamSession) touch() {
+	s.lastInput.Store(timeNow().UnixNano())
+}
+
+// idleFor returns how long the session has gone without terminal input.
+func (s *streamSession) idleFor() time.Duration {
+	return timeNow().Sub(time.Unix(0, s.lastInput.Load()))
 }
 
 // streamSessions is managed on the App instance (see app.go)
@@ -61,12 +93,27 @@ func getUserLogin(req *backend.RunStreamRequest) string {
 
 // TerminalStreamOutput represents output messages to the frontend
 type TerminalStreamOutput struct {
-	Type    string `json:"type"` // "output", "error", "connected", "disconnected", "status"
-	Data    string `json:"data,omitempty"`
-	Error   string `json:"error,omitempty"`
-	State   string `json:"state,omitempty"`   // VM state for "status" type: "pending", "provisioning", "active"
-	Message string `json:"message,omitempty"` // Human-readable status message
-	VmId    string `json:"vmId,omitempty"`    // Actual VM ID being used (sent with "connected" and "status")
+	Type    string    `json:"type"` // "output", "error", "connected", "disconnected", "status", "health", "lock", "replay"
+	Data    string    `json:"data,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	State   string    `json:"state,omitempty"`   // VM state for "status" type: "pending", "provisioning", "active"
+	Message string    `json:"message,omitempty"` // Human-readable status message
+	VmId    string    `json:"vmId,omitempty"`    // Actual VM ID being used (sent with "connected" and "status")
+	Health  *VMHealth `json:"health,omitempty"`  // Probe details for "health" type
+	// Presence is the member list of a guide presence channel, sent with
+	// "presence".
+	Presence []guidePresence `json:"presence,omitempty"`
+	Holder   string          `json:"holder,omitempty"` // Write lock holder for "lock" type
+	// Countdown is the seconds left before a restart, sent with "draining".
+	Countdown int   `json:"countdown,omitempty"`
+	Seq       int64 `json:"seq,omitempty"` // Heartbeat number, echoed in "pong"; output number, sent back in "resume"
+	// CorrelationID identifies the session in plugin, relay and Coda logs;
+	// sent with "connected" and "error".
+	CorrelationID string `json:"correlationId,omitempty"`
+	// Capabilities is sent once, as the subscription's initial data.
+	Capabilities *StreamCapabilities `json:"capabilities,omitempty"`
+	// SchemaVersion is set on every frame by terminalFrame.
+	SchemaVersion int `json:"schemaVersion"`
 }
 
 // SubscribeStream is called when a client wants to subscribe to a stream.
@@ -75,10 +122,46 @@ type TerminalStreamOutput struct {
 // Special vmId values:
 //   - "new": Backend will provision a fresh VM in RunStream
 //   - Any other value: Treated as existing VM ID (will be validated/replaced in RunStream)
-func (a *App) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+func (a *App) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (_ *backend.SubscribeStreamResponse, err error) {
+	defer a.recoverStream(ctx, req.Path, nil, &err)
 	ctxLogger := a.ctxLogger(ctx)
 	ctxLogger.Info("SubscribeStream called", "path", req.Path)
 
+	// Presence doesn't touch sandboxes, so the terminal feature flag and
+	// kill switch don't apply.
+	if strings.HasPrefix(req.Path, presenceChannelPrefix+"/") {
+		return a.subscribePresenceStream(ctx, req)
+	}
+	if a.terminalStreamDenied(ctx) {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	if err := a.killSwitchError(); err != nil {
+		ctxLogger.Info("Refusing stream: kill switch engaged")
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	if a.drainRefuses(req.Path) {
+		ctxLogger.Info("Refusing stream: draining for restart")
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	if strings.HasPrefix(req.Path, tailChannelPrefix+"/") {
+		return a.subscribeTailStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, vmLogsChannelPrefix+"/") {
+		return a.subscribeVMLogsStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, scriptChannelPrefix+"/") {
+		return a.subscribeScriptStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, broadcastChannelPrefix+"/") {
+		return a.subscribeBroadcastStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, sharedTerminalChannelPrefix+"/") {
+		return a.subscribeSharedTerminalStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, takeoverChannelPrefix+"/") {
+		return a.subscribeTakeoverStream(ctx, req)
+	}
+
 	// Parse channel path: terminal/{vmId} or terminal/{vmId}/{nonce}
 	parts := strings.Split(req.Path, "/")
 	if len(parts) < 2 || parts[0] != "terminal" {
@@ -97,12 +180,10 @@ func (a *App) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamR
 		}, nil
 	}
 
-	// Allow "new" vmId - RunStream will provision a fresh VM
-	if vmID == "new" || vmID == "" {
+	// Allow "new" vmId and workspace names - RunStream will resolve the VM
+	if vmID == "new" || vmID == "" || workspaceNameFromChannel(vmID) != "" {
 		ctxLogger.Info("Stream subscription accepted for new VM provisioning")
-		return &backend.SubscribeStreamResponse{
-			Status: backend.SubscribeStreamStatusOK,
-		}, nil
+		return terminalSubscribeOK(), nil
 	}
 
 	// For existing vmId, verify VM exists (allow pending/provisioning VMs - RunStream will wait)
@@ -111,9 +192,7 @@ func (a *App) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamR
 	if err != nil {
 		// VM not found - still accept, RunStream will provision a new one
 		ctxLogger.Info("VM not found, will provision in RunStream", "vmID", vmID)
-		return &backend.SubscribeStreamResponse{
-			Status: backend.SubscribeStreamStatusOK,
-		}, nil
+		return terminalSubscribeOK(), nil
 	}
 
 	// Only reject destroyed or error states at subscription time for better UX
@@ -121,33 +200,53 @@ func (a *App) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamR
 	if vm.State == "destroyed" || vm.State == "destroying" || vm.State == "error" {
 		ctxLogger.Info("VM in terminal state, will provision replacement in RunStream", "vmID", vmID, "state", vm.State)
 		// Still accept - RunStream will handle provisioning a replacement
-		return &backend.SubscribeStreamResponse{
-			Status: backend.SubscribeStreamStatusOK,
-		}, nil
+		return terminalSubscribeOK(), nil
 	}
 
 	ctxLogger.Info("Stream subscription accepted", "vmID", vmID, "state", vm.State)
 
-	return &backend.SubscribeStreamResponse{
-		Status: backend.SubscribeStreamStatusOK,
-	}, nil
+	return terminalSubscribeOK(), nil
 }
 
 // TerminalInput represents input sent to the terminal from the frontend via PublishStream.
 type TerminalInput struct {
-	Type string `json:"type"` // "input", "resize"
-	Data string `json:"data,omitempty"`
-	Rows int    `json:"rows,omitempty"`
-	Cols int    `json:"cols,omitempty"`
+	Type string `json:"type" validate:"required,oneof=input paste resize pong resume lock-request lock-release lock-handoff"` // "lock-*" only on shared sessions
+	Data string `json:"data,omitempty" validate:"max=262144"`
+	Rows int    `json:"rows,omitempty" validate:"min=1,max=1000"`
+	Cols int    `json:"cols,omitempty" validate:"min=1,max=1000"`
+	Seq  int64  `json:"seq,omitempty"` // Heartbeat being acknowledged, for "pong"; last output received, for "resume"
+	// SchemaVersion is the client's frame schema; 0 for legacy clients.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// SessionID and InputSeq protect "input" and "paste" from replay (see
+	// input_replay.go).
+	SessionID string `json:"sessionId,omitempty" validate:"max=100"`
+	InputSeq  int64  `json:"inputSeq,omitempty" validate:"min=0"`
 }
 
 // PublishStream is called when a client publishes a message to a stream.
 // This handles terminal input from the frontend (keyboard input, resize events)
 // over the same Grafana Live WebSocket used for output streaming.
-func (a *App) PublishStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+func (a *App) PublishStream(ctx context.Context, req *backend.PublishStreamRequest) (_ *backend.PublishStreamResponse, err error) {
+	defer a.recoverStream(ctx, req.Path, nil, &err)
 	ctxLogger := a.ctxLogger(ctx)
 	ctxLogger.Debug("PublishStream called", "path", req.Path, "dataLen", len(req.Data))
 
+	if strings.HasPrefix(req.Path, presenceChannelPrefix+"/") {
+		return a.publishPresenceStream(ctx, req)
+	}
+	if a.terminalStreamDenied(ctx) {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+	if strings.HasPrefix(req.Path, broadcastChannelPrefix+"/") {
+		return a.publishBroadcastStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, sharedTerminalChannelPrefix+"/") {
+		return a.publishSharedTerminalStream(ctx, req)
+	}
+	if strings.HasPrefix(req.Path, takeoverChannelPrefix+"/") {
+		return a.publishTakeoverStream(ctx, req)
+	}
+
 	// Parse channel path: terminal/{vmId} or terminal/{vmId}/{nonce}
 	parts := strings.Split(req.Path, "/")
 	if len(parts) < 2 || parts[0] != "terminal" {
@@ -170,22 +269,79 @@ func (a *App) PublishStream(ctx context.Context, req *backend.PublishStreamReque
 			Status: backend.PublishStreamStatusNotFound,
 		}, nil
 	}
+	ctx = withCorrelationID(ctx, sess.id)
+	ctxLogger = a.ctxLogger(ctx)
 
 	// Parse the input message
-	var input TerminalInput
-	if err := json.Unmarshal(req.Data, &input); err != nil {
-		ctxLogger.Error("PublishStream: failed to parse input", "error", err, "data", string(req.Data))
-		return nil, fmt.Errorf("invalid terminal input: %w", err)
+	input, err := a.parseTerminalInput(req.Data)
+	if err != nil {
+		ctxLogger.Warn("PublishStream: invalid input", "error", err, "dataLen", len(req.Data))
+		return nil, err
+	}
+	sess.clientSchema.Store(int32(input.SchemaVersion))
+
+	// Pongs and resumes come from whoever owns the subscription, so they
+	// bypass the takeover and write-lock checks below.
+	if input.Type == "pong" {
+		sess.ackHeartbeat()
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
+	}
+	if input.Type == "resume" {
+		if sess.output != nil {
+			if err := sess.output.replay(sess.sender, input.Seq); err != nil {
+				ctxLogger.Warn("PublishStream: failed to replay output", "vmID", vmID, "error", err)
+			}
+		}
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
 	}
 
-	// Handle the message
+	if input.Type == "input" || input.Type == "paste" {
+		if err := a.checkInputSeq(sess, input); err != nil {
+			ctxLogger.Warn("PublishStream: rejected replayed or out-of-order input", "vmID", vmID, "error", err)
+			return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+		}
+	}
+
+	// While an admin has taken over the session, the learner cannot type.
+	if (input.Type == "input" || input.Type == "paste") && a.getTakeover(sess.id) != nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+
+	// A shared session only accepts input from the write lock holder, which
+	// may not be the owner.
+	for _, shared := range a.sharedTerminalsFor(sess.userLogin, sess.vmID) {
+		if status, handled := a.applySharedInput(ctxLogger, shared, sess.userLogin, input); handled {
+			return &backend.PublishStreamResponse{Status: status}, nil
+		}
+	}
+
+	a.applyTerminalInput(ctxLogger, sess, input)
+
+	return &backend.PublishStreamResponse{
+		Status: backend.PublishStreamStatusOK,
+	}, nil
+}
+
+// applyTerminalInput forwards one input message to the session's SSH shell.
+func (a *App) applyTerminalInput(ctxLogger log.Logger, sess *streamSession, input TerminalInput) {
+	vmID := sess.vmID
 	switch input.Type {
 	case "input":
+		sess.touch()
+		sess.traffic.recordIn(len(input.Data))
 		if err := sess.session.Write([]byte(input.Data)); err != nil {
 			ctxLogger.Error("PublishStream: failed to write to SSH", "vmID", vmID, "error", err)
 		} else {
 			ctxLogger.Debug("PublishStream: wrote input to SSH", "vmID", vmID, "dataLen", len(input.Data))
 		}
+	case "paste":
+		sess.touch()
+		sess.traffic.recordIn(len(input.Data))
+		if err := sess.session.Paste(input.Data); err != nil {
+			ctxLogger.Error("PublishStream: failed to paste to SSH", "vmID", vmID, "error", err)
+		} else {
+			ctxLogger.Debug("PublishStream: pasted input to SSH", "vmID", vmID, "dataLen", len(input.Data))
+		}
 	case "resize":
 		if input.Rows > 0 && input.Cols > 0 {
 			if err := sess.session.Resize(input.Rows, input.Cols); err != nil {
@@ -197,21 +353,22 @@ func (a *App) PublishStream(ctx context.Context, req *backend.PublishStreamReque
 	default:
 		ctxLogger.Warn("PublishStream: unknown input type", "type", input.Type)
 	}
-
-	return &backend.PublishStreamResponse{
-		Status: backend.PublishStreamStatusOK,
-	}, nil
 }
 
 // sendStreamError sends an error message to the frontend via the stream
-func sendStreamError(sender *backend.StreamSender, errMsg string) {
+func sendStreamError(ctx context.Context, sender *backend.StreamSender, errMsg string) {
 	output := TerminalStreamOutput{
-		Type:  "error",
-		Error: errMsg,
+		Type:          "error",
+		Error:         errMsg,
+		CorrelationID: correlationIDFromContext(ctx),
 	}
-	jsonBytes, _ := json.Marshal(output)
-	frame := data.NewFrame("terminal")
-	frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+	frame := terminalFrame(output)
+	_ = sender.SendFrame(frame, data.IncludeAll)
+}
+
+// sendStreamMessage sends an arbitrary output message to the frontend via the stream
+func sendStreamMessage(sender *backend.StreamSender, output TerminalStreamOutput) {
+	frame := terminalFrame(output)
 	_ = sender.SendFrame(frame, data.IncludeAll)
 }
 
@@ -223,9 +380,7 @@ func sendStreamStatusWithVmId(sender *backend.StreamSender, state string, messag
 		Message: message,
 		VmId:    vmId,
 	}
-	jsonBytes, _ := json.Marshal(output)
-	frame := data.NewFrame("terminal")
-	frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+	frame := terminalFrame(output)
 	_ = sender.SendFrame(frame, data.IncludeAll)
 }
 
@@ -238,6 +393,12 @@ func statusMessageForState(state string) string {
 		return "VM is booting..."
 	case "active":
 		return "VM is ready"
+	case "stopping":
+		return "VM is hibernating..."
+	case "stopped":
+		return "VM is hibernated"
+	case "starting":
+		return "Resuming hibernated VM..."
 	default:
 		return fmt.Sprintf("VM state: %s", state)
 	}
@@ -291,19 +452,83 @@ func isSSHRetryableError(err error) bool {
 
 // SSH retry constants
 const (
-	maxSSHRetries         = 3                // SSH connection retries on the same VM
-	maxCredentialRefreshes = 2               // Times to re-fetch credentials on auth failure before giving up
-	sshRetryDelay         = 5 * time.Second  // Delay between same-VM retries
-	maxUserVMs            = 3                // Hard limit on non-terminal VMs per user
+	maxSSHRetries          = 5                // SSH connection retries on the same VM
+	maxCredentialRefreshes = 2                // Times to re-fetch credentials on auth failure before giving up
+	sshRetryBaseDelay      = 2 * time.Second  // First same-VM retry delay, doubled per attempt
+	sshRetryMaxDelay       = 20 * time.Second // Cap on a single same-VM retry delay
+	sshRetryJitter         = 0.2              // Fraction of the delay randomized either way
+	maxUserVMs             = 3                // Hard limit on non-terminal VMs per user
 )
 
-// waitForVMActive polls until VM is active and returns it, sending status updates
+// sshRetryBackoff returns the delay after the given (1-based) failed attempt:
+// sshRetryBaseDelay doubled per attempt, spread by jitter (in [-1, 1]) times
+// sshRetryJitter so sessions waiting on the same VM don't reconnect in
+// lockstep, and capped at sshRetryMaxDelay.
+func sshRetryBackoff(attempt int, jitter float64) time.Duration {
+	d := sshRetryBaseDelay << min(max(attempt-1, 0), 10)
+	d = time.Duration(float64(d) * (1 + jitter*sshRetryJitter))
+	return min(d, sshRetryMaxDelay)
+}
+
+// waitSSHRetry sleeps for d or until ctx is done.
+func waitSSHRetry(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+const (
+	vmActivePollInterval   = 3 * time.Second
+	defaultVMActiveTimeout = 3 * time.Minute
+)
+
+// relayTimeouts returns the configured relay and SSH handshake timeouts.
+func (a *App) relayTimeouts() RelayTimeouts {
+	if a.settings == nil {
+		return RelayTimeouts{}
+	}
+	return RelayTimeouts{
+		WebSocketHandshake: time.Duration(a.settings.RelayHandshakeTimeoutSeconds) * time.Second,
+		SSHHandshake:       time.Duration(a.settings.SSHHandshakeTimeoutSeconds) * time.Second,
+	}
+}
+
+// vmActiveTimeout returns how long waitForVMActive waits for a VM.
+func (a *App) vmActiveTimeout() time.Duration {
+	if a.settings == nil || a.settings.VMActiveTimeoutSeconds <= 0 {
+		return defaultVMActiveTimeout
+	}
+	return time.Duration(a.settings.VMActiveTimeoutSeconds) * time.Second
+}
+
+// waitForVMActive polls until VM is active and returns it, sending status updates.
+// A hibernated VM is resumed once it reaches "stopped".
 func (a *App) waitForVMActive(ctx context.Context, sender *backend.StreamSender, vmID string) (*VM, error) {
 	ctxLogger := a.ctxLogger(ctx)
-	ticker := time.NewTicker(3 * time.Second)
+	ticker := time.NewTicker(vmActivePollInterval)
 	defer ticker.Stop()
 
-	maxAttempts := 60 // 3 minutes max wait
+	resumeRequested := false
+	resume := func() {
+		if resumeRequested {
+			return
+		}
+		resumeRequested = true
+		ctxLogger.Info("Resuming hibernated VM", "vmID", vmID)
+		sendStreamStatusWithVmId(sender, "starting", statusMessageForState("starting"), vmID)
+		if err := a.coda.StartVM(ctx, vmID); err != nil {
+			ctxLogger.Warn("Failed to resume VM, will retry", "vmID", vmID, "error", err)
+			resumeRequested = false
+		}
+	}
+	if vm, err := a.coda.GetVM(ctx, vmID); err == nil && vm.State == "stopped" {
+		resume()
+	}
+
+	maxAttempts := max(int(a.vmActiveTimeout()/vmActivePollInterval), 1)
 	for attempts := 0; attempts < maxAttempts; attempts++ {
 		select {
 		case <-ctx.Done():
@@ -320,15 +545,20 @@ func (a *App) waitForVMActive(ctx context.Context, sender *backend.StreamSender,
 				if vm.ErrorMessage != nil {
 					errMsg = fmt.Sprintf("VM provisioning failed: %s", *vm.ErrorMessage)
 				}
-				sendStreamError(sender, errMsg)
+				sendStreamError(ctx, sender, errMsg)
 				return nil, errors.New(errMsg)
 			}
 			if vm.State == "destroyed" || vm.State == "destroying" {
 				errMsg := "VM was destroyed"
-				sendStreamError(sender, errMsg)
+				sendStreamError(ctx, sender, errMsg)
 				return nil, errors.New(errMsg)
 			}
 
+			if vm.State == "stopped" {
+				resume()
+				continue
+			}
+
 			sendStreamStatusWithVmId(sender, vm.State, statusMessageForState(vm.State), vmID)
 
 			if vm.State == "active" && vm.Credentials != nil {
@@ -338,7 +568,7 @@ func (a *App) waitForVMActive(ctx context.Context, sender *backend.StreamSender,
 	}
 
 	errMsg := "timeout waiting for VM to become active"
-	sendStreamError(sender, errMsg)
+	sendStreamError(ctx, sender, errMsg)
 	return nil, errors.New(errMsg)
 }
 
@@ -444,7 +674,7 @@ func (a *App) resolveVMForUser(ctx context.Context, sender *backend.StreamSender
 	ctxLogger.Info("Querying Coda for existing VMs", "userLogin", userLogin)
 	sendStreamStatusWithVmId(sender, "checking", "Looking for your existing VM...", "")
 
-	existingVM, surplusVMs, err := a.coda.FindActiveVMForUser(ctx, userLogin)
+	existingVM, surplusVMs, err := a.coda.FindActiveVMForUser(ctx, userLogin, a.workspaceVMIDs(userLogin))
 	if err != nil {
 		ctxLogger.Warn("FindActiveVMForUser failed, proceeding to create", "error", err)
 	}
@@ -455,9 +685,7 @@ func (a *App) resolveVMForUser(ctx context.Context, sender *backend.StreamSender
 
 		if templateMatch && appMatch && scenarioMatch {
 			ctxLogger.Info("Found existing VM via ListVMs", "vmID", existingVM.ID, "state", existingVM.State, "surplusCount", len(surplusVMs))
-			a.userVMsMu.Lock()
-			a.userVMs[userLogin] = existingVM.ID
-			a.userVMsMu.Unlock()
+			a.setUserVM(userLogin, existingVM.ID)
 
 			if len(surplusVMs) > 0 {
 				ctxLogger.Info("Destroying surplus VMs for user", "userLogin", userLogin, "count", len(surplusVMs))
@@ -490,9 +718,7 @@ func (a *App) resolveVMForUser(ctx context.Context, sender *backend.StreamSender
 
 		if matchingSurplus != nil {
 			ctxLogger.Info("Found matching VM in surplus list", "vmID", matchingSurplus.ID, "state", matchingSurplus.State)
-			a.userVMsMu.Lock()
-			a.userVMs[userLogin] = matchingSurplus.ID
-			a.userVMsMu.Unlock()
+			a.setUserVM(userLogin, matchingSurplus.ID)
 
 			// Destroy the non-matching primary and other non-matching surplus in background
 			primaryToDelete := existingVM.ID
@@ -538,7 +764,21 @@ func (a *App) resolveVMForUser(ctx context.Context, sender *backend.StreamSender
 		ctxLogger.Info("Mismatch VM deletions completed", "count", len(mismatchVMsToDelete))
 	}
 
-	// Step 3: No usable VM -- check quota then create.
+	// Step 3: No usable VM -- use the user's claimed workshop VM or take one
+	// from an active workshop schedule if there is one, otherwise check quota
+	// then create.
+	if vmConfig == nil {
+		vm := a.workshopVMForUser(ctx, userLogin, userEmailFromContext(ctx), requestedTemplate)
+		if vm == nil {
+			vm = a.claimScheduledVM(ctx, userLogin, requestedTemplate, ctxLogger)
+		}
+		if vm != nil {
+			a.setUserVM(userLogin, vm.ID)
+			sendStreamStatusWithVmId(sender, vm.State, "Assigned a pre-provisioned workshop VM", vm.ID)
+			return vm, vm.ID, nil
+		}
+	}
+
 	// If quota is full, force-destroy all the user's non-matching VMs and retry
 	// once, since the user clearly needs a different VM type.
 	ctxLogger.Info("No existing VM found, checking quota", "userLogin", userLogin)
@@ -547,11 +787,20 @@ func (a *App) resolveVMForUser(ctx context.Context, sender *backend.StreamSender
 		ctxLogger.Info("Quota full, cleaning up stale VMs before creating", "userLogin", userLogin, "count", count)
 		if cleaned := a.cleanupUserVMsForQuota(ctx, sender, userLogin, ctxLogger); !cleaned {
 			errMsg := fmt.Sprintf("VM quota exceeded: you already have %d VMs (max %d), please wait for existing VMs to expire", count, maxUserVMs)
-			sendStreamError(sender, errMsg)
+			sendStreamError(ctx, sender, errMsg)
 			return nil, "", errors.New(errMsg)
 		}
 	}
 
+	if err := a.featureError(featureVMProvisioning); err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return nil, "", err
+	}
+	if err := a.checkOrgQuota(); err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return nil, "", err
+	}
+
 	ctxLogger.Info("Provisioning new VM", "userLogin", userLogin, "template", requestedTemplate)
 	sendStreamStatusWithVmId(sender, "provisioning", "Provisioning new VM...", "")
 
@@ -568,14 +817,14 @@ func (a *App) resolveVMForUser(ctx context.Context, sender *backend.StreamSender
 		}
 		if createErr != nil {
 			errMsg := fmt.Sprintf("Failed to create VM: %v", createErr)
-			sendStreamError(sender, errMsg)
+			sendStreamError(ctx, sender, errMsg)
 			return nil, "", fmt.Errorf("failed to create VM: %w", createErr)
 		}
 	}
 
-	a.userVMsMu.Lock()
-	a.userVMs[userLogin] = vm.ID
-	a.userVMsMu.Unlock()
+	a.recordVMProvisioned(ctxLogger)
+
+	a.setUserVM(userLogin, vm.ID)
 
 	ctxLogger.Info("New VM created", "userLogin", userLogin, "vmID", vm.ID, "state", vm.State, "template", requestedTemplate)
 	sendStreamStatusWithVmId(sender, vm.State, "VM allocated, waiting for boot...", vm.ID)
@@ -593,13 +842,17 @@ func (a *App) getVMWithRetry(ctx context.Context, vmID string) (*VM, error) {
 	return a.coda.GetVM(ctx, vmID)
 }
 
-// clearUserVM removes a VM from the in-memory cache if it matches the expected ID.
+// clearUserVM removes a user's VM assignment if it matches the expected ID.
 func (a *App) clearUserVM(userLogin, vmID string) {
 	a.userVMsMu.Lock()
-	if a.userVMs[userLogin] == vmID {
+	matched := a.userVMs[userLogin] == vmID
+	if matched {
 		delete(a.userVMs, userLogin)
 	}
 	a.userVMsMu.Unlock()
+	if matched && a.store != nil {
+		_ = a.store.delete(userVMCollection, userLogin)
+	}
 }
 
 // cleanupUserVMsForQuota force-destroys all of a user's VMs and waits for
@@ -612,9 +865,10 @@ func (a *App) cleanupUserVMsForQuota(ctx context.Context, sender *backend.Stream
 		return false
 	}
 
+	workspaceVMs := a.workspaceVMIDs(userLogin)
 	var toDelete []string
 	for i := range vms {
-		if isUsableState(vms[i].State) {
+		if isUsableState(vms[i].State) && !workspaceVMs[vms[i].ID] {
 			toDelete = append(toDelete, vms[i].ID)
 		}
 	}
@@ -638,9 +892,7 @@ func (a *App) cleanupUserVMsForQuota(ctx context.Context, sender *backend.Stream
 	}
 	wg.Wait()
 
-	a.userVMsMu.Lock()
-	delete(a.userVMs, userLogin)
-	a.userVMsMu.Unlock()
+	a.forgetUserVM(userLogin)
 
 	// Poll until Coda's count drops below the limit. VMs transition through
 	// "destroying" before disappearing, and Coda's server-side quota counts
@@ -672,22 +924,46 @@ func (a *App) cleanupUserVMsForQuota(ctx context.Context, sender *backend.Stream
 
 // RunStream is called once for each active stream subscription.
 // It runs for the lifetime of the stream, sending data to the client.
-func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) (err error) {
+	ctx = withCorrelationID(ctx, newCorrelationID())
+	defer a.recoverStream(ctx, req.Path, sender, &err)
 	ctxLogger := a.ctxLogger(ctx)
 	ctxLogger.Info("RunStream started", "path", req.Path)
 
+	if strings.HasPrefix(req.Path, presenceChannelPrefix+"/") {
+		return a.runPresenceStream(ctx, req, sender)
+	}
+	if strings.HasPrefix(req.Path, tailChannelPrefix+"/") {
+		return a.runTailStream(ctx, req, sender)
+	}
+	if strings.HasPrefix(req.Path, vmLogsChannelPrefix+"/") {
+		return a.runVMLogsStream(ctx, req, sender)
+	}
+	if strings.HasPrefix(req.Path, scriptChannelPrefix+"/") {
+		return a.runScriptStream(ctx, req, sender)
+	}
+	if strings.HasPrefix(req.Path, broadcastChannelPrefix+"/") {
+		return a.runBroadcastStream(ctx, req, sender)
+	}
+	if strings.HasPrefix(req.Path, sharedTerminalChannelPrefix+"/") {
+		return a.runSharedTerminalStream(ctx, req, sender)
+	}
+	if strings.HasPrefix(req.Path, takeoverChannelPrefix+"/") {
+		return a.runTakeoverStream(ctx, req, sender)
+	}
+
 	// Parse channel path: terminal/{vmId} or terminal/{vmId}/{nonce}
 	parts := strings.Split(req.Path, "/")
 	if len(parts) < 2 || parts[0] != "terminal" {
 		errMsg := fmt.Sprintf("invalid path: %s", req.Path)
-		sendStreamError(sender, errMsg)
+		sendStreamError(ctx, sender, errMsg)
 		return errors.New(errMsg)
 	}
 
 	// Get VM credentials
 	if a.coda == nil {
 		errMsg := "coda not registered - configure enrollment key and register first"
-		sendStreamError(sender, errMsg)
+		sendStreamError(ctx, sender, errMsg)
 		return errors.New(errMsg)
 	}
 
@@ -699,8 +975,16 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 	//   terminal/{vmId}/{nonce}                       → default (vm-aws)
 	//   terminal/{vmId}/{nonce}/{template}             → custom template, no app
 	//   terminal/{vmId}/{nonce}/{template}/{app}       → custom template + app name
+	//   terminal/{vmId}/{nonce}/guide.{guideId}        → template mapped to the guide
 	var reqOpts vmRequestOpts
-	if len(parts) >= 4 && parts[3] != "" {
+	var guideID string
+	if len(parts) >= 4 {
+		guideID = guideIDFromTemplateSegment(parts[3])
+	}
+	if guideID != "" {
+		reqOpts = a.guideVMRequestOpts(guideID)
+		ctxLogger.Info("Guide VM template resolved", "guideId", guideID, "template", reqOpts.template, "config", reqOpts.config)
+	} else if len(parts) >= 4 && parts[3] != "" {
 		reqOpts.template = parts[3]
 		if len(parts) >= 5 && parts[4] != "" {
 			configKey := "app"
@@ -719,8 +1003,16 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 		ctxLogger.Info("Custom VM template requested", "template", reqOpts.template, "config", reqOpts.config)
 	}
 
-	// Resolve a VM: reuse existing or create new (with quota check)
-	vm, vmID, err := a.resolveVMForUser(ctx, sender, userLogin, reqOpts)
+	// Resolve a VM: reattach to a named workspace, or reuse existing / create
+	// new (with quota check)
+	workspaceName := workspaceNameFromChannel(parts[1])
+	var vm *VM
+	var vmID string
+	if workspaceName != "" {
+		vm, vmID, err = a.resolveWorkspaceVM(ctx, sender, userLogin, workspaceName)
+	} else {
+		vm, vmID, err = a.resolveVMForUser(ctx, sender, userLogin, reqOpts)
+	}
 	if err != nil {
 		return err
 	}
@@ -741,20 +1033,23 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 	streamCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Output callback - sends data to frontend via Grafana Live
-	onOutput := func(outputBytes []byte) {
-		output := TerminalStreamOutput{
-			Type: "output",
-			Data: string(outputBytes),
-		}
-		jsonBytes, _ := json.Marshal(output)
+	logLabels := lokiLabels{user: userLogin, vmID: vmID, guide: guideID}
+	traffic := &sessionTraffic{}
 
-		frame := data.NewFrame("terminal")
-		frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+	// Output is buffered and sent to the frontend by the pump; a full buffer
+	// blocks onOutput and so pauses SSH reads (see output_pump.go)
+	pump := newOutputPump(a.outputBufferLimit(), a.replayBufferLimit(), a.liveFrameBudget())
+	defer pump.close()
+	go pump.drain(sender, func(err error) {
+		ctxLogger.Error("Failed to send frame", "error", err)
+	})
 
-		if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
-			ctxLogger.Error("Failed to send frame", "error", err)
-		}
+	// Output callback - queues data for the frontend
+	onOutput := func(outputBytes []byte) {
+		traffic.recordOut(len(outputBytes))
+		a.loki.output(logLabels, outputBytes)
+		a.fanOutTerminalOutput(userLogin, vmID, outputBytes)
+		pump.write(outputBytes)
 	}
 
 	// Error callback
@@ -763,10 +1058,7 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 			Type:  "error",
 			Error: err.Error(),
 		}
-		jsonBytes, _ := json.Marshal(output)
-
-		frame := data.NewFrame("terminal")
-		frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+		frame := terminalFrame(output)
 		_ = sender.SendFrame(frame, data.IncludeAll)
 	}
 
@@ -774,23 +1066,25 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 	// On auth failures, re-fetches credentials from GetVM before retrying.
 	// On retryable errors (timeout, connection refused), retries with a delay.
 	var session *TerminalSession
+	var sessionKey *sessionSSHKey
 	var lastErr error
 	credentialRefreshCount := 0
 
 	// Relay URL checks (invariant for the loop)
 	if a.settings.CodaRelayURL == "" {
-		sendStreamError(sender, "Relay URL not configured - SSH connections require the WebSocket relay")
+		sendStreamError(ctx, sender, "Relay URL not configured - SSH connections require the WebSocket relay")
 		return errors.New("relay URL not configured")
 	}
 	if !IsAllowedRelayURL(a.settings.CodaRelayURL) {
 		ctxLogger.Error("Relay URL not in allowlist", "relayURL", a.settings.CodaRelayURL)
-		sendStreamError(sender, "Relay URL is not a trusted host")
+		sendStreamError(ctx, sender, "Relay URL is not a trusted host")
 		return errors.New("relay URL not in allowlist")
 	}
 
 	sendStreamStatusWithVmId(sender, "ssh_connecting", "Establishing SSH connection...", vmID)
 
 	for sshRetry := 1; sshRetry <= maxSSHRetries; sshRetry++ {
+		retryDelay := sshRetryBackoff(sshRetry, mrand.Float64()*2-1)
 		select {
 		case <-ctx.Done():
 			ctxLogger.Info("Connection cancelled by user", "vmID", vmID)
@@ -812,11 +1106,11 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 		accessToken, err := a.coda.GetAccessToken(ctx)
 		if err != nil {
 			ctxLogger.Error("Failed to get access token for relay", "error", err)
-			sendStreamError(sender, fmt.Sprintf("Authentication failed: %v", err))
+			sendStreamError(ctx, sender, fmt.Sprintf("Authentication failed: %v", err))
 			return fmt.Errorf("failed to get access token: %w", err)
 		}
 
-		sshClient, err := ConnectSSHViaRelay(a.settings.CodaRelayURL, vmID, vm.Credentials, accessToken)
+		sshClient, err := ConnectSSHViaRelay(ctx, a.settings.CodaRelayURL, vmID, vm.Credentials, accessToken, a.relayTimeouts())
 		if err != nil {
 			lastErr = err
 			ctxLogger.Warn("Relay connection failed", "vmID", vmID, "error", err, "sshRetry", sshRetry)
@@ -826,12 +1120,12 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 				ctxLogger.Info("SSH auth failed, refreshing credentials from GetVM",
 					"vmID", vmID, "refreshCount", credentialRefreshCount)
 				sendStreamStatusWithVmId(sender, "retrying",
-					fmt.Sprintf("Refreshing credentials (%d/%d)...", credentialRefreshCount, maxCredentialRefreshes), vmID)
+					fmt.Sprintf("Refreshing credentials, retrying in %s (%d/%d)...", retryDelay.Round(time.Second), credentialRefreshCount, maxCredentialRefreshes), vmID)
 
 				refreshedVM, refreshErr := a.coda.GetVM(ctx, vmID)
 				if refreshErr == nil && refreshedVM.State == "active" && refreshedVM.Credentials != nil {
 					vm = refreshedVM
-					time.Sleep(sshRetryDelay)
+					waitSSHRetry(ctx, retryDelay)
 					continue
 				}
 				ctxLogger.Warn("Credential refresh failed or VM not active", "vmID", vmID, "error", refreshErr)
@@ -839,27 +1133,33 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 			}
 
 			if isSSHRetryableError(err) && sshRetry < maxSSHRetries {
-				ctxLogger.Info("SSH not ready, will retry", "vmID", vmID, "sshRetry", sshRetry)
+				ctxLogger.Info("SSH not ready, will retry", "vmID", vmID, "sshRetry", sshRetry, "delay", retryDelay.String())
 				sendStreamStatusWithVmId(sender, "retrying",
-					fmt.Sprintf("SSH not ready, retrying (%d/%d)...", sshRetry, maxSSHRetries), vmID)
-				time.Sleep(sshRetryDelay)
+					fmt.Sprintf("SSH not ready, retrying in %s (%d/%d)...", retryDelay.Round(time.Second), sshRetry, maxSSHRetries), vmID)
+				waitSSHRetry(ctx, retryDelay)
 				continue
 			}
 
 			break
 		}
 
+		if a.sessionSSHKeysEnabled() {
+			sshClient, sessionKey = a.switchToSessionSSHKey(ctx, ctxLogger, sshClient, vmID, vm.Credentials, accessToken)
+		}
+
 		ctxLogger.Info("Relay connection established, creating terminal session", "vmID", vmID)
 		session, err = NewTerminalSessionWithClient(vmID, sshClient, onOutput, onError)
 		if err != nil {
+			a.revokeSessionSSHKey(ctxLogger, sessionKey, sshClient)
+			sessionKey = nil
 			_ = sshClient.Close()
 			lastErr = err
 			ctxLogger.Warn("Failed to create terminal session", "vmID", vmID, "error", err, "sshRetry", sshRetry)
 
 			if isSSHRetryableError(err) && sshRetry < maxSSHRetries {
 				sendStreamStatusWithVmId(sender, "retrying",
-					fmt.Sprintf("SSH not ready, retrying (%d/%d)...", sshRetry, maxSSHRetries), vmID)
-				time.Sleep(sshRetryDelay)
+					fmt.Sprintf("SSH not ready, retrying in %s (%d/%d)...", retryDelay.Round(time.Second), sshRetry, maxSSHRetries), vmID)
+				waitSSHRetry(ctx, retryDelay)
 				continue
 			}
 			break
@@ -872,39 +1172,63 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 	if session == nil {
 		errMsg := fmt.Sprintf("SSH connection failed (last error: %v). Press Connect to try again.", lastErr)
 		ctxLogger.Error("All SSH retries exhausted", "vmID", vmID, "lastError", lastErr)
-		sendStreamError(sender, errMsg)
-
-		// Best-effort destroy so the broken VM doesn't consume a quota slot
-		ctxLogger.Info("Destroying failed VM to free quota", "vmID", vmID, "userLogin", userLogin)
-		a.clearUserVM(userLogin, vmID)
-		go func() { _ = a.coda.DeleteVM(context.Background(), vmID, true) }()
+		sendStreamError(ctx, sender, errMsg)
+		a.loki.event(logLabels, "SSH connection failed: %v", lastErr)
+
+		// Best-effort destroy so the broken VM doesn't consume a quota slot.
+		// Workspace VMs are kept: they may hold the learner's work.
+		if workspaceName == "" {
+			ctxLogger.Info("Destroying failed VM to free quota", "vmID", vmID, "userLogin", userLogin)
+			a.clearUserVM(userLogin, vmID)
+			go func() { _ = a.coda.DeleteVM(context.Background(), vmID, true) }()
+		}
 
 		return errors.New(errMsg)
 	}
 	defer func() { _ = session.Close() }()
+	defer a.revokeSessionSSHKey(ctxLogger, sessionKey, session.SSHClient)
 
 	// Store session for PublishStream to find
-	a.streamSessionsMu.Lock()
-	a.streamSessions[req.Path] = &streamSession{
+	sess := &streamSession{
+		id:        correlationIDFromContext(ctx),
 		vmID:      vmID,
 		userLogin: userLogin,
+		channel:   req.Path,
 		session:   session,
 		sender:    sender,
 		cancel:    cancel,
+		logLabels: logLabels,
+		template:  vm.Template,
+		startedAt: timeNow(),
+		traffic:   traffic,
+		output:    pump,
 	}
+	sess.touch()
+	a.noteVMActivity(vmID, userLogin, timeNow())
+	a.streamSessionsMu.Lock()
+	a.streamSessions[req.Path] = sess
 	a.streamSessionsMu.Unlock()
+	resumed, wasResumable := a.takeResumable(req.Path, userLogin)
+	a.saveSessionRecord(sess)
 
 	defer func() {
 		a.streamSessionsMu.Lock()
 		delete(a.streamSessions, req.Path)
 		a.streamSessionsMu.Unlock()
+		a.endSessionRecord(sess)
+		a.noteVMActivity(sess.vmID, sess.userLogin, time.Unix(0, sess.lastInput.Load()))
+		a.endTakeover(sess.id)
+		a.recordSessionUsage(ctxLogger, sess.startedAt)
+		a.recordUsage(ctxLogger, sess)
 	}()
 
 	// Send connected message to frontend with vmId so it can cache it
-	connectedOutput := TerminalStreamOutput{Type: "connected", VmId: vmID}
-	jsonBytes, _ := json.Marshal(connectedOutput)
-	frame := data.NewFrame("terminal")
-	frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+	connectedOutput := TerminalStreamOutput{Type: "connected", VmId: vmID, CorrelationID: sess.id}
+	if wasResumable {
+		connectedOutput.Message = "Reattached after a plugin restart"
+		ctxLogger.Info("Resuming session from before a restart", "previousSessionID", resumed.SessionID, "previousOutputSeq", resumed.OutputSeq)
+	}
+	frame := terminalFrame(connectedOutput)
 
 	if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
 		ctxLogger.Error("Failed to send connected message", "vmID", vmID, "error", err)
@@ -913,40 +1237,12 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 	}
 
 	ctxLogger.Info("Terminal session started", "vmID", vmID)
+	sessionStart := timeNow()
+	a.loki.event(logLabels, "Session connected (template %s)", vm.Template)
 
-	// Start heartbeat sender to keep Grafana Live stream alive
-	// Grafana may close idle streams, so we send heartbeats every 3 seconds
-	// to ensure the stream stays active even when the user is idle
-	go func() {
-		// Send IMMEDIATE heartbeat to prevent early stream closure
-		heartbeat := TerminalStreamOutput{Type: "heartbeat"}
-		jsonBytes, _ := json.Marshal(heartbeat)
-		frame := data.NewFrame("terminal")
-		frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
-		if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
-			ctxLogger.Debug("Initial heartbeat send failed", "error", err)
-			return
-		}
-		ctxLogger.Debug("Sent initial heartbeat")
-
-		heartbeatTicker := time.NewTicker(3 * time.Second)
-		defer heartbeatTicker.Stop()
-		for {
-			select {
-			case <-streamCtx.Done():
-				return
-			case <-heartbeatTicker.C:
-				heartbeat := TerminalStreamOutput{Type: "heartbeat"}
-				jsonBytes, _ := json.Marshal(heartbeat)
-				frame := data.NewFrame("terminal")
-				frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
-				if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
-					ctxLogger.Debug("Heartbeat send failed, stream likely closed", "error", err)
-					return
-				}
-			}
-		}
-	}()
+	// Heartbeats keep the Live channel open and end the session when the
+	// subscriber is gone
+	go runHeartbeat(streamCtx, sess, heartbeatInterval, heartbeatAckTimeout, ctxLogger, cancel)
 
 	// Poll VM state to detect expiry/destruction and disconnect gracefully
 	// Capture vmID and userLogin for the goroutine
@@ -975,7 +1271,8 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 					if polledVM.State == "error" {
 						msg = "VM entered error state"
 					}
-					sendStreamError(sender, msg)
+					a.loki.event(logLabels, "%s (state %s)", msg, polledVM.State)
+					sendStreamError(ctx, sender, msg)
 					cancel()
 					return
 				}
@@ -983,16 +1280,25 @@ func (a *App) RunStream(ctx context.Context, req *backend.RunStreamRequest, send
 		}
 	}()
 
-	// Wait for context cancellation (stream disconnect or VM expiry)
+	go a.monitorVMHealth(streamCtx, sess, ctxLogger)
+
+	if a.metrics != nil {
+		go a.forwardVMMetrics(streamCtx, sess, ctxLogger)
+	}
+
+	if idleLimit := a.hibernateIdleTimeout(); idleLimit > 0 {
+		go a.hibernateWhenIdle(streamCtx, sess, idleLimit, ctxLogger)
+	}
+
+	// Wait for context cancellation (stream disconnect, VM expiry or hibernation)
 	<-streamCtx.Done()
 
 	// Send disconnected message
 	disconnectedOutput := TerminalStreamOutput{Type: "disconnected"}
-	jsonBytes, _ = json.Marshal(disconnectedOutput)
-	frame = data.NewFrame("terminal")
-	frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+	frame = terminalFrame(disconnectedOutput)
 	_ = sender.SendFrame(frame, data.IncludeAll)
 
+	a.loki.event(logLabels, "Session disconnected after %s", timeNow().Sub(sessionStart).Round(time.Second))
 	ctxLogger.Info("RunStream ended", "vmID", vmID)
 	return nil
 }
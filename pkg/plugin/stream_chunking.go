@@ -0,0 +1,69 @@
+package plugin
+
+import "unicode/utf8"
+
+// Live message size limits.
+//
+// Grafana Live drops messages larger than its configured limit, and plugins
+// can't query that limit, so Settings.LiveMaxMessageKB (default 64) mirrors
+// it. Output is split into frames whose encoded size stays under it. The
+// output JSON is escaped twice on its way out (once as TerminalStreamOutput,
+// again as a string inside the data frame), so each character is counted at
+// its doubly escaped length, and liveFrameOverhead is kept for the rest of
+// the frame. Splits fall on UTF-8 character boundaries.
+
+const (
+	defaultLiveMaxMessageKB = 64
+	liveFrameOverhead       = 1024
+	minLiveFrameBudget      = 1024
+)
+
+// liveFrameBudget returns the doubly escaped output bytes one frame may carry.
+func (a *App) liveFrameBudget() int {
+	kb := defaultLiveMaxMessageKB
+	if a.settings != nil && a.settings.LiveMaxMessageKB > 0 {
+		kb = a.settings.LiveMaxMessageKB
+	}
+	return max(kb*1024-liveFrameOverhead, minLiveFrameBudget)
+}
+
+// splitOutput splits out into chunks whose doubly escaped size fits budget.
+func splitOutput(out []byte, budget int) []string {
+	s := string(out)
+	if len(s)*maxEscapedRuneCost <= budget {
+		return []string{s}
+	}
+	var chunks []string
+	start, size := 0, 0
+	for i, r := range s {
+		c := escapedRuneCost(r)
+		if size+c > budget && i > start {
+			chunks = append(chunks, s[start:i])
+			start, size = i, 0
+		}
+		size += c
+	}
+	if start < len(s) {
+		chunks = append(chunks, s[start:])
+	}
+	return chunks
+}
+
+// maxEscapedRuneCost bounds escapedRuneCost per input byte.
+const maxEscapedRuneCost = 7
+
+// escapedRuneCost is the length of r after JSON-escaping it twice: \u001b
+// becomes \\u001b, " becomes \\\", and so on. Invalid UTF-8 decodes as
+// utf8.RuneError and is encoded as \ufffd.
+func escapedRuneCost(r rune) int {
+	switch {
+	case r == '"' || r == '\\':
+		return 4
+	case r == '\n' || r == '\r' || r == '\t':
+		return 3
+	case r < 0x20, r == '<', r == '>', r == '&', r == '\u2028', r == '\u2029', r == utf8.RuneError:
+		return 7
+	default:
+		return utf8.RuneLen(r)
+	}
+}
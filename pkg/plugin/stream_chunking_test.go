@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitOutput(t *testing.T) {
+	app := &App{settings: &Settings{LiveMaxMessageKB: 4}}
+	budget := app.liveFrameBudget()
+	if budget != 3*1024 {
+		t.Fatalf("budget = %d", budget)
+	}
+
+	inputs := map[string]string{
+		"short":   "hello\r\n",
+		"plain":   strings.Repeat("ls -la /var/log\r\n", 2000),
+		"escapes": strings.Repeat("\x1b[31m\"quoted\"\\<tag>\x1b[0m\r\n", 2000),
+		"unicode": strings.Repeat("├── ✓ グラファナ\r\n", 2000),
+	}
+	for name, in := range inputs {
+		chunks := splitOutput([]byte(in), budget)
+		if strings.Join(chunks, "") != in {
+			t.Errorf("%s: chunks don't rejoin to the input", name)
+		}
+		if name == "short" && len(chunks) != 1 {
+			t.Errorf("short output split into %d chunks", len(chunks))
+		}
+		for _, c := range chunks {
+			if !utf8.ValidString(c) {
+				t.Errorf("%s: chunk splits a character", name)
+			}
+			raw, err := json.Marshal(terminalFrame(TerminalStreamOutput{Type: "output", Data: c, Seq: 1 << 40}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(raw) > 4*1024 {
+				t.Errorf("%s: frame is %d bytes, over the 4 KB limit", name, len(raw))
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Terminal frame parsing.
+//
+// Every transport decodes terminal messages here rather than with its own
+// json.Unmarshal: Live publishes on terminal, shared, broadcast and takeover
+// channels, and gRPC, whose messages go through PublishStream.
+// decodeTerminalInput refuses
+//
+//   - frames over maxTerminalInputBytes, before decoding them;
+//   - anything but one JSON object, such as trailing data after it;
+//   - fields this backend doesn't know, with strictTerminalInput. Otherwise
+//     they are ignored, as the schema policy in stream_schema.go asks;
+//   - messages breaking TerminalInput's validate tags, including unknown
+//     types and data over maxPasteBytes;
+//   - a schemaVersion newer than terminalSchemaVersion.
+//
+// decodePresenceUpdate does the same for updates published on guide
+// presence channels, under maxPresenceUpdateBytes and always refusing
+// unknown fields, since no older client sends any.
+//
+// Output goes the other way: unwrapTerminalFrame takes the message out of a
+// frame built by terminalFrame, and parseTerminalOutput decodes it for
+// clients of the transports.
+
+const (
+	// maxTerminalInputBytes leaves room for a maximal paste with escaping.
+	maxTerminalInputBytes = 2*maxPasteBytes + 1024
+	// maxTerminalOutputBytes bounds one encoded output message.
+	maxTerminalOutputBytes = defaultMaxBodyBytes
+	// maxPresenceUpdateBytes is well above a presenceUpdate at its limits.
+	maxPresenceUpdateBytes = 4096
+)
+
+// decodeTerminalInput parses and validates one input message.
+func decodeTerminalInput(raw []byte, strict bool) (TerminalInput, error) {
+	var input TerminalInput
+	if len(raw) > maxTerminalInputBytes {
+		return input, fmt.Errorf("message is %d bytes (max %d)", len(raw), maxTerminalInputBytes)
+	}
+	if err := decodeFrameObject(raw, &input, strict); err != nil {
+		return TerminalInput{}, err
+	}
+	if errs := validateRequest(input); len(errs) > 0 {
+		return TerminalInput{}, fmt.Errorf("%s %s", errs[0].Field, errs[0].Message)
+	}
+	if input.SchemaVersion > terminalSchemaVersion {
+		return TerminalInput{}, fmt.Errorf("unsupported schemaVersion %d (backend supports %d)", input.SchemaVersion, terminalSchemaVersion)
+	}
+	return input, nil
+}
+
+// parseTerminalInput decodes input published on a terminal channel under
+// the configured unknown-field policy.
+func (a *App) parseTerminalInput(raw []byte) (TerminalInput, error) {
+	input, err := decodeTerminalInput(raw, a.settings != nil && a.settings.StrictTerminalInput)
+	if err != nil {
+		return input, fmt.Errorf("invalid terminal input: %w", err)
+	}
+	return input, nil
+}
+
+// decodePresenceUpdate parses and validates one guide presence update.
+func decodePresenceUpdate(raw []byte) (presenceUpdate, error) {
+	var update presenceUpdate
+	if len(raw) > maxPresenceUpdateBytes {
+		return update, fmt.Errorf("message is %d bytes (max %d)", len(raw), maxPresenceUpdateBytes)
+	}
+	if err := decodeFrameObject(raw, &update, true); err != nil {
+		return presenceUpdate{}, err
+	}
+	if errs := validateRequest(update); len(errs) > 0 {
+		return presenceUpdate{}, fmt.Errorf("%s %s", errs[0].Field, errs[0].Message)
+	}
+	return update, nil
+}
+
+// parseTerminalOutput decodes one output message. Unknown fields are
+// ignored so clients keep working as types gain fields.
+func parseTerminalOutput(raw []byte) (TerminalStreamOutput, error) {
+	var output TerminalStreamOutput
+	if len(raw) > maxTerminalOutputBytes {
+		return output, fmt.Errorf("message is %d bytes (max %d)", len(raw), maxTerminalOutputBytes)
+	}
+	if err := decodeFrameObject(raw, &output, false); err != nil {
+		return TerminalStreamOutput{}, err
+	}
+	if output.Type == "" {
+		return TerminalStreamOutput{}, errors.New("type is required")
+	}
+	return output, nil
+}
+
+// unwrapTerminalFrame returns the message carried by an encoded terminal
+// frame, or nil for a frame without one.
+func unwrapTerminalFrame(packet []byte) ([]byte, error) {
+	var frame data.Frame
+	if err := json.Unmarshal(packet, &frame); err != nil {
+		return nil, fmt.Errorf("failed to decode stream frame: %w", err)
+	}
+	if len(frame.Fields) == 0 || frame.Fields[0].Len() == 0 {
+		return nil, nil
+	}
+	raw, ok := frame.Fields[0].At(0).(string)
+	if !ok {
+		return nil, fmt.Errorf("stream frame field is %s, not string", frame.Fields[0].Type())
+	}
+	return []byte(raw), nil
+}
+
+// decodeFrameObject decodes raw, which must hold exactly one JSON object,
+// into v. With strict, fields v doesn't declare are refused.
+func decodeFrameObject(raw []byte, v any, strict bool) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' {
+		return errors.New("message must be a JSON object")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the message")
+	}
+	return nil
+}
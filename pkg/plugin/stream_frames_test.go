@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestDecodeTerminalInput(t *testing.T) {
+	for _, tc := range []struct {
+		raw    string
+		strict bool
+		want   string
+	}{
+		{`{"type":"input","data":"ls\r"}`, true, ""},
+		{` {"type":"resize","rows":24,"cols":80} `, true, ""},
+		{`{"type":"input","data":"a","futureField":1}`, false, ""},
+		{`{"type":"input","data":"a","futureField":1}`, true, `unknown field "futureField"`},
+		{`{"type":"input","data":"a"}{"type":"input","data":"b"}`, false, "unexpected data"},
+		{`{"type":"input","data":"a"} x`, false, "unexpected data"},
+		{`[{"type":"input"}]`, false, "JSON object"},
+		{`null`, false, "JSON object"},
+		{``, false, "JSON object"},
+		{`{"type":"exec","data":"rm -rf /"}`, false, "type must be one of"},
+		{`{"data":"a"}`, false, "type is required"},
+		{`{"type":"resize","rows":5000,"cols":80}`, false, "rows must be at most 1000"},
+		{`{"type":"input","data":"a","inputSeq":-1}`, false, "inputSeq must be at least 0"},
+		{`{"type":"input","data":"a","schemaVersion":99}`, false, "unsupported schemaVersion 99"},
+		{`{"type":"paste","data":"` + strings.Repeat("x", maxPasteBytes+1) + `"}`, false, "data must be at most 262144 bytes"},
+		{`{"type":"paste","data":"` + strings.Repeat("x", maxTerminalInputBytes) + `"}`, false, "max 525312"},
+	} {
+		_, err := decodeTerminalInput([]byte(tc.raw), tc.strict)
+		name := tc.raw[:min(len(tc.raw), 60)]
+		if tc.want == "" && err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%s: err = %v, want %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestDecodePresenceUpdate(t *testing.T) {
+	if got, err := decodePresenceUpdate([]byte(`{"step":"s1","stepIndex":1,"totalSteps":3,"status":"completed"}`)); err != nil || got.Step != "s1" || got.Status != presenceCompleted {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	for _, raw := range []string{
+		`{"step":"s1","login":"root"}`,
+		`{"status":"left"} {}`,
+		`{"status":"away"}`,
+		`{"step":"` + strings.Repeat("x", maxPresenceUpdateBytes) + `"}`,
+	} {
+		if _, err := decodePresenceUpdate([]byte(raw)); err == nil {
+			t.Errorf("accepted %.60s", raw)
+		}
+	}
+}
+
+func TestPublishStream_StrictTerminalInput(t *testing.T) {
+	stdin := &recordingWriter{}
+	sess := &streamSession{id: "sess-1", vmID: "vm-1", userLogin: "alice", session: &TerminalSession{VMID: "vm-1", stdin: stdin}}
+	app := &App{logger: log.DefaultLogger, settings: &Settings{StrictTerminalInput: true}, streamSessions: map[string]*streamSession{"terminal/vm-1/1": sess}}
+	publish := func(body string) error {
+		_, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{Path: "terminal/vm-1/1", Data: json.RawMessage(body)})
+		return err
+	}
+	if err := publish(`{"type":"input","data":"a"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := publish(`{"type":"input","data":"b","cmd":"x"}`); err == nil {
+		t.Error("unknown field accepted")
+	}
+	if len(stdin.writes) != 1 {
+		t.Errorf("stdin writes = %q", stdin.writes)
+	}
+}
+
+func TestTerminalOutputRoundTrip(t *testing.T) {
+	want := TerminalStreamOutput{Type: "output", Data: "héllo\x1b[0m\n", Seq: 7, SchemaVersion: terminalSchemaVersion}
+	frame := terminalFrame(want)
+	packet, err := json.Marshal(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := unwrapTerminalFrame(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseTerminalOutput(raw)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if _, err := parseTerminalOutput([]byte(`{"data":"x"}`)); err == nil {
+		t.Error("output without a type accepted")
+	}
+	if _, err := unwrapTerminalFrame([]byte(`not a frame`)); err == nil {
+		t.Error("garbage frame accepted")
+	}
+}
+
+func FuzzDecodeTerminalInput(f *testing.F) {
+	for _, seed := range []string{
+		`{"type":"input","data":"ls\r","sessionId":"sess-1","inputSeq":1}`,
+		`{"type":"paste","data":"echo \u001b[31m"}`,
+		`{"type":"resize","rows":24,"cols":80,"schemaVersion":1}`,
+		`{"type":"pong","seq":3}`,
+		`{"type":"resume","seq":-1}`,
+		`{"type":"lock-handoff","data":"bob","extra":{"a":[1,2]}}`,
+		`{"type":"input","Type":"paste"}`,
+		`{"type":"input"} {}`,
+		`"input"`,
+	} {
+		f.Add([]byte(seed), false)
+		f.Add([]byte(seed), true)
+	}
+	f.Fuzz(func(t *testing.T, raw []byte, strict bool) {
+		input, err := decodeTerminalInput(raw, strict)
+		if err != nil {
+			return
+		}
+		if len(raw) > maxTerminalInputBytes || len(input.Data) > maxPasteBytes || input.SchemaVersion > terminalSchemaVersion {
+			t.Fatalf("accepted %q as %+v", raw, input)
+		}
+		if errs := validateRequest(input); len(errs) > 0 {
+			t.Fatalf("accepted invalid %+v: %v", input, errs)
+		}
+		// What was accepted decodes the same once re-encoded.
+		again, err := json.Marshal(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeTerminalInput(again, true)
+		if err != nil || !reflect.DeepEqual(decoded, input) {
+			t.Fatalf("re-encoded %s: %+v, %v", again, decoded, err)
+		}
+	})
+}
+
+func FuzzDecodePresenceUpdate(f *testing.F) {
+	for _, seed := range []string{
+		`{"step":"Add a data source","stepIndex":2,"totalSteps":5,"status":"viewing"}`,
+		`{"status":"completed"}`,
+		`{}`,
+		`{"status":"away"}`,
+		`{"stepIndex":-1}`,
+		`{"step":"x","login":"root"}`,
+		`{"status":"left"} {}`,
+		`[]`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		update, err := decodePresenceUpdate(raw)
+		if err != nil {
+			return
+		}
+		if len(raw) > maxPresenceUpdateBytes {
+			t.Fatalf("accepted %d bytes", len(raw))
+		}
+		if errs := validateRequest(update); len(errs) > 0 {
+			t.Fatalf("accepted invalid %+v: %v", update, errs)
+		}
+		again, err := json.Marshal(update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded, err := decodePresenceUpdate(again); err != nil || decoded != update {
+			t.Fatalf("re-encoded %s: %+v, %v", again, decoded, err)
+		}
+	})
+}
+
+func FuzzParseTerminalOutput(f *testing.F) {
+	f.Add("output", "hi\r\n", int64(1))
+	f.Add("error", "\xff\xfe", int64(0))
+	f.Add("lock", "", int64(-5))
+	f.Fuzz(func(t *testing.T, typ, data string, seq int64) {
+		packet, err := json.Marshal(terminalFrame(TerminalStreamOutput{Type: typ, Data: data, Seq: seq}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := unwrapTerminalFrame(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseTerminalOutput(raw)
+		if typ == "" {
+			if err == nil {
+				t.Fatal("output without a type accepted")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if got.Type != jsonString(typ) || got.Seq != seq || got.Data != jsonString(data) {
+			t.Fatalf("round trip of %q %q %d: %+v", typ, data, seq, got)
+		}
+	})
+}
+
+// jsonString is s as it reads back from JSON, with invalid UTF-8 replaced.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	var out string
+	_ = json.Unmarshal(b, &out)
+	return out
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Heartbeat pings.
+//
+// RunStream sends a numbered "heartbeat" frame every heartbeatInterval. It
+// keeps Grafana Live from closing idle channels and doubles as a liveness
+// probe, because Grafana doesn't always cancel RunStream's context when a
+// subscriber disappears. A subscriber is treated as dead, and its session
+// ended, when:
+//
+//   - a frame can't be sent, or
+//   - the client has acknowledged a heartbeat ({"type":"pong","seq":N}) and
+//     then goes heartbeatAckTimeout without another.
+//
+// Clients that never acknowledge (frontends predating pongs) are only subject
+// to the first check.
+
+const (
+	heartbeatInterval   = 3 * time.Second
+	heartbeatAckTimeout = 30 * time.Second
+)
+
+// ackHeartbeat records a pong from the client.
+func (s *streamSession) ackHeartbeat() {
+	s.lastAck.Store(timeNow().UnixNano())
+}
+
+// runHeartbeat pings the session's subscriber every interval until ctx is
+// done, calling dead once if the subscriber stops responding.
+func runHeartbeat(ctx context.Context, sess *streamSession, interval, ackTimeout time.Duration, ctxLogger log.Logger, dead func()) {
+	var seq int64
+	ping := func() bool {
+		seq++
+		if err := sess.sender.SendFrame(terminalFrame(TerminalStreamOutput{Type: "heartbeat", Seq: seq}), data.IncludeAll); err != nil {
+			ctxLogger.Info("Heartbeat send failed, ending session for dead subscriber", "vmID", sess.vmID, "error", err)
+			return false
+		}
+		if last := sess.lastAck.Load(); last != 0 && timeNow().Sub(time.Unix(0, last)) > ackTimeout {
+			ctxLogger.Info("Heartbeats unacknowledged, ending session for dead subscriber", "vmID", sess.vmID, "timeout", ackTimeout.String())
+			return false
+		}
+		return true
+	}
+
+	// Send one immediately to prevent early stream closure
+	if !ping() {
+		dead()
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !ping() {
+				dead()
+				return
+			}
+		}
+	}
+}
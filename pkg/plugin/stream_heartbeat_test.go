@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+type failingPacketSender struct{}
+
+func (failingPacketSender) Send(*backend.StreamPacket) error { return errors.New("stream closed") }
+
+func TestRunHeartbeat_DeadSubscriber(t *testing.T) {
+	run := func(sess *streamSession) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		dead := false
+		runHeartbeat(ctx, sess, 5*time.Millisecond, time.Minute, log.DefaultLogger, func() { dead = true })
+		return dead
+	}
+
+	rec, sender := newStreamRecorder(t)
+	if run(&streamSession{vmID: "vm-1", sender: sender}) {
+		t.Error("live subscriber that never acks was declared dead")
+	}
+	if beats := rec.ofType("heartbeat"); len(beats) < 2 || beats[0].Seq != 1 || beats[1].Seq != 2 {
+		t.Errorf("heartbeats = %+v", beats)
+	}
+
+	if !run(&streamSession{vmID: "vm-1", sender: backend.NewStreamSender(failingPacketSender{})}) {
+		t.Error("send failure not treated as a dead subscriber")
+	}
+
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+	_, sender = newStreamRecorder(t)
+	sess := &streamSession{vmID: "vm-1", sender: sender}
+	sess.ackHeartbeat()
+	now = now.Add(2 * time.Minute)
+	if !run(sess) {
+		t.Error("client that stopped acking was not declared dead")
+	}
+}
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"encoding/json"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Terminal stream frame schema.
+//
+// Every TerminalStreamOutput carries schemaVersion and clients send theirs on
+// each TerminalInput. Evolution policy:
+//
+//   - New message types and new optional fields are additive and don't bump
+//     terminalSchemaVersion. Clients must ignore types and fields they don't
+//     know.
+//   - A new type that older frontends would mishandle is listed in
+//     outputTypeSince with the version that introduced it, and a session only
+//     receives it once its client has declared that version.
+//   - Renaming, removing or changing the meaning of an existing type or field
+//     bumps terminalSchemaVersion, and the backend keeps producing the old
+//     shape for clients that declare an older version.
+//
+// Inputs without schemaVersion come from frontends that predate it and are
+// treated as version 0. Inputs declaring a newer version than this backend
+// knows are refused rather than half-understood.
+
+const terminalSchemaVersion = 1
+
+// outputTypeSince maps output types to the schema version that introduced
+// them. Unlisted types are understood by every client.
+var outputTypeSince = map[string]int{
+	"health": 1,
+}
+
+// terminalFrame encodes output as the single-row frame every terminal channel
+// uses, stamped with the current schema version.
+func terminalFrame(output TerminalStreamOutput) *data.Frame {
+	output.SchemaVersion = terminalSchemaVersion
+	jsonBytes, _ := json.Marshal(output)
+	frame := data.NewFrame("terminal")
+	frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(jsonBytes)}))
+	return frame
+}
+
+// clientUnderstands reports whether a client that declared version can handle
+// an output of type typ.
+func clientUnderstands(version int, typ string) bool {
+	return version >= outputTypeSince[typ]
+}
+
+// StreamCapabilities tells a terminal client which protocol features this
+// backend supports. It is the initial data of every accepted terminal
+// subscription, as a "capabilities" message, so clients choose a mode from
+// what the deployed backend reports rather than from their own version.
+type StreamCapabilities struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// BinaryFrames: output can be sent as binary rather than JSON text.
+	BinaryFrames bool `json:"binaryFrames"`
+	// Resume: output missed across a Live reconnect is replayed on "resume".
+	Resume bool `json:"resume"`
+	// Multiplexing: several terminals can share one channel.
+	Multiplexing bool `json:"multiplexing"`
+	// InputOverLive: input is accepted with Live publish on the channel.
+	InputOverLive bool `json:"inputOverLive"`
+	// InputSeq: sessionId and inputSeq on input are checked against replay.
+	InputSeq bool `json:"inputSeq"`
+}
+
+// terminalCapabilities returns what this backend supports.
+func terminalCapabilities() StreamCapabilities {
+	return StreamCapabilities{
+		SchemaVersion: terminalSchemaVersion,
+		Resume:        true,
+		InputOverLive: true,
+		InputSeq:      true,
+	}
+}
+
+// terminalSubscribeOK accepts a terminal subscription, attaching the
+// backend's capabilities as initial data.
+func terminalSubscribeOK() *backend.SubscribeStreamResponse {
+	caps := terminalCapabilities()
+	initial, err := backend.NewInitialFrame(terminalFrame(TerminalStreamOutput{Type: "capabilities", Capabilities: &caps}), data.IncludeAll)
+	if err != nil {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK, InitialData: initial}
+}
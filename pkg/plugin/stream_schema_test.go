@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestTerminalFrame_StampsSchemaVersion(t *testing.T) {
+	frame := terminalFrame(TerminalStreamOutput{Type: "output", Data: "hi"})
+	raw, _ := frame.Fields[0].At(0).(string)
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["schemaVersion"] != float64(terminalSchemaVersion) || got["type"] != "output" {
+		t.Errorf("frame = %s", raw)
+	}
+}
+
+func TestPublishStream_SchemaVersion(t *testing.T) {
+	stdin := &recordingWriter{}
+	sess := &streamSession{id: "sess-1", vmID: "vm-1", userLogin: "alice", session: &TerminalSession{VMID: "vm-1", stdin: stdin}}
+	app := &App{logger: log.DefaultLogger, streamSessions: map[string]*streamSession{"terminal/vm-1/1": sess}}
+
+	publish := func(body string) error {
+		_, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			Path: "terminal/vm-1/1",
+			Data: json.RawMessage(body),
+		})
+		return err
+	}
+
+	if err := publish(`{"type":"input","data":"a"}`); err != nil {
+		t.Fatalf("legacy input: %v", err)
+	}
+	if v := sess.clientSchema.Load(); v != 0 || clientUnderstands(int(v), "health") {
+		t.Errorf("legacy client: schema %d understands health", v)
+	}
+	if !clientUnderstands(0, "output") {
+		t.Error("legacy client should understand output")
+	}
+
+	if err := publish(`{"type":"input","data":"b","schemaVersion":1}`); err != nil {
+		t.Fatalf("current input: %v", err)
+	}
+	if !clientUnderstands(int(sess.clientSchema.Load()), "health") {
+		t.Error("current client should receive health")
+	}
+
+	if err := publish(`{"type":"input","data":"c","schemaVersion":99}`); err == nil {
+		t.Error("input from a newer schema was accepted")
+	}
+	if len(stdin.writes) != 2 {
+		t.Errorf("stdin writes = %q", stdin.writes)
+	}
+}
+
+func TestSubscribeStream_ReportsCapabilities(t *testing.T) {
+	app := newTestApp(t)
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"terminal/new/1", "terminal/vm-gone/1"} {
+		resp, err := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: path})
+		if err != nil || resp.Status != backend.SubscribeStreamStatusOK || resp.InitialData == nil {
+			t.Fatalf("%s: resp = %+v, err = %v", path, resp, err)
+		}
+		var frame data.Frame
+		if err := json.Unmarshal(resp.InitialData.Data(), &frame); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := frame.Fields[0].At(0).(string)
+		var msg TerminalStreamOutput
+		_ = json.Unmarshal([]byte(raw), &msg)
+		if msg.Type != "capabilities" || msg.Capabilities == nil || *msg.Capabilities != terminalCapabilities() {
+			t.Errorf("%s: initial data = %s", path, raw)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestIsSSHAuthError(t *testing.T) {
@@ -74,6 +75,9 @@ func TestStatusMessageForState(t *testing.T) {
 		{"pending", "Waiting in queue..."},
 		{"provisioning", "VM is booting..."},
 		{"active", "VM is ready"},
+		{"stopping", "VM is hibernating..."},
+		{"stopped", "VM is hibernated"},
+		{"starting", "Resuming hibernated VM..."},
 		{"unknown", "VM state: unknown"},
 		{"error", "VM state: error"},
 		{"destroying", "VM state: destroying"},
@@ -135,3 +139,42 @@ func TestSSHRetryConstants(t *testing.T) {
 		t.Errorf("maxCredentialRefreshes should be >= 1, got %d", maxCredentialRefreshes)
 	}
 }
+
+func TestConnectionTimeoutSettings(t *testing.T) {
+	app := &App{}
+	if got := app.relayTimeouts(); got != (RelayTimeouts{}) {
+		t.Errorf("relayTimeouts() without settings = %+v", got)
+	}
+	if got := app.vmActiveTimeout(); got != defaultVMActiveTimeout {
+		t.Errorf("vmActiveTimeout() without settings = %v", got)
+	}
+
+	app.settings = &Settings{RelayHandshakeTimeoutSeconds: 90, SSHHandshakeTimeoutSeconds: 45, VMActiveTimeoutSeconds: 600}
+	if got, want := app.relayTimeouts(), (RelayTimeouts{WebSocketHandshake: 90 * time.Second, SSHHandshake: 45 * time.Second}); got != want {
+		t.Errorf("relayTimeouts() = %+v, want %+v", got, want)
+	}
+	if got := app.vmActiveTimeout(); got != 10*time.Minute {
+		t.Errorf("vmActiveTimeout() = %v, want 10m", got)
+	}
+}
+
+func TestSSHRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		jitter  float64
+		want    time.Duration
+	}{
+		{1, 0, 2 * time.Second},
+		{2, 0, 4 * time.Second},
+		{3, 0, 8 * time.Second},
+		{3, 1, 9600 * time.Millisecond},
+		{3, -1, 6400 * time.Millisecond},
+		{5, 1, sshRetryMaxDelay},
+		{100, 0, sshRetryMaxDelay},
+	}
+	for _, tt := range tests {
+		if got := sshRetryBackoff(tt.attempt, tt.jitter); got != tt.want {
+			t.Errorf("sshRetryBackoff(%d, %v) = %v, want %v", tt.attempt, tt.jitter, got, tt.want)
+		}
+	}
+}
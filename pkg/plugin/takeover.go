@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Admin session takeover.
+//
+// Channel path: takeover/{sessionId}
+//
+// Org admins can attach to any active terminal session for support and
+// moderation. While an admin's takeover stream runs, they receive the
+// session's output (see terminal_fanout.go) and their input goes to its
+// shell; the learner's own input is refused. A banner written to the
+// learner's terminal says who took control and when it is handed back.
+// Starting and ending a takeover is recorded in the audit log.
+
+const takeoverChannelPrefix = "takeover"
+
+// sessionTakeover is an admin's control of another user's session.
+type sessionTakeover struct {
+	sessionID string
+	admin     string
+	user      string
+	vmID      string
+	startedAt time.Time
+	fanout    *outputFanout
+}
+
+// takeoverBanner formats a notice for the learner's terminal.
+func takeoverBanner(text string) string {
+	return "\r\n\x1b[1;33m━━ " + text + " ━━\x1b[0m\r\n"
+}
+
+// parseTakeoverChannel extracts the session ID from takeover/{sessionId}.
+func parseTakeoverChannel(channelPath string) (string, bool) {
+	parts := strings.Split(channelPath, "/")
+	if len(parts) != 2 || parts[0] != takeoverChannelPrefix || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// findStreamSessionByID returns the active terminal session with id, or nil.
+func (a *App) findStreamSessionByID(id string) *streamSession {
+	a.streamSessionsMu.Lock()
+	defer a.streamSessionsMu.Unlock()
+	for _, sess := range a.streamSessions {
+		if sess != nil && sess.session != nil && sess.id == id {
+			return sess
+		}
+	}
+	return nil
+}
+
+func (a *App) getTakeover(sessionID string) *sessionTakeover {
+	a.takeoversMu.Lock()
+	defer a.takeoversMu.Unlock()
+	return a.takeovers[sessionID]
+}
+
+// takeoverFanouts returns the fan-outs of takeovers of user's session on vmID.
+func (a *App) takeoverFanouts(user, vmID string) []*outputFanout {
+	a.takeoversMu.Lock()
+	defer a.takeoversMu.Unlock()
+	var fanouts []*outputFanout
+	for _, t := range a.takeovers {
+		if t.user == user && t.vmID == vmID {
+			fanouts = append(fanouts, t.fanout)
+		}
+	}
+	return fanouts
+}
+
+// endTakeover detaches any admin from sessionID; called when the session
+// itself ends.
+func (a *App) endTakeover(sessionID string) {
+	if t := a.getTakeover(sessionID); t != nil {
+		t.fanout.stop()
+	}
+}
+
+// subscribeTakeoverStream only accepts admins, and only for live sessions.
+func (a *App) subscribeTakeoverStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+	sessionID, ok := parseTakeoverChannel(req.Path)
+	if !ok {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if !pluginUserIsAdmin(req.PluginContext) {
+		ctxLogger.Warn("Rejecting takeover subscription from non-admin", "sessionID", sessionID, "user", pluginUserLogin(req.PluginContext))
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	if a.findStreamSessionByID(sessionID) == nil {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// runTakeoverStream gives the admin control of the session until the stream
+// closes or the session ends, then hands control back to the learner.
+func (a *App) runTakeoverStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	ctxLogger := a.ctxLogger(ctx)
+	sessionID, ok := parseTakeoverChannel(req.Path)
+	admin := pluginUserLogin(req.PluginContext)
+	if !ok || !pluginUserIsAdmin(req.PluginContext) {
+		sendStreamError(ctx, sender, "Only admins can take over a terminal session")
+		return nil
+	}
+	sess := a.findStreamSessionByID(sessionID)
+	if sess == nil {
+		sendStreamError(ctx, sender, "Terminal session not found")
+		return nil
+	}
+
+	t := &sessionTakeover{
+		sessionID: sessionID,
+		admin:     admin,
+		user:      sess.userLogin,
+		vmID:      sess.vmID,
+		startedAt: timeNow(),
+		fanout:    newOutputFanout(),
+	}
+	a.takeoversMu.Lock()
+	if existing := a.takeovers[sessionID]; existing != nil {
+		a.takeoversMu.Unlock()
+		sendStreamError(ctx, sender, fmt.Sprintf("Session is already controlled by %s", existing.admin))
+		return nil
+	}
+	if a.takeovers == nil {
+		a.takeovers = make(map[string]*sessionTakeover)
+	}
+	a.takeovers[sessionID] = t
+	a.takeoversMu.Unlock()
+
+	a.recordAudit(ctxLogger, auditEntry{Actor: admin, Action: "session.takeover.start", TargetUser: t.user, VMID: t.vmID, SessionID: sessionID})
+	sendStreamMessage(sess.sender, TerminalStreamOutput{
+		Type: "output",
+		Data: takeoverBanner(fmt.Sprintf("Administrator %s has taken control of this terminal for support. Your input is paused.", admin)),
+	})
+
+	runFanoutStream(ctx, sender, t.fanout, "Session ended", TerminalStreamOutput{
+		Type:    "connected",
+		VmId:    t.vmID,
+		Message: "Controlling " + t.user + "'s terminal",
+	})
+
+	a.takeoversMu.Lock()
+	delete(a.takeovers, sessionID)
+	a.takeoversMu.Unlock()
+
+	if sess := a.findStreamSessionByID(sessionID); sess != nil {
+		sendStreamMessage(sess.sender, TerminalStreamOutput{
+			Type: "output",
+			Data: takeoverBanner(fmt.Sprintf("Administrator %s has returned control of this terminal.", admin)),
+		})
+	}
+	a.recordAudit(ctxLogger, auditEntry{
+		Actor:      admin,
+		Action:     "session.takeover.end",
+		TargetUser: t.user,
+		VMID:       t.vmID,
+		SessionID:  sessionID,
+		Details:    "duration " + timeNow().Sub(t.startedAt).Round(time.Second).String(),
+	})
+	return nil
+}
+
+// publishTakeoverStream forwards the controlling admin's input to the
+// session. Resizes are ignored so the learner's layout is kept.
+func (a *App) publishTakeoverStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	ctxLogger := a.ctxLogger(ctx)
+	sessionID, ok := parseTakeoverChannel(req.Path)
+	if !ok {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+	t := a.getTakeover(sessionID)
+	if t == nil || !pluginUserIsAdmin(req.PluginContext) || pluginUserLogin(req.PluginContext) != t.admin {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+	sess := a.findStreamSessionByID(sessionID)
+	if sess == nil {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+
+	input, err := a.parseTerminalInput(req.Data)
+	if err != nil {
+		ctxLogger.Warn("PublishStream: invalid input", "error", err, "dataLen", len(req.Data))
+		return nil, err
+	}
+	if input.Type != "resize" {
+		a.applyTerminalInput(ctxLogger, sess, input)
+	}
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestSubscribeTakeoverStream_RequiresAdmin(t *testing.T) {
+	app := &App{logger: log.DefaultLogger, streamSessions: map[string]*streamSession{
+		"terminal/vm-1/1": {id: "sess-1", vmID: "vm-1", userLogin: "learner", session: &TerminalSession{}},
+	}}
+
+	for _, tc := range []struct {
+		path, role string
+		want       backend.SubscribeStreamStatus
+	}{
+		{"takeover/sess-1", "Editor", backend.SubscribeStreamStatusPermissionDenied},
+		{"takeover/sess-1", "Admin", backend.SubscribeStreamStatusOK},
+		{"takeover/missing", "Admin", backend.SubscribeStreamStatusNotFound},
+	} {
+		resp, _ := app.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+			Path:          tc.path,
+			PluginContext: backend.PluginContext{User: &backend.User{Login: "support", Role: tc.role}},
+		})
+		if resp.Status != tc.want {
+			t.Errorf("%s as %s: status = %v, want %v", tc.path, tc.role, resp.Status, tc.want)
+		}
+	}
+}
+
+func TestTakeover_ControlsSessionAndIsAudited(t *testing.T) {
+	stdin := &recordingWriter{}
+	learnerRec, learnerSender := newStreamRecorder(t)
+	app := &App{logger: log.DefaultLogger, store: newMemoryStore(), streamSessions: map[string]*streamSession{
+		"terminal/vm-1/1": {
+			id:        "sess-1",
+			vmID:      "vm-1",
+			userLogin: "learner",
+			session:   &TerminalSession{VMID: "vm-1", stdin: stdin},
+			sender:    learnerSender,
+		},
+	}}
+	admin := backend.PluginContext{User: &backend.User{Login: "support", Role: "Admin"}}
+
+	adminRec, adminSender := newStreamRecorder(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- app.RunStream(ctx, &backend.RunStreamRequest{Path: "takeover/sess-1", PluginContext: admin}, adminSender)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for (app.getTakeover("sess-1") == nil || app.getTakeover("sess-1").fanout.viewerCount() == 0) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	publish := func(path string, pCtx backend.PluginContext) backend.PublishStreamStatus {
+		resp, err := app.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			Path:          path,
+			Data:          json.RawMessage(`{"type":"input","data":"id\r"}`),
+			PluginContext: pCtx,
+		})
+		if err != nil {
+			t.Fatalf("PublishStream(%s): %v", path, err)
+		}
+		return resp.Status
+	}
+	learner := backend.PluginContext{User: &backend.User{Login: "learner", Role: "Viewer"}}
+	if got := publish("terminal/vm-1/1", learner); got != backend.PublishStreamStatusPermissionDenied {
+		t.Errorf("learner during takeover: status = %v", got)
+	}
+	if got := publish("takeover/sess-1", admin); got != backend.PublishStreamStatusOK {
+		t.Errorf("admin: status = %v", got)
+	}
+	if len(stdin.writes) != 1 {
+		t.Errorf("stdin writes = %q", stdin.writes)
+	}
+
+	app.fanOutTerminalOutput("learner", "vm-1", []byte("uid=1000\r\n"))
+	cancel()
+	<-done
+
+	if out := adminRec.ofType("output"); len(out) != 1 || out[0].Data != "uid=1000\r\n" {
+		t.Errorf("admin output = %+v", out)
+	}
+	banners := learnerRec.ofType("output")
+	if len(banners) != 2 || !strings.Contains(banners[0].Data, "support has taken control") || !strings.Contains(banners[1].Data, "returned control") {
+		t.Errorf("learner banners = %+v", banners)
+	}
+	if got := publish("terminal/vm-1/1", learner); got != backend.PublishStreamStatusOK {
+		t.Errorf("learner after takeover: status = %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	app.handleAuditLog(w, roleRequest(http.MethodGet, "/admin/audit-log", "", "support", "Admin"))
+	var resp struct {
+		Entries []auditEntry `json:"entries"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Entries) != 2 || resp.Entries[0].Action != "session.takeover.end" || resp.Entries[1].Action != "session.takeover.start" {
+		t.Fatalf("audit entries = %+v", resp.Entries)
+	}
+	if e := resp.Entries[1]; e.Actor != "support" || e.TargetUser != "learner" || e.SessionID != "sess-1" {
+		t.Errorf("start entry = %+v", e)
+	}
+}
+
+func TestHandleAuditLog_AdminOnly(t *testing.T) {
+	app := newTestApp(t)
+	w := httptest.NewRecorder()
+	app.handleAuditLog(w, roleRequest(http.MethodGet, "/admin/audit-log", "", "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d", w.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"context"
 	"encoding/pem"
 	"fmt"
 	"io"
@@ -28,10 +29,84 @@ type TerminalSession struct {
 	onOutput func(data []byte)
 	onError  func(err error)
 
+	// pasteMode tracks whether the remote application has enabled
+	// bracketed paste (DECSET 2004) on the PTY.
+	pasteMode bracketedPasteTracker
+
 	mu     sync.Mutex
 	closed bool
 }
 
+// Bracketed paste control sequences. Applications (bash/readline, zsh, vim)
+// opt in with pasteModeOn; while enabled, pasted text must be wrapped in
+// pasteStart/pasteEnd so it is inserted literally instead of executed line
+// by line.
+const (
+	pasteModeOn  = "\x1b[?2004h"
+	pasteModeOff = "\x1b[?2004l"
+	pasteStart   = "\x1b[200~"
+	pasteEnd     = "\x1b[201~"
+)
+
+const (
+	// pasteChunkSize bounds each stdin write for pasted text. Large single
+	// writes can overrun the PTY input queue and drop or reorder bytes.
+	pasteChunkSize = 1024
+	// pasteChunkDelay gives the remote line discipline time to drain
+	// between chunks.
+	pasteChunkDelay = 5 * time.Millisecond
+	// maxPasteBytes caps a single paste message.
+	maxPasteBytes = 256 * 1024
+)
+
+// bracketedPasteTracker follows DECSET/DECRST 2004 in the output stream.
+// Sequences can straddle read boundaries, so a short tail of the previous
+// chunk is kept and scanned together with the next one.
+type bracketedPasteTracker struct {
+	mu      sync.Mutex
+	enabled bool
+	tail    []byte
+}
+
+// observe scans output for bracketed paste mode changes. The last sequence
+// seen wins.
+func (t *bracketedPasteTracker) observe(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buf := string(t.tail) + string(data)
+	on := strings.LastIndex(buf, pasteModeOn)
+	off := strings.LastIndex(buf, pasteModeOff)
+	if on > off {
+		t.enabled = true
+	} else if off > on {
+		t.enabled = false
+	}
+
+	keep := len(pasteModeOn) - 1
+	if len(buf) < keep {
+		keep = len(buf)
+	}
+	t.tail = []byte(buf[len(buf)-keep:])
+}
+
+// isEnabled reports whether bracketed paste is currently enabled.
+func (t *bracketedPasteTracker) isEnabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.enabled
+}
+
+// preparePaste wraps text for the PTY. Embedded end markers are stripped so
+// pasted content cannot terminate the bracket early and run commands.
+func preparePaste(text string, bracketed bool) []byte {
+	if !bracketed {
+		return []byte(text)
+	}
+	text = strings.ReplaceAll(text, pasteEnd, "")
+	return []byte(pasteStart + text + pasteEnd)
+}
+
 // normalizePrivateKey ensures the private key has proper newline characters
 // and validates the result is a well-formed PEM block.
 func normalizePrivateKey(key string) (string, error) {
@@ -60,10 +135,29 @@ func normalizePrivateKey(key string) (string, error) {
 	return key, nil
 }
 
+// Default relay connection timeouts, used when RelayTimeouts leaves a field zero.
+const (
+	defaultRelayHandshakeTimeout = 30 * time.Second
+	defaultSSHHandshakeTimeout   = 30 * time.Second
+)
+
+// RelayTimeouts bounds the two handshakes in ConnectSSHViaRelay. Zero fields
+// use the defaults.
+type RelayTimeouts struct {
+	WebSocketHandshake time.Duration
+	SSHHandshake       time.Duration
+}
+
 // ConnectSSHViaRelay establishes an SSH connection through a WebSocket relay.
 // This is used when direct TCP access to the VM is not available (e.g., Grafana Cloud).
-func ConnectSSHViaRelay(relayURL string, vmID string, creds *Credentials, token string) (*ssh.Client, error) {
-	logger := backend.Logger
+func ConnectSSHViaRelay(ctx context.Context, relayURL string, vmID string, creds *Credentials, token string, timeouts RelayTimeouts) (*ssh.Client, error) {
+	logger := backend.Logger.FromContext(ctx)
+	if timeouts.WebSocketHandshake <= 0 {
+		timeouts.WebSocketHandshake = defaultRelayHandshakeTimeout
+	}
+	if timeouts.SSHHandshake <= 0 {
+		timeouts.SSHHandshake = defaultSSHHandshakeTimeout
+	}
 
 	if creds == nil {
 		return nil, fmt.Errorf("credentials are nil")
@@ -80,11 +174,12 @@ func ConnectSSHViaRelay(relayURL string, vmID string, creds *Credentials, token
 	startTime := time.Now()
 
 	dialer := websocket.Dialer{
-		HandshakeTimeout: 30 * time.Second,
+		HandshakeTimeout: timeouts.WebSocketHandshake,
 	}
 
 	header := http.Header{}
 	header.Set("Authorization", "Bearer "+token)
+	setCorrelationHeader(ctx, header)
 
 	wsConn, resp, err := dialer.Dial(wsURL, header)
 	dialDuration := time.Since(startTime)
@@ -160,7 +255,7 @@ func ConnectSSHViaRelay(relayURL string, vmID string, creds *Credentials, token
 			ssh.PublicKeys(signer),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
+		Timeout:         timeouts.SSHHandshake,
 	}
 
 	addr := fmt.Sprintf("%s:%d", creds.PublicIP, creds.SSHPort)
@@ -315,6 +410,9 @@ func (ts *TerminalSession) forwardOutput() {
 			}
 			return
 		}
+		if n > 0 {
+			ts.pasteMode.observe(buf[:n])
+		}
 		if n > 0 && ts.onOutput != nil {
 			// Make a copy to avoid data race
 			data := make([]byte, n)
@@ -357,6 +455,35 @@ func (ts *TerminalSession) Write(data []byte) error {
 	return err
 }
 
+// Paste sends pasted text to stdin, wrapped in bracketed paste markers when
+// the remote application has enabled them, and written in small chunks. The
+// session lock is held throughout so keystrokes cannot interleave.
+func (ts *TerminalSession) Paste(text string) error {
+	if len(text) > maxPasteBytes {
+		return fmt.Errorf("paste too large: %d bytes (max %d)", len(text), maxPasteBytes)
+	}
+	payload := preparePaste(text, ts.pasteMode.isEnabled())
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.closed {
+		return fmt.Errorf("session is closed")
+	}
+
+	for len(payload) > 0 {
+		n := min(len(payload), pasteChunkSize)
+		if _, err := ts.stdin.Write(payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if len(payload) > 0 {
+			time.Sleep(pasteChunkDelay)
+		}
+	}
+	return nil
+}
+
 // Resize changes the terminal window size.
 func (ts *TerminalSession) Resize(rows, cols int) error {
 	ts.mu.Lock()
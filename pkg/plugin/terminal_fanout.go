@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Fan-out of one terminal session's output to extra Live streams.
+//
+// A terminal session normally has exactly one viewer: its own channel.
+// Instructor broadcasts (broadcast.go), shared terminals
+// (shared_terminal.go) and admin takeovers (takeover.go) attach more streams to an existing session. The
+// session's RunStream hands every output chunk to fanOutTerminalOutput, which
+// forwards it to each outputFanout attached to that user's session on the VM.
+
+const (
+	// fanoutReplayBytes of recent output are replayed to late joiners so
+	// they see the current prompt rather than a blank screen.
+	fanoutReplayBytes = 16 * 1024
+
+	fanoutHeartbeatInterval = 3 * time.Second
+)
+
+// outputFanout is a set of Live streams receiving the same messages.
+type outputFanout struct {
+	mu      sync.Mutex
+	viewers map[*backend.StreamSender]struct{}
+	replay  []byte
+	done    chan struct{}
+	stopped bool
+}
+
+func newOutputFanout() *outputFanout {
+	return &outputFanout{
+		viewers: make(map[*backend.StreamSender]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// publish sends an output chunk to every viewer and keeps it for replay.
+func (f *outputFanout) publish(data []byte) {
+	f.mu.Lock()
+	f.replay = append(f.replay, data...)
+	if over := len(f.replay) - fanoutReplayBytes; over > 0 {
+		f.replay = append([]byte(nil), f.replay[over:]...)
+	}
+	f.mu.Unlock()
+	f.send(TerminalStreamOutput{Type: "output", Data: string(data)})
+}
+
+// send delivers msg to every viewer without keeping it for replay.
+func (f *outputFanout) send(msg TerminalStreamOutput) {
+	f.mu.Lock()
+	viewers := make([]*backend.StreamSender, 0, len(f.viewers))
+	for sender := range f.viewers {
+		viewers = append(viewers, sender)
+	}
+	f.mu.Unlock()
+
+	for _, sender := range viewers {
+		sendStreamMessage(sender, msg)
+	}
+}
+
+// join registers sender as a viewer and returns the replay buffer.
+func (f *outputFanout) join(sender *backend.StreamSender) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.viewers[sender] = struct{}{}
+	return append([]byte(nil), f.replay...)
+}
+
+func (f *outputFanout) leave(sender *backend.StreamSender) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.viewers, sender)
+}
+
+func (f *outputFanout) viewerCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.viewers)
+}
+
+func (f *outputFanout) resetReplay() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replay = nil
+}
+
+// stop ends every runFanoutStream attached to f.
+func (f *outputFanout) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.stopped {
+		f.stopped = true
+		close(f.done)
+	}
+}
+
+// runFanoutStream attaches sender to f, sends the initial messages and the
+// replay buffer, then keeps the stream alive with heartbeats until ctx is
+// done or f is stopped.
+func runFanoutStream(ctx context.Context, sender *backend.StreamSender, f *outputFanout, endMessage string, initial ...TerminalStreamOutput) {
+	replay := f.join(sender)
+	defer f.leave(sender)
+
+	for _, msg := range initial {
+		sendStreamMessage(sender, msg)
+	}
+	if len(replay) > 0 {
+		sendStreamMessage(sender, TerminalStreamOutput{Type: "output", Data: string(replay)})
+	}
+
+	ticker := time.NewTicker(fanoutHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.done:
+			sendStreamMessage(sender, TerminalStreamOutput{Type: "disconnected", Message: endMessage})
+			return
+		case <-ticker.C:
+			sendStreamMessage(sender, TerminalStreamOutput{Type: "heartbeat"})
+		}
+	}
+}
+
+// fanOutTerminalOutput forwards an output chunk from user's session on vmID
+// to every broadcast, shared terminal and takeover attached to it.
+func (a *App) fanOutTerminalOutput(user, vmID string, data []byte) {
+	fanouts := a.broadcastFanouts(user, vmID)
+	for _, s := range a.sharedTerminalsFor(user, vmID) {
+		fanouts = append(fanouts, s.fanout)
+	}
+	fanouts = append(fanouts, a.takeoverFanouts(user, vmID)...)
+	if len(fanouts) == 0 {
+		return
+	}
+	for _, chunk := range splitOutput(data, a.liveFrameBudget()) {
+		for _, f := range fanouts {
+			f.publish([]byte(chunk))
+		}
+	}
+}
+
+// findStreamSessionForUserVM returns user's active terminal session on vmID,
+// or nil.
+func (a *App) findStreamSessionForUserVM(user, vmID string) *streamSession {
+	a.streamSessionsMu.Lock()
+	defer a.streamSessionsMu.Unlock()
+	for _, sess := range a.streamSessions {
+		if sess != nil && sess.session != nil && sess.userLogin == user && sess.vmID == vmID {
+			return sess
+		}
+	}
+	return nil
+}
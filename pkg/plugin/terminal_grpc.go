@@ -0,0 +1,339 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// gRPC terminal transport.
+//
+// Non-browser clients (CLI tooling, automated course validation) can drive a
+// sandbox terminal over a bidirectional gRPC stream instead of Grafana Live.
+// With terminalGrpcAddress set, the plugin listens there and serves
+//
+//	service pathfinder.terminal.v1.Terminal {
+//	  rpc Connect(stream google.protobuf.BytesValue) returns (stream google.protobuf.BytesValue);
+//	}
+//
+// Each client message carries one TerminalInput as JSON and each server
+// message one TerminalStreamOutput, exactly as on the Live channel. Callers
+// authenticate with "authorization: Bearer <token>" against the
+// terminalGrpcTokens secure setting ("login:token" per line, optionally
+// "login:token:Role") and act as that Grafana login in the instance's org,
+// with the given org role or Viewer. The optional "pathfinder-channel" header picks the VM the
+// same way a Live channel path does (default "terminal/new"). Half-closing
+// the client stream ends the session.
+//
+// A stream goes through SubscribeStream, RunStream and PublishStream, so
+// feature flags, the kill switch, quotas, takeovers and shared-terminal locks
+// apply unchanged. Grafana creates one app instance per org, so each org
+// runs its own listener, which follows that org's most recent instance.
+
+const (
+	terminalGRPCServiceName   = "pathfinder.terminal.v1.Terminal"
+	terminalGRPCChannelHeader = "pathfinder-channel"
+	terminalGRPCNoncePrefix   = "grpc-"
+)
+
+// terminalGRPCConnector is the handler type of the Terminal service.
+type terminalGRPCConnector interface {
+	connect(stream grpc.ServerStream) error
+}
+
+var terminalGRPCServiceDesc = grpc.ServiceDesc{
+	ServiceName: terminalGRPCServiceName,
+	HandlerType: (*terminalGRPCConnector)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Connect",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(terminalGRPCConnector).connect(stream)
+		},
+	}},
+}
+
+// terminalGRPCHosts holds each org's listener.
+type terminalGRPCHosts struct {
+	mu    sync.Mutex
+	hosts map[int64]*terminalGRPCHost
+}
+
+var terminalGRPC = &terminalGRPCHosts{}
+
+// attach hands a's org listener to a (see terminalGRPCHost.attach).
+func (hs *terminalGRPCHosts) attach(a *App) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	h := hs.hosts[a.orgID]
+	if h == nil {
+		h = &terminalGRPCHost{}
+		if hs.hosts == nil {
+			hs.hosts = map[int64]*terminalGRPCHost{}
+		}
+		hs.hosts[a.orgID] = h
+	}
+	err := h.attach(a)
+	if !h.running() {
+		delete(hs.hosts, a.orgID)
+	}
+	return err
+}
+
+// detach stops a's org listener if a is the instance serving it.
+func (hs *terminalGRPCHosts) detach(a *App) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if h := hs.hosts[a.orgID]; h != nil {
+		h.detach(a)
+		if !h.running() {
+			delete(hs.hosts, a.orgID)
+		}
+	}
+}
+
+// terminalGRPCHost owns one org's listener. Grafana replaces the org's app
+// instance on every settings change, so the server is handed from one
+// instance to the next and only restarted when its address or TLS files
+// change.
+type terminalGRPCHost struct {
+	mu     sync.Mutex
+	config string
+	server *grpc.Server
+	app    *App
+}
+
+// attach makes a, an instance of the host's org, the one serving gRPC
+// terminals, starting, restarting or stopping the listener to match its
+// settings.
+func (h *terminalGRPCHost) attach(a *App) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := a.settings
+	if s == nil || s.TerminalGRPCAddress == "" {
+		h.stopLocked()
+		return nil
+	}
+	config := strings.Join([]string{s.TerminalGRPCAddress, s.TerminalGRPCTLSCertFile, s.TerminalGRPCTLSKeyFile}, "|")
+	if h.server != nil && h.config == config {
+		h.app = a
+		return nil
+	}
+	h.stopLocked()
+
+	var opts []grpc.ServerOption
+	if s.TerminalGRPCTLSCertFile != "" || s.TerminalGRPCTLSKeyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(s.TerminalGRPCTLSCertFile, s.TerminalGRPCTLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load gRPC terminal TLS credentials: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		a.logger.Warn("gRPC terminal transport is serving without TLS", "address", s.TerminalGRPCAddress)
+	}
+	lis, err := net.Listen("tcp", s.TerminalGRPCAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC terminals: %w", err)
+	}
+
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&terminalGRPCServiceDesc, h)
+	h.server, h.config, h.app = server, config, a
+	a.logger.Info("gRPC terminal transport listening", "address", lis.Addr().String())
+	go func() { _ = server.Serve(lis) }()
+	return nil
+}
+
+// detach stops the listener if a is the instance serving it.
+func (h *terminalGRPCHost) detach(a *App) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.app == a {
+		h.stopLocked()
+	}
+}
+
+func (h *terminalGRPCHost) running() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.server != nil
+}
+
+func (h *terminalGRPCHost) stopLocked() {
+	if h.server != nil {
+		h.server.Stop()
+	}
+	h.server, h.config, h.app = nil, "", nil
+}
+
+func (h *terminalGRPCHost) connect(stream grpc.ServerStream) error {
+	h.mu.Lock()
+	a := h.app
+	h.mu.Unlock()
+	if a == nil {
+		return status.Error(codes.Unavailable, "terminal transport is shutting down")
+	}
+	return a.serveTerminalGRPC(stream)
+}
+
+// serveTerminalGRPC runs one terminal session over a gRPC stream.
+func (a *App) serveTerminalGRPC(stream grpc.ServerStream) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	ctxLogger := a.ctxLogger(ctx)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	login, role := a.terminalGRPCLogin(firstMetadata(md, "authorization"))
+	if login == "" {
+		return status.Error(codes.Unauthenticated, "missing or invalid terminal token")
+	}
+	path, err := terminalGRPCChannel(firstMetadata(md, terminalGRPCChannelHeader))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	pluginCtx := backend.PluginContext{OrgID: a.orgID, User: &backend.User{Login: login, Role: role}}
+	ctx = backend.WithPluginContext(ctx, pluginCtx)
+	ctxLogger.Info("gRPC terminal stream opened", "userLogin", login, "path", path)
+
+	sub, err := a.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	switch sub.Status {
+	case backend.SubscribeStreamStatusOK:
+	case backend.SubscribeStreamStatusPermissionDenied:
+		return status.Error(codes.PermissionDenied, "terminal access is disabled")
+	default:
+		return status.Error(codes.NotFound, "terminal not available")
+	}
+
+	packets := &grpcPacketSender{stream: stream}
+	if sub.InitialData != nil {
+		if err := packets.Send(&backend.StreamPacket{Data: sub.InitialData.Data()}); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		defer cancel()
+		for {
+			var in wrapperspb.BytesValue
+			if err := stream.RecvMsg(&in); err != nil {
+				return
+			}
+			resp, err := a.PublishStream(ctx, &backend.PublishStreamRequest{PluginContext: pluginCtx, Path: path, Data: in.Value})
+			if err != nil || resp.Status != backend.PublishStreamStatusOK {
+				ctxLogger.Debug("gRPC terminal input dropped", "path", path, "error", err)
+			}
+		}
+	}()
+
+	sender := backend.NewStreamSender(packets)
+	if err := a.RunStream(ctx, &backend.RunStreamRequest{PluginContext: pluginCtx, Path: path}, sender); err != nil && ctx.Err() == nil {
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return nil
+}
+
+// terminalGRPCToken is a gRPC terminal client's token and the org role it
+// acts with.
+type terminalGRPCToken struct {
+	Token string
+	Role  string
+}
+
+// terminalGRPCLogin returns the login and role whose token matches the
+// bearer authorization value, or "" if none does.
+func (a *App) terminalGRPCLogin(authorization string) (login, role string) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" || a.settings == nil {
+		return "", ""
+	}
+	for l, t := range a.settings.TerminalGRPCTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			login, role = l, t.Role
+		}
+	}
+	return login, role
+}
+
+// parseTerminalGRPCTokens parses "login:token" or "login:token:Role" entries
+// separated by newlines or commas; the role is Viewer unless the last
+// segment names an org role. Malformed entries are skipped.
+func parseTerminalGRPCTokens(raw string) map[string]terminalGRPCToken {
+	tokens := map[string]terminalGRPCToken{}
+	for _, entry := range splitSecretList(raw) {
+		login, token, ok := strings.Cut(entry, ":")
+		role := "Viewer"
+		if i := strings.LastIndex(token, ":"); i >= 0 {
+			switch r := strings.TrimSpace(token[i+1:]); r {
+			case "Viewer", "Editor", "Admin":
+				token, role = token[:i], r
+			}
+		}
+		login, token = strings.TrimSpace(login), strings.TrimSpace(token)
+		if ok && login != "" && token != "" {
+			tokens[login] = terminalGRPCToken{Token: token, Role: role}
+		}
+	}
+	return tokens
+}
+
+// terminalGRPCChannel returns the terminal channel path for a gRPC stream.
+// The nonce segment is always replaced so gRPC sessions never share a
+// session key with a Live subscriber or with each other.
+func terminalGRPCChannel(requested string) (string, error) {
+	if requested == "" {
+		requested = "terminal/new"
+	}
+	parts := strings.Split(requested, "/")
+	if len(parts) < 2 || parts[0] != "terminal" || parts[1] == "" {
+		return "", fmt.Errorf("invalid channel %q: want terminal/{vmId}[/{nonce}[/{template}[/{app}]]]", requested)
+	}
+	nonce := terminalGRPCNoncePrefix + rand.Text()
+	if len(parts) == 2 {
+		parts = append(parts, nonce)
+	} else {
+		parts[2] = nonce
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// grpcPacketSender unwraps the terminal frames RunStream sends and writes
+// each TerminalStreamOutput to the gRPC stream.
+type grpcPacketSender struct {
+	mu     sync.Mutex
+	stream grpc.ServerStream
+}
+
+func (s *grpcPacketSender) Send(p *backend.StreamPacket) error {
+	raw, err := unwrapTerminalFrame(p.Data)
+	if err != nil || raw == nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream.SendMsg(wrapperspb.Bytes(raw))
+}
@@ -0,0 +1,174 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTerminalGRPCChannel(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+	}{
+		{"", "terminal/new/grpc-"},
+		{"terminal/vm-1", "terminal/vm-1/grpc-"},
+		{"terminal/new/abc/vm-aws-sample-app/shop", "terminal/new/grpc-"},
+	}
+	for _, tt := range tests {
+		got, err := terminalGRPCChannel(tt.requested)
+		if err != nil || !strings.HasPrefix(got, tt.want) {
+			t.Errorf("terminalGRPCChannel(%q) = %q, %v", tt.requested, got, err)
+		}
+	}
+	if got, _ := terminalGRPCChannel("terminal/new/abc/vm-aws-sample-app/shop"); !strings.HasSuffix(got, "/vm-aws-sample-app/shop") {
+		t.Errorf("template segments lost: %q", got)
+	}
+	for _, bad := range []string{"tail/vm-1", "terminal", "terminal/"} {
+		if _, err := terminalGRPCChannel(bad); err == nil {
+			t.Errorf("terminalGRPCChannel(%q) accepted", bad)
+		}
+	}
+}
+
+func TestServeTerminalGRPC(t *testing.T) {
+	app := newTestApp(t)
+	app.settings = &Settings{TerminalGRPCTokens: parseTerminalGRPCTokens("alice:s3cret\nbroken-entry")}
+	app.streamSessions = map[string]*streamSession{}
+	app.userVMs = map[string]string{}
+	var codaCalls int
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		codaCalls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&terminalGRPCServiceDesc, &terminalGRPCHost{app: app})
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	connect := func(token string) (grpc.ClientStream, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		t.Cleanup(cancel)
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+		stream, err := conn.NewStream(ctx, &terminalGRPCServiceDesc.Streams[0], "/"+terminalGRPCServiceName+"/Connect")
+		if err != nil {
+			return nil, err
+		}
+		var msg wrapperspb.BytesValue
+		err = stream.RecvMsg(&msg)
+		if err != nil {
+			return stream, err
+		}
+		if _, err := parseTerminalOutput(msg.Value); err != nil {
+			t.Fatalf("decode output %q: %v", msg.Value, err)
+		}
+		return stream, nil
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if _, err := connect(token); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("token %q: err = %v, want Unauthenticated", token, err)
+		}
+	}
+
+	stream, err := connect("s3cret")
+	if err != nil {
+		t.Fatalf("authorized stream: %v", err)
+	}
+	for err == nil {
+		err = stream.RecvMsg(&wrapperspb.BytesValue{})
+	}
+	if status.Code(err) != codes.Aborted || codaCalls == 0 {
+		t.Errorf("stream ended with %v after %d Coda calls, want Aborted from the failed VM lookup", err, codaCalls)
+	}
+
+	disabled := false
+	app.settings.Features.Terminal = &disabled
+	if _, err := connect("s3cret"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("terminal feature off: err = %v, want PermissionDenied", err)
+	}
+}
+
+func TestParseTerminalGRPCTokens(t *testing.T) {
+	got := parseTerminalGRPCTokens("alice:s3cret\nroot:t0ken:Admin, carol:a:b\nbroken-entry")
+	want := map[string]terminalGRPCToken{
+		"alice": {Token: "s3cret", Role: "Viewer"},
+		"root":  {Token: "t0ken", Role: "Admin"},
+		"carol": {Token: "a:b", Role: "Viewer"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tokens = %+v", got)
+	}
+	for login, tok := range want {
+		if got[login] != tok {
+			t.Errorf("%s = %+v, want %+v", login, got[login], tok)
+		}
+	}
+	app := newTestApp(t)
+	app.settings = &Settings{TerminalGRPCTokens: got}
+	if login, role := app.terminalGRPCLogin("Bearer t0ken"); login != "root" || role != "Admin" {
+		t.Errorf("terminalGRPCLogin = %q %q", login, role)
+	}
+}
+
+func TestTerminalGRPCHostsPerOrg(t *testing.T) {
+	hosts := &terminalGRPCHosts{}
+	org1 := newTestApp(t)
+	org1.orgID = 1
+	org1.settings = &Settings{TerminalGRPCAddress: "127.0.0.1:0"}
+	org2 := newTestApp(t)
+	org2.orgID = 2
+	org2.settings = &Settings{}
+
+	if err := hosts.attach(org1); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hosts.detach(org1) })
+	if err := hosts.attach(org2); err != nil {
+		t.Fatal(err)
+	}
+	hosts.detach(org2)
+	if h := hosts.hosts[1]; h == nil || !h.running() || h.app != org1 {
+		t.Fatal("another org's instance stopped or took over org 1's listener")
+	}
+
+	// A replacement instance for org 1 takes the listener over, and
+	// disposing the old one leaves it running.
+	next := newTestApp(t)
+	next.orgID = 1
+	next.settings = &Settings{TerminalGRPCAddress: "127.0.0.1:0"}
+	if err := hosts.attach(next); err != nil {
+		t.Fatal(err)
+	}
+	hosts.detach(org1)
+	if h := hosts.hosts[1]; h == nil || h.app != next {
+		t.Fatal("disposing the replaced instance stopped the listener")
+	}
+	hosts.detach(next)
+	if len(hosts.hosts) != 0 {
+		t.Errorf("hosts left after detach: %v", hosts.hosts)
+	}
+}
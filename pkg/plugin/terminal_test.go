@@ -3,6 +3,7 @@ package plugin
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -193,3 +194,77 @@ func TestCategorizeConnectionError(t *testing.T) {
 		})
 	}
 }
+
+func TestBracketedPasteTracker(t *testing.T) {
+	var tr bracketedPasteTracker
+
+	tr.observe([]byte("prompt$ "))
+	if tr.isEnabled() {
+		t.Fatal("enabled before any DECSET 2004")
+	}
+
+	// Sequence split across two reads.
+	tr.observe([]byte("bash-5.2$ \x1b[?20"))
+	tr.observe([]byte("04h"))
+	if !tr.isEnabled() {
+		t.Fatal("split enable sequence not detected")
+	}
+
+	// Last sequence in a chunk wins.
+	tr.observe([]byte("\x1b[?2004h vim \x1b[?2004l"))
+	if tr.isEnabled() {
+		t.Error("disable after enable in the same chunk should leave mode off")
+	}
+}
+
+func TestPreparePaste(t *testing.T) {
+	if got := string(preparePaste("a\nb", false)); got != "a\nb" {
+		t.Errorf("unbracketed = %q", got)
+	}
+	if got := string(preparePaste("a\nb", true)); got != "\x1b[200~a\nb\x1b[201~" {
+		t.Errorf("bracketed = %q", got)
+	}
+	if got := string(preparePaste("x\x1b[201~rm -rf /\n", true)); got != "\x1b[200~xrm -rf /\n\x1b[201~" {
+		t.Errorf("embedded end marker not stripped: %q", got)
+	}
+}
+
+type recordingWriter struct {
+	writes [][]byte
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+func TestTerminalSessionPaste_Chunks(t *testing.T) {
+	stdin := &recordingWriter{}
+	ts := &TerminalSession{stdin: stdin}
+	ts.pasteMode.observe([]byte(pasteModeOn))
+
+	text := strings.Repeat("echo hello\n", 200)
+	if err := ts.Paste(text); err != nil {
+		t.Fatalf("Paste: %v", err)
+	}
+
+	var joined []byte
+	for _, w := range stdin.writes {
+		if len(w) > pasteChunkSize {
+			t.Errorf("chunk of %d bytes exceeds %d", len(w), pasteChunkSize)
+		}
+		joined = append(joined, w...)
+	}
+	if want := pasteStart + text + pasteEnd; string(joined) != want {
+		t.Errorf("reassembled paste mismatch: got %d bytes, want %d", len(joined), len(want))
+	}
+	if len(stdin.writes) < 2 {
+		t.Errorf("expected multiple chunks, got %d", len(stdin.writes))
+	}
+
+	if err := ts.Paste(strings.Repeat("x", maxPasteBytes+1)); err == nil {
+		t.Error("expected an error for an oversized paste")
+	}
+}
@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Usage export.
+//
+// Every terminal session that ends leaves a usageRecord in the plugin store
+// (newest maxUsageRecords kept) unless analytics is off (see features.go). GET /usage/export aggregates the sessions
+// that started in a time range into one row per user, guide and template,
+// as JSON or CSV, for feeding sandbox consumption into internal reporting.
+
+const (
+	usageCollection = "usage-sessions"
+	maxUsageRecords = 10000
+
+	defaultUsageExportRange = 30 * 24 * time.Hour
+)
+
+// usageRecord is one finished terminal session.
+type usageRecord struct {
+	User      string    `json:"user"`
+	Guide     string    `json:"guide,omitempty"`
+	Template  string    `json:"template,omitempty"`
+	VMID      string    `json:"vmId"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	BytesIn   int64     `json:"bytesIn"`
+	BytesOut  int64     `json:"bytesOut"`
+}
+
+// usageRow is one aggregated row of GET /usage/export.
+type usageRow struct {
+	User           string  `json:"user"`
+	Guide          string  `json:"guide"`
+	Template       string  `json:"template"`
+	Sessions       int     `json:"sessions"`
+	VMs            int     `json:"vms"`
+	ConnectedHours float64 `json:"connectedHours"`
+	BytesIn        int64   `json:"bytesIn"`
+	BytesOut       int64   `json:"bytesOut"`
+	Email          string  `json:"email,omitempty"`
+	EmployeeID     string  `json:"employeeId,omitempty"`
+}
+
+// recordUsage stores a usage record for sess, which just ended, and drops the
+// oldest records beyond maxUsageRecords.
+func (a *App) recordUsage(ctxLogger log.Logger, sess *streamSession) {
+	if sess.startedAt.IsZero() || !a.featureEnabled(featureAnalytics) {
+		return
+	}
+	now := timeNow().UTC()
+	rec := usageRecord{
+		User:      sess.userLogin,
+		Guide:     sess.logLabels.guide,
+		Template:  sess.template,
+		VMID:      sess.vmID,
+		StartedAt: sess.startedAt.UTC(),
+		EndedAt:   now,
+	}
+	if sess.traffic != nil {
+		rec.BytesIn = sess.traffic.bytesIn.Load()
+		rec.BytesOut = sess.traffic.bytesOut.Load()
+	}
+	if err := a.store.put(usageCollection, fmt.Sprintf("%020d-%s", now.UnixNano(), sess.id), rec); err != nil {
+		ctxLogger.Warn("Failed to record session usage", "vmID", sess.vmID, "error", err)
+		return
+	}
+	keys := a.store.keys(usageCollection)
+	for len(keys) > maxUsageRecords {
+		if err := a.store.delete(usageCollection, keys[0]); err != nil {
+			ctxLogger.Warn("Failed to prune usage records", "error", err)
+			return
+		}
+		keys = keys[1:]
+	}
+}
+
+// aggregateUsage groups the records that started in [from, to) by user,
+// guide and template.
+func (a *App) aggregateUsage(from, to time.Time) []usageRow {
+	type rowKey struct{ user, guide, template string }
+	rows := map[rowKey]*usageRow{}
+	vms := map[rowKey]map[string]bool{}
+	for _, key := range a.store.keys(usageCollection) {
+		var rec usageRecord
+		if ok, err := a.store.get(usageCollection, key, &rec); err != nil || !ok {
+			continue
+		}
+		if rec.StartedAt.Before(from) || !rec.StartedAt.Before(to) {
+			continue
+		}
+		k := rowKey{rec.User, rec.Guide, rec.Template}
+		row := rows[k]
+		if row == nil {
+			row = &usageRow{User: rec.User, Guide: rec.Guide, Template: rec.Template}
+			rows[k] = row
+			vms[k] = map[string]bool{}
+		}
+		row.Sessions++
+		row.ConnectedHours += rec.EndedAt.Sub(rec.StartedAt).Hours()
+		row.BytesIn += rec.BytesIn
+		row.BytesOut += rec.BytesOut
+		vms[k][rec.VMID] = true
+	}
+
+	result := make([]usageRow, 0, len(rows))
+	identities := map[string]externalIdentity{}
+	for k, row := range rows {
+		row.VMs = len(vms[k])
+		id, ok := identities[row.User]
+		if !ok {
+			id, _ = a.identity(row.User)
+			identities[row.User] = id
+		}
+		row.Email, row.EmployeeID = id.Email, id.EmployeeID
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].User != result[j].User {
+			return result[i].User < result[j].User
+		}
+		if result[i].Guide != result[j].Guide {
+			return result[i].Guide < result[j].Guide
+		}
+		return result[i].Template < result[j].Template
+	})
+	return result
+}
+
+// handleUsageExport handles GET /usage/export?from=T&to=T&format=json|csv
+// (admin only). from and to are RFC 3339; the default range is the last 30
+// days.
+func (a *App) handleUsageExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if userLoginFromContext(r.Context()) == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can export usage", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	to := timeNow().UTC()
+	if raw := query.Get("to"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			a.writeError(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultUsageExportRange)
+	if raw := query.Get("from"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			a.writeError(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		a.writeError(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	rows := a.aggregateUsage(from, to)
+	switch format := query.Get("format"); format {
+	case "", "json":
+		a.writeJSON(w, map[string]interface{}{"from": from, "to": to, "rows": rows}, http.StatusOK)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"pathfinder-usage-%s-%s.csv\"", from.Format("20060102"), to.Format("20060102")))
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"user", "guide", "template", "sessions", "vms", "connected_hours", "bytes_in", "bytes_out", "email", "employee_id"})
+		for _, row := range rows {
+			_ = cw.Write([]string{
+				row.User,
+				row.Guide,
+				row.Template,
+				strconv.Itoa(row.Sessions),
+				strconv.Itoa(row.VMs),
+				strconv.FormatFloat(row.ConnectedHours, 'f', 3, 64),
+				strconv.FormatInt(row.BytesIn, 10),
+				strconv.FormatInt(row.BytesOut, 10),
+				row.Email,
+				row.EmployeeID,
+			})
+		}
+		cw.Flush()
+	default:
+		a.writeError(w, "format must be json or csv", http.StatusBadRequest)
+	}
+}
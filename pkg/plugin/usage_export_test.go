@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestHandleUsageExport(t *testing.T) {
+	base := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	now := base
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	app := newTestApp(t)
+	for i, s := range []struct {
+		user, guide, vm string
+		dur             time.Duration
+	}{
+		{"alice", "prom-101", "vm-1", 30 * time.Minute},
+		{"alice", "prom-101", "vm-1", 90 * time.Minute},
+		{"alice", "loki-101", "vm-2", time.Hour},
+		{"bob", "prom-101", "vm-3", time.Hour},
+	} {
+		start := base.Add(time.Duration(i) * 24 * time.Hour)
+		now = start.Add(s.dur)
+		traffic := &sessionTraffic{}
+		traffic.recordIn(10)
+		app.recordUsage(log.DefaultLogger, &streamSession{
+			id:        "s" + string(rune('a'+i)),
+			userLogin: s.user,
+			vmID:      s.vm,
+			template:  "vm-aws",
+			logLabels: lokiLabels{guide: s.guide},
+			startedAt: start,
+			traffic:   traffic,
+		})
+	}
+
+	w := httptest.NewRecorder()
+	app.handleUsageExport(w, roleRequest(http.MethodGet, "/usage/export", "", "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	app.handleUsageExport(w, roleRequest(http.MethodGet, "/usage/export?from=2026-05-01T00:00:00Z&to=2026-05-03T00:00:00Z", "", "admin", "Admin"))
+	var resp struct {
+		Rows []usageRow `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+	if len(resp.Rows) != 1 {
+		t.Fatalf("rows = %+v", resp.Rows)
+	}
+	if r := resp.Rows[0]; r.User != "alice" || r.Guide != "prom-101" || r.Sessions != 2 || r.VMs != 1 || r.ConnectedHours != 2 || r.BytesIn != 20 {
+		t.Errorf("row = %+v", r)
+	}
+
+	if _, err := app.setIdentity("bob", IdentityRequest{EmployeeID: "E1002"}); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	app.handleUsageExport(w, roleRequest(http.MethodGet, "/usage/export?format=csv&from=2026-05-01T00:00:00Z&to=2026-06-01T00:00:00Z", "", "admin", "Admin"))
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "user" || records[1][1] != "loki-101" || records[3][0] != "bob" || records[3][5] != "1.000" || records[3][9] != "E1002" {
+		t.Errorf("csv = %v", records)
+	}
+
+	for _, q := range []string{"?format=xml", "?from=yesterday", "?from=2026-06-01T00:00:00Z&to=2026-05-01T00:00:00Z"} {
+		w = httptest.NewRecorder()
+		app.handleUsageExport(w, roleRequest(http.MethodGet, "/usage/export"+q, "", "admin", "Admin"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", q, w.Code)
+		}
+	}
+}
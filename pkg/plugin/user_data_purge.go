@@ -0,0 +1,361 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// User data purge.
+//
+// DELETE /admin/users/{login}/data erases what the plugin stores about one
+// user, for data-subject deletion requests:
+//
+//   - workspaces, script runs, session usage records, learning activity,
+//     preferences, bookmarks, guide history, step progress, step comments,
+//     the external identity and audit entries naming the user as actor or
+//     target are deleted;
+//   - the user's VM assignment and idle tracking are forgotten, and with
+//     ?destroyVms=true the assigned and workspace VMs are destroyed;
+//   - workshops and provisioning schedules belong to the admins who created
+//     them, so the user's login in them (creator, claims) is replaced with
+//     purgedUserPlaceholder and roster reservations are released; so is the
+//     reporter of their broken-step reports.
+//
+// The purge refuses to run while the user has a connected terminal, because
+// ending sessions write new usage records. Data kept outside the plugin
+// (completion records in App Platform, Loki transcripts, remote-written
+// metrics) is listed in the report for the operator to erase there. The
+// purge itself is audited without the user's login.
+
+const purgedUserPlaceholder = "[deleted user]"
+
+// purgeReport is the response of DELETE /admin/users/{login}/data.
+type purgeReport struct {
+	User     string        `json:"user"`
+	Deleted  purgeDeleted  `json:"deleted"`
+	Redacted purgeRedacted `json:"redacted"`
+	VMs      []purgedVM    `json:"vms"`
+	External []string      `json:"external"`
+}
+
+type purgeDeleted struct {
+	Workspaces       int `json:"workspaces"`
+	ScriptRuns       int `json:"scriptRuns"`
+	UsageRecords     int `json:"usageRecords"`
+	AuditEntries     int `json:"auditEntries"`
+	VMAssignments    int `json:"vmAssignments"`
+	LearningActivity int `json:"learningActivity"`
+	Preferences      int `json:"preferences"`
+	Bookmarks        int `json:"bookmarks"`
+	GuideHistory     int `json:"guideHistory"`
+	StepProgress     int `json:"stepProgress"`
+	Identity         int `json:"identity"`
+	StepComments     int `json:"stepComments"`
+	// ExperimentExposures are the user's A/B test assignments.
+	ExperimentExposures int `json:"experimentExposures"`
+	// RecommendationFeedback are the user's ratings of recommendations.
+	RecommendationFeedback int `json:"recommendationFeedback"`
+	// SessionRecords are the user's persisted terminal sessions.
+	SessionRecords int `json:"sessionRecords"`
+}
+
+type purgeRedacted struct {
+	Workshops             int `json:"workshops"`
+	ProvisioningSchedules int `json:"provisioningSchedules"`
+	StepReports           int `json:"stepReports"`
+	// AnalyticsRollups are the rollups the user was removed from; their
+	// counts are kept.
+	AnalyticsRollups int `json:"analyticsRollups"`
+}
+
+// purgedVM is a VM that was associated with the user.
+type purgedVM struct {
+	VMID      string `json:"vmId"`
+	Destroyed bool   `json:"destroyed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// handleAdminUserData handles DELETE /admin/users/{login}/data (admin only).
+func (a *App) handleAdminUserData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin := userLoginFromContext(r.Context())
+	if admin == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can purge user data", http.StatusForbidden)
+		return
+	}
+
+	login, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/data")
+	if !ok || login == "" || strings.Contains(login, "/") {
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	destroyVMs := r.URL.Query().Get("destroyVms") == "true"
+	if destroyVMs && a.coda == nil {
+		a.writeError(w, "Coda not registered - configure enrollment key and register first", http.StatusServiceUnavailable)
+		return
+	}
+	if n := a.countUserSessions(login); n > 0 {
+		a.writeError(w, fmt.Sprintf("%s has %d connected terminal session(s); disconnect them first with DELETE /admin/sessions/{id}", login, n), http.StatusConflict)
+		return
+	}
+
+	ctxLogger := a.ctxLogger(r.Context())
+	report, err := a.purgeUserData(login, r.URL.Query().Get("email"))
+	if err != nil {
+		ctxLogger.Error("User data purge failed", "error", err)
+		a.writeError(w, "Failed to purge user data: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if destroyVMs {
+		for i, vm := range report.VMs {
+			if err := a.coda.DeleteVM(r.Context(), vm.VMID, true); err != nil {
+				ctxLogger.Error("Failed to destroy VM of purged user", "vmID", vm.VMID, "error", err)
+				report.VMs[i].Error = err.Error()
+				status = http.StatusBadGateway
+				continue
+			}
+			report.VMs[i].Destroyed = true
+		}
+	}
+
+	a.recordAudit(ctxLogger, auditEntry{Actor: admin, Action: "user.purge", Details: fmt.Sprintf(
+		"deleted %d workspaces, %d script runs, %d usage records, %d audit entries; redacted %d workshops, %d schedules",
+		report.Deleted.Workspaces, report.Deleted.ScriptRuns, report.Deleted.UsageRecords, report.Deleted.AuditEntries,
+		report.Redacted.Workshops, report.Redacted.ProvisioningSchedules)})
+	a.writeJSON(w, report, status)
+}
+
+// countUserSessions returns the number of connected terminal sessions login
+// owns.
+func (a *App) countUserSessions(login string) int {
+	a.streamSessionsMu.Lock()
+	defer a.streamSessionsMu.Unlock()
+	n := 0
+	for _, sess := range a.streamSessions {
+		if sess != nil && sess.userLogin == login {
+			n++
+		}
+	}
+	return n
+}
+
+// purgeUserData removes or redacts everything stored about login. email, if
+// given, also matches workshop roster reservations made by email.
+func (a *App) purgeUserData(login, email string) (*purgeReport, error) {
+	report := &purgeReport{User: login, VMs: []purgedVM{}, External: a.externalUserData()}
+	vmIDs := map[string]bool{}
+	var err error
+
+	for _, ws := range a.listWorkspaces(login) {
+		if ws.VMID != "" {
+			vmIDs[ws.VMID] = true
+		}
+	}
+	prefix := login + "/"
+	if report.Deleted.Workspaces, err = a.deleteRecords(workspaceCollection, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.ScriptRuns, err = a.deleteRecords(scriptRunCollection, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.UsageRecords, err = a.deleteRecords(usageCollection, func(key string) bool {
+		var rec usageRecord
+		ok, err := a.store.get(usageCollection, key, &rec)
+		return ok && err == nil && rec.User == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.LearningActivity, err = a.deleteRecords(learningActivityCollection, func(key string) bool {
+		return key == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.Preferences, err = a.deleteRecords(preferencesCollection, func(key string) bool {
+		return key == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.Bookmarks, err = a.deleteRecords(bookmarkCollection, func(key string) bool {
+		return key == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.GuideHistory, err = a.deleteRecords(historyCollection, func(key string) bool {
+		return key == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.StepProgress, err = a.deleteRecords(progressCollection, func(key string) bool {
+		return key == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.Identity, err = a.deleteRecords(identityCollection, func(key string) bool {
+		return key == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.StepComments, err = a.deleteRecords(stepCommentCollection, func(key string) bool {
+		var c stepComment
+		ok, err := a.store.get(stepCommentCollection, key, &c)
+		return ok && err == nil && c.Author == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.ExperimentExposures, err = a.deleteRecords(experimentExposureCollection, func(key string) bool {
+		var x experimentExposure
+		ok, err := a.store.get(experimentExposureCollection, key, &x)
+		return ok && err == nil && x.User == login
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.RecommendationFeedback, err = a.deleteRecords(recommendationFeedbackCollection, func(key string) bool {
+		return strings.HasPrefix(key, login+"/")
+	}); err != nil {
+		return nil, err
+	}
+	if report.Deleted.AuditEntries, err = a.deleteRecords(auditCollection, func(key string) bool {
+		var entry auditEntry
+		ok, err := a.store.get(auditCollection, key, &entry)
+		return ok && err == nil && (entry.Actor == login || entry.TargetUser == login)
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, w := range a.listWorkshops() {
+		if !workshopMentions(w, login, email) {
+			continue
+		}
+		if _, ok := a.updateWorkshop(w.Name, func(w *workshop) { redactWorkshop(w, login, email) }); ok {
+			report.Redacted.Workshops++
+		}
+	}
+	for _, s := range a.listSchedules() {
+		if _, claimed := s.Claims[login]; s.CreatedBy != login && !claimed {
+			continue
+		}
+		if _, ok := a.updateSchedule(s.ID, func(s *provisioningSchedule) {
+			if s.CreatedBy == login {
+				s.CreatedBy = purgedUserPlaceholder
+			}
+			delete(s.Claims, login)
+		}); ok {
+			report.Redacted.ProvisioningSchedules++
+		}
+	}
+	a.stepReportsMu.Lock()
+	for _, key := range a.store.keys(stepReportCollection) {
+		var step brokenStep
+		if ok, err := a.store.get(stepReportCollection, key, &step); err != nil || !ok {
+			continue
+		}
+		redacted := false
+		for i := range step.Reports {
+			if step.Reports[i].Reporter == login {
+				step.Reports[i].Reporter = purgedUserPlaceholder
+				redacted = true
+			}
+		}
+		if !redacted {
+			continue
+		}
+		if err := a.store.put(stepReportCollection, key, step); err != nil {
+			a.stepReportsMu.Unlock()
+			return nil, err
+		}
+		report.Redacted.StepReports++
+	}
+	a.stepReportsMu.Unlock()
+	if report.Redacted.AnalyticsRollups, err = a.forgetAnalyticsLearner(login); err != nil {
+		return nil, err
+	}
+
+	a.userVMsMu.Lock()
+	vmID, assigned := a.userVMs[login]
+	a.userVMsMu.Unlock()
+	if assigned {
+		vmIDs[vmID] = true
+		a.forgetUserVM(login)
+		report.Deleted.VMAssignments++
+	}
+	report.Deleted.SessionRecords = a.forgetUserSessions(login)
+	a.idleVMs.mu.Lock()
+	for vmID, act := range a.idleVMs.vms {
+		if act.owner == login {
+			vmIDs[vmID] = true
+			delete(a.idleVMs.vms, vmID)
+		}
+	}
+	a.idleVMs.mu.Unlock()
+
+	for vmID := range vmIDs {
+		report.VMs = append(report.VMs, purgedVM{VMID: vmID})
+	}
+	sort.Slice(report.VMs, func(i, j int) bool { return report.VMs[i].VMID < report.VMs[j].VMID })
+	return report, nil
+}
+
+// deleteRecords deletes the keys of collection that match.
+func (a *App) deleteRecords(collection string, match func(key string) bool) (int, error) {
+	var keys []string
+	for _, key := range a.store.keys(collection) {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	return a.store.deleteKeys(collection, keys)
+}
+
+func workshopMentions(w workshop, login, email string) bool {
+	if w.CreatedBy == login {
+		return true
+	}
+	for _, vm := range w.VMs {
+		if vm.ClaimedBy == login || vm.assignedTo(login, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactWorkshop(w *workshop, login, email string) {
+	if w.CreatedBy == login {
+		w.CreatedBy = purgedUserPlaceholder
+	}
+	for i := range w.VMs {
+		if w.VMs[i].ClaimedBy == login {
+			w.VMs[i].ClaimedBy = purgedUserPlaceholder
+		}
+		if w.VMs[i].assignedTo(login, email) {
+			w.VMs[i].AssignedTo = ""
+		}
+	}
+}
+
+// externalUserData lists user data the plugin sends elsewhere and cannot
+// delete.
+func (a *App) externalUserData() []string {
+	external := []string{"Completion records (learning progress) are stored in Grafana App Platform, not by the plugin"}
+	if a.loki != nil {
+		external = append(external, "Terminal transcripts and session events exported to Loki carry a user label and must be deleted there")
+	}
+	if a.metrics != nil {
+		external = append(external, "VM metrics sent with Prometheus remote write carry a user label and must be deleted there")
+	}
+	return external
+}
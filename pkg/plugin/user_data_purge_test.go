@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleAdminUserData(t *testing.T) {
+	app := newTestApp(t)
+	app.streamSessions = map[string]*streamSession{}
+	app.userVMs = map[string]string{"alice": "vm-a", "bob": "vm-b"}
+	app.noteVMActivity("vm-a", "alice", timeNow())
+
+	puts := []struct {
+		collection, key string
+		doc             interface{}
+	}{
+		{workspaceCollection, workspaceKey("alice", "lab"), workspace{Name: "lab", Owner: "alice", VMID: "vm-ws"}},
+		{workspaceCollection, workspaceKey("bob", "lab"), workspace{Name: "lab", Owner: "bob"}},
+		{scriptRunCollection, "alice/00000000000000000001", scriptRun{User: "alice"}},
+		{usageCollection, "00000000000000000001-s1", usageRecord{User: "alice"}},
+		{usageCollection, "00000000000000000002-s2", usageRecord{User: "bob"}},
+		{auditCollection, "00000000000000000001", auditEntry{Actor: "root", TargetUser: "alice"}},
+		{auditCollection, "00000000000000000002", auditEntry{Actor: "root", TargetUser: "bob"}},
+		{workshopCollection, "ws1", workshop{Name: "ws1", CreatedBy: "root", VMs: []workshopVM{
+			{VMID: "vm-1", ClaimedBy: "alice"},
+			{VMID: "vm-2", AssignedTo: "alice@example.com"},
+			{VMID: "vm-3", ClaimedBy: "bob"},
+		}}},
+		{learningActivityCollection, "alice", learnerActivity{User: "alice"}},
+		{learningActivityCollection, "bob", learnerActivity{User: "bob"}},
+		{preferencesCollection, "alice", UserPreferences{TerminalFontSize: 16}},
+		{bookmarkCollection, "alice", userBookmarks{Bookmarks: []guideBookmark{{GuideID: "loki-101"}}}},
+		{historyCollection, "alice", guideHistory{Entries: []guideHistoryEntry{{GuideID: "loki-101"}}}},
+		{progressCollection, "alice", userProgress{}},
+		{identityCollection, "alice", externalIdentity{Login: "alice", Email: "alice@example.com"}},
+		{stepCommentCollection, "loki-101/c1", stepComment{ID: "c1", Guide: "loki-101", Author: "alice"}},
+		{stepCommentCollection, "loki-101/c2", stepComment{ID: "c2", Guide: "loki-101", Author: "bob"}},
+		{experimentExposureCollection, "short-intro/alice", experimentExposure{Experiment: "short-intro", User: "alice", Variant: "a"}},
+		{experimentExposureCollection, "short-intro/bob", experimentExposure{Experiment: "short-intro", User: "bob", Variant: "b"}},
+		{stepReportCollection, "loki-101/step-2", brokenStep{Guide: "loki-101", StepID: "step-2", Reports: []stepReport{{Reporter: "alice"}, {Reporter: "bob"}}}},
+		{analyticsCollection, "day/2026-05-01/loki-101", analyticsDay{Day: "2026-05-01", Guide: "loki-101", Opens: 2, Learners: []string{learnerHash("alice"), learnerHash("bob")}}},
+		{analyticsCollection, "funnel/loki-101", analyticsFunnel{Guide: "loki-101", TotalSteps: 3, Furthest: map[string]int{learnerHash("alice"): 1}, Completed: map[string]bool{}}},
+		{recommendationFeedbackCollection, feedbackKey("alice", "https://grafana.com/docs/loki/"), recommendationFeedback{User: "alice", URL: "https://grafana.com/docs/loki/", Signal: "up"}},
+		{recommendationFeedbackCollection, feedbackKey("bob", "https://grafana.com/docs/loki/"), recommendationFeedback{User: "bob", URL: "https://grafana.com/docs/loki/", Signal: "down"}},
+		{scheduleCollection, "s1", provisioningSchedule{ID: "s1", CreatedBy: "alice", Claims: map[string]string{"alice": "vm-9", "bob": "vm-8"}}},
+	}
+	for _, p := range puts {
+		if err := app.store.put(p.collection, p.key, p.doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	app.handleAdminUserData(w, roleRequest(http.MethodDelete, "/admin/users/alice/data", "", "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("editor: status = %d", w.Code)
+	}
+
+	app.streamSessions["terminal/vm-a/1"] = &streamSession{userLogin: "alice"}
+	w = httptest.NewRecorder()
+	app.handleAdminUserData(w, roleRequest(http.MethodDelete, "/admin/users/alice/data", "", "root", "Admin"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("connected user: status = %d", w.Code)
+	}
+	delete(app.streamSessions, "terminal/vm-a/1")
+
+	w = httptest.NewRecorder()
+	app.handleAdminUserData(w, roleRequest(http.MethodDelete, "/admin/users/alice/data?email=alice@example.com", "", "root", "Admin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report purgeReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	want := purgeDeleted{Workspaces: 1, ScriptRuns: 1, UsageRecords: 1, AuditEntries: 1, VMAssignments: 1, LearningActivity: 1, Preferences: 1, Bookmarks: 1, GuideHistory: 1, StepProgress: 1, Identity: 1, StepComments: 1, ExperimentExposures: 1, RecommendationFeedback: 1}
+	if report.Deleted != want {
+		t.Errorf("deleted = %+v, want %+v", report.Deleted, want)
+	}
+	if report.Redacted != (purgeRedacted{Workshops: 1, ProvisioningSchedules: 1, StepReports: 1, AnalyticsRollups: 2}) {
+		t.Errorf("redacted = %+v", report.Redacted)
+	}
+	if len(report.VMs) != 2 || report.VMs[0].VMID != "vm-a" || report.VMs[1].VMID != "vm-ws" || report.VMs[0].Destroyed {
+		t.Errorf("vms = %+v", report.VMs)
+	}
+	if len(report.External) == 0 {
+		t.Error("report lists no external data")
+	}
+
+	if app.userVMs["bob"] != "vm-b" || app.userVMs["alice"] != "" {
+		t.Errorf("userVMs = %v", app.userVMs)
+	}
+	ws, _ := app.getWorkshop("ws1")
+	if ws.VMs[0].ClaimedBy != purgedUserPlaceholder || ws.VMs[1].AssignedTo != "" || ws.VMs[2].ClaimedBy != "bob" {
+		t.Errorf("workshop VMs = %+v", ws.VMs)
+	}
+	var sched provisioningSchedule
+	_, _ = app.store.get(scheduleCollection, "s1", &sched)
+	if sched.CreatedBy != purgedUserPlaceholder || len(sched.Claims) != 1 || sched.Claims["bob"] != "vm-8" {
+		t.Errorf("schedule = %+v", sched)
+	}
+	var audit []auditEntry
+	for _, key := range app.store.keys(auditCollection) {
+		var e auditEntry
+		_, _ = app.store.get(auditCollection, key, &e)
+		audit = append(audit, e)
+	}
+	if len(audit) != 2 || audit[0].TargetUser != "bob" || audit[1].Action != "user.purge" || audit[1].TargetUser != "" {
+		t.Errorf("audit log = %+v", audit)
+	}
+}
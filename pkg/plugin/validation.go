@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Request body validation.
+//
+// Request types declare their constraints in a validate struct tag, and
+// handlers read bodies with decodeRequest, which answers 400 listing every
+// invalid field:
+//
+//	{"error": "Invalid request body: name must ...", "fields": [{"field": "name", "message": "must ..."}]}
+//
+// Rules are comma-separated:
+//
+//   - required: present and not blank
+//   - min=N, max=N: bounds on a number, or on a string's or list's length
+//   - oneof=a b: one of the listed values
+//   - pattern=name: matches validationPatterns[name]
+//   - each: the rules after it apply to every element of a list
+//
+// Rules other than required skip zero values, so optional fields can carry
+// them. Checks that depend on state (ownership, timing, the caller) stay in
+// the handlers. Terminal input over Live uses the same rules, and the
+// OpenAPI document reflects them.
+
+// validationPatterns are the named patterns for the pattern rule, with the
+// message shown when a value doesn't match.
+var validationPatterns = map[string]struct {
+	re      *regexp.Regexp
+	message string
+}{
+	"name":     {workspaceNamePattern, "must be 1-40 lowercase letters, digits, or hyphens"},
+	"template": {vmTemplateIDPattern, "must be a Coda template name such as vm-aws-sample-app"},
+	"pluginId": {pluginIDPattern, "must be a plugin ID such as grafana-clock-panel"},
+	"version":  {pluginVersionPattern, "must be a version such as 2.1.0"},
+	"guideId":  {guideIDPattern, "must be a guide ID such as alerting-101"},
+	"language": {languageTagPattern, "must be a language tag such as en or pt-BR"},
+	"email":    {emailPattern, "must be an email address"},
+}
+
+// fieldError is one invalid field of a request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// decodeRequest decodes the JSON body of r into v and validates it. On
+// failure it writes a 400 and returns false.
+func (a *App) decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			a.writeError(w, bodyTooLargeError(tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		a.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	errs := validateRequest(v)
+	if len(errs) == 0 {
+		return true
+	}
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Field + " " + e.Message
+	}
+	body := map[string]interface{}{
+		"error":  "Invalid request body: " + strings.Join(msgs, "; "),
+		"fields": errs,
+	}
+	if id := w.Header().Get(correlationIDHeader); id != "" {
+		body["correlationId"] = id
+	}
+	a.writeJSON(w, body, http.StatusBadRequest)
+	return false
+}
+
+// validateRequest checks v, a struct or pointer to one, against its validate
+// tags.
+func validateRequest(v interface{}) []fieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []fieldError
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		if msg := checkRules(rv.Field(i), strings.Split(tag, ",")); msg != "" {
+			errs = append(errs, fieldError{Field: name, Message: msg})
+		}
+	}
+	return errs
+}
+
+// checkRules returns why v breaks rules, or "" if it doesn't.
+func checkRules(v reflect.Value, rules []string) string {
+	for i, rule := range rules {
+		key, arg, _ := strings.Cut(rule, "=")
+		if key == "each" {
+			if v.Kind() != reflect.Slice {
+				return ""
+			}
+			for j := 0; j < v.Len(); j++ {
+				if msg := checkRules(v.Index(j), rules[i+1:]); msg != "" {
+					return fmt.Sprintf("[%d] %s", j, msg)
+				}
+			}
+			return ""
+		}
+		if key == "required" {
+			if isBlank(v) {
+				return "is required"
+			}
+			continue
+		}
+		if v.IsZero() {
+			continue
+		}
+		if msg := checkRule(v, key, arg); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func checkRule(v reflect.Value, key, arg string) string {
+	switch key {
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(arg, 64)
+		n, unit := measure(v)
+		if key == "min" && n < limit {
+			return "must be at least " + arg + unit
+		}
+		if key == "max" && n > limit {
+			return "must be at most " + arg + unit
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, o := range options {
+			if fmt.Sprint(v.Interface()) == o {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	case "pattern":
+		p := validationPatterns[arg]
+		if v.Kind() == reflect.String && !p.re.MatchString(v.String()) {
+			return p.message
+		}
+	}
+	return ""
+}
+
+// measure returns the number min and max compare against: a number's value,
+// or a string's or list's length with its unit. Pointers are measured by
+// what they point to.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		return measure(v.Elem())
+	case reflect.String:
+		return float64(v.Len()), " bytes"
+	case reflect.Slice, reflect.Map:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	return 0, ""
+}
+
+func isBlank(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequest(t *testing.T) {
+	cases := []struct {
+		name string
+		req  interface{}
+		want []fieldError
+	}{
+		{"valid", CreateWorkshopRequest{Name: "intro", Count: 3}, nil},
+		{"missing fields", CreateWorkshopRequest{Name: " "}, []fieldError{
+			{"name", "is required"},
+			{"count", "is required"},
+		}},
+		{"bounds and patterns", CreateWorkshopRequest{Name: "Intro", Template: "VM AWS", Count: 101}, []fieldError{
+			{"name", "must be 1-40 lowercase letters, digits, or hyphens"},
+			{"template", "must be a Coda template name such as vm-aws-sample-app"},
+			{"count", "must be at most 100"},
+		}},
+		{"oneof", &PublishScriptRequest{Name: "setup", Kind: "cleanup", Content: "echo"}, []fieldError{
+			{"kind", "must be one of setup, teardown"},
+		}},
+		{"each", RosterRequest{Participants: []string{"alice", strings.Repeat("x", 201)}}, []fieldError{
+			{"participants", "[1] must be at most 200 bytes"},
+		}},
+		{"optional rules skip zero values", TerminalInput{Type: "input"}, nil},
+		{"negative size", TerminalInput{Type: "resize", Rows: -1, Cols: 80}, []fieldError{
+			{"rows", "must be at least 1"},
+		}},
+	}
+	for _, c := range cases {
+		if got := validateRequest(c.req); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	app := newTestApp(t)
+
+	w := httptest.NewRecorder()
+	var req StartBroadcastRequest
+	if app.decodeRequest(w, httptest.NewRequest(http.MethodPost, "/broadcasts", strings.NewReader(`{"cohort":"Workshop 1"}`)), &req) {
+		t.Fatal("invalid body accepted")
+	}
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []fieldError `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest || len(body.Fields) != 2 || !strings.HasPrefix(body.Error, "Invalid request body: cohort must be") {
+		t.Errorf("status = %d, body = %+v", w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	if !app.decodeRequest(w, httptest.NewRequest(http.MethodPost, "/broadcasts", strings.NewReader(`{"cohort":"w1","vmId":"vm-1"}`)), &req) {
+		t.Errorf("valid body refused: %s", w.Body.String())
+	}
+}
+
+func TestOpenAPI_ValidationRules(t *testing.T) {
+	doc := openAPIDocument(newTestApp(t).apiRoutes(), "")
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	workshop := schemas["CreateWorkshopRequest"].(map[string]interface{})
+	count := workshop["properties"].(map[string]interface{})["count"].(map[string]interface{})
+	if count["minimum"] != 1 || count["maximum"] != 100 {
+		t.Errorf("count schema = %v", count)
+	}
+	if required := workshop["required"]; !reflect.DeepEqual(required, []string{"name", "count"}) {
+		t.Errorf("required = %v", required)
+	}
+}
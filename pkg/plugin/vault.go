@@ -0,0 +1,397 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Enrollment secrets from HashiCorp Vault.
+//
+// With the vault settings block's address and path set, the Coda enrollment
+// key and refresh token are read from that KV version 2 secret, under
+// {address}/v1/{mount}/data/{path}, instead of Grafana's secureJsonData, so
+// the database holds no long-lived Coda credentials. The plugin
+// authenticates with AppRole when roleId is set, using the vaultSecretId
+// secure field, or with the vaultToken secure field. A value found in Vault
+// wins over secureJsonData.
+//
+// The token is renewed two thirds into its TTL, or the plugin logs in
+// again when it can't be; a renewable lease on the secret is renewed the
+// same way, and otherwise the secret is read again every 15 minutes so a
+// rotated refresh token is picked up without a restart.
+
+const (
+	defaultVaultMount           = "secret"
+	defaultVaultEnrollmentField = "enrollmentKey"
+	defaultVaultRefreshField    = "refreshToken"
+	vaultRequestTimeout         = 10 * time.Second
+	vaultRereadInterval         = 15 * time.Minute
+	vaultRetryInterval          = 30 * time.Second
+	maxVaultResponseBytes       = 1 << 20
+)
+
+// VaultSettings are the vault settings block.
+type VaultSettings struct {
+	Address            string `json:"address"`
+	Namespace          string `json:"namespace"`
+	Mount              string `json:"mount"`
+	Path               string `json:"path"`
+	RoleID             string `json:"roleId"`
+	EnrollmentKeyField string `json:"enrollmentKeyField"`
+	RefreshTokenField  string `json:"refreshTokenField"`
+	Token              string `json:"-"`
+	SecretID           string `json:"-"`
+}
+
+// vaultSecrets reads the enrollment secrets and keeps its token and the
+// secret's lease alive.
+type vaultSecrets struct {
+	cfg    VaultSettings
+	client *http.Client
+
+	// refreshMu serializes refresh, which alone uses the token and lease
+	// fields, so Vault round-trips never hold mu.
+	refreshMu      sync.Mutex
+	token          string
+	tokenRenewable bool
+	tokenRenewAt   time.Time
+	leaseID        string
+	leaseRenewAt   time.Time
+	lastRead       time.Time
+
+	// mu guards the values request paths read.
+	mu            sync.Mutex
+	enrollmentKey string
+	refreshToken  string
+	lastError     string
+}
+
+// vaultResponse is the part of Vault's response envelope the plugin uses.
+type vaultResponse struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int             `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// newVaultSecrets returns nil unless cfg has an address and a path.
+func newVaultSecrets(cfg VaultSettings) *vaultSecrets {
+	if cfg.Address == "" || cfg.Path == "" {
+		return nil
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	cfg.Mount = strings.Trim(cfg.Mount, "/")
+	if cfg.Mount == "" {
+		cfg.Mount = defaultVaultMount
+	}
+	cfg.Path = strings.Trim(cfg.Path, "/")
+	if cfg.EnrollmentKeyField == "" {
+		cfg.EnrollmentKeyField = defaultVaultEnrollmentField
+	}
+	if cfg.RefreshTokenField == "" {
+		cfg.RefreshTokenField = defaultVaultRefreshField
+	}
+	return &vaultSecrets{cfg: cfg, client: &http.Client{Timeout: vaultRequestTimeout}}
+}
+
+// renewAt is two thirds into a TTL of seconds from now, or zero when
+// nothing expires.
+func renewAt(seconds int) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return timeNow().Add(time.Duration(seconds) * time.Second * 2 / 3)
+}
+
+func (v *vaultSecrets) do(ctx context.Context, method, path string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.cfg.Address+"/v1/"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var out vaultResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxVaultResponseBytes)).Decode(&out); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, strings.Join(out.Errors, "; "))
+	}
+	return &out, nil
+}
+
+// login gets a token with AppRole, or takes the configured token and
+// looks up its TTL.
+func (v *vaultSecrets) login(ctx context.Context) error {
+	if v.cfg.RoleID == "" {
+		if v.cfg.Token == "" {
+			return errors.New("neither roleId nor the vaultToken secure field is set")
+		}
+		v.token = v.cfg.Token
+		resp, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+		if err != nil {
+			v.token = ""
+			return fmt.Errorf("token lookup: %w", err)
+		}
+		var data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		}
+		_ = json.Unmarshal(resp.Data, &data)
+		v.tokenRenewable = data.Renewable
+		v.tokenRenewAt = renewAt(data.TTL)
+		return nil
+	}
+	v.token = ""
+	resp, err := v.do(ctx, http.MethodPost, "auth/approle/login", map[string]string{"role_id": v.cfg.RoleID, "secret_id": v.cfg.SecretID})
+	if err != nil {
+		return fmt.Errorf("AppRole login: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("AppRole login returned no token")
+	}
+	v.token = resp.Auth.ClientToken
+	v.tokenRenewable = resp.Auth.Renewable
+	v.tokenRenewAt = renewAt(resp.Auth.LeaseDuration)
+	return nil
+}
+
+// ensureToken logs in, or renews the token when it is due, logging in
+// again when renewal fails and AppRole is configured.
+func (v *vaultSecrets) ensureToken(ctx context.Context) error {
+	if v.token == "" {
+		return v.login(ctx)
+	}
+	if v.tokenRenewAt.IsZero() || timeNow().Before(v.tokenRenewAt) {
+		return nil
+	}
+	if v.tokenRenewable {
+		resp, err := v.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{})
+		if err == nil && resp.Auth != nil {
+			v.tokenRenewable = resp.Auth.Renewable
+			v.tokenRenewAt = renewAt(resp.Auth.LeaseDuration)
+			return nil
+		}
+		if v.cfg.RoleID == "" {
+			return fmt.Errorf("token renewal: %v", err)
+		}
+	} else if v.cfg.RoleID == "" {
+		return errors.New("the Vault token can't be renewed and expires soon")
+	}
+	return v.login(ctx)
+}
+
+// read fetches the secret, logging in again once if the token was
+// rejected.
+func (v *vaultSecrets) read(ctx context.Context) error {
+	path := v.cfg.Mount + "/data/" + v.cfg.Path
+	resp, err := v.do(ctx, http.MethodGet, path, nil)
+	if err != nil && v.cfg.RoleID != "" && strings.Contains(err.Error(), "status 403") {
+		if err = v.login(ctx); err == nil {
+			resp, err = v.do(ctx, http.MethodGet, path, nil)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	var kv struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Data, &kv); err != nil || kv.Data == nil {
+		return fmt.Errorf("%s is not a KV version 2 secret", path)
+	}
+	field := func(name string) string {
+		s, _ := kv.Data[name].(string)
+		return s
+	}
+	enrollmentKey, refreshToken := field(v.cfg.EnrollmentKeyField), field(v.cfg.RefreshTokenField)
+	if enrollmentKey == "" && refreshToken == "" {
+		return fmt.Errorf("%s has neither %s nor %s", path, v.cfg.EnrollmentKeyField, v.cfg.RefreshTokenField)
+	}
+	v.mu.Lock()
+	v.enrollmentKey, v.refreshToken = enrollmentKey, refreshToken
+	v.mu.Unlock()
+	v.leaseID = ""
+	if resp.Renewable && resp.LeaseID != "" {
+		v.leaseID = resp.LeaseID
+	}
+	v.leaseRenewAt = renewAt(resp.LeaseDuration)
+	v.lastRead = timeNow()
+	return nil
+}
+
+// refresh brings the token and secret up to date and returns when to run
+// again.
+func (v *vaultSecrets) refresh(ctx context.Context) (time.Duration, error) {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+	err := v.ensureToken(ctx)
+	if err == nil {
+		err = v.refreshSecret(ctx)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err != nil {
+		v.lastError = err.Error()
+		return vaultRetryInterval, err
+	}
+	v.lastError = ""
+	return max(v.nextRefresh().Sub(timeNow()), time.Second), nil
+}
+
+// refreshSecret renews the secret's lease when it is renewable and due,
+// and otherwise reads the secret again when vaultRereadInterval has passed.
+func (v *vaultSecrets) refreshSecret(ctx context.Context) error {
+	if v.lastRead.IsZero() {
+		return v.read(ctx)
+	}
+	if v.leaseID == "" {
+		if timeNow().Before(v.lastRead.Add(vaultRereadInterval)) {
+			return nil
+		}
+		return v.read(ctx)
+	}
+	if timeNow().Before(v.leaseRenewAt) {
+		return nil
+	}
+	resp, err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]string{"lease_id": v.leaseID})
+	if err == nil && resp.Renewable {
+		v.leaseRenewAt = renewAt(resp.LeaseDuration)
+		return nil
+	}
+	return v.read(ctx)
+}
+
+// nextRefresh is when the token or secret is next due.
+func (v *vaultSecrets) nextRefresh() time.Time {
+	next := v.leaseRenewAt
+	if v.leaseID == "" {
+		next = v.lastRead.Add(vaultRereadInterval)
+	}
+	if !v.tokenRenewAt.IsZero() && v.tokenRenewAt.Before(next) {
+		next = v.tokenRenewAt
+	}
+	return next
+}
+
+// secrets returns the values last read.
+func (v *vaultSecrets) secrets() (enrollmentKey, refreshToken string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.enrollmentKey, v.refreshToken
+}
+
+// err is the last refresh's failure, or nil.
+func (v *vaultSecrets) err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.lastError == "" {
+		return nil
+	}
+	return errors.New("Vault: " + v.lastError)
+}
+
+// initVaultSecrets reads the enrollment secrets from Vault, when it is
+// configured, into settings before the Coda client is created.
+func (a *App) initVaultSecrets(settings *Settings) {
+	a.vault = newVaultSecrets(settings.Vault)
+	if a.vault == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+	defer cancel()
+	if _, err := a.vault.refresh(ctx); err != nil {
+		a.logger.Error("Failed to read enrollment secrets from Vault", "address", a.vault.cfg.Address, "path", a.vault.cfg.Path, "error", err)
+		return
+	}
+	enrollmentKey, refreshToken := a.vault.secrets()
+	if enrollmentKey != "" {
+		settings.EnrollmentKey = enrollmentKey
+	}
+	if refreshToken != "" {
+		settings.RefreshToken = refreshToken
+	}
+	a.logger.Info("Read enrollment secrets from Vault", "address", a.vault.cfg.Address, "path", a.vault.cfg.Path)
+}
+
+// startVaultRenewal keeps the Vault token and secret fresh, handing a
+// rotated refresh token to the Coda client.
+func (a *App) startVaultRenewal() {
+	if a.vault != nil {
+		a.runScheduled(vaultRetryInterval, a.refreshVaultSecrets)
+	}
+}
+
+// refreshVaultSecrets runs one renewal and returns when to run the next.
+func (a *App) refreshVaultSecrets(ctx context.Context) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, vaultRequestTimeout)
+	defer cancel()
+	next, err := a.vault.refresh(ctx)
+	if err != nil {
+		a.logger.Warn("Failed to refresh enrollment secrets from Vault", "path", a.vault.cfg.Path, "error", err)
+		return next
+	}
+	if _, refreshToken := a.vault.secrets(); refreshToken != "" && a.coda != nil {
+		if a.coda.setRefreshToken(refreshToken) {
+			a.logger.Info("Coda refresh token rotated in Vault", "path", a.vault.cfg.Path)
+		}
+	}
+	return next
+}
+
+// enrollmentKey is the configured enrollment key, from Vault when it has
+// one.
+func (a *App) enrollmentKey() string {
+	if a.vault != nil {
+		if key, _ := a.vault.secrets(); key != "" {
+			return key
+		}
+	}
+	return a.settings.EnrollmentKey
+}
+
+// reportVaultHealth fails result when the last Vault read failed.
+func (a *App) reportVaultHealth(result *backend.CheckHealthResult) {
+	if a.vault == nil {
+		return
+	}
+	if err := a.vault.err(); err != nil {
+		result.Status = backend.HealthStatusError
+		result.Message = err.Error()
+		return
+	}
+	result.Message += "; enrollment secrets from Vault"
+}
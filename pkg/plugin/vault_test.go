@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// fakeVault serves AppRole login, token renewal and a KV version 2 secret.
+type fakeVault struct {
+	mu       sync.Mutex
+	tokens   map[string]bool
+	issued   int
+	secret   map[string]string
+	requests []string
+	failRead bool
+	tokenTTL int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	fv := &fakeVault{tokens: map[string]bool{}, tokenTTL: 3600, secret: map[string]string{
+		"enrollmentKey": "ek-1",
+		"refreshToken":  "rt-1",
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fv.mu.Lock()
+		defer fv.mu.Unlock()
+		fv.requests = append(fv.requests, r.Method+" "+r.URL.Path)
+		if r.Header.Get("X-Vault-Namespace") != "team-a" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := r.Header.Get("X-Vault-Token")
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "pathfinder" || body["secret_id"] != "s3cret" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors": ["invalid role or secret ID"]}`))
+				return
+			}
+			fv.issued++
+			token := "tok-" + string(rune('0'+fv.issued))
+			fv.tokens[token] = true
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": fv.tokenTTL, "renewable": true}})
+		case !fv.tokens[token]:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+		case r.URL.Path == "/v1/auth/token/renew-self":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": fv.tokenTTL, "renewable": true}})
+		case r.URL.Path == "/v1/kv/data/pathfinder/coda" && !fv.failRead:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": fv.secret}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return fv, srv
+}
+
+func (fv *fakeVault) take() []string {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+	out := fv.requests
+	fv.requests = nil
+	return out
+}
+
+func TestVaultSecrets(t *testing.T) {
+	advance := withFrozenTime(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	fv, srv := newFakeVault(t)
+	app := newTestApp(t)
+	settings := &Settings{
+		CodaAPIURL:    "https://coda.example.com",
+		EnrollmentKey: "from-grafana",
+		Vault:         VaultSettings{Address: srv.URL + "/", Namespace: "team-a", Mount: "kv", Path: "/pathfinder/coda", RoleID: "pathfinder", SecretID: "s3cret"},
+	}
+	app.settings = settings
+	app.initVaultSecrets(settings)
+	if settings.EnrollmentKey != "ek-1" || settings.RefreshToken != "rt-1" || app.enrollmentKey() != "ek-1" {
+		t.Fatalf("settings = %q %q", settings.EnrollmentKey, settings.RefreshToken)
+	}
+	if got := strings.Join(fv.take(), ", "); got != "POST /v1/auth/approle/login, GET /v1/kv/data/pathfinder/coda" {
+		t.Errorf("requests = %s", got)
+	}
+	app.coda = NewCodaClient(settings.CodaAPIURL, settings.RefreshToken)
+
+	// Nothing is due until two thirds into the token's hour.
+	if next := app.refreshVaultSecrets(t.Context()); next != 15*time.Minute {
+		t.Errorf("next refresh in %v", next)
+	}
+	if got := fv.take(); len(got) != 0 {
+		t.Errorf("requests before anything was due: %v", got)
+	}
+
+	// After 15 minutes the secret is read again and a rotated refresh
+	// token reaches the Coda client.
+	fv.mu.Lock()
+	fv.secret["refreshToken"] = "rt-2"
+	fv.mu.Unlock()
+	advance(15 * time.Minute)
+	app.refreshVaultSecrets(t.Context())
+	if app.coda.refreshToken != "rt-2" {
+		t.Errorf("Coda refresh token = %q", app.coda.refreshToken)
+	}
+
+	// At 40 minutes the token is renewed.
+	advance(25 * time.Minute)
+	fv.take()
+	app.refreshVaultSecrets(t.Context())
+	if got := strings.Join(fv.take(), ", "); got != "POST /v1/auth/token/renew-self, GET /v1/kv/data/pathfinder/coda" {
+		t.Errorf("requests = %s", got)
+	}
+
+	// A token revoked in Vault is replaced with a new login.
+	fv.mu.Lock()
+	fv.tokens = map[string]bool{}
+	fv.mu.Unlock()
+	advance(15 * time.Minute)
+	app.refreshVaultSecrets(t.Context())
+	if got := strings.Join(fv.take(), ", "); got != "GET /v1/kv/data/pathfinder/coda, POST /v1/auth/approle/login, GET /v1/kv/data/pathfinder/coda" {
+		t.Errorf("requests = %s", got)
+	}
+
+	result := &backend.CheckHealthResult{Status: backend.HealthStatusOk, Message: "Plugin is running"}
+	app.reportVaultHealth(result)
+	if result.Status != backend.HealthStatusOk || !strings.Contains(result.Message, "from Vault") {
+		t.Errorf("health = %v %q", result.Status, result.Message)
+	}
+	fv.mu.Lock()
+	fv.failRead = true
+	fv.mu.Unlock()
+	advance(15 * time.Minute)
+	if next := app.refreshVaultSecrets(t.Context()); next != vaultRetryInterval {
+		t.Errorf("retry in %v", next)
+	}
+	app.reportVaultHealth(result)
+	if result.Status != backend.HealthStatusError || !strings.Contains(result.Message, "status 404") {
+		t.Errorf("health = %v %q", result.Status, result.Message)
+	}
+	if app.enrollmentKey() != "ek-1" || app.coda.refreshToken != "rt-2" {
+		t.Error("a failed read dropped the secrets")
+	}
+}
+
+func TestVaultSecretsMisconfigured(t *testing.T) {
+	_, srv := newFakeVault(t)
+	if newVaultSecrets(VaultSettings{Address: srv.URL}) != nil {
+		t.Error("Vault used without a path")
+	}
+	app := newTestApp(t)
+	settings := &Settings{RefreshToken: "from-grafana", Vault: VaultSettings{Address: srv.URL, Namespace: "team-a", Mount: "kv", Path: "pathfinder/coda", RoleID: "pathfinder", SecretID: "wrong"}}
+	app.settings = settings
+	app.initVaultSecrets(settings)
+	if settings.RefreshToken != "from-grafana" {
+		t.Errorf("refresh token = %q", settings.RefreshToken)
+	}
+	result := &backend.CheckHealthResult{}
+	app.reportVaultHealth(result)
+	if result.Status != backend.HealthStatusError || !strings.Contains(result.Message, "invalid role or secret ID") {
+		t.Errorf("health = %v %q", result.Status, result.Message)
+	}
+	coda := NewCodaClient("https://coda.example.com", "")
+	coda.missingTokenErr = app.vault.err
+	if _, err := coda.GetAccessToken(t.Context()); err == nil || !strings.Contains(err.Error(), "Vault: AppRole login") {
+		t.Errorf("access token without a refresh token: %v", err)
+	}
+
+	parsed, err := ParseSettings(backend.AppInstanceSettings{
+		JSONData:                []byte(`{"vault": {"address": "https://vault.internal", "path": "pathfinder/coda", "roleId": "pathfinder"}}`),
+		DecryptedSecureJSONData: map[string]string{"vaultSecretId": "s3cret", "vaultToken": "hvs.x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Vault.SecretID != "s3cret" || parsed.Vault.Token != "hvs.x" || parsed.Vault.RoleID != "pathfinder" {
+		t.Errorf("vault settings = %+v", parsed.Vault)
+	}
+}
+
+func TestVaultSecretsReadableDuringRefresh(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	v := newVaultSecrets(VaultSettings{Address: srv.URL, Path: "pathfinder/coda", Token: "hvs.x"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = v.refresh(t.Context())
+	}()
+	<-entered
+	got := make(chan struct{})
+	go func() {
+		v.secrets()
+		close(got)
+	}()
+	select {
+	case <-got:
+	case <-time.After(5 * time.Second):
+		t.Error("secrets() blocked behind a Vault request")
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,196 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// VM health probes.
+//
+// While a terminal session is connected, the VM is probed every
+// vmHealthInterval and the result is sent on the terminal stream as a
+// "health" message, so the UI can tell "your VM is overloaded" apart from
+// "the network is broken":
+//
+//   - ok:          SSH answers promptly and CPU, memory and disk are below
+//     their thresholds.
+//   - degraded:    SSH answers but the VM is saturated, slow to respond, or
+//     too busy to report stats.
+//   - unreachable: SSH does not answer a keepalive at all.
+
+const (
+	vmHealthInterval     = 30 * time.Second
+	vmHealthProbeTimeout = 5 * time.Second
+	vmHealthStatsTimeout = 10 * time.Second
+
+	// Thresholds above which a VM is reported degraded.
+	vmHealthCPUPercent    = 90
+	vmHealthMemoryPercent = 90
+	vmHealthDiskPercent   = 90
+	vmHealthSlowSSH       = 2 * time.Second
+)
+
+// VMHealth is the payload of a "health" stream message. Percentages are nil
+// when the probe could not measure them.
+type VMHealth struct {
+	Status            string   `json:"status"` // "ok", "degraded", "unreachable"
+	CPUPercent        *float64 `json:"cpuPercent,omitempty"`
+	MemoryUsedPercent *float64 `json:"memoryUsedPercent,omitempty"`
+	DiskUsedPercent   *float64 `json:"diskUsedPercent,omitempty"`
+	Load1             *float64 `json:"load1,omitempty"`
+	SSHLatencyMs      int64    `json:"sshLatencyMs"`
+	Reasons           []string `json:"reasons,omitempty"`
+}
+
+// summary is a one-line, human-readable description for the UI.
+func (h VMHealth) summary() string {
+	switch h.Status {
+	case "unreachable":
+		return "VM is not responding — the connection may be broken"
+	case "degraded":
+		return "VM is under pressure: " + strings.Join(h.Reasons, ", ")
+	default:
+		return "VM is healthy"
+	}
+}
+
+// cpuBusyPercent returns the aggregate CPU utilization between two samples,
+// or false when it cannot be computed.
+func cpuBusyPercent(prev, cur *vmStats) (float64, bool) {
+	if prev == nil || cur == nil {
+		return 0, false
+	}
+	p, c := prev.CPUSeconds["cpu"], cur.CPUSeconds["cpu"]
+	if p == nil || c == nil {
+		return 0, false
+	}
+	var total, idle float64
+	for _, mode := range cpuModes {
+		d := c[mode] - p[mode]
+		total += d
+		if mode == "idle" || mode == "iowait" {
+			idle += d
+		}
+	}
+	if total <= 0 {
+		return 0, false
+	}
+	return 100 * (total - idle) / total, true
+}
+
+// evaluateVMHealth classifies a probe. sshErr is the keepalive result;
+// statsErr the stats collection result, which is only attempted when SSH
+// answered. prev may be nil on the first probe.
+func evaluateVMHealth(prev, cur *vmStats, sshLatency time.Duration, sshErr, statsErr error) VMHealth {
+	h := VMHealth{Status: "ok", SSHLatencyMs: sshLatency.Milliseconds()}
+	if sshErr != nil {
+		h.Status = "unreachable"
+		h.Reasons = []string{"SSH keepalive failed"}
+		return h
+	}
+
+	if sshLatency > vmHealthSlowSSH {
+		h.Reasons = append(h.Reasons, fmt.Sprintf("SSH slow to respond (%dms)", h.SSHLatencyMs))
+	}
+	if statsErr != nil || cur == nil {
+		h.Reasons = append(h.Reasons, "too busy to report resource usage")
+	} else {
+		if cpu, ok := cpuBusyPercent(prev, cur); ok {
+			h.CPUPercent = &cpu
+			if cpu >= vmHealthCPUPercent {
+				h.Reasons = append(h.Reasons, fmt.Sprintf("CPU %.0f%%", cpu))
+			}
+		}
+		load := cur.Load1
+		h.Load1 = &load
+		if cur.MemTotalBytes > 0 {
+			mem := 100 * (cur.MemTotalBytes - cur.MemAvailableBytes) / cur.MemTotalBytes
+			h.MemoryUsedPercent = &mem
+			if mem >= vmHealthMemoryPercent {
+				h.Reasons = append(h.Reasons, fmt.Sprintf("memory %.0f%%", mem))
+			}
+		}
+		if cur.RootFSSizeBytes > 0 {
+			disk := 100 * (cur.RootFSSizeBytes - cur.RootFSAvailBytes) / cur.RootFSSizeBytes
+			h.DiskUsedPercent = &disk
+			if disk >= vmHealthDiskPercent {
+				h.Reasons = append(h.Reasons, fmt.Sprintf("disk %.0f%%", disk))
+			}
+		}
+	}
+
+	if len(h.Reasons) > 0 {
+		h.Status = "degraded"
+	}
+	return h
+}
+
+// probeSSH sends an OpenSSH keepalive and returns its round-trip time.
+func probeSSH(client *ssh.Client, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return time.Since(start), err
+	case <-time.After(timeout):
+		return time.Since(start), errors.New("keepalive timed out")
+	}
+}
+
+// monitorVMHealth probes the session's VM every vmHealthInterval and sends a
+// "health" message until ctx is done.
+func (a *App) monitorVMHealth(ctx context.Context, sess *streamSession, ctxLogger log.Logger) {
+	client := sess.session.SSHClient
+	var prev *vmStats
+	lastStatus := ""
+
+	ticker := time.NewTicker(vmHealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			latency, sshErr := probeSSH(client, vmHealthProbeTimeout)
+			var cur *vmStats
+			var statsErr error
+			if sshErr == nil {
+				statsCtx, cancel := context.WithTimeout(ctx, vmHealthStatsTimeout)
+				cur, statsErr = collectVMStats(statsCtx, client)
+				cancel()
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			health := evaluateVMHealth(prev, cur, latency, sshErr, statsErr)
+			if cur != nil {
+				prev = cur
+			}
+			if health.Status != lastStatus {
+				ctxLogger.Info("VM health changed", "vmID", sess.vmID, "status", health.Status, "reasons", health.Reasons)
+				lastStatus = health.Status
+			}
+			if !clientUnderstands(int(sess.clientSchema.Load()), "health") {
+				continue
+			}
+			sendStreamMessage(sess.sender, TerminalStreamOutput{
+				Type:    "health",
+				State:   health.Status,
+				Message: health.summary(),
+				VmId:    sess.vmID,
+				Health:  &health,
+			})
+		}
+	}
+}
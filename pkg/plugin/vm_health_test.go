@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cpuSample(busy, idle float64) *vmStats {
+	return &vmStats{
+		CPUSeconds:        map[string]map[string]float64{"cpu": {"user": busy, "idle": idle}},
+		MemTotalBytes:     1000,
+		MemAvailableBytes: 500,
+		RootFSSizeBytes:   1000,
+		RootFSAvailBytes:  800,
+	}
+}
+
+func TestCPUBusyPercent(t *testing.T) {
+	if _, ok := cpuBusyPercent(nil, cpuSample(1, 1)); ok {
+		t.Error("first sample should not yield a CPU percentage")
+	}
+	got, ok := cpuBusyPercent(cpuSample(100, 100), cpuSample(175, 125))
+	if !ok || got != 75 {
+		t.Errorf("cpuBusyPercent = %v, %v; want 75", got, ok)
+	}
+}
+
+func TestEvaluateVMHealth(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		h := evaluateVMHealth(cpuSample(0, 0), cpuSample(10, 90), 20*time.Millisecond, nil, nil)
+		if h.Status != "ok" || h.CPUPercent == nil || *h.CPUPercent != 10 || *h.MemoryUsedPercent != 50 || *h.DiskUsedPercent != 20 {
+			t.Errorf("health = %+v", h)
+		}
+	})
+
+	t.Run("overloaded", func(t *testing.T) {
+		cur := cpuSample(99, 1)
+		cur.MemAvailableBytes = 50
+		h := evaluateVMHealth(cpuSample(0, 0), cur, 20*time.Millisecond, nil, nil)
+		if h.Status != "degraded" || len(h.Reasons) != 2 {
+			t.Fatalf("health = %+v, want degraded on CPU and memory", h)
+		}
+		if !strings.Contains(h.summary(), "CPU 99%") {
+			t.Errorf("summary = %q", h.summary())
+		}
+	})
+
+	t.Run("too busy to report", func(t *testing.T) {
+		h := evaluateVMHealth(nil, nil, 3*time.Second, nil, errors.New("command timed out"))
+		if h.Status != "degraded" || len(h.Reasons) != 2 || h.SSHLatencyMs != 3000 {
+			t.Errorf("health = %+v", h)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		h := evaluateVMHealth(nil, nil, 5*time.Second, errors.New("keepalive timed out"), nil)
+		if h.Status != "unreachable" || !strings.Contains(h.summary(), "not responding") {
+			t.Errorf("health = %+v", h)
+		}
+	})
+}
+
+func TestProbeSSH(t *testing.T) {
+	srv := newTestSSHServer(t)
+	defer srv.close()
+	client := srv.dialClient(t)
+
+	if _, err := probeSSH(client, time.Second); err != nil {
+		t.Errorf("probe on live client: %v", err)
+	}
+	_ = client.Close()
+	if _, err := probeSSH(client, time.Second); err == nil {
+		t.Error("probe on closed client should fail")
+	}
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HTTP proxy to services on a sandbox VM.
+//
+// GET /vms/{id}/proxy/{service}/{path} forwards to the service's port on
+// the VM's loopback interface through the owner's terminal SSH connection,
+// so nothing on the VM has to be exposed. The VM owner can call it directly;
+// Grafana data sources created for the sandbox (see sandbox_datasources.go)
+// call it as the plugin's service account and identify the VM with a proxy
+// token header instead. The proxy is read-only: only GET and HEAD are
+// forwarded.
+
+const (
+	vmProxyTokenHeader     = "X-Pathfinder-Proxy-Token"
+	vmProxyTokenCollection = "vm-proxy-tokens"
+	vmProxyTimeout         = 60 * time.Second
+)
+
+// vmService is a well-known service a sandbox VM can run.
+type vmService struct {
+	Name       string
+	Port       int
+	ReadyPath  string
+	Datasource string // Grafana data source plugin type
+}
+
+var vmServices = map[string]vmService{
+	"prometheus": {Name: "prometheus", Port: 9090, ReadyPath: "/-/ready", Datasource: "prometheus"},
+	"loki":       {Name: "loki", Port: 3100, ReadyPath: "/ready", Datasource: "loki"},
+	"tempo":      {Name: "tempo", Port: 3200, ReadyPath: "/ready", Datasource: "tempo"},
+}
+
+// vmProxyToken is what a proxy token grants: one service on one user's VM.
+type vmProxyToken struct {
+	User          string `json:"user"`
+	VMID          string `json:"vmId"`
+	Service       string `json:"service"`
+	DatasourceUID string `json:"datasourceUid,omitempty"`
+}
+
+func hashProxyToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueVMProxyToken stores a new token for grant and returns it. Only the
+// hash is kept.
+func (a *App) issueVMProxyToken(grant vmProxyToken) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	if err := a.store.put(vmProxyTokenCollection, hashProxyToken(token), grant); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeVMProxyTokens deletes the tokens issued for a data source.
+func (a *App) revokeVMProxyTokens(datasourceUID string) {
+	var revoked []string
+	for _, key := range a.store.keys(vmProxyTokenCollection) {
+		var grant vmProxyToken
+		if ok, err := a.store.get(vmProxyTokenCollection, key, &grant); err == nil && ok && grant.DatasourceUID == datasourceUID {
+			revoked = append(revoked, key)
+		}
+	}
+	if len(revoked) > 0 {
+		if _, err := a.store.deleteKeys(vmProxyTokenCollection, revoked); err != nil {
+			a.logger.Error("Failed to revoke VM proxy tokens", "datasourceUid", datasourceUID, "error", err)
+		}
+	}
+}
+
+// handleVMProxy handles GET /vms/{id}/proxy/{service}/{path}; rest is the
+// part after "proxy/".
+func (a *App) handleVMProxy(w http.ResponseWriter, r *http.Request, vmID, rest string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, path, _ := strings.Cut(rest, "/")
+	service, ok := vmServices[name]
+	if !ok {
+		a.writeError(w, "Unknown VM service: "+name, http.StatusNotFound)
+		return
+	}
+
+	owner := userLoginFromContext(r.Context())
+	if owner == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if token := r.Header.Get(vmProxyTokenHeader); token != "" {
+		var grant vmProxyToken
+		ok, err := a.store.get(vmProxyTokenCollection, hashProxyToken(token), &grant)
+		if err != nil || !ok || grant.VMID != vmID || grant.Service != service.Name {
+			a.writeError(w, "Invalid proxy token", http.StatusForbidden)
+			return
+		}
+		owner = grant.User
+	}
+
+	client := a.findSSHClientForUserVM(owner, vmID)
+	if client == nil {
+		a.writeError(w, "The sandbox has no connected terminal session; open the terminal to query it", http.StatusServiceUnavailable)
+		return
+	}
+
+	logger := a.ctxLogger(r.Context())
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = "127.0.0.1:" + strconv.Itoa(service.Port)
+			pr.Out.URL.Path = "/" + path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = pr.Out.URL.Host
+			for _, h := range []string{"Authorization", "Cookie", vmProxyTokenHeader} {
+				pr.Out.Header.Del(h)
+			}
+		},
+		Transport: sshTunnelTransport(client),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Debug("VM proxy request failed", "vmID", vmID, "service", service.Name, "error", err)
+			a.writeError(w, "Could not reach "+service.Name+" on the sandbox", http.StatusBadGateway)
+		},
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), vmProxyTimeout)
+	defer cancel()
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// sshTunnelTransport opens connections from the VM's side of client, so
+// loopback URLs reach services on the VM.
+func sshTunnelTransport(client *ssh.Client) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client.DialContext(ctx, network, addr)
+		},
+		ResponseHeaderTimeout: vmProxyTimeout,
+		// Each idle connection would hold an SSH channel open.
+		DisableKeepAlives: true,
+	}
+}
+
+// vmServiceReady reports whether service answers its readiness check on
+// the VM.
+func vmServiceReady(ctx context.Context, client *ssh.Client, service vmService) bool {
+	return probeVMPort(ctx, client, service.Port, service.ReadyPath) == nil
+}
@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// VM resource stats read from /proc over the session's SSH client.
+//
+// Sandbox images do not ship node_exporter, so stats are read directly from
+// /proc and df in a single remote command and parsed here. Metric semantics
+// follow node_exporter so exported series work with its dashboards.
+
+// vmStatsSectionSep separates the output of each probe in vmStatsCommand.
+const vmStatsSectionSep = "--pathfinder--"
+
+// vmStatsCommand prints loadavg, memory, CPU, root filesystem and network
+// counters, separated by vmStatsSectionSep.
+var vmStatsCommand = strings.Join([]string{
+	"cat /proc/loadavg",
+	"grep -E '^(MemTotal|MemAvailable):' /proc/meminfo",
+	"grep '^cpu' /proc/stat",
+	"df -Pk /",
+	"tail -n +3 /proc/net/dev",
+}, "; echo "+vmStatsSectionSep+"; ")
+
+// clockTicksPerSecond is USER_HZ, which is 100 on every Linux architecture
+// the sandboxes run on.
+const clockTicksPerSecond = 100
+
+// cpuModes are the /proc/stat columns, in order.
+var cpuModes = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+// vmStats is a point-in-time snapshot of VM resource usage.
+type vmStats struct {
+	Load1, Load5, Load15 float64
+
+	MemTotalBytes     float64
+	MemAvailableBytes float64
+
+	// CPUSeconds is cumulative time per CPU ("cpu0", ...) and mode. The
+	// aggregate "cpu" line is kept under "cpu".
+	CPUSeconds map[string]map[string]float64
+
+	RootFSSizeBytes  float64
+	RootFSAvailBytes float64
+
+	NetReceiveBytes  map[string]float64
+	NetTransmitBytes map[string]float64
+}
+
+// collectVMStats runs vmStatsCommand on client and parses the result.
+func collectVMStats(ctx context.Context, client *ssh.Client) (*vmStats, error) {
+	result, err := runRemoteCommand(ctx, client, vmStatsCommand, "raw")
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("stats command exited with %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return parseVMStats(result.Stdout)
+}
+
+// parseVMStats parses vmStatsCommand output.
+func parseVMStats(out string) (*vmStats, error) {
+	sections := strings.Split(out, vmStatsSectionSep+"\n")
+	if len(sections) != 5 {
+		return nil, fmt.Errorf("unexpected stats output: %d sections", len(sections))
+	}
+	s := &vmStats{
+		CPUSeconds:       map[string]map[string]float64{},
+		NetReceiveBytes:  map[string]float64{},
+		NetTransmitBytes: map[string]float64{},
+	}
+
+	load := strings.Fields(sections[0])
+	if len(load) < 3 {
+		return nil, fmt.Errorf("unexpected loadavg: %q", sections[0])
+	}
+	var err error
+	if s.Load1, err = strconv.ParseFloat(load[0], 64); err != nil {
+		return nil, fmt.Errorf("parse load1: %w", err)
+	}
+	if s.Load5, err = strconv.ParseFloat(load[1], 64); err != nil {
+		return nil, fmt.Errorf("parse load5: %w", err)
+	}
+	if s.Load15, err = strconv.ParseFloat(load[2], 64); err != nil {
+		return nil, fmt.Errorf("parse load15: %w", err)
+	}
+
+	for _, line := range splitLines(sections[1]) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			s.MemTotalBytes = kb * 1024
+		case "MemAvailable:":
+			s.MemAvailableBytes = kb * 1024
+		}
+	}
+
+	for _, line := range splitLines(sections[2]) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		modes := map[string]float64{}
+		for i, mode := range cpuModes {
+			if i+1 >= len(fields) {
+				break
+			}
+			ticks, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil {
+				continue
+			}
+			modes[mode] = ticks / clockTicksPerSecond
+		}
+		s.CPUSeconds[fields[0]] = modes
+	}
+
+	// df -Pk: header, then "fs 1024-blocks used available capacity mount".
+	if lines := splitLines(sections[3]); len(lines) >= 2 {
+		fields := strings.Fields(lines[len(lines)-1])
+		if len(fields) >= 4 {
+			size, _ := strconv.ParseFloat(fields[1], 64)
+			avail, _ := strconv.ParseFloat(fields[3], 64)
+			s.RootFSSizeBytes = size * 1024
+			s.RootFSAvailBytes = avail * 1024
+		}
+	}
+
+	// /proc/net/dev: "iface: rx_bytes rx_packets ... (8 rx cols) tx_bytes ...".
+	for _, line := range splitLines(sections[4]) {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(rest)
+		if name == "lo" || len(fields) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseFloat(fields[0], 64)
+		tx, _ := strconv.ParseFloat(fields[8], 64)
+		s.NetReceiveBytes[name] = rx
+		s.NetTransmitBytes[name] = tx
+	}
+
+	return s, nil
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
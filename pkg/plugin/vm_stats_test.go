@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleVMStatsOutput = `0.52 0.31 0.12 1/123 4567
+--pathfinder--
+MemTotal:        2014548 kB
+MemAvailable:    1500000 kB
+--pathfinder--
+cpu  1000 20 300 50000 40 0 10 5 0 0
+cpu0 600 10 200 25000 20 0 5 3 0 0
+cpu1 400 10 100 25000 20 0 5 2 0 0
+--pathfinder--
+Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/root         20134592 3500000  16618208      18% /
+--pathfinder--
+    lo:  1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  ens5: 123456    100    0    0    0     0          0         0    65432      90    0    0    0     0       0          0
+`
+
+func TestVMStatsCommand(t *testing.T) {
+	if n := strings.Count(vmStatsCommand, "echo "+vmStatsSectionSep); n != 4 {
+		t.Errorf("vmStatsCommand has %d separators, want 4: %s", n, vmStatsCommand)
+	}
+}
+
+func TestParseVMStats(t *testing.T) {
+	s, err := parseVMStats(sampleVMStatsOutput)
+	if err != nil {
+		t.Fatalf("parseVMStats: %v", err)
+	}
+	if s.Load1 != 0.52 || s.Load15 != 0.12 {
+		t.Errorf("load = %v %v %v", s.Load1, s.Load5, s.Load15)
+	}
+	if s.MemTotalBytes != 2014548*1024 || s.MemAvailableBytes != 1500000*1024 {
+		t.Errorf("memory = %v / %v", s.MemAvailableBytes, s.MemTotalBytes)
+	}
+	if got := s.CPUSeconds["cpu1"]["user"]; got != 4 {
+		t.Errorf("cpu1 user seconds = %v, want 4", got)
+	}
+	if got := s.CPUSeconds["cpu"]["steal"]; got != 0.05 {
+		t.Errorf("cpu steal seconds = %v, want 0.05", got)
+	}
+	if s.RootFSSizeBytes != 20134592*1024 || s.RootFSAvailBytes != 16618208*1024 {
+		t.Errorf("rootfs = %v / %v", s.RootFSAvailBytes, s.RootFSSizeBytes)
+	}
+	if _, ok := s.NetReceiveBytes["lo"]; ok {
+		t.Error("loopback should be skipped")
+	}
+	if s.NetReceiveBytes["ens5"] != 123456 || s.NetTransmitBytes["ens5"] != 65432 {
+		t.Errorf("ens5 = rx %v tx %v", s.NetReceiveBytes["ens5"], s.NetTransmitBytes["ens5"])
+	}
+}
+
+func TestParseVMStats_Malformed(t *testing.T) {
+	for _, out := range []string{"", "garbage", strings.Replace(sampleVMStatsOutput, "0.52", "x", 1)} {
+		if _, err := parseVMStats(out); err == nil {
+			t.Errorf("parseVMStats(%q) should fail", out)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Loopback tunnels to services on a sandbox VM.
+//
+// A tunnel listens on 127.0.0.1 in the plugin process and forwards each
+// connection to a port on the VM's loopback interface through the owner's
+// terminal SSH connection. The listener outlives terminal sessions: when
+// the learner reconnects, new connections use the new session, so a Grafana
+// data source pointed at the tunnel keeps working. While no session is
+// connected, connections are closed straight away. The port a tunnel was
+// given is remembered in the store and reused when it is reopened, for
+// example after a plugin restart. A health check probes the service
+// through the current session every vmTunnelHealthInterval.
+//
+// Besides the data source tunnels, users can open named tunnels with
+// POST /vms/{id}/tunnels, list them with their health, and close them with
+// DELETE /vms/{id}/tunnels/{name}. A named tunnel is opened to a service
+// ("prometheus", "loki" or "tempo") rather than an arbitrary port: anything
+// on the host can connect to a tunnel without a credential, so named tunnels
+// only reach the vmServices ports, as data source tunnels do. Each user may
+// hold maxVMTunnelsPerUser tunnels. Named tunnels with no open connections
+// for vmTunnelIdleTimeout are closed by the health check; data source
+// tunnels stay open until the data source is cleaned up.
+
+const (
+	vmTunnelPortCollection = "vm-tunnel-ports"
+	vmTunnelHealthInterval = 30 * time.Second
+	vmTunnelIdleTimeout    = 30 * time.Minute
+	maxVMTunnelsPerUser    = 5
+
+	vmTunnelHealthy      = "healthy"
+	vmTunnelUnhealthy    = "unhealthy"
+	vmTunnelDisconnected = "disconnected"
+	vmTunnelPending      = "pending"
+)
+
+// vmTunnelInfo describes a tunnel and its last health check.
+type vmTunnelInfo struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	User          string    `json:"user"`
+	VMID          string    `json:"vmId"`
+	RemotePort    int       `json:"remotePort"`
+	LocalAddr     string    `json:"localAddr"`
+	DatasourceUID string    `json:"datasourceUid,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Status        string    `json:"status"`
+	LastCheck     time.Time `json:"lastCheck,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	Connections   int       `json:"connections"`
+	LastUsed      time.Time `json:"lastUsed,omitempty"`
+}
+
+type vmTunnel struct {
+	app       *App
+	listener  net.Listener
+	readyPath string // HTTP path probed by health checks; a TCP dial if empty
+	cancel    context.CancelFunc
+	// wg tracks the accept loop, health check and forwarded connections.
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	info   vmTunnelInfo
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func vmTunnelKey(user, vmID, name string) string {
+	return user + "/" + vmID + "/" + name
+}
+
+type openVMTunnelRequest struct {
+	Name    string `json:"name" validate:"required,pattern=name"`
+	Service string `json:"service" validate:"required,oneof=prometheus loki tempo"`
+}
+
+// openVMTunnel returns the user's tunnel named name to remotePort on vmID,
+// opening it if needed.
+func (a *App) openVMTunnel(user, vmID, name string, remotePort int, readyPath string) (*vmTunnel, error) {
+	key := vmTunnelKey(user, vmID, name)
+	a.tunnelsMu.Lock()
+	defer a.tunnelsMu.Unlock()
+	if t, ok := a.tunnels[key]; ok {
+		return t, nil
+	}
+
+	var port int
+	_, _ = a.store.get(vmTunnelPortCollection, key, &port)
+	listener, err := listenLoopback(port)
+	if err != nil {
+		return nil, err
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
+	if err := a.store.put(vmTunnelPortCollection, key, port); err != nil {
+		a.logger.Warn("Failed to remember tunnel port", "tunnel", key, "error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &vmTunnel{
+		app:       a,
+		listener:  listener,
+		readyPath: readyPath,
+		cancel:    cancel,
+		conns:     map[net.Conn]struct{}{},
+		info: vmTunnelInfo{
+			ID:         key,
+			Name:       name,
+			User:       user,
+			VMID:       vmID,
+			RemotePort: remotePort,
+			LocalAddr:  listener.Addr().String(),
+			CreatedAt:  timeNow(),
+			Status:     vmTunnelPending,
+		},
+	}
+	if a.tunnels == nil {
+		a.tunnels = make(map[string]*vmTunnel)
+	}
+	a.tunnels[key] = t
+	t.wg.Add(2)
+	go t.serve()
+	go t.monitor(ctx)
+	return t, nil
+}
+
+// listenLoopback listens on port on 127.0.0.1, falling back to any free
+// port when port is 0 or taken.
+func listenLoopback(port int) (net.Listener, error) {
+	if port > 0 {
+		if l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil {
+			return l, nil
+		}
+	}
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+// closeVMTunnels closes the tunnels match selects and returns how many.
+func (a *App) closeVMTunnels(match func(vmTunnelInfo) bool) int {
+	closing := a.removeVMTunnels(match)
+	for _, t := range closing {
+		t.close()
+	}
+	return len(closing)
+}
+
+// removeVMTunnels removes the tunnels match selects and returns them.
+func (a *App) removeVMTunnels(match func(vmTunnelInfo) bool) []*vmTunnel {
+	a.tunnelsMu.Lock()
+	defer a.tunnelsMu.Unlock()
+	var removed []*vmTunnel
+	for key, t := range a.tunnels {
+		if match(t.snapshot()) {
+			removed = append(removed, t)
+			delete(a.tunnels, key)
+		}
+	}
+	return removed
+}
+
+// vmTunnelList returns the tunnels match selects.
+func (a *App) vmTunnelList(match func(vmTunnelInfo) bool) []vmTunnelInfo {
+	a.tunnelsMu.Lock()
+	defer a.tunnelsMu.Unlock()
+	var out []vmTunnelInfo
+	for _, t := range a.tunnels {
+		if info := t.snapshot(); match(info) {
+			out = append(out, info)
+		}
+	}
+	return out
+}
+
+func (t *vmTunnel) snapshot() vmTunnelInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info := t.info
+	info.Connections = len(t.conns)
+	return info
+}
+
+func (t *vmTunnel) setDatasource(uid string) {
+	t.mu.Lock()
+	t.info.DatasourceUID = uid
+	t.mu.Unlock()
+}
+
+func (t *vmTunnel) setStatus(status string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.info.Status = status
+	t.info.LastCheck = timeNow()
+	t.info.LastError = ""
+	if err != nil {
+		t.info.LastError = err.Error()
+	}
+}
+
+// stop closes t's listener and connections without waiting.
+func (t *vmTunnel) stop() {
+	t.cancel()
+	_ = t.listener.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for c := range t.conns {
+		_ = c.Close()
+	}
+}
+
+// close stops t and waits for its goroutines to return.
+func (t *vmTunnel) close() {
+	t.stop()
+	t.wg.Wait()
+}
+
+// idle reports whether a named tunnel has gone unused for
+// vmTunnelIdleTimeout at now.
+func (info vmTunnelInfo) idle(now time.Time) bool {
+	if info.DatasourceUID != "" || info.Connections > 0 {
+		return false
+	}
+	last := info.CreatedAt
+	if info.LastUsed.After(last) {
+		last = info.LastUsed
+	}
+	return now.Sub(last) >= vmTunnelIdleTimeout
+}
+
+// closeIfIdle stops t if it has gone unused and reports whether it did.
+// It runs on the health check, so it doesn't wait for t's goroutines.
+func (t *vmTunnel) closeIfIdle() bool {
+	info := t.snapshot()
+	if !info.idle(timeNow()) {
+		return false
+	}
+	for _, removed := range t.app.removeVMTunnels(func(o vmTunnelInfo) bool { return o.ID == info.ID }) {
+		removed.stop()
+	}
+	return true
+}
+
+func (t *vmTunnel) serve() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.forward(conn)
+		}()
+	}
+}
+
+func (t *vmTunnel) remoteAddr() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(t.info.RemotePort))
+}
+
+// forward copies between conn and the VM port until either side closes.
+func (t *vmTunnel) forward(conn net.Conn) {
+	defer conn.Close()
+	client := t.app.findSSHClientForUserVM(t.info.User, t.info.VMID)
+	if client == nil {
+		t.setStatus(vmTunnelDisconnected, nil)
+		return
+	}
+	remote, err := client.Dial("tcp", t.remoteAddr())
+	if err != nil {
+		t.setStatus(vmTunnelUnhealthy, err)
+		return
+	}
+	defer remote.Close()
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.conns[conn] = struct{}{}
+	t.info.LastUsed = timeNow()
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+	}()
+
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(remote, conn); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(conn, remote); done <- struct{}{} }()
+	<-done
+}
+
+func (t *vmTunnel) monitor(ctx context.Context) {
+	defer t.wg.Done()
+	ticker := time.NewTicker(vmTunnelHealthInterval)
+	defer ticker.Stop()
+	for {
+		t.check(ctx)
+		if t.closeIfIdle() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check probes the tunnel's VM port through the owner's current session.
+func (t *vmTunnel) check(ctx context.Context) {
+	client := t.app.findSSHClientForUserVM(t.info.User, t.info.VMID)
+	if client == nil {
+		t.setStatus(vmTunnelDisconnected, nil)
+		return
+	}
+	if err := probeVMPort(ctx, client, t.info.RemotePort, t.readyPath); err != nil {
+		t.setStatus(vmTunnelUnhealthy, err)
+		return
+	}
+	t.setStatus(vmTunnelHealthy, nil)
+}
+
+// probeVMPort checks that port answers on the VM: with a 200 on readyPath,
+// or by accepting a connection when readyPath is empty.
+func probeVMPort(ctx context.Context, client *ssh.Client, port int, readyPath string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	if readyPath == "" {
+		conn, err := client.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+readyPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: sshTunnelTransport(client)}).Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", readyPath, resp.Status)
+	}
+	return nil
+}
+
+// handleVMTunnels handles GET/POST /vms/{id}/tunnels and GET/DELETE
+// /vms/{id}/tunnels/{name}; name is empty for the collection.
+func (a *App) handleVMTunnels(w http.ResponseWriter, r *http.Request, vmID, name string) {
+	ctx := r.Context()
+	user := userLoginFromContext(ctx)
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	mine := func(t vmTunnelInfo) bool { return t.User == user && t.VMID == vmID }
+
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			tunnels := a.vmTunnelList(mine)
+			sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Name < tunnels[j].Name })
+			if tunnels == nil {
+				tunnels = []vmTunnelInfo{}
+			}
+			a.writeJSON(w, map[string]interface{}{"tunnels": tunnels}, http.StatusOK)
+		case http.MethodPost:
+			a.openNamedVMTunnel(w, r, user, vmID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	named := func(t vmTunnelInfo) bool { return mine(t) && t.Name == name }
+	tunnels := a.vmTunnelList(named)
+	if len(tunnels) == 0 {
+		a.writeError(w, "Tunnel not found: "+name, http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, tunnels[0], http.StatusOK)
+	case http.MethodDelete:
+		if uid := tunnels[0].DatasourceUID; uid != "" {
+			a.writeError(w, "Tunnel is used by data source "+uid+"; remove it with /actions/cleanup", http.StatusConflict)
+			return
+		}
+		a.closeVMTunnels(named)
+		a.recordAudit(a.ctxLogger(ctx), auditEntry{Actor: user, Action: "vm.tunnel.close", VMID: vmID, Details: name})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) openNamedVMTunnel(w http.ResponseWriter, r *http.Request, user, vmID string) {
+	var req openVMTunnelRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	service := vmServices[req.Service]
+	if a.findSSHClientForUserVM(user, vmID) == nil {
+		a.writeError(w, "No active terminal session for this VM", http.StatusConflict)
+		return
+	}
+	if len(a.vmTunnelList(func(t vmTunnelInfo) bool { return t.User == user && t.VMID == vmID && t.Name == req.Name })) > 0 {
+		a.writeError(w, "A tunnel named "+req.Name+" is already open", http.StatusConflict)
+		return
+	}
+	if n := len(a.vmTunnelList(func(t vmTunnelInfo) bool { return t.User == user })); n >= maxVMTunnelsPerUser {
+		a.writeError(w, fmt.Sprintf("You already have %d open tunnels; close one first", n), http.StatusTooManyRequests)
+		return
+	}
+
+	t, err := a.openVMTunnel(user, vmID, req.Name, service.Port, service.ReadyPath)
+	if err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to open VM tunnel", "vmID", vmID, "name", req.Name, "error", err)
+		a.writeError(w, "Failed to open the tunnel", http.StatusInternalServerError)
+		return
+	}
+	t.check(r.Context())
+	a.recordAudit(a.ctxLogger(r.Context()), auditEntry{Actor: user, Action: "vm.tunnel.open", VMID: vmID, Details: fmt.Sprintf("%s to %s", req.Name, req.Service)})
+	a.writeJSON(w, t.snapshot(), http.StatusCreated)
+}
@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVMTunnelDatasource(t *testing.T) {
+	api := &fakeGrafanaAPI{}
+	useFakeGrafanaAPI(t, api)
+	app, mux := newSandboxApp(t)
+	t.Cleanup(func() { app.closeVMTunnels(func(vmTunnelInfo) bool { return true }) })
+
+	body := `{"services": ["prometheus", "loki"], "mode": "tunnel", "guide": "explore-101"}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, withServiceAccount(roleRequest(http.MethodPost, "/v1/vms/vm-1/datasources", body, "ana", "Editor")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct{ Datasources []sandboxDatasource }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Datasources) != 2 || resp.Datasources[0].Status != sandboxDatasourceCreated || resp.Datasources[0].Tunnel == "" {
+		t.Fatalf("datasources = %+v", resp.Datasources)
+	}
+	addr := resp.Datasources[0].Tunnel
+	ds := api.created[resp.Datasources[0].UID]
+	if ds.URL != "http://"+addr || ds.SecureJSONData != nil {
+		t.Fatalf("data source = %+v", ds)
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	query := func() (int, error) {
+		resp, err := client.Get("http://" + addr + "/api/v1/query?query=up")
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if code, err := query(); err != nil || code != http.StatusOK {
+		t.Fatalf("query through tunnel: %d %v", code, err)
+	}
+
+	tunnels := app.vmTunnelList(func(vmTunnelInfo) bool { return true })
+	if len(tunnels) != 1 {
+		t.Fatalf("tunnels = %+v", tunnels)
+	}
+	app.tunnels[tunnels[0].ID].check(context.Background())
+	if got := app.vmTunnelList(func(vmTunnelInfo) bool { return true })[0]; got.Status != vmTunnelHealthy || got.DatasourceUID != ds.UID {
+		t.Errorf("tunnel = %+v", got)
+	}
+
+	// Without a session the endpoint stays up but drops connections; the
+	// same address works again once the learner reconnects.
+	sess := app.streamSessions["terminal/vm-1/1"]
+	app.streamSessionsMu.Lock()
+	delete(app.streamSessions, "terminal/vm-1/1")
+	app.streamSessionsMu.Unlock()
+	if _, err := query(); err == nil {
+		t.Error("query succeeded without a session")
+	}
+	app.tunnels[tunnels[0].ID].check(context.Background())
+	if got := app.vmTunnelList(func(vmTunnelInfo) bool { return true })[0]; got.Status != vmTunnelDisconnected {
+		t.Errorf("status without a session = %s", got.Status)
+	}
+	app.streamSessionsMu.Lock()
+	app.streamSessions["terminal/vm-1/2"] = sess
+	app.streamSessionsMu.Unlock()
+	if code, err := query(); err != nil || code != http.StatusOK {
+		t.Fatalf("query after reconnect: %d %v", code, err)
+	}
+
+	// A reopened tunnel keeps its port.
+	app.closeVMTunnels(func(vmTunnelInfo) bool { return true })
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withServiceAccount(roleRequest(http.MethodPost, "/v1/vms/vm-1/datasources", `{"services": ["prometheus"], "mode": "tunnel"}`, "ana", "Editor")))
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Datasources[0].Status != sandboxDatasourceExists || resp.Datasources[0].Tunnel != addr {
+		t.Fatalf("reopened = %+v, want %s", resp.Datasources[0], addr)
+	}
+
+	cleanup(t, mux, `{"guide": "explore-101"}`, "ana")
+	if left := app.vmTunnelList(func(vmTunnelInfo) bool { return true }); len(left) != 0 {
+		t.Errorf("tunnels after cleanup: %+v", left)
+	}
+	if _, err := query(); err == nil {
+		t.Error("tunnel still accepting after cleanup")
+	}
+}
+
+func TestVMTunnelsAPI(t *testing.T) {
+	app, mux := newSandboxApp(t)
+	t.Cleanup(func() { app.closeVMTunnels(func(vmTunnelInfo) bool { return true }) })
+	serve := func(method, target, body, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, roleRequest(method, target, body, user, "Viewer"))
+		return w
+	}
+
+	w := serve(http.MethodPost, "/v1/vms/vm-1/tunnels", `{"name": "prom", "service": "prometheus"}`, "ana")
+	var opened vmTunnelInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &opened); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("open: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if opened.Status != vmTunnelHealthy || opened.LocalAddr == "" || opened.RemotePort != 9090 {
+		t.Errorf("opened = %+v", opened)
+	}
+
+	for _, tc := range []struct {
+		body, user string
+		want       int
+	}{
+		{`{"name": "prom", "service": "loki"}`, "ana", http.StatusConflict},
+		{`{"name": "prom", "service": "prometheus"}`, "bo", http.StatusConflict},
+		{`{"name": "Bad Name", "service": "prometheus"}`, "ana", http.StatusBadRequest},
+		{`{"name": "x", "service": "ssh"}`, "ana", http.StatusBadRequest},
+		{`{"name": "x", "port": 22}`, "ana", http.StatusBadRequest},
+	} {
+		if w := serve(http.MethodPost, "/v1/vms/vm-1/tunnels", tc.body, tc.user); w.Code != tc.want {
+			t.Errorf("open %s as %s: status=%d, want %d", tc.body, tc.user, w.Code, tc.want)
+		}
+	}
+
+	// A service that isn't running opens but reports unhealthy.
+	w = serve(http.MethodPost, "/v1/vms/vm-1/tunnels", `{"name": "app", "service": "loki"}`, "ana")
+	if err := json.Unmarshal(w.Body.Bytes(), &opened); err != nil || opened.Status != vmTunnelUnhealthy || opened.LastError == "" {
+		t.Errorf("unhealthy open: status=%d body=%s", w.Code, w.Body.String())
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if w := serve(http.MethodPost, "/v1/vms/vm-1/tunnels", `{"name": "`+name+`", "service": "tempo"}`, "ana"); w.Code != http.StatusCreated {
+			t.Fatalf("open %s: status=%d", name, w.Code)
+		}
+	}
+	if w := serve(http.MethodPost, "/v1/vms/vm-1/tunnels", `{"name": "d", "service": "tempo"}`, "ana"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("over the limit: status=%d", w.Code)
+	}
+
+	var listed struct{ Tunnels []vmTunnelInfo }
+	if err := json.Unmarshal(serve(http.MethodGet, "/v1/vms/vm-1/tunnels", "", "ana").Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Tunnels) != maxVMTunnelsPerUser || listed.Tunnels[0].Name != "a" {
+		t.Errorf("listed %+v", listed.Tunnels)
+	}
+	if err := json.Unmarshal(serve(http.MethodGet, "/v1/vms/vm-1/tunnels", "", "bo").Body.Bytes(), &listed); err != nil || listed.Tunnels == nil || len(listed.Tunnels) != 0 {
+		t.Errorf("bo's list = %+v, %v", listed.Tunnels, err)
+	}
+	if w := serve(http.MethodGet, "/v1/vms/vm-1/tunnels/prom", "", "ana"); w.Code != http.StatusOK {
+		t.Errorf("get: status=%d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/v1/vms/vm-1/tunnels/prom", "", "bo"); w.Code != http.StatusNotFound {
+		t.Errorf("bo closing ana's tunnel: status=%d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/v1/vms/vm-1/tunnels/prom", "", "ana"); w.Code != http.StatusNoContent {
+		t.Errorf("close: status=%d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/v1/vms/vm-1/tunnels/prom", "", "ana"); w.Code != http.StatusNotFound {
+		t.Errorf("get after close: status=%d", w.Code)
+	}
+
+	// Unused named tunnels are closed once idle.
+	app.tunnelsMu.Lock()
+	idle := app.tunnels[vmTunnelKey("ana", "vm-1", "a")]
+	app.tunnelsMu.Unlock()
+	idle.mu.Lock()
+	idle.info.CreatedAt = idle.info.CreatedAt.Add(-vmTunnelIdleTimeout)
+	idle.mu.Unlock()
+	if !idle.closeIfIdle() {
+		t.Error("idle tunnel kept open")
+	}
+	idle.wg.Wait()
+	if n := len(app.vmTunnelList(func(vmTunnelInfo) bool { return true })); n != 3 {
+		t.Errorf("%d tunnels after idle cleanup, want 3", n)
+	}
+}
@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signed webhooks.
+//
+// External systems notify the plugin with POST /webhooks/{kind}. Each call is
+// signed with HMAC-SHA256 over "{timestamp}.{body}" using a shared secret:
+//
+//	X-Pathfinder-Signature: t=1767225600,v1=<hex hmac>
+//
+// Calls older or newer than webhookReplayWindow, or whose signature was
+// already seen inside the window, are rejected, so a captured call can't be
+// replayed. The webhookSecrets secure setting holds one secret per line; list
+// the new secret next to the old one while rotating. Without secrets every
+// webhook is refused.
+//
+//	POST /webhooks/vm-state          {"vmId": "...", "state": "destroyed"}
+//	POST /webhooks/content-refresh   drops the cached package index
+
+const (
+	webhookSignatureHeader = "X-Pathfinder-Signature"
+	webhookReplayWindow    = 5 * time.Minute
+	webhookMaxBodyBytes    = 64 * 1024
+)
+
+// webhookReplayCache remembers signatures seen inside the replay window.
+type webhookReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// remember records sig and reports whether it is new. Expired entries are
+// dropped on the way.
+func (c *webhookReplayCache) remember(sig string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = map[string]time.Time{}
+	}
+	for k, t := range c.seen {
+		if now.Sub(t) > 2*webhookReplayWindow {
+			delete(c.seen, k)
+		}
+	}
+	if _, ok := c.seen[sig]; ok {
+		return false
+	}
+	c.seen[sig] = now
+	return true
+}
+
+// signWebhook returns the signature header value for body at ts.
+func signWebhook(secret string, ts time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", ts.Unix(), webhookMAC(secret, strconv.FormatInt(ts.Unix(), 10), body))
+}
+
+func webhookMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhook checks the signature of a webhook call and returns its body.
+func (a *App) verifyWebhook(r *http.Request) ([]byte, error) {
+	var secrets []string
+	if a.settings != nil {
+		secrets = a.settings.WebhookSecrets
+	}
+	if len(secrets) == 0 {
+		return nil, errors.New("webhooks are not configured")
+	}
+
+	var ts, sig string
+	for _, part := range strings.Split(r.Header.Get(webhookSignatureHeader), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return nil, errors.New("missing or malformed signature")
+	}
+	now := timeNow()
+	if d := now.Sub(time.Unix(unix, 0)); d > webhookReplayWindow || d < -webhookReplayWindow {
+		return nil, errors.New("signature timestamp outside the replay window")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if len(body) > webhookMaxBodyBytes {
+		return nil, errors.New("body too large")
+	}
+
+	valid := false
+	for _, secret := range secrets {
+		if hmac.Equal([]byte(webhookMAC(secret, ts, body)), []byte(sig)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, errors.New("signature mismatch")
+	}
+	if !a.webhookReplays.remember(sig, now) {
+		return nil, errors.New("webhook replayed")
+	}
+	return body, nil
+}
+
+// handleWebhook handles POST /webhooks/{kind}.
+func (a *App) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctxLogger := a.ctxLogger(r.Context())
+	kind := strings.TrimPrefix(r.URL.Path, "/webhooks/")
+	body, err := a.verifyWebhook(r)
+	if err != nil {
+		ctxLogger.Warn("Rejected webhook", "kind", kind, "error", err)
+		a.writeError(w, "Invalid webhook signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch kind {
+	case "vm-state":
+		var event struct {
+			VMID  string `json:"vmId"`
+			State string `json:"state"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil || event.VMID == "" {
+			a.writeError(w, "Invalid webhook body", http.StatusBadRequest)
+			return
+		}
+		ctxLogger.Info("VM state webhook", "vmID", event.VMID, "state", event.State)
+		if a.coda != nil {
+			a.coda.InvalidateVMList()
+		}
+		if !isUsableState(event.State) {
+			a.forgetVM(event.VMID)
+		}
+	case "content-refresh":
+		ctxLogger.Info("Content refresh webhook")
+		packageCacheMu.Lock()
+		packageCache = nil
+		packageCacheMu.Unlock()
+	default:
+		a.writeError(w, "Unknown webhook", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgetVM drops vmID from the per-user VM cache, whoever it belongs to.
+func (a *App) forgetVM(vmID string) {
+	a.userVMsMu.Lock()
+	defer a.userVMsMu.Unlock()
+	for user, id := range a.userVMs {
+		if id == vmID {
+			delete(a.userVMs, user)
+		}
+	}
+}
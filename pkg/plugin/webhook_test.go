@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleWebhook_Signature(t *testing.T) {
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	restore := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = restore }()
+
+	app := newTestApp(t)
+	app.settings = &Settings{WebhookSecrets: splitSecretList("old-secret\nnew-secret")}
+	app.userVMs = map[string]string{"alice": "vm-1", "bob": "vm-2"}
+
+	body := `{"vmId":"vm-1","state":"destroyed"}`
+	send := func(sig, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/vm-state", strings.NewReader(body))
+		if sig != "" {
+			r.Header.Set(webhookSignatureHeader, sig)
+		}
+		w := httptest.NewRecorder()
+		app.handleWebhook(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name string
+		sig  string
+		body string
+	}{
+		{"unsigned", "", body},
+		{"wrong secret", signWebhook("guess", now, []byte(body)), body},
+		{"tampered body", signWebhook("new-secret", now, []byte(body)), `{"vmId":"vm-2","state":"destroyed"}`},
+		{"stale", signWebhook("new-secret", now.Add(-10*time.Minute), []byte(body)), body},
+		{"malformed", "v1=abc", body},
+	}
+	for _, tt := range tests {
+		if code := send(tt.sig, tt.body); code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", tt.name, code)
+		}
+	}
+	if len(app.userVMs) != 2 {
+		t.Fatalf("rejected webhook changed state: %v", app.userVMs)
+	}
+
+	sig := signWebhook("old-secret", now.Add(-time.Minute), []byte(body))
+	if code := send(sig, body); code != http.StatusNoContent {
+		t.Fatalf("signed: status = %d", code)
+	}
+	if _, ok := app.userVMs["alice"]; ok || app.userVMs["bob"] != "vm-2" {
+		t.Errorf("userVMs = %v", app.userVMs)
+	}
+	if code := send(sig, body); code != http.StatusUnauthorized {
+		t.Errorf("replay: status = %d", code)
+	}
+
+	app.settings.WebhookSecrets = nil
+	if code := send(signWebhook("new-secret", now, []byte(body)), body); code != http.StatusUnauthorized {
+		t.Errorf("no secrets configured: status = %d", code)
+	}
+}
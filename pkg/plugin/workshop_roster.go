@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Workshop rosters.
+//
+// PUT /admin/workshops/{name}/roster reserves one of the workshop's VMs for
+// each participant (a Grafana login or email). A reserved VM is used for the
+// participant's first terminal connection with the workshop's template, so
+// learners get their own pre-warmed environment instead of racing for claim
+// links, and its claim link refuses anyone else. Re-uploading a roster keeps
+// existing reservations for participants still on it and frees the rest.
+
+// RosterRequest is the body of PUT /admin/workshops/{name}/roster.
+type RosterRequest struct {
+	Participants []string `json:"participants" validate:"max=100,each,max=200"`
+}
+
+// rosterEntry is one participant's reservation in the roster response.
+type rosterEntry struct {
+	Participant string `json:"participant"`
+	VMID        string `json:"vmId,omitempty"`
+	State       string `json:"state"`
+	ClaimedBy   string `json:"claimedBy,omitempty"`
+}
+
+// assignedTo reports whether the slot is reserved for the user with login or
+// email. Logins and emails match case-insensitively.
+func (vm workshopVM) assignedTo(login, email string) bool {
+	if vm.AssignedTo == "" {
+		return false
+	}
+	return strings.EqualFold(vm.AssignedTo, login) || (email != "" && strings.EqualFold(vm.AssignedTo, email))
+}
+
+func (w workshop) roster() []rosterEntry {
+	entries := []rosterEntry{}
+	for _, vm := range w.VMs {
+		if vm.AssignedTo != "" {
+			entries = append(entries, rosterEntry{Participant: vm.AssignedTo, VMID: vm.VMID, State: vm.State, ClaimedBy: vm.ClaimedBy})
+		}
+	}
+	return entries
+}
+
+// assignRoster reserves a VM for every participant. It fails without
+// changing w when there are not enough unreserved VMs.
+func (w *workshop) assignRoster(participants []string) error {
+	wanted := make(map[string]bool, len(participants))
+	for _, p := range participants {
+		wanted[strings.ToLower(p)] = true
+	}
+
+	vms := append([]workshopVM(nil), w.VMs...)
+	assigned := map[string]bool{}
+	for i := range vms {
+		key := strings.ToLower(vms[i].AssignedTo)
+		if vms[i].AssignedTo != "" && !wanted[key] {
+			vms[i].AssignedTo = ""
+		}
+		if vms[i].AssignedTo != "" {
+			assigned[key] = true
+		}
+	}
+
+	for _, p := range participants {
+		if assigned[strings.ToLower(p)] {
+			continue
+		}
+		slot := -1
+		for i := range vms {
+			if vms[i].AssignedTo == "" && strings.EqualFold(vms[i].ClaimedBy, p) {
+				slot = i
+				break
+			}
+		}
+		for i := 0; slot < 0 && i < len(vms); i++ {
+			if vms[i].AssignedTo == "" && vms[i].ClaimedBy == "" && vms[i].State != workshopVMFailed {
+				slot = i
+			}
+		}
+		if slot < 0 {
+			return fmt.Errorf("Not enough free VMs in workshop %q for %d participants", w.Name, len(participants))
+		}
+		vms[slot].AssignedTo = p
+		assigned[strings.ToLower(p)] = true
+	}
+	w.VMs = vms
+	return nil
+}
+
+// handleWorkshopRoster handles GET/PUT /admin/workshops/{name}/roster. The
+// caller has already checked that the user is an admin.
+func (a *App) handleWorkshopRoster(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		ws, _ := a.getWorkshop(name)
+		a.writeJSON(w, map[string]interface{}{"roster": ws.roster()}, http.StatusOK)
+	case http.MethodPut:
+		var req RosterRequest
+		if !a.decodeRequest(w, r, &req) {
+			return
+		}
+		seen := map[string]bool{}
+		participants := make([]string, 0, len(req.Participants))
+		for _, p := range req.Participants {
+			p = strings.TrimSpace(p)
+			if p == "" || seen[strings.ToLower(p)] {
+				continue
+			}
+			seen[strings.ToLower(p)] = true
+			participants = append(participants, p)
+		}
+
+		var assignErr error
+		ws, ok := a.updateWorkshop(name, func(ws *workshop) { assignErr = ws.assignRoster(participants) })
+		if !ok {
+			a.writeError(w, "Workshop not found", http.StatusNotFound)
+			return
+		}
+		if assignErr != nil {
+			a.writeError(w, assignErr.Error(), http.StatusConflict)
+			return
+		}
+		a.ctxLogger(r.Context()).Info("Workshop roster updated", "workshop", name, "participants", len(participants), "by", userLoginFromContext(r.Context()))
+		a.writeJSON(w, map[string]interface{}{"roster": ws.roster()}, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWorkshopAssignRoster(t *testing.T) {
+	ws := workshop{Name: "obs-101", VMs: []workshopVM{
+		{VMID: "vm-1", State: workshopVMReady, ClaimedBy: "carol"},
+		{VMID: "vm-2", State: workshopVMFailed},
+		{VMID: "vm-3", State: workshopVMReady},
+		{VMID: "vm-4", State: workshopVMReady},
+	}}
+
+	if err := ws.assignRoster([]string{"alice", "Carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if ws.VMs[0].AssignedTo != "Carol" || ws.VMs[2].AssignedTo != "alice" {
+		t.Errorf("assignments = %+v", ws.VMs)
+	}
+
+	// Re-upload keeps alice's VM, frees Carol's and reserves one for bob.
+	if err := ws.assignRoster([]string{"bob@example.com", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if ws.VMs[2].AssignedTo != "alice" || ws.VMs[3].AssignedTo != "bob@example.com" || ws.VMs[0].AssignedTo != "" {
+		t.Errorf("assignments after re-upload = %+v", ws.VMs)
+	}
+
+	before := append([]workshopVM(nil), ws.VMs...)
+	if err := ws.assignRoster([]string{"alice", "bob@example.com", "dave", "erin"}); err == nil {
+		t.Error("expected an error when the roster outgrows the free VMs")
+	}
+	for i := range before {
+		if ws.VMs[i] != before[i] {
+			t.Errorf("failed assignment changed slot %d: %+v", i, ws.VMs[i])
+		}
+	}
+
+	if !ws.VMs[3].assignedTo("bob", "Bob@Example.com") || ws.VMs[3].assignedTo("bob", "") {
+		t.Error("email matching")
+	}
+}
+
+func TestWorkshopRoster_ReservedVM(t *testing.T) {
+	app, _ := newWorkshopTestApp(t)
+	if err := app.store.put(workshopCollection, "obs-101", workshop{Name: "obs-101", Template: "vm-aws", VMs: []workshopVM{
+		{VMID: "vm-1", State: workshopVMReady, ClaimToken: "t1"},
+		{VMID: "vm-2", State: workshopVMReady, ClaimToken: "t2"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	app.handleAdminWorkshopByName(w, roleRequest(http.MethodPut, "/admin/workshops/obs-101/roster", `{"participants":["bob@example.com"," alice ","alice"]}`, "admin", "Admin"))
+	var resp struct {
+		Roster []rosterEntry `json:"roster"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || len(resp.Roster) != 2 || resp.Roster[0].Participant != "bob@example.com" || resp.Roster[1].Participant != "alice" {
+		t.Fatalf("status = %d, roster = %+v", w.Code, resp.Roster)
+	}
+
+	// Bob's reserved VM is found by email and refuses other claimants.
+	if vm := app.workshopVMForUser(context.Background(), "bob", "bob@example.com", "vm-aws"); vm == nil || vm.ID != "vm-1" {
+		t.Errorf("bob's VM = %+v", vm)
+	}
+	w = httptest.NewRecorder()
+	app.handleWorkshopClaim(w, withUser(httptest.NewRequest(http.MethodGet, "/workshops/claim/t2", nil), "mallory"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("mallory claiming alice's VM: status = %d", w.Code)
+	}
+	ws, _ := app.getWorkshop("obs-101")
+	if ws.VMs[0].ClaimedBy != "bob" {
+		t.Errorf("vm-1 claimedBy = %q", ws.VMs[0].ClaimedBy)
+	}
+
+	w = httptest.NewRecorder()
+	app.handleAdminWorkshopByName(w, roleRequest(http.MethodPut, "/admin/workshops/obs-101/roster", `{"participants":["a","b","c"]}`, "admin", "Admin"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("oversized roster: status = %d", w.Code)
+	}
+}
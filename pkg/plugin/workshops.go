@@ -0,0 +1,411 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Workshop batch provisioning.
+//
+// POST /admin/workshops creates a named batch of VMs in the background,
+// workshopProvisionConcurrency at a time, and returns immediately; the
+// workshop record in the plugin store tracks each VM's progress and is
+// returned by GET /admin/workshops/{name}. Every VM gets a random claim
+// token. Opening its claim link (GET /workshops/claim/{token}) as a signed-in
+// user binds that VM to them and redirects to the app, and their next
+// terminal connection with the workshop's template uses it.
+
+const (
+	workshopCollection           = "workshops"
+	workshopProvisionConcurrency = 8
+
+	// pluginResourcesPath is where Grafana serves this plugin's resources.
+	pluginResourcesPath = "/api/plugins/grafana-pathfinder-app/resources"
+)
+
+const (
+	workshopVMPending = "pending"
+	workshopVMReady   = "ready"
+	workshopVMFailed  = "failed"
+)
+
+// workshop is a stored batch of pre-provisioned VMs.
+type workshop struct {
+	Name      string       `json:"name"`
+	Template  string       `json:"template"`
+	CreatedBy string       `json:"createdBy"`
+	CreatedAt time.Time    `json:"createdAt"`
+	VMs       []workshopVM `json:"vms"`
+}
+
+// workshopVM is one VM slot of a workshop.
+type workshopVM struct {
+	VMID       string    `json:"vmId,omitempty"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	ClaimToken string    `json:"claimToken"`
+	ClaimedBy  string    `json:"claimedBy,omitempty"`
+	ClaimedAt  time.Time `json:"claimedAt,omitzero"`
+	// AssignedTo reserves the VM for a roster participant (login or email).
+	AssignedTo string `json:"assignedTo,omitempty"`
+}
+
+// workshopInfo is the JSON view of a workshop with progress and claim links.
+type workshopInfo struct {
+	workshop
+	Total       int      `json:"total"`
+	Ready       int      `json:"ready"`
+	Failed      int      `json:"failed"`
+	Pending     int      `json:"pending"`
+	Claimed     int      `json:"claimed"`
+	ClaimLinks  []string `json:"claimLinks"`
+	Provisioned bool     `json:"provisioned"`
+}
+
+func (w workshop) info() workshopInfo {
+	info := workshopInfo{workshop: w, Total: len(w.VMs), ClaimLinks: make([]string, 0, len(w.VMs))}
+	for _, vm := range w.VMs {
+		switch vm.State {
+		case workshopVMReady:
+			info.Ready++
+		case workshopVMFailed:
+			info.Failed++
+		default:
+			info.Pending++
+		}
+		if vm.ClaimedBy != "" {
+			info.Claimed++
+		}
+		info.ClaimLinks = append(info.ClaimLinks, pluginResourcesPath+"/"+apiVersion+"/workshops/claim/"+vm.ClaimToken)
+	}
+	info.Provisioned = info.Pending == 0
+	return info
+}
+
+// CreateWorkshopRequest is the body of POST /admin/workshops.
+type CreateWorkshopRequest struct {
+	Name     string `json:"name" validate:"required,pattern=name"`
+	Template string `json:"template" validate:"pattern=template"`
+	Count    int    `json:"count" validate:"required,min=1,max=100"`
+}
+
+func (a *App) getWorkshop(name string) (workshop, bool) {
+	var w workshop
+	ok, err := a.store.get(workshopCollection, name, &w)
+	return w, ok && err == nil
+}
+
+func (a *App) listWorkshops() []workshop {
+	workshops := []workshop{}
+	for _, key := range a.store.keys(workshopCollection) {
+		if w, ok := a.getWorkshop(key); ok {
+			workshops = append(workshops, w)
+		}
+	}
+	return workshops
+}
+
+// updateWorkshop applies fn to the stored workshop under workshopsMu.
+// Returns false when the workshop no longer exists.
+func (a *App) updateWorkshop(name string, fn func(*workshop)) (workshop, bool) {
+	a.workshopsMu.Lock()
+	defer a.workshopsMu.Unlock()
+	w, ok := a.getWorkshop(name)
+	if !ok {
+		return w, false
+	}
+	fn(&w)
+	if err := a.store.put(workshopCollection, name, w); err != nil {
+		a.logger.Warn("Failed to update workshop", "workshop", name, "error", err)
+	}
+	return w, true
+}
+
+// provisionWorkshop creates the workshop's pending VMs concurrently. Slots
+// not started when ctx ends stay pending.
+func (a *App) provisionWorkshop(ctx context.Context, name string) {
+	w, ok := a.getWorkshop(name)
+	if !ok {
+		return
+	}
+	sem := make(chan struct{}, workshopProvisionConcurrency)
+	var wg sync.WaitGroup
+	for i := range w.VMs {
+		if w.VMs[i].State != workshopVMPending {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var vmID, errMsg string
+			if err := a.killSwitchError(); err != nil {
+				errMsg = err.Error()
+			} else if err := a.checkOrgQuota(); err != nil {
+				errMsg = err.Error()
+			} else if vm, err := a.coda.CreateVM(ctx, w.Template, "workshop:"+name); err != nil {
+				errMsg = err.Error()
+			} else {
+				vmID = vm.ID
+				a.recordVMProvisioned(a.logger)
+			}
+			_, ok := a.updateWorkshop(name, func(w *workshop) {
+				w.VMs[slot].VMID = vmID
+				w.VMs[slot].Error = errMsg
+				w.VMs[slot].State = workshopVMReady
+				if errMsg != "" {
+					w.VMs[slot].State = workshopVMFailed
+				}
+			})
+			if !ok && vmID != "" {
+				// Workshop deleted while provisioning.
+				_ = a.coda.DeleteVM(ctx, vmID, true)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if w, ok := a.getWorkshop(name); ok {
+		info := w.info()
+		a.logger.Info("Workshop provisioned", "workshop", name, "ready", info.Ready, "failed", info.Failed)
+	}
+}
+
+// workshopVMForUser returns the usable VM the user claimed or was assigned
+// by roster in a workshop for template, or nil. An assigned VM is marked as
+// claimed by the user on first use.
+func (a *App) workshopVMForUser(ctx context.Context, user, email, template string) *VM {
+	for _, w := range a.listWorkshops() {
+		if w.Template != template {
+			continue
+		}
+		for i, slot := range w.VMs {
+			if slot.VMID == "" || (slot.ClaimedBy != user && !(slot.ClaimedBy == "" && slot.assignedTo(user, email))) {
+				continue
+			}
+			vm, err := a.coda.GetVM(ctx, slot.VMID)
+			if err != nil || !isUsableState(vm.State) {
+				continue
+			}
+			if slot.ClaimedBy == "" {
+				a.updateWorkshop(w.Name, func(w *workshop) {
+					w.VMs[i].ClaimedBy = user
+					w.VMs[i].ClaimedAt = timeNow().UTC()
+				})
+			}
+			return vm
+		}
+	}
+	return nil
+}
+
+// handleAdminWorkshops handles GET and POST /admin/workshops (admin only).
+func (a *App) handleAdminWorkshops(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage workshops", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		infos := []workshopInfo{}
+		for _, ws := range a.listWorkshops() {
+			infos = append(infos, ws.info())
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.After(infos[j].CreatedAt) })
+		a.writeJSON(w, map[string]interface{}{"workshops": infos}, http.StatusOK)
+	case http.MethodPost:
+		a.handleCreateWorkshop(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleCreateWorkshop(w http.ResponseWriter, r *http.Request, user string) {
+	if a.coda == nil {
+		a.writeError(w, "Coda not registered - configure enrollment key and register first", http.StatusServiceUnavailable)
+		return
+	}
+	var req CreateWorkshopRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Template == "" {
+		req.Template = "vm-aws"
+	}
+
+	ws := workshop{Name: req.Name, Template: req.Template, CreatedBy: user, CreatedAt: timeNow().UTC()}
+	for i := 0; i < req.Count; i++ {
+		ws.VMs = append(ws.VMs, workshopVM{State: workshopVMPending, ClaimToken: strings.ToLower(rand.Text())})
+	}
+	a.workshopsMu.Lock()
+	if _, exists := a.getWorkshop(req.Name); exists {
+		a.workshopsMu.Unlock()
+		a.writeError(w, "Workshop already exists", http.StatusConflict)
+		return
+	}
+	err := a.store.put(workshopCollection, req.Name, ws)
+	a.workshopsMu.Unlock()
+	if err != nil {
+		a.writeError(w, "Failed to save workshop", http.StatusInternalServerError)
+		return
+	}
+
+	if !a.goBackground(func(ctx context.Context) { a.provisionWorkshop(ctx, req.Name) }) {
+		a.workshopsMu.Lock()
+		_ = a.store.delete(workshopCollection, req.Name)
+		a.workshopsMu.Unlock()
+		a.writeError(w, "Plugin is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	a.ctxLogger(r.Context()).Info("Provisioning workshop", "workshop", req.Name, "template", req.Template, "count", req.Count, "by", user)
+	a.writeJSON(w, ws.info(), http.StatusAccepted)
+}
+
+// handleAdminWorkshopByName handles GET/DELETE /admin/workshops/{name} and
+// /admin/workshops/{name}/roster (admin only). DELETE destroys the
+// workshop's VMs.
+func (a *App) handleAdminWorkshopByName(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	if !userIsAdminFromContext(r.Context()) {
+		a.writeError(w, "Only admins can manage workshops", http.StatusForbidden)
+		return
+	}
+	name, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/workshops/"), "/")
+	ws, ok := a.getWorkshop(name)
+	if !ok {
+		a.writeError(w, "Workshop not found", http.StatusNotFound)
+		return
+	}
+	if sub == "roster" {
+		a.handleWorkshopRoster(w, r, name)
+		return
+	} else if sub != "" {
+		a.writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, ws.info(), http.StatusOK)
+	case http.MethodDelete:
+		a.workshopsMu.Lock()
+		ws, _ = a.getWorkshop(name)
+		err := a.store.delete(workshopCollection, name)
+		a.workshopsMu.Unlock()
+		if err != nil {
+			a.writeError(w, "Failed to delete workshop", http.StatusInternalServerError)
+			return
+		}
+		for _, slot := range ws.VMs {
+			if slot.ClaimedBy != "" {
+				a.clearUserVM(slot.ClaimedBy, slot.VMID)
+			}
+			if slot.VMID != "" && a.coda != nil {
+				if err := a.coda.DeleteVM(r.Context(), slot.VMID, true); err != nil && !isVMNotFoundError(err) {
+					a.ctxLogger(r.Context()).Warn("Failed to destroy workshop VM", "workshop", name, "vmID", slot.VMID, "error", err)
+				}
+			}
+		}
+		a.ctxLogger(r.Context()).Info("Deleted workshop", "workshop", name, "by", user)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWorkshopClaim handles GET /workshops/claim/{token}: the signed-in
+// user claims the VM behind the token and is redirected to the app.
+func (a *App) handleWorkshopClaim(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	email := userEmailFromContext(r.Context())
+	token := strings.TrimPrefix(r.URL.Path, "/workshops/claim/")
+
+	var name, vmID, conflict string
+	a.workshopsMu.Lock()
+	for _, ws := range a.listWorkshops() {
+		slot := -1
+		for i, vm := range ws.VMs {
+			if vm.ClaimToken == token {
+				slot = i
+			}
+		}
+		if slot < 0 {
+			continue
+		}
+		name = ws.Name
+		for _, vm := range ws.VMs {
+			if vm.ClaimedBy == user && vm.ClaimToken != token {
+				conflict = "You already claimed a VM in this workshop"
+			}
+		}
+		switch vm := &ws.VMs[slot]; {
+		case conflict != "":
+		case vm.ClaimedBy != "" && vm.ClaimedBy != user:
+			conflict = "This VM was already claimed by another participant"
+		case vm.AssignedTo != "" && !vm.assignedTo(user, email):
+			conflict = "This VM is reserved for another participant"
+		case vm.State != workshopVMReady:
+			conflict = "This VM is not ready yet"
+		default:
+			vm.ClaimedBy = user
+			vm.ClaimedAt = timeNow().UTC()
+			vmID = vm.VMID
+			if err := a.store.put(workshopCollection, ws.Name, ws); err != nil {
+				a.logger.Warn("Failed to record workshop claim", "workshop", ws.Name, "error", err)
+			}
+		}
+		break
+	}
+	a.workshopsMu.Unlock()
+
+	switch {
+	case name == "":
+		a.writeError(w, "Claim link not found", http.StatusNotFound)
+		return
+	case conflict != "":
+		a.writeError(w, conflict, http.StatusConflict)
+		return
+	}
+
+	a.setUserVM(user, vmID)
+	a.ctxLogger(r.Context()).Info("Claimed workshop VM", "workshop", name, "vmID", vmID, "userLogin", user)
+
+	// Relative to .../resources[/v1]/workshops/claim/{token} so it also works
+	// when Grafana is served from a sub-path; http.Redirect would resolve it
+	// against the resource path instead.
+	up := strings.Repeat("../", 6)
+	if apiVersionFromContext(r.Context()) != "" {
+		up += "../"
+	}
+	w.Header().Set("Location", up+"a/grafana-pathfinder-app")
+	w.WriteHeader(http.StatusSeeOther)
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newWorkshopTestApp(t *testing.T) (*App, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	created := 0
+	var deleted []string
+	app := newTestApp(t)
+	app.userVMs = map[string]string{}
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			var req CreateVMRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			created++
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(VM{ID: fmt.Sprintf("vm-%d", created), Template: req.Template, Owner: req.Owner, State: "pending"})
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(VM{ID: strings.TrimPrefix(r.URL.Path, "/api/v1/vms/"), Template: "vm-aws", State: "active"})
+		case http.MethodDelete:
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/v1/vms/"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return app, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), deleted...)
+	}
+}
+
+func TestAdminWorkshops_ProvisionAndClaim(t *testing.T) {
+	app, deleted := newWorkshopTestApp(t)
+
+	w := httptest.NewRecorder()
+	app.handleAdminWorkshops(w, roleRequest(http.MethodPost, "/admin/workshops", `{"name":"obs-101","count":3}`, "bob", "Editor"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", w.Code)
+	}
+	for _, body := range []string{`{"name":"Bad Name","count":3}`, `{"name":"obs-101","count":0}`, `{"name":"obs-101","count":101}`} {
+		w = httptest.NewRecorder()
+		app.handleAdminWorkshops(w, roleRequest(http.MethodPost, "/admin/workshops", body, "admin", "Admin"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", body, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.handleAdminWorkshops(w, roleRequest(http.MethodPost, "/admin/workshops", `{"name":"obs-101","count":3}`, "admin", "Admin"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	app.handleAdminWorkshops(w, roleRequest(http.MethodPost, "/admin/workshops", `{"name":"obs-101","count":1}`, "admin", "Admin"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate: status = %d", w.Code)
+	}
+
+	var info workshopInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for !info.Provisioned && time.Now().Before(deadline) {
+		w = httptest.NewRecorder()
+		app.handleAdminWorkshopByName(w, roleRequest(http.MethodGet, "/admin/workshops/obs-101", "", "admin", "Admin"))
+		_ = json.Unmarshal(w.Body.Bytes(), &info)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if info.Ready != 3 || len(info.ClaimLinks) != 3 {
+		t.Fatalf("workshop = %+v", info)
+	}
+
+	claim := func(link, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.handleWorkshopClaim(w, withUser(httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, pluginResourcesPath+"/"+apiVersion), nil), user))
+		return w
+	}
+	if w := claim(info.ClaimLinks[0], "alice"); w.Code != http.StatusSeeOther || !strings.HasSuffix(w.Header().Get("Location"), "/a/grafana-pathfinder-app") {
+		t.Fatalf("alice claim: status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := claim(info.ClaimLinks[0], "bob"); w.Code != http.StatusConflict {
+		t.Errorf("bob on alice's link: status = %d", w.Code)
+	}
+	if w := claim(info.ClaimLinks[1], "alice"); w.Code != http.StatusConflict {
+		t.Errorf("alice second claim: status = %d", w.Code)
+	}
+	if w := claim(pluginResourcesPath+"/workshops/claim/nope", "bob"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown token: status = %d", w.Code)
+	}
+
+	aliceVM := info.VMs[0].VMID
+	if app.userVMs["alice"] != aliceVM {
+		t.Errorf("userVMs[alice] = %q, want %q", app.userVMs["alice"], aliceVM)
+	}
+	if vm := app.workshopVMForUser(context.Background(), "alice", "", "vm-aws"); vm == nil || vm.ID != aliceVM {
+		t.Errorf("workshopVMForUser(alice) = %+v", vm)
+	}
+	if vm := app.workshopVMForUser(context.Background(), "bob", "", "vm-aws"); vm != nil {
+		t.Errorf("workshopVMForUser(bob) = %+v", vm)
+	}
+
+	w = httptest.NewRecorder()
+	app.handleAdminWorkshopByName(w, roleRequest(http.MethodDelete, "/admin/workshops/obs-101", "", "admin", "Admin"))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", w.Code)
+	}
+	if got := deleted(); len(got) != 3 {
+		t.Errorf("deleted VMs = %v", got)
+	}
+	if _, ok := app.userVMs["alice"]; ok {
+		t.Error("alice still mapped to a deleted workshop VM")
+	}
+}
+
+func TestAdminWorkshops_CreateAfterDispose(t *testing.T) {
+	app, _ := newWorkshopTestApp(t)
+	app.stopBackground()
+
+	w := httptest.NewRecorder()
+	app.handleAdminWorkshops(w, roleRequest(http.MethodPost, "/admin/workshops", `{"name":"obs-101","count":3}`, "admin", "Admin"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if _, ok := app.getWorkshop("obs-101"); ok {
+		t.Error("workshop kept after provisioning was refused")
+	}
+}
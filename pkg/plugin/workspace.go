@@ -0,0 +1,356 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Named persistent workspaces.
+//
+// A workspace is a user-owned, named pointer at a VM, persisted in the plugin
+// store so a learner working through a multi-part course reattaches to the same
+// environment across reconnects (and across plugin restarts when a storage
+// path is configured) instead of getting a fresh VM per nonce. The record
+// outlives its VM: when Coda expires the VM, the next connection provisions a
+// replacement from the stored template/config and re-points the workspace.
+//
+// Workspaces are selected over Grafana Live with a prefixed vmId segment:
+//
+//	terminal/workspace.{name}/{nonce}
+//
+// VMs bound to a workspace are exempt from the surplus/mismatch/quota cleanup
+// that resolveVMForUser applies to ordinary sandbox VMs.
+
+const (
+	workspaceCollection = "workspaces"
+
+	// workspaceChannelPrefix marks a Live channel vmId segment as a workspace
+	// name rather than a VM ID.
+	workspaceChannelPrefix = "workspace."
+
+	// maxUserWorkspaces leaves at least one quota slot free for ordinary
+	// sandbox connections.
+	maxUserWorkspaces = maxUserVMs - 1
+)
+
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// workspace is the persisted user → named VM mapping.
+type workspace struct {
+	Name       string                 `json:"name"`
+	Owner      string                 `json:"owner"`
+	Template   string                 `json:"template"`
+	Config     map[string]interface{} `json:"config,omitempty"`
+	VMID       string                 `json:"vmId,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	LastUsedAt time.Time              `json:"lastUsedAt,omitempty"`
+}
+
+// CreateWorkspaceRequest is the JSON body for POST /workspaces.
+type CreateWorkspaceRequest struct {
+	Name     string                 `json:"name" validate:"required,pattern=name"`
+	Template string                 `json:"template,omitempty" validate:"pattern=template"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+}
+
+var errWorkspaceNotFound = errors.New("workspace not found")
+
+func workspaceKey(owner, name string) string {
+	return owner + "/" + name
+}
+
+// workspaceOwnerLockKey is the workspaceLocks key for creating owner's
+// workspaces. Names are never empty, so it can't be a workspaceKey.
+func workspaceOwnerLockKey(owner string) string {
+	return owner + "/"
+}
+
+// workspaceLocks serialises resolving each workspace's VM, so two tabs opening
+// the same workspace share one VM, and creating each owner's workspaces, so
+// the name check and the limit hold (see workspaceOwnerLockKey).
+type workspaceLocks struct {
+	mu    sync.Mutex
+	locks map[string]*workspaceLock
+}
+
+type workspaceLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the function that unlocks it.
+func (l *workspaceLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*workspaceLock{}
+	}
+	wl := l.locks[key]
+	if wl == nil {
+		wl = &workspaceLock{}
+		l.locks[key] = wl
+	}
+	wl.refs++
+	l.mu.Unlock()
+
+	wl.Lock()
+	return func() {
+		wl.Unlock()
+		l.mu.Lock()
+		wl.refs--
+		if wl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// workspaceNameFromChannel returns the workspace name encoded in a Live channel
+// vmId segment, or "" when the segment addresses a VM directly.
+func workspaceNameFromChannel(vmSegment string) string {
+	if !strings.HasPrefix(vmSegment, workspaceChannelPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(vmSegment, workspaceChannelPrefix)
+}
+
+// getWorkspace loads one workspace owned by owner.
+func (a *App) getWorkspace(owner, name string) (*workspace, error) {
+	var ws workspace
+	ok, err := a.store.get(workspaceCollection, workspaceKey(owner, name), &ws)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errWorkspaceNotFound
+	}
+	return &ws, nil
+}
+
+// listWorkspaces returns every workspace owned by owner, sorted by name.
+func (a *App) listWorkspaces(owner string) []workspace {
+	prefix := owner + "/"
+	result := []workspace{}
+	for _, key := range a.store.keys(workspaceCollection) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var ws workspace
+		if ok, err := a.store.get(workspaceCollection, key, &ws); err != nil || !ok {
+			continue
+		}
+		result = append(result, ws)
+	}
+	return result
+}
+
+// workspaceVMIDs returns the set of VM IDs currently bound to owner's
+// workspaces. Used to exempt them from ordinary VM cleanup.
+func (a *App) workspaceVMIDs(owner string) map[string]bool {
+	ids := map[string]bool{}
+	if a.store == nil {
+		return ids
+	}
+	for _, ws := range a.listWorkspaces(owner) {
+		if ws.VMID != "" {
+			ids[ws.VMID] = true
+		}
+	}
+	return ids
+}
+
+// handleWorkspaces handles GET /workspaces (list) and POST /workspaces (create).
+func (a *App) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, map[string]interface{}{"workspaces": a.listWorkspaces(user)}, http.StatusOK)
+	case http.MethodPost:
+		a.handleCreateWorkspace(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) handleCreateWorkspace(w http.ResponseWriter, r *http.Request, user string) {
+	var req CreateWorkspaceRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Template == "" {
+		req.Template = "vm-aws"
+	}
+
+	unlock := a.workspaceLocks.lock(workspaceOwnerLockKey(user))
+	defer unlock()
+	if _, err := a.getWorkspace(user, req.Name); err == nil {
+		a.writeError(w, "Workspace already exists", http.StatusConflict)
+		return
+	}
+	if len(a.listWorkspaces(user)) >= maxUserWorkspaces {
+		a.writeError(w, fmt.Sprintf("Workspace limit reached (max %d)", maxUserWorkspaces), http.StatusTooManyRequests)
+		return
+	}
+
+	ws := workspace{
+		Name:      req.Name,
+		Owner:     user,
+		Template:  req.Template,
+		Config:    req.Config,
+		CreatedAt: timeNow().UTC(),
+	}
+	if err := a.store.put(workspaceCollection, workspaceKey(user, ws.Name), ws); err != nil {
+		a.ctxLogger(r.Context()).Error("Failed to persist workspace", "user", user, "workspace", ws.Name, "error", err)
+		a.writeError(w, "Failed to save workspace", http.StatusInternalServerError)
+		return
+	}
+	a.writeJSON(w, ws, http.StatusCreated)
+}
+
+// handleWorkspaceByName handles GET/DELETE /workspaces/{name}. DELETE removes
+// the record and, with ?destroyVm=true, also destroys the bound VM.
+func (a *App) handleWorkspaceByName(w http.ResponseWriter, r *http.Request) {
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/workspaces/")
+	if name == "" || strings.Contains(name, "/") {
+		a.writeError(w, "Workspace name required", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := a.getWorkspace(user, name)
+	if errors.Is(err, errWorkspaceNotFound) {
+		a.writeError(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.writeError(w, "Failed to load workspace", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.writeJSON(w, ws, http.StatusOK)
+	case http.MethodDelete:
+		if r.URL.Query().Get("destroyVm") == "true" && ws.VMID != "" && a.coda != nil {
+			if err := a.coda.DeleteVM(r.Context(), ws.VMID, true); err != nil && !isVMNotFoundError(err) {
+				a.ctxLogger(r.Context()).Warn("Failed to destroy workspace VM", "workspace", name, "vmID", ws.VMID, "error", err)
+			}
+		}
+		if err := a.store.delete(workspaceCollection, workspaceKey(user, name)); err != nil {
+			a.writeError(w, "Failed to delete workspace", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// resolveWorkspaceVM reattaches to the VM bound to the named workspace, or
+// provisions a replacement from the workspace's template when the bound VM is
+// gone or unusable. The workspace record is re-pointed and its lastUsedAt
+// bumped.
+func (a *App) resolveWorkspaceVM(ctx context.Context, sender *backend.StreamSender, userLogin, name string) (*VM, string, error) {
+	ctxLogger := a.ctxLogger(ctx)
+
+	unlock := a.workspaceLocks.lock(workspaceKey(userLogin, name))
+	defer unlock()
+
+	ws, err := a.getWorkspace(userLogin, name)
+	if err != nil {
+		errMsg := fmt.Sprintf("Workspace %q not found", name)
+		sendStreamError(ctx, sender, errMsg)
+		return nil, "", errors.New(errMsg)
+	}
+
+	if ws.VMID != "" {
+		vm, getErr := a.getVMWithRetry(ctx, ws.VMID)
+		switch {
+		case getErr == nil && isUsableState(vm.State):
+			ctxLogger.Info("Reattaching to workspace VM", "userLogin", userLogin, "workspace", name, "vmID", ws.VMID, "state", vm.State)
+			sendStreamStatusWithVmId(sender, vm.State, fmt.Sprintf("Reconnecting to workspace %q...", name), ws.VMID)
+			a.touchWorkspace(ws, ws.VMID)
+			return vm, ws.VMID, nil
+		case getErr != nil && !isVMNotFoundError(getErr):
+			errMsg := fmt.Sprintf("Failed to look up workspace VM: %v", getErr)
+			sendStreamError(ctx, sender, errMsg)
+			return nil, "", errors.New(errMsg)
+		case getErr == nil:
+			ctxLogger.Info("Workspace VM is unusable, replacing it", "workspace", name, "vmID", ws.VMID, "state", vm.State)
+			a.releaseWorkspaceVM(ctx, vm)
+		default:
+			ctxLogger.Info("Workspace VM is gone, provisioning replacement", "workspace", name, "vmID", ws.VMID)
+			a.forgetVM(ws.VMID)
+			a.forgetVMActivity(ws.VMID)
+		}
+		a.touchWorkspace(ws, "")
+	}
+
+	count, countErr := a.coda.CountVMsForUser(ctx, userLogin)
+	if countErr == nil && count >= maxUserVMs {
+		errMsg := fmt.Sprintf("VM quota exceeded: you already have %d VMs (max %d), please wait for existing VMs to expire", count, maxUserVMs)
+		sendStreamError(ctx, sender, errMsg)
+		return nil, "", errors.New(errMsg)
+	}
+
+	if err := a.featureError(featureVMProvisioning); err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return nil, "", err
+	}
+	if err := a.checkOrgQuota(); err != nil {
+		sendStreamError(ctx, sender, err.Error())
+		return nil, "", err
+	}
+
+	sendStreamStatusWithVmId(sender, "provisioning", fmt.Sprintf("Provisioning workspace %q...", name), "")
+	vm, err := a.coda.CreateVM(ctx, ws.Template, userLogin, ws.Config)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to create VM: %v", err)
+		sendStreamError(ctx, sender, errMsg)
+		return nil, "", fmt.Errorf("failed to create workspace VM: %w", err)
+	}
+	a.recordVMProvisioned(ctxLogger)
+
+	a.touchWorkspace(ws, vm.ID)
+	ctxLogger.Info("Workspace VM created", "userLogin", userLogin, "workspace", name, "vmID", vm.ID)
+	sendStreamStatusWithVmId(sender, vm.State, "VM allocated, waiting for boot...", vm.ID)
+	return vm, vm.ID, nil
+}
+
+// releaseWorkspaceVM destroys a workspace VM that can no longer serve a
+// connection and stops tracking it.
+func (a *App) releaseWorkspaceVM(ctx context.Context, vm *VM) {
+	if err := a.coda.DeleteVM(ctx, vm.ID, true); err != nil && !isVMNotFoundError(err) {
+		a.ctxLogger(ctx).Warn("Failed to destroy unusable workspace VM", "vmID", vm.ID, "error", err)
+	}
+	a.forgetVM(vm.ID)
+	a.forgetVMActivity(vm.ID)
+	a.releaseVMProvisioned(a.ctxLogger(ctx), vm)
+}
+
+// touchWorkspace binds ws to vmID and records the use. Best-effort: a failed
+// write only costs continuity on the next connection.
+func (a *App) touchWorkspace(ws *workspace, vmID string) {
+	ws.VMID = vmID
+	ws.LastUsedAt = timeNow().UTC()
+	if err := a.store.put(workspaceCollection, workspaceKey(ws.Owner, ws.Name), ws); err != nil {
+		a.logger.Warn("Failed to update workspace", "workspace", ws.Name, "error", err)
+	}
+}
@@ -0,0 +1,210 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func workspaceRequest(method, target, body, user string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if user != "" {
+		r = withUser(r, user)
+	}
+	return r
+}
+
+func TestWorkspaceNameFromChannel(t *testing.T) {
+	cases := map[string]string{
+		"workspace.lab": "lab",
+		"workspace.":    "",
+		"new":           "",
+		"vm-123":        "",
+	}
+	for in, want := range cases {
+		if got := workspaceNameFromChannel(in); got != want {
+			t.Errorf("workspaceNameFromChannel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHandleWorkspaces_RequiresUser(t *testing.T) {
+	app := newTestApp(t)
+	rr := httptest.NewRecorder()
+	app.handleWorkspaces(rr, workspaceRequest(http.MethodGet, "/workspaces", "", ""))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("got %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandleWorkspaces_CreateListDelete(t *testing.T) {
+	app := newTestApp(t)
+
+	rr := httptest.NewRecorder()
+	app.handleWorkspaces(rr, workspaceRequest(http.MethodPost, "/workspaces", `{"name":"course-1"}`, "alice"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var created workspace
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.Template != "vm-aws" || created.Owner != "alice" {
+		t.Errorf("created = %+v, want default template owned by alice", created)
+	}
+
+	// Duplicate name conflicts.
+	rr = httptest.NewRecorder()
+	app.handleWorkspaces(rr, workspaceRequest(http.MethodPost, "/workspaces", `{"name":"course-1"}`, "alice"))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("duplicate create: got %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	// Other users don't see alice's workspace.
+	rr = httptest.NewRecorder()
+	app.handleWorkspaces(rr, workspaceRequest(http.MethodGet, "/workspaces", "", "bob"))
+	var bobList struct {
+		Workspaces []workspace `json:"workspaces"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &bobList)
+	if len(bobList.Workspaces) != 0 {
+		t.Errorf("bob sees %d workspaces, want 0", len(bobList.Workspaces))
+	}
+	rr = httptest.NewRecorder()
+	app.handleWorkspaceByName(rr, workspaceRequest(http.MethodGet, "/workspaces/course-1", "", "bob"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("bob get: got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	rr = httptest.NewRecorder()
+	app.handleWorkspaceByName(rr, workspaceRequest(http.MethodDelete, "/workspaces/course-1", "", "alice"))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d", rr.Code)
+	}
+	if n := len(app.listWorkspaces("alice")); n != 0 {
+		t.Errorf("alice has %d workspaces after delete, want 0", n)
+	}
+}
+
+func TestHandleWorkspaces_Validation(t *testing.T) {
+	app := newTestApp(t)
+	for _, body := range []string{`not json`, `{"name":""}`, `{"name":"Has Spaces"}`, `{"name":"../x"}`} {
+		rr := httptest.NewRecorder()
+		app.handleWorkspaces(rr, workspaceRequest(http.MethodPost, "/workspaces", body, "alice"))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("body %s: got %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleWorkspaces_Limit(t *testing.T) {
+	app := newTestApp(t)
+	for i := 0; i < maxUserWorkspaces; i++ {
+		rr := httptest.NewRecorder()
+		body := `{"name":"ws-` + string(rune('a'+i)) + `"}`
+		app.handleWorkspaces(rr, workspaceRequest(http.MethodPost, "/workspaces", body, "alice"))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("create %d: got %d", i, rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	app.handleWorkspaces(rr, workspaceRequest(http.MethodPost, "/workspaces", `{"name":"one-too-many"}`, "alice"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("over limit: got %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestHandleWorkspaces_ConcurrentCreate(t *testing.T) {
+	app := newTestApp(t)
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 2 * maxUserWorkspaces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Half the requests reuse a name, so both checks are raced.
+			body := fmt.Sprintf(`{"name":"lab-%d"}`, i/2)
+			rr := httptest.NewRecorder()
+			app.handleWorkspaces(rr, workspaceRequest(http.MethodPost, "/workspaces", body, "alice"))
+			if rr.Code == http.StatusCreated {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(app.listWorkspaces("alice")); n != int(created.Load()) || n != maxUserWorkspaces {
+		t.Errorf("created %d, stored %d workspaces, want %d", created.Load(), n, maxUserWorkspaces)
+	}
+}
+
+func TestWorkspaceVMIDs(t *testing.T) {
+	app := newTestApp(t)
+	_ = app.store.put(workspaceCollection, workspaceKey("alice", "a"), workspace{Name: "a", Owner: "alice", VMID: "vm-1"})
+	_ = app.store.put(workspaceCollection, workspaceKey("alice", "b"), workspace{Name: "b", Owner: "alice"})
+	_ = app.store.put(workspaceCollection, workspaceKey("bob", "a"), workspace{Name: "a", Owner: "bob", VMID: "vm-2"})
+
+	ids := app.workspaceVMIDs("alice")
+	if len(ids) != 1 || !ids["vm-1"] {
+		t.Errorf("workspaceVMIDs(alice) = %v, want {vm-1}", ids)
+	}
+}
+
+func TestResolveWorkspaceVM_ReplacesUnusableVMOnce(t *testing.T) {
+	app := newTestApp(t)
+	app.userVMs = map[string]string{"alice": "vm-old"}
+	_ = app.store.put(workspaceCollection, workspaceKey("alice", "lab"), workspace{Name: "lab", Owner: "alice", Template: "vm-aws", VMID: "vm-old"})
+	app.recordVMProvisioned(app.logger)
+
+	var created, deleted atomic.Int32
+	app.coda = newTestCodaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/vms/vm-old":
+			_ = json.NewEncoder(w).Encode(VM{ID: "vm-old", State: "error", CreatedAt: time.Now()})
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/vms/vm-new":
+			_ = json.NewEncoder(w).Encode(VM{ID: "vm-new", State: "provisioning"})
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/vms":
+			_, _ = w.Write([]byte(`{"vms":[]}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/vms/vm-old":
+			deleted.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/vms":
+			created.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(VM{ID: "vm-new", State: "provisioning"})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, sender := newStreamRecorder(t)
+			if _, vmID, err := app.resolveWorkspaceVM(context.Background(), sender, "alice", "lab"); err != nil || vmID != "vm-new" {
+				t.Errorf("resolveWorkspaceVM = %q, %v; want vm-new", vmID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created.Load() != 1 || deleted.Load() != 1 {
+		t.Errorf("created %d and deleted %d VMs, want 1 each", created.Load(), deleted.Load())
+	}
+	if _, ok := app.userVMs["alice"]; ok {
+		t.Error("alice is still assigned the unusable VM")
+	}
+	if usage := app.currentOrgUsage(); usage.VMCount != 1 {
+		t.Errorf("org VM count = %d, want 1 (the replacement only)", usage.VMCount)
+	}
+	if ws, _ := app.getWorkspace("alice", "lab"); ws.VMID != "vm-new" {
+		t.Errorf("workspace VM = %q, want vm-new", ws.VMID)
+	}
+}
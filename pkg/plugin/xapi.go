@@ -0,0 +1,337 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/config"
+)
+
+// xAPI statements for LMS integration.
+//
+// When Settings.XAPIEndpoint is set, learning events are sent to that
+// Learning Record Store as xAPI 1.0.3 statements: "experienced" when a
+// guide is opened (POST /history without stepIndex), "completed" when a
+// completion is recorded (POST /learning-activity) and "scored" for quiz
+// results (POST /learning-activity/quiz). The actor is the learner's
+// employee ID, as an account on xapiAccountHomePage, or their email when
+// only that is known (see identities.go); otherwise the Grafana login, as
+// an account on the instance's URL. Guides and quizzes are activities
+// under xapiActivityBase, so the same guide has the same activity ID on
+// every stack.
+//
+// Like Loki export, this is best-effort: statements are buffered and posted
+// in batches by one goroutine, and dropped when the LRS can't keep up.
+
+const (
+	xapiVersion       = "1.0.3"
+	xapiActivityBase  = "https://grafana.com/pathfinder/guides/"
+	xapiBufferSize    = 1024
+	xapiBatchSize     = 50
+	xapiFlushInterval = 5 * time.Second
+	xapiPostTimeout   = 10 * time.Second
+
+	// homePage for actors when the instance URL is unknown.
+	xapiDefaultHomePage = "https://grafana.com"
+)
+
+var (
+	xapiVerbExperienced = xapiVerb{ID: "http://adlnet.gov/expapi/verbs/experienced", Display: map[string]string{"en-US": "experienced"}}
+	xapiVerbCompleted   = xapiVerb{ID: "http://adlnet.gov/expapi/verbs/completed", Display: map[string]string{"en-US": "completed"}}
+	xapiVerbScored      = xapiVerb{ID: "http://adlnet.gov/expapi/verbs/scored", Display: map[string]string{"en-US": "scored"}}
+)
+
+type xapiAccount struct {
+	HomePage string `json:"homePage"`
+	Name     string `json:"name"`
+}
+
+type xapiAgent struct {
+	ObjectType string       `json:"objectType"`
+	Name       string       `json:"name,omitempty"`
+	Mbox       string       `json:"mbox,omitempty"`
+	Account    *xapiAccount `json:"account,omitempty"`
+}
+
+type xapiVerb struct {
+	ID      string            `json:"id"`
+	Display map[string]string `json:"display"`
+}
+
+type xapiActivityDefinition struct {
+	Name map[string]string `json:"name,omitempty"`
+	Type string            `json:"type"`
+}
+
+type xapiActivity struct {
+	ObjectType string                 `json:"objectType"`
+	ID         string                 `json:"id"`
+	Definition xapiActivityDefinition `json:"definition"`
+}
+
+type xapiScore struct {
+	Scaled float64 `json:"scaled"`
+	Raw    int     `json:"raw"`
+	Min    int     `json:"min"`
+	Max    int     `json:"max"`
+}
+
+type xapiResult struct {
+	Score      *xapiScore `json:"score,omitempty"`
+	Success    *bool      `json:"success,omitempty"`
+	Completion *bool      `json:"completion,omitempty"`
+}
+
+type xapiStatement struct {
+	Actor     xapiAgent    `json:"actor"`
+	Verb      xapiVerb     `json:"verb"`
+	Object    xapiActivity `json:"object"`
+	Result    *xapiResult  `json:"result,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// guideActivity returns the xAPI activity for a guide.
+func guideActivity(guideID, title string) xapiActivity {
+	act := xapiActivity{
+		ObjectType: "Activity",
+		ID:         xapiActivityBase + guideID,
+		Definition: xapiActivityDefinition{Type: "http://adlnet.gov/expapi/activities/lesson"},
+	}
+	if title != "" {
+		act.Definition.Name = map[string]string{"en-US": title}
+	}
+	return act
+}
+
+// quizActivity returns the xAPI activity for a quiz in a guide.
+func quizActivity(guideID, quizID string) xapiActivity {
+	return xapiActivity{
+		ObjectType: "Activity",
+		ID:         xapiActivityBase + guideID + "/quizzes/" + quizID,
+		Definition: xapiActivityDefinition{Type: "http://adlnet.gov/expapi/activities/assessment"},
+	}
+}
+
+// xapiActor returns the agent for user, identified by their external
+// identity when there is one.
+func (a *App) xapiActor(ctx context.Context, user string) xapiAgent {
+	agent := xapiAgent{ObjectType: "Agent"}
+	if u := backend.PluginConfigFromContext(ctx).User; u != nil {
+		agent.Name = u.Name
+	}
+	homePage := xapiDefaultHomePage
+	if cfg := config.GrafanaConfigFromContext(ctx); cfg != nil {
+		if appURL, err := cfg.AppURL(); err == nil && appURL != "" {
+			homePage = strings.TrimSuffix(appURL, "/")
+		}
+	}
+	id, _ := a.identity(user)
+	switch {
+	case id.EmployeeID != "":
+		if a.settings != nil && a.settings.XAPIAccountHomePage != "" {
+			homePage = a.settings.XAPIAccountHomePage
+		}
+		agent.Account = &xapiAccount{HomePage: homePage, Name: id.EmployeeID}
+	case id.Email != "":
+		agent.Mbox = "mailto:" + id.Email
+	default:
+		agent.Account = &xapiAccount{HomePage: homePage, Name: user}
+	}
+	return agent
+}
+
+// emitXAPI queues a statement by user when an LRS is configured.
+func (a *App) emitXAPI(ctx context.Context, user string, verb xapiVerb, object xapiActivity, result *xapiResult) {
+	if a.xapi == nil {
+		return
+	}
+	a.xapi.emit(xapiStatement{Actor: a.xapiActor(ctx, user), Verb: verb, Object: object, Result: result, Timestamp: timeNow().UTC()})
+}
+
+// xapiEmitter batches statements and posts them to the LRS. A nil emitter
+// is a valid no-op.
+type xapiEmitter struct {
+	statementsURL string
+	user          string
+	password      string
+	client        *http.Client
+	logger        log.Logger
+
+	// mu guards closed so emit never sends on a closed channel.
+	mu         sync.RWMutex
+	closed     bool
+	statements chan xapiStatement
+	done       chan struct{}
+
+	dropMu  sync.Mutex
+	dropped int
+}
+
+// newXAPIEmitter returns an emitter for settings, or nil when no LRS is
+// configured.
+func newXAPIEmitter(settings *Settings, logger log.Logger) *xapiEmitter {
+	if settings == nil || settings.XAPIEndpoint == "" {
+		return nil
+	}
+	e := &xapiEmitter{
+		statementsURL: strings.TrimSuffix(settings.XAPIEndpoint, "/") + "/statements",
+		user:          settings.XAPIUser,
+		password:      settings.XAPIPassword,
+		client:        &http.Client{Timeout: xapiPostTimeout},
+		logger:        logger,
+		statements:    make(chan xapiStatement, xapiBufferSize),
+		done:          make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// emit queues a statement.
+func (e *xapiEmitter) emit(st xapiStatement) {
+	if e == nil {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.statements <- st:
+	default:
+		e.dropMu.Lock()
+		e.dropped++
+		e.dropMu.Unlock()
+	}
+}
+
+// close flushes buffered statements and stops the emitter.
+func (e *xapiEmitter) close() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.statements)
+	}
+	e.mu.Unlock()
+	<-e.done
+}
+
+func (e *xapiEmitter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(xapiFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]xapiStatement, 0, xapiBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(context.Background(), batch); err != nil {
+			e.logger.Warn("Failed to send xAPI statements", "statements", len(batch), "error", err)
+		}
+		batch = batch[:0]
+
+		e.dropMu.Lock()
+		dropped := e.dropped
+		e.dropped = 0
+		e.dropMu.Unlock()
+		if dropped > 0 {
+			e.logger.Warn("Dropped xAPI statements, buffer full", "dropped", dropped)
+		}
+	}
+
+	for {
+		select {
+		case st, ok := <-e.statements:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, st)
+			if len(batch) >= xapiBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// post sends statements to the LRS in one request.
+func (e *xapiEmitter) post(ctx context.Context, statements []xapiStatement) error {
+	body, err := json.Marshal(statements)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, xapiPostTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.statementsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Experience-API-Version", xapiVersion)
+	if e.user != "" || e.password != "" {
+		req.SetBasicAuth(e.user, e.password)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("LRS returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// QuizResultRequest is the JSON body for POST /learning-activity/quiz.
+type QuizResultRequest struct {
+	GuideID  string `json:"guideId" validate:"required,pattern=guideId"`
+	QuizID   string `json:"quizId" validate:"required,pattern=guideId"`
+	Score    int    `json:"score" validate:"min=0,max=1000"`
+	MaxScore int    `json:"maxScore" validate:"required,min=1,max=1000"`
+	Passed   bool   `json:"passed"`
+}
+
+// handleQuizResult handles POST /learning-activity/quiz. Quiz results
+// aren't stored; they're only sent to the LRS as "scored" statements.
+func (a *App) handleQuizResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := userLoginFromContext(r.Context())
+	if user == "" {
+		a.writeError(w, "Could not identify Grafana user for this request", http.StatusUnauthorized)
+		return
+	}
+	var req QuizResultRequest
+	if !a.decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Score > req.MaxScore {
+		a.writeError(w, "Invalid request body: score must not exceed maxScore", http.StatusBadRequest)
+		return
+	}
+	completion := true
+	a.emitXAPI(r.Context(), user, xapiVerbScored, quizActivity(req.GuideID, req.QuizID), &xapiResult{
+		Score:      &xapiScore{Scaled: float64(req.Score) / float64(req.MaxScore), Raw: req.Score, Max: req.MaxScore},
+		Success:    &req.Passed,
+		Completion: &completion,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
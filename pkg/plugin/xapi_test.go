@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestXAPIStatements(t *testing.T) {
+	var mu sync.Mutex
+	var got []xapiStatement
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/xapi/statements" || r.Header.Get("X-Experience-API-Version") != xapiVersion || user != "lrs" || pass != "secret" {
+			t.Errorf("request %s version=%q auth=%s:%s", r.URL.Path, r.Header.Get("X-Experience-API-Version"), user, pass)
+		}
+		var batch []xapiStatement
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		got = append(got, batch...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	app := newTestApp(t)
+	app.xapi = newXAPIEmitter(&Settings{XAPIEndpoint: srv.URL + "/xapi/", XAPIUser: "lrs", XAPIPassword: "secret"}, app.logger)
+	withFrozenTime(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	serve := func(h http.HandlerFunc, target, body string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(w, roleRequest(http.MethodPost, target, body, "alice", "Viewer"))
+		return w.Code
+	}
+
+	serve(app.handleHistory, "/history", `{"guideId": "alerting-101", "title": "Alerting 101"}`)
+	serve(app.handleHistory, "/history", `{"guideId": "alerting-101", "stepIndex": 2}`)
+	serve(app.handleLearningActivity, "/learning-activity", `{"guideId": "alerting-101"}`)
+	if code := serve(app.handleQuizResult, "/learning-activity/quiz", `{"guideId": "alerting-101", "quizId": "q1", "score": 3, "maxScore": 4, "passed": true}`); code != http.StatusNoContent {
+		t.Fatalf("quiz: status %d", code)
+	}
+	if code := serve(app.handleQuizResult, "/learning-activity/quiz", `{"guideId": "alerting-101", "quizId": "q1", "score": 5, "maxScore": 4}`); code != http.StatusBadRequest {
+		t.Errorf("score over max: status %d, want 400", code)
+	}
+	app.xapi.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 {
+		t.Fatalf("statements = %+v, want 3", got)
+	}
+	wantVerbs := []string{xapiVerbExperienced.ID, xapiVerbCompleted.ID, xapiVerbScored.ID}
+	for i, st := range got {
+		if st.Verb.ID != wantVerbs[i] || st.Actor.Account.Name != "alice" || st.Actor.Account.HomePage != xapiDefaultHomePage {
+			t.Errorf("statement %d = %+v", i, st)
+		}
+	}
+	if got[0].Object.ID != xapiActivityBase+"alerting-101" || got[0].Object.Definition.Name["en-US"] != "Alerting 101" {
+		t.Errorf("guide activity = %+v", got[0].Object)
+	}
+	quiz := got[2]
+	if quiz.Object.ID != xapiActivityBase+"alerting-101/quizzes/q1" || quiz.Result == nil || quiz.Result.Score.Scaled != 0.75 || !*quiz.Result.Success {
+		t.Errorf("quiz statement = %+v", quiz)
+	}
+}
@@ -26,6 +26,12 @@ import { config, getBackendSrv } from '@grafana/runtime';
 
 type JsonData = DocsPluginConfig;
 
+type KeyValidation = {
+  status: 'valid' | 'invalid' | 'expired' | 'error';
+  expiresAt?: string;
+  message?: string;
+};
+
 type State = {
   recommenderServiceUrl: string;
   tutorialUrl: string;
@@ -77,6 +83,8 @@ const ConfigurationForm = ({ plugin }: ConfigurationFormProps) => {
   const hasProvisionedKey = plugin.meta.secureJsonFields?.codaEnrollmentKey ?? false;
   const [isRegistering, setIsRegistering] = useState(false);
   const [registrationError, setRegistrationError] = useState<string | null>(null);
+  const [isValidatingKey, setIsValidatingKey] = useState(false);
+  const [keyValidation, setKeyValidation] = useState<KeyValidation | null>(null);
   const autoRegisterAttempted = useRef(false);
 
   // SECURITY: Dev mode - hybrid approach (jsonData storage, multi-user ID scoping)
@@ -209,6 +217,28 @@ const ConfigurationForm = ({ plugin }: ConfigurationFormProps) => {
       codaEnrollmentKey: event.target.value,
     });
     setRegistrationError(null);
+    setKeyValidation(null);
+  };
+
+  const onValidateEnrollmentKey = async () => {
+    setIsValidatingKey(true);
+    setKeyValidation(null);
+    try {
+      const response = await getBackendSrv().post(
+        `${PLUGIN_BACKEND_URL}/coda/validate-key`,
+        { enrollmentKey: state.codaEnrollmentKey, codaApiUrl: state.codaApiUrl },
+        { showErrorAlert: false }
+      );
+      setKeyValidation({ status: response.status, expiresAt: response.expiresAt });
+    } catch (error) {
+      logger.error('Failed to validate enrollment key', { error });
+      const message =
+        (error as { data?: { error?: string } })?.data?.error ??
+        (error instanceof Error ? error.message : 'Could not reach Coda');
+      setKeyValidation({ status: 'error', message });
+    } finally {
+      setIsValidatingKey(false);
+    }
   };
 
   const onChangeCodaApiUrl = (event: ChangeEvent<HTMLInputElement>) => {
@@ -801,6 +831,42 @@ const ConfigurationForm = ({ plugin }: ConfigurationFormProps) => {
                     />
                   </Field>
 
+                  <div style={{ display: 'flex', alignItems: 'center', gap: '8px' }}>
+                    <Button
+                      type="button"
+                      variant="secondary"
+                      size="sm"
+                      data-testid={testIds.appConfig.codaValidateKey}
+                      onClick={onValidateEnrollmentKey}
+                      disabled={
+                        isValidatingKey ||
+                        isSaving ||
+                        !state.codaApiUrl ||
+                        (!state.codaEnrollmentKey && !hasProvisionedKey)
+                      }
+                    >
+                      {isValidatingKey ? 'Checking...' : 'Check key'}
+                    </Button>
+                    {keyValidation?.status === 'valid' && (
+                      <Badge
+                        color="green"
+                        icon="check"
+                        text={
+                          keyValidation.expiresAt
+                            ? `Valid until ${new Date(keyValidation.expiresAt).toLocaleString()}`
+                            : 'Valid'
+                        }
+                      />
+                    )}
+                    {keyValidation?.status === 'invalid' && <Badge color="red" icon="times" text="Invalid key" />}
+                    {keyValidation?.status === 'expired' && (
+                      <Badge color="orange" icon="clock-nine" text="Expired key" />
+                    )}
+                    {keyValidation?.status === 'error' && (
+                      <Badge color="red" icon="exclamation-triangle" text={keyValidation.message ?? 'Check failed'} />
+                    )}
+                  </div>
+
                   {registrationError && (
                     <Alert severity="error" title="Registration failed" className={s.marginTop}>
                       <Text variant="body">{registrationError}</Text>
@@ -12,6 +12,7 @@ import { css } from '@emotion/css';
 import { BLOCK_TYPE_METADATA, BLOCK_TYPE_ORDER, BLOCK_TYPE_GROUPS } from './constants';
 import { getConfigWithDefaults } from '../../constants';
 import { testIds } from '../../constants/testIds';
+import { useBackendFeatures } from '../../lib/backend-features-client';
 import type { BlockType, OnBlockTypeSelect } from './types';
 
 const CODA_BLOCK_TYPES: BlockType[] = ['terminal', 'terminal-connect'];
@@ -272,12 +273,14 @@ export function BlockPalette({
     return compact ? styles.triggerCompact : styles.trigger;
   };
 
+  const backendFeatures = useBackendFeatures();
+
   const effectiveExcludeTypes = useMemo(() => {
-    if (pluginConfig.enableCodaTerminal) {
+    if (pluginConfig.enableCodaTerminal && backendFeatures.terminal) {
       return excludeTypes;
     }
     return [...excludeTypes, ...CODA_BLOCK_TYPES];
-  }, [excludeTypes, pluginConfig.enableCodaTerminal]);
+  }, [excludeTypes, pluginConfig.enableCodaTerminal, backendFeatures.terminal]);
 
   const availableTypes = BLOCK_TYPE_ORDER.filter((type) => !effectiveExcludeTypes.includes(type));
 
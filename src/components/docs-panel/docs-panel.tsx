@@ -36,6 +36,7 @@ import {
   AnalyticsContentType,
 } from '../../lib/analytics';
 import { logger } from '../../lib/logging';
+import { useBackendFeatures } from '../../lib/backend-features-client';
 import { withGuideOpenAction, type GuideLoadOutcome } from '../../lib/telemetry';
 import { usePanelReadyMeasurement } from './hooks/usePanelReadyMeasurement';
 import { tabStorage, useUserStorage } from '../../lib/user-storage';
@@ -808,6 +809,7 @@ function CombinedPanelRendererInner({ model }: SceneComponentProps<CombinedLearn
   // SECURITY: Dev mode - hybrid approach (synchronous check with user ID scoping)
   const currentUserId = config.bootData.user?.id;
   const isDevMode = isDevModeEnabled(pluginConfig, currentUserId);
+  const backendFeatures = useBackendFeatures();
 
   const currentUser = config.bootData?.user;
   const isEditorUser =
@@ -1305,7 +1307,7 @@ function CombinedPanelRendererInner({ model }: SceneComponentProps<CombinedLearn
       />
 
       {/* Coda Terminal Panel - only shown in dev mode with terminal feature enabled */}
-      {isDevMode && pluginConfig.enableCodaTerminal && (
+      {isDevMode && pluginConfig.enableCodaTerminal && backendFeatures.terminal && (
         <Suspense fallback={null}>
           <TerminalPanel />
         </Suspense>
@@ -23,7 +23,7 @@ import { useTerminalContext } from '../../integrations/coda/TerminalContext';
 import { checkPostconditions } from '../../requirements-manager';
 import { markStepCompleted, useStepCompletion } from '../../global-state/completion-store';
 
-const CODA_EXEC_URL = '/api/plugins/grafana-pathfinder-app/resources/coda/exec';
+const CODA_EXEC_URL = '/api/plugins/grafana-pathfinder-app/resources/v1/coda/exec';
 // /tmp/pathfinder-ready matches codaSentinelPath in the Go backend. The
 // atomic temp+rename guarantees the gated coda-exit-zero check never sees a
 // partially-written sentinel.
@@ -12,6 +12,7 @@ import { GrafanaTheme2 } from '@grafana/data';
 import { css } from '@emotion/css';
 
 import { useTerminalContext } from '../../integrations/coda/TerminalContext';
+import { useGuideResponsesOptional } from '../../docs-retrieval';
 import { STEP_STATES, type StepStateValue } from './step-states';
 import { markStepCompleted, useStepCompletion } from '../../global-state/completion-store';
 
@@ -108,6 +109,7 @@ export const TerminalConnectStep = forwardRef<
   ) => {
     const styles = useStyles2(getStyles);
     const terminalCtx = useTerminalContext();
+    const guideId = useGuideResponsesOptional()?.guideId;
 
     const generatedStepIdRef = useRef<string | undefined>(undefined);
     if (!generatedStepIdRef.current) {
@@ -141,9 +143,13 @@ export const TerminalConnectStep = forwardRef<
       }
 
       setIsConnecting(true);
-      const vmOpts = vmTemplate ? { template: vmTemplate, app: vmApp, scenario: vmScenario } : undefined;
+      const vmOpts = vmTemplate
+        ? { template: vmTemplate, app: vmApp, scenario: vmScenario }
+        : guideId
+          ? { guide: guideId }
+          : undefined;
       terminalCtx.openTerminal(vmOpts);
-    }, [terminalCtx, vmTemplate, vmApp, vmScenario]);
+    }, [terminalCtx, vmTemplate, vmApp, vmScenario, guideId]);
 
     // React to terminal status changes while waiting for connection.
     // Handles: success (connected), failure (error), and cancellation (disconnected).
@@ -193,6 +193,7 @@ export const testIds = {
     codaApiUrl: 'config-coda-api-url',
     codaRelayUrl: 'config-coda-relay-url',
     codaEnrollmentKey: 'config-coda-enrollment-key',
+    codaValidateKey: 'config-coda-validate-key',
     // Interactive Features
     interactiveFeatures: {
       toggle: 'config-interactive-auto-detection-toggle',
@@ -144,12 +144,17 @@ export function TerminalProvider({ children }: TerminalProviderProps) {
       const requestedTemplate = vmOpts?.template || '';
       const requestedApp = vmOpts?.app || '';
       const requestedScenario = vmOpts?.scenario || '';
+      const requestedGuide = vmOpts?.guide || '';
       const activeTemplate = activeVmOptsRef.current?.template || '';
       const activeApp = activeVmOptsRef.current?.app || '';
       const activeScenario = activeVmOptsRef.current?.scenario || '';
+      const activeGuide = activeVmOptsRef.current?.guide || '';
       const needsReconnect =
         !needsConnect &&
-        (requestedTemplate !== activeTemplate || requestedApp !== activeApp || requestedScenario !== activeScenario);
+        (requestedTemplate !== activeTemplate ||
+          requestedApp !== activeApp ||
+          requestedScenario !== activeScenario ||
+          (!requestedTemplate && requestedGuide !== activeGuide));
 
       if (needsReconnect) {
         reconnectingRef.current = true;
@@ -62,7 +62,7 @@ export function TerminalPanel({ onClose }: TerminalPanelProps) {
   const [searchQuery, setSearchQuery] = useState('');
 
   // Grafana Live connection - pass ref, not current value (React hooks/refs rule)
-  const { status, connect, disconnect, resize, sendCommand, error } = useTerminalLive({
+  const { status, connect, disconnect, resize, sendCommand, error, health, lagging } = useTerminalLive({
     terminalRef: terminalInstanceRef,
   });
 
@@ -380,7 +380,10 @@ export function TerminalPanel({ onClose }: TerminalPanelProps) {
   const getStatusDotClass = (s: ConnectionStatus) => {
     switch (s) {
       case 'connected':
-        return styles.statusConnected;
+        if (health?.status === 'unreachable') {
+          return styles.statusError;
+        }
+        return health?.status === 'degraded' || lagging ? styles.statusConnecting : styles.statusConnected;
       case 'connecting':
         return styles.statusConnecting;
       case 'error':
@@ -393,6 +396,15 @@ export function TerminalPanel({ onClose }: TerminalPanelProps) {
   const getStatusText = (s: ConnectionStatus) => {
     switch (s) {
       case 'connected':
+        if (health?.status === 'unreachable') {
+          return 'Connected - VM not responding';
+        }
+        if (health?.status === 'degraded') {
+          return `Connected - VM under pressure (${health.reasons?.join(', ') || 'degraded'})`;
+        }
+        if (lagging) {
+          return 'Connected - connection falling behind, output paused';
+        }
         return 'Connected';
       case 'connecting':
         return 'Connecting...';
@@ -58,6 +58,24 @@ export interface TerminalVMOptions {
   app?: string;
   /** Scenario name for alloy-scenario templates */
   scenario?: string;
+  /** Guide ID; when no template is set, the backend uses the guide's mapped template */
+  guide?: string;
+}
+
+/** VM health probe result (sent by the backend every 30s while connected) */
+export interface VMHealth {
+  status: 'ok' | 'degraded' | 'unreachable';
+  cpuPercent?: number;
+  memoryUsedPercent?: number;
+  diskUsedPercent?: number;
+  load1?: number;
+  sshLatencyMs: number;
+  reasons?: string[];
+}
+
+/** Grafana Live channel segments only allow [A-Za-z0-9_=.-]. */
+function toChannelSegment(value: string): string {
+  return value.replace(/[^A-Za-z0-9_=.-]/g, '-');
 }
 
 interface UseTerminalLiveReturn {
@@ -73,18 +91,57 @@ interface UseTerminalLiveReturn {
   sendCommand: (command: string) => Promise<void>;
   /** Error message if status is 'error' */
   error: string | null;
+  /** Latest VM health probe, or null before the first probe */
+  health: VMHealth | null;
+  /** True while the backend is holding output back because this client is falling behind */
+  lagging: boolean;
+}
+
+/** Protocol features the backend reports when a subscription is accepted */
+interface StreamCapabilities {
+  schemaVersion: number;
+  binaryFrames: boolean;
+  resume: boolean;
+  multiplexing: boolean;
+  inputOverLive: boolean;
+  inputSeq?: boolean;
 }
 
 /** Terminal stream output message (sent from backend via SendJSON) */
 interface TerminalStreamOutput {
-  type: 'output' | 'error' | 'connected' | 'disconnected' | 'status' | 'heartbeat';
+  type:
+    | 'output'
+    | 'error'
+    | 'connected'
+    | 'disconnected'
+    | 'status'
+    | 'heartbeat'
+    | 'health'
+    | 'capabilities'
+    | 'lag'
+    | 'replay'
+    | 'draining';
   data?: string;
   error?: string;
-  state?: string; // VM state for 'status' type: 'pending', 'provisioning', 'active'
+  // VM state for 'status' type: 'pending', 'provisioning', 'active'; 'lagging' or 'ok' for 'lag';
+  // 'ok' or 'truncated' for 'replay'
+  state?: string;
   message?: string; // Human-readable status message
   vmId?: string; // Actual VM ID being used (sent by backend with 'connected' and 'status')
+  health?: VMHealth; // Probe result for 'health' type
+  capabilities?: StreamCapabilities; // Sent once as the subscription's initial data
+  seq?: number; // Heartbeat number, echoed back in 'pong'; output number, sent back in 'resume'
+  countdown?: number; // Seconds until the backend restarts, sent with 'draining'
+  correlationId?: string; // Session ID, sent with 'connected' and 'error'
+  schemaVersion?: number; // Frame schema version (see pkg/plugin/stream_schema.go)
 }
 
+/**
+ * Frame schema version this client understands. Sent on every input so the
+ * backend only streams message types this client can handle.
+ */
+const TERMINAL_SCHEMA_VERSION = 1;
+
 // ─── Provision progress bar ──────────────────────────────────────────────────
 // Rendered inline in xterm via \r to overwrite the current line every 500ms.
 // Uses an asymptotic ease-out curve so the bar never freezes: it reaches ~38%
@@ -122,6 +179,8 @@ function renderProvisionProgress(label: string, elapsedMs: number, complete = fa
 export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTerminalLiveReturn {
   const [status, setStatus] = useState<ConnectionStatus>('disconnected');
   const [error, setError] = useState<string | null>(null);
+  const [health, setHealth] = useState<VMHealth | null>(null);
+  const [lagging, setLagging] = useState(false);
 
   const connectionLogRef = useRef<ConnectionLog>(createConnectionLog());
 
@@ -135,6 +194,17 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
   // Grafana Live publish refs: populated in connectLiveStream, read by sendInput/sendResize
   const liveSrvRef = useRef<GrafanaLiveSrv | undefined>(undefined);
   const addressRef = useRef<LiveChannelAddress | null>(null);
+  // Capabilities of the backend serving the current channel; null until reported
+  const backendCapabilitiesRef = useRef<StreamCapabilities | null>(null);
+  // Output replay after a Live reconnect: last output seq written, whether the
+  // channel dropped mid-session, and whether a replay has been requested
+  const outputSeqRef = useRef(0);
+  const reconnectingRef = useRef(false);
+  const awaitingReplayRef = useRef(false);
+  // Replay protection for input and paste: the session from 'connected' and
+  // the last inputSeq sent in it (see pkg/plugin/input_replay.go)
+  const sessionIdRef = useRef<string | null>(null);
+  const inputSeqRef = useRef(0);
 
   // Provision progress bar state (animated bar during pending/provisioning)
   const provisionProgressRef = useRef<{
@@ -164,6 +234,13 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
       provisionProgressRef.current = null;
     }
     lastStatusLineRef.current = '';
+    setHealth(null);
+    setLagging(false);
+    outputSeqRef.current = 0;
+    reconnectingRef.current = false;
+    awaitingReplayRef.current = false;
+    sessionIdRef.current = null;
+    inputSeqRef.current = 0;
     liveSrvRef.current = undefined;
     addressRef.current = null;
   }, []);
@@ -184,11 +261,24 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
    * stream, causing a 404.
    */
   const publishOverSocket = useCallback(
-    (address: LiveChannelAddress, data: unknown) =>
-      (liveSrvRef.current as any)?.publish(address, data, { useSocket: true }),
+    (address: LiveChannelAddress, data: Record<string, unknown>) =>
+      (liveSrvRef.current as any)?.publish(
+        address,
+        { ...data, schemaVersion: TERMINAL_SCHEMA_VERSION },
+        { useSocket: true }
+      ),
     []
   );
 
+  /** sessionId and the next inputSeq for an input or paste message, once the session is known */
+  const nextInputSeq = useCallback((): Record<string, unknown> => {
+    if (!sessionIdRef.current) {
+      return {};
+    }
+    inputSeqRef.current += 1;
+    return { sessionId: sessionIdRef.current, inputSeq: inputSeqRef.current };
+  }, []);
+
   /**
    * Send input to the terminal via Grafana Live publish.
    * Publishes a plain object to the same channel used by RunStream/SubscribeStream.
@@ -201,12 +291,33 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
       }
 
       try {
-        await publishOverSocket(address, { type: 'input', data: inputData });
+        await publishOverSocket(address, { type: 'input', data: inputData, ...nextInputSeq() });
       } catch {
         // Input publish failures are transient; ignore silently
       }
     },
-    [publishOverSocket]
+    [publishOverSocket, nextInputSeq]
+  );
+
+  /**
+   * Send pasted text via Grafana Live publish. The backend wraps it in
+   * bracketed paste markers when the shell has enabled them and writes it in
+   * chunks, so multi-line blocks are inserted intact instead of run line by line.
+   */
+  const sendPaste = useCallback(
+    async (text: string) => {
+      const address = addressRef.current;
+      if (!liveSrvRef.current || !address) {
+        return;
+      }
+
+      try {
+        await publishOverSocket(address, { type: 'paste', data: text, ...nextInputSeq() });
+      } catch {
+        // Paste publish failures are transient; ignore silently
+      }
+    },
+    [publishOverSocket, nextInputSeq]
   );
 
   /**
@@ -228,6 +339,49 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
     [publishOverSocket]
   );
 
+  /**
+   * Acknowledge a backend heartbeat. Once a client has acknowledged one, the
+   * backend ends the session if acknowledgements stop, so a dead tab doesn't
+   * hold the VM connection open.
+   */
+  const sendPong = useCallback(
+    async (seq: number) => {
+      const address = addressRef.current;
+      if (!liveSrvRef.current || !address) {
+        return;
+      }
+
+      try {
+        await publishOverSocket(address, { type: 'pong', seq });
+      } catch {
+        // A missed pong is tolerated; the backend only reacts to a long gap
+      }
+    },
+    [publishOverSocket]
+  );
+
+  /**
+   * Ask the backend to replay output after the last one received, once the
+   * Live channel is back after a transient disconnect.
+   */
+  const sendResume = useCallback(
+    async (seq: number) => {
+      const address = addressRef.current;
+      if (!liveSrvRef.current || !address) {
+        return;
+      }
+
+      awaitingReplayRef.current = true;
+      try {
+        await publishOverSocket(address, { type: 'resume', seq });
+      } catch {
+        // The session is gone; a fresh RunStream will send 'connected'
+        awaitingReplayRef.current = false;
+      }
+    },
+    [publishOverSocket]
+  );
+
   /**
    * Parse terminal output from a Grafana Live message.
    * With SendJSON, messages arrive as raw JSON objects (not wrapped in DataFrame).
@@ -280,6 +434,7 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
       // Encode optional template and app as additional path segments:
       //   terminal/{id}/{nonce}                         → default (vm-aws)
       //   terminal/{id}/{nonce}/{template}/{app}         → custom template with app
+      //   terminal/{id}/{nonce}/guide.{guideId}          → template mapped to the guide
       let channelPathStr = `terminal/${id}/${nonce}`;
       if (vmOpts?.template && vmOpts.template !== 'vm-aws') {
         channelPathStr += `/${vmOpts.template}`;
@@ -288,6 +443,8 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
         } else if (vmOpts.app) {
           channelPathStr += `/${vmOpts.app}`;
         }
+      } else if (!vmOpts?.template && vmOpts?.guide) {
+        channelPathStr += `/guide.${toChannelSegment(vmOpts.guide)}`;
       }
       const address: LiveChannelAddress = {
         scope: LiveChannelScope.Plugin,
@@ -387,11 +544,30 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
                   break;
 
                 case 'output':
+                  if (typeof msg.seq === 'number') {
+                    // Skip output already written, and output past a gap the
+                    // requested replay is about to fill
+                    if (msg.seq <= outputSeqRef.current) {
+                      break;
+                    }
+                    if (awaitingReplayRef.current && msg.seq > outputSeqRef.current + 1) {
+                      break;
+                    }
+                    outputSeqRef.current = msg.seq;
+                  }
                   if (msg.data) {
                     terminal.write(msg.data);
                   }
                   break;
 
+                case 'replay':
+                  awaitingReplayRef.current = false;
+                  outputSeqRef.current = msg.seq ?? outputSeqRef.current;
+                  if (msg.state === 'truncated') {
+                    terminal.writeln('\r\n\x1b[33m⚠ Some output was lost while disconnected\x1b[0m');
+                  }
+                  break;
+
                 case 'error':
                   connectionLogRef.current.error('Backend error received', null, {
                     vmId: id,
@@ -416,6 +592,13 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
                     handshakeTimeoutRef.current = null;
                   }
 
+                  // A new RunStream numbers its output from 1 and is a new
+                  // session for input replay protection
+                  outputSeqRef.current = 0;
+                  awaitingReplayRef.current = false;
+                  sessionIdRef.current = msg.correlationId ?? null;
+                  inputSeqRef.current = 0;
+
                   // Update current VM ID ref from backend
                   if (msg.vmId) {
                     currentVmIdRef.current = msg.vmId;
@@ -467,7 +650,36 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
                   break;
 
                 case 'heartbeat':
-                  // Silently ignore - backend sends these every 3s to keep stream alive
+                  // Backend pings every 3s to keep the stream alive and detect dead subscribers
+                  if (typeof msg.seq === 'number') {
+                    void sendPong(msg.seq);
+                  }
+                  break;
+
+                case 'health':
+                  setHealth(msg.health ?? null);
+                  break;
+
+                case 'lag':
+                  setLagging(msg.state === 'lagging');
+                  break;
+
+                case 'draining':
+                  // Backend is about to restart; the VM survives and a reconnect reattaches to it
+                  terminal.writeln(`\r\n\x1b[33m⚠ ${msg.message || 'Pathfinder is restarting'}\x1b[0m`);
+                  break;
+
+                case 'capabilities':
+                  backendCapabilitiesRef.current = msg.capabilities ?? null;
+                  // Live publish is the only input mode this client implements
+                  if (msg.capabilities?.inputOverLive === false) {
+                    connectionLogRef.current.warn('Backend does not accept input over Live', {
+                      vmId: id,
+                      category: 'unsupported_backend',
+                    });
+                    setError('This Pathfinder backend does not accept terminal input from this version of the app');
+                    setStatus('error');
+                  }
                   break;
               }
             }
@@ -475,12 +687,26 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
 
           if (isLiveChannelStatusEvent(event)) {
             if (event.state === LiveChannelConnectionState.Connected) {
-              terminal.writeln('\x1b[90m       Waiting for SSH handshake...\x1b[0m');
+              if (reconnectingRef.current) {
+                reconnectingRef.current = false;
+                terminal.writeln('\r\n\x1b[32m✓ Reconnected\x1b[0m');
+                setStatus('connected');
+                void sendResume(outputSeqRef.current);
+              } else {
+                terminal.writeln('\x1b[90m       Waiting for SSH handshake...\x1b[0m');
+              }
             } else if (event.state === LiveChannelConnectionState.Disconnected) {
               connectionLogRef.current.warn('LiveStream disconnected', {
                 vmId: id,
                 category: 'live_channel_disconnected',
               });
+              // Keep the session when the backend can replay what we miss
+              if (backendCapabilitiesRef.current?.resume && inputDisposerRef.current) {
+                reconnectingRef.current = true;
+                terminal.writeln('\r\n\x1b[33m⚠ Connection lost, reconnecting...\x1b[0m');
+                setStatus('connecting');
+                return;
+              }
               if (inputDisposerRef.current) {
                 inputDisposerRef.current.dispose();
                 inputDisposerRef.current = null;
@@ -531,7 +757,7 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
         },
       });
     },
-    [cleanup, parseTerminalOutput, sendInput, sendResize]
+    [cleanup, parseTerminalOutput, sendInput, sendResize, sendPong, sendResume]
   );
 
   /**
@@ -612,7 +838,9 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
   );
 
   /**
-   * Send a command to the terminal (appends newline to execute)
+   * Send a command to the terminal (appends newline to execute).
+   * Multi-line commands go through sendPaste so the shell receives the block
+   * as a single paste before the final newline runs it.
    */
   const sendCommand = useCallback(
     async (command: string) => {
@@ -620,9 +848,14 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
         connectionLogRef.current.warn('Cannot send command: not connected');
         return;
       }
+      if (command.includes('\n')) {
+        await sendPaste(command);
+        await sendInput('\n');
+        return;
+      }
       await sendInput(command + '\n');
     },
-    [sendInput]
+    [sendInput, sendPaste]
   );
 
   return {
@@ -632,5 +865,7 @@ export function useTerminalLive({ terminalRef }: UseTerminalLiveOptions): UseTer
     resize,
     sendCommand,
     error,
+    health,
+    lagging,
   };
 }
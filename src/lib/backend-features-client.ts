@@ -0,0 +1,74 @@
+import { useEffect, useState } from 'react';
+import { getBackendSrv } from '@grafana/runtime';
+
+import { PLUGIN_BACKEND_URL } from '../constants';
+
+/**
+ * Backend capabilities an admin can switch off in the plugin settings
+ * (`jsonData.features`). Mirrors `handleFeatures` in `pkg/plugin/features.go`.
+ */
+export interface BackendFeatures {
+  terminal: boolean;
+  vmProvisioning: boolean;
+  customGuides: boolean;
+  analytics: boolean;
+}
+
+const ALL_ENABLED: BackendFeatures = {
+  terminal: true,
+  vmProvisioning: true,
+  customGuides: true,
+  analytics: true,
+};
+
+let inFlight: Promise<BackendFeatures> | null = null;
+
+/**
+ * Fetch the backend feature flags once per page load. Resolves to all
+ * features enabled when the backend is unreachable, so an older backend
+ * without `/features` keeps today's behavior. Never throws.
+ */
+export function fetchBackendFeatures(): Promise<BackendFeatures> {
+  if (!inFlight) {
+    inFlight = performFetch();
+  }
+  return inFlight;
+}
+
+async function performFetch(): Promise<BackendFeatures> {
+  try {
+    const response = await getBackendSrv().get<Partial<BackendFeatures>>(
+      `${PLUGIN_BACKEND_URL}/features`,
+      undefined,
+      undefined,
+      {
+        showErrorAlert: false,
+        showSuccessAlert: false,
+      }
+    );
+    return { ...ALL_ENABLED, ...response };
+  } catch {
+    return ALL_ENABLED;
+  }
+}
+
+/** React hook over `fetchBackendFeatures`; all enabled until the fetch resolves. */
+export function useBackendFeatures(): BackendFeatures {
+  const [features, setFeatures] = useState<BackendFeatures>(ALL_ENABLED);
+  useEffect(() => {
+    let cancelled = false;
+    fetchBackendFeatures().then((result) => {
+      if (!cancelled) {
+        setFeatures(result);
+      }
+    });
+    return () => {
+      cancelled = true;
+    };
+  }, []);
+  return features;
+}
+
+export function __resetBackendFeaturesClientForTests(): void {
+  inFlight = null;
+}
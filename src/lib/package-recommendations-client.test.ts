@@ -66,7 +66,7 @@ describe('fetchOnlinePackageRecommendations', () => {
     const result = await fetchOnlinePackageRecommendations();
 
     expect(mockGet).toHaveBeenCalledWith(
-      '/api/plugins/grafana-pathfinder-app/resources/package-recommendations',
+      '/api/plugins/grafana-pathfinder-app/resources/v1/package-recommendations',
       undefined,
       undefined,
       expect.objectContaining({ showErrorAlert: false })
@@ -38,7 +38,7 @@ describe('codaExitZeroCheck', () => {
     expect(result.pass).toBe(true);
     expect(fetch).toHaveBeenCalledWith(
       expect.objectContaining({
-        url: '/api/plugins/grafana-pathfinder-app/resources/coda/exec',
+        url: '/api/plugins/grafana-pathfinder-app/resources/v1/coda/exec',
         method: 'POST',
         data: expect.objectContaining({ command: 'test -f /etc/foo', mode: 'gated' }),
         showErrorAlert: false,
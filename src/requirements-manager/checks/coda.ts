@@ -17,7 +17,7 @@ import type { CheckResultError } from '../../types/requirements.types';
 import { getBackendSrv } from '@grafana/runtime';
 import { lastValueFrom } from 'rxjs';
 
-const CODA_EXEC_URL = '/api/plugins/grafana-pathfinder-app/resources/coda/exec';
+const CODA_EXEC_URL = '/api/plugins/grafana-pathfinder-app/resources/v1/coda/exec';
 
 interface CodaExecResponse {
   stdout: string;